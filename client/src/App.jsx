@@ -35,6 +35,7 @@ function App() {
   const reconnectAttemptRef = useRef(0);
   const reconnectTimerRef = useRef(null);
   const activeSocketRef = useRef(null);
+  const goingAwayRef = useRef(null);
 
   useEffect(() => {
     let cancelled = false;
@@ -118,10 +119,10 @@ function App() {
       }
     };
 
-    const scheduleReconnect = () => {
+    const scheduleReconnect = (hintMs) => {
       clearReconnect();
       const attempt = reconnectAttemptRef.current;
-      const delay = Math.min(1000 * (2 ** attempt), 15000);
+      const delay = hintMs ?? Math.min(1000 * (2 ** attempt), 15000);
       reconnectAttemptRef.current = attempt + 1;
 
       reconnectTimerRef.current = setTimeout(() => {
@@ -137,8 +138,12 @@ function App() {
           return;
         }
 
-        setWsStatus("connecting");
-        setOnlineUsers([]);
+        // A planned restart keeps the last presence list and shows
+        // "Reconnecting" instead of blanking the app.
+        if (!goingAwayRef.current) {
+          setWsStatus("connecting");
+          setOnlineUsers([]);
+        }
 
         let nextToken = getAccessToken();
         try {
@@ -173,6 +178,7 @@ function App() {
             return;
           }
           reconnectAttemptRef.current = 0;
+          goingAwayRef.current = null;
           setWsStatus("online");
           setSyncToken((current) => current + 1);
         };
@@ -183,13 +189,20 @@ function App() {
           }
           activeSocketRef.current = null;
           setWs(null);
+          const goingAway = goingAwayRef.current;
+          if (goingAway && Date.now() < goingAway.graceUntil) {
+            setWsStatus("reconnecting");
+            scheduleReconnect(goingAway.retryAfterMs);
+            return;
+          }
+          goingAwayRef.current = null;
           setWsStatus("offline");
           setOnlineUsers([]);
           scheduleReconnect();
         };
 
         socket.onerror = () => {
-          if (activeSocketRef.current !== socket) {
+          if (activeSocketRef.current !== socket || goingAwayRef.current) {
             return;
           }
           setWsStatus("offline");
@@ -208,6 +221,11 @@ function App() {
             console.error("Received invalid WebSocket payload:", err);
             return;
           }
+          if (message.type === "server_going_away") {
+            const retryAfterMs = message.retry_after_ms || 1000;
+            goingAwayRef.current = { retryAfterMs, graceUntil: Date.now() + retryAfterMs + 30000 };
+            return;
+          }
           if (message.type === "presence_state") {
             setOnlineUsers(normalizeOnlineUsers(message.users || []));
             return;
@@ -296,7 +314,7 @@ function App() {
       );
     }
 
-    if (!ws && wsStatus !== "offline") {
+    if (!ws && wsStatus === "connecting") {
       return <div className="status-block">Connecting...</div>;
     }
 
@@ -345,7 +363,13 @@ function App() {
         {isLoggedIn && !selectedContact && (
           <div className={`connection-pill ${wsStatus}`}>
             <span className="connection-dot" />
-            {wsStatus === "online" ? "Connected" : wsStatus === "connecting" ? "Connecting" : "Offline"}
+            {wsStatus === "online"
+              ? "Connected"
+              : wsStatus === "connecting"
+                ? "Connecting"
+                : wsStatus === "reconnecting"
+                  ? "Reconnecting"
+                  : "Offline"}
           </div>
         )}
         {renderContent()}
@@ -365,6 +365,50 @@ export const rejectInvite = (inviteID) =>
     body: JSON.stringify({ invite_id: inviteID }),
   });
 
+export const getOutgoingInvites = () => apiRequest("/api/invites/outgoing");
+
+export const cancelInvite = (inviteID) =>
+  apiRequest("/api/invites/cancel", {
+    method: "POST",
+    body: JSON.stringify({ invite_id: inviteID }),
+  });
+
+export const getInviteLinks = () => apiRequest("/api/invite-links");
+
+export const createInviteLink = ({ maxUses, expiresInHours } = {}) =>
+  apiRequest("/api/invite-links", {
+    method: "POST",
+    body: JSON.stringify({ max_uses: maxUses, expires_in_hours: expiresInHours }),
+  });
+
+export const revokeInviteLink = (linkID) =>
+  apiRequest("/api/invite-links", {
+    method: "DELETE",
+    body: JSON.stringify({ id: linkID }),
+  });
+
+export const redeemInviteLink = (code) =>
+  apiRequest("/api/invite-links/redeem", {
+    method: "POST",
+    body: JSON.stringify({ code }),
+  });
+
+export const searchUsers = (query, limit) => {
+  const params = new URLSearchParams({ q: query });
+  if (limit) {
+    params.set("limit", String(limit));
+  }
+  return apiRequest(`/api/users/search?${params.toString()}`);
+};
+
+export const getDiscoverability = () => apiRequest("/api/me/discoverability");
+
+export const updateDiscoverability = (discoverability) =>
+  apiRequest("/api/me/discoverability", {
+    method: "PUT",
+    body: JSON.stringify({ discoverability }),
+  });
+
 export const getMe = () => apiRequest("/api/me");
 
 export const updateMe = (profile) =>
@@ -119,6 +119,9 @@ function getDisplayedMessageBody(message, fallback = "No messages yet") {
   if (!message) {
     return fallback;
   }
+  if (getMessageContentKind(message) === "deleted") {
+    return "Message deleted";
+  }
   if (canUseMessageBodyForDisplay(message)) {
     if (!message.body && isEncryptedMessage(message)) {
       const contentKind = getMessageContentKind(message);
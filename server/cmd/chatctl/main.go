@@ -0,0 +1,179 @@
+// Command chatctl runs operator tasks against the SQLite database.
+//
+//	chatctl backup          [-db chat.db] [-dir backups] [-keep-last 7] [-keep-daily 14] [-keep-weekly 8] [-prune=true]
+//	chatctl restore         -from backups/chat-<time>.manifest.json [-db chat.db] [-force]
+//	chatctl integrity-check [-db chat.db]
+//	chatctl prune           [-dir backups] [-keep-last 7] [-keep-daily 14] [-keep-weekly 8]
+//	chatctl jobs            [-db chat.db] [-run job-name]
+//
+// backup is safe while the server is running; restore should be run with
+// the server stopped. jobs lists background job state; -run makes a job due
+// so a running server picks it up within 15 seconds. Paths default to the project root; -db defaults to
+// the server's DATABASE_PATH, read from CONFIG_FILE or the environment.
+// PostgreSQL deployments (DATABASE_URL) are backed up with pg_dump instead.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqlitejobs"
+	"github.com/kyambuthia/go-chat-site/server/internal/backup"
+	"github.com/kyambuthia/go-chat-site/server/internal/config"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+func main() {
+	root, err := findProjectRoot()
+	if err != nil {
+		log.Fatal("failed to find project root: ", err)
+	}
+	cfg, err := config.Load(os.Getenv(config.EnvConfigFile))
+	if err != nil {
+		log.Fatal("invalid configuration: ", err)
+	}
+	config.Install(cfg)
+	if err := run(context.Background(), os.Args[1:], os.Stdout, root, time.Now()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer, root string, now time.Time) error {
+	if len(args) == 0 {
+		return errors.New("usage: chatctl backup|restore|integrity-check|prune|jobs [flags]")
+	}
+	if config.DatabaseURL() != "" {
+		return fmt.Errorf("chatctl works on the SQLite database; %s is set, so back up PostgreSQL with pg_dump", config.EnvDatabaseURL)
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dbPath := fs.String("db", config.ResolvePath(root, config.DatabasePath()), "SQLite database file")
+	dir := fs.String("dir", filepath.Join(root, "backups"), "backup directory")
+	from := fs.String("from", "", "manifest of the backup to restore")
+	force := fs.Bool("force", false, "overwrite an existing database on restore")
+	prune := fs.Bool("prune", true, "apply the retention policy after a backup")
+	runJob := fs.String("run", "", "job to make due now")
+	var policy backup.Policy
+	fs.IntVar(&policy.KeepLast, "keep-last", 7, "newest backups to keep")
+	fs.IntVar(&policy.KeepDaily, "keep-daily", 14, "days to keep one backup for")
+	fs.IntVar(&policy.KeepWeekly, "keep-weekly", 8, "ISO weeks to keep one backup for")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "backup":
+		manifest, err := backup.Create(ctx, *dbPath, *dir, now)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "backed up %s to %s (schema %s, %d accounts, %d cents)\n",
+			*dbPath, manifest.Path, manifest.SchemaVersion, manifest.Check.Accounts, manifest.Check.TotalBalanceCents)
+		if !*prune {
+			return nil
+		}
+		return pruneBackups(stdout, *dir, policy)
+	case "restore":
+		if *from == "" {
+			return errors.New("-from is required")
+		}
+		if _, err := os.Stat(*dbPath); err == nil && !*force {
+			return fmt.Errorf("%s exists; stop the server and pass -force to replace it", *dbPath)
+		}
+		report, err := backup.Restore(ctx, *from, *dbPath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "restored %s from %s (%d accounts, %d cents)\n", *dbPath, *from, report.Accounts, report.TotalBalanceCents)
+		return nil
+	case "integrity-check":
+		report, err := backup.Check(ctx, *dbPath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "integrity: %s\nforeign key violations: %d\nledger: %d accounts, %d transfers, %d cents\n",
+			strings.Join(report.Integrity, "; "), report.ForeignKeyViolations, report.Accounts, report.Transfers, report.TotalBalanceCents)
+		for _, problem := range report.LedgerProblems {
+			fmt.Fprintf(stdout, "ledger problem: %s\n", problem)
+		}
+		if !report.OK() {
+			return fmt.Errorf("%w: %s", backup.ErrCheckFailed, report.Summary())
+		}
+		return nil
+	case "prune":
+		return pruneBackups(stdout, *dir, policy)
+	case "jobs":
+		return jobs(ctx, stdout, *dbPath, *runJob, now)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func pruneBackups(stdout io.Writer, dir string, policy backup.Policy) error {
+	removed, err := backup.Prune(dir, policy)
+	for _, manifest := range removed {
+		fmt.Fprintf(stdout, "pruned %s\n", manifest.Path)
+	}
+	return err
+}
+
+func jobs(ctx context.Context, stdout io.Writer, dbPath, runJob string, now time.Time) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		return err
+	}
+	s, err := store.NewSqliteStore(dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.DB.Close()
+	repo := &sqlitejobs.Adapter{DB: s.DB}
+
+	if runJob != "" {
+		if err := repo.ScheduleJob(ctx, runJob, now); err != nil {
+			return fmt.Errorf("%s: %w", runJob, err)
+		}
+		fmt.Fprintf(stdout, "%s is due now\n", runJob)
+		return nil
+	}
+	states, err := repo.ListJobs(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tNEXT RUN\tRUNS\tFAILURES\tLAST ITEMS\tLAST DURATION\tLEASE\tLAST ERROR")
+	for _, state := range states {
+		lease := "-"
+		if state.LeaseUntil != nil && state.LeaseUntil.After(now) {
+			lease = state.LeaseOwner + " until " + state.LeaseUntil.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\n", state.Name, state.NextRunAt.UTC().Format(time.RFC3339),
+			state.Runs, state.Failures, state.LastItems, state.LastDuration, lease, state.LastError)
+	}
+	return w.Flush()
+}
+
+func findProjectRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		if dir == "/" {
+			return "", errors.New("go.mod not found")
+		}
+		dir = filepath.Dir(dir)
+	}
+}
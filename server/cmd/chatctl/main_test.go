@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/config"
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+	"github.com/kyambuthia/go-chat-site/server/migrations"
+)
+
+func TestRun_BackupCheckAndRestore(t *testing.T) {
+	root := t.TempDir()
+	s, err := store.NewSqliteStore(filepath.Join(root, "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.Apply(s.DB, migrations.SQLite(), dialect.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateUser("alice", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var out bytes.Buffer
+
+	if err := run(ctx, []string{"backup"}, &out, root, now); err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(root, "backups", "chat-20260301T120000Z.manifest.json")
+	if !strings.Contains(out.String(), manifest) {
+		t.Fatalf("backup output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := run(ctx, []string{"integrity-check"}, &out, root, now); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "integrity: ok") {
+		t.Fatalf("integrity-check output = %q", out.String())
+	}
+
+	if err := run(ctx, []string{"restore", "-from", manifest}, &out, root, now); err == nil {
+		t.Fatal("expected restore over an existing database to need -force")
+	}
+	restored := filepath.Join(root, "restored.db")
+	if err := run(ctx, []string{"restore", "-from", manifest, "-db", restored}, &out, root, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(restored); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{nil, {"restore"}, {"explode"}, {"prune", "-keep-last", "0"}} {
+		if err := run(ctx, args, &out, root, now); err == nil {
+			t.Errorf("run(%q) succeeded, want error", args)
+		}
+	}
+
+	t.Setenv(config.EnvDatabaseURL, "postgres://localhost/chat")
+	if err := run(ctx, []string{"backup"}, &out, root, now); err == nil || !strings.Contains(err.Error(), "pg_dump") {
+		t.Fatalf("backup with DATABASE_URL error = %v", err)
+	}
+}
+
+func TestRun_JobsListsStateAndMakesAJobDue(t *testing.T) {
+	root := t.TempDir()
+	s, err := store.NewSqliteStore(filepath.Join(root, "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.Apply(s.DB, migrations.SQLite(), dialect.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := s.DB.Exec(`INSERT INTO scheduled_jobs (name, next_run_at, runs, failures, last_error) VALUES ('session_cleanup', ?, 4, 1, 'database is locked')`, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+
+	if err := run(ctx, []string{"jobs"}, &out, root, now); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "session_cleanup") || !strings.Contains(out.String(), "2026-03-01T13:00:00Z") || !strings.Contains(out.String(), "database is locked") {
+		t.Fatalf("jobs output = %q", out.String())
+	}
+
+	if err := run(ctx, []string{"jobs", "-run", "session_cleanup"}, &out, root, now); err != nil {
+		t.Fatal(err)
+	}
+	var next time.Time
+	if err := s.DB.QueryRow(`SELECT next_run_at FROM scheduled_jobs WHERE name = 'session_cleanup'`).Scan(&next); err != nil || !next.Equal(now) {
+		t.Fatalf("next_run_at = %v, %v", next, err)
+	}
+	if err := run(ctx, []string{"jobs", "-run", "no_such_job"}, &out, root, now); err == nil {
+		t.Fatal("expected an unknown job to be an error")
+	}
+}
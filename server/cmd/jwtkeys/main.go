@@ -0,0 +1,95 @@
+// Command jwtkeys manages the asymmetric JWT signing key file read from
+// JWT_KEYS_PATH.
+//
+//	jwtkeys generate -keys jwt-keys.json [-alg EdDSA|ES256] [-force]
+//	jwtkeys rotate   -keys jwt-keys.json [-alg EdDSA|ES256] [-window 24h]
+//	jwtkeys jwks     -keys jwt-keys.json
+//
+// The server reads the file at startup, so restart it after a rotation. The
+// previous key keeps verifying for -window, which must cover the longest
+// access-token lifetime.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, time.Now()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string, stdout io.Writer, now time.Time) error {
+	if len(args) == 0 {
+		return errors.New("usage: jwtkeys generate|rotate|jwks -keys <path>")
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	path := fs.String("keys", os.Getenv("JWT_KEYS_PATH"), "key set file")
+	alg := fs.String("alg", "", "signing algorithm: EdDSA or ES256")
+	window := fs.Duration("window", auth.DefaultKeyRotationWindow, "how long the previous key keeps verifying")
+	force := fs.Bool("force", false, "overwrite an existing key file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *path == "" {
+		return errors.New("-keys or JWT_KEYS_PATH is required")
+	}
+
+	switch args[0] {
+	case "generate":
+		if _, err := os.Stat(*path); err == nil && !*force {
+			return fmt.Errorf("%s already exists; use rotate, or -force to replace it", *path)
+		}
+		if *alg == "" {
+			*alg = auth.AlgEdDSA
+		}
+		keys, err := auth.NewKeySet(*alg, now)
+		if err != nil {
+			return err
+		}
+		if err := keys.Save(*path); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "generated %s key %s\n", *alg, keys.ActiveKID)
+		return nil
+	case "rotate":
+		if *window <= 0 {
+			return errors.New("-window must be positive")
+		}
+		keys, err := auth.LoadKeySet(*path)
+		if err != nil {
+			return err
+		}
+		previous := keys.ActiveKID
+		next, err := keys.Rotate(*alg, *window, now)
+		if err != nil {
+			return err
+		}
+		if err := keys.Save(*path); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "rotated to %s key %s; %s verifies until %s\n", next.Alg, next.KID, previous, now.UTC().Add(*window).Format(time.RFC3339))
+		return nil
+	case "jwks":
+		keys, err := auth.LoadKeySet(*path)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(keys.JWKS(now))
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+)
+
+func TestRun_GenerateRotateAndPublish(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt-keys.json")
+	now := time.Now()
+	var out bytes.Buffer
+
+	if err := run([]string{"generate", "-keys", path}, &out, now); err != nil {
+		t.Fatalf("generate error: %v", err)
+	}
+	if err := run([]string{"generate", "-keys", path}, &out, now); err == nil {
+		t.Fatal("expected generate to refuse to overwrite an existing key file")
+	}
+	first, err := auth.LoadKeySet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run([]string{"rotate", "-keys", path, "-alg", "ES256", "-window", "1h"}, &out, now); err != nil {
+		t.Fatalf("rotate error: %v", err)
+	}
+	rotated, err := auth.LoadKeySet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, _ := rotated.Active()
+	if active.Alg != auth.AlgES256 || rotated.ActiveKID == first.ActiveKID || len(rotated.Keys) != 2 {
+		t.Fatalf("rotated key set = %+v", rotated)
+	}
+
+	out.Reset()
+	if err := run([]string{"jwks", "-keys", path}, &out, now); err != nil {
+		t.Fatalf("jwks error: %v", err)
+	}
+	var jwks auth.JWKS
+	if err := json.Unmarshal(out.Bytes(), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 2 || jwks.Keys[0].KID != rotated.ActiveKID || jwks.Keys[1].KID != first.ActiveKID {
+		t.Fatalf("jwks = %+v", jwks)
+	}
+	if strings.Contains(out.String(), "private") {
+		t.Fatal("jwks output must not contain private key material")
+	}
+}
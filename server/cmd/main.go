@@ -2,21 +2,31 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/kyambuthia/go-chat-site/server/internal/adapters/transport/wsrelay"
 	"github.com/kyambuthia/go-chat-site/server/internal/api"
+	"github.com/kyambuthia/go-chat-site/server/internal/app"
 	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	"github.com/kyambuthia/go-chat-site/server/internal/config"
 	"github.com/kyambuthia/go-chat-site/server/internal/health"
 	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
 	"github.com/kyambuthia/go-chat-site/server/internal/store"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+	"github.com/kyambuthia/go-chat-site/server/migrations"
 )
 
 func main() {
@@ -24,32 +34,53 @@ func main() {
 	if err != nil {
 		log.Fatal("failed to find project root: ", err)
 	}
+	cfg, configPath, err := loadConfig(os.Args[1:], root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.Install(cfg)
 
-	logFile, err := os.OpenFile(filepath.Join(root, "server", "server.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o666)
+	logFile, err := os.OpenFile(cfg.Server.LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o666)
 	if err != nil {
 		log.Fatal("failed to open log file: ", err)
 	}
 	defer logFile.Close()
 	log.SetOutput(logFile)
+	log.Printf("effective config: %s", cfg)
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if err := auth.ConfigureJWT(jwtSecret); err != nil {
-		log.Fatal("invalid JWT_SECRET: ", err)
+	// With JWT_KEYS_PATH set, JWT_SECRET is optional and only verifies
+	// tokens issued before the switch to asymmetric keys.
+	keysPath := cfg.Auth.JWTKeysPath
+	if keysPath != "" {
+		keys, err := auth.LoadKeySet(keysPath)
+		if err != nil {
+			log.Fatal("invalid JWT_KEYS_PATH: ", err)
+		}
+		if err := auth.ConfigureKeySet(keys); err != nil {
+			log.Fatal("invalid JWT_KEYS_PATH: ", err)
+		}
+		auth.ConfigureLegacySecretUntil(config.JWTLegacySecretUntil())
+	}
+	jwtSecret := cfg.Auth.JWTSecret
+	if keysPath == "" || jwtSecret != "" {
+		if err := auth.ConfigureJWT(jwtSecret); err != nil {
+			log.Fatal("invalid JWT_SECRET: ", err)
+		}
 	}
 
-	dbPath := filepath.Join(root, "chat.db")
-	dbStore, err := store.NewSqliteStore(dbPath)
+	if cfg.Server.DatabaseURL != "" {
+		if err := app.CheckPostgresSupport(); err != nil {
+			log.Fatal("unsupported PostgreSQL configuration: ", err)
+		}
+	}
+	dbStore, db, err := openStore(cfg.Server)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer dbStore.DB.Close()
+	defer db.Close()
 
-	migrationsPath := filepath.Join(root, "server", "migrations")
-	if err := migrate.RunMigrations(dbStore.DB, migrationsPath); err != nil {
-		log.Fatal("migration failed: ", err)
-	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	if err := health.CheckDBReady(ctx, dbStore.DB); err != nil {
+	if err := health.CheckDBReady(ctx, db); err != nil {
 		cancel()
 		log.Fatal("startup readiness check failed: ", err)
 	}
@@ -59,13 +90,11 @@ func main() {
 	go hub.Run()
 	defer hub.Shutdown()
 
-	handler := api.NewAPI(dbStore, hub)
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	wiring := app.NewWiring(dbStore)
+	handler := api.NewAPIWithWiring(dbStore, hub, wiring)
+	wiring.Start(context.Background())
 
+	port := strconv.Itoa(cfg.Server.Port)
 	log.Printf("server listening on port %s", port)
 	server := &http.Server{
 		Addr:              ":" + port,
@@ -77,20 +106,157 @@ func main() {
 		MaxHeaderBytes:    1 << 20, // 1 MiB
 	}
 
+	ln, err := listen(server.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 		defer signal.Stop(sigCh)
 
-		<-sigCh
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		_ = server.Shutdown(ctx)
+		for sig := range sigCh {
+			if sig == syscall.SIGHUP {
+				reloadConfig(configPath, hub)
+				continue
+			}
+			shutdown(server, hub, wiring, time.Duration(cfg.Server.ShutdownTimeoutSeconds)*time.Second)
+			return
+		}
 	}()
 
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
+	<-stopped
+}
+
+// wsReconnectSpread is the window over which WebSocket clients are told to
+// reconnect during a drain, so the next process is not hit all at once.
+const wsReconnectSpread = 5 * time.Second
+
+// shutdown tells WebSocket clients to reconnect elsewhere, stops accepting
+// HTTP requests and then drains the hub: in-flight relay sends finish and
+// queued receipts are flushed before each socket closes with code 1001.
+// Background loops stop last, since draining requests may still queue work.
+func shutdown(server *http.Server, hub *wsrelay.Hub, wiring *app.Wiring, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	defer wiring.Stop()
+
+	log.Printf("shutdown started: draining for up to %s", timeout)
+	hub.BeginDrain(wsReconnectSpread)
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("http shutdown: %v", err)
+	}
+	if err := hub.Drain(ctx, wsReconnectSpread); err != nil {
+		log.Printf("websocket drain incomplete, closing remaining sockets: %v", err)
+		return
+	}
+	log.Printf("shutdown complete")
+}
+
+// listen uses the socket passed by systemd socket activation when there is
+// one, so a restart never refuses connections: the socket stays open while
+// the old process drains and the new one starts. Otherwise it binds addr.
+func listen(addr string) (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()) && os.Getenv("LISTEN_FDS") == "1" {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+		f := os.NewFile(3, "systemd-socket")
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("activated socket: %w", err)
+		}
+		log.Printf("using socket passed by systemd")
+		return ln, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// loadConfig reads the file named by -config, or by CONFIG_FILE when the
+// flag is absent, applies environment overrides and resolves relative paths
+// against root. It returns the file path so a reload reads the same file.
+func loadConfig(args []string, root string) (*config.Config, string, error) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(config.EnvConfigFile), "JSON configuration file")
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	cfg, err := config.Load(*path)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	cfg.ResolvePaths(root)
+	return cfg, *path, nil
+}
+
+// reloadConfig applies new rate limits, WebSocket origins and the legacy
+// JWT secret cutoff on SIGHUP, and re-reads the JWT key file so a rotated
+// set takes effect without a restart. A file that fails validation is
+// rejected and the running values are kept. New frame limits apply to
+// connections opened after the reload.
+func reloadConfig(path string, hub interface{ SetRateLimits(wsrelay.RateLimits) }) {
+	cfg, pending, err := config.Reload(path)
+	if err != nil {
+		log.Printf("config reload rejected: %v", err)
+		return
+	}
+	hub.SetRateLimits(wsrelay.RateLimitsFromConfig())
+	if keysPath := config.JWTKeysPath(); keysPath != "" {
+		reloadKeySet(keysPath)
+		auth.ConfigureLegacySecretUntil(config.JWTLegacySecretUntil())
+	}
+	if len(pending) > 0 {
+		log.Printf("config reload: restart to apply %s", strings.Join(pending, ", "))
+	}
+	log.Printf("config reloaded: %s", cfg)
+}
+
+// reloadKeySet swaps in the key set at path. A file that fails to load keeps
+// the running set, so a bad edit cannot lock every user out.
+func reloadKeySet(path string) {
+	keys, err := auth.LoadKeySet(path)
+	if err == nil {
+		err = auth.ConfigureKeySet(keys)
+	}
+	if err != nil {
+		log.Printf("JWT key set reload rejected: %v", err)
+		return
+	}
+	log.Printf("JWT key set reloaded from %s", path)
+}
+
+// openStore connects to PostgreSQL when DATABASE_URL is set and to the SQLite
+// database at DATABASE_PATH otherwise, then applies that backend's embedded
+// migration set.
+func openStore(cfg config.ServerConfig) (store.APIStore, *sql.DB, error) {
+	if dsn := cfg.DatabaseURL; dsn != "" {
+		pgStore, err := store.NewPostgresStore(dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := migrate.Apply(pgStore.DB, migrations.Postgres(), dialect.Postgres); err != nil {
+			_ = pgStore.DB.Close()
+			return nil, nil, fmt.Errorf("migration failed: %w", err)
+		}
+		return pgStore, pgStore.DB, nil
+	}
+
+	sqliteStore, err := store.NewSqliteStore(cfg.DatabasePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := migrate.Apply(sqliteStore.DB, migrations.SQLite(), dialect.SQLite); err != nil {
+		_ = sqliteStore.DB.Close()
+		return nil, nil, fmt.Errorf("migration failed: %w", err)
+	}
+	return sqliteStore, sqliteStore.DB, nil
 }
 
 func findProjectRoot() (string, error) {
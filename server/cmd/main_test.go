@@ -3,7 +3,10 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/config"
 )
 
 func TestFindProjectRoot_FindsNearestGoMod(t *testing.T) {
@@ -33,3 +36,28 @@ func TestFindProjectRoot_FindsNearestGoMod(t *testing.T) {
 		t.Fatalf("root = %q, want %q", root, tmp)
 	}
 }
+
+func TestLoadConfig_ReadsFlagAndResolvesPaths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"server": {"database_path": "data/chat.db", "log_path": "/var/log/chat.log"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(config.EnvConfigFile, "")
+
+	cfg, configPath, err := loadConfig([]string{"-config", path}, "/srv/chat")
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if configPath != path {
+		t.Fatalf("config path = %q, want %q", configPath, path)
+	}
+	if cfg.Server.DatabasePath != filepath.Join("/srv/chat", "data", "chat.db") || cfg.Server.LogPath != "/var/log/chat.log" {
+		t.Fatalf("server paths = %+v", cfg.Server)
+	}
+
+	t.Setenv(config.EnvConfigFile, path)
+	t.Setenv(config.EnvPort, "99999")
+	if _, _, err := loadConfig(nil, "/srv/chat"); err == nil || !strings.Contains(err.Error(), "server.port") {
+		t.Fatalf("out-of-range port err = %v", err)
+	}
+}
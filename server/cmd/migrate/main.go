@@ -1,35 +1,163 @@
+// Command migrate manages the schema of the database the server uses:
+// DATABASE_PATH under the project root (chat.db by default), or PostgreSQL
+// when DATABASE_URL is set. Both are read from CONFIG_FILE or the
+// environment, as the server reads them.
+//
+//	migrate            apply every pending migration
+//	migrate up [N]     apply the next N pending migrations (all when omitted)
+//	migrate down N     revert the N most recently applied migrations
+//	migrate status     list every version and whether it is applied
+//	migrate verify     fail if an applied migration was modified or is unknown
+//
+// Migrations are embedded in the binary, so it does not need the source tree.
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"text/tabwriter"
 
+	"github.com/kyambuthia/go-chat-site/server/internal/config"
 	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+	"github.com/kyambuthia/go-chat-site/server/migrations"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
-	root, err := findProjectRoot()
+	cfg, err := config.Load(os.Getenv(config.EnvConfigFile))
 	if err != nil {
-		log.Fatal("Failed to find project root:", err)
+		log.Fatal("invalid configuration: ", err)
 	}
-	dbPath := filepath.Join(root, "chat.db")
-
-	db, err := sql.Open("sqlite3", dbPath)
+	config.Install(cfg)
+	db, d, err := openDB()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
-
-	migrationsPath := filepath.Join(root, "server", "migrations")
-	if err := migrate.RunMigrations(db, migrationsPath); err != nil {
+	m, err := migrate.New(db, migrations.For(d), d)
+	if err == nil {
+		err = run(context.Background(), os.Args[1:], os.Stdout, m)
+	}
+	_ = db.Close()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// openDB follows the server: DATABASE_URL selects PostgreSQL, otherwise
+// DATABASE_PATH under the project root.
+func openDB() (*sql.DB, dialect.Dialect, error) {
+	if dsn := config.DatabaseURL(); dsn != "" {
+		pgStore, err := store.NewPostgresStore(dsn)
+		if err != nil {
+			return nil, dialect.Postgres, err
+		}
+		return pgStore.DB, dialect.Postgres, nil
+	}
+
+	root, err := findProjectRoot()
+	if err != nil {
+		return nil, dialect.SQLite, fmt.Errorf("failed to find project root: %w", err)
+	}
+	db, err := sql.Open("sqlite3", config.ResolvePath(root, config.DatabasePath()))
+	return db, dialect.SQLite, err
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer, m *migrate.Migrator) error {
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "up":
+		n, err := count(args, 0)
+		if err != nil {
+			return err
+		}
+		applied, err := m.Up(ctx, n)
+		if err != nil {
+			return err
+		}
+		for _, migration := range applied {
+			fmt.Fprintf(stdout, "applied %s\n", migration.Name)
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(stdout, "no pending migrations")
+		}
+		return nil
+	case "down":
+		if len(args) != 1 {
+			return errors.New("usage: migrate down N")
+		}
+		n, err := count(args, 0)
+		if err != nil {
+			return err
+		}
+		reverted, err := m.Down(ctx, n)
+		if err != nil {
+			return err
+		}
+		for _, migration := range reverted {
+			fmt.Fprintf(stdout, "reverted %s\n", migration.Name)
+		}
+		return nil
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		for _, s := range statuses {
+			state := "pending"
+			switch {
+			case s.Missing:
+				state = "applied, not in this binary"
+			case s.Modified:
+				state = "applied, MODIFIED"
+			case s.Applied:
+				state = "applied"
+			}
+			down := ""
+			if !s.Missing && !s.HasDown {
+				down = "no down"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Version, state, s.Name, down)
+		}
+		return w.Flush()
+	case "verify":
+		if err := m.Verify(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "ok")
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q; usage: migrate [up [N] | down N | status | verify]", command)
+	}
+}
+
+func count(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+	if len(args) > 1 {
+		return 0, errors.New("too many arguments")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid count %q", args[0])
+	}
+	return n, nil
+}
+
 func findProjectRoot() (string, error) {
 	dir, err := os.Getwd()
 	if err != nil {
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+	"github.com/kyambuthia/go-chat-site/server/migrations"
 )
 
 func TestFindProjectRoot_FindsNearestGoMod(t *testing.T) {
@@ -33,3 +41,56 @@ func TestFindProjectRoot_FindsNearestGoMod(t *testing.T) {
 		t.Fatalf("root = %q, want %q", root, tmp)
 	}
 }
+
+func TestRun_UpStatusDownVerify(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	m, err := migrate.New(db, migrations.SQLite(), dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	if err := run(ctx, []string{"up", "2"}, &out, m); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "applied 0001_init.sql") || !strings.Contains(out.String(), "applied 0002_") {
+		t.Fatalf("up 2 output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := run(ctx, []string{"status"}, &out, m); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(m.Migrations()) || !strings.Contains(lines[1], "applied") || !strings.Contains(lines[2], "pending") {
+		t.Fatalf("status output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := run(ctx, []string{"down", "1"}, &out, m); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "reverted 0002_") {
+		t.Fatalf("down output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := run(ctx, nil, &out, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(ctx, []string{"verify"}, &out, m); err != nil {
+		t.Fatalf("verify error: %v", err)
+	}
+
+	for _, args := range [][]string{{"down"}, {"down", "0"}, {"up", "x"}, {"sideways"}} {
+		if err := run(ctx, args, &out, m); err == nil {
+			t.Errorf("run(%q) succeeded, want usage error", args)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Command vapidkeys generates a VAPID key pair for Web Push.
+//
+//	vapidkeys generate
+//
+// It prints WEBPUSH_VAPID_PRIVATE_KEY for the server's environment, and the
+// public key browsers receive from GET /api/me/push. Replacing the key
+// invalidates every existing browser subscription.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webpush"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	if len(args) != 1 || args[0] != "generate" {
+		return errors.New("usage: vapidkeys generate")
+	}
+	private, err := webpush.GenerateVAPIDKey()
+	if err != nil {
+		return err
+	}
+	key, err := webpush.ParseVAPIDKey(private)
+	if err != nil {
+		return err
+	}
+	public, err := webpush.PublicKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "WEBPUSH_VAPID_PRIVATE_KEY=%s\n# public key: %s\n", private, public)
+	return err
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webpush"
+)
+
+func TestRun_GeneratePrintsUsableKey(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"generate"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	line, _, _ := strings.Cut(out.String(), "\n")
+	private, ok := strings.CutPrefix(line, "WEBPUSH_VAPID_PRIVATE_KEY=")
+	if !ok {
+		t.Fatalf("output = %q", out.String())
+	}
+	if _, err := webpush.ParseVAPIDKey(private); err != nil {
+		t.Fatalf("generated key does not parse: %v", err)
+	}
+	if err := run(nil, &out); err == nil {
+		t.Fatal("expected usage error")
+	}
+}
@@ -0,0 +1,213 @@
+package fsblob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+)
+
+// Store keeps attachment bytes on the local filesystem. In-progress uploads live
+// under staging/ and committed blobs under blobs/<first two hex chars>/<sha256>,
+// so identical files are stored once.
+type Store struct {
+	Root string
+}
+
+func New(root string) (*Store, error) {
+	if root == "" {
+		return nil, errors.New("blob store root is required")
+	}
+	for _, dir := range []string{filepath.Join(root, "staging"), filepath.Join(root, "blobs")} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{Root: root}, nil
+}
+
+func (s *Store) WriteChunk(_ context.Context, uploadID int64, offset int64, r io.Reader) (int64, error) {
+	f, err := os.OpenFile(s.stagingPath(uploadID), os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() < offset {
+		return 0, coreatt.ErrChunkOutOfOrder
+	}
+	// A previous write may have landed without its offset being recorded; drop
+	// those bytes so the staged file matches the upload's received count.
+	if info.Size() > offset {
+		if err := f.Truncate(offset); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return n, err
+	}
+	return n, f.Sync()
+}
+
+func (s *Store) Commit(_ context.Context, uploadID int64, expectedSHA256 string, transform coreatt.Transform) (coreatt.BlobInfo, error) {
+	staged := s.stagingPath(uploadID)
+	f, err := os.Open(staged)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return coreatt.BlobInfo{}, coreatt.ErrUploadNotFound
+		}
+		return coreatt.BlobInfo{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return coreatt.BlobInfo{}, err
+	}
+	blobID := hex.EncodeToString(h.Sum(nil))
+	if expectedSHA256 != "" && expectedSHA256 != blobID {
+		return coreatt.BlobInfo{}, coreatt.ErrChecksumMismatch
+	}
+	if transform == nil {
+		return s.place(staged, blobID, size)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return coreatt.BlobInfo{}, err
+	}
+	info, err := s.writeBlob(func(w io.Writer) error { return transform(w, f) })
+	if err != nil {
+		return coreatt.BlobInfo{}, err
+	}
+	if err := os.Remove(staged); err != nil {
+		return coreatt.BlobInfo{}, err
+	}
+	return info, nil
+}
+
+func (s *Store) Put(_ context.Context, r io.Reader) (coreatt.BlobInfo, error) {
+	return s.writeBlob(func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// writeBlob streams write into a temporary staging file while hashing it, then
+// moves the file under its content address.
+func (s *Store) writeBlob(write func(w io.Writer) error) (coreatt.BlobInfo, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.Root, "staging"), "blob-*.tmp")
+	if err != nil {
+		return coreatt.BlobInfo{}, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	h := sha256.New()
+	counter := &countingWriter{}
+	if err := write(io.MultiWriter(tmp, h, counter)); err != nil {
+		tmp.Close()
+		return coreatt.BlobInfo{}, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return coreatt.BlobInfo{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return coreatt.BlobInfo{}, err
+	}
+	return s.place(tmpPath, hex.EncodeToString(h.Sum(nil)), counter.n)
+}
+
+// place moves src to the blob path for blobID, or drops it when an identical
+// blob is already stored.
+func (s *Store) place(src string, blobID string, size int64) (coreatt.BlobInfo, error) {
+	dest := s.blobPath(blobID)
+	if _, err := os.Stat(dest); err == nil {
+		if err := os.Remove(src); err != nil {
+			return coreatt.BlobInfo{}, err
+		}
+		return coreatt.BlobInfo{ID: blobID, SizeBytes: size}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+		return coreatt.BlobInfo{}, err
+	}
+	if err := os.Rename(src, dest); err != nil {
+		return coreatt.BlobInfo{}, err
+	}
+	return coreatt.BlobInfo{ID: blobID, SizeBytes: size}, nil
+}
+
+func (s *Store) Discard(_ context.Context, uploadID int64) error {
+	err := os.Remove(s.stagingPath(uploadID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) Open(_ context.Context, blobID string) (io.ReadSeekCloser, error) {
+	if !validBlobID(blobID) {
+		return nil, coreatt.ErrAttachmentNotFound
+	}
+	f, err := os.Open(s.blobPath(blobID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, coreatt.ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Delete removes a committed blob. A blob that is already gone is not an
+// error, so cleanup can be retried.
+func (s *Store) Delete(_ context.Context, blobID string) error {
+	if !validBlobID(blobID) {
+		return coreatt.ErrAttachmentNotFound
+	}
+	err := os.Remove(s.blobPath(blobID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) stagingPath(uploadID int64) string {
+	return filepath.Join(s.Root, "staging", strconv.FormatInt(uploadID, 10)+".part")
+}
+
+func (s *Store) blobPath(blobID string) string {
+	return filepath.Join(s.Root, "blobs", blobID[:2], blobID)
+}
+
+func validBlobID(blobID string) bool {
+	if len(blobID) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(blobID)
+	return err == nil
+}
+
+type countingWriter struct{ n int64 }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+var _ coreatt.BlobStore = (*Store)(nil)
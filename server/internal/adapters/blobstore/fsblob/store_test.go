@@ -0,0 +1,148 @@
+package fsblob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+)
+
+func TestStore_WriteCommitAndOpen(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := s.WriteChunk(ctx, 1, 0, strings.NewReader("hello ")); err != nil {
+		t.Fatalf("first chunk: %v", err)
+	}
+	if _, err := s.WriteChunk(ctx, 1, 6, strings.NewReader("world")); err != nil {
+		t.Fatalf("second chunk: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte("hello world"))
+	want := hex.EncodeToString(sum[:])
+	info, err := s.Commit(ctx, 1, want, nil)
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if info.ID != want || info.SizeBytes != 11 {
+		t.Fatalf("blob info = %+v, want %s/11", info, want)
+	}
+	if _, err := os.Stat(filepath.Join(s.Root, "blobs", want[:2], want)); err != nil {
+		t.Fatalf("expected blob at content address: %v", err)
+	}
+
+	f, err := s.Open(ctx, info.ID)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	got, _ := io.ReadAll(f)
+	if string(got) != "hello world" {
+		t.Fatalf("blob = %q, want hello world", got)
+	}
+}
+
+func TestStore_WriteChunkTruncatesUnrecordedTail(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	_, _ = s.WriteChunk(ctx, 2, 0, strings.NewReader("abcXXX"))
+	if _, err := s.WriteChunk(ctx, 2, 3, strings.NewReader("def")); err != nil {
+		t.Fatalf("rewrite chunk: %v", err)
+	}
+	if _, err := s.WriteChunk(ctx, 2, 10, strings.NewReader("gap")); !errors.Is(err, coreatt.ErrChunkOutOfOrder) {
+		t.Fatalf("gap err = %v, want ErrChunkOutOfOrder", err)
+	}
+
+	info, err := s.Commit(ctx, 2, "", nil)
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if info.SizeBytes != 6 {
+		t.Fatalf("size = %d, want 6", info.SizeBytes)
+	}
+}
+
+func TestStore_CommitDeduplicatesAndChecksChecksum(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	_, _ = s.WriteChunk(ctx, 3, 0, strings.NewReader("same"))
+	first, err := s.Commit(ctx, 3, "", nil)
+	if err != nil {
+		t.Fatalf("first Commit: %v", err)
+	}
+	_, _ = s.WriteChunk(ctx, 4, 0, strings.NewReader("same"))
+	second, err := s.Commit(ctx, 4, "", nil)
+	if err != nil {
+		t.Fatalf("second Commit: %v", err)
+	}
+	if first.ID != second.ID {
+		t.Fatalf("blob ids differ for identical content: %s vs %s", first.ID, second.ID)
+	}
+	if _, err := os.Stat(s.stagingPath(4)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected duplicate staging file to be removed, stat err = %v", err)
+	}
+
+	_, _ = s.WriteChunk(ctx, 5, 0, strings.NewReader("other"))
+	if _, err := s.Commit(ctx, 5, first.ID, nil); !errors.Is(err, coreatt.ErrChecksumMismatch) {
+		t.Fatalf("err = %v, want ErrChecksumMismatch", err)
+	}
+	if err := s.Discard(ctx, 5); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+	if err := s.Discard(ctx, 5); err != nil {
+		t.Fatalf("second Discard should be a no-op: %v", err)
+	}
+}
+
+func TestStore_OpenRejectsNonContentAddresses(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"", "../../etc/passwd", strings.Repeat("z", 64), strings.Repeat("a", 64)} {
+		if _, err := s.Open(context.Background(), id); !errors.Is(err, coreatt.ErrAttachmentNotFound) {
+			t.Fatalf("Open(%q) err = %v, want ErrAttachmentNotFound", id, err)
+		}
+	}
+}
+
+func TestStore_DeleteRemovesBlobAndIsIdempotent(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	info, err := s.Put(ctx, strings.NewReader("bye"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Delete(ctx, info.ID); err != nil {
+			t.Fatalf("Delete %d: %v", i+1, err)
+		}
+	}
+	if _, err := s.Open(ctx, info.ID); !errors.Is(err, coreatt.ErrAttachmentNotFound) {
+		t.Fatalf("Open after Delete err = %v", err)
+	}
+	if err := s.Delete(ctx, "../../etc/passwd"); !errors.Is(err, coreatt.ErrAttachmentNotFound) {
+		t.Fatalf("Delete of a non-content address err = %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreaccount "github.com/kyambuthia/go-chat-site/server/internal/core/account"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+// RequestExport queues an archive of the caller's data. Asking again while
+// one is queued or recent returns that one.
+func (h *MeHandler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Account == nil {
+		web.JSONError(w, errors.New("account export unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	export, err := h.Account.RequestExport(r.Context(), userID)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("account_export_requested", map[string]any{
+		"request_id": r.Header.Get("X-Request-ID"),
+		"user_id":    userID,
+		"export_id":  export.ID,
+		"status":     string(export.Status),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(accountExportJSON(export))
+}
+
+func (h *MeHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Account == nil {
+		web.JSONError(w, errors.New("account export unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	export, err := h.Account.LatestExport(r.Context(), userID)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(accountExportJSON(export))
+}
+
+// DownloadExport streams a ready archive as a JSON attachment.
+func (h *MeHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Account == nil {
+		web.JSONError(w, errors.New("account export unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+	exportID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || exportID <= 0 {
+		web.JSONError(w, errors.New("id is required"), http.StatusBadRequest)
+		return
+	}
+
+	export, archive, err := h.Account.DownloadExport(r.Context(), userID, exportID)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="account-export-%d.json"`, export.ID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(archive)
+}
+
+// DeleteMe deletes the caller's account after checking the password, when
+// the account has one, and the typed username. Wallet history is kept under
+// an anonymous username; everything else the account owns is removed and its
+// sockets are closed.
+func (h *MeHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Account == nil {
+		web.JSONError(w, errors.New("account deletion unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Password        string `json:"password"`
+		ConfirmUsername string `json:"confirm_username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+	if req.ConfirmUsername == "" {
+		web.JSONError(w, errors.New("confirm_username is required"), http.StatusBadRequest)
+		return
+	}
+
+	profile, err := h.Identity.GetProfile(r.Context(), coreid.UserID(userID))
+	if err != nil {
+		web.JSONError(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+	ip := clientIP(r)
+	requestID := r.Header.Get("X-Request-ID")
+	if h.Security != nil {
+		if err := h.Security.allowLogin(r.Context(), profile.Username, ip, requestID); err != nil {
+			writeAuthThrottleError(w, err)
+			return
+		}
+	}
+
+	deletion, err := h.Account.DeleteAccount(r.Context(), userID, req.Password, req.ConfirmUsername)
+	if err != nil {
+		if errors.Is(err, coreaccount.ErrInvalidCredentials) && h.Security != nil {
+			h.Security.recordLoginFailure(r.Context(), profile.Username, ip, requestID)
+		}
+		writeAccountError(w, err)
+		return
+	}
+	if h.SessionHub != nil {
+		h.SessionHub.DisconnectUser(userID)
+		for _, botID := range deletion.BotUserIDs {
+			h.SessionHub.DisconnectUser(botID)
+		}
+	}
+	auth.LogSecurityEvent("account_deleted", map[string]any{
+		"request_id":            requestID,
+		"user_id":               userID,
+		"ip_address":            ip,
+		"revoked_sessions":      len(deletion.RevokedSessionIDs),
+		"tombstoned_messages":   deletion.TombstonedMessages,
+		"deleted_bots":          len(deletion.BotUserIDs),
+		"deleted_files":         len(deletion.BlobIDs) + len(deletion.UploadIDs) - deletion.BlobCleanupFailures,
+		"blob_cleanup_failures": deletion.BlobCleanupFailures,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"deleted":             true,
+		"revoked_sessions":    len(deletion.RevokedSessionIDs),
+		"tombstoned_messages": deletion.TombstonedMessages,
+		"deleted_bots":        len(deletion.BotUserIDs),
+	})
+}
+
+func accountExportJSON(export coreaccount.Export) map[string]any {
+	out := map[string]any{
+		"id":           export.ID,
+		"status":       string(export.Status),
+		"size_bytes":   export.SizeBytes,
+		"created_at":   export.CreatedAt,
+		"completed_at": export.CompletedAt,
+		"expires_at":   export.ExpiresAt,
+	}
+	if export.Status == coreaccount.ExportFailed {
+		out["error"] = "export failed; request a new one"
+	}
+	return out
+}
+
+func writeAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, coreaccount.ErrExportNotFound):
+		web.JSONError(w, err, http.StatusNotFound)
+	case errors.Is(err, coreaccount.ErrExportNotReady):
+		web.JSONError(w, err, http.StatusConflict)
+	case errors.Is(err, coreaccount.ErrConfirmation):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, coreaccount.ErrInvalidCredentials):
+		web.JSONError(w, errors.New("password is incorrect"), http.StatusUnauthorized)
+	case errors.Is(err, coreaccount.ErrAccountNotFound):
+		web.JSONError(w, errors.New("user not found"), http.StatusNotFound)
+	default:
+		web.JSONError(w, errors.New("internal server error"), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,187 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreaccount "github.com/kyambuthia/go-chat-site/server/internal/core/account"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+type fakeAccountService struct {
+	export       coreaccount.Export
+	exportErr    error
+	archive      []byte
+	deletion     coreaccount.Deletion
+	deleteErr    error
+	lastPassword string
+	lastConfirm  string
+	lastExportID int64
+}
+
+func (f *fakeAccountService) RequestExport(ctx context.Context, userID int) (coreaccount.Export, error) {
+	return f.export, f.exportErr
+}
+
+func (f *fakeAccountService) LatestExport(ctx context.Context, userID int) (coreaccount.Export, error) {
+	return f.export, f.exportErr
+}
+
+func (f *fakeAccountService) DownloadExport(ctx context.Context, userID int, exportID int64) (coreaccount.Export, []byte, error) {
+	f.lastExportID = exportID
+	return f.export, f.archive, f.exportErr
+}
+
+func (f *fakeAccountService) DeleteAccount(ctx context.Context, userID int, password, confirmUsername string) (coreaccount.Deletion, error) {
+	f.lastPassword, f.lastConfirm = password, confirmUsername
+	return f.deletion, f.deleteErr
+}
+
+type fakeUserDisconnector struct {
+	users []int
+}
+
+func (f *fakeUserDisconnector) DisconnectUser(userID int) {
+	f.users = append(f.users, userID)
+}
+
+func TestMeHandler_Export_RequestPollAndDownload(t *testing.T) {
+	completed := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := &fakeAccountService{export: coreaccount.Export{ID: 3, Status: coreaccount.ExportPending}}
+	h := &MeHandler{Account: svc}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/me/export", nil)
+	req = req.WithContext(auth.WithUserID(req.Context(), 4))
+	rr := httptest.NewRecorder()
+	h.RequestExport(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("request status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["status"] != "pending" || resp["id"] != float64(3) {
+		t.Fatalf("unexpected export %v", resp)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/me/export/download?id=3", nil)
+	req = req.WithContext(auth.WithUserID(req.Context(), 4))
+	rr = httptest.NewRecorder()
+	svc.exportErr = coreaccount.ErrExportNotReady
+	h.DownloadExport(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("download before ready status = %d, want 409", rr.Code)
+	}
+
+	svc.exportErr = nil
+	svc.export = coreaccount.Export{ID: 3, Status: coreaccount.ExportReady, CompletedAt: &completed}
+	svc.archive = []byte(`{"format_version":1}`)
+	rr = httptest.NewRecorder()
+	h.DownloadExport(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"format_version":1}` || svc.lastExportID != 3 {
+		t.Fatalf("download status = %d, body %q, id %d", rr.Code, rr.Body.String(), svc.lastExportID)
+	}
+	if got := rr.Header().Get("Content-Disposition"); !strings.Contains(got, "account-export-3.json") {
+		t.Fatalf("Content-Disposition = %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/me/export/download", nil)
+	req = req.WithContext(auth.WithUserID(req.Context(), 4))
+	rr = httptest.NewRecorder()
+	h.DownloadExport(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("download without id status = %d, want 400", rr.Code)
+	}
+}
+
+func TestMeHandler_Export_UnavailableWithoutService(t *testing.T) {
+	h := &MeHandler{}
+	req := httptest.NewRequest(http.MethodGet, "/api/me/export", nil)
+	req = req.WithContext(auth.WithUserID(req.Context(), 4))
+	rr := httptest.NewRecorder()
+	h.GetExport(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rr.Code)
+	}
+}
+
+func TestMeHandler_DeleteMe_DisconnectsAccountAndBots(t *testing.T) {
+	svc := &fakeAccountService{deletion: coreaccount.Deletion{
+		UserID:             4,
+		RevokedSessionIDs:  []int64{10, 11},
+		BotUserIDs:         []int{9},
+		TombstonedMessages: 5,
+	}}
+	hub := &fakeUserDisconnector{}
+	h := &MeHandler{Identity: &fakeIdentityProfileService{profile: coreid.Profile{UserID: 4, Username: "alice"}}, Account: svc, SessionHub: hub}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/me", strings.NewReader(`{"password":"pw","confirm_username":"alice"}`))
+	req = req.WithContext(auth.WithUserID(req.Context(), 4))
+	rr := httptest.NewRecorder()
+	h.DeleteMe(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	if svc.lastPassword != "pw" || svc.lastConfirm != "alice" {
+		t.Fatalf("unexpected confirmation %q/%q", svc.lastPassword, svc.lastConfirm)
+	}
+	if len(hub.users) != 2 || hub.users[0] != 4 || hub.users[1] != 9 {
+		t.Fatalf("disconnected %v, want [4 9]", hub.users)
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["tombstoned_messages"] != float64(5) || resp["revoked_sessions"] != float64(2) || resp["deleted_bots"] != float64(1) {
+		t.Fatalf("unexpected response %v", resp)
+	}
+}
+
+func TestMeHandler_DeleteMe_RejectsWrongPasswordAndMissingConfirmation(t *testing.T) {
+	security := newAuthSecurityForTest(t, 100, 100, 2)
+	svc := &fakeAccountService{deleteErr: coreaccount.ErrInvalidCredentials}
+	hub := &fakeUserDisconnector{}
+	h := &MeHandler{Identity: &fakeIdentityProfileService{profile: coreid.Profile{UserID: 4, Username: "alice"}}, Account: svc, Security: security, SessionHub: hub}
+
+	send := func(body string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/me", strings.NewReader(body))
+		req = req.WithContext(auth.WithUserID(req.Context(), 4))
+		req.RemoteAddr = "127.0.0.1:3456"
+		rr := httptest.NewRecorder()
+		h.DeleteMe(rr, req)
+		return rr.Code
+	}
+
+	if code := send(`{"password":"pw"}`); code != http.StatusBadRequest {
+		t.Fatalf("missing confirmation status = %d, want 400", code)
+	}
+	for range 2 {
+		if code := send(`{"password":"wrong","confirm_username":"alice"}`); code != http.StatusUnauthorized {
+			t.Fatalf("wrong password status = %d, want 401", code)
+		}
+	}
+	if code := send(`{"password":"wrong","confirm_username":"alice"}`); code != http.StatusTooManyRequests {
+		t.Fatalf("status after lockout = %d, want 429", code)
+	}
+	if len(hub.users) != 0 {
+		t.Fatalf("failed deletion should not disconnect, got %v", hub.users)
+	}
+}
+
+func TestAuthHandler_Register_RejectsDeletedUsernamePrefix(t *testing.T) {
+	h := &AuthHandler{}
+	req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(`{"username":"Deleted-User-7","password":"password123"}`))
+	rr := httptest.NewRecorder()
+	h.Register(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rr.Code)
+	}
+}
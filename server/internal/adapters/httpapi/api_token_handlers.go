@@ -0,0 +1,270 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+// APITokenHandler manages API tokens and bot accounts. Its routes take
+// session tokens only, so a leaked API token cannot mint more.
+type APITokenHandler struct {
+	Tokens     coreid.APITokenService
+	SessionHub interface{ DisconnectUser(userID int) }
+}
+
+func (h *APITokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Tokens == nil {
+		web.JSONError(w, errors.New("api tokens unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		BotID         int      `json:"bot_id"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	token, secret, err := h.Tokens.CreateAPIToken(r.Context(), coreid.UserID(userID), coreid.CreateAPITokenRequest{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		BotID:     coreid.UserID(req.BotID),
+		ExpiresIn: time.Duration(req.ExpiresInDays) * 24 * time.Hour,
+	})
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("auth_api_token_created", map[string]any{
+		"request_id":   r.Header.Get("X-Request-ID"),
+		"user_id":      userID,
+		"api_token_id": token.ID,
+		"token_owner":  int(token.UserID),
+		"scopes":       strings.Join(token.Scopes, " "),
+	})
+
+	resp := apiTokenJSON(token)
+	resp["token"] = secret
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// ListTokens lists the caller's tokens, or a bot's with ?bot_id=. Secrets
+// are never returned after creation.
+func (h *APITokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Tokens == nil {
+		web.JSONError(w, errors.New("api tokens unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var botID int
+	if raw := r.URL.Query().Get("bot_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			web.JSONError(w, errors.New("invalid bot_id"), http.StatusBadRequest)
+			return
+		}
+		botID = id
+	}
+
+	tokens, err := h.Tokens.ListAPITokens(r.Context(), coreid.UserID(userID), coreid.UserID(botID))
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+	resp := make([]map[string]any, 0, len(tokens))
+	for _, token := range tokens {
+		resp = append(resp, apiTokenJSON(token))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeToken takes effect on the next request; a bot's open WebSockets are
+// closed immediately.
+func (h *APITokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Tokens == nil {
+		web.JSONError(w, errors.New("api tokens unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.Tokens.RevokeAPIToken(r.Context(), coreid.UserID(userID), req.ID)
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+	if token.Bot && h.SessionHub != nil {
+		h.SessionHub.DisconnectUser(int(token.UserID))
+	}
+	auth.LogSecurityEvent("auth_api_token_revoked", map[string]any{
+		"request_id":   r.Header.Get("X-Request-ID"),
+		"user_id":      userID,
+		"api_token_id": token.ID,
+		"token_owner":  int(token.UserID),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *APITokenHandler) CreateBot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Tokens == nil {
+		web.JSONError(w, errors.New("api tokens unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Username    string `json:"username"`
+		DisplayName string `json:"display_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	bot, err := h.Tokens.CreateBot(r.Context(), coreid.UserID(userID), req.Username, req.DisplayName)
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("auth_bot_created", map[string]any{
+		"request_id": r.Header.Get("X-Request-ID"),
+		"user_id":    userID,
+		"bot_id":     int(bot.ID),
+		"username":   bot.Username,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(botJSON(bot))
+}
+
+func (h *APITokenHandler) ListBots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Tokens == nil {
+		web.JSONError(w, errors.New("api tokens unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	bots, err := h.Tokens.ListBots(r.Context(), coreid.UserID(userID))
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+	resp := make([]map[string]any, 0, len(bots))
+	for _, bot := range bots {
+		resp = append(resp, botJSON(bot))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func apiTokenJSON(token coreid.APIToken) map[string]any {
+	item := map[string]any{
+		"id":         token.ID,
+		"user_id":    int(token.UserID),
+		"bot":        token.Bot,
+		"name":       token.Name,
+		"scopes":     token.Scopes,
+		"created_at": token.CreatedAt,
+	}
+	if token.LastUsedAt != nil {
+		item["last_used_at"] = *token.LastUsedAt
+	}
+	if token.ExpiresAt != nil {
+		item["expires_at"] = *token.ExpiresAt
+	}
+	if token.RevokedAt != nil {
+		item["revoked_at"] = *token.RevokedAt
+	}
+	return item
+}
+
+func botJSON(bot coreid.Bot) map[string]any {
+	return map[string]any{
+		"id":           int(bot.ID),
+		"username":     bot.Username,
+		"display_name": bot.DisplayName,
+		"created_at":   bot.CreatedAt,
+	}
+}
+
+func writeAPITokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, coreid.ErrInvalidAPITokenRequest), errors.Is(err, coreid.ErrInvalidAPITokenExpiry),
+		errors.Is(err, coreid.ErrInvalidScope), errors.Is(err, coreid.ErrInvalidBotUsername):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, coreid.ErrAPITokenNotFound), errors.Is(err, coreid.ErrBotNotFound):
+		web.JSONError(w, err, http.StatusNotFound)
+	case errors.Is(err, coreid.ErrUsernameTaken), errors.Is(err, coreid.ErrAPITokenLimitReached), errors.Is(err, coreid.ErrBotLimitReached):
+		web.JSONError(w, err, http.StatusConflict)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
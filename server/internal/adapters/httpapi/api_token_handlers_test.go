@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func authedRequest(t *testing.T, h http.Handler, method, path, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPITokenHandlers_ScopedTokensAndBots(t *testing.T) {
+	router, _ := passwordTestRouter(t)
+	session, _ := loginForTest(t, router, "password123")
+
+	rr := postJSON(t, router, "/api/me/tokens", session, map[string]any{"name": "ci", "scopes": []string{"wallet:send"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("unknown scope status = %d, want 400", rr.Code)
+	}
+	rr = postJSON(t, router, "/api/me/tokens", session, map[string]any{"name": "ci", "scopes": []string{"messages:read"}, "expires_in_days": 30})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create token status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var created struct {
+		ID    int64  `json:"id"`
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil || !strings.HasPrefix(created.Token, "gcs_") {
+		t.Fatalf("created = %+v, err = %v", created, err)
+	}
+
+	if rr := authedRequest(t, router, http.MethodGet, "/api/messages/inbox", created.Token, nil); rr.Code != http.StatusOK {
+		t.Fatalf("scoped route status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := authedRequest(t, router, http.MethodGet, "/api/wallet", created.Token, nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("route needing another scope status = %d, want 403", rr.Code)
+	}
+	for _, path := range []string{"/api/me", "/api/me/tokens", "/api/sessions"} {
+		if rr := authedRequest(t, router, http.MethodGet, path, created.Token, nil); rr.Code != http.StatusForbidden {
+			t.Fatalf("%s with api token status = %d, want 403", path, rr.Code)
+		}
+	}
+
+	rr = authedRequest(t, router, http.MethodGet, "/api/me/tokens", session, nil)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), created.Token) || !strings.Contains(rr.Body.String(), "last_used_at") {
+		t.Fatalf("list tokens status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = authedRequest(t, router, http.MethodDelete, "/api/me/tokens", session, map[string]any{"id": created.ID})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := authedRequest(t, router, http.MethodGet, "/api/messages/inbox", created.Token, nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token status = %d, want 401", rr.Code)
+	}
+
+	rr = postJSON(t, router, "/api/me/bots", session, map[string]string{"username": "oncall-bot", "display_name": "On-call"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create bot status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var bot struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&bot); err != nil {
+		t.Fatal(err)
+	}
+	if rr := postJSON(t, router, "/api/me/bots", session, map[string]string{"username": "oncall-bot"}); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate bot status = %d, want 409", rr.Code)
+	}
+	if rr := postJSON(t, router, "/api/login", "", map[string]string{"username": "oncall-bot", "password": ""}); rr.Code == http.StatusOK {
+		t.Fatal("bots must not be able to sign in with a password")
+	}
+	rr = postJSON(t, router, "/api/me/tokens", session, map[string]any{"name": "alerts", "scopes": []string{"messages:send", "messages:read"}, "bot_id": bot.ID})
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"bot":true`) {
+		t.Fatalf("bot token status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = authedRequest(t, router, http.MethodGet, "/api/me/tokens?bot_id="+strconv.Itoa(bot.ID), session, nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"alerts"`) {
+		t.Fatalf("list bot tokens status = %d body=%s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,309 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+type AttachmentsHandler struct {
+	Attachments coreatt.Service
+}
+
+func (h *AttachmentsHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		FileName  string `json:"file_name"`
+		MimeType  string `json:"mime_type"`
+		SizeBytes int64  `json:"size_bytes"`
+		Encrypted bool   `json:"encrypted"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.Attachments.BeginUpload(r.Context(), userID, coreatt.BeginUploadRequest{
+		FileName:  req.FileName,
+		MimeType:  req.MimeType,
+		SizeBytes: req.SizeBytes,
+		Encrypted: req.Encrypted,
+	})
+	if err != nil {
+		web.JSONError(w, err, attachmentErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(h.uploadToJSON(upload))
+}
+
+func (h *AttachmentsHandler) GetUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	uploadID, err := strconv.ParseInt(r.URL.Query().Get("upload_id"), 10, 64)
+	if err != nil || uploadID <= 0 {
+		web.JSONError(w, errors.New("invalid upload_id"), http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.Attachments.GetUpload(r.Context(), userID, uploadID)
+	if err != nil {
+		web.JSONError(w, err, attachmentErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.uploadToJSON(upload))
+}
+
+// AppendChunk accepts the raw bytes of the next chunk. offset must equal the
+// upload's received_bytes, which lets clients resume after a dropped request.
+func (h *AttachmentsHandler) AppendChunk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	uploadID, err := strconv.ParseInt(r.URL.Query().Get("upload_id"), 10, 64)
+	if err != nil || uploadID <= 0 {
+		web.JSONError(w, errors.New("invalid upload_id"), http.StatusBadRequest)
+		return
+	}
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		web.JSONError(w, errors.New("invalid offset"), http.StatusBadRequest)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, h.Attachments.Limits().ChunkBytes)
+	upload, err := h.Attachments.AppendChunk(r.Context(), userID, uploadID, offset, body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = coreatt.ErrTooLarge
+		}
+		web.JSONError(w, err, attachmentErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.uploadToJSON(upload))
+}
+
+func (h *AttachmentsHandler) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UploadID int64  `json:"upload_id"`
+		SHA256   string `json:"sha256"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+	if req.UploadID <= 0 {
+		web.JSONError(w, errors.New("invalid upload_id"), http.StatusBadRequest)
+		return
+	}
+
+	attachment, err := h.Attachments.CompleteUpload(r.Context(), userID, req.UploadID, req.SHA256)
+	if err != nil {
+		web.JSONError(w, err, attachmentErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(attachmentToJSON(attachment))
+}
+
+func (h *AttachmentsHandler) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || attachmentID <= 0 {
+		web.JSONError(w, errors.New("invalid id"), http.StatusBadRequest)
+		return
+	}
+
+	attachment, err := h.Attachments.GetAttachment(r.Context(), userID, attachmentID)
+	if err != nil {
+		web.JSONError(w, err, attachmentErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(attachmentToJSON(attachment))
+}
+
+// DownloadAttachment streams the blob. Responses are always served as downloads
+// with nosniff so uploaded content cannot execute in the app's origin.
+func (h *AttachmentsHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || attachmentID <= 0 {
+		web.JSONError(w, errors.New("invalid id"), http.StatusBadRequest)
+		return
+	}
+
+	attachment, blob, err := h.Attachments.OpenAttachment(r.Context(), userID, attachmentID)
+	if err != nil {
+		web.JSONError(w, err, attachmentErrorStatus(err))
+		return
+	}
+	defer blob.Close()
+
+	fileName := attachment.FileName
+	if fileName == "" {
+		fileName = "attachment-" + strconv.FormatInt(attachment.ID, 10)
+	}
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("ETag", `"`+attachment.BlobID+`"`)
+	http.ServeContent(w, r, "", attachment.CreatedAt, blob)
+}
+
+// DownloadThumbnail serves the generated preview inline. Thumbnails are always
+// re-encoded by the server, so they are safe to render directly.
+func (h *AttachmentsHandler) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || attachmentID <= 0 {
+		web.JSONError(w, errors.New("invalid id"), http.StatusBadRequest)
+		return
+	}
+
+	media, blob, err := h.Attachments.OpenThumbnail(r.Context(), userID, attachmentID)
+	if err != nil {
+		web.JSONError(w, err, attachmentErrorStatus(err))
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", media.ThumbnailMimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("ETag", `"`+media.ThumbnailBlobID+`"`)
+	http.ServeContent(w, r, "", time.Time{}, blob)
+}
+
+func (h *AttachmentsHandler) authorize(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if h.Attachments == nil {
+		web.JSONError(w, errors.New("attachments unavailable"), http.StatusServiceUnavailable)
+		return 0, false
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return 0, false
+	}
+	return userID, true
+}
+
+func (h *AttachmentsHandler) uploadToJSON(upload coreatt.Upload) map[string]any {
+	return map[string]any{
+		"id":             upload.ID,
+		"file_name":      upload.FileName,
+		"mime_type":      upload.MimeType,
+		"size_bytes":     upload.SizeBytes,
+		"received_bytes": upload.ReceivedBytes,
+		"encrypted":      upload.Encrypted,
+		"chunk_bytes":    h.Attachments.Limits().ChunkBytes,
+		"created_at":     upload.CreatedAt,
+	}
+}
+
+func attachmentToJSON(attachment coreatt.Attachment) map[string]any {
+	item := map[string]any{
+		"id":            attachment.ID,
+		"owner_user_id": attachment.OwnerUserID,
+		"blob_id":       attachment.BlobID,
+		"file_name":     attachment.FileName,
+		"mime_type":     attachment.MimeType,
+		"size_bytes":    attachment.SizeBytes,
+		"encrypted":     attachment.Encrypted,
+		"created_at":    attachment.CreatedAt,
+	}
+	if media := attachment.Media; media != nil {
+		item["media_status"] = media.Status
+		if media.Status == coreatt.MediaReady {
+			item["width"] = media.Width
+			item["height"] = media.Height
+			item["placeholder"] = media.Placeholder
+			item["has_thumbnail"] = media.ThumbnailBlobID != ""
+		}
+	}
+	return item
+}
+
+func attachmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, coreatt.ErrUploadNotFound), errors.Is(err, coreatt.ErrAttachmentNotFound), errors.Is(err, coreatt.ErrMediaNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, coreatt.ErrUnsupportedMimeType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, coreatt.ErrTooLarge), errors.Is(err, coreatt.ErrQuotaExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, coreatt.ErrChunkOutOfOrder), errors.Is(err, coreatt.ErrUploadIncomplete):
+		return http.StatusConflict
+	case errors.Is(err, coreatt.ErrChecksumMismatch), errors.Is(err, coreatt.ErrInvalidUpload):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,226 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/blobstore/fsblob"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/media/stdimage"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqliteattachments"
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+)
+
+func newAttachmentsHandlerForTest(t *testing.T, limits coreatt.Limits) (*AttachmentsHandler, int, int) {
+	t.Helper()
+	s := setupRouterStore(t)
+	var ids [2]int
+	for i, name := range []string{"alice", "bob"} {
+		res, err := s.DB.Exec(`INSERT INTO users (username, password_hash) VALUES (?, 'test-hash')`, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		ids[i] = int(id)
+	}
+	blobs, err := fsblob.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := coreatt.NewService(&sqliteattachments.Adapter{DB: s.DB}, blobs, limits)
+	return &AttachmentsHandler{Attachments: svc}, ids[0], ids[1]
+}
+
+func serveAs(userID int, handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	req = req.WithContext(auth.WithUserID(req.Context(), userID))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestAttachmentsHandler_ChunkedUploadAndDownload(t *testing.T) {
+	h, aliceID, bobID := newAttachmentsHandlerForTest(t, coreatt.Limits{ChunkBytes: 4})
+	content := []byte("invoice #42 total 100")
+
+	rr := serveAs(aliceID, h.CreateUpload, httptest.NewRequest(http.MethodPost, "/api/attachments/uploads",
+		strings.NewReader(`{"file_name":"invoice.txt","mime_type":"text/plain","size_bytes":`+strconv.Itoa(len(content))+`}`)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	var upload struct {
+		ID         int64 `json:"id"`
+		ChunkBytes int64 `json:"chunk_bytes"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &upload); err != nil {
+		t.Fatal(err)
+	}
+	if upload.ChunkBytes != 4 {
+		t.Fatalf("chunk_bytes = %d, want 4", upload.ChunkBytes)
+	}
+
+	uploadID := strconv.FormatInt(upload.ID, 10)
+	for offset := 0; offset < len(content); offset += 4 {
+		end := min(offset+4, len(content))
+		req := httptest.NewRequest(http.MethodPut, "/api/attachments/uploads/chunk?upload_id="+uploadID+"&offset="+strconv.Itoa(offset), bytes.NewReader(content[offset:end]))
+		if rr := serveAs(aliceID, h.AppendChunk, req); rr.Code != http.StatusOK {
+			t.Fatalf("chunk at %d status = %d, body = %s", offset, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr = serveAs(aliceID, h.GetUpload, httptest.NewRequest(http.MethodGet, "/api/attachments/uploads?upload_id="+uploadID, nil))
+	if !strings.Contains(rr.Body.String(), `"received_bytes":`+strconv.Itoa(len(content))) {
+		t.Fatalf("upload status body = %s, want all bytes received", rr.Body.String())
+	}
+
+	sum := sha256.Sum256(content)
+	rr = serveAs(aliceID, h.CompleteUpload, httptest.NewRequest(http.MethodPost, "/api/attachments/uploads/complete",
+		strings.NewReader(`{"upload_id":`+uploadID+`,"sha256":"`+hex.EncodeToString(sum[:])+`"}`)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("complete status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	var attachment struct {
+		ID     int64  `json:"id"`
+		BlobID string `json:"blob_id"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &attachment); err != nil {
+		t.Fatal(err)
+	}
+	attachmentID := strconv.FormatInt(attachment.ID, 10)
+
+	rr = serveAs(aliceID, h.DownloadAttachment, httptest.NewRequest(http.MethodGet, "/api/attachments/blob?id="+attachmentID, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("download status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	body, _ := io.ReadAll(rr.Body)
+	if !bytes.Equal(body, content) {
+		t.Fatalf("downloaded %q, want %q", body, content)
+	}
+	if got := rr.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Fatalf("nosniff header = %q", got)
+	}
+	if got := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment;") || !strings.Contains(got, "invoice.txt") {
+		t.Fatalf("content-disposition = %q", got)
+	}
+
+	rr = serveAs(bobID, h.GetAttachment, httptest.NewRequest(http.MethodGet, "/api/attachments?id="+attachmentID, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("non-participant status = %d, want 404", rr.Code)
+	}
+}
+
+func TestAttachmentsHandler_ErrorStatuses(t *testing.T) {
+	h, aliceID, _ := newAttachmentsHandlerForTest(t, coreatt.Limits{MaxBytes: 10, ChunkBytes: 4})
+
+	rr := serveAs(aliceID, h.CreateUpload, httptest.NewRequest(http.MethodPost, "/api/attachments/uploads",
+		strings.NewReader(`{"mime_type":"image/svg+xml","size_bytes":5}`)))
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("svg status = %d, want 415", rr.Code)
+	}
+	rr = serveAs(aliceID, h.CreateUpload, httptest.NewRequest(http.MethodPost, "/api/attachments/uploads",
+		strings.NewReader(`{"mime_type":"text/plain","size_bytes":11}`)))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized status = %d, want 413", rr.Code)
+	}
+
+	rr = serveAs(aliceID, h.CreateUpload, httptest.NewRequest(http.MethodPost, "/api/attachments/uploads",
+		strings.NewReader(`{"mime_type":"text/plain","size_bytes":8}`)))
+	var upload struct {
+		ID int64 `json:"id"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &upload)
+	uploadID := strconv.FormatInt(upload.ID, 10)
+
+	rr = serveAs(aliceID, h.AppendChunk, httptest.NewRequest(http.MethodPut, "/api/attachments/uploads/chunk?upload_id="+uploadID+"&offset=0", strings.NewReader("toolong")))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized chunk status = %d, want 413", rr.Code)
+	}
+	rr = serveAs(aliceID, h.AppendChunk, httptest.NewRequest(http.MethodPut, "/api/attachments/uploads/chunk?upload_id="+uploadID+"&offset=4", strings.NewReader("abcd")))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("out-of-order chunk status = %d, want 409", rr.Code)
+	}
+	rr = serveAs(aliceID, h.CompleteUpload, httptest.NewRequest(http.MethodPost, "/api/attachments/uploads/complete", strings.NewReader(`{"upload_id":`+uploadID+`}`)))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("incomplete upload status = %d, want 409", rr.Code)
+	}
+}
+
+func TestAttachmentsHandler_ThumbnailAfterMediaProcessing(t *testing.T) {
+	s := setupRouterStore(t)
+	res, err := s.DB.Exec(`INSERT INTO users (username, password_hash) VALUES ('alice', 'test-hash')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceID64, _ := res.LastInsertId()
+	aliceID := int(aliceID64)
+	blobs, err := fsblob.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &sqliteattachments.Adapter{DB: s.DB}
+	images := &stdimage.Processor{ThumbnailMaxDim: 16}
+	pipeline := coreatt.NewMediaPipeline(repo, repo, blobs, images)
+	h := &AttachmentsHandler{Attachments: coreatt.NewServiceWithMedia(repo, blobs, coreatt.Limits{}, images, pipeline)}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 32))); err != nil {
+		t.Fatal(err)
+	}
+	content := buf.Bytes()
+	rr := serveAs(aliceID, h.CreateUpload, httptest.NewRequest(http.MethodPost, "/api/attachments/uploads",
+		strings.NewReader(`{"mime_type":"image/png","size_bytes":`+strconv.Itoa(len(content))+`}`)))
+	var upload struct {
+		ID int64 `json:"id"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &upload)
+	uploadID := strconv.FormatInt(upload.ID, 10)
+	serveAs(aliceID, h.AppendChunk, httptest.NewRequest(http.MethodPut, "/api/attachments/uploads/chunk?upload_id="+uploadID+"&offset=0", bytes.NewReader(content)))
+	rr = serveAs(aliceID, h.CompleteUpload, httptest.NewRequest(http.MethodPost, "/api/attachments/uploads/complete", strings.NewReader(`{"upload_id":`+uploadID+`}`)))
+	var attachment struct {
+		ID          int64  `json:"id"`
+		MediaStatus string `json:"media_status"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &attachment); err != nil || attachment.MediaStatus != "pending" {
+		t.Fatalf("complete body = %s, want media_status pending", rr.Body.String())
+	}
+	attachmentID := strconv.FormatInt(attachment.ID, 10)
+
+	rr = serveAs(aliceID, h.DownloadThumbnail, httptest.NewRequest(http.MethodGet, "/api/attachments/thumbnail?id="+attachmentID, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("thumbnail before processing status = %d, want 404", rr.Code)
+	}
+	if err := pipeline.Process(context.Background(), attachment.ID); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+
+	rr = serveAs(aliceID, h.GetAttachment, httptest.NewRequest(http.MethodGet, "/api/attachments?id="+attachmentID, nil))
+	if !strings.Contains(rr.Body.String(), `"width":64`) || !strings.Contains(rr.Body.String(), `"media_status":"ready"`) {
+		t.Fatalf("attachment body = %s, want ready media with width", rr.Body.String())
+	}
+	rr = serveAs(aliceID, h.DownloadThumbnail, httptest.NewRequest(http.MethodGet, "/api/attachments/thumbnail?id="+attachmentID, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("thumbnail status = %d, content-type = %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	thumb, err := png.DecodeConfig(rr.Body)
+	if err != nil || thumb.Width != 16 || thumb.Height != 8 {
+		t.Fatalf("thumbnail config = %+v, err = %v", thumb, err)
+	}
+}
+
+func TestAttachmentsHandler_UnavailableWithoutService(t *testing.T) {
+	h := &AttachmentsHandler{}
+	rr := serveAs(1, h.GetAttachment, httptest.NewRequest(http.MethodGet, "/api/attachments?id=1", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rr.Code)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreaccount "github.com/kyambuthia/go-chat-site/server/internal/core/account"
 	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
 	"github.com/kyambuthia/go-chat-site/server/internal/web"
 )
@@ -18,10 +19,11 @@ type sessionDisconnector interface {
 }
 
 type AuthHandler struct {
-	Identity   coreid.AuthService
-	Sessions   coreid.SessionService
-	Security   *authSecurity
-	SessionHub sessionDisconnector
+	Identity    coreid.AuthService
+	Sessions    coreid.SessionService
+	Credentials coreid.CredentialService
+	Security    *authSecurity
+	SessionHub  sessionDisconnector
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -46,9 +48,8 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		web.JSONError(w, errors.New("username is required"), http.StatusBadRequest)
 		return
 	}
-
-	if len(creds.Password) < 8 {
-		web.JSONError(w, errors.New("password too short"), http.StatusBadRequest)
+	if strings.HasPrefix(strings.ToLower(creds.Username), coreaccount.DeletedUsernamePrefix) {
+		web.JSONError(w, errors.New("username is reserved"), http.StatusBadRequest)
 		return
 	}
 
@@ -57,6 +58,10 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Password: creds.Password,
 	})
 	if err != nil {
+		if errors.Is(err, coreid.ErrWeakPassword) {
+			web.JSONError(w, err, http.StatusBadRequest)
+			return
+		}
 		web.JSONError(w, err, http.StatusConflict)
 		return
 	}
@@ -108,6 +113,18 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 			web.JSONError(w, errors.New("invalid username or password"), http.StatusUnauthorized)
 			return
 		}
+		var required *coreid.MFARequiredError
+		if errors.As(err, &required) {
+			// The lockout counter is deliberately left alone until the second
+			// factor succeeds, so a known password cannot reset it.
+			auth.LogSecurityEvent("auth_mfa_challenge_issued", map[string]any{
+				"request_id": requestID,
+				"user_id":    int(required.Principal.ID),
+				"ip_address": ip,
+			})
+			writeMFARequiredJSON(w, required)
+			return
+		}
 		web.JSONError(w, err, http.StatusInternalServerError)
 		return
 	}
@@ -118,6 +135,68 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	writeSessionTokensJSON(w, tokens)
 }
 
+func writeMFARequiredJSON(w http.ResponseWriter, required *coreid.MFARequiredError) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"mfa_required":   true,
+		"mfa_token":      required.Challenge.Token,
+		"mfa_expires_at": required.Challenge.ExpiresAt,
+		"mfa_methods":    []string{"totp", "recovery_code"},
+	})
+}
+
+// LoginMFA completes a login that /api/login answered with mfa_required.
+// Wrong codes count toward the same per-account lockout as wrong passwords.
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		MFAToken    string `json:"mfa_token"`
+		Code        string `json:"code"`
+		DeviceLabel string `json:"device_label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.MFAToken) == "" || strings.TrimSpace(req.Code) == "" {
+		web.JSONError(w, errors.New("mfa_token and code are required"), http.StatusBadRequest)
+		return
+	}
+
+	principal, err := h.Identity.ResolveMFAChallenge(r.Context(), req.MFAToken)
+	if err != nil {
+		writeMFALoginError(w, err)
+		return
+	}
+
+	ip := clientIP(r)
+	requestID := r.Header.Get("X-Request-ID")
+	if h.Security != nil {
+		if err := h.Security.allowLogin(r.Context(), principal.Username, ip, requestID); err != nil {
+			writeAuthThrottleError(w, err)
+			return
+		}
+	}
+
+	tokens, err := h.Identity.CompleteMFALogin(r.Context(), req.MFAToken, req.Code, sessionMetadataFromRequest(r, req.DeviceLabel))
+	if err != nil {
+		if errors.Is(err, coreid.ErrInvalidMFACode) && h.Security != nil {
+			h.Security.recordLoginFailure(r.Context(), principal.Username, ip, requestID)
+		}
+		writeMFALoginError(w, err)
+		return
+	}
+	if h.Security != nil {
+		h.Security.recordLoginSuccess(r.Context(), int(tokens.Session.UserID), principal.Username, ip, requestID)
+	}
+
+	writeSessionTokensJSON(w, tokens)
+}
+
 func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
@@ -148,16 +227,25 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 
 	tokens, err := h.Sessions.RefreshSession(r.Context(), strings.TrimSpace(req.RefreshToken), sessionMetadataFromRequest(r, req.DeviceLabel))
 	if err != nil {
-		auth.LogSecurityEvent("auth_refresh_failed", map[string]any{
-			"request_id": requestID,
-			"ip_address": ip,
-			"reason":     err.Error(),
-		})
-		status := http.StatusUnauthorized
-		if errors.Is(err, coreid.ErrRefreshTokenReplay) {
-			status = http.StatusUnauthorized
+		var reuse *coreid.RefreshTokenReuseError
+		if errors.As(err, &reuse) {
+			// A rotated-out token came back: treat it as stolen and force
+			// every socket on the revoked sessions to sign in again.
+			h.disconnectSessions(reuse.SessionIDs)
+			auth.LogSecurityEvent("auth_refresh_token_reuse", map[string]any{
+				"request_id":  requestID,
+				"user_id":     int(reuse.UserID),
+				"session_ids": reuse.SessionIDs,
+				"ip_address":  ip,
+			})
+		} else {
+			auth.LogSecurityEvent("auth_refresh_failed", map[string]any{
+				"request_id": requestID,
+				"ip_address": ip,
+				"reason":     err.Error(),
+			})
 		}
-		web.JSONError(w, err, status)
+		web.JSONError(w, err, http.StatusUnauthorized)
 		return
 	}
 	auth.LogSecurityEvent("auth_refresh_succeeded", map[string]any{
@@ -322,6 +410,15 @@ func writeSessionTokensJSON(w http.ResponseWriter, tokens coreid.SessionTokens)
 	})
 }
 
+func writeMFALoginError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, coreid.ErrInvalidMFACode), errors.Is(err, coreid.ErrInvalidMFAChallenge):
+		web.JSONError(w, err, http.StatusUnauthorized)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
 func writeAuthThrottleError(w http.ResponseWriter, err error) {
 	var locked loginLockedError
 	if errors.As(err, &locked) {
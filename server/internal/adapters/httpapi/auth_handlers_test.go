@@ -1,8 +1,10 @@
 package httpapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -18,6 +20,11 @@ type fakeAuthService struct {
 	loginCalls int
 	lastCred   coreid.PasswordCredential
 	lastMeta   coreid.SessionMetadata
+
+	mfaPrincipal coreid.Principal
+	mfaErr       error
+	mfaCalls     int
+	lastMFACode  string
 }
 
 func (f *fakeAuthService) RegisterPassword(ctx context.Context, cred coreid.PasswordCredential) (coreid.Principal, error) {
@@ -34,6 +41,33 @@ func (f *fakeAuthService) LoginPassword(ctx context.Context, cred coreid.Passwor
 	return f.loginResp, f.loginErr
 }
 
+func (f *fakeAuthService) Login(ctx context.Context, cred coreid.Credential, meta coreid.SessionMetadata) (coreid.SessionTokens, error) {
+	if password, ok := cred.(coreid.PasswordCredential); ok {
+		return f.LoginPassword(ctx, password, meta)
+	}
+	return coreid.SessionTokens{}, coreid.ErrUnsupportedCredential
+}
+
+func (f *fakeAuthService) ResolveMFAChallenge(ctx context.Context, challengeToken string) (coreid.Principal, error) {
+	_ = ctx
+	if challengeToken != "mfa-token" {
+		return coreid.Principal{}, coreid.ErrInvalidMFAChallenge
+	}
+	return f.mfaPrincipal, nil
+}
+
+func (f *fakeAuthService) CompleteMFALogin(ctx context.Context, challengeToken, code string, meta coreid.SessionMetadata) (coreid.SessionTokens, error) {
+	_ = ctx
+	_ = challengeToken
+	f.mfaCalls++
+	f.lastMFACode = code
+	f.lastMeta = meta
+	if f.mfaErr != nil {
+		return coreid.SessionTokens{}, f.mfaErr
+	}
+	return f.loginResp, nil
+}
+
 type fakeSessionService struct {
 	refreshResp  coreid.SessionTokens
 	refreshErr   error
@@ -63,6 +97,14 @@ func (f *fakeSessionService) RevokeSession(ctx context.Context, actorUserID core
 	return nil
 }
 
+type fakeSessionHub struct {
+	disconnected []int64
+}
+
+func (f *fakeSessionHub) DisconnectSession(sessionID int64) {
+	f.disconnected = append(f.disconnected, sessionID)
+}
+
 func loginReq(body string) *http.Request {
 	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
@@ -169,7 +211,7 @@ func TestAuthHandler_Login_LockoutIncludesRetryAfter(t *testing.T) {
 
 func TestAuthHandler_Refresh_RateLimitedIncludesRetryAfter(t *testing.T) {
 	security := newAuthSecurityForTest(t, 100, 100, 10)
-	security.refreshIPLimiter = newFixedWindowRateLimiter(1, time.Minute)
+	security.refreshIPLimiter = newFixedWindowRateLimiter(staticLimit(1), time.Minute)
 	sessions := &fakeSessionService{refreshResp: coreid.SessionTokens{
 		AccessToken:           "access-token",
 		RefreshToken:          "refresh-token-next",
@@ -220,3 +262,146 @@ func TestAuthHandler_Refresh_RateLimitedIncludesRetryAfter(t *testing.T) {
 		t.Fatalf("session refresh calls = %d, want 1", sessions.refreshCalls)
 	}
 }
+
+func TestAuthHandler_Login_ReturnsMFAChallenge(t *testing.T) {
+	security := newAuthSecurityForTest(t, 100, 100, 5)
+	security.recordLoginFailure(context.Background(), "alice", "127.0.0.1", "req-0")
+	expiresAt := time.Now().UTC().Add(5 * time.Minute)
+	identity := &fakeAuthService{loginErr: &coreid.MFARequiredError{
+		Principal: coreid.Principal{ID: 4, Username: "alice"},
+		Challenge: coreid.MFAChallenge{Token: "mfa-token", ExpiresAt: expiresAt},
+	}}
+	h := &AuthHandler{Identity: identity, Security: security}
+
+	rr := httptest.NewRecorder()
+	h.Login(rr, loginReq(`{"username":"alice","password":"password123"}`))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 body=%s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if resp["mfa_required"] != true || resp["mfa_token"] != "mfa-token" {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+	if _, ok := resp["access_token"]; ok {
+		t.Fatal("password step must not return session tokens")
+	}
+	if failures, _, _, err := security.readThrottle(context.Background(), "user:alice"); err != nil || failures != 1 {
+		t.Fatalf("failure count = %d, err = %v; password step must not clear it", failures, err)
+	}
+}
+
+func TestAuthHandler_LoginMFA_FailuresCountTowardLockout(t *testing.T) {
+	security := newAuthSecurityForTest(t, 100, 100, 2)
+	identity := &fakeAuthService{
+		mfaPrincipal: coreid.Principal{ID: 4, Username: "alice"},
+		mfaErr:       coreid.ErrInvalidMFACode,
+	}
+	h := &AuthHandler{Identity: identity, Security: security}
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		h.LoginMFA(rr, mfaLoginReq(`{"mfa_token":"mfa-token","code":"000000"}`))
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d status = %d, want 401 body=%s", i+1, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	h.LoginMFA(rr, mfaLoginReq(`{"mfa_token":"mfa-token","code":"000000"}`))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429 body=%s", rr.Code, rr.Body.String())
+	}
+	if identity.mfaCalls != 2 {
+		t.Fatalf("CompleteMFALogin calls = %d, want 2", identity.mfaCalls)
+	}
+
+	passwordAttempt := httptest.NewRecorder()
+	h.Login(passwordAttempt, loginReq(`{"username":"alice","password":"password123"}`))
+	if passwordAttempt.Code != http.StatusTooManyRequests {
+		t.Fatalf("password login status = %d, want 429 after MFA lockout", passwordAttempt.Code)
+	}
+}
+
+func TestAuthHandler_LoginMFA_IssuesSession(t *testing.T) {
+	security := newAuthSecurityForTest(t, 100, 100, 5)
+	identity := &fakeAuthService{
+		mfaPrincipal: coreid.Principal{ID: 4, Username: "alice"},
+		loginResp: coreid.SessionTokens{
+			AccessToken:  "access-token",
+			RefreshToken: "refresh-token",
+			Session:      coreid.Session{ID: 9, UserID: 4},
+		},
+	}
+	h := &AuthHandler{Identity: identity, Security: security}
+
+	rr := httptest.NewRecorder()
+	h.LoginMFA(rr, mfaLoginReq(`{"mfa_token":"mfa-token","code":"123456","device_label":"Phone"}`))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 body=%s", rr.Code, rr.Body.String())
+	}
+	if identity.lastMFACode != "123456" || identity.lastMeta.DeviceLabel != "Phone" {
+		t.Fatalf("unexpected MFA call code=%q meta=%+v", identity.lastMFACode, identity.lastMeta)
+	}
+	if !strings.Contains(rr.Body.String(), `"access_token":"access-token"`) {
+		t.Fatalf("unexpected body: %s", rr.Body.String())
+	}
+
+	unknown := httptest.NewRecorder()
+	h.LoginMFA(unknown, mfaLoginReq(`{"mfa_token":"other","code":"123456"}`))
+	if unknown.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown challenge status = %d, want 401", unknown.Code)
+	}
+	var resp map[string]any
+	_ = json.Unmarshal(unknown.Body.Bytes(), &resp)
+	if resp["error"] != coreid.ErrInvalidMFAChallenge.Error() {
+		t.Fatalf("unexpected error body: %v", resp)
+	}
+	if identity.mfaCalls != 1 {
+		t.Fatalf("unknown challenge must not reach CompleteMFALogin, calls = %d", identity.mfaCalls)
+	}
+}
+
+func mfaLoginReq(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/login/mfa", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "req-1")
+	req.RemoteAddr = "127.0.0.1:3456"
+	return req
+}
+
+func TestAuthHandler_Refresh_TokenReuseDisconnectsRevokedSessions(t *testing.T) {
+	var logBuf bytes.Buffer
+	originalOut := log.Writer()
+	log.SetOutput(&logBuf)
+	t.Cleanup(func() {
+		log.SetOutput(originalOut)
+	})
+
+	sessions := &fakeSessionService{refreshErr: &coreid.RefreshTokenReuseError{UserID: 4, SessionIDs: []int64{7}}}
+	hub := &fakeSessionHub{}
+	h := &AuthHandler{Sessions: sessions, SessionHub: hub}
+
+	rr := httptest.NewRecorder()
+	h.Refresh(rr, refreshReq(`{"refresh_token":"rotated-out"}`))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401 body=%s", rr.Code, rr.Body.String())
+	}
+	if len(hub.disconnected) != 1 || hub.disconnected[0] != 7 {
+		t.Fatalf("disconnected = %v, want [7]", hub.disconnected)
+	}
+	logged := logBuf.String()
+	if !strings.Contains(logged, `"event":"auth_refresh_token_reuse"`) || !strings.Contains(logged, `"session_ids":[7]`) {
+		t.Fatalf("expected reuse security event, got %q", logged)
+	}
+
+	sessions.refreshErr = coreid.ErrInvalidRefreshToken
+	hub.disconnected = nil
+	rr = httptest.NewRecorder()
+	h.Refresh(rr, refreshReq(`{"refresh_token":"unknown"}`))
+	if rr.Code != http.StatusUnauthorized || len(hub.disconnected) != 0 {
+		t.Fatalf("unknown token status = %d, disconnected = %v", rr.Code, hub.disconnected)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/kyambuthia/go-chat-site/server/internal/auth"
 	"github.com/kyambuthia/go-chat-site/server/internal/config"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
 )
 
 var errAuthRateLimited = errors.New("rate limit exceeded")
@@ -37,6 +38,7 @@ func (e rateLimitedError) Is(target error) bool {
 
 type authSecurity struct {
 	db               *sql.DB
+	dialect          dialect.Dialect
 	perIPLimiter     requestRateLimiter
 	perUserLimiter   requestRateLimiter
 	refreshIPLimiter requestRateLimiter
@@ -45,25 +47,26 @@ type authSecurity struct {
 	lockoutDuration  time.Duration
 }
 
-func newAuthSecurity(db *sql.DB) (*authSecurity, error) {
+func newAuthSecurity(db *sql.DB, d dialect.Dialect) (*authSecurity, error) {
 	if db == nil {
 		return nil, nil
 	}
 
-	perIPLimiter, err := newSharedWindowRateLimiter(db, config.LoginRateLimitPerMinute(), time.Minute)
+	perIPLimiter, err := newSharedWindowRateLimiter(db, d, config.LoginRateLimitPerMinute, time.Minute)
 	if err != nil {
 		return nil, err
 	}
-	perUserLimiter, err := newSharedWindowRateLimiter(db, config.LoginUserRateLimitPerMinute(), time.Minute)
+	perUserLimiter, err := newSharedWindowRateLimiter(db, d, config.LoginUserRateLimitPerMinute, time.Minute)
 	if err != nil {
 		return nil, err
 	}
-	refreshIPLimiter, err := newSharedWindowRateLimiter(db, config.RefreshRateLimitPerMinute(), time.Minute)
+	refreshIPLimiter, err := newSharedWindowRateLimiter(db, d, config.RefreshRateLimitPerMinute, time.Minute)
 	if err != nil {
 		return nil, err
 	}
 	security := &authSecurity{
 		db:               db,
+		dialect:          d,
 		perIPLimiter:     perIPLimiter,
 		perUserLimiter:   perUserLimiter,
 		refreshIPLimiter: refreshIPLimiter,
@@ -81,13 +84,14 @@ func (s *authSecurity) init(ctx context.Context) error {
 	if s == nil || s.db == nil {
 		return nil
 	}
+	timestamp := s.dialect.TimestampType()
 	_, err := s.db.ExecContext(ctx, `
 		CREATE TABLE IF NOT EXISTS auth_login_throttles (
 			scope_key TEXT PRIMARY KEY,
 			failure_count INTEGER NOT NULL DEFAULT 0,
-			first_failed_at DATETIME,
-			locked_until DATETIME,
-			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			first_failed_at `+timestamp+`,
+			locked_until `+timestamp+`,
+			updated_at `+timestamp+` NOT NULL DEFAULT CURRENT_TIMESTAMP
 		)
 	`)
 	return err
@@ -182,7 +186,7 @@ func (s *authSecurity) recordLoginFailure(ctx context.Context, username string,
 		until := now.Add(s.lockoutDuration)
 		lockedUntil = &until
 	}
-	_, _ = s.db.ExecContext(ctx, `
+	_, _ = s.db.ExecContext(ctx, s.dialect.Rebind(`
 		INSERT INTO auth_login_throttles (scope_key, failure_count, first_failed_at, locked_until, updated_at)
 		VALUES (?, ?, ?, ?, ?)
 		ON CONFLICT(scope_key) DO UPDATE SET
@@ -190,7 +194,7 @@ func (s *authSecurity) recordLoginFailure(ctx context.Context, username string,
 			first_failed_at = excluded.first_failed_at,
 			locked_until = excluded.locked_until,
 			updated_at = excluded.updated_at
-	`, key, count, firstFailedAt, lockedUntil, now)
+	`), key, count, firstFailedAt, lockedUntil, now)
 
 	fields := map[string]any{
 		"request_id":    requestID,
@@ -202,7 +206,6 @@ func (s *authSecurity) recordLoginFailure(ctx context.Context, username string,
 		fields["locked_until"] = lockedUntil.UTC().Format(time.RFC3339)
 	}
 	auth.LogSecurityEvent("auth_login_failed", fields)
-	s.maybeCleanup()
 }
 
 func (s *authSecurity) recordLoginSuccess(ctx context.Context, userID int, username string, ip string, requestID string) {
@@ -211,7 +214,7 @@ func (s *authSecurity) recordLoginSuccess(ctx context.Context, userID int, usern
 	}
 	normalizedUsername := normalizeThrottleUsername(username)
 	if normalizedUsername != "" {
-		_, _ = s.db.ExecContext(ctx, `DELETE FROM auth_login_throttles WHERE scope_key = ?`, "user:"+normalizedUsername)
+		_, _ = s.db.ExecContext(ctx, s.dialect.Rebind(`DELETE FROM auth_login_throttles WHERE scope_key = ?`), "user:"+normalizedUsername)
 	}
 	auth.LogSecurityEvent("auth_login_succeeded", map[string]any{
 		"request_id": requestID,
@@ -219,7 +222,6 @@ func (s *authSecurity) recordLoginSuccess(ctx context.Context, userID int, usern
 		"username":   normalizedUsername,
 		"ip_address": ip,
 	})
-	s.maybeCleanup()
 }
 
 func (s *authSecurity) readThrottle(ctx context.Context, key string) (int, time.Time, time.Time, error) {
@@ -229,11 +231,11 @@ func (s *authSecurity) readThrottle(ctx context.Context, key string) (int, time.
 	var count int
 	var firstFailedAt sql.NullTime
 	var lockedUntil sql.NullTime
-	err := s.db.QueryRowContext(ctx, `
+	err := s.db.QueryRowContext(ctx, s.dialect.Rebind(`
 		SELECT failure_count, first_failed_at, locked_until
 		FROM auth_login_throttles
 		WHERE scope_key = ?
-	`, key).Scan(&count, &firstFailedAt, &lockedUntil)
+	`), key).Scan(&count, &firstFailedAt, &lockedUntil)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, time.Time{}, time.Time{}, nil
@@ -256,14 +258,6 @@ func (s *authSecurity) lockedUntil(ctx context.Context, key string) (time.Time,
 	return lockedUntil, err
 }
 
-func (s *authSecurity) maybeCleanup() {
-	if s == nil || s.db == nil {
-		return
-	}
-	cutoff := time.Now().UTC().Add(-24 * time.Hour)
-	_, _ = s.db.Exec(`DELETE FROM auth_login_throttles WHERE updated_at < ?`, cutoff)
-}
-
 func normalizeThrottleUsername(username string) string {
 	return strings.ToLower(strings.TrimSpace(username))
 }
@@ -20,9 +20,9 @@ func newAuthSecurityForTest(t *testing.T, perIPLimit int, perUserLimit int, thre
 
 	security := &authSecurity{
 		db:               s.DB,
-		perIPLimiter:     newFixedWindowRateLimiter(perIPLimit, time.Minute),
-		perUserLimiter:   newFixedWindowRateLimiter(perUserLimit, time.Minute),
-		refreshIPLimiter: newFixedWindowRateLimiter(100, time.Minute),
+		perIPLimiter:     newFixedWindowRateLimiter(staticLimit(perIPLimit), time.Minute),
+		perUserLimiter:   newFixedWindowRateLimiter(staticLimit(perUserLimit), time.Minute),
+		refreshIPLimiter: newFixedWindowRateLimiter(staticLimit(100), time.Minute),
 		lockoutThreshold: threshold,
 		lockoutWindow:    time.Hour,
 		lockoutDuration:  time.Hour,
@@ -117,7 +117,7 @@ func TestAuthSecurity_EnforcesPerIPRateLimit(t *testing.T) {
 
 func TestAuthSecurity_EnforcesRefreshPerIPRateLimit(t *testing.T) {
 	security := newAuthSecurityForTest(t, 100, 100, 10)
-	security.refreshIPLimiter = newFixedWindowRateLimiter(1, time.Minute)
+	security.refreshIPLimiter = newFixedWindowRateLimiter(staticLimit(1), time.Minute)
 	ctx := context.Background()
 
 	if err := security.allowRefresh(ctx, "127.0.0.1", "req-1"); err != nil {
@@ -75,6 +75,19 @@ func (f *fakeContactsService) RespondToInvite(ctx context.Context, inviteID int,
 	return f.err
 }
 
+func (f *fakeContactsService) ListOutgoingInvites(ctx context.Context, userID corecontacts.UserID) ([]corecontacts.Invite, error) {
+	_ = ctx
+	f.lastUserID = userID
+	return f.invites, f.err
+}
+
+func (f *fakeContactsService) CancelInvite(ctx context.Context, inviteID int, userID corecontacts.UserID) error {
+	_ = ctx
+	f.lastInvite = inviteID
+	f.lastUserID = userID
+	return f.err
+}
+
 func authedJSONReq(t *testing.T, method, target string, body []byte, userID int) *http.Request {
 	t.Helper()
 	req := httptest.NewRequest(method, target, bytes.NewReader(body))
@@ -0,0 +1,161 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coredirectory "github.com/kyambuthia/go-chat-site/server/internal/core/directory"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+// DirectoryHandler serves user search and the caller's discoverability
+// setting. Limiter is keyed by user, so one account cannot page through the
+// directory however many addresses it searches from.
+type DirectoryHandler struct {
+	Directory coredirectory.Service
+	Limiter   requestRateLimiter
+}
+
+// Search takes q and an optional limit and returns matching users, each with
+// its relationship to the caller.
+func (h *DirectoryHandler) Search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Directory == nil {
+		web.JSONError(w, errors.New("user search unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			web.JSONError(w, errors.New("invalid limit"), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	if h.Limiter != nil {
+		decision := h.Limiter.allow("user-search:user:" + strconv.Itoa(userID))
+		if !decision.Allowed {
+			auth.LogSecurityEvent("user_search_rate_limited", map[string]any{
+				"request_id":          r.Header.Get("X-Request-ID"),
+				"user_id":             userID,
+				"ip_address":          clientIP(r),
+				"retry_after_seconds": retryAfterSeconds(decision.RetryAfter),
+			})
+			if seconds := retryAfterSeconds(decision.RetryAfter); seconds > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"error":               "rate limit exceeded",
+				"retry_after_seconds": retryAfterSeconds(decision.RetryAfter),
+			})
+			return
+		}
+	}
+
+	results, err := h.Directory.Search(r.Context(), userID, r.URL.Query().Get("q"), limit)
+	if err != nil {
+		writeDirectoryError(w, err)
+		return
+	}
+	resp := make([]map[string]any, 0, len(results))
+	for _, result := range results {
+		item := map[string]any{
+			"id":           result.UserID,
+			"username":     result.Username,
+			"display_name": result.DisplayName,
+			"avatar_url":   result.AvatarURL,
+			"relationship": string(result.Relationship),
+		}
+		if result.InviteID != 0 {
+			item["invite_id"] = result.InviteID
+		}
+		resp = append(resp, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *DirectoryHandler) GetDiscoverability(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Directory == nil {
+		web.JSONError(w, errors.New("user search unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	d, err := h.Directory.GetDiscoverability(r.Context(), userID)
+	if err != nil {
+		writeDirectoryError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"discoverability": string(d)})
+}
+
+// UpdateDiscoverability takes {"discoverability": "everyone"|"username"|"nobody"}.
+func (h *DirectoryHandler) UpdateDiscoverability(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Directory == nil {
+		web.JSONError(w, errors.New("user search unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Discoverability string `json:"discoverability"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+	d := coredirectory.Discoverability(req.Discoverability)
+	if err := h.Directory.SetDiscoverability(r.Context(), userID, d); err != nil {
+		writeDirectoryError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"discoverability": string(d)})
+}
+
+func writeDirectoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, coredirectory.ErrInvalidQuery), errors.Is(err, coredirectory.ErrInvalidDiscoverability):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, coredirectory.ErrUserNotFound):
+		web.JSONError(w, err, http.StatusNotFound)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
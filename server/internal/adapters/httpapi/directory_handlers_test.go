@@ -0,0 +1,78 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+type searchResult struct {
+	ID           int    `json:"id"`
+	Username     string `json:"username"`
+	Relationship string `json:"relationship"`
+	InviteID     int    `json:"invite_id"`
+}
+
+func searchUsers(t *testing.T, h http.Handler, token, query string) (int, []searchResult) {
+	t.Helper()
+	rr := authedRequest(t, h, http.MethodGet, "/api/users/search?q="+query, token, nil)
+	var results []searchResult
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr.Code, results
+}
+
+func TestDirectoryHandlers_SearchHonoursDiscoverabilityAndAnnotates(t *testing.T) {
+	t.Setenv("USER_SEARCH_RATE_LIMIT_PER_MINUTE", "100")
+	router := newInviteRouter(t, "searcher", "alice", "alicia", "alina")
+	searcher, alina := loginAs(t, router, "searcher"), loginAs(t, router, "alina")
+
+	if rr := postJSON(t, router, "/api/invites/send", searcher, map[string]string{"username": "alicia"}); rr.Code != http.StatusCreated {
+		t.Fatalf("send status = %d", rr.Code)
+	}
+	if rr := authedRequest(t, router, http.MethodPut, "/api/me/discoverability", alina, map[string]string{"discoverability": "friends"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid discoverability status = %d", rr.Code)
+	}
+	if rr := authedRequest(t, router, http.MethodPut, "/api/me/discoverability", alina, map[string]string{"discoverability": "username"}); rr.Code != http.StatusOK {
+		t.Fatalf("update discoverability status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	code, results := searchUsers(t, router, searcher, "ali")
+	if code != http.StatusOK || len(results) != 2 || results[0].Username != "alice" || results[1].Username != "alicia" {
+		t.Fatalf("search = %d %+v", code, results)
+	}
+	if results[0].Relationship != "none" || results[1].Relationship != "invite_sent" || results[1].InviteID == 0 {
+		t.Fatalf("relationships = %+v", results)
+	}
+	if _, results := searchUsers(t, router, searcher, "alina"); len(results) != 1 || results[0].Username != "alina" {
+		t.Fatalf("exact search for username-only account = %+v", results)
+	}
+	if _, results := searchUsers(t, router, searcher, "alcie"); len(results) == 0 || results[0].Username != "alice" {
+		t.Fatalf("typo search = %+v", results)
+	}
+	if code, _ := searchUsers(t, router, searcher, "a"); code != http.StatusBadRequest {
+		t.Fatalf("one-letter query status = %d", code)
+	}
+}
+
+func TestDirectoryHandlers_SearchIsRateLimitedPerUser(t *testing.T) {
+	t.Setenv("USER_SEARCH_RATE_LIMIT_PER_MINUTE", "2")
+	router := newInviteRouter(t, "alice", "bob")
+	alice, bob := loginAs(t, router, "alice"), loginAs(t, router, "bob")
+
+	for i := 0; i < 2; i++ {
+		if code, _ := searchUsers(t, router, alice, "bob"); code != http.StatusOK {
+			t.Fatalf("search %d status = %d", i+1, code)
+		}
+	}
+	rr := authedRequest(t, router, http.MethodGet, "/api/users/search?q=bob", alice, nil)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("over limit status = %d headers=%v", rr.Code, rr.Header())
+	}
+	if code, _ := searchUsers(t, router, bob, "alice"); code != http.StatusOK {
+		t.Fatalf("other user status = %d", code)
+	}
+}
@@ -75,6 +75,8 @@ func (h *InviteHandler) GetInvites(w http.ResponseWriter, r *http.Request) {
 		resp = append(resp, map[string]any{
 			"id":               inv.ID,
 			"inviter_username": inv.InviterUsername,
+			"created_at":       inv.CreatedAt,
+			"expires_at":       inv.ExpiresAt,
 		})
 	}
 
@@ -82,6 +84,73 @@ func (h *InviteHandler) GetInvites(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// GetOutgoingInvites lists the caller's own pending invites.
+func (h *InviteHandler) GetOutgoingInvites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	invites, err := h.Contacts.ListOutgoingInvites(r.Context(), corecontacts.UserID(userID))
+	if err != nil {
+		web.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]map[string]any, 0, len(invites))
+	for _, inv := range invites {
+		resp = append(resp, map[string]any{
+			"id":                 inv.ID,
+			"recipient_username": inv.RecipientUsername,
+			"created_at":         inv.CreatedAt,
+			"expires_at":         inv.ExpiresAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// CancelInvite withdraws one of the caller's pending invites.
+func (h *InviteHandler) CancelInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		InviteID int `json:"invite_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Contacts.CancelInvite(r.Context(), req.InviteID, corecontacts.UserID(userID)); err != nil {
+		if errors.Is(err, corecontacts.ErrInviteNotFound) {
+			web.JSONError(w, errors.New("invite not found"), http.StatusNotFound)
+			return
+		}
+		web.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 func (h *InviteHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
 	h.updateInviteStatus(w, r, "accepted")
 }
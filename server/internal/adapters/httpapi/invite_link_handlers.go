@@ -0,0 +1,204 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	"github.com/kyambuthia/go-chat-site/server/internal/config"
+	corecontacts "github.com/kyambuthia/go-chat-site/server/internal/core/contacts"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+// InviteLinkHandler manages shareable invite links. Links is nil when
+// INVITE_LINK_SECRET is unset, and every route then answers 503.
+type InviteLinkHandler struct {
+	Links corecontacts.InviteLinks
+}
+
+// CreateLink takes optional max_uses and expires_in_hours and returns the
+// link with the URL to share.
+func (h *InviteLinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Links == nil {
+		web.JSONError(w, errors.New("invite links unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		MaxUses        int `json:"max_uses"`
+		ExpiresInHours int `json:"expires_in_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.Links.CreateInviteLink(r.Context(), corecontacts.UserID(userID), req.MaxUses, time.Duration(req.ExpiresInHours)*time.Hour)
+	if err != nil {
+		writeInviteLinkError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("invite_link_created", map[string]any{
+		"request_id": r.Header.Get("X-Request-ID"),
+		"user_id":    userID,
+		"link_id":    link.ID,
+		"max_uses":   link.MaxUses,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(inviteLinkJSON(link))
+}
+
+func (h *InviteLinkHandler) ListLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Links == nil {
+		web.JSONError(w, errors.New("invite links unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	links, err := h.Links.ListInviteLinks(r.Context(), corecontacts.UserID(userID))
+	if err != nil {
+		writeInviteLinkError(w, err)
+		return
+	}
+	resp := make([]map[string]any, 0, len(links))
+	for _, link := range links {
+		resp = append(resp, inviteLinkJSON(link))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeLink stops a link from being redeemed again. Contacts it already
+// created are kept.
+func (h *InviteLinkHandler) RevokeLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Links == nil {
+		web.JSONError(w, errors.New("invite links unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Links.RevokeInviteLink(r.Context(), req.ID, corecontacts.UserID(userID)); err != nil {
+		writeInviteLinkError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("invite_link_revoked", map[string]any{
+		"request_id": r.Header.Get("X-Request-ID"),
+		"user_id":    userID,
+		"link_id":    req.ID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RedeemLink makes the caller and the link's owner contacts. Redeeming the
+// same link twice is not an error.
+func (h *InviteLinkHandler) RedeemLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Links == nil {
+		web.JSONError(w, errors.New("invite links unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.Links.RedeemInviteLink(r.Context(), corecontacts.UserID(userID), strings.TrimSpace(req.Code))
+	if err != nil {
+		writeInviteLinkError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("invite_link_redeemed", map[string]any{
+		"request_id": r.Header.Get("X-Request-ID"),
+		"user_id":    userID,
+		"link_id":    link.ID,
+		"owner_id":   int(link.OwnerID),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"contact": map[string]any{
+			"id":       int(link.OwnerID),
+			"username": link.OwnerUsername,
+		},
+	})
+}
+
+func inviteLinkJSON(link corecontacts.InviteLink) map[string]any {
+	return map[string]any{
+		"id":         link.ID,
+		"code":       link.Code,
+		"url":        strings.TrimRight(config.NotificationsAppURL(), "/") + "/invite/" + link.Code,
+		"max_uses":   link.MaxUses,
+		"use_count":  link.UseCount,
+		"created_at": link.CreatedAt,
+		"expires_at": link.ExpiresAt,
+		"revoked_at": link.RevokedAt,
+		"active":     link.Active(time.Now()),
+	}
+}
+
+func writeInviteLinkError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, corecontacts.ErrInvalidInviteLink), errors.Is(err, corecontacts.ErrInviteLinkOwn):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, corecontacts.ErrInviteLinkInvalid), errors.Is(err, corecontacts.ErrInviteLinkNotFound):
+		web.JSONError(w, err, http.StatusNotFound)
+	case errors.Is(err, corecontacts.ErrInviteLinkLimit):
+		web.JSONError(w, err, http.StatusConflict)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,155 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/transport/wsrelay"
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+)
+
+func loginAs(t *testing.T, h http.Handler, username string) string {
+	t.Helper()
+	rr := postJSON(t, h, "/api/login", "", map[string]string{"username": username, "password": "password123"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login %s status = %d body=%s", username, rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.AccessToken
+}
+
+func newInviteRouter(t *testing.T, users ...string) http.Handler {
+	t.Helper()
+	if err := auth.ConfigureJWT("invite-link-handlers-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	s := setupRouterStore(t)
+	for _, name := range users {
+		if _, err := s.CreateUser(name, "password123"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hub := wsrelay.NewHub()
+	go hub.Run()
+	t.Cleanup(hub.Shutdown)
+	return NewRouter(s, hub)
+}
+
+func TestInviteLinkHandlers_CreateRedeemAndRevoke(t *testing.T) {
+	t.Setenv("INVITE_LINK_SECRET", strings.Repeat("k", 32))
+	t.Setenv("NOTIFICATIONS_APP_URL", "https://chat.example.com/")
+	router := newInviteRouter(t, "alice", "bob", "carol")
+	alice, bob, carol := loginAs(t, router, "alice"), loginAs(t, router, "bob"), loginAs(t, router, "carol")
+
+	if rr := postJSON(t, router, "/api/invite-links", alice, map[string]any{"max_uses": 101}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("max_uses 101 status = %d, want 400", rr.Code)
+	}
+	rr := postJSON(t, router, "/api/invite-links", alice, map[string]any{"max_uses": 1, "expires_in_hours": 24})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var link struct {
+		ID   int64  `json:"id"`
+		Code string `json:"code"`
+		URL  string `json:"url"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&link); err != nil {
+		t.Fatal(err)
+	}
+	if link.URL != "https://chat.example.com/invite/"+link.Code {
+		t.Fatalf("url = %q", link.URL)
+	}
+
+	if rr := postJSON(t, router, "/api/invite-links/redeem", alice, map[string]string{"code": link.Code}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("own link status = %d, want 400", rr.Code)
+	}
+	tampered := "A" + link.Code[1:]
+	if tampered == link.Code {
+		tampered = "B" + link.Code[1:]
+	}
+	if rr := postJSON(t, router, "/api/invite-links/redeem", bob, map[string]string{"code": tampered}); rr.Code != http.StatusNotFound {
+		t.Fatalf("tampered code status = %d, want 404", rr.Code)
+	}
+	for i := 0; i < 2; i++ {
+		rr := postJSON(t, router, "/api/invite-links/redeem", bob, map[string]string{"code": link.Code})
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"username":"alice"`) {
+			t.Fatalf("redeem %d status = %d body=%s", i+1, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := authedRequest(t, router, http.MethodGet, "/api/contacts", alice, nil); !strings.Contains(rr.Body.String(), `"username":"bob"`) {
+		t.Fatalf("alice contacts after redeem = %s", rr.Body.String())
+	}
+	if rr := postJSON(t, router, "/api/invite-links/redeem", carol, map[string]string{"code": link.Code}); rr.Code != http.StatusNotFound {
+		t.Fatalf("used-up link status = %d, want 404", rr.Code)
+	}
+
+	rr = postJSON(t, router, "/api/invite-links", alice, map[string]any{"max_uses": 5})
+	if err := json.NewDecoder(rr.Body).Decode(&link); err != nil {
+		t.Fatal(err)
+	}
+	if rr := authedRequest(t, router, http.MethodDelete, "/api/invite-links", bob, map[string]int64{"id": link.ID}); rr.Code != http.StatusNotFound {
+		t.Fatalf("revoke by other user status = %d, want 404", rr.Code)
+	}
+	if rr := authedRequest(t, router, http.MethodDelete, "/api/invite-links", alice, map[string]int64{"id": link.ID}); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d", rr.Code)
+	}
+	if rr := postJSON(t, router, "/api/invite-links/redeem", carol, map[string]string{"code": link.Code}); rr.Code != http.StatusNotFound {
+		t.Fatalf("revoked link status = %d, want 404", rr.Code)
+	}
+	rr = authedRequest(t, router, http.MethodGet, "/api/invite-links", alice, nil)
+	var links []map[string]any
+	if err := json.NewDecoder(rr.Body).Decode(&links); err != nil || len(links) != 2 {
+		t.Fatalf("list = %v, %v", links, err)
+	}
+	if links[0]["active"] != false || links[0]["revoked_at"] == nil {
+		t.Fatalf("revoked link = %v", links[0])
+	}
+}
+
+func TestInviteLinkHandlers_UnavailableWithoutSecret(t *testing.T) {
+	t.Setenv("INVITE_LINK_SECRET", "")
+	router := newInviteRouter(t, "alice")
+	alice := loginAs(t, router, "alice")
+
+	if rr := postJSON(t, router, "/api/invite-links", alice, map[string]any{}); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rr.Code)
+	}
+}
+
+func TestInviteHandlers_OutgoingAndCancel(t *testing.T) {
+	router := newInviteRouter(t, "alice", "bob")
+	alice, bob := loginAs(t, router, "alice"), loginAs(t, router, "bob")
+
+	if rr := postJSON(t, router, "/api/invites/send", alice, map[string]string{"username": "bob"}); rr.Code != http.StatusCreated {
+		t.Fatalf("send status = %d", rr.Code)
+	}
+	rr := authedRequest(t, router, http.MethodGet, "/api/invites/outgoing", alice, nil)
+	var outgoing []struct {
+		ID                int    `json:"id"`
+		RecipientUsername string `json:"recipient_username"`
+		ExpiresAt         string `json:"expires_at"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&outgoing); err != nil || len(outgoing) != 1 || outgoing[0].RecipientUsername != "bob" || outgoing[0].ExpiresAt == "" {
+		t.Fatalf("outgoing = %+v, %v", outgoing, err)
+	}
+
+	if rr := postJSON(t, router, "/api/invites/cancel", bob, map[string]int{"invite_id": outgoing[0].ID}); rr.Code != http.StatusNotFound {
+		t.Fatalf("cancel by recipient status = %d, want 404", rr.Code)
+	}
+	if rr := postJSON(t, router, "/api/invites/cancel", alice, map[string]int{"invite_id": outgoing[0].ID}); rr.Code != http.StatusOK {
+		t.Fatalf("cancel status = %d", rr.Code)
+	}
+	if rr := authedRequest(t, router, http.MethodGet, "/api/invites", bob, nil); strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Fatalf("bob invites after cancel = %s", rr.Body.String())
+	}
+	if rr := postJSON(t, router, "/api/invites/send", alice, map[string]string{"username": "bob"}); rr.Code != http.StatusCreated {
+		t.Fatalf("resend after cancel status = %d", rr.Code)
+	}
+}
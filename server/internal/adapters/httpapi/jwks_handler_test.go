@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+)
+
+func TestJWKS_PublishesKeyThatVerifiesIssuedTokens(t *testing.T) {
+	router, _ := passwordTestRouter(t)
+	keys, err := auth.NewKeySet(auth.AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.ConfigureKeySet(keys); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = auth.ConfigureKeySet(nil) })
+
+	access, _ := loginForTest(t, router, "password123")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("jwks status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var jwks auth.JWKS
+	if err := json.NewDecoder(rr.Body).Decode(&jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].KID != keys.ActiveKID || jwks.Keys[0].Kty != "OKP" {
+		t.Fatalf("jwks = %+v", jwks)
+	}
+
+	// Verify the access token using only what the JWKS published.
+	pub, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(access, ".")
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), []byte(parts[0]+"."+parts[1]), sig) {
+		t.Fatal("access token signature does not verify against the published key")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("/api/me with asymmetric token status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if err := auth.ConfigureKeySet(nil); err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if strings.TrimSpace(rr.Body.String()) != `{"keys":[]}` {
+		t.Fatalf("HMAC-only jwks = %s", rr.Body.String())
+	}
+}
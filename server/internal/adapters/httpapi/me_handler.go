@@ -6,12 +6,16 @@ import (
 	"net/http"
 
 	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreaccount "github.com/kyambuthia/go-chat-site/server/internal/core/account"
 	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
 	"github.com/kyambuthia/go-chat-site/server/internal/web"
 )
 
 type MeHandler struct {
-	Identity coreid.ProfileService
+	Identity   coreid.ProfileService
+	Account    coreaccount.Service
+	Security   *authSecurity
+	SessionHub interface{ DisconnectUser(userID int) }
 }
 
 func (h *MeHandler) GetMe(w http.ResponseWriter, r *http.Request) {
@@ -3,8 +3,11 @@ package httpapi
 import (
 	"encoding/json"
 	"errors"
+	"html"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kyambuthia/go-chat-site/server/internal/auth"
 	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
@@ -14,7 +17,9 @@ import (
 type MessagesHandler struct {
 	Messaging        coremsg.PersistenceService
 	Threads          coremsg.ThreadSummaryService
+	Search           coremsg.SearchService
 	ReceiptTransport coremsg.Transport
+	Retention        coremsg.RetentionService
 }
 
 func (h *MessagesHandler) GetOutbox(w http.ResponseWriter, r *http.Request) {
@@ -218,6 +223,16 @@ func (h *MessagesHandler) GetSync(w http.ResponseWriter, r *http.Request) {
 		afterID = n
 	}
 
+	purgedAfterID := int64(0)
+	if raw := r.URL.Query().Get("purged_after_id"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			web.JSONError(w, errors.New("invalid purged_after_id"), http.StatusBadRequest)
+			return
+		}
+		purgedAfterID = n
+	}
+
 	result, err := coremsg.NewSyncService(h.Messaging).Sync(r.Context(), userID, afterID, limit)
 	if err != nil {
 		web.JSONError(w, err, http.StatusInternalServerError)
@@ -232,6 +247,23 @@ func (h *MessagesHandler) GetSync(w http.ResponseWriter, r *http.Request) {
 		"messages": storedMessagesToJSON(result.Messages),
 		"has_more": result.HasMore,
 	}
+	if h.Retention != nil {
+		page, err := h.Retention.ListPurgedAfter(r.Context(), userID, purgedAfterID, limit)
+		if err != nil {
+			web.JSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+		ids := make([]int64, 0, len(page.Purged))
+		for _, purged := range page.Purged {
+			ids = append(ids, purged.MessageID)
+		}
+		resp["purged"] = map[string]any{
+			"after_id":      page.AfterID,
+			"next_after_id": page.NextAfterID,
+			"message_ids":   ids,
+			"has_more":      page.HasMore,
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(resp)
@@ -490,11 +522,240 @@ func (h *MessagesHandler) tryPushReceipt(senderUserID int, kind coremsg.MessageK
 	})
 }
 
+// GetThreadTimer serves GET /api/messaging/threads/timer?user_id=N, the
+// disappearing-message timer of the caller's thread with user N.
+func (h *MessagesHandler) GetThreadTimer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Retention == nil {
+		web.JSONError(w, errors.New("disappearing messages unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+	peerUserID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || peerUserID <= 0 {
+		web.JSONError(w, errors.New("invalid user_id"), http.StatusBadRequest)
+		return
+	}
+
+	setting, err := h.Retention.GetThreadRetention(r.Context(), userID, peerUserID)
+	if err != nil {
+		writeThreadTimerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(threadTimerToJSON(setting))
+}
+
+// SetThreadTimer serves PUT /api/messaging/threads/timer. Either participant
+// may change the timer; the change is announced in the thread with a system
+// message that is relayed to both users' connected devices.
+func (h *MessagesHandler) SetThreadTimer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Retention == nil {
+		web.JSONError(w, errors.New("disappearing messages unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+	var req struct {
+		UserID     int   `json:"user_id"`
+		TTLSeconds int64 `json:"ttl_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+	if req.UserID <= 0 || req.TTLSeconds < 0 || req.TTLSeconds > int64(coremsg.MaxRetentionTTL/time.Second) {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	setting, announcement, err := h.Retention.SetThreadRetention(r.Context(), userID, req.UserID, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		writeThreadTimerError(w, err)
+		return
+	}
+	resp := threadTimerToJSON(setting)
+	if announcement.ID > 0 {
+		resp["announcement"] = storedMessagesToJSON([]coremsg.StoredMessage{announcement})[0]
+		if h.ReceiptTransport != nil {
+			event := coremsg.Message{
+				Type:            coremsg.KindThreadTimer,
+				StoredMessageID: announcement.ID,
+				Body:            announcement.Body,
+				ContentKind:     announcement.ContentKind,
+			}
+			_ = h.ReceiptTransport.SendDirect(req.UserID, event)
+			_ = h.ReceiptTransport.SendDirect(userID, event)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func writeThreadTimerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, coremsg.ErrThreadPeerNotFound):
+		web.JSONError(w, errors.New("user not found"), http.StatusNotFound)
+	case errors.Is(err, coremsg.ErrInvalidRetentionTTL):
+		web.JSONError(w, err, http.StatusBadRequest)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func threadTimerToJSON(setting coremsg.ThreadRetention) map[string]any {
+	resp := map[string]any{
+		"user_id":     setting.PeerUserID,
+		"ttl_seconds": int64(setting.TTL / time.Second),
+	}
+	if setting.UpdatedByUserID > 0 {
+		resp["updated_by_user_id"] = setting.UpdatedByUserID
+		resp["updated_at"] = setting.UpdatedAt
+	}
+	return resp
+}
+
+// SearchMessages serves GET /api/messaging/search over the caller's plaintext
+// history. Snippets are HTML-escaped with matches wrapped in <mark>.
+func (h *MessagesHandler) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Search == nil {
+		web.JSONError(w, errors.New("messaging search unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	params := r.URL.Query()
+	q := coremsg.SearchQuery{
+		UserID:      userID,
+		Text:        params.Get("q"),
+		ContentKind: params.Get("content_kind"),
+		Sort:        coremsg.SearchSort(params.Get("sort")),
+	}
+	if raw := params.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			web.JSONError(w, errors.New("invalid limit"), http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+	if raw := params.Get("with_user_id"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			web.JSONError(w, errors.New("invalid with_user_id"), http.StatusBadRequest)
+			return
+		}
+		q.WithUserID = n
+	}
+	if raw := params.Get("before_id"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			web.JSONError(w, errors.New("invalid before_id"), http.StatusBadRequest)
+			return
+		}
+		q.BeforeID = n
+	}
+	if raw := params.Get("since"); raw != "" {
+		t, _, err := parseSearchTime(raw)
+		if err != nil {
+			web.JSONError(w, errors.New("invalid since"), http.StatusBadRequest)
+			return
+		}
+		q.Since = t
+	}
+	if raw := params.Get("until"); raw != "" {
+		t, dateOnly, err := parseSearchTime(raw)
+		if err != nil {
+			web.JSONError(w, errors.New("invalid until"), http.StatusBadRequest)
+			return
+		}
+		if dateOnly {
+			// A bare date includes that whole day.
+			t = t.AddDate(0, 0, 1)
+		}
+		q.Until = t
+	}
+
+	results, err := h.Search.SearchMessages(r.Context(), q)
+	if err != nil {
+		if errors.Is(err, coremsg.ErrInvalidSearchQuery) {
+			web.JSONError(w, err, http.StatusBadRequest)
+			return
+		}
+		web.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	msgs := make([]coremsg.StoredMessage, 0, len(results))
+	for _, result := range results {
+		msgs = append(msgs, result.Message)
+	}
+	resp := storedMessagesToJSON(msgs)
+	for i, result := range results {
+		resp[i]["snippet"] = highlightSnippet(result.Snippet)
+		resp[i]["highlight"] = highlightSnippet(result.Highlight)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// parseSearchTime accepts RFC 3339 timestamps or YYYY-MM-DD dates (UTC) and
+// reports which form was used.
+func parseSearchTime(raw string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, raw)
+	return t, true, err
+}
+
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, coremsg.SnippetMatchStart, "<mark>")
+	return strings.ReplaceAll(escaped, coremsg.SnippetMatchEnd, "</mark>")
+}
+
 func writeStoredMessagesJSON(w http.ResponseWriter, msgs []coremsg.StoredMessage) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(storedMessagesToJSON(msgs))
 }
 
+func attachmentSummariesToJSON(summaries []coremsg.AttachmentSummary) []map[string]any {
+	out := make([]map[string]any, 0, len(summaries))
+	for _, summary := range summaries {
+		item := map[string]any{
+			"id":         summary.ID,
+			"mime_type":  summary.MimeType,
+			"size_bytes": summary.SizeBytes,
+			"encrypted":  summary.Encrypted,
+		}
+		if summary.Width > 0 && summary.Height > 0 {
+			item["width"] = summary.Width
+			item["height"] = summary.Height
+		}
+		if summary.Placeholder != "" {
+			item["placeholder"] = summary.Placeholder
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
 func storedMessagesToJSON(msgs []coremsg.StoredMessage) []map[string]any {
 	resp := make([]map[string]any, 0, len(msgs))
 	for _, msg := range msgs {
@@ -518,6 +779,12 @@ func storedMessagesToJSON(msgs []coremsg.StoredMessage) []map[string]any {
 		if msg.RecipientDeviceID > 0 {
 			item["recipient_device_id"] = msg.RecipientDeviceID
 		}
+		if len(msg.AttachmentIDs) > 0 {
+			item["attachment_ids"] = msg.AttachmentIDs
+		}
+		if len(msg.Attachments) > 0 {
+			item["attachments"] = attachmentSummariesToJSON(msg.Attachments)
+		}
 		if msg.ClientMessageID > 0 {
 			item["client_message_id"] = msg.ClientMessageID
 		}
@@ -530,6 +797,9 @@ func storedMessagesToJSON(msgs []coremsg.StoredMessage) []map[string]any {
 		if msg.ReadAt != nil {
 			item["read_at"] = *msg.ReadAt
 		}
+		if msg.ExpiresAt != nil {
+			item["expires_at"] = *msg.ExpiresAt
+		}
 		resp = append(resp, item)
 	}
 	return resp
@@ -945,3 +945,208 @@ func TestMessagesHandler_MarkDelivered_ValidatesAndDelegates(t *testing.T) {
 		}
 	})
 }
+
+type fakeSearchService struct {
+	results []coremsg.SearchResult
+	err     error
+	last    coremsg.SearchQuery
+}
+
+func (f *fakeSearchService) SearchMessages(ctx context.Context, q coremsg.SearchQuery) ([]coremsg.SearchResult, error) {
+	_ = ctx
+	f.last = q
+	return f.results, f.err
+}
+
+func TestMessagesHandler_SearchMessages_ParsesFiltersAndEscapesSnippets(t *testing.T) {
+	svc := &fakeSearchService{results: []coremsg.SearchResult{{
+		Message:   coremsg.StoredMessage{ID: 12, FromUserID: 2, ToUserID: 7, Body: "<b>invoice</b>", ContentKind: "text"},
+		Snippet:   "<b>" + coremsg.SnippetMatchStart + "invoice" + coremsg.SnippetMatchEnd + "</b>",
+		Highlight: "<b>" + coremsg.SnippetMatchStart + "invoice" + coremsg.SnippetMatchEnd + "</b>",
+	}}}
+	h := &MessagesHandler{Search: svc}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/messaging/search?q=invoice&with_user_id=7&content_kind=text&since=2025-01-01&until=2025-01-31&before_id=99&limit=5&sort=recent", nil)
+	req = req.WithContext(auth.WithUserID(req.Context(), 2))
+	rr := httptest.NewRecorder()
+	h.SearchMessages(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 body=%s", rr.Code, rr.Body.String())
+	}
+	want := coremsg.SearchQuery{
+		UserID:      2,
+		Text:        "invoice",
+		WithUserID:  7,
+		ContentKind: "text",
+		Since:       time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until:       time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		BeforeID:    99,
+		Limit:       5,
+		Sort:        coremsg.SearchSortRecent,
+	}
+	if svc.last != want {
+		t.Fatalf("query = %+v, want %+v", svc.last, want)
+	}
+
+	var resp []map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp) != 1 || resp[0]["snippet"] != "&lt;b&gt;<mark>invoice</mark>&lt;/b&gt;" || resp[0]["highlight"] != resp[0]["snippet"] || resp[0]["body"] != "<b>invoice</b>" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestMessagesHandler_SearchMessages_MapsErrors(t *testing.T) {
+	serve := func(h *MessagesHandler, target string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), 2))
+		rr := httptest.NewRecorder()
+		h.SearchMessages(rr, req)
+		return rr.Code
+	}
+
+	if code := serve(&MessagesHandler{}, "/api/messaging/search?q=x"); code != http.StatusServiceUnavailable {
+		t.Fatalf("no service status = %d, want 503", code)
+	}
+	if code := serve(&MessagesHandler{Search: &fakeSearchService{}}, "/api/messaging/search?q=x&since=yesterday"); code != http.StatusBadRequest {
+		t.Fatalf("bad since status = %d, want 400", code)
+	}
+	if code := serve(&MessagesHandler{Search: &fakeSearchService{err: coremsg.ErrInvalidSearchQuery}}, "/api/messaging/search"); code != http.StatusBadRequest {
+		t.Fatalf("invalid query status = %d, want 400", code)
+	}
+	if code := serve(&MessagesHandler{Search: &fakeSearchService{err: errors.New("db down")}}, "/api/messaging/search?q=x"); code != http.StatusInternalServerError {
+		t.Fatalf("repo error status = %d, want 500", code)
+	}
+}
+
+type fakeRetentionService struct {
+	setting      coremsg.ThreadRetention
+	announcement coremsg.StoredMessage
+	err          error
+	lastUserID   int
+	lastPeerID   int
+	lastTTL      time.Duration
+	purged       coremsg.PurgeLogPage
+	lastAfterID  int64
+}
+
+func (f *fakeRetentionService) GetThreadRetention(ctx context.Context, userID, peerUserID int) (coremsg.ThreadRetention, error) {
+	f.lastUserID, f.lastPeerID = userID, peerUserID
+	return f.setting, f.err
+}
+
+func (f *fakeRetentionService) SetThreadRetention(ctx context.Context, userID, peerUserID int, ttl time.Duration) (coremsg.ThreadRetention, coremsg.StoredMessage, error) {
+	f.lastUserID, f.lastPeerID, f.lastTTL = userID, peerUserID, ttl
+	return f.setting, f.announcement, f.err
+}
+
+func (f *fakeRetentionService) ListPurgedAfter(ctx context.Context, userID int, afterID int64, limit int) (coremsg.PurgeLogPage, error) {
+	f.lastAfterID = afterID
+	return f.purged, f.err
+}
+
+func TestMessagesHandler_SetThreadTimer_AnnouncesToBothParticipants(t *testing.T) {
+	svc := &fakeRetentionService{
+		setting:      coremsg.ThreadRetention{UserID: 2, PeerUserID: 7, TTL: time.Hour, UpdatedByUserID: 2, UpdatedAt: time.Now()},
+		announcement: coremsg.StoredMessage{ID: 31, FromUserID: 2, ToUserID: 7, Body: `{"event":"disappearing_timer_changed"}`, ContentKind: coremsg.ContentKindSystem},
+	}
+	transport := &fakeTransport{ok: true}
+	h := &MessagesHandler{Retention: svc, ReceiptTransport: transport}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/messaging/threads/timer", bytes.NewBufferString(`{"user_id":7,"ttl_seconds":3600}`))
+	req = req.WithContext(auth.WithUserID(req.Context(), 2))
+	rr := httptest.NewRecorder()
+	h.SetThreadTimer(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 body=%s", rr.Code, rr.Body.String())
+	}
+	if svc.lastUserID != 2 || svc.lastPeerID != 7 || svc.lastTTL != time.Hour {
+		t.Fatalf("unexpected call user=%d peer=%d ttl=%v", svc.lastUserID, svc.lastPeerID, svc.lastTTL)
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	announcement, _ := resp["announcement"].(map[string]any)
+	if resp["ttl_seconds"] != float64(3600) || announcement["content_kind"] != coremsg.ContentKindSystem {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if transport.lastTo != 2 || transport.lastMsg.Type != coremsg.KindThreadTimer || transport.lastMsg.StoredMessageID != 31 {
+		t.Fatalf("expected timer event relayed, got to=%d msg=%+v", transport.lastTo, transport.lastMsg)
+	}
+}
+
+func TestMessagesHandler_ThreadTimer_MapsErrors(t *testing.T) {
+	serve := func(h *MessagesHandler, method, body string) int {
+		req := httptest.NewRequest(method, "/api/messaging/threads/timer?user_id=7", bytes.NewBufferString(body))
+		req = req.WithContext(auth.WithUserID(req.Context(), 2))
+		rr := httptest.NewRecorder()
+		if method == http.MethodGet {
+			h.GetThreadTimer(rr, req)
+		} else {
+			h.SetThreadTimer(rr, req)
+		}
+		return rr.Code
+	}
+
+	if code := serve(&MessagesHandler{}, http.MethodGet, ""); code != http.StatusServiceUnavailable {
+		t.Fatalf("nil service: status = %d, want 503", code)
+	}
+	h := &MessagesHandler{Retention: &fakeRetentionService{err: coremsg.ErrThreadPeerNotFound}}
+	if code := serve(h, http.MethodGet, ""); code != http.StatusNotFound {
+		t.Fatalf("unknown peer: status = %d, want 404", code)
+	}
+	h = &MessagesHandler{Retention: &fakeRetentionService{err: coremsg.ErrInvalidRetentionTTL}}
+	if code := serve(h, http.MethodPut, `{"user_id":7,"ttl_seconds":5}`); code != http.StatusBadRequest {
+		t.Fatalf("invalid ttl: status = %d, want 400", code)
+	}
+	if code := serve(h, http.MethodPut, `{"user_id":7,"ttl_seconds":-1}`); code != http.StatusBadRequest {
+		t.Fatalf("negative ttl: status = %d, want 400", code)
+	}
+}
+
+func TestMessagesHandler_GetSync_ReportsPurgedMessageIDs(t *testing.T) {
+	expires := time.Now().Add(time.Hour).UTC()
+	persistence := &fakeMessagingPersistence{listResp: []coremsg.StoredMessage{{ID: 9, FromUserID: 7, ToUserID: 2, Body: "hi", ExpiresAt: &expires}}}
+	retention := &fakeRetentionService{purged: coremsg.PurgeLogPage{AfterID: 4, NextAfterID: 6, Purged: []coremsg.PurgedMessage{{ID: 5, MessageID: 3}, {ID: 6, MessageID: 8}}}}
+	h := &MessagesHandler{Messaging: persistence, Retention: retention}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/messaging/sync?purged_after_id=4", nil)
+	req = req.WithContext(auth.WithUserID(req.Context(), 2))
+	rr := httptest.NewRecorder()
+	h.GetSync(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 body=%s", rr.Code, rr.Body.String())
+	}
+	if retention.lastAfterID != 4 {
+		t.Fatalf("purged_after_id = %d, want 4", retention.lastAfterID)
+	}
+	var resp struct {
+		Messages []map[string]any `json:"messages"`
+		Purged   struct {
+			NextAfterID int64   `json:"next_after_id"`
+			MessageIDs  []int64 `json:"message_ids"`
+		} `json:"purged"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Purged.NextAfterID != 6 || len(resp.Purged.MessageIDs) != 2 || resp.Purged.MessageIDs[1] != 8 {
+		t.Fatalf("unexpected purged section: %+v", resp.Purged)
+	}
+	if len(resp.Messages) == 0 || resp.Messages[0]["expires_at"] == nil {
+		t.Fatalf("expected expires_at on synced messages: %+v", resp.Messages)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/messaging/sync?purged_after_id=x", nil)
+	req = req.WithContext(auth.WithUserID(req.Context(), 2))
+	rr = httptest.NewRecorder()
+	h.GetSync(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid cursor: status = %d, want 400", rr.Code)
+	}
+}
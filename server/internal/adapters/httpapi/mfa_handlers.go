@@ -0,0 +1,172 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+type MFAHandler struct {
+	MFA coreid.MFAService
+}
+
+func (h *MFAHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.MFA == nil {
+		web.JSONError(w, errors.New("two-factor authentication unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	status, err := h.MFA.Status(r.Context(), coreid.UserID(userID))
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"totp_enabled":             status.TOTPEnabled,
+		"recovery_codes_remaining": status.RecoveryCodesRemaining,
+	})
+}
+
+// BeginTOTP returns a fresh secret and its otpauth:// provisioning URI. TOTP
+// stays disabled until ConfirmTOTP succeeds.
+func (h *MFAHandler) BeginTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.MFA == nil {
+		web.JSONError(w, errors.New("two-factor authentication unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	enrollment, err := h.MFA.BeginTOTPEnrollment(r.Context(), coreid.UserID(userID))
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"secret":           enrollment.Secret,
+		"provisioning_uri": enrollment.ProvisioningURI,
+	})
+}
+
+func (h *MFAHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.MFA == nil {
+		web.JSONError(w, errors.New("two-factor authentication unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+	code, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.MFA.ConfirmTOTPEnrollment(r.Context(), coreid.UserID(userID), code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("auth_mfa_enabled", map[string]any{
+		"request_id": r.Header.Get("X-Request-ID"),
+		"user_id":    userID,
+		"method":     "totp",
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"totp_enabled":   true,
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// DisableTOTP requires a current TOTP code or an unused recovery code so a
+// stolen access token alone cannot remove the second factor.
+func (h *MFAHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.MFA == nil {
+		web.JSONError(w, errors.New("two-factor authentication unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+	code, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.MFA.DisableTOTP(r.Context(), coreid.UserID(userID), code); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("auth_mfa_disabled", map[string]any{
+		"request_id": r.Header.Get("X-Request-ID"),
+		"user_id":    userID,
+		"method":     "totp",
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeMFACode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return "", false
+	}
+	if req.Code == "" {
+		web.JSONError(w, errors.New("code is required"), http.StatusBadRequest)
+		return "", false
+	}
+	return req.Code, true
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, coreid.ErrInvalidMFACode):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, coreid.ErrMFANotEnrolled):
+		web.JSONError(w, err, http.StatusNotFound)
+	case errors.Is(err, coreid.ErrMFAAlreadyEnabled):
+		web.JSONError(w, err, http.StatusConflict)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
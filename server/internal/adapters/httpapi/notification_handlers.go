@@ -0,0 +1,200 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coredigest "github.com/kyambuthia/go-chat-site/server/internal/core/digest"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+// NotificationsHandler manages the caller's email address and activity
+// digest preferences. Its /api/me routes take session tokens only.
+type NotificationsHandler struct {
+	Digest   coredigest.Service
+	Security *authSecurity
+}
+
+func (h *NotificationsHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Digest == nil {
+		web.JSONError(w, errors.New("email notifications unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	prefs, err := h.Digest.GetPreferences(r.Context(), userID)
+	if err != nil {
+		writeNotificationsError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(notificationPreferencesJSON(prefs))
+}
+
+// UpdatePreferences replaces the caller's preferences. A new email address is
+// sent a verification link and gets no digests until it is confirmed.
+func (h *NotificationsHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Digest == nil {
+		web.JSONError(w, errors.New("email notifications unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Email              string `json:"email"`
+		DigestEnabled      bool   `json:"digest_enabled"`
+		Frequency          string `json:"frequency"`
+		UnreadDelayMinutes int    `json:"unread_delay_minutes"`
+		Include            struct {
+			Messages  bool `json:"messages"`
+			Invites   bool `json:"invites"`
+			Transfers bool `json:"transfers"`
+		} `json:"include"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UnreadDelayMinutes < 0 {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.Digest.GetPreferences(r.Context(), userID)
+	if err != nil {
+		writeNotificationsError(w, err)
+		return
+	}
+	prefs, err := h.Digest.UpdatePreferences(r.Context(), userID, coredigest.UpdateRequest{
+		Email:            req.Email,
+		DigestEnabled:    req.DigestEnabled,
+		Frequency:        coredigest.Frequency(req.Frequency),
+		UnreadDelay:      time.Duration(req.UnreadDelayMinutes) * time.Minute,
+		IncludeMessages:  req.Include.Messages,
+		IncludeInvites:   req.Include.Invites,
+		IncludeTransfers: req.Include.Transfers,
+	})
+	if err != nil {
+		writeNotificationsError(w, err)
+		return
+	}
+	if prefs.Email != before.Email {
+		auth.LogSecurityEvent("notification_email_changed", map[string]any{
+			"request_id": r.Header.Get("X-Request-ID"),
+			"user_id":    userID,
+			"removed":    prefs.Email == "",
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(notificationPreferencesJSON(prefs))
+}
+
+func (h *NotificationsHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Digest == nil {
+		web.JSONError(w, errors.New("email notifications unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := h.Digest.ResendVerification(r.Context(), userID); err != nil {
+		writeNotificationsError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyEmail confirms an address from the emailed link. It takes no session,
+// since the link may open in a browser that is not signed in, and is throttled
+// per client IP like the other token-redeeming routes.
+func (h *NotificationsHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Digest == nil {
+		web.JSONError(w, errors.New("email notifications unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	requestID := r.Header.Get("X-Request-ID")
+	if h.Security != nil {
+		if err := h.Security.allowLogin(r.Context(), "", ip, requestID); err != nil {
+			writeAuthThrottleError(w, err)
+			return
+		}
+	}
+
+	userID, err := h.Digest.VerifyEmail(r.Context(), req.Token)
+	if err != nil {
+		writeNotificationsError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("notification_email_verified", map[string]any{
+		"request_id": requestID,
+		"user_id":    userID,
+		"ip_address": ip,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func notificationPreferencesJSON(p coredigest.Preferences) map[string]any {
+	return map[string]any{
+		"email":                p.Email,
+		"email_verified":       p.EmailVerifiedAt != nil,
+		"email_verified_at":    p.EmailVerifiedAt,
+		"digest_enabled":       p.DigestEnabled,
+		"frequency":            string(p.Frequency),
+		"unread_delay_minutes": int(p.UnreadDelay / time.Minute),
+		"include": map[string]bool{
+			"messages":  p.IncludeMessages,
+			"invites":   p.IncludeInvites,
+			"transfers": p.IncludeTransfers,
+		},
+		"last_sent_at":   p.LastSentAt,
+		"next_digest_at": p.NextDigestAt,
+	}
+}
+
+func writeNotificationsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, coredigest.ErrInvalidPreferences),
+		errors.Is(err, coredigest.ErrInvalidEmail):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, coredigest.ErrInvalidVerifyToken):
+		web.JSONError(w, err, http.StatusUnauthorized)
+	default:
+		web.JSONError(w, errors.New("internal server error"), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,125 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNotificationHandlers_Unavailable(t *testing.T) {
+	router, _ := passwordTestRouter(t)
+	session, _ := loginForTest(t, router, "password123")
+	if rr := authedRequest(t, router, http.MethodGet, "/api/me/notifications", session, nil); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rr.Code)
+	}
+	if rr := postJSON(t, router, "/api/notifications/verify-email", "", map[string]string{"token": "x"}); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("verify status = %d, want 503", rr.Code)
+	}
+}
+
+// droppedVerifyToken expects want mails in dir and reads the token from the
+// newest.
+func droppedVerifyToken(t *testing.T, dir string, want int) string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != want {
+		t.Fatalf("dropped mail = %v, %v, want %d", entries, err, want)
+	}
+	f, err := os.Open(filepath.Join(dir, entries[want-1].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(body), "\r\n") {
+		if u, err := url.Parse(line); err == nil && u.Query().Get("token") != "" {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatalf("no verification link in %q", body)
+	return ""
+}
+
+func TestNotificationHandlers_PreferencesAndVerification(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("MAIL_DROP_DIR", dir)
+	t.Setenv("NOTIFICATIONS_APP_URL", "https://chat.example.com")
+	router, _ := passwordTestRouter(t)
+	session, _ := loginForTest(t, router, "password123")
+
+	rr := authedRequest(t, router, http.MethodGet, "/api/me/notifications", session, nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"frequency":"daily"`) {
+		t.Fatalf("get status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	for _, body := range []map[string]any{
+		{"email": "Alice <alice@example.com>"},
+		{"digest_enabled": true},
+		{"email": "alice@example.com", "frequency": "weekly"},
+		{"email": "alice@example.com", "unread_delay_minutes": 1},
+	} {
+		if rr := authedRequest(t, router, http.MethodPut, "/api/me/notifications", session, body); rr.Code != http.StatusBadRequest {
+			t.Fatalf("PUT %v status = %d, want 400", body, rr.Code)
+		}
+	}
+
+	rr = authedRequest(t, router, http.MethodPut, "/api/me/notifications", session, map[string]any{
+		"email":                "alice@example.com",
+		"digest_enabled":       true,
+		"frequency":            "hourly",
+		"unread_delay_minutes": 15,
+		"include":              map[string]bool{"messages": true, "invites": true},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("put status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var prefs struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Frequency     string `json:"frequency"`
+		Delay         int    `json:"unread_delay_minutes"`
+		Include       struct {
+			Transfers bool `json:"transfers"`
+		} `json:"include"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&prefs); err != nil {
+		t.Fatal(err)
+	}
+	if prefs.Email != "alice@example.com" || prefs.EmailVerified || prefs.Frequency != "hourly" || prefs.Delay != 15 || prefs.Include.Transfers {
+		t.Fatalf("prefs = %+v", prefs)
+	}
+
+	stale := droppedVerifyToken(t, dir, 1)
+	if rr := postJSON(t, router, "/api/me/notifications/resend-verification", session, map[string]any{}); rr.Code != http.StatusNoContent {
+		t.Fatalf("resend status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	token := droppedVerifyToken(t, dir, 2)
+	if rr := postJSON(t, router, "/api/notifications/verify-email", "", map[string]string{"token": stale}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("stale token status = %d, want 401", rr.Code)
+	}
+	if rr := postJSON(t, router, "/api/notifications/verify-email", "", map[string]string{"token": token}); rr.Code != http.StatusNoContent {
+		t.Fatalf("verify status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := postJSON(t, router, "/api/notifications/verify-email", "", map[string]string{"token": token}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("reused token status = %d, want 401", rr.Code)
+	}
+
+	rr = authedRequest(t, router, http.MethodGet, "/api/me/notifications", session, nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"email_verified":true`) {
+		t.Fatalf("get status = %d body=%s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,320 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	"github.com/kyambuthia/go-chat-site/server/internal/config"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+// OIDCHandler runs single sign-on against the configured identity provider.
+// The provider redirects the browser to the web client, which posts the
+// returned state and code here; tokens are never placed in a URL. Sessions
+// are issued by Auth, so a provider sign-in meets the same MFA policy as a
+// password.
+type OIDCHandler struct {
+	OIDC     coreid.OIDCService
+	Auth     coreid.AuthService
+	Security *authSecurity
+}
+
+// oidcStateCookie ties a login state to the browser that started it, so an
+// attacker cannot have a victim's browser finish the attacker's sign-in.
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/login/oidc"
+)
+
+type oidcCallbackRequest struct {
+	State       string `json:"state"`
+	Code        string `json:"code"`
+	DeviceLabel string `json:"device_label"`
+}
+
+func (h *OIDCHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.OIDC == nil {
+		web.JSONError(w, errors.New("single sign-on unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+	if h.Security != nil {
+		if err := h.Security.allowLogin(r.Context(), "", clientIP(r), r.Header.Get("X-Request-ID")); err != nil {
+			writeAuthThrottleError(w, err)
+			return
+		}
+	}
+
+	authz, err := h.OIDC.BeginOIDCLogin(r.Context())
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    authz.State,
+		Path:     oidcStateCookiePath,
+		Expires:  authz.ExpiresAt,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.OIDCRedirectURL(), "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+	writeOIDCAuthorizationJSON(w, authz)
+}
+
+// Login finishes a provider sign-in. Like passkey login there is no username
+// until the provider answers, so only the per-IP limit applies. The state
+// must match the cookie BeginLogin set in this browser.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.OIDC == nil || h.Auth == nil {
+		web.JSONError(w, errors.New("single sign-on unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req oidcCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.State == "" || req.Code == "" {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	requestID := r.Header.Get("X-Request-ID")
+	if h.Security != nil {
+		if err := h.Security.allowLogin(r.Context(), "", ip, requestID); err != nil {
+			writeAuthThrottleError(w, err)
+			return
+		}
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcStateCookiePath, MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.State)) != 1 {
+		auth.LogSecurityEvent("auth_oidc_login_failed", map[string]any{
+			"request_id": requestID,
+			"ip_address": ip,
+			"reason":     "state not bound to this browser",
+		})
+		web.JSONError(w, errors.New("single sign-on failed"), http.StatusUnauthorized)
+		return
+	}
+
+	login, err := h.OIDC.RedeemOIDCLogin(r.Context(), req.State, req.Code)
+	if err != nil {
+		auth.LogSecurityEvent("auth_oidc_login_failed", map[string]any{
+			"request_id": requestID,
+			"ip_address": ip,
+			"reason":     err.Error(),
+		})
+		switch {
+		case errors.Is(err, coreid.ErrExternalIdentityUnknown):
+			web.JSONError(w, err, http.StatusForbidden)
+		case errors.Is(err, coreid.ErrInvalidOIDCState), errors.Is(err, coreid.ErrInvalidExternalIdentity):
+			web.JSONError(w, errors.New("single sign-on failed"), http.StatusUnauthorized)
+		default:
+			web.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+	fields := map[string]any{
+		"request_id": requestID,
+		"user_id":    int(login.Principal.ID),
+		"issuer":     login.Identity.Issuer,
+		"subject":    login.Identity.Subject,
+		"ip_address": ip,
+	}
+	if login.Created {
+		auth.LogSecurityEvent("auth_oidc_account_created", fields)
+	}
+
+	tokens, err := h.Auth.Login(r.Context(), login, sessionMetadataFromRequest(r, req.DeviceLabel))
+	if err != nil {
+		var required *coreid.MFARequiredError
+		if errors.As(err, &required) {
+			auth.LogSecurityEvent("auth_mfa_challenge_issued", fields)
+			writeMFARequiredJSON(w, required)
+			return
+		}
+		web.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	auth.LogSecurityEvent("auth_oidc_login", fields)
+	if h.Security != nil {
+		h.Security.recordLoginSuccess(r.Context(), int(login.Principal.ID), "", ip, requestID)
+	}
+
+	writeSessionTokensJSON(w, tokens)
+}
+
+func (h *OIDCHandler) BeginLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.OIDC == nil {
+		web.JSONError(w, errors.New("single sign-on unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	authz, err := h.OIDC.BeginOIDCLink(r.Context(), coreid.UserID(userID))
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	writeOIDCAuthorizationJSON(w, authz)
+}
+
+func (h *OIDCHandler) FinishLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.OIDC == nil {
+		web.JSONError(w, errors.New("single sign-on unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req oidcCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.State == "" || req.Code == "" {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.OIDC.FinishOIDCLink(r.Context(), coreid.UserID(userID), req.State, req.Code)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("auth_oidc_linked", map[string]any{
+		"request_id": r.Header.Get("X-Request-ID"),
+		"user_id":    userID,
+		"issuer":     link.Issuer,
+		"subject":    link.Subject,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(externalIdentityJSON(link))
+}
+
+func (h *OIDCHandler) ListLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.OIDC == nil {
+		web.JSONError(w, errors.New("single sign-on unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	links, err := h.OIDC.ListExternalIdentities(r.Context(), coreid.UserID(userID))
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	resp := make([]map[string]any, 0, len(links))
+	for _, link := range links {
+		resp = append(resp, externalIdentityJSON(link))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *OIDCHandler) Unlink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.OIDC == nil {
+		web.JSONError(w, errors.New("single sign-on unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Issuer  string `json:"issuer"`
+		Subject string `json:"subject"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.OIDC.UnlinkExternalIdentity(r.Context(), coreid.UserID(userID), req.Issuer, req.Subject); err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("auth_oidc_unlinked", map[string]any{
+		"request_id": r.Header.Get("X-Request-ID"),
+		"user_id":    userID,
+		"issuer":     req.Issuer,
+		"subject":    req.Subject,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeOIDCAuthorizationJSON(w http.ResponseWriter, authz coreid.OIDCAuthorization) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"authorization_url": authz.URL,
+		"state":             authz.State,
+		"expires_at":        authz.ExpiresAt,
+	})
+}
+
+func externalIdentityJSON(link coreid.ExternalIdentityLink) map[string]any {
+	item := map[string]any{
+		"issuer":     link.Issuer,
+		"subject":    link.Subject,
+		"email":      link.Email,
+		"created_at": link.CreatedAt,
+	}
+	if link.LastLoginAt != nil {
+		item["last_login_at"] = *link.LastLoginAt
+	}
+	return item
+}
+
+func writeOIDCError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, coreid.ErrInvalidOIDCState), errors.Is(err, coreid.ErrInvalidExternalIdentity):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, coreid.ErrExternalIdentityMissing):
+		web.JSONError(w, err, http.StatusNotFound)
+	case errors.Is(err, coreid.ErrExternalIdentityLinked), errors.Is(err, coreid.ErrExternalIdentityExists):
+		web.JSONError(w, err, http.StatusConflict)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,243 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/oidc/oidctest"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/totp"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/transport/wsrelay"
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+func oidcTestRouter(t *testing.T, autoCreate string) (http.Handler, *oidctest.Server, *store.SqliteStore) {
+	t.Helper()
+	if err := auth.ConfigureJWT("oidc-handlers-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	idp, err := oidctest.New("chat-app", "chat-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+	t.Setenv("OIDC_ISSUER", idp.URL)
+	t.Setenv("OIDC_CLIENT_ID", "chat-app")
+	t.Setenv("OIDC_CLIENT_SECRET", "chat-secret")
+	t.Setenv("OIDC_AUTO_CREATE", autoCreate)
+	t.Setenv("OIDC_ALLOWED_EMAIL_DOMAINS", "corp.example")
+
+	s := setupRouterStore(t)
+	if _, err := s.CreateUser("alice", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	hub := wsrelay.NewHub()
+	go hub.Run()
+	t.Cleanup(hub.Shutdown)
+	return NewRouter(s, hub), idp, s
+}
+
+// oidcRequest posts body to path with the cookies a browser would send.
+func oidcRequest(t *testing.T, h http.Handler, path, token string, body any, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// oidcBegin starts a flow at beginPath and lets the fake provider approve
+// it, returning the callback body and the cookies set by the begin call.
+func oidcBegin(t *testing.T, h http.Handler, idp *oidctest.Server, beginPath, token string) (map[string]string, []*http.Cookie) {
+	t.Helper()
+	rr := oidcRequest(t, h, beginPath, token, nil, nil)
+	var begin struct {
+		AuthorizationURL string `json:"authorization_url"`
+		State            string `json:"state"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&begin); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("%s status=%d err=%v", beginPath, rr.Code, err)
+	}
+	code, state, err := idp.Authorize(begin.AuthorizationURL)
+	if err != nil || state != begin.State {
+		t.Fatalf("Authorize = %q, %q, %v", code, state, err)
+	}
+	return map[string]string{"state": state, "code": code, "device_label": "sso"}, rr.Result().Cookies()
+}
+
+// oidcRoundTrip starts a flow at beginPath, lets the fake provider approve it
+// and posts the callback to finishPath from the same browser.
+func oidcRoundTrip(t *testing.T, h http.Handler, idp *oidctest.Server, beginPath, finishPath, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, cookies := oidcBegin(t, h, idp, beginPath, token)
+	return oidcRequest(t, h, finishPath, token, body, cookies)
+}
+
+func TestOIDCHandlers_LinkThenSingleSignOn(t *testing.T) {
+	router, idp, _ := oidcTestRouter(t, "false")
+	idp.SetUser(oidctest.User{Subject: "staff-1", Email: "alice@corp.example", EmailVerified: true, PreferredUsername: "alice"})
+
+	rr := oidcRoundTrip(t, router, idp, "/api/login/oidc/begin", "/api/login/oidc", "")
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("unlinked login status = %d, want 403 body=%s", rr.Code, rr.Body.String())
+	}
+
+	session, _ := loginForTest(t, router, "password123")
+	rr = oidcRoundTrip(t, router, idp, "/api/me/oidc/link/begin", "/api/me/oidc/link", session)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("link status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = oidcRoundTrip(t, router, idp, "/api/login/oidc/begin", "/api/login/oidc", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("sso login status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil || tokens.AccessToken == "" {
+		t.Fatalf("sso login body err = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	me := httptest.NewRecorder()
+	router.ServeHTTP(me, req)
+	if me.Code != http.StatusOK || !strings.Contains(me.Body.String(), `"alice"`) {
+		t.Fatalf("GET /api/me status = %d body=%s", me.Code, me.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/me/oidc", nil)
+	req.Header.Set("Authorization", "Bearer "+session)
+	list := httptest.NewRecorder()
+	router.ServeHTTP(list, req)
+	if list.Code != http.StatusOK || !strings.Contains(list.Body.String(), `"staff-1"`) || !strings.Contains(list.Body.String(), "last_login_at") {
+		t.Fatalf("GET /api/me/oidc status = %d body=%s", list.Code, list.Body.String())
+	}
+}
+
+func TestOIDCHandlers_AutoCreateRespectsPolicyAndStateIsSingleUse(t *testing.T) {
+	router, idp, _ := oidcTestRouter(t, "true")
+
+	idp.SetUser(oidctest.User{Subject: "contractor-1", Email: "eve@elsewhere.example", EmailVerified: true, PreferredUsername: "eve"})
+	rr := oidcRoundTrip(t, router, idp, "/api/login/oidc/begin", "/api/login/oidc", "")
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("outside allowed domain status = %d, want 403", rr.Code)
+	}
+
+	idp.SetUser(oidctest.User{Subject: "staff-2", Email: "Alice@corp.example", EmailVerified: true, PreferredUsername: "alice"})
+	body, cookies := oidcBegin(t, router, idp, "/api/login/oidc/begin", "")
+	rr = oidcRequest(t, router, "/api/login/oidc", "", body, cookies)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("auto-create login status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = oidcRequest(t, router, "/api/login/oidc", "", body, cookies)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed state status = %d, want 401", rr.Code)
+	}
+}
+
+func TestOIDCHandlers_LoginRequiresStateCookieFromSameBrowser(t *testing.T) {
+	router, idp, _ := oidcTestRouter(t, "true")
+	idp.SetUser(oidctest.User{Subject: "staff-3", Email: "carol@corp.example", EmailVerified: true, PreferredUsername: "carol"})
+
+	rr := oidcRequest(t, router, "/api/login/oidc/begin", "", nil, nil)
+	var cookie *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == "oidc_state" {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode || cookie.Path != "/api/login/oidc" {
+		t.Fatalf("state cookie = %+v", cookie)
+	}
+
+	// The attacker's own authorization response, replayed without the
+	// attacker's cookie, is refused.
+	body, _ := oidcBegin(t, router, idp, "/api/login/oidc/begin", "")
+	rr = oidcRequest(t, router, "/api/login/oidc", "", body, nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("missing cookie status = %d, want 401", rr.Code)
+	}
+	victim, victimCookies := oidcBegin(t, router, idp, "/api/login/oidc/begin", "")
+	attacker, _ := oidcBegin(t, router, idp, "/api/login/oidc/begin", "")
+	rr = oidcRequest(t, router, "/api/login/oidc", "", attacker, victimCookies)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("mismatched cookie status = %d, want 401", rr.Code)
+	}
+	rr = oidcRequest(t, router, "/api/login/oidc", "", victim, victimCookies)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("matching cookie status = %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestOIDCHandlers_LoginAsksForTOTPUnlessProviderMFAIsTrusted(t *testing.T) {
+	router, idp, s := oidcTestRouter(t, "false")
+	idp.SetUser(oidctest.User{Subject: "staff-1", Email: "alice@corp.example", EmailVerified: true, AMR: []string{"pwd", "mfa"}})
+	session, _ := loginForTest(t, router, "password123")
+	if rr := oidcRoundTrip(t, router, idp, "/api/me/oidc/link/begin", "/api/me/oidc/link", session); rr.Code != http.StatusCreated {
+		t.Fatalf("link status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr := oidcRequest(t, router, "/api/me/mfa/totp", session, nil, nil)
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&enrollment); err != nil || enrollment.Secret == "" {
+		t.Fatalf("begin TOTP status = %d err = %v", rr.Code, err)
+	}
+	code, err := totp.New("test").Code(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := oidcRequest(t, router, "/api/me/mfa/totp/confirm", session, map[string]string{"code": code}, nil); rr.Code != http.StatusOK {
+		t.Fatalf("confirm TOTP status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = oidcRoundTrip(t, router, idp, "/api/login/oidc/begin", "/api/login/oidc", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"mfa_required":true`) || strings.Contains(rr.Body.String(), "access_token") {
+		t.Fatalf("sso login with TOTP enrolled status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	t.Setenv("OIDC_TRUST_PROVIDER_MFA", "true")
+	hub := wsrelay.NewHub()
+	go hub.Run()
+	t.Cleanup(hub.Shutdown)
+	trusting := NewRouter(s, hub)
+	rr = oidcRoundTrip(t, trusting, idp, "/api/login/oidc/begin", "/api/login/oidc", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "access_token") {
+		t.Fatalf("sso login with trusted provider MFA status = %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestOIDCHandlers_UnavailableWithoutIssuer(t *testing.T) {
+	if err := auth.ConfigureJWT("oidc-handlers-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OIDC_ISSUER", "")
+	hub := wsrelay.NewHub()
+	go hub.Run()
+	defer hub.Shutdown()
+	router := NewRouter(setupRouterStore(t), hub)
+
+	rr := passkeyRequest(t, router, "/api/login/oidc/begin", "", nil)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rr.Code)
+	}
+}
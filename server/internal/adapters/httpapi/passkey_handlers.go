@@ -0,0 +1,386 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+// PasskeyHandler manages passkeys. Login goes through Auth, whose
+// authenticators include Passkeys, so it shares the password login's session
+// and MFA policy.
+type PasskeyHandler struct {
+	Passkeys coreid.PasskeyService
+	Auth     coreid.AuthService
+	Security *authSecurity
+}
+
+// publicKeyCredentialJSON is the PublicKeyCredential.toJSON() shape browsers
+// produce; every binary field is unpadded base64url.
+type publicKeyCredentialJSON struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// BeginRegistration returns PublicKeyCredentialCreationOptions for
+// navigator.credentials.create. Credentials must be discoverable and user
+// verifying so they can later be used without a username or password.
+func (h *PasskeyHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Passkeys == nil {
+		web.JSONError(w, errors.New("passkeys unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	opts, err := h.Passkeys.BeginPasskeyRegistration(r.Context(), coreid.UserID(userID))
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	exclude := make([]map[string]any, 0, len(opts.ExcludeCredentialIDs))
+	for _, id := range opts.ExcludeCredentialIDs {
+		exclude = append(exclude, map[string]any{"type": "public-key", "id": id})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"publicKey": map[string]any{
+			"rp": map[string]any{"id": opts.RelyingParty.ID, "name": opts.RelyingParty.Name},
+			"user": map[string]any{
+				"id":          base64.RawURLEncoding.EncodeToString(opts.UserHandle),
+				"name":        opts.Username,
+				"displayName": opts.Username,
+			},
+			"challenge": opts.Challenge,
+			"pubKeyCredParams": []map[string]any{
+				{"type": "public-key", "alg": -7},
+				{"type": "public-key", "alg": -8},
+			},
+			"timeout":     opts.Timeout.Milliseconds(),
+			"attestation": "none",
+			"authenticatorSelection": map[string]any{
+				"residentKey":        "required",
+				"requireResidentKey": true,
+				"userVerification":   "required",
+			},
+			"excludeCredentials": exclude,
+		},
+	})
+}
+
+func (h *PasskeyHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Passkeys == nil {
+		web.JSONError(w, errors.New("passkeys unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Label      string                  `json:"label"`
+		Credential publicKeyCredentialJSON `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+	attestation, err := req.Credential.attestation()
+	if err != nil {
+		web.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	cred, err := h.Passkeys.FinishPasskeyRegistration(r.Context(), coreid.UserID(userID), req.Label, attestation)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("auth_passkey_registered", map[string]any{
+		"request_id":    r.Header.Get("X-Request-ID"),
+		"user_id":       userID,
+		"credential_id": cred.ID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(passkeyJSON(cred))
+}
+
+func (h *PasskeyHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Passkeys == nil {
+		web.JSONError(w, errors.New("passkeys unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	creds, err := h.Passkeys.ListPasskeys(r.Context(), coreid.UserID(userID))
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	resp := make([]map[string]any, 0, len(creds))
+	for _, cred := range creds {
+		resp = append(resp, passkeyJSON(cred))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *PasskeyHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Passkeys == nil {
+		web.JSONError(w, errors.New("passkeys unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		CredentialID string `json:"credential_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Passkeys.DeletePasskey(r.Context(), coreid.UserID(userID), req.CredentialID); err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("auth_passkey_deleted", map[string]any{
+		"request_id":    r.Header.Get("X-Request-ID"),
+		"user_id":       userID,
+		"credential_id": req.CredentialID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BeginLogin returns PublicKeyCredentialRequestOptions with no
+// allowCredentials, so the authenticator offers whichever passkeys it holds
+// for this relying party.
+func (h *PasskeyHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Passkeys == nil {
+		web.JSONError(w, errors.New("passkeys unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+	if h.Security != nil {
+		if err := h.Security.allowLogin(r.Context(), "", clientIP(r), r.Header.Get("X-Request-ID")); err != nil {
+			writeAuthThrottleError(w, err)
+			return
+		}
+	}
+
+	opts, err := h.Passkeys.BeginPasskeyLogin(r.Context())
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"publicKey": map[string]any{
+			"rpId":             opts.RelyingParty.ID,
+			"challenge":        opts.Challenge,
+			"timeout":          opts.Timeout.Milliseconds(),
+			"userVerification": "required",
+		},
+	})
+}
+
+// Login exchanges a passkey assertion for a session. There is no username
+// until the assertion verifies, so only the per-IP limit applies and a
+// passkey login does not clear the password lockout counter.
+func (h *PasskeyHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Passkeys == nil || h.Auth == nil {
+		web.JSONError(w, errors.New("passkeys unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Credential  publicKeyCredentialJSON `json:"credential"`
+		DeviceLabel string                  `json:"device_label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	requestID := r.Header.Get("X-Request-ID")
+	if h.Security != nil {
+		if err := h.Security.allowLogin(r.Context(), "", ip, requestID); err != nil {
+			writeAuthThrottleError(w, err)
+			return
+		}
+	}
+
+	assertion, err := req.Credential.assertion()
+	if err != nil {
+		web.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.Auth.Login(r.Context(), assertion, sessionMetadataFromRequest(r, req.DeviceLabel))
+	if err != nil {
+		auth.LogSecurityEvent("auth_passkey_login_failed", map[string]any{
+			"request_id": requestID,
+			"ip_address": ip,
+			"reason":     err.Error(),
+		})
+		switch {
+		case errors.Is(err, coreid.ErrInvalidPasskeyAssertion),
+			errors.Is(err, coreid.ErrInvalidPasskeyChallenge),
+			errors.Is(err, coreid.ErrPasskeySignCountRollback):
+			web.JSONError(w, errors.New("passkey login failed"), http.StatusUnauthorized)
+		default:
+			web.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+	if h.Security != nil {
+		h.Security.recordLoginSuccess(r.Context(), int(tokens.Session.UserID), "", ip, requestID)
+	}
+
+	writeSessionTokensJSON(w, tokens)
+}
+
+func (c publicKeyCredentialJSON) attestation() (coreid.PasskeyAttestation, error) {
+	var out coreid.PasskeyAttestation
+	var err error
+	if out.CredentialID, err = c.rawID(); err != nil {
+		return out, err
+	}
+	if out.ClientDataJSON, err = decodeCredentialField(c.Response.ClientDataJSON, true); err != nil {
+		return out, err
+	}
+	if out.AttestationObject, err = decodeCredentialField(c.Response.AttestationObject, true); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+func (c publicKeyCredentialJSON) assertion() (coreid.PasskeyAssertion, error) {
+	var out coreid.PasskeyAssertion
+	var err error
+	if out.CredentialID, err = c.rawID(); err != nil {
+		return out, err
+	}
+	if out.ClientDataJSON, err = decodeCredentialField(c.Response.ClientDataJSON, true); err != nil {
+		return out, err
+	}
+	if out.AuthenticatorData, err = decodeCredentialField(c.Response.AuthenticatorData, true); err != nil {
+		return out, err
+	}
+	if out.Signature, err = decodeCredentialField(c.Response.Signature, true); err != nil {
+		return out, err
+	}
+	if out.UserHandle, err = decodeCredentialField(c.Response.UserHandle, false); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+func (c publicKeyCredentialJSON) rawID() ([]byte, error) {
+	if c.Type != "public-key" {
+		return nil, errors.New("credential type must be public-key")
+	}
+	raw := c.RawID
+	if raw == "" {
+		raw = c.ID
+	}
+	return decodeCredentialField(raw, true)
+}
+
+func decodeCredentialField(value string, required bool) ([]byte, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "=")
+	if value == "" {
+		if required {
+			return nil, errors.New("invalid credential")
+		}
+		return nil, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid credential")
+	}
+	return decoded, nil
+}
+
+func passkeyJSON(cred coreid.PasskeyCredential) map[string]any {
+	item := map[string]any{
+		"id":         cred.ID,
+		"label":      cred.Label,
+		"algorithm":  cred.Algorithm,
+		"aaguid":     cred.AAGUID,
+		"created_at": cred.CreatedAt,
+	}
+	if cred.LastUsedAt != nil {
+		item["last_used_at"] = *cred.LastUsedAt
+	}
+	return item
+}
+
+func writePasskeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, coreid.ErrInvalidPasskeyAssertion), errors.Is(err, coreid.ErrInvalidPasskeyChallenge):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, coreid.ErrPasskeyNotFound):
+		web.JSONError(w, err, http.StatusNotFound)
+	case errors.Is(err, coreid.ErrPasskeyExists), errors.Is(err, coreid.ErrPasskeyLimitReached):
+		web.JSONError(w, err, http.StatusConflict)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/webauthn/webauthntest"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/transport/wsrelay"
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+)
+
+func passkeyRequest(t *testing.T, h http.Handler, path, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPasskeyHandlers_RegisterThenPasswordlessLogin(t *testing.T) {
+	if err := auth.ConfigureJWT("passkey-handlers-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WEBAUTHN_RP_ID", "chat.example")
+	t.Setenv("WEBAUTHN_ORIGINS", "https://chat.example")
+	s := setupRouterStore(t)
+	if _, err := s.CreateUser("alice", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	hub := wsrelay.NewHub()
+	go hub.Run()
+	defer hub.Shutdown()
+	router := NewRouter(s, hub)
+
+	rr := passkeyRequest(t, router, "/api/login", "", map[string]string{"username": "alice", "password": "password123"})
+	var session struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&session); err != nil || session.AccessToken == "" {
+		t.Fatalf("password login status=%d err=%v", rr.Code, err)
+	}
+
+	rr = passkeyRequest(t, router, "/api/me/passkeys/register/begin", session.AccessToken, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("register begin status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var creation struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&creation); err != nil {
+		t.Fatal(err)
+	}
+	userHandle, err := base64.RawURLEncoding.DecodeString(creation.PublicKey.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := webauthntest.New("chat.example", "https://chat.example")
+	attestation, err := authenticator.Register(creation.PublicKey.Challenge, userHandle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = passkeyRequest(t, router, "/api/me/passkeys/register", session.AccessToken, map[string]any{
+		"label":      "laptop",
+		"credential": webauthntest.RegistrationJSON(attestation),
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("register status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = passkeyRequest(t, router, "/api/login/passkey/begin", "", nil)
+	var request struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&request); err != nil {
+		t.Fatalf("login begin status=%d err=%v", rr.Code, err)
+	}
+	assertion, err := authenticator.Assert(request.PublicKey.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := map[string]any{"credential": webauthntest.AssertionJSON(assertion), "device_label": "phone"}
+	rr = passkeyRequest(t, router, "/api/login/passkey", "", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("passkey login status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var tokens map[string]any
+	if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil || tokens["access_token"] == "" {
+		t.Fatalf("passkey login body = %v, err = %v", tokens, err)
+	}
+
+	rr = passkeyRequest(t, router, "/api/login/passkey", "", body)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed assertion status = %d, want 401", rr.Code)
+	}
+}
@@ -0,0 +1,199 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+// ChangePassword re-verifies the current password and revokes every other
+// session. Wrong current passwords count toward the login lockout so a stolen
+// access token cannot be used to guess the password.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Credentials == nil {
+		web.JSONError(w, errors.New("password management unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		web.JSONError(w, errors.New("current_password and new_password are required"), http.StatusBadRequest)
+		return
+	}
+
+	principal, err := h.Credentials.ResolvePrincipal(r.Context(), coreid.UserID(userID))
+	if err != nil {
+		web.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	ip := clientIP(r)
+	requestID := r.Header.Get("X-Request-ID")
+	if h.Security != nil {
+		if err := h.Security.allowLogin(r.Context(), principal.Username, ip, requestID); err != nil {
+			writeAuthThrottleError(w, err)
+			return
+		}
+	}
+
+	sessionID, _ := auth.SessionIDFromContext(r.Context())
+	change, err := h.Credentials.ChangePassword(r.Context(), coreid.UserID(userID), sessionID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, coreid.ErrInvalidCredentials) {
+			if h.Security != nil {
+				h.Security.recordLoginFailure(r.Context(), principal.Username, ip, requestID)
+			}
+			web.JSONError(w, errors.New("current password is incorrect"), http.StatusUnauthorized)
+			return
+		}
+		writePasswordError(w, err)
+		return
+	}
+	h.disconnectSessions(change.RevokedSessionIDs)
+	auth.LogSecurityEvent("auth_password_changed", map[string]any{
+		"request_id":       requestID,
+		"user_id":          userID,
+		"ip_address":       ip,
+		"revoked_sessions": len(change.RevokedSessionIDs),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"revoked_sessions": len(change.RevokedSessionIDs),
+	})
+}
+
+// RequestPasswordReset always answers 202 so callers cannot tell whether the
+// username exists.
+func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Credentials == nil {
+		web.JSONError(w, errors.New("password management unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+	username := strings.TrimSpace(req.Username)
+	if username == "" {
+		web.JSONError(w, errors.New("username is required"), http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	requestID := r.Header.Get("X-Request-ID")
+	if h.Security != nil {
+		if err := h.Security.allowLogin(r.Context(), "", ip, requestID); err != nil {
+			writeAuthThrottleError(w, err)
+			return
+		}
+	}
+
+	if err := h.Credentials.RequestPasswordReset(r.Context(), username); err != nil {
+		web.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	auth.LogSecurityEvent("auth_password_reset_requested", map[string]any{
+		"request_id": requestID,
+		"username":   normalizeThrottleUsername(username),
+		"ip_address": ip,
+	})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password from a reset token and revokes every
+// session; it does not sign the caller in.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Credentials == nil {
+		web.JSONError(w, errors.New("password management unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Token) == "" || req.NewPassword == "" {
+		web.JSONError(w, errors.New("token and new_password are required"), http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	requestID := r.Header.Get("X-Request-ID")
+	if h.Security != nil {
+		if err := h.Security.allowLogin(r.Context(), "", ip, requestID); err != nil {
+			writeAuthThrottleError(w, err)
+			return
+		}
+	}
+
+	change, err := h.Credentials.ResetPassword(r.Context(), req.Token, req.NewPassword)
+	if err != nil {
+		writePasswordError(w, err)
+		return
+	}
+	h.disconnectSessions(change.RevokedSessionIDs)
+	auth.LogSecurityEvent("auth_password_reset", map[string]any{
+		"request_id":       requestID,
+		"user_id":          int(change.Principal.ID),
+		"ip_address":       ip,
+		"revoked_sessions": len(change.RevokedSessionIDs),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) disconnectSessions(sessionIDs []int64) {
+	if h.SessionHub == nil {
+		return
+	}
+	for _, id := range sessionIDs {
+		h.SessionHub.DisconnectSession(id)
+	}
+}
+
+func writePasswordError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, coreid.ErrWeakPassword):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, coreid.ErrInvalidResetToken):
+		web.JSONError(w, err, http.StatusUnauthorized)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,151 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/transport/wsrelay"
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+)
+
+func passwordTestRouter(t *testing.T) (http.Handler, string) {
+	t.Helper()
+	if err := auth.ConfigureJWT("password-handlers-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(t.TempDir(), "resets.log")
+	t.Setenv("PASSWORD_RESET_LOG_PATH", logPath)
+	s := setupRouterStore(t)
+	if _, err := s.CreateUser("alice", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	hub := wsrelay.NewHub()
+	go hub.Run()
+	t.Cleanup(hub.Shutdown)
+	return NewRouter(s, hub), logPath
+}
+
+func postJSON(t *testing.T, h http.Handler, path, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func loginForTest(t *testing.T, h http.Handler, password string) (string, string) {
+	t.Helper()
+	rr := postJSON(t, h, "/api/login", "", map[string]string{"username": "alice", "password": password})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.AccessToken, resp.RefreshToken
+}
+
+func TestPasswordHandlers_ChangeRevokesOtherSessions(t *testing.T) {
+	router, _ := passwordTestRouter(t)
+	current, _ := loginForTest(t, router, "password123")
+	other, otherRefresh := loginForTest(t, router, "password123")
+
+	rr := postJSON(t, router, "/api/me/password", current, map[string]string{"current_password": "wrong-guess-1", "new_password": "new-secret-1"})
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong current password status = %d", rr.Code)
+	}
+	rr = postJSON(t, router, "/api/me/password", current, map[string]string{"current_password": "password123", "new_password": "short"})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("weak password status = %d", rr.Code)
+	}
+	rr = postJSON(t, router, "/api/me/password", current, map[string]string{"current_password": "password123", "new_password": "new-secret-1"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("change status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]int
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp["revoked_sessions"] != 1 {
+		t.Fatalf("change body = %v, err = %v", resp, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+current)
+	got := httptest.NewRecorder()
+	router.ServeHTTP(got, req)
+	if got.Code != http.StatusOK {
+		t.Fatalf("current session status = %d", got.Code)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+other)
+	got = httptest.NewRecorder()
+	router.ServeHTTP(got, req)
+	if got.Code != http.StatusUnauthorized {
+		t.Fatalf("other session status = %d, want 401", got.Code)
+	}
+	if rr := postJSON(t, router, "/api/auth/refresh", "", map[string]string{"refresh_token": otherRefresh}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("other refresh status = %d, want 401", rr.Code)
+	}
+	loginForTest(t, router, "new-secret-1")
+}
+
+func TestPasswordHandlers_ResetFlow(t *testing.T) {
+	router, logPath := passwordTestRouter(t)
+	session, _ := loginForTest(t, router, "password123")
+
+	if rr := postJSON(t, router, "/api/auth/password/reset-request", "", map[string]string{"username": "nobody"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("unknown user status = %d", rr.Code)
+	}
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Fatalf("expected no notification for unknown user, stat err = %v", err)
+	}
+	if rr := postJSON(t, router, "/api/auth/password/reset-request", "", map[string]string{"username": "alice"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("reset request status = %d", rr.Code)
+	}
+	raw, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notice struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(raw), &notice); err != nil || notice.Token == "" {
+		t.Fatalf("notification %q: %v", raw, err)
+	}
+
+	if rr := postJSON(t, router, "/api/auth/password/reset", "", map[string]string{"token": "bogus", "new_password": "new-secret-1"}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("bogus token status = %d", rr.Code)
+	}
+	if rr := postJSON(t, router, "/api/auth/password/reset", "", map[string]string{"token": notice.Token, "new_password": "new-secret-1"}); rr.Code != http.StatusNoContent {
+		t.Fatalf("reset status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := postJSON(t, router, "/api/auth/password/reset", "", map[string]string{"token": notice.Token, "new_password": "other-secret-2"}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("reused token status = %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+session)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("pre-reset session status = %d, want 401", rr.Code)
+	}
+	if rr := postJSON(t, router, "/api/login", "", map[string]string{"username": "alice", "password": "password123"}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("old password login status = %d", rr.Code)
+	}
+	loginForTest(t, router, "new-secret-1")
+}
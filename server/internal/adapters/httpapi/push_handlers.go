@@ -0,0 +1,335 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	corepush "github.com/kyambuthia/go-chat-site/server/internal/core/push"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+// PushHandler manages the caller's Web Push subscriptions, do-not-disturb
+// settings and muted conversations. Its routes take session tokens only.
+type PushHandler struct {
+	Push corepush.Service
+}
+
+// GetPush returns everything a client needs to render push preferences,
+// including the VAPID key to pass to pushManager.subscribe.
+func (h *PushHandler) GetPush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Push == nil {
+		web.JSONError(w, errors.New("push notifications unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	subs, err := h.Push.ListSubscriptions(r.Context(), userID)
+	if err != nil {
+		writePushError(w, err)
+		return
+	}
+	settings, err := h.Push.GetSettings(r.Context(), userID)
+	if err != nil {
+		writePushError(w, err)
+		return
+	}
+	mutes, err := h.Push.ListMutes(r.Context(), userID)
+	if err != nil {
+		writePushError(w, err)
+		return
+	}
+
+	sessionID, _ := auth.SessionIDFromContext(r.Context())
+	subsJSON := make([]map[string]any, 0, len(subs))
+	for _, sub := range subs {
+		subsJSON = append(subsJSON, pushSubscriptionJSON(sub, sessionID))
+	}
+	mutesJSON := make([]map[string]any, 0, len(mutes))
+	for _, mute := range mutes {
+		mutesJSON = append(mutesJSON, pushMuteJSON(mute))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"vapid_public_key": h.Push.PublicKey(),
+		"settings":         pushSettingsJSON(settings),
+		"subscriptions":    subsJSON,
+		"mutes":            mutesJSON,
+	})
+}
+
+// Subscribe registers the browser's PushSubscription for the calling session.
+// Signing out of that session removes it.
+func (h *PushHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Push == nil {
+		web.JSONError(w, errors.New("push notifications unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Endpoint string `json:"endpoint"`
+		Keys     struct {
+			P256DH string `json:"p256dh"`
+			Auth   string `json:"auth"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	sessionID, _ := auth.SessionIDFromContext(r.Context())
+	sub, err := h.Push.Subscribe(r.Context(), userID, sessionID, corepush.SubscribeRequest{
+		Endpoint: req.Endpoint,
+		P256DH:   req.Keys.P256DH,
+		Auth:     req.Keys.Auth,
+	})
+	if err != nil {
+		writePushError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("push_subscription_created", map[string]any{
+		"request_id":      r.Header.Get("X-Request-ID"),
+		"user_id":         userID,
+		"session_id":      sessionID,
+		"subscription_id": sub.ID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(pushSubscriptionJSON(sub, sessionID))
+}
+
+func (h *PushHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Push == nil {
+		web.JSONError(w, errors.New("push notifications unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Push.Unsubscribe(r.Context(), userID, req.ID); err != nil {
+		writePushError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("push_subscription_deleted", map[string]any{
+		"request_id":      r.Header.Get("X-Request-ID"),
+		"user_id":         userID,
+		"subscription_id": req.ID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateSettings replaces do-not-disturb and quiet hours. Omitting a field,
+// or sending null, turns it off.
+func (h *PushHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Push == nil {
+		web.JSONError(w, errors.New("push notifications unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		DNDUntil   *time.Time `json:"dnd_until"`
+		QuietHours *struct {
+			Start            string `json:"start"`
+			End              string `json:"end"`
+			UTCOffsetMinutes int    `json:"utc_offset_minutes"`
+		} `json:"quiet_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	settings := corepush.Settings{UserID: userID, DNDUntil: req.DNDUntil}
+	if q := req.QuietHours; q != nil {
+		start, startErr := parseClockMinute(q.Start)
+		end, endErr := parseClockMinute(q.End)
+		if startErr != nil || endErr != nil {
+			web.JSONError(w, errors.New("quiet hours must be HH:MM"), http.StatusBadRequest)
+			return
+		}
+		settings.QuietHours = &corepush.QuietHours{StartMinute: start, EndMinute: end, UTCOffsetMinutes: q.UTCOffsetMinutes}
+	}
+
+	updated, err := h.Push.UpdateSettings(r.Context(), settings)
+	if err != nil {
+		writePushError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pushSettingsJSON(updated))
+}
+
+// Mute silences pushes from one user. duration_minutes of zero or omitted
+// mutes until unmuted.
+func (h *PushHandler) Mute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Push == nil {
+		web.JSONError(w, errors.New("push notifications unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		UserID          int `json:"user_id"`
+		DurationMinutes int `json:"duration_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	mute, err := h.Push.Mute(r.Context(), userID, req.UserID, time.Duration(req.DurationMinutes)*time.Minute)
+	if err != nil {
+		writePushError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pushMuteJSON(mute))
+}
+
+func (h *PushHandler) Unmute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Push == nil {
+		web.JSONError(w, errors.New("push notifications unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Push.Unmute(r.Context(), userID, req.UserID); err != nil {
+		writePushError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func pushSubscriptionJSON(sub corepush.Subscription, currentSessionID int64) map[string]any {
+	return map[string]any{
+		"id":              sub.ID,
+		"endpoint":        sub.Endpoint,
+		"created_at":      sub.CreatedAt,
+		"current_session": sub.SessionID == currentSessionID,
+	}
+}
+
+func pushSettingsJSON(settings corepush.Settings) map[string]any {
+	out := map[string]any{"dnd_until": nil, "quiet_hours": nil}
+	if settings.DNDUntil != nil {
+		out["dnd_until"] = *settings.DNDUntil
+	}
+	if q := settings.QuietHours; q != nil {
+		out["quiet_hours"] = map[string]any{
+			"start":              formatClockMinute(q.StartMinute),
+			"end":                formatClockMinute(q.EndMinute),
+			"utc_offset_minutes": q.UTCOffsetMinutes,
+		}
+	}
+	return out
+}
+
+func pushMuteJSON(mute corepush.Mute) map[string]any {
+	item := map[string]any{
+		"user_id":    mute.PeerUserID,
+		"created_at": mute.CreatedAt,
+		"until":      nil,
+	}
+	if mute.Until != nil {
+		item["until"] = *mute.Until
+	}
+	return item
+}
+
+func parseClockMinute(raw string) (int, error) {
+	t, err := time.Parse("15:04", raw)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatClockMinute(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+func writePushError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, corepush.ErrInvalidSubscription), errors.Is(err, corepush.ErrInvalidSettings),
+		errors.Is(err, corepush.ErrInvalidMute):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, corepush.ErrSessionRequired):
+		web.JSONError(w, err, http.StatusForbidden)
+	case errors.Is(err, corepush.ErrSubscriptionNotFound), errors.Is(err, corepush.ErrMuteNotFound):
+		web.JSONError(w, err, http.StatusNotFound)
+	case errors.Is(err, corepush.ErrSubscriptionLimit):
+		web.JSONError(w, err, http.StatusConflict)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
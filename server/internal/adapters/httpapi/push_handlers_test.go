@@ -0,0 +1,127 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webpush"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webpush/webpushtest"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/transport/wsrelay"
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+)
+
+func TestPushHandlers_Unavailable(t *testing.T) {
+	router, _ := passwordTestRouter(t)
+	session, _ := loginForTest(t, router, "password123")
+	if rr := authedRequest(t, router, http.MethodGet, "/api/me/push", session, nil); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rr.Code)
+	}
+}
+
+func TestPushHandlers_SubscriptionsSettingsAndMutes(t *testing.T) {
+	key, err := webpush.GenerateVAPIDKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WEBPUSH_VAPID_PRIVATE_KEY", key)
+	t.Setenv("WEBPUSH_VAPID_SUBJECT", "mailto:ops@example.com")
+	t.Setenv("WEBPUSH_ALLOW_PRIVATE_TARGETS", "true")
+	service := webpushtest.New()
+	defer service.Close()
+	browser, err := service.NewSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := auth.ConfigureJWT("push-handlers-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	s := setupRouterStore(t)
+	if _, err := s.CreateUser("alice", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	bobID, err := s.CreateUser("bob", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := wsrelay.NewHub()
+	go hub.Run()
+	t.Cleanup(hub.Shutdown)
+	router := NewRouter(s, hub)
+	session, _ := loginForTest(t, router, "password123")
+	other, _ := loginForTest(t, router, "password123")
+
+	rr := postJSON(t, router, "/api/me/push/subscriptions", session, map[string]any{
+		"endpoint": browser.Endpoint,
+		"keys":     map[string]string{"p256dh": browser.P256DH, "auth": "short"},
+	})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad keys status = %d, want 400", rr.Code)
+	}
+	rr = postJSON(t, router, "/api/me/push/subscriptions", session, map[string]any{
+		"endpoint": browser.Endpoint,
+		"keys":     map[string]string{"p256dh": browser.P256DH, "auth": browser.Auth},
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("subscribe status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var sub struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&sub); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = authedRequest(t, router, http.MethodPut, "/api/me/push/settings", session, map[string]any{
+		"quiet_hours": map[string]any{"start": "22:00", "end": "25:00"},
+	})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad quiet hours status = %d, want 400", rr.Code)
+	}
+	rr = authedRequest(t, router, http.MethodPut, "/api/me/push/settings", session, map[string]any{
+		"quiet_hours": map[string]any{"start": "22:30", "end": "07:00", "utc_offset_minutes": 180},
+	})
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"start":"22:30"`) {
+		t.Fatalf("settings status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := postJSON(t, router, "/api/me/push/mutes", session, map[string]any{"user_id": bobID, "duration_minutes": 60}); rr.Code != http.StatusOK {
+		t.Fatalf("mute status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := postJSON(t, router, "/api/me/push/mutes", session, map[string]any{"user_id": 9999}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("mute unknown user status = %d, want 400", rr.Code)
+	}
+
+	rr = authedRequest(t, router, http.MethodGet, "/api/me/push", other, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("get status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var overview struct {
+		VAPIDPublicKey string `json:"vapid_public_key"`
+		Subscriptions  []struct {
+			ID             int64 `json:"id"`
+			CurrentSession bool  `json:"current_session"`
+		} `json:"subscriptions"`
+		Mutes []struct {
+			UserID int `json:"user_id"`
+		} `json:"mutes"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&overview); err != nil {
+		t.Fatal(err)
+	}
+	if overview.VAPIDPublicKey == "" || len(overview.Subscriptions) != 1 || overview.Subscriptions[0].CurrentSession ||
+		len(overview.Mutes) != 1 || overview.Mutes[0].UserID != bobID {
+		t.Fatalf("overview = %+v", overview)
+	}
+
+	if rr := authedRequest(t, router, http.MethodDelete, "/api/me/push/mutes", session, map[string]int{"user_id": bobID}); rr.Code != http.StatusNoContent {
+		t.Fatalf("unmute status = %d", rr.Code)
+	}
+	if rr := authedRequest(t, router, http.MethodDelete, "/api/me/push/subscriptions", session, map[string]int64{"id": sub.ID}); rr.Code != http.StatusNoContent {
+		t.Fatalf("unsubscribe status = %d", rr.Code)
+	}
+	if rr := authedRequest(t, router, http.MethodDelete, "/api/me/push/subscriptions", session, map[string]int64{"id": sub.ID}); rr.Code != http.StatusNotFound {
+		t.Fatalf("second unsubscribe status = %d, want 404", rr.Code)
+	}
+}
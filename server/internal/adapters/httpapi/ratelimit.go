@@ -9,8 +9,9 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
 )
 
 type requestRateLimiter interface {
@@ -22,8 +23,10 @@ type rateLimitDecision struct {
 	RetryAfter time.Duration
 }
 
+// Limits are read through a function on every call so a configuration
+// reload applies without rebuilding the limiter.
 type fixedWindowRateLimiter struct {
-	limit  int
+	limit  func() int
 	window time.Duration
 
 	mu    sync.Mutex
@@ -31,7 +34,7 @@ type fixedWindowRateLimiter struct {
 	until time.Time
 }
 
-func newFixedWindowRateLimiter(limit int, window time.Duration) *fixedWindowRateLimiter {
+func newFixedWindowRateLimiter(limit func() int, window time.Duration) *fixedWindowRateLimiter {
 	return &fixedWindowRateLimiter{
 		limit:  limit,
 		window: window,
@@ -41,7 +44,8 @@ func newFixedWindowRateLimiter(limit int, window time.Duration) *fixedWindowRate
 }
 
 func (l *fixedWindowRateLimiter) allow(key string) rateLimitDecision {
-	if l.limit <= 0 {
+	limit := l.limit()
+	if limit <= 0 {
 		return rateLimitDecision{Allowed: true}
 	}
 	now := time.Now()
@@ -55,7 +59,7 @@ func (l *fixedWindowRateLimiter) allow(key string) rateLimitDecision {
 	}
 
 	l.hits[key]++
-	if l.hits[key] <= l.limit {
+	if l.hits[key] <= limit {
 		return rateLimitDecision{Allowed: true}
 	}
 	retryAfter := time.Until(l.until)
@@ -66,18 +70,18 @@ func (l *fixedWindowRateLimiter) allow(key string) rateLimitDecision {
 }
 
 type sharedWindowRateLimiter struct {
-	db     *sql.DB
-	limit  int
-	window time.Duration
-
-	calls atomic.Uint64
+	db      *sql.DB
+	dialect dialect.Dialect
+	limit   func() int
+	window  time.Duration
 }
 
-func newSharedWindowRateLimiter(db *sql.DB, limit int, window time.Duration) (*sharedWindowRateLimiter, error) {
+func newSharedWindowRateLimiter(db *sql.DB, d dialect.Dialect, limit func() int, window time.Duration) (*sharedWindowRateLimiter, error) {
 	l := &sharedWindowRateLimiter{
-		db:     db,
-		limit:  limit,
-		window: window,
+		db:      db,
+		dialect: d,
+		limit:   limit,
+		window:  window,
 	}
 	if err := l.init(context.Background()); err != nil {
 		return nil, err
@@ -89,9 +93,9 @@ func (l *sharedWindowRateLimiter) init(ctx context.Context) error {
 	_, err := l.db.ExecContext(ctx, `
 		CREATE TABLE IF NOT EXISTS rate_limit_windows (
 			rate_key TEXT NOT NULL,
-			window_start_unix INTEGER NOT NULL,
+			window_start_unix BIGINT NOT NULL,
 			hits INTEGER NOT NULL DEFAULT 0,
-			updated_at_unix INTEGER NOT NULL,
+			updated_at_unix BIGINT NOT NULL,
 			PRIMARY KEY(rate_key, window_start_unix)
 		)
 	`)
@@ -99,7 +103,8 @@ func (l *sharedWindowRateLimiter) init(ctx context.Context) error {
 }
 
 func (l *sharedWindowRateLimiter) allow(key string) rateLimitDecision {
-	if l.limit <= 0 {
+	limit := l.limit()
+	if limit <= 0 {
 		return rateLimitDecision{Allowed: true}
 	}
 	now := time.Now().Unix()
@@ -116,7 +121,7 @@ func (l *sharedWindowRateLimiter) allow(key string) rateLimitDecision {
 	defer tx.Rollback()
 
 	if _, err := tx.Exec(
-		`INSERT OR IGNORE INTO rate_limit_windows (rate_key, window_start_unix, hits, updated_at_unix) VALUES (?, ?, 0, ?)`,
+		l.dialect.Rebind(`INSERT INTO rate_limit_windows (rate_key, window_start_unix, hits, updated_at_unix) VALUES (?, ?, 0, ?) ON CONFLICT DO NOTHING`),
 		key,
 		windowStart,
 		now,
@@ -125,7 +130,7 @@ func (l *sharedWindowRateLimiter) allow(key string) rateLimitDecision {
 	}
 
 	if _, err := tx.Exec(
-		`UPDATE rate_limit_windows SET hits = hits + 1, updated_at_unix = ? WHERE rate_key = ? AND window_start_unix = ?`,
+		l.dialect.Rebind(`UPDATE rate_limit_windows SET hits = hits + 1, updated_at_unix = ? WHERE rate_key = ? AND window_start_unix = ?`),
 		now,
 		key,
 		windowStart,
@@ -135,7 +140,7 @@ func (l *sharedWindowRateLimiter) allow(key string) rateLimitDecision {
 
 	var hits int
 	if err := tx.QueryRow(
-		`SELECT hits FROM rate_limit_windows WHERE rate_key = ? AND window_start_unix = ?`,
+		l.dialect.Rebind(`SELECT hits FROM rate_limit_windows WHERE rate_key = ? AND window_start_unix = ?`),
 		key,
 		windowStart,
 	).Scan(&hits); err != nil {
@@ -146,12 +151,7 @@ func (l *sharedWindowRateLimiter) allow(key string) rateLimitDecision {
 		return rateLimitDecision{Allowed: true}
 	}
 
-	// Probabilistic cleanup to bound growth while keeping hot path cheap.
-	if l.calls.Add(1)%256 == 0 {
-		cutoff := windowStart - (windowSeconds * 2)
-		_, _ = l.db.Exec(`DELETE FROM rate_limit_windows WHERE window_start_unix < ?`, cutoff)
-	}
-	if hits <= l.limit {
+	if hits <= limit {
 		return rateLimitDecision{Allowed: true}
 	}
 	retryAfter := time.Until(time.Unix(windowStart+windowSeconds, 0))
@@ -8,11 +8,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+func staticLimit(n int) func() int {
+	return func() int { return n }
+}
+
 func TestFixedWindowRateLimiter_AllowAndWindowReset(t *testing.T) {
-	limiter := newFixedWindowRateLimiter(2, 15*time.Millisecond)
+	limiter := newFixedWindowRateLimiter(staticLimit(2), 15*time.Millisecond)
 
 	if !limiter.allow("1.2.3.4").Allowed {
 		t.Fatal("first request should pass")
@@ -35,8 +40,24 @@ func TestFixedWindowRateLimiter_AllowAndWindowReset(t *testing.T) {
 	}
 }
 
+func TestFixedWindowRateLimiter_FollowsLimitChanges(t *testing.T) {
+	limit := 1
+	limiter := newFixedWindowRateLimiter(func() int { return limit }, time.Minute)
+
+	if !limiter.allow("1.2.3.4").Allowed {
+		t.Fatal("first request should pass")
+	}
+	if limiter.allow("1.2.3.4").Allowed {
+		t.Fatal("second request should be rate limited")
+	}
+	limit = 3
+	if !limiter.allow("1.2.3.4").Allowed {
+		t.Fatal("raised limit should apply within the current window")
+	}
+}
+
 func TestRateLimitMiddleware_ReturnsJSON429(t *testing.T) {
-	limiter := newFixedWindowRateLimiter(1, time.Minute)
+	limiter := newFixedWindowRateLimiter(staticLimit(1), time.Minute)
 	called := 0
 	h := rateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		called++
@@ -119,11 +140,11 @@ func TestSharedWindowRateLimiter_SharedAcrossInstances(t *testing.T) {
 	}
 	defer db.Close()
 
-	l1, err := newSharedWindowRateLimiter(db, 2, time.Minute)
+	l1, err := newSharedWindowRateLimiter(db, dialect.SQLite, staticLimit(2), time.Minute)
 	if err != nil {
 		t.Fatalf("new shared limiter l1: %v", err)
 	}
-	l2, err := newSharedWindowRateLimiter(db, 2, time.Minute)
+	l2, err := newSharedWindowRateLimiter(db, dialect.SQLite, staticLimit(2), time.Minute)
 	if err != nil {
 		t.Fatalf("new shared limiter l2: %v", err)
 	}
@@ -146,7 +167,7 @@ func TestSharedWindowRateLimiter_ResetsAfterWindow(t *testing.T) {
 	}
 	defer db.Close()
 
-	limiter, err := newSharedWindowRateLimiter(db, 1, time.Second)
+	limiter, err := newSharedWindowRateLimiter(db, dialect.SQLite, staticLimit(1), time.Second)
 	if err != nil {
 		t.Fatalf("new shared limiter: %v", err)
 	}
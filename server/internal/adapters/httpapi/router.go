@@ -11,47 +11,86 @@ import (
 	"github.com/kyambuthia/go-chat-site/server/internal/app"
 	"github.com/kyambuthia/go-chat-site/server/internal/auth"
 	"github.com/kyambuthia/go-chat-site/server/internal/config"
-	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
 	"github.com/kyambuthia/go-chat-site/server/internal/store"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
 	"github.com/kyambuthia/go-chat-site/server/internal/web"
 )
 
 // NewRouter builds the mux-based HTTP+WS adapter while preserving current route paths.
+// Its wiring is never started, so background loops do not run; the server
+// uses NewRouterWithWiring.
 func NewRouter(dataStore store.APIStore, hub *wsrelay.Hub) http.Handler {
+	return NewRouterWithWiring(dataStore, hub, app.NewWiring(dataStore))
+}
+
+// NewRouterWithWiring routes to wiring's services. The caller owns the
+// wiring's lifecycle.
+func NewRouterWithWiring(dataStore store.APIStore, hub *wsrelay.Hub, wiring *app.Wiring) http.Handler {
 	mux := http.NewServeMux()
-	wsLimiterImpl := requestRateLimiter(newFixedWindowRateLimiter(config.WSHandshakeRateLimitPerMinute(), time.Minute))
+	wsLimiterImpl := requestRateLimiter(newFixedWindowRateLimiter(config.WSHandshakeRateLimitPerMinute, time.Minute))
+	searchLimiter := requestRateLimiter(newFixedWindowRateLimiter(config.UserSearchRateLimitPerMinute, time.Minute))
 	var authSecurity *authSecurity
 	if dbProvider, ok := dataStore.(interface{ SQLDB() *sql.DB }); ok && dbProvider.SQLDB() != nil {
-		wsShared, err := newSharedWindowRateLimiter(dbProvider.SQLDB(), config.WSHandshakeRateLimitPerMinute(), time.Minute)
+		d := dialect.Of(dataStore)
+		wsShared, err := newSharedWindowRateLimiter(dbProvider.SQLDB(), d, config.WSHandshakeRateLimitPerMinute, time.Minute)
 		if err != nil {
 			log.Printf("warn: shared websocket rate limiter disabled: %v", err)
 		} else {
 			wsLimiterImpl = wsShared
 		}
-		authSecurity, err = newAuthSecurity(dbProvider.SQLDB())
+		if searchShared, err := newSharedWindowRateLimiter(dbProvider.SQLDB(), d, config.UserSearchRateLimitPerMinute, time.Minute); err != nil {
+			log.Printf("warn: shared user search rate limiter disabled: %v", err)
+		} else {
+			searchLimiter = searchShared
+		}
+		authSecurity, err = newAuthSecurity(dbProvider.SQLDB(), d)
 		if err != nil {
 			log.Printf("warn: auth security controls disabled: %v", err)
 		}
 	}
 	wsHandshakeLimiter := rateLimitMiddleware(wsLimiterImpl)
-	wiring := app.NewWiring(dataStore)
-	hub.SetDeliveryService(coremsg.NewDurableRelayServiceWithCorrelation(hub, wiring.MessagingPersistence, wiring.MessagingCorrelation))
+	hub.SetDeliveryService(wiring.MessageDelivery(hub))
+	// authMiddleware admits session tokens only; the scoped variants also
+	// admit API tokens holding that scope.
 	authMiddleware := auth.Middleware(wiring.Tokens)
+	messagesRead := auth.Middleware(wiring.Tokens, coreid.ScopeMessagesRead)
+	messagesSend := auth.Middleware(wiring.Tokens, coreid.ScopeMessagesSend)
+	walletRead := auth.Middleware(wiring.Tokens, coreid.ScopeWalletRead)
 
-	authHandler := &AuthHandler{Identity: wiring.Auth, Sessions: wiring.Sessions, Security: authSecurity, SessionHub: hub}
+	authHandler := &AuthHandler{Identity: wiring.Auth, Sessions: wiring.Sessions, Credentials: wiring.Credentials, Security: authSecurity, SessionHub: hub}
 	contactsHandler := &ContactsHandler{Contacts: wiring.Contacts}
 	inviteHandler := &InviteHandler{Contacts: wiring.Contacts}
+	inviteLinkHandler := &InviteLinkHandler{Links: wiring.InviteLinks}
+	directoryHandler := &DirectoryHandler{Directory: wiring.Directory, Limiter: searchLimiter}
 	walletHandler := &WalletHandler{Ledger: wiring.Ledger}
-	messagesHandler := &MessagesHandler{Messaging: wiring.MessagingPersistence, Threads: wiring.MessagingThreads, ReceiptTransport: hub}
-	meHandler := &MeHandler{Identity: wiring.Identity}
+	messagesHandler := &MessagesHandler{Messaging: wiring.MessagingPersistence, Threads: wiring.MessagingThreads, Search: wiring.MessagingSearch, ReceiptTransport: hub, Retention: wiring.MessagingRetention}
+	meHandler := &MeHandler{Identity: wiring.Identity, Account: wiring.Account, Security: authSecurity, SessionHub: hub}
+	mfaHandler := &MFAHandler{MFA: wiring.MFA}
+	passkeyHandler := &PasskeyHandler{Passkeys: wiring.Passkeys, Auth: wiring.Auth, Security: authSecurity}
+	oidcHandler := &OIDCHandler{OIDC: wiring.OIDC, Auth: wiring.Auth, Security: authSecurity}
+	apiTokenHandler := &APITokenHandler{Tokens: wiring.APITokens, SessionHub: hub}
+	webhookHandler := &WebhookHandler{Webhooks: wiring.Webhooks}
+	pushHandler := &PushHandler{Push: wiring.Push}
+	notificationsHandler := &NotificationsHandler{Digest: wiring.Digest, Security: authSecurity}
 	deviceKeysHandler := &DeviceKeysHandler{Devices: wiring.Devices}
+	attachmentsHandler := &AttachmentsHandler{Attachments: wiring.Attachments}
 
 	mux.HandleFunc("/healthz", healthzHandler)
 	mux.HandleFunc("/readyz", readyzHandler(readinessCheck(dataStore)))
+	mux.HandleFunc("/.well-known/jwks.json", jwksHandler)
 
 	mux.HandleFunc("/api/register", authHandler.Register)
 	mux.HandleFunc("/api/login", authHandler.Login)
+	mux.HandleFunc("/api/login/mfa", authHandler.LoginMFA)
+	mux.HandleFunc("/api/login/passkey/begin", passkeyHandler.BeginLogin)
+	mux.HandleFunc("/api/login/passkey", passkeyHandler.Login)
+	mux.HandleFunc("/api/login/oidc/begin", oidcHandler.BeginLogin)
+	mux.HandleFunc("/api/login/oidc", oidcHandler.Login)
 	mux.HandleFunc("/api/auth/refresh", authHandler.Refresh)
+	mux.HandleFunc("/api/auth/password/reset-request", authHandler.RequestPasswordReset)
+	mux.HandleFunc("/api/auth/password/reset", authHandler.ResetPassword)
+	mux.HandleFunc("/api/notifications/verify-email", notificationsHandler.VerifyEmail)
 
 	mux.Handle("/api/logout", authMiddleware(http.HandlerFunc(authHandler.Logout)))
 	mux.Handle("/api/sessions", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -82,6 +121,22 @@ func NewRouter(dataStore store.APIStore, hub *wsrelay.Hub) http.Handler {
 	mux.Handle("/api/invites/send", authMiddleware(http.HandlerFunc(inviteHandler.SendInvite)))
 	mux.Handle("/api/invites/accept", authMiddleware(http.HandlerFunc(inviteHandler.AcceptInvite)))
 	mux.Handle("/api/invites/reject", authMiddleware(http.HandlerFunc(inviteHandler.RejectInvite)))
+	mux.Handle("/api/invites/outgoing", authMiddleware(http.HandlerFunc(inviteHandler.GetOutgoingInvites)))
+	mux.Handle("/api/invites/cancel", authMiddleware(http.HandlerFunc(inviteHandler.CancelInvite)))
+	mux.Handle("/api/invite-links", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			inviteLinkHandler.ListLinks(w, r)
+		case http.MethodPost:
+			inviteLinkHandler.CreateLink(w, r)
+		case http.MethodDelete:
+			inviteLinkHandler.RevokeLink(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/invite-links/redeem", authMiddleware(http.HandlerFunc(inviteLinkHandler.RedeemLink)))
+	mux.Handle("/api/users/search", authMiddleware(http.HandlerFunc(directoryHandler.Search)))
 
 	mux.Handle("/api/me", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -89,23 +144,163 @@ func NewRouter(dataStore store.APIStore, hub *wsrelay.Hub) http.Handler {
 			meHandler.GetMe(w, r)
 		case http.MethodPatch:
 			meHandler.UpdateMe(w, r)
+		case http.MethodDelete:
+			meHandler.DeleteMe(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/export", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			meHandler.GetExport(w, r)
+		case http.MethodPost:
+			meHandler.RequestExport(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/export/download", authMiddleware(http.HandlerFunc(meHandler.DownloadExport)))
+	mux.Handle("/api/me/discoverability", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			directoryHandler.GetDiscoverability(w, r)
+		case http.MethodPut:
+			directoryHandler.UpdateDiscoverability(w, r)
 		default:
 			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
 		}
 	})))
-	mux.Handle("/api/wallet", authMiddleware(http.HandlerFunc(walletHandler.GetWallet)))
-	mux.Handle("/api/wallet/transfers", authMiddleware(http.HandlerFunc(walletHandler.GetTransfers)))
+	mux.Handle("/api/me/password", authMiddleware(http.HandlerFunc(authHandler.ChangePassword)))
+	mux.Handle("/api/me/mfa", authMiddleware(http.HandlerFunc(mfaHandler.GetStatus)))
+	mux.Handle("/api/me/mfa/totp", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			mfaHandler.BeginTOTP(w, r)
+		case http.MethodDelete:
+			mfaHandler.DisableTOTP(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/mfa/totp/confirm", authMiddleware(http.HandlerFunc(mfaHandler.ConfirmTOTP)))
+	mux.Handle("/api/me/passkeys", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			passkeyHandler.ListPasskeys(w, r)
+		case http.MethodDelete:
+			passkeyHandler.DeletePasskey(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/passkeys/register/begin", authMiddleware(http.HandlerFunc(passkeyHandler.BeginRegistration)))
+	mux.Handle("/api/me/passkeys/register", authMiddleware(http.HandlerFunc(passkeyHandler.FinishRegistration)))
+	mux.Handle("/api/me/oidc", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			oidcHandler.ListLinks(w, r)
+		case http.MethodDelete:
+			oidcHandler.Unlink(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/oidc/link/begin", authMiddleware(http.HandlerFunc(oidcHandler.BeginLink)))
+	mux.Handle("/api/me/oidc/link", authMiddleware(http.HandlerFunc(oidcHandler.FinishLink)))
+	mux.Handle("/api/me/tokens", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			apiTokenHandler.ListTokens(w, r)
+		case http.MethodPost:
+			apiTokenHandler.CreateToken(w, r)
+		case http.MethodDelete:
+			apiTokenHandler.RevokeToken(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/bots", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			apiTokenHandler.ListBots(w, r)
+		case http.MethodPost:
+			apiTokenHandler.CreateBot(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/webhooks", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			webhookHandler.ListEndpoints(w, r)
+		case http.MethodPost:
+			webhookHandler.CreateEndpoint(w, r)
+		case http.MethodDelete:
+			webhookHandler.DeleteEndpoint(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/webhooks/deliveries", authMiddleware(http.HandlerFunc(webhookHandler.ListDeliveries)))
+	mux.Handle("/api/me/webhooks/deliveries/retry", authMiddleware(http.HandlerFunc(webhookHandler.RetryDelivery)))
+	mux.Handle("/api/me/push", authMiddleware(http.HandlerFunc(pushHandler.GetPush)))
+	mux.Handle("/api/me/push/subscriptions", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			pushHandler.Subscribe(w, r)
+		case http.MethodDelete:
+			pushHandler.Unsubscribe(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/push/settings", authMiddleware(http.HandlerFunc(pushHandler.UpdateSettings)))
+	mux.Handle("/api/me/push/mutes", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			pushHandler.Mute(w, r)
+		case http.MethodDelete:
+			pushHandler.Unmute(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/notifications", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			notificationsHandler.GetPreferences(w, r)
+		case http.MethodPut:
+			notificationsHandler.UpdatePreferences(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/me/notifications/resend-verification", authMiddleware(http.HandlerFunc(notificationsHandler.ResendVerification)))
+	mux.Handle("/api/wallet", walletRead(http.HandlerFunc(walletHandler.GetWallet)))
+	mux.Handle("/api/wallet/transfers", walletRead(http.HandlerFunc(walletHandler.GetTransfers)))
 	mux.Handle("/api/wallet/send", authMiddleware(http.HandlerFunc(walletHandler.SendMoney)))
-	mux.Handle("/api/messages/inbox", authMiddleware(http.HandlerFunc(messagesHandler.GetInbox)))
-	mux.Handle("/api/messages/outbox", authMiddleware(http.HandlerFunc(messagesHandler.GetOutbox)))
-	mux.Handle("/api/messages/threads", authMiddleware(http.HandlerFunc(messagesHandler.GetThreads)))
-	mux.Handle("/api/messaging/threads", authMiddleware(http.HandlerFunc(messagesHandler.GetThreads)))
-	mux.Handle("/api/messages/sync", authMiddleware(http.HandlerFunc(messagesHandler.GetSync)))
-	mux.Handle("/api/messaging/sync", authMiddleware(http.HandlerFunc(messagesHandler.GetSync)))
-	mux.Handle("/api/messages/read", authMiddleware(http.HandlerFunc(messagesHandler.MarkRead)))
-	mux.Handle("/api/messages/read-thread", authMiddleware(http.HandlerFunc(messagesHandler.MarkThreadRead)))
-	mux.Handle("/api/messaging/read-thread", authMiddleware(http.HandlerFunc(messagesHandler.MarkThreadRead)))
-	mux.Handle("/api/messages/delivered", authMiddleware(http.HandlerFunc(messagesHandler.MarkDelivered)))
+	mux.Handle("/api/messages/inbox", messagesRead(http.HandlerFunc(messagesHandler.GetInbox)))
+	mux.Handle("/api/messages/outbox", messagesRead(http.HandlerFunc(messagesHandler.GetOutbox)))
+	mux.Handle("/api/messages/threads", messagesRead(http.HandlerFunc(messagesHandler.GetThreads)))
+	mux.Handle("/api/messaging/threads", messagesRead(http.HandlerFunc(messagesHandler.GetThreads)))
+	mux.Handle("/api/messaging/search", messagesRead(http.HandlerFunc(messagesHandler.SearchMessages)))
+	mux.Handle("/api/messaging/threads/timer", messagesSend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			messagesHandler.GetThreadTimer(w, r)
+		case http.MethodPut:
+			messagesHandler.SetThreadTimer(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/messages/sync", messagesRead(http.HandlerFunc(messagesHandler.GetSync)))
+	mux.Handle("/api/messaging/sync", messagesRead(http.HandlerFunc(messagesHandler.GetSync)))
+	mux.Handle("/api/messages/read", messagesRead(http.HandlerFunc(messagesHandler.MarkRead)))
+	mux.Handle("/api/messages/read-thread", messagesRead(http.HandlerFunc(messagesHandler.MarkThreadRead)))
+	mux.Handle("/api/messaging/read-thread", messagesRead(http.HandlerFunc(messagesHandler.MarkThreadRead)))
+	mux.Handle("/api/messages/delivered", messagesRead(http.HandlerFunc(messagesHandler.MarkDelivered)))
 	mux.Handle("/api/devices", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -121,6 +316,21 @@ func NewRouter(dataStore store.APIStore, hub *wsrelay.Hub) http.Handler {
 	mux.Handle("/api/devices/rotate", authMiddleware(http.HandlerFunc(deviceKeysHandler.RotateDevice)))
 	mux.Handle("/api/messaging/prekeys", authMiddleware(http.HandlerFunc(deviceKeysHandler.PublishPrekeys)))
 	mux.Handle("/api/devices/directory", authMiddleware(http.HandlerFunc(deviceKeysHandler.GetDirectory)))
+	mux.Handle("/api/attachments/uploads", messagesSend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			attachmentsHandler.GetUpload(w, r)
+		case http.MethodPost:
+			attachmentsHandler.CreateUpload(w, r)
+		default:
+			web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.Handle("/api/attachments/uploads/chunk", messagesSend(http.HandlerFunc(attachmentsHandler.AppendChunk)))
+	mux.Handle("/api/attachments/uploads/complete", messagesSend(http.HandlerFunc(attachmentsHandler.CompleteUpload)))
+	mux.Handle("/api/attachments", messagesRead(http.HandlerFunc(attachmentsHandler.GetAttachment)))
+	mux.Handle("/api/attachments/blob", messagesRead(http.HandlerFunc(attachmentsHandler.DownloadAttachment)))
+	mux.Handle("/api/attachments/thumbnail", messagesRead(http.HandlerFunc(attachmentsHandler.DownloadThumbnail)))
 
 	mux.Handle("/ws", wsHandshakeLimiter(wsrelay.WebSocketHandler(hub, app.WSAuthenticator(wiring.Tokens, dataStore), app.WSResolveUserID(dataStore))))
 
@@ -0,0 +1,266 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	corewebhooks "github.com/kyambuthia/go-chat-site/server/internal/core/webhooks"
+	"github.com/kyambuthia/go-chat-site/server/internal/web"
+)
+
+// WebhookHandler manages the caller's outbound webhook endpoints and their
+// delivery log. Its routes take session tokens only.
+type WebhookHandler struct {
+	Webhooks corewebhooks.Service
+}
+
+// CreateEndpoint returns the signing secret once, in the 201 response.
+func (h *WebhookHandler) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Webhooks == nil {
+		web.JSONError(w, errors.New("webhooks unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		URL         string   `json:"url"`
+		Description string   `json:"description"`
+		Events      []string `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	endpoint, err := h.Webhooks.CreateEndpoint(r.Context(), userID, corewebhooks.CreateEndpointRequest{
+		URL:         req.URL,
+		Description: req.Description,
+		Events:      req.Events,
+	})
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("webhook_endpoint_created", map[string]any{
+		"request_id":  r.Header.Get("X-Request-ID"),
+		"user_id":     userID,
+		"endpoint_id": endpoint.ID,
+		"url":         endpoint.URL,
+	})
+
+	resp := webhookEndpointJSON(endpoint)
+	resp["secret"] = endpoint.Secret
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *WebhookHandler) ListEndpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Webhooks == nil {
+		web.JSONError(w, errors.New("webhooks unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	endpoints, err := h.Webhooks.ListEndpoints(r.Context(), userID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	resp := make([]map[string]any, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		resp = append(resp, webhookEndpointJSON(endpoint))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// DeleteEndpoint also drops the endpoint's queued deliveries and log.
+func (h *WebhookHandler) DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Webhooks == nil {
+		web.JSONError(w, errors.New("webhooks unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Webhooks.DeleteEndpoint(r.Context(), userID, req.ID); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	auth.LogSecurityEvent("webhook_endpoint_deleted", map[string]any{
+		"request_id":  r.Header.Get("X-Request-ID"),
+		"user_id":     userID,
+		"endpoint_id": req.ID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns the delivery log, newest first, optionally for one
+// endpoint with ?endpoint_id=.
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Webhooks == nil {
+		web.JSONError(w, errors.New("webhooks unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var endpointID int64
+	if raw := r.URL.Query().Get("endpoint_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			web.JSONError(w, errors.New("invalid endpoint_id"), http.StatusBadRequest)
+			return
+		}
+		endpointID = id
+	}
+	var limit int
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			web.JSONError(w, errors.New("invalid limit"), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.Webhooks.ListDeliveries(r.Context(), userID, endpointID, limit)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	resp := make([]map[string]any, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		resp = append(resp, webhookDeliveryJSON(delivery))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RetryDelivery re-queues a dead-lettered delivery.
+func (h *WebhookHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		web.JSONError(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		web.JSONError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	if h.Webhooks == nil {
+		web.JSONError(w, errors.New("webhooks unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+		web.JSONError(w, errors.New("invalid request body"), http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.Webhooks.RetryDelivery(r.Context(), userID, req.ID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(webhookDeliveryJSON(delivery))
+}
+
+func webhookEndpointJSON(endpoint corewebhooks.Endpoint) map[string]any {
+	return map[string]any{
+		"id":          endpoint.ID,
+		"url":         endpoint.URL,
+		"description": endpoint.Description,
+		"events":      endpoint.Events,
+		"created_at":  endpoint.CreatedAt,
+	}
+}
+
+func webhookDeliveryJSON(delivery corewebhooks.Delivery) map[string]any {
+	item := map[string]any{
+		"id":               delivery.ID,
+		"endpoint_id":      delivery.EndpointID,
+		"event_id":         delivery.EventID,
+		"event_type":       delivery.EventType,
+		"status":           delivery.Status,
+		"attempts":         delivery.Attempts,
+		"last_status_code": delivery.LastStatusCode,
+		"last_error":       delivery.LastError,
+		"created_at":       delivery.CreatedAt,
+	}
+	if delivery.Status == corewebhooks.DeliveryPending {
+		item["next_attempt_at"] = delivery.NextAttemptAt
+	}
+	if delivery.LastAttemptAt != nil {
+		item["last_attempt_at"] = *delivery.LastAttemptAt
+	}
+	if delivery.DeliveredAt != nil {
+		item["delivered_at"] = *delivery.DeliveredAt
+	}
+	return item
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, corewebhooks.ErrInvalidEndpoint), errors.Is(err, corewebhooks.ErrInvalidEndpointURL),
+		errors.Is(err, corewebhooks.ErrInvalidEventType):
+		web.JSONError(w, err, http.StatusBadRequest)
+	case errors.Is(err, corewebhooks.ErrEndpointNotFound), errors.Is(err, corewebhooks.ErrDeliveryNotFound):
+		web.JSONError(w, err, http.StatusNotFound)
+	case errors.Is(err, corewebhooks.ErrEndpointLimit), errors.Is(err, corewebhooks.ErrDeliveryNotDead):
+		web.JSONError(w, err, http.StatusConflict)
+	default:
+		web.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,209 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/transport/wsrelay"
+	"github.com/kyambuthia/go-chat-site/server/internal/app"
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+	corewebhooks "github.com/kyambuthia/go-chat-site/server/internal/core/webhooks"
+)
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func TestWebhookHandlers_InviteAcceptedIsDeliveredSigned(t *testing.T) {
+	if err := auth.ConfigureJWT("webhook-handlers-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WEBHOOKS_ALLOW_PRIVATE_TARGETS", "true")
+	received := make(chan receivedWebhook, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedWebhook{header: r.Header.Clone(), body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	s := setupRouterStore(t)
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := s.CreateUser(name, "password123"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hub := wsrelay.NewHub()
+	go hub.Run()
+	t.Cleanup(hub.Shutdown)
+	// Deliveries need the dispatcher, so this test starts the wiring.
+	wiring := app.NewWiring(s)
+	wiring.Start(context.Background())
+	t.Cleanup(wiring.Stop)
+	router := NewRouterWithWiring(s, hub, wiring)
+	alice, _ := loginForTest(t, router, "password123")
+	rr := postJSON(t, router, "/api/login", "", map[string]string{"username": "bob", "password": "password123"})
+	var bobLogin struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&bobLogin); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := postJSON(t, router, "/api/me/webhooks", alice, map[string]any{"url": "ftp://example.com", "events": []string{"invite.accepted"}}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad url status = %d, want 400", rr.Code)
+	}
+	rr = postJSON(t, router, "/api/me/webhooks", alice, map[string]any{"url": receiver.URL + "/hooks", "events": []string{"invite.accepted"}})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create endpoint status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var endpoint struct {
+		ID     int64  `json:"id"`
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&endpoint); err != nil || endpoint.Secret == "" {
+		t.Fatalf("endpoint = %+v, err = %v", endpoint, err)
+	}
+	if rr := authedRequest(t, router, http.MethodGet, "/api/me/webhooks", alice, nil); rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), endpoint.Secret) {
+		t.Fatalf("list endpoints status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if rr := postJSON(t, router, "/api/invites/send", alice, map[string]string{"username": "bob"}); rr.Code >= 300 {
+		t.Fatalf("send invite status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = authedRequest(t, router, http.MethodGet, "/api/invites", bobLogin.AccessToken, nil)
+	var invites []struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&invites); err != nil || len(invites) != 1 {
+		t.Fatalf("invites = %+v, err = %v", invites, err)
+	}
+	if rr := postJSON(t, router, "/api/invites/accept", bobLogin.AccessToken, map[string]int{"invite_id": invites[0].ID}); rr.Code >= 300 {
+		t.Fatalf("accept invite status = %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	var got receivedWebhook
+	select {
+	case got = <-received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	if err := corewebhooks.VerifySignature(endpoint.Secret, got.header.Get(corewebhooks.SignatureHeader), got.body, time.Now(), time.Minute); err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	if got.header.Get(corewebhooks.EventTypeHeader) != "invite.accepted" || !strings.Contains(string(got.body), `"accepted_by_user_id"`) {
+		t.Fatalf("webhook headers=%v body=%s", got.header, got.body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rr = authedRequest(t, router, http.MethodGet, "/api/me/webhooks/deliveries", alice, nil)
+		if strings.Contains(rr.Body.String(), `"status":"delivered"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery log status = %d body=%s", rr.Code, rr.Body.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if rr := authedRequest(t, router, http.MethodGet, "/api/me/webhooks/deliveries", bobLogin.AccessToken, nil); rr.Body.String() != "[]\n" {
+		t.Fatalf("another user's delivery log = %s", rr.Body.String())
+	}
+
+	if rr := authedRequest(t, router, http.MethodDelete, "/api/me/webhooks", bobLogin.AccessToken, map[string]int64{"id": endpoint.ID}); rr.Code != http.StatusNotFound {
+		t.Fatalf("delete by another user status = %d, want 404", rr.Code)
+	}
+	if rr := authedRequest(t, router, http.MethodDelete, "/api/me/webhooks", alice, map[string]int64{"id": endpoint.ID}); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestWebhookHandlers_PaymentRequestPaidIsDeliveredToRequester(t *testing.T) {
+	if err := auth.ConfigureJWT("webhook-handlers-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WEBHOOKS_ALLOW_PRIVATE_TARGETS", "true")
+	received := make(chan receivedWebhook, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedWebhook{header: r.Header.Clone(), body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	s := setupRouterStore(t)
+	aliceID, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobID, err := s.CreateUser("bob", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := wsrelay.NewHub()
+	go hub.Run()
+	t.Cleanup(hub.Shutdown)
+	wiring := app.NewWiring(s)
+	wiring.Start(context.Background())
+	t.Cleanup(wiring.Stop)
+	router := NewRouterWithWiring(s, hub, wiring)
+	alice, _ := loginForTest(t, router, "password123")
+
+	rr := postJSON(t, router, "/api/me/webhooks", alice, map[string]any{"url": receiver.URL + "/hooks", "events": []string{"payment_request.paid"}})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create endpoint status = %d body=%s", rr.Code, rr.Body.String())
+	}
+	var endpoint struct {
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, req := range []coremsg.PersistDirectMessageRequest{
+		{FromUserID: aliceID, ToUserID: bobID, ContentKind: "payment_request", Body: `__microapp_v1__:{"kind":"payment_request","requestId":"payreq_1","amount":12.5}`},
+		{FromUserID: bobID, ToUserID: aliceID, ContentKind: "payment_request_update", Body: `__microapp_v1__:{"kind":"payment_request_update","requestId":"payreq_1","status":"declined"}`},
+		{FromUserID: bobID, ToUserID: aliceID, ContentKind: "payment_request_update", Body: `__microapp_v1__:{"kind":"payment_request_update","requestId":"payreq_1","status":"paid"}`},
+	} {
+		if _, err := wiring.MessagingPersistence.StoreDirectMessage(ctx, req); err != nil {
+			t.Fatalf("StoreDirectMessage(%s) error: %v", req.ContentKind, err)
+		}
+	}
+
+	var got receivedWebhook
+	select {
+	case got = <-received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	if err := corewebhooks.VerifySignature(endpoint.Secret, got.header.Get(corewebhooks.SignatureHeader), got.body, time.Now(), time.Minute); err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			RequestID   string `json:"request_id"`
+			PayerUserID int    `json:"payer_user_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(got.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != "payment_request.paid" || event.Data.RequestID != "payreq_1" || event.Data.PayerUserID != bobID {
+		t.Fatalf("webhook body = %s", got.body)
+	}
+	select {
+	case extra := <-received:
+		t.Fatalf("unexpected second webhook: %s", extra.body)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
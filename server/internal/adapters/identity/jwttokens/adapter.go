@@ -9,11 +9,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"sync/atomic"
 	"time"
 
 	"github.com/kyambuthia/go-chat-site/server/internal/auth"
 	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
 )
 
 const (
@@ -22,14 +22,17 @@ const (
 )
 
 type Adapter struct {
-	DB         *sql.DB
+	DB *sql.DB
+	// Dialect is the SQL flavour of DB; the zero value is SQLite.
+	Dialect    dialect.Dialect
 	AccessTTL  time.Duration
 	RefreshTTL time.Duration
-
-	cleanupCalls atomic.Uint64
 }
 
-var _ coreid.TokenService = (*Adapter)(nil)
+var (
+	_ coreid.TokenService   = (*Adapter)(nil)
+	_ coreid.SessionRevoker = (*Adapter)(nil)
+)
 
 func (a *Adapter) IssueSession(ctx context.Context, principal coreid.Principal, meta coreid.SessionMetadata) (coreid.SessionTokens, error) {
 	if a.DB == nil {
@@ -69,7 +72,6 @@ func (a *Adapter) IssueSession(ctx context.Context, principal coreid.Principal,
 	if err := tx.Commit(); err != nil {
 		return coreid.SessionTokens{}, err
 	}
-	a.maybeCleanup()
 	return tokens, nil
 }
 
@@ -90,6 +92,11 @@ func (a *Adapter) RefreshSession(ctx context.Context, refreshToken string, meta
 	defer tx.Rollback()
 
 	record, err := a.getSessionByRefreshHashTx(ctx, tx, tokenHash)
+	retired := false
+	if errors.Is(err, sql.ErrNoRows) {
+		record, err = a.getSessionByRetiredRefreshHashTx(ctx, tx, tokenHash)
+		retired = true
+	}
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return coreid.SessionTokens{}, coreid.ErrInvalidRefreshToken
@@ -108,14 +115,15 @@ func (a *Adapter) RefreshSession(ctx context.Context, refreshToken string, meta
 		}
 		return coreid.SessionTokens{}, coreid.ErrInvalidRefreshToken
 	}
-	if record.PreviousRefreshHash == tokenHash {
-		if err := a.revokeSessionTx(ctx, tx, int(record.UserID), record.ID, "refresh_token_replay", now); err != nil {
+	if retired || record.PreviousRefreshHash == tokenHash {
+		revoked, err := a.revokeSessionFamilyTx(ctx, tx, record, coreid.RevokeReasonRefreshTokenReplay, now)
+		if err != nil {
 			return coreid.SessionTokens{}, err
 		}
 		if err := tx.Commit(); err != nil {
 			return coreid.SessionTokens{}, err
 		}
-		return coreid.SessionTokens{}, coreid.ErrRefreshTokenReplay
+		return coreid.SessionTokens{}, &coreid.RefreshTokenReuseError{UserID: record.UserID, SessionIDs: revoked}
 	}
 	if record.CurrentRefreshHash != tokenHash {
 		return coreid.SessionTokens{}, coreid.ErrInvalidRefreshToken
@@ -141,7 +149,7 @@ func (a *Adapter) RefreshSession(ctx context.Context, refreshToken string, meta
 		lastSeenIP = meta.IPAddress
 	}
 
-	if _, err := tx.ExecContext(ctx, `
+	if _, err := tx.ExecContext(ctx, a.Dialect.Rebind(`
 		UPDATE auth_sessions
 		SET previous_refresh_hash = current_refresh_hash,
 			current_refresh_hash = ?,
@@ -154,7 +162,14 @@ func (a *Adapter) RefreshSession(ctx context.Context, refreshToken string, meta
 			refresh_token_expires_at = ?,
 			updated_at = ?
 		WHERE id = ? AND user_id = ? AND revoked_at IS NULL
-	`, nextRefreshHash, deviceLabel, userAgent, lastSeenIP, now, now, accessExpiresAt, refreshExpiresAt, now, record.ID, record.UserID); err != nil {
+	`), nextRefreshHash, deviceLabel, userAgent, lastSeenIP, now, now, accessExpiresAt, refreshExpiresAt, now, record.ID, record.UserID); err != nil {
+		return coreid.SessionTokens{}, err
+	}
+	if _, err := tx.ExecContext(ctx, a.Dialect.Rebind(`
+		INSERT INTO auth_refresh_token_history (token_hash, session_id, rotated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (token_hash) DO NOTHING
+	`), tokenHash, record.ID, now); err != nil {
 		return coreid.SessionTokens{}, err
 	}
 
@@ -165,7 +180,6 @@ func (a *Adapter) RefreshSession(ctx context.Context, refreshToken string, meta
 	if err := tx.Commit(); err != nil {
 		return coreid.SessionTokens{}, err
 	}
-	a.maybeCleanup()
 
 	return coreid.SessionTokens{
 		AccessToken:           accessToken,
@@ -200,11 +214,11 @@ func (a *Adapter) ValidateToken(ctx context.Context, token string) (coreid.Token
 
 	var userID int
 	var revokedAt sql.NullTime
-	if err := a.DB.QueryRowContext(ctx, `
+	if err := a.DB.QueryRowContext(ctx, a.Dialect.Rebind(`
 		SELECT user_id, revoked_at
 		FROM auth_sessions
 		WHERE id = ?
-	`, claims.SessionID).Scan(&userID, &revokedAt); err != nil {
+	`), claims.SessionID).Scan(&userID, &revokedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return coreid.TokenClaims{}, coreid.ErrSessionNotFound
 		}
@@ -225,13 +239,13 @@ func (a *Adapter) ListSessions(ctx context.Context, userID coreid.UserID) ([]cor
 		return nil, nil
 	}
 
-	rows, err := a.DB.QueryContext(ctx, `
+	rows, err := a.DB.QueryContext(ctx, a.Dialect.Rebind(`
 		SELECT id, user_id, device_label, user_agent, last_seen_ip,
 		       created_at, last_seen_at, access_token_expires_at, refresh_token_expires_at, revoked_at
 		FROM auth_sessions
 		WHERE user_id = ?
 		ORDER BY created_at DESC, id DESC
-	`, userID)
+	`), userID)
 	if err != nil {
 		return nil, err
 	}
@@ -248,7 +262,6 @@ func (a *Adapter) ListSessions(ctx context.Context, userID coreid.UserID) ([]cor
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	a.maybeCleanup()
 	return sessions, nil
 }
 
@@ -269,26 +282,54 @@ func (a *Adapter) RevokeSession(ctx context.Context, actorUserID coreid.UserID,
 	if err := tx.Commit(); err != nil {
 		return err
 	}
-	a.maybeCleanup()
 	return nil
 }
 
+// RevokeUserSessions revokes every live session of userID other than
+// keepSessionID and returns the IDs it revoked.
+func (a *Adapter) RevokeUserSessions(ctx context.Context, userID coreid.UserID, keepSessionID int64, reason string) ([]int64, error) {
+	if a.DB == nil {
+		return nil, nil
+	}
+	now := time.Now().UTC()
+	rows, err := a.DB.QueryContext(ctx, a.Dialect.Rebind(`
+		UPDATE auth_sessions
+		SET revoked_at = ?, revoke_reason = ?, updated_at = ?
+		WHERE user_id = ? AND id <> ? AND revoked_at IS NULL
+		RETURNING id
+	`), now, reason, now, userID, keepSessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		revoked = append(revoked, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
 func (a *Adapter) TouchSession(ctx context.Context, sessionID int64, meta coreid.SessionMetadata) error {
 	if a.DB == nil || sessionID <= 0 {
 		return nil
 	}
 	now := time.Now().UTC()
-	_, err := a.DB.ExecContext(ctx, `
+	_, err := a.DB.ExecContext(ctx, a.Dialect.Rebind(`
 		UPDATE auth_sessions
 		SET user_agent = CASE WHEN ? <> '' THEN ? ELSE user_agent END,
 			last_seen_ip = CASE WHEN ? <> '' THEN ? ELSE last_seen_ip END,
 			last_seen_at = ?,
 			updated_at = ?
 		WHERE id = ? AND revoked_at IS NULL
-	`, meta.UserAgent, meta.UserAgent, meta.IPAddress, meta.IPAddress, now, now, sessionID)
-	if err == nil {
-		a.maybeCleanup()
-	}
+	`), meta.UserAgent, meta.UserAgent, meta.IPAddress, meta.IPAddress, now, now, sessionID)
 	return err
 }
 
@@ -308,17 +349,14 @@ func (a *Adapter) issueSessionTx(ctx context.Context, tx *sql.Tx, principal core
 	refreshExpiresAt := now.Add(a.refreshTTL())
 	deviceLabel := normalizeDeviceLabel(meta.DeviceLabel)
 
-	result, err := tx.ExecContext(ctx, `
+	var sessionID int64
+	if err := tx.QueryRowContext(ctx, a.Dialect.Rebind(`
 		INSERT INTO auth_sessions (
 			user_id, device_label, user_agent, last_seen_ip, current_refresh_hash,
 			access_token_expires_at, refresh_token_expires_at, created_at, last_seen_at, refreshed_at, updated_at
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, principal.ID, deviceLabel, meta.UserAgent, meta.IPAddress, refreshHash, accessExpiresAt, refreshExpiresAt, now, now, now, now)
-	if err != nil {
-		return coreid.SessionTokens{}, err
-	}
-	sessionID, err := result.LastInsertId()
-	if err != nil {
+		RETURNING id
+	`), principal.ID, deviceLabel, meta.UserAgent, meta.IPAddress, refreshHash, accessExpiresAt, refreshExpiresAt, now, now, now, now).Scan(&sessionID); err != nil {
 		return coreid.SessionTokens{}, err
 	}
 	accessToken, err := auth.GenerateAccessToken(int(principal.ID), sessionID, a.accessTTL())
@@ -345,14 +383,14 @@ func (a *Adapter) issueSessionTx(ctx context.Context, tx *sql.Tx, principal core
 }
 
 func (a *Adapter) getSessionByRefreshHashTx(ctx context.Context, tx *sql.Tx, refreshHash string) (sessionRecord, error) {
-	row := tx.QueryRowContext(ctx, `
+	row := tx.QueryRowContext(ctx, a.Dialect.Rebind(`
 		SELECT id, user_id, device_label, user_agent, last_seen_ip,
 		       created_at, last_seen_at, access_token_expires_at, refresh_token_expires_at, revoked_at,
 		       current_refresh_hash, previous_refresh_hash
 		FROM auth_sessions
 		WHERE current_refresh_hash = ? OR previous_refresh_hash = ?
 		LIMIT 1
-	`, refreshHash, refreshHash)
+	`), refreshHash, refreshHash)
 
 	session, err := scanSessionRecord(row)
 	if err != nil {
@@ -361,14 +399,39 @@ func (a *Adapter) getSessionByRefreshHashTx(ctx context.Context, tx *sql.Tx, ref
 	return session, nil
 }
 
+// getSessionByRetiredRefreshHashTx finds the session that once issued a
+// refresh token which has since been rotated out.
+func (a *Adapter) getSessionByRetiredRefreshHashTx(ctx context.Context, tx *sql.Tx, refreshHash string) (sessionRecord, error) {
+	row := tx.QueryRowContext(ctx, a.Dialect.Rebind(`
+		SELECT s.id, s.user_id, s.device_label, s.user_agent, s.last_seen_ip,
+		       s.created_at, s.last_seen_at, s.access_token_expires_at, s.refresh_token_expires_at, s.revoked_at,
+		       s.current_refresh_hash, s.previous_refresh_hash
+		FROM auth_refresh_token_history h
+		JOIN auth_sessions s ON s.id = h.session_id
+		WHERE h.token_hash = ?
+	`), refreshHash)
+	return scanSessionRecord(row)
+}
+
+// revokeSessionFamilyTx revokes every session descended from the same login
+// as record and returns their IDs. Refresh rotation happens in place, so a
+// login's whole token chain lives on one auth_sessions row and the family is
+// that row.
+func (a *Adapter) revokeSessionFamilyTx(ctx context.Context, tx *sql.Tx, record sessionRecord, reason string, now time.Time) ([]int64, error) {
+	if err := a.revokeSessionTx(ctx, tx, int(record.UserID), record.ID, reason, now); err != nil {
+		return nil, err
+	}
+	return []int64{record.ID}, nil
+}
+
 func (a *Adapter) revokeSessionTx(ctx context.Context, tx *sql.Tx, actorUserID int, sessionID int64, reason string, now time.Time) error {
-	result, err := tx.ExecContext(ctx, `
+	result, err := tx.ExecContext(ctx, a.Dialect.Rebind(`
 		UPDATE auth_sessions
 		SET revoked_at = COALESCE(revoked_at, ?),
 			revoke_reason = CASE WHEN revoke_reason = '' THEN ? ELSE revoke_reason END,
 			updated_at = ?
 		WHERE id = ? AND user_id = ?
-	`, now, reason, now, sessionID, actorUserID)
+	`), now, reason, now, sessionID, actorUserID)
 	if err != nil {
 		return err
 	}
@@ -396,19 +459,27 @@ func (a *Adapter) refreshTTL() time.Duration {
 	return defaultRefreshTTL
 }
 
-func (a *Adapter) maybeCleanup() {
+// sessionRetention is how long a revoked or expired session is kept so the
+// sessions list can still show it.
+const sessionRetention = 30 * 24 * time.Hour
+
+// DeleteStaleSessions deletes sessions revoked or past their refresh expiry
+// more than sessionRetention before now. It returns how many it deleted.
+func (a *Adapter) DeleteStaleSessions(ctx context.Context, now time.Time) (int, error) {
 	if a.DB == nil {
-		return
-	}
-	if a.cleanupCalls.Add(1)%256 != 0 {
-		return
+		return 0, nil
 	}
-	cutoff := time.Now().UTC().Add(-30 * 24 * time.Hour)
-	_, _ = a.DB.Exec(`
+	cutoff := now.UTC().Add(-sessionRetention)
+	res, err := a.DB.ExecContext(ctx, a.Dialect.Rebind(`
 		DELETE FROM auth_sessions
 		WHERE (revoked_at IS NOT NULL AND updated_at < ?)
 		   OR refresh_token_expires_at < ?
-	`, cutoff, cutoff)
+	`), cutoff, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
 }
 
 type scanner interface {
@@ -2,8 +2,10 @@ package jwttokens
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/kyambuthia/go-chat-site/server/internal/auth"
 	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
@@ -74,6 +76,89 @@ func TestAdapter_IssueValidateListAndRevokeSession(t *testing.T) {
 	}
 }
 
+func TestAdapter_RevokeUserSessions_KeepsCurrentSession(t *testing.T) {
+	if err := auth.ConfigureJWT("test-secret-123456"); err != nil {
+		t.Fatal(err)
+	}
+	s := newTokenTestStore(t)
+	aliceID, _ := s.CreateUser("alice", "password123")
+	bobID, _ := s.CreateUser("bob", "password123")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+	alice := coreid.Principal{ID: coreid.UserID(aliceID), Username: "alice"}
+
+	current, err := a.IssueSession(ctx, alice, coreid.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := a.IssueSession(ctx, alice, coreid.SessionMetadata{})
+	bob, _ := a.IssueSession(ctx, coreid.Principal{ID: coreid.UserID(bobID), Username: "bob"}, coreid.SessionMetadata{})
+
+	revoked, err := a.RevokeUserSessions(ctx, alice.ID, current.Session.ID, coreid.RevokeReasonPasswordChanged)
+	if err != nil {
+		t.Fatalf("RevokeUserSessions error: %v", err)
+	}
+	if len(revoked) != 1 || revoked[0] != other.Session.ID {
+		t.Fatalf("revoked = %v, want [%d]", revoked, other.Session.ID)
+	}
+	if _, err := a.ValidateToken(ctx, other.AccessToken); err == nil {
+		t.Fatal("expected other session to be revoked")
+	}
+	if _, err := a.RefreshSession(ctx, other.RefreshToken, coreid.SessionMetadata{}); err == nil {
+		t.Fatal("expected other session refresh to fail")
+	}
+	for _, tokens := range []coreid.SessionTokens{current, bob} {
+		if _, err := a.ValidateToken(ctx, tokens.AccessToken); err != nil {
+			t.Fatalf("session %d should survive: %v", tokens.Session.ID, err)
+		}
+	}
+	var reason string
+	if err := s.DB.QueryRow(`SELECT revoke_reason FROM auth_sessions WHERE id = ?`, other.Session.ID).Scan(&reason); err != nil || reason != coreid.RevokeReasonPasswordChanged {
+		t.Fatalf("revoke_reason = %q, %v", reason, err)
+	}
+
+	if revoked, err := a.RevokeUserSessions(ctx, alice.ID, 0, coreid.RevokeReasonPasswordReset); err != nil || len(revoked) != 1 || revoked[0] != current.Session.ID {
+		t.Fatalf("revoke all = %v, %v", revoked, err)
+	}
+}
+
+func TestAdapter_DeleteStaleSessions_RemovesOnlyOldRevokedOrExpired(t *testing.T) {
+	if err := auth.ConfigureJWT("test-secret-123456"); err != nil {
+		t.Fatal(err)
+	}
+	s := newTokenTestStore(t)
+	aliceID, _ := s.CreateUser("alice", "password123")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+	alice := coreid.Principal{ID: coreid.UserID(aliceID), Username: "alice"}
+
+	live, _ := a.IssueSession(ctx, alice, coreid.SessionMetadata{})
+	recentlyRevoked, _ := a.IssueSession(ctx, alice, coreid.SessionMetadata{})
+	oldRevoked, _ := a.IssueSession(ctx, alice, coreid.SessionMetadata{})
+	if err := a.RevokeSession(ctx, alice.ID, recentlyRevoked.Session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RevokeSession(ctx, alice.ID, oldRevoked.Session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DB.Exec(`UPDATE auth_sessions SET updated_at = ? WHERE id = ?`, time.Now().UTC().AddDate(0, 0, -31), oldRevoked.Session.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := a.DeleteStaleSessions(ctx, time.Now()); err != nil || n != 1 {
+		t.Fatalf("DeleteStaleSessions = %d, %v; want 1", n, err)
+	}
+	sessions, err := a.ListSessions(ctx, alice.ID)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("sessions left = %d, %v", len(sessions), err)
+	}
+	for _, session := range sessions {
+		if session.ID != live.Session.ID && session.ID != recentlyRevoked.Session.ID {
+			t.Fatalf("unexpected session %d kept", session.ID)
+		}
+	}
+}
+
 func TestAdapter_RefreshSession_RotatesAndRejectsReplay(t *testing.T) {
 	if err := auth.ConfigureJWT("test-secret-123456"); err != nil {
 		t.Fatal(err)
@@ -109,7 +194,7 @@ func TestAdapter_RefreshSession_RotatesAndRejectsReplay(t *testing.T) {
 	if _, err := a.RefreshSession(context.Background(), initial.RefreshToken, coreid.SessionMetadata{
 		UserAgent: "replay-agent",
 		IPAddress: "127.0.0.3",
-	}); err != coreid.ErrRefreshTokenReplay {
+	}); !errors.Is(err, coreid.ErrRefreshTokenReplay) {
 		t.Fatalf("replay error = %v, want %v", err, coreid.ErrRefreshTokenReplay)
 	}
 
@@ -128,3 +213,110 @@ func TestAdapter_ValidateToken_FailsForInvalidToken(t *testing.T) {
 		t.Fatal("expected invalid token error")
 	}
 }
+
+func TestAdapter_RefreshSession_ReuseOfOlderTokenRevokesFamily(t *testing.T) {
+	if err := auth.ConfigureJWT("test-secret-123456"); err != nil {
+		t.Fatal(err)
+	}
+	s := newTokenTestStore(t)
+	userID, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+	alice := coreid.Principal{ID: coreid.UserID(userID), Username: "alice"}
+
+	first, err := a.IssueSession(ctx, alice, coreid.SessionMetadata{DeviceLabel: "laptop"})
+	if err != nil {
+		t.Fatalf("IssueSession error: %v", err)
+	}
+	other, err := a.IssueSession(ctx, alice, coreid.SessionMetadata{DeviceLabel: "phone"})
+	if err != nil {
+		t.Fatalf("IssueSession error: %v", err)
+	}
+	second, err := a.RefreshSession(ctx, first.RefreshToken, coreid.SessionMetadata{})
+	if err != nil {
+		t.Fatalf("first rotation error: %v", err)
+	}
+	third, err := a.RefreshSession(ctx, second.RefreshToken, coreid.SessionMetadata{})
+	if err != nil {
+		t.Fatalf("second rotation error: %v", err)
+	}
+
+	// first.RefreshToken is no longer the previous hash; only the history
+	// table still knows it.
+	_, err = a.RefreshSession(ctx, first.RefreshToken, coreid.SessionMetadata{})
+	var reuse *coreid.RefreshTokenReuseError
+	if !errors.As(err, &reuse) || !errors.Is(err, coreid.ErrRefreshTokenReplay) {
+		t.Fatalf("reuse error = %v", err)
+	}
+	if reuse.UserID != alice.ID || len(reuse.SessionIDs) != 1 || reuse.SessionIDs[0] != first.Session.ID {
+		t.Fatalf("reuse = %+v", reuse)
+	}
+	if _, err := a.RefreshSession(ctx, third.RefreshToken, coreid.SessionMetadata{}); !errors.Is(err, coreid.ErrInvalidRefreshToken) {
+		t.Fatalf("descendant refresh error = %v", err)
+	}
+	if _, err := a.ValidateToken(ctx, third.AccessToken); err == nil {
+		t.Fatal("expected descendant access token to be revoked")
+	}
+	var reason string
+	if err := s.DB.QueryRow(`SELECT revoke_reason FROM auth_sessions WHERE id = ?`, first.Session.ID).Scan(&reason); err != nil || reason != coreid.RevokeReasonRefreshTokenReplay {
+		t.Fatalf("revoke_reason = %q, %v", reason, err)
+	}
+	if _, err := a.ValidateToken(ctx, other.AccessToken); err != nil {
+		t.Fatalf("unrelated session should survive: %v", err)
+	}
+	if _, err := a.RefreshSession(ctx, "never-issued", coreid.SessionMetadata{}); !errors.Is(err, coreid.ErrInvalidRefreshToken) {
+		t.Fatalf("unknown token error = %v", err)
+	}
+}
+
+func TestAdapter_ValidateToken_UsesConfiguredKeySet(t *testing.T) {
+	if err := auth.ConfigureJWT("test-secret-123456"); err != nil {
+		t.Fatal(err)
+	}
+	s := newTokenTestStore(t)
+	userID, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+
+	legacy, err := a.IssueSession(ctx, coreid.Principal{ID: coreid.UserID(userID), Username: "alice"}, coreid.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.NewKeySet(auth.AlgES256, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.ConfigureKeySet(keys); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = auth.ConfigureKeySet(nil) })
+	if _, err := a.ValidateToken(ctx, legacy.AccessToken); err == nil {
+		t.Fatal("expected a kid-less token to fail under a key set without a legacy cutoff")
+	}
+	auth.ConfigureLegacySecretUntil(time.Now().Add(time.Hour))
+	t.Cleanup(func() { auth.ConfigureLegacySecretUntil(time.Time{}) })
+
+	issued, err := a.IssueSession(ctx, coreid.Principal{ID: coreid.UserID(userID), Username: "alice"}, coreid.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tokens := range []coreid.SessionTokens{legacy, issued} {
+		claims, err := a.ValidateToken(ctx, tokens.AccessToken)
+		if err != nil || claims.SessionID != tokens.Session.ID {
+			t.Fatalf("ValidateToken = %+v, %v", claims, err)
+		}
+	}
+
+	if _, err := keys.Rotate("", time.Hour, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ValidateToken(ctx, issued.AccessToken); err == nil {
+		t.Fatal("expected token from a key past its rotation window to fail")
+	}
+}
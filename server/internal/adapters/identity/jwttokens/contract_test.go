@@ -0,0 +1,15 @@
+package jwttokens
+
+import (
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/store/storetest"
+)
+
+func TestAdapter_SessionContract(t *testing.T) {
+	storetest.ForEach(t, func(t *testing.T, open storetest.Opener) {
+		storetest.RunSessionContract(t, open, func(b storetest.Backend) storetest.SessionStore {
+			return &Adapter{DB: b.DB, Dialect: b.Dialect}
+		})
+	})
+}
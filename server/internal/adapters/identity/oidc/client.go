@@ -0,0 +1,305 @@
+// Package oidc implements the OpenID Connect authorization-code flow with
+// PKCE against one issuer, verifying ID tokens with the issuer's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+const (
+	// jwksRefreshInterval limits refetching the issuer's keys when a token
+	// names an unknown kid, so forged tokens cannot hammer the issuer.
+	jwksRefreshInterval = time.Minute
+	clockLeeway         = time.Minute
+	maxResponseBytes    = 1 << 20
+)
+
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+type Client struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	http         *http.Client
+
+	mu          sync.Mutex
+	discovery   *discoveryDocument
+	keys        map[string]verificationKey
+	keysFetched time.Time
+}
+
+var _ coreid.OIDCProvider = (*Client)(nil)
+
+// New returns a client for issuer. The discovery document and keys are
+// fetched on first use. A nil httpClient uses a client with a 10s timeout.
+func New(issuer, clientID, clientSecret, redirectURL string, scopes []string, httpClient *http.Client) *Client {
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{
+		issuer:       strings.TrimRight(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		http:         httpClient,
+	}
+}
+
+func (c *Client) Issuer() string { return c.issuer }
+
+func (c *Client) AuthorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", c.clientID)
+	q.Set("redirect_uri", c.redirectURL)
+	q.Set("scope", strings.Join(c.scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems code at the token endpoint and verifies the returned ID
+// token. Provider-side rejections are reported as
+// ErrInvalidExternalIdentity; transport failures are returned as they are.
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier, nonce string) (coreid.ExternalIdentity, error) {
+	doc, err := c.discover(ctx)
+	if err != nil {
+		return coreid.ExternalIdentity{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.redirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {c.clientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return coreid.ExternalIdentity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return coreid.ExternalIdentity{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return coreid.ExternalIdentity{}, err
+	}
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &token)
+	if resp.StatusCode != http.StatusOK {
+		if token.Error != "" {
+			return coreid.ExternalIdentity{}, fmt.Errorf("%w: %s", coreid.ErrInvalidExternalIdentity, token.Error)
+		}
+		return coreid.ExternalIdentity{}, fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+	if token.IDToken == "" {
+		return coreid.ExternalIdentity{}, fmt.Errorf("%w: no id_token", coreid.ErrInvalidExternalIdentity)
+	}
+	return c.verifyIDToken(ctx, token.IDToken, nonce)
+}
+
+type idTokenClaims struct {
+	Nonce             string       `json:"nonce"`
+	AuthorizedParty   string       `json:"azp"`
+	Email             string       `json:"email"`
+	EmailVerified     flexibleBool `json:"email_verified"`
+	PreferredUsername string       `json:"preferred_username"`
+	Name              string       `json:"name"`
+	AMR               []string     `json:"amr"`
+	jwt.RegisteredClaims
+}
+
+// flexibleBool accepts true and "true": some providers send email_verified
+// as a string.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+func (c *Client) verifyIDToken(ctx context.Context, raw, nonce string) (coreid.ExternalIdentity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := c.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.alg {
+			return nil, errors.New("id token alg does not match key")
+		}
+		return key.public, nil
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(c.issuer),
+		jwt.WithAudience(c.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockLeeway),
+	)
+	if err != nil {
+		return coreid.ExternalIdentity{}, fmt.Errorf("%w: %v", coreid.ErrInvalidExternalIdentity, err)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return coreid.ExternalIdentity{}, fmt.Errorf("%w: nonce mismatch", coreid.ErrInvalidExternalIdentity)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != c.clientID {
+		return coreid.ExternalIdentity{}, fmt.Errorf("%w: azp mismatch", coreid.ErrInvalidExternalIdentity)
+	}
+	return coreid.ExternalIdentity{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     bool(claims.EmailVerified),
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+		AMR:               claims.AMR,
+	}, nil
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func (c *Client) discover(ctx context.Context) (*discoveryDocument, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+	var doc discoveryDocument
+	if err := c.getJSON(ctx, c.issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != c.issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", doc.Issuer, c.issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: missing endpoints")
+	}
+	c.discovery = &doc
+	return c.discovery, nil
+}
+
+// key returns the issuer key named kid, refetching the JWKS at most once a
+// minute when kid is unknown so provider key rotation is picked up.
+func (c *Client) key(ctx context.Context, kid string) (verificationKey, error) {
+	doc, err := c.discover(ctx)
+	if err != nil {
+		return verificationKey{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+	if !c.keysFetched.IsZero() && time.Since(c.keysFetched) < jwksRefreshInterval {
+		return verificationKey{}, errors.New("unknown id token signing key")
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := c.getJSON(ctx, doc.JWKSURI, &set); err != nil {
+		return verificationKey{}, fmt.Errorf("oidc jwks: %w", err)
+	}
+	c.keys = make(map[string]verificationKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.verificationKey()
+		if err != nil {
+			continue
+		}
+		c.keys[jwk.KID] = key
+	}
+	c.keysFetched = time.Now()
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+	return verificationKey{}, errors.New("unknown id token signing key")
+}
+
+// lookupKey accepts a missing kid only when the issuer publishes exactly one
+// key.
+func (c *Client) lookupKey(kid string) (verificationKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+func (c *Client) getJSON(ctx context.Context, endpoint string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(out)
+}
+
+type verificationKey struct {
+	alg    string
+	public crypto.PublicKey
+}
@@ -0,0 +1,116 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/oidc/oidctest"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+const (
+	testRedirect = "http://localhost:5173/oidc/callback"
+	testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func testChallenge() string {
+	sum := sha256.Sum256([]byte(testVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func newTestProvider(t *testing.T) (*oidctest.Server, *Client) {
+	t.Helper()
+	idp, err := oidctest.New("chat-app", "chat-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+	idp.SetUser(oidctest.User{Subject: "staff-1", Email: "alice@corp.example", EmailVerified: true, PreferredUsername: "alice", Name: "Alice", AMR: []string{"pwd", "mfa"}})
+	return idp, New(idp.URL, "chat-app", "chat-secret", testRedirect, nil, idp.Client())
+}
+
+func authorize(t *testing.T, idp *oidctest.Server, c *Client, nonce string) string {
+	t.Helper()
+	authURL, err := c.AuthorizationURL(context.Background(), "state-1", nonce, testChallenge())
+	if err != nil {
+		t.Fatalf("AuthorizationURL error: %v", err)
+	}
+	code, state, err := idp.Authorize(authURL)
+	if err != nil || state != "state-1" {
+		t.Fatalf("Authorize = %q, %q, %v", code, state, err)
+	}
+	return code
+}
+
+func TestClient_AuthorizationCodeFlowWithPKCE(t *testing.T) {
+	idp, c := newTestProvider(t)
+	ctx := context.Background()
+
+	authURL, err := c.AuthorizationURL(ctx, "state-1", "nonce-1", testChallenge())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("redirect_uri") != testRedirect || q.Get("scope") != "openid email profile" {
+		t.Fatalf("authorization URL = %s", authURL)
+	}
+
+	ident, err := c.Exchange(ctx, authorize(t, idp, c, "nonce-1"), testVerifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange error: %v", err)
+	}
+	want := coreid.ExternalIdentity{Issuer: idp.URL, Subject: "staff-1", Email: "alice@corp.example", EmailVerified: true, PreferredUsername: "alice", Name: "Alice", AMR: []string{"pwd", "mfa"}}
+	if !reflect.DeepEqual(ident, want) {
+		t.Fatalf("identity = %+v, want %+v", ident, want)
+	}
+
+	code := authorize(t, idp, c, "nonce-2")
+	if _, err := c.Exchange(ctx, code, "wrong-verifier-wrong-verifier-wrong-verifier", "nonce-2"); !errors.Is(err, coreid.ErrInvalidExternalIdentity) {
+		t.Fatalf("wrong PKCE verifier err = %v", err)
+	}
+	if _, err := c.Exchange(ctx, code, testVerifier, "nonce-2"); !errors.Is(err, coreid.ErrInvalidExternalIdentity) {
+		t.Fatalf("reused code err = %v", err)
+	}
+}
+
+func TestClient_RejectsBadIDTokens(t *testing.T) {
+	idp, c := newTestProvider(t)
+	ctx := context.Background()
+
+	for name, tamper := range map[string]func(jwt.MapClaims){
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = 1 },
+		"wrong nonce":    func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+		"foreign azp": func(c jwt.MapClaims) {
+			c["aud"] = []string{"chat-app", "other"}
+			c["azp"] = "other"
+		},
+	} {
+		idp.TamperClaims = tamper
+		if _, err := c.Exchange(ctx, authorize(t, idp, c, "nonce"), testVerifier, "nonce"); !errors.Is(err, coreid.ErrInvalidExternalIdentity) {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+
+	idp.TamperClaims = nil
+	wrongSecret := New(idp.URL, "chat-app", "not-the-secret", testRedirect, nil, idp.Client())
+	if _, err := wrongSecret.Exchange(ctx, authorize(t, idp, wrongSecret, "nonce"), testVerifier, "nonce"); !errors.Is(err, coreid.ErrInvalidExternalIdentity) {
+		t.Fatalf("wrong client secret err = %v", err)
+	}
+}
+
+func TestClient_DiscoveryRejectsIssuerMismatch(t *testing.T) {
+	idp, _ := newTestProvider(t)
+	c := New(idp.URL+"/tenant", "chat-app", "chat-secret", testRedirect, nil, idp.Client())
+	if _, err := c.AuthorizationURL(context.Background(), "s", "n", testChallenge()); err == nil {
+		t.Fatal("expected discovery against the wrong issuer to fail")
+	}
+}
@@ -0,0 +1,83 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// minRSABits rejects provider keys too short to trust.
+const minRSABits = 2048
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	KID string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// verificationKey maps a JWK to the one JWS algorithm it may verify: RSA
+// keys RS256, P-256 keys ES256 and Ed25519 keys EdDSA.
+func (k jsonWebKey) verificationKey() (verificationKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		if n.BitLen() < minRSABits || !e.IsInt64() || e.Int64() < 3 {
+			return verificationKey{}, errors.New("weak RSA key")
+		}
+		return verificationKey{alg: "RS256", public: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return verificationKey{}, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if _, err := pub.ECDH(); err != nil {
+			return verificationKey{}, errors.New("EC point is not on P-256")
+		}
+		return verificationKey{alg: "ES256", public: pub}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return verificationKey{}, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return verificationKey{}, errors.New("invalid Ed25519 key")
+		}
+		return verificationKey{alg: "EdDSA", public: ed25519.PublicKey(x)}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(raw) == 0 {
+		return nil, errors.New("invalid JWK integer")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
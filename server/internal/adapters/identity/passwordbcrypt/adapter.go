@@ -9,3 +9,7 @@ type Verifier struct{}
 func (Verifier) VerifyPassword(password, hash string) bool {
 	return crypto.CheckPasswordHash(password, hash)
 }
+
+func (Verifier) HashPassword(password string) (string, error) {
+	return crypto.HashPassword(password)
+}
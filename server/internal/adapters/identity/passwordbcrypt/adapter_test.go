@@ -20,3 +20,14 @@ func TestVerifier_VerifyPassword(t *testing.T) {
 		t.Fatal("expected password verification to fail")
 	}
 }
+
+func TestVerifier_HashPasswordRoundTrip(t *testing.T) {
+	v := Verifier{}
+	hash, err := v.HashPassword("new-secret-1")
+	if err != nil {
+		t.Fatalf("HashPassword error: %v", err)
+	}
+	if !v.VerifyPassword("new-secret-1", hash) || v.VerifyPassword("password123", hash) {
+		t.Fatal("expected hash to verify only the hashed password")
+	}
+}
@@ -0,0 +1,72 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 test key from RFC 6238 appendix B, base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestProvider_MatchesRFC6238Vectors(t *testing.T) {
+	p := Provider{Period: 30 * time.Second, Digits: 8}
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+	} {
+		at := time.Unix(tc.unix, 0)
+		got, err := p.Code(rfc6238Secret, at)
+		if err != nil {
+			t.Fatalf("Code error: %v", err)
+		}
+		if got != tc.code {
+			t.Fatalf("Code(%d) = %s, want %s", tc.unix, got, tc.code)
+		}
+		if step, ok := p.MatchStep(rfc6238Secret, tc.code, at); !ok || step != tc.unix/30 {
+			t.Fatalf("MatchStep(%d) = %d, %v", tc.unix, step, ok)
+		}
+	}
+}
+
+func TestProvider_MatchStepAllowsConfiguredSkewOnly(t *testing.T) {
+	p := New("chat")
+	secret, err := p.NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret error: %v", err)
+	}
+	now := time.Unix(1_700_000_010, 0)
+	previous, _ := p.Code(secret, now.Add(-30*time.Second))
+	stale, _ := p.Code(secret, now.Add(-90*time.Second))
+
+	if step, ok := p.MatchStep(secret, previous, now); !ok || step != now.Unix()/30-1 {
+		t.Fatalf("previous step match = %d, %v", step, ok)
+	}
+	if _, ok := p.MatchStep(secret, stale, now); ok {
+		t.Fatal("expected code outside the skew window to be rejected")
+	}
+	if _, ok := p.MatchStep(secret, "12345", now); ok {
+		t.Fatal("expected short code to be rejected")
+	}
+}
+
+func TestProvider_ProvisioningURI(t *testing.T) {
+	p := New("Go Chat")
+	raw := p.ProvisioningURI("ABCDEF", "alice smith")
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse uri: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Go Chat:alice smith" {
+		t.Fatalf("unexpected uri %q", raw)
+	}
+	q := u.Query()
+	if q.Get("secret") != "ABCDEF" || q.Get("issuer") != "Go Chat" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Fatalf("unexpected query %v", q)
+	}
+}
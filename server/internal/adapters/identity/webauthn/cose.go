@@ -0,0 +1,94 @@
+package webauthn
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithm identifiers accepted for passkeys.
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+)
+
+const (
+	coseKeyType   int64 = 1
+	coseAlgorithm int64 = 3
+	coseCurve     int64 = -1
+	coseX         int64 = -2
+	coseY         int64 = -3
+
+	coseKeyTypeOKP   int64 = 1
+	coseKeyTypeEC2   int64 = 2
+	coseCurveP256    int64 = 1
+	coseCurveEd25519 int64 = 6
+)
+
+var errUnsupportedKey = errors.New("unsupported credential public key")
+
+type credentialPublicKey struct {
+	alg     int64
+	ecdsa   *ecdsa.PublicKey
+	ed25519 ed25519.PublicKey
+}
+
+// parseCOSEKey accepts ES256 keys on P-256 and Ed25519 keys; everything else,
+// including RS256, is rejected at registration.
+func parseCOSEKey(raw []byte) (credentialPublicKey, error) {
+	v, n, err := decodeCBOR(raw)
+	if err != nil {
+		return credentialPublicKey{}, err
+	}
+	if n != len(raw) {
+		return credentialPublicKey{}, errMalformedCBOR
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return credentialPublicKey{}, errMalformedCBOR
+	}
+	kty, _ := m[coseKeyType].(int64)
+	alg, _ := m[coseAlgorithm].(int64)
+	crv, _ := m[coseCurve].(int64)
+	x, _ := m[coseX].([]byte)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256 && crv == coseCurveP256:
+		y, _ := m[coseY].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return credentialPublicKey{}, errUnsupportedKey
+		}
+		point := append(append([]byte{0x04}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return credentialPublicKey{}, errUnsupportedKey
+		}
+		return credentialPublicKey{alg: alg, ecdsa: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA && crv == coseCurveEd25519:
+		if len(x) != ed25519.PublicKeySize {
+			return credentialPublicKey{}, errUnsupportedKey
+		}
+		return credentialPublicKey{alg: alg, ed25519: ed25519.PublicKey(x)}, nil
+	default:
+		return credentialPublicKey{}, errUnsupportedKey
+	}
+}
+
+func (k credentialPublicKey) verify(message, signature []byte) bool {
+	switch k.alg {
+	case AlgES256:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(k.ecdsa, digest[:], signature)
+	case AlgEdDSA:
+		return ed25519.Verify(k.ed25519, message, signature)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,212 @@
+package webauthn
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+const (
+	flagUserPresent  byte = 0x01
+	flagUserVerified byte = 0x04
+	flagAttestedData byte = 0x40
+	flagExtensions   byte = 0x80
+
+	maxCredentialIDLength = 1023
+)
+
+// Verifier checks WebAuthn registration and assertion ceremonies for one
+// relying party. User verification is always required because passkeys
+// replace the password rather than supplementing it. Attestation statements
+// are not verified: registration requests "none" conveyance, so the
+// credential is trusted the same way a password set over TLS is.
+type Verifier struct {
+	RPID    string
+	RPName  string
+	Origins []string
+}
+
+var _ coreid.PasskeyVerifier = (*Verifier)(nil)
+
+func New(rpID, rpName string, origins []string) *Verifier {
+	return &Verifier{RPID: rpID, RPName: rpName, Origins: origins}
+}
+
+func (v *Verifier) RelyingParty() coreid.RelyingParty {
+	return coreid.RelyingParty{ID: v.RPID, Name: v.RPName}
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (v *Verifier) ClientChallenge(clientDataJSON []byte) (string, error) {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return "", invalid("client data is not JSON")
+	}
+	return cd.Challenge, nil
+}
+
+func (v *Verifier) VerifyRegistration(challenge string, resp coreid.PasskeyAttestation) (coreid.PasskeyCredential, error) {
+	if err := v.verifyClientData(resp.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return coreid.PasskeyCredential{}, err
+	}
+
+	decoded, n, err := decodeCBOR(resp.AttestationObject)
+	if err != nil || n != len(resp.AttestationObject) {
+		return coreid.PasskeyCredential{}, invalid("malformed attestation object")
+	}
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return coreid.PasskeyCredential{}, invalid("malformed attestation object")
+	}
+	if _, ok := attestation["fmt"].(string); !ok {
+		return coreid.PasskeyCredential{}, invalid("attestation format missing")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return coreid.PasskeyCredential{}, invalid("authenticator data missing")
+	}
+
+	authData, err := v.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return coreid.PasskeyCredential{}, err
+	}
+	if authData.flags&flagAttestedData == 0 || authData.credentialID == nil {
+		return coreid.PasskeyCredential{}, invalid("attested credential data missing")
+	}
+	if len(resp.CredentialID) > 0 && subtle.ConstantTimeCompare(resp.CredentialID, authData.credentialID) != 1 {
+		return coreid.PasskeyCredential{}, invalid("credential id mismatch")
+	}
+	key, err := parseCOSEKey(authData.publicKey)
+	if err != nil {
+		return coreid.PasskeyCredential{}, invalid(err.Error())
+	}
+
+	return coreid.PasskeyCredential{
+		ID:        base64.RawURLEncoding.EncodeToString(authData.credentialID),
+		PublicKey: authData.publicKey,
+		Algorithm: key.alg,
+		SignCount: authData.signCount,
+		AAGUID:    hex.EncodeToString(authData.aaguid),
+	}, nil
+}
+
+// VerifyAssertion checks the signature over authenticatorData and the client
+// data hash and returns the authenticator's signature counter. Counter policy
+// belongs to the caller.
+func (v *Verifier) VerifyAssertion(challenge string, resp coreid.PasskeyAssertion, publicKey []byte) (uint32, error) {
+	if err := v.verifyClientData(resp.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	authData, err := v.parseAuthenticatorData(resp.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return 0, invalid(err.Error())
+	}
+	clientDataHash := sha256.Sum256(resp.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, resp.Signature) {
+		return 0, invalid("signature verification failed")
+	}
+	return authData.signCount, nil
+}
+
+func (v *Verifier) verifyClientData(raw []byte, wantType, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return invalid("client data is not JSON")
+	}
+	if cd.Type != wantType {
+		return invalid("unexpected client data type")
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return invalid("challenge mismatch")
+	}
+	if cd.CrossOrigin {
+		return invalid("cross-origin ceremonies are not allowed")
+	}
+	for _, origin := range v.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return invalid("origin not allowed")
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+func (v *Verifier) parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, invalid("authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(v.RPID))
+	if subtle.ConstantTimeCompare(data[:32], rpIDHash[:]) != 1 {
+		return authenticatorData{}, invalid("relying party id mismatch")
+	}
+	out := authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if out.flags&flagUserPresent == 0 {
+		return authenticatorData{}, invalid("user presence flag not set")
+	}
+	if out.flags&flagUserVerified == 0 {
+		return authenticatorData{}, invalid("user verification flag not set")
+	}
+
+	rest := data[37:]
+	if out.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return authenticatorData{}, invalid("attested credential data truncated")
+		}
+		out.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > maxCredentialIDLength || idLen > len(rest) {
+			return authenticatorData{}, invalid("invalid credential id length")
+		}
+		out.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, invalid("malformed credential public key")
+		}
+		out.publicKey = append([]byte(nil), rest[:n]...)
+		rest = rest[n:]
+	}
+	if out.flags&flagExtensions != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, invalid("malformed extensions")
+		}
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return authenticatorData{}, invalid("trailing authenticator data")
+	}
+	return out, nil
+}
+
+func invalid(reason string) error {
+	return fmt.Errorf("%w: %s", coreid.ErrInvalidPasskeyAssertion, reason)
+}
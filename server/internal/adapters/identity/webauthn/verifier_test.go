@@ -0,0 +1,122 @@
+package webauthn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/webauthn/webauthntest"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+const (
+	testRPID   = "chat.example"
+	testOrigin = "https://chat.example"
+)
+
+func TestVerifier_RegistrationAndAssertion(t *testing.T) {
+	for _, alg := range []int64{webauthntest.AlgES256, webauthntest.AlgEdDSA} {
+		v := New(testRPID, "Chat", []string{testOrigin})
+		authn := webauthntest.New(testRPID, testOrigin)
+		authn.Algorithm = alg
+
+		att, err := authn.Register("reg-challenge", []byte("handle"))
+		if err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		if got, _ := v.ClientChallenge(att.ClientDataJSON); got != "reg-challenge" {
+			t.Fatalf("ClientChallenge = %q", got)
+		}
+		cred, err := v.VerifyRegistration("reg-challenge", att)
+		if err != nil {
+			t.Fatalf("alg %d VerifyRegistration: %v", alg, err)
+		}
+		if cred.Algorithm != alg || cred.ID == "" || len(cred.PublicKey) == 0 {
+			t.Fatalf("credential = %+v", cred)
+		}
+
+		assertion, err := authn.Assert("login-challenge")
+		if err != nil {
+			t.Fatalf("Assert: %v", err)
+		}
+		count, err := v.VerifyAssertion("login-challenge", assertion, cred.PublicKey)
+		if err != nil {
+			t.Fatalf("alg %d VerifyAssertion: %v", alg, err)
+		}
+		if count != 1 {
+			t.Fatalf("sign count = %d, want 1", count)
+		}
+
+		assertion.Signature[len(assertion.Signature)-1] ^= 0xff
+		if _, err := v.VerifyAssertion("login-challenge", assertion, cred.PublicKey); !errors.Is(err, coreid.ErrInvalidPasskeyAssertion) {
+			t.Fatalf("tampered signature err = %v", err)
+		}
+	}
+}
+
+func TestVerifier_RejectsCeremonyMismatches(t *testing.T) {
+	v := New(testRPID, "Chat", []string{testOrigin})
+	authn := webauthntest.New(testRPID, testOrigin)
+	att, err := authn.Register("challenge", []byte("handle"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := v.VerifyRegistration("challenge", att)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func() error{
+		"wrong challenge": func() error {
+			_, err := v.VerifyRegistration("other", att)
+			return err
+		},
+		"wrong origin": func() error {
+			evil := webauthntest.New(testRPID, "https://evil.example")
+			att, _ := evil.Register("challenge", nil)
+			_, err := v.VerifyRegistration("challenge", att)
+			return err
+		},
+		"wrong rp id": func() error {
+			other := webauthntest.New("evil.example", testOrigin)
+			att, _ := other.Register("challenge", nil)
+			_, err := v.VerifyRegistration("challenge", att)
+			return err
+		},
+		"no user verification": func() error {
+			authn.Flags = 0x01
+			defer func() { authn.Flags = 0 }()
+			assertion, _ := authn.Assert("challenge")
+			_, err := v.VerifyAssertion("challenge", assertion, cred.PublicKey)
+			return err
+		},
+		"registration replayed as assertion": func() error {
+			_, err := v.VerifyAssertion("challenge", coreid.PasskeyAssertion{ClientDataJSON: att.ClientDataJSON}, cred.PublicKey)
+			return err
+		},
+		"truncated attestation": func() error {
+			att := att
+			att.AttestationObject = att.AttestationObject[:len(att.AttestationObject)-5]
+			_, err := v.VerifyRegistration("challenge", att)
+			return err
+		},
+	}
+	for name, run := range cases {
+		if err := run(); !errors.Is(err, coreid.ErrInvalidPasskeyAssertion) {
+			t.Fatalf("%s: err = %v, want ErrInvalidPasskeyAssertion", name, err)
+		}
+	}
+}
+
+func TestDecodeCBOR_RejectsHostileInput(t *testing.T) {
+	for name, input := range map[string][]byte{
+		"indefinite map":    {0xbf, 0xff},
+		"huge byte string":  {0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"huge array":        {0x9a, 0xff, 0xff, 0xff, 0xff},
+		"float":             {0xfa, 0, 0, 0, 0},
+		"duplicate map key": {0xa2, 0x01, 0x01, 0x01, 0x02},
+	} {
+		if _, _, err := decodeCBOR(input); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
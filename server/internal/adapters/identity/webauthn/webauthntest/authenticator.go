@@ -0,0 +1,195 @@
+// Package webauthntest provides a software WebAuthn authenticator for tests.
+package webauthntest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+)
+
+// Authenticator behaves like a platform passkey provider: it creates
+// discoverable credentials, always asserts user presence and verification,
+// and increments a per-credential signature counter on every assertion.
+type Authenticator struct {
+	RPID      string
+	Origin    string
+	Algorithm int64
+	// ZeroCounter makes the authenticator report a zero counter, like synced
+	// passkeys do.
+	ZeroCounter bool
+	// Flags overrides the authenticator data flags when non-zero.
+	Flags byte
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	userHandle []byte
+	alg        int64
+	signer     crypto.Signer
+	signCount  uint32
+}
+
+func New(rpID, origin string) *Authenticator {
+	return &Authenticator{RPID: rpID, Origin: origin, Algorithm: AlgES256}
+}
+
+// Register answers navigator.credentials.create with "none" attestation.
+func (a *Authenticator) Register(challenge string, userHandle []byte) (coreid.PasskeyAttestation, error) {
+	cred := &credential{id: make([]byte, 16), userHandle: userHandle, alg: a.Algorithm}
+	if _, err := rand.Read(cred.id); err != nil {
+		return coreid.PasskeyAttestation{}, err
+	}
+	var coseKey map[int64]any
+	switch a.Algorithm {
+	case AlgEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return coreid.PasskeyAttestation{}, err
+		}
+		cred.signer = priv
+		coseKey = map[int64]any{1: 1, 3: AlgEdDSA, -1: 6, -2: []byte(pub)}
+	default:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return coreid.PasskeyAttestation{}, err
+		}
+		cred.alg = AlgES256
+		cred.signer = priv
+		coseKey = map[int64]any{1: 2, 3: AlgES256, -1: 1, -2: pad32(priv.X.Bytes()), -3: pad32(priv.Y.Bytes())}
+	}
+	a.credentials = append(a.credentials, cred)
+
+	attested := make([]byte, 0, 128)
+	attested = append(attested, make([]byte, 16)...)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(cred.id)))
+	attested = append(attested, cred.id...)
+	attested = append(attested, Encode(coseKey)...)
+	authData := a.authenticatorData(0x40, 0, attested)
+
+	return coreid.PasskeyAttestation{
+		CredentialID:      cred.id,
+		ClientDataJSON:    a.ClientDataJSON("webauthn.create", challenge),
+		AttestationObject: Encode(map[string]any{"fmt": "none", "attStmt": map[string]any{}, "authData": authData}),
+	}, nil
+}
+
+// Assert answers navigator.credentials.get with the most recently registered
+// credential, as a discoverable-credential prompt would.
+func (a *Authenticator) Assert(challenge string) (coreid.PasskeyAssertion, error) {
+	if len(a.credentials) == 0 {
+		return coreid.PasskeyAssertion{}, errors.New("no credentials registered")
+	}
+	cred := a.credentials[len(a.credentials)-1]
+	if !a.ZeroCounter {
+		cred.signCount++
+	}
+	counter := cred.signCount
+	if a.ZeroCounter {
+		counter = 0
+	}
+	authData := a.authenticatorData(0, counter, nil)
+	clientDataJSON := a.ClientDataJSON("webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authData...), clientDataHash[:]...)
+
+	var signature []byte
+	var err error
+	if cred.alg == AlgEdDSA {
+		signature, err = cred.signer.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(signed)
+		signature, err = cred.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return coreid.PasskeyAssertion{}, err
+	}
+	return coreid.PasskeyAssertion{
+		CredentialID:      cred.id,
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		UserHandle:        cred.userHandle,
+	}, nil
+}
+
+// SetSignCount rewinds or advances the counter of the latest credential, to
+// simulate a cloned authenticator.
+func (a *Authenticator) SetSignCount(n uint32) {
+	if len(a.credentials) > 0 {
+		a.credentials[len(a.credentials)-1].signCount = n
+	}
+}
+
+func (a *Authenticator) ClientDataJSON(typ, challenge string) []byte {
+	raw, _ := json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return raw
+}
+
+func (a *Authenticator) authenticatorData(extraFlags byte, signCount uint32, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	flags := a.Flags
+	if flags == 0 {
+		flags = 0x01 | 0x04
+	}
+	out := append([]byte(nil), rpIDHash[:]...)
+	out = append(out, flags|extraFlags)
+	out = binary.BigEndian.AppendUint32(out, signCount)
+	return append(out, attested...)
+}
+
+// RegistrationJSON renders an attestation the way PublicKeyCredential.toJSON does.
+func RegistrationJSON(att coreid.PasskeyAttestation) map[string]any {
+	id := base64.RawURLEncoding.EncodeToString(att.CredentialID)
+	return map[string]any{
+		"id":    id,
+		"rawId": id,
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(att.ClientDataJSON),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(att.AttestationObject),
+		},
+	}
+}
+
+// AssertionJSON renders an assertion the way PublicKeyCredential.toJSON does.
+func AssertionJSON(assertion coreid.PasskeyAssertion) map[string]any {
+	id := base64.RawURLEncoding.EncodeToString(assertion.CredentialID)
+	return map[string]any{
+		"id":    id,
+		"rawId": id,
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(assertion.ClientDataJSON),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(assertion.AuthenticatorData),
+			"signature":         base64.RawURLEncoding.EncodeToString(assertion.Signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(assertion.UserHandle),
+		},
+	}
+}
+
+func pad32(b []byte) []byte {
+	out := make([]byte, 32)
+	copy(out[32-len(b):], b)
+	return out
+}
@@ -0,0 +1,77 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Encode writes the CBOR subset authenticators emit: integers, byte and text
+// strings, and maps with int64 or string keys. Map keys are written in
+// length-then-bytewise order as CTAP2 canonical encoding requires.
+func Encode(v any) []byte {
+	var out []byte
+	switch val := v.(type) {
+	case int:
+		out = encodeInt(int64(val))
+	case int64:
+		out = encodeInt(val)
+	case []byte:
+		out = append(head(2, uint64(len(val))), val...)
+	case string:
+		out = append(head(3, uint64(len(val))), val...)
+	case map[int64]any:
+		entries := make([][2][]byte, 0, len(val))
+		for k, item := range val {
+			entries = append(entries, [2][]byte{encodeInt(k), Encode(item)})
+		}
+		out = encodeMap(entries)
+	case map[string]any:
+		entries := make([][2][]byte, 0, len(val))
+		for k, item := range val {
+			entries = append(entries, [2][]byte{Encode(k), Encode(item)})
+		}
+		out = encodeMap(entries)
+	default:
+		panic(fmt.Sprintf("webauthntest: cannot encode %T", v))
+	}
+	return out
+}
+
+func encodeInt(v int64) []byte {
+	if v < 0 {
+		return head(1, uint64(-1-v))
+	}
+	return head(0, uint64(v))
+}
+
+func encodeMap(entries [][2][]byte) []byte {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i][0], entries[j][0]
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return string(a) < string(b)
+	})
+	out := head(5, uint64(len(entries)))
+	for _, entry := range entries {
+		out = append(out, entry[0]...)
+		out = append(out, entry[1]...)
+	}
+	return out
+}
+
+func head(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+	}
+}
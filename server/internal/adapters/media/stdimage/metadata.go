@@ -0,0 +1,276 @@
+package stdimage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+)
+
+var errMalformedImage = fmt.Errorf("%w: malformed image", coreatt.ErrUnsupportedMimeType)
+
+const (
+	jpegMarkerSOI  = 0xD8
+	jpegMarkerEOI  = 0xD9
+	jpegMarkerSOS  = 0xDA
+	jpegMarkerAPP1 = 0xE1
+
+	exifTagGPSInfo = 0x8825
+)
+
+var (
+	exifHeader   = []byte("Exif\x00\x00")
+	xmpHeader    = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	pngXMPKey    = []byte("XML:com.adobe.xmp\x00")
+)
+
+// stripJPEGLocation copies a JPEG, blanking the EXIF GPS IFD and dropping XMP
+// packets (which can repeat the location). Other EXIF fields such as
+// orientation are kept so images still render the right way up.
+func stripJPEGLocation(dst io.Writer, src io.Reader) error {
+	r := bufio.NewReader(src)
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != jpegMarkerSOI {
+		return errMalformedImage
+	}
+	if _, err := dst.Write(soi[:]); err != nil {
+		return err
+	}
+
+	for {
+		marker, err := readJPEGMarker(r)
+		if err != nil {
+			return err
+		}
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			if _, err := dst.Write([]byte{0xFF, marker}); err != nil {
+				return err
+			}
+			_, err := io.Copy(dst, r)
+			return err
+		}
+		if marker >= 0xD0 && marker <= 0xD7 || marker == 0x01 {
+			if _, err := dst.Write([]byte{0xFF, marker}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var lengthBytes [2]byte
+		if _, err := io.ReadFull(r, lengthBytes[:]); err != nil {
+			return errMalformedImage
+		}
+		length := int(binary.BigEndian.Uint16(lengthBytes[:]))
+		if length < 2 {
+			return errMalformedImage
+		}
+		payload := make([]byte, length-2)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return errMalformedImage
+		}
+
+		if marker == jpegMarkerAPP1 {
+			switch {
+			case bytes.HasPrefix(payload, xmpHeader), bytes.HasPrefix(payload, xmpExtHeader):
+				continue
+			case bytes.HasPrefix(payload, exifHeader):
+				if !scrubEXIFGPS(payload[len(exifHeader):]) {
+					// Unparseable EXIF could still hide a location; drop it.
+					continue
+				}
+			}
+		}
+		if _, err := dst.Write([]byte{0xFF, marker, lengthBytes[0], lengthBytes[1]}); err != nil {
+			return err
+		}
+		if _, err := dst.Write(payload); err != nil {
+			return err
+		}
+	}
+}
+
+func readJPEGMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil || b != 0xFF {
+		return 0, errMalformedImage
+	}
+	for {
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, errMalformedImage
+		}
+		if b != 0xFF {
+			return b, nil
+		}
+	}
+}
+
+// scrubEXIFGPS zeroes the GPS IFD of a TIFF-structured EXIF block in place and
+// reports whether the block could be parsed.
+func scrubEXIFGPS(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+
+	ifd0 := int(order.Uint32(tiff[4:8]))
+	entries, ok := ifdEntries(tiff, order, ifd0)
+	if !ok {
+		return false
+	}
+	for i := 0; i < entries; i++ {
+		entry := ifd0 + 2 + i*12
+		if order.Uint16(tiff[entry:entry+2]) != exifTagGPSInfo {
+			continue
+		}
+		gps := int(order.Uint32(tiff[entry+8 : entry+12]))
+		return zeroIFD(tiff, order, gps)
+	}
+	return true
+}
+
+func ifdEntries(tiff []byte, order binary.ByteOrder, offset int) (int, bool) {
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0, false
+	}
+	n := int(order.Uint16(tiff[offset : offset+2]))
+	if offset+2+n*12 > len(tiff) {
+		return 0, false
+	}
+	return n, true
+}
+
+// zeroIFD clears an IFD's out-of-line values and entries and leaves it with a
+// zero entry count, so readers see an empty directory.
+func zeroIFD(tiff []byte, order binary.ByteOrder, offset int) bool {
+	n, ok := ifdEntries(tiff, order, offset)
+	if !ok {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		entry := tiff[offset+2+i*12:]
+		size := exifTypeSize(order.Uint16(entry[2:4])) * int(order.Uint32(entry[4:8]))
+		if size > 4 {
+			valueOffset := int(order.Uint32(entry[8:12]))
+			if valueOffset < 8 || valueOffset+size > len(tiff) {
+				return false
+			}
+			clear(tiff[valueOffset : valueOffset+size])
+		}
+	}
+	clear(tiff[offset : offset+2+n*12])
+	return true
+}
+
+func exifTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7:
+		return 1
+	case 3, 8:
+		return 2
+	case 4, 9, 11:
+		return 4
+	case 5, 10, 12:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// stripPNGLocation copies a PNG without eXIf and XMP chunks.
+func stripPNGLocation(dst io.Writer, src io.Reader) error {
+	r := bufio.NewReader(src)
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return errMalformedImage
+	}
+	if _, err := dst.Write(signature); err != nil {
+		return err
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return errMalformedImage
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		chunkType := string(header[4:8])
+
+		drop := chunkType == "eXIf"
+		if chunkType == "iTXt" {
+			peek, _ := r.Peek(len(pngXMPKey))
+			drop = bytes.Equal(peek, pngXMPKey)
+		}
+		if drop {
+			if _, err := r.Discard(int(length) + 4); err != nil {
+				return errMalformedImage
+			}
+			continue
+		}
+
+		if _, err := dst.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(dst, r, length+4); err != nil {
+			return errMalformedImage
+		}
+		if chunkType == "IEND" {
+			return nil
+		}
+	}
+}
+
+// stripWebPLocation drops EXIF and XMP chunks from a WebP container and clears
+// the matching VP8X feature flags. WebP has no streaming size-free form, so the
+// file is buffered; uploads are already bounded by the attachment size limit.
+func stripWebPLocation(dst io.Writer, src io.Reader) error {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return errMalformedImage
+	}
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return errMalformedImage
+		}
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size + size%2
+		if end > len(data) {
+			return errMalformedImage
+		}
+		if fourCC != "EXIF" && fourCC != "XMP " {
+			chunk := append([]byte(nil), data[pos:end]...)
+			if fourCC == "VP8X" && len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out = append(out, chunk...)
+		}
+		pos = end
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	_, err = dst.Write(out)
+	return err
+}
@@ -0,0 +1,177 @@
+// Package stdimage implements the attachment image seam with the standard
+// library decoders, so no cgo image toolchain is required.
+package stdimage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+)
+
+const (
+	DefaultThumbnailMaxDim = 320
+	DefaultMaxPixels       = 50_000_000
+
+	placeholderMaxDim     = 32
+	placeholderComponentX = 4
+	placeholderComponentY = 3
+)
+
+// Processor decodes PNG, JPEG and GIF images. WebP is sanitized on upload but
+// not decoded, since the standard library has no WebP decoder.
+type Processor struct {
+	ThumbnailMaxDim int
+	MaxPixels       int
+}
+
+func New() *Processor {
+	return &Processor{ThumbnailMaxDim: DefaultThumbnailMaxDim, MaxPixels: DefaultMaxPixels}
+}
+
+func (p *Processor) Supports(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Processor) Sanitizer(mimeType string) coreatt.Transform {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEGLocation
+	case "image/png":
+		return stripPNGLocation
+	case "image/webp":
+		return stripWebPLocation
+	default:
+		return nil
+	}
+}
+
+func (p *Processor) Analyze(mimeType string, r io.Reader) (coreatt.ImageAnalysis, error) {
+	if !p.Supports(mimeType) {
+		return coreatt.ImageAnalysis{}, coreatt.ErrUnsupportedMimeType
+	}
+	br := bufio.NewReader(r)
+
+	// Check the header first so a tiny file claiming huge dimensions cannot
+	// make the decoder allocate gigabytes.
+	header, err := br.Peek(64 << 10)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return coreatt.ImageAnalysis{}, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(header))
+	if err != nil {
+		return coreatt.ImageAnalysis{}, fmt.Errorf("decode image config: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > p.maxPixels() {
+		return coreatt.ImageAnalysis{}, fmt.Errorf("%w: image is %dx%d", coreatt.ErrTooLarge, cfg.Width, cfg.Height)
+	}
+
+	img, err := decode(mimeType, br)
+	if err != nil {
+		return coreatt.ImageAnalysis{}, fmt.Errorf("decode image: %w", err)
+	}
+	bounds := img.Bounds()
+
+	thumb := downscale(img, p.thumbnailMaxDim())
+	var buf bytes.Buffer
+	thumbnailMimeType := "image/png"
+	if mimeType == "image/jpeg" {
+		thumbnailMimeType = "image/jpeg"
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return coreatt.ImageAnalysis{}, fmt.Errorf("encode thumbnail: %w", err)
+	}
+
+	return coreatt.ImageAnalysis{
+		Width:             bounds.Dx(),
+		Height:            bounds.Dy(),
+		Placeholder:       blurhash(downscale(thumb, placeholderMaxDim), placeholderComponentX, placeholderComponentY),
+		Thumbnail:         buf.Bytes(),
+		ThumbnailMimeType: thumbnailMimeType,
+	}, nil
+}
+
+func (p *Processor) thumbnailMaxDim() int {
+	if p.ThumbnailMaxDim <= 0 {
+		return DefaultThumbnailMaxDim
+	}
+	return p.ThumbnailMaxDim
+}
+
+func (p *Processor) maxPixels() int {
+	if p.MaxPixels <= 0 {
+		return DefaultMaxPixels
+	}
+	return p.MaxPixels
+}
+
+func decode(mimeType string, r io.Reader) (image.Image, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return jpeg.Decode(r)
+	case "image/gif":
+		// Only the first frame is used for thumbnails.
+		return gif.Decode(r)
+	default:
+		return png.Decode(r)
+	}
+}
+
+// downscale box-filters img so neither side exceeds maxDim. Images already
+// within bounds are copied to RGBA unchanged.
+func downscale(img image.Image, maxDim int) *image.RGBA {
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= maxDim && sh <= maxDim {
+		return src
+	}
+	dw, dh := maxDim, maxDim
+	if sw >= sh {
+		dh = max(1, sh*maxDim/sw)
+	} else {
+		dw = max(1, sw*maxDim/sh)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					px := row[sx*4 : sx*4+4]
+					r += int(px[0])
+					g += int(px[1])
+					b += int(px[2])
+					a += int(px[3])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,153 @@
+package stdimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+)
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// exifWithGPS builds a little-endian EXIF APP1 payload whose IFD0 has one
+// orientation entry and a GPS pointer; the GPS IFD holds a latitude rational.
+func exifWithGPS() []byte {
+	le := binary.LittleEndian
+	tiff := make([]byte, 0, 128)
+	tiff = append(tiff, 'I', 'I', 42, 0, 8, 0, 0, 0)
+
+	// IFD0 at 8: two entries, next-IFD 0.
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint16(tiff, 0x0112) // Orientation
+	tiff = le.AppendUint16(tiff, 3)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 6)
+	tiff = le.AppendUint16(tiff, exifTagGPSInfo)
+	tiff = le.AppendUint16(tiff, 4)
+	tiff = le.AppendUint32(tiff, 1)
+	gpsOffset := len(tiff) + 4 + 4
+	tiff = le.AppendUint32(tiff, uint32(gpsOffset))
+	tiff = le.AppendUint32(tiff, 0)
+
+	// GPS IFD: one GPSLatitude entry (3 rationals stored out of line).
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = le.AppendUint16(tiff, 0x0002)
+	tiff = le.AppendUint16(tiff, 5)
+	tiff = le.AppendUint32(tiff, 3)
+	tiff = le.AppendUint32(tiff, uint32(gpsOffset+2+12+4))
+	tiff = le.AppendUint32(tiff, 0)
+	for _, v := range []uint32{51, 1, 30, 1, 2647, 100} {
+		tiff = le.AppendUint32(tiff, v)
+	}
+	return append(append([]byte(nil), exifHeader...), tiff...)
+}
+
+func insertJPEGSegment(t *testing.T, jpg []byte, marker byte, payload []byte) []byte {
+	t.Helper()
+	if jpg[0] != 0xFF || jpg[1] != jpegMarkerSOI {
+		t.Fatal("not a jpeg")
+	}
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	out := append([]byte{0xFF, jpegMarkerSOI}, segment...)
+	out = append(out, payload...)
+	return append(out, jpg[2:]...)
+}
+
+func TestSanitizer_JPEGScrubsGPSAndDropsXMP(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(16, 16), nil); err != nil {
+		t.Fatal(err)
+	}
+	src := insertJPEGSegment(t, buf.Bytes(), jpegMarkerAPP1, append(append([]byte(nil), xmpHeader...), "<x:xmpmeta>exif:GPSLatitude</x:xmpmeta>"...))
+	src = insertJPEGSegment(t, src, jpegMarkerAPP1, exifWithGPS())
+
+	var out bytes.Buffer
+	if err := New().Sanitizer("image/jpeg")(&out, bytes.NewReader(src)); err != nil {
+		t.Fatalf("sanitize: %v", err)
+	}
+	got := out.Bytes()
+	if bytes.Contains(got, xmpHeader) {
+		t.Fatal("expected XMP segment to be dropped")
+	}
+	if !bytes.Contains(got, exifHeader) {
+		t.Fatal("expected EXIF segment to be kept")
+	}
+	lat := binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, 2647), 100)
+	if bytes.Contains(got, lat) {
+		t.Fatal("expected GPS latitude to be zeroed")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(got)); err != nil {
+		t.Fatalf("sanitized jpeg no longer decodes: %v", err)
+	}
+}
+
+func TestSanitizer_PNGDropsEXIFChunk(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(8, 8)); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.Bytes()
+	// Insert an eXIf chunk right after IHDR (8 signature + 25 IHDR bytes).
+	chunk := binary.BigEndian.AppendUint32(nil, 4)
+	chunk = append(chunk, "eXIfGPS!"...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	withExif := append(append(append([]byte(nil), src[:33]...), chunk...), src[33:]...)
+
+	var out bytes.Buffer
+	if err := New().Sanitizer("image/png")(&out, bytes.NewReader(withExif)); err != nil {
+		t.Fatalf("sanitize: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), src) {
+		t.Fatal("expected sanitized png to equal the original without eXIf")
+	}
+
+	if err := New().Sanitizer("image/png")(&out, bytes.NewReader([]byte("not a png"))); !errors.Is(err, coreatt.ErrUnsupportedMimeType) {
+		t.Fatalf("malformed err = %v, want ErrUnsupportedMimeType", err)
+	}
+}
+
+func TestProcessor_AnalyzeThumbnailAndPlaceholder(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(800, 400)); err != nil {
+		t.Fatal(err)
+	}
+	p := &Processor{ThumbnailMaxDim: 100}
+	result, err := p.Analyze("image/png", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if result.Width != 800 || result.Height != 400 {
+		t.Fatalf("dimensions = %dx%d, want 800x400", result.Width, result.Height)
+	}
+	thumb, err := png.Decode(bytes.NewReader(result.Thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail decode: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Fatalf("thumbnail = %dx%d, want 100x50", b.Dx(), b.Dy())
+	}
+	// 4x3 components: 1 size + 1 max AC + 4 DC + 2*11 AC characters.
+	if len(result.Placeholder) != 28 {
+		t.Fatalf("placeholder %q has length %d, want 28", result.Placeholder, len(result.Placeholder))
+	}
+
+	p.MaxPixels = 1000
+	if _, err := p.Analyze("image/png", bytes.NewReader(buf.Bytes())); !errors.Is(err, coreatt.ErrTooLarge) {
+		t.Fatalf("oversized err = %v, want ErrTooLarge", err)
+	}
+}
@@ -0,0 +1,58 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	coredigest "github.com/kyambuthia/go-chat-site/server/internal/core/digest"
+)
+
+// DropSender writes each message to its own .eml file instead of sending it.
+// It stands in for a relay during development. Verification mail carries
+// live tokens, so the directory is 0700 and the files are 0600.
+type DropSender struct {
+	Dir  string
+	From string
+}
+
+var _ coredigest.Mailer = (*DropSender)(nil)
+
+func NewDrop(dir, from string) (*DropSender, error) {
+	if dir == "" {
+		return nil, errors.New("mail drop directory is required")
+	}
+	if from == "" {
+		from = "notifications@localhost"
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DropSender{Dir: dir, From: from}, nil
+}
+
+func (d *DropSender) Send(_ context.Context, m coredigest.Mail) error {
+	now := time.Now()
+	msg, err := render(d.From, m, now)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := now.UTC().Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix) + ".eml"
+	f, err := os.OpenFile(filepath.Join(d.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(msg); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,211 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	coredigest "github.com/kyambuthia/go-chat-site/server/internal/core/digest"
+)
+
+type received struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP accepts one plaintext session per connection and reports each
+// message it receives.
+func fakeSMTP(t *testing.T) (string, <-chan received) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	out := make(chan received, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, out)
+		}
+	}()
+	return ln.Addr().String(), out
+}
+
+func serveSMTP(conn net.Conn, out chan<- received) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+	var msg received
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH PLAIN "):
+			raw, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			msg.auth = string(raw)
+			reply("235 ok")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.data = b.String()
+			out <- msg
+			msg = received{}
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func readBody(t *testing.T, raw string) (*mail.Message, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg, string(body)
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	addr, inbox := fakeSMTP(t)
+	sender, err := NewSMTP(SMTPConfig{Addr: addr, Username: "relay-user", Password: "relay-pass", From: "Chat <notify@example.com>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "Unread messages:\n- bob: 2 unread messages\n.\n" + strings.Repeat("long ", 40) + "\n"
+	if err := sender.Send(context.Background(), coredigest.Mail{To: "alice@example.com", Subject: "Grüße from chat", Text: text}); err != nil {
+		t.Fatal(err)
+	}
+	got := <-inbox
+	if got.from != "notify@example.com" || len(got.to) != 1 || got.to[0] != "alice@example.com" {
+		t.Fatalf("envelope = %+v", got)
+	}
+	if got.auth != "\x00relay-user\x00relay-pass" {
+		t.Fatalf("auth = %q", got.auth)
+	}
+	msg, body := readBody(t, got.data)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Grüße from chat" {
+		t.Fatalf("subject = %q, %v", subject, err)
+	}
+	if msg.Header.Get("To") != "alice@example.com" || msg.Header.Get("Message-Id") == "" {
+		t.Fatalf("headers = %v", msg.Header)
+	}
+	if body != strings.ReplaceAll(text, "\n", "\r\n") {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestSMTPSender_RequireTLS(t *testing.T) {
+	addr, inbox := fakeSMTP(t)
+	sender, err := NewSMTP(SMTPConfig{Addr: addr, From: "notify@example.com", RequireTLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sender.Send(context.Background(), coredigest.Mail{To: "alice@example.com", Subject: "hi", Text: "hi"})
+	if !errors.Is(err, ErrTLSUnavailable) {
+		t.Fatalf("err = %v, want ErrTLSUnavailable", err)
+	}
+	select {
+	case got := <-inbox:
+		t.Fatalf("message sent without TLS: %+v", got)
+	default:
+	}
+}
+
+func TestSMTPSender_RejectsHeaderInjection(t *testing.T) {
+	sender, err := NewSMTP(SMTPConfig{Addr: "127.0.0.1:1", From: "notify@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []coredigest.Mail{
+		{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "hi"},
+		{To: "alice@example.com", Subject: "hi\r\nBcc: eve@example.com"},
+	} {
+		if err := sender.Send(context.Background(), m); !errors.Is(err, ErrInvalidHeader) {
+			t.Fatalf("Send(%q) err = %v", m.To, err)
+		}
+	}
+	if _, err := NewSMTP(SMTPConfig{Addr: "relay.example.com", From: "notify@example.com"}); err == nil {
+		t.Fatal("expected error for address without port")
+	}
+}
+
+func TestDropSender_WritesPrivateFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	sender, err := NewDrop(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := sender.Send(context.Background(), coredigest.Mail{To: "alice@example.com", Subject: "Confirm", Text: "link\n"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("entries = %v, %v", entries, err)
+	}
+	info, err := entries[0].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 || !strings.HasSuffix(entries[0].Name(), ".eml") {
+		t.Fatalf("file = %s %v", entries[0].Name(), info.Mode())
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, body := readBody(t, string(raw))
+	if msg.Header.Get("From") != "notifications@localhost" || body != "link\r\n" {
+		t.Fatalf("message = %v %q", msg.Header, body)
+	}
+}
@@ -0,0 +1,111 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"time"
+
+	coredigest "github.com/kyambuthia/go-chat-site/server/internal/core/digest"
+)
+
+const defaultSMTPTimeout = 30 * time.Second
+
+var ErrTLSUnavailable = errors.New("smtp relay does not offer STARTTLS")
+
+type SMTPConfig struct {
+	// Addr is the relay's host:port.
+	Addr     string
+	Username string
+	Password string
+	From     string
+	// RequireTLS refuses to send when the relay does not offer STARTTLS.
+	// Credentials are never sent in clear text to a remote relay either way.
+	RequireTLS bool
+}
+
+// SMTPSender delivers mail through a relay, one connection per message. It
+// upgrades with STARTTLS whenever the relay offers it.
+type SMTPSender struct {
+	cfg     SMTPConfig
+	host    string
+	timeout time.Duration
+}
+
+var _ coredigest.Mailer = (*SMTPSender)(nil)
+
+func NewSMTP(cfg SMTPConfig) (*SMTPSender, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, errors.New("smtp address must be host:port")
+	}
+	if _, err := envelopeAddress(cfg.From); err != nil {
+		return nil, errors.New("mail from address is invalid")
+	}
+	return &SMTPSender{cfg: cfg, host: host, timeout: defaultSMTPTimeout}, nil
+}
+
+func (s *SMTPSender) Send(ctx context.Context, m coredigest.Mail) error {
+	from, err := envelopeAddress(s.cfg.From)
+	if err != nil {
+		return err
+	}
+	to, err := envelopeAddress(m.To)
+	if err != nil {
+		return err
+	}
+	msg, err := render(s.cfg.From, m, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	} else if s.cfg.RequireTLS {
+		return ErrTLSUnavailable
+	}
+	if s.cfg.Username != "" {
+		// PlainAuth itself refuses to send credentials over an unencrypted
+		// connection to anything but localhost.
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
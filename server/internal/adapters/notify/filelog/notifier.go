@@ -0,0 +1,94 @@
+package filelog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+// Notifier appends one JSON line per notification to a local file. It stands
+// in for real delivery during development: anyone who can read the file can
+// reset any account, so it is created 0600.
+type Notifier struct {
+	Path string
+	// ResetURL is the client page that accepts a reset token; the token is
+	// added as the "token" query parameter.
+	ResetURL string
+
+	mu sync.Mutex
+}
+
+var _ coreid.PasswordResetNotifier = (*Notifier)(nil)
+
+func New(path, resetURL string) (*Notifier, error) {
+	if path == "" {
+		return nil, errors.New("notification log path is required")
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &Notifier{Path: path, ResetURL: resetURL}, nil
+}
+
+type entry struct {
+	Kind      string    `json:"kind"`
+	At        time.Time `json:"at"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	Link      string    `json:"link,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (n *Notifier) NotifyPasswordReset(_ context.Context, notice coreid.PasswordResetNotice) error {
+	return n.append(entry{
+		Kind:      "password_reset",
+		At:        time.Now().UTC(),
+		UserID:    int64(notice.Principal.ID),
+		Username:  notice.Principal.Username,
+		Token:     notice.Token,
+		Link:      n.resetLink(notice.Token),
+		ExpiresAt: notice.ExpiresAt.UTC(),
+	})
+}
+
+func (n *Notifier) resetLink(token string) string {
+	if n.ResetURL == "" {
+		return ""
+	}
+	u, err := url.Parse(n.ResetURL)
+	if err != nil {
+		return ""
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (n *Notifier) append(e entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f, err := os.OpenFile(n.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
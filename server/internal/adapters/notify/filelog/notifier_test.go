@@ -0,0 +1,58 @@
+package filelog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+func TestNotifier_AppendsPasswordResetLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify", "resets.log")
+	n, err := New(path, "https://chat.example/reset-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"first", "second"} {
+		if err := n.NotifyPasswordReset(context.Background(), coreid.PasswordResetNotice{
+			Principal: coreid.Principal{ID: 7, Username: "alice"},
+			Token:     token,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}); err != nil {
+			t.Fatalf("NotifyPasswordReset error: %v", err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("file mode = %v, want 0600", perm)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 2 || got[1].Token != "second" || got[0].Username != "alice" || got[0].Kind != "password_reset" {
+		t.Fatalf("entries = %+v", got)
+	}
+	if got[0].Link != "https://chat.example/reset-password?token=first" {
+		t.Fatalf("link = %q", got[0].Link)
+	}
+}
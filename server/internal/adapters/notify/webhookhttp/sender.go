@@ -0,0 +1,87 @@
+package webhookhttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	corewebhooks "github.com/kyambuthia/go-chat-site/server/internal/core/webhooks"
+)
+
+const (
+	defaultTimeout   = 10 * time.Second
+	maxResponseBytes = 4 << 10
+)
+
+var ErrPrivateAddress = errors.New("webhook target resolves to a private address")
+
+// Sender posts deliveries over HTTP. It does not follow redirects, and unless
+// AllowPrivate is set it refuses to connect to loopback, private and
+// link-local addresses, so endpoints cannot be pointed at internal services.
+// The check runs on the dialed address, after DNS resolution.
+type Sender struct {
+	client *http.Client
+}
+
+var _ corewebhooks.Sender = (*Sender)(nil)
+
+func New(allowPrivate bool) *Sender {
+	return &Sender{client: NewClient(allowPrivate)}
+}
+
+// NewClient returns the guarded client Sender uses, for other deliveries to
+// user-supplied URLs such as Web Push endpoints.
+func NewClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !publicAddr(addr) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   defaultTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func (s *Sender) Send(ctx context.Context, req corewebhooks.Request) (int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+	return resp.StatusCode, nil
+}
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
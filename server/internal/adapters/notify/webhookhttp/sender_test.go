@@ -0,0 +1,55 @@
+package webhookhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corewebhooks "github.com/kyambuthia/go-chat-site/server/internal/core/webhooks"
+)
+
+func TestSender_PostsToReceiver(t *testing.T) {
+	var gotBody, gotHeader string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody, gotHeader = string(body), r.Header.Get(corewebhooks.EventTypeHeader)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+
+	status, err := New(true).Send(context.Background(), corewebhooks.Request{
+		URL:     receiver.URL,
+		Headers: map[string]string{corewebhooks.EventTypeHeader: "invite.accepted"},
+		Body:    []byte(`{"ok":true}`),
+	})
+	if err != nil || status != http.StatusAccepted {
+		t.Fatalf("Send = %d, %v", status, err)
+	}
+	if gotBody != `{"ok":true}` || gotHeader != "invite.accepted" {
+		t.Fatalf("receiver got body=%q header=%q", gotBody, gotHeader)
+	}
+}
+
+func TestSender_RefusesPrivateAddressesAndRedirects(t *testing.T) {
+	hits := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer receiver.Close()
+
+	if _, err := New(false).Send(context.Background(), corewebhooks.Request{URL: receiver.URL}); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("loopback target err = %v", err)
+	}
+	if hits != 0 {
+		t.Fatal("request reached a loopback receiver")
+	}
+
+	status, err := New(true).Send(context.Background(), corewebhooks.Request{URL: receiver.URL})
+	if err != nil || status != http.StatusFound || hits != 1 {
+		t.Fatalf("redirect was followed: status=%d hits=%d err=%v", status, hits, err)
+	}
+}
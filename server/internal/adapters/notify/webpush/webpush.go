@@ -0,0 +1,279 @@
+// Package webpush sends Web Push messages: payloads are encrypted for the
+// browser with the aes128gcm content coding (RFC 8291, RFC 8188) and requests
+// are authenticated to the push service with VAPID (RFC 8292).
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	corepush "github.com/kyambuthia/go-chat-site/server/internal/core/push"
+)
+
+const (
+	recordSize = 4096
+	// MaxPayloadBytes is the largest plaintext that fits one record after
+	// the header, the AEAD tag and the padding delimiter.
+	MaxPayloadBytes  = 3993
+	vapidTokenTTL    = 12 * time.Hour
+	maxResponseBytes = 4 << 10
+)
+
+var ErrPayloadTooLarge = errors.New("push payload too large")
+
+// Client is a corepush.Pusher backed by an HTTP client and a VAPID key.
+type Client struct {
+	key       *ecdsa.PrivateKey
+	publicKey string
+	subject   string
+	http      *http.Client
+	now       func() time.Time
+}
+
+var _ corepush.Pusher = (*Client)(nil)
+
+// New returns a client signing with key. subject is the VAPID contact, a
+// mailto: or https: URL that push services may use to reach the operator.
+func New(key *ecdsa.PrivateKey, subject string, httpClient *http.Client) (*Client, error) {
+	if key == nil {
+		return nil, errors.New("vapid key is required")
+	}
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https://") {
+		return nil, errors.New("vapid subject must be a mailto: or https: url")
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	publicKey, err := PublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		key:       key,
+		publicKey: publicKey,
+		subject:   subject,
+		http:      httpClient,
+		now:       time.Now,
+	}, nil
+}
+
+// GenerateVAPIDKey returns a new key encoded as ParseVAPIDKey expects.
+func GenerateVAPIDKey() (string, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key.Bytes()), nil
+}
+
+// ParseVAPIDKey decodes a base64url P-256 private scalar, the format most
+// Web Push libraries print.
+func ParseVAPIDKey(encoded string) (*ecdsa.PrivateKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(encoded), "="))
+	if err != nil {
+		return nil, fmt.Errorf("vapid key is not base64url: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("vapid key is not a P-256 private key: %w", err)
+	}
+	pub := key.PublicKey().Bytes()
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}, nil
+}
+
+// PublicKey returns the base64url uncompressed point browsers expect as
+// applicationServerKey.
+func PublicKey(key *ecdsa.PrivateKey) (string, error) {
+	pub, err := key.PublicKey.ECDH()
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(pub.Bytes()), nil
+}
+
+func (c *Client) PublicKey() string {
+	return c.publicKey
+}
+
+func (c *Client) Push(ctx context.Context, sub corepush.Subscription, payload []byte, opts corepush.PushOptions) (int, error) {
+	body, err := Encrypt(sub.P256DH, sub.Auth, payload)
+	if err != nil {
+		return 0, err
+	}
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return 0, err
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": c.now().Add(vapidTokenTTL).Unix(),
+		"sub": c.subject,
+	}).SignedString(c.key)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "vapid t="+token+", k="+c.publicKey)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(opts.TTL/time.Second)))
+	if opts.Urgency != "" {
+		req.Header.Set("Urgency", string(opts.Urgency))
+	}
+	if opts.Topic != "" {
+		req.Header.Set("Topic", opts.Topic)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+	return resp.StatusCode, nil
+}
+
+// Encrypt seals payload for the subscription keys as a single aes128gcm
+// record with a fresh ephemeral key and salt.
+func Encrypt(p256dh, auth string, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadBytes {
+		return nil, ErrPayloadTooLarge
+	}
+	uaPublic, err := decode(p256dh)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := decode(auth)
+	if err != nil {
+		return nil, err
+	}
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	asPublic := asKey.PublicKey().Bytes()
+
+	gcm, nonce, err := contentCipher(shared, authSecret, uaPublic, asPublic, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, 21+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// Decrypt opens a body produced by Encrypt with the browser's private key.
+// It exists for push-service stubs in tests.
+func Decrypt(uaPrivate *ecdh.PrivateKey, auth string, body []byte) ([]byte, error) {
+	authSecret, err := decode(auth)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < 21 {
+		return nil, errors.New("push body too short")
+	}
+	salt := body[:16]
+	idLen := int(body[20])
+	if len(body) < 21+idLen {
+		return nil, errors.New("push body too short")
+	}
+	asPublic := body[21 : 21+idLen]
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := uaPrivate.ECDH(asKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, nonce, err := contentCipher(shared, authSecret, uaPrivate.PublicKey().Bytes(), asPublic, salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, body[21+idLen:], nil)
+	if err != nil {
+		return nil, err
+	}
+	plaintext = bytes.TrimRight(plaintext, "\x00")
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		return nil, errors.New("push record is not the last record")
+	}
+	return plaintext[:len(plaintext)-1], nil
+}
+
+// contentCipher derives the content encryption key and nonce (RFC 8291
+// section 3.4, RFC 8188 section 2.2).
+func contentCipher(shared, authSecret, uaPublic, asPublic, salt []byte) (cipher.AEAD, []byte, error) {
+	prkKey := hmacSHA256(authSecret, shared)
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hmacSHA256(prkKey, append(keyInfo, 0x01))
+	prk := hmacSHA256(salt, ikm)
+	cek := hmacSHA256(prk, []byte("Content-Encoding: aes128gcm\x00\x01"))[:16]
+	nonce := hmacSHA256(prk, []byte("Content-Encoding: nonce\x00\x01"))[:12]
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gcm, nonce, nil
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func decode(v string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(v, "="))
+}
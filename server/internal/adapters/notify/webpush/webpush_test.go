@@ -0,0 +1,82 @@
+package webpush_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webpush"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webpush/webpushtest"
+	corepush "github.com/kyambuthia/go-chat-site/server/internal/core/push"
+)
+
+func newClient(t *testing.T) *webpush.Client {
+	t.Helper()
+	encoded, err := webpush.GenerateVAPIDKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := webpush.ParseVAPIDKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := webpush.New(key, "mailto:ops@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestClientPush_EncryptsAndSignsForPushService(t *testing.T) {
+	service := webpushtest.New()
+	defer service.Close()
+	sub, err := service.NewSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newClient(t)
+
+	status, err := client.Push(context.Background(), corepush.Subscription{Endpoint: sub.Endpoint, P256DH: sub.P256DH, Auth: sub.Auth},
+		[]byte(`{"type":"message"}`), corepush.PushOptions{TTL: time.Hour, Urgency: corepush.UrgencyHigh, Topic: "dm-7"})
+	if err != nil || status != http.StatusCreated {
+		t.Fatalf("Push = %d, %v", status, err)
+	}
+	got := <-service.Pushes
+	if got.Err != nil {
+		t.Fatalf("push service rejected request: %v", got.Err)
+	}
+	if string(got.Payload) != `{"type":"message"}` {
+		t.Fatalf("payload = %q", got.Payload)
+	}
+	if got.Header.Get("TTL") != "3600" || got.Header.Get("Urgency") != "high" || got.Header.Get("Topic") != "dm-7" {
+		t.Fatalf("headers = %v", got.Header)
+	}
+}
+
+func TestClientPush_ReturnsPushServiceStatus(t *testing.T) {
+	service := webpushtest.New()
+	defer service.Close()
+	service.SetStatus(http.StatusGone)
+	sub, _ := service.NewSubscription()
+
+	status, err := newClient(t).Push(context.Background(), corepush.Subscription{Endpoint: sub.Endpoint, P256DH: sub.P256DH, Auth: sub.Auth}, []byte("x"), corepush.PushOptions{TTL: time.Minute})
+	if err != nil || status != http.StatusGone {
+		t.Fatalf("Push = %d, %v; want 410", status, err)
+	}
+}
+
+func TestEncrypt_RejectsOversizedPayload(t *testing.T) {
+	service := webpushtest.New()
+	defer service.Close()
+	sub, _ := service.NewSubscription()
+	if _, err := webpush.Encrypt(sub.P256DH, sub.Auth, make([]byte, webpush.MaxPayloadBytes+1)); err != webpush.ErrPayloadTooLarge {
+		t.Fatalf("err = %v, want ErrPayloadTooLarge", err)
+	}
+}
+
+func TestParseVAPIDKey_RejectsGarbage(t *testing.T) {
+	if _, err := webpush.ParseVAPIDKey("not a key"); err == nil {
+		t.Fatal("expected error")
+	}
+}
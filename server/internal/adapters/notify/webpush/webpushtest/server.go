@@ -0,0 +1,175 @@
+// Package webpushtest is an in-process push service for tests. It hands out
+// subscriptions backed by browser-side keys it keeps, checks the VAPID
+// authorization on each request, decrypts the body and records what arrived.
+package webpushtest
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webpush"
+)
+
+// Subscription is what a browser would return from pushManager.subscribe.
+type Subscription struct {
+	Endpoint string
+	P256DH   string
+	Auth     string
+}
+
+// Push is one request the service received. Err is set when the request
+// failed VAPID or decryption checks; the service answered 400 or 401.
+type Push struct {
+	Endpoint string
+	Header   http.Header
+	Payload  []byte
+	Err      error
+}
+
+type Server struct {
+	*httptest.Server
+	Pushes chan Push
+
+	mu     sync.Mutex
+	status int
+	subs   map[string]subscriber
+	nextID int
+}
+
+type subscriber struct {
+	key  *ecdh.PrivateKey
+	auth string
+}
+
+// New starts a push service answering 201 Created. Call Close when done.
+func New() *Server {
+	s := &Server{
+		Pushes: make(chan Push, 64),
+		status: http.StatusCreated,
+		subs:   map[string]subscriber{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SetStatus changes the status returned for accepted pushes, for example 410
+// to simulate an expired subscription or 503 to force retries.
+func (s *Server) SetStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *Server) NewSubscription() (Subscription, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return Subscription{}, err
+	}
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return Subscription{}, err
+	}
+	auth := base64.RawURLEncoding.EncodeToString(secret)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	path := fmt.Sprintf("/push/%d", s.nextID)
+	s.subs[path] = subscriber{key: key, auth: auth}
+	return Subscription{
+		Endpoint: s.URL + path,
+		P256DH:   base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		Auth:     auth,
+	}, nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	sub, ok := s.subs[r.URL.Path]
+	status := s.status
+	s.mu.Unlock()
+	if !ok || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	push := Push{Endpoint: s.URL + r.URL.Path, Header: r.Header.Clone()}
+	defer func() { s.Pushes <- push }()
+
+	if err := s.verifyVAPID(r.Header.Get("Authorization")); err != nil {
+		push.Err = err
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+		push.Err = errors.New("missing Content-Encoding or TTL header")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 8<<10))
+	if err != nil {
+		push.Err = err
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	push.Payload, push.Err = webpush.Decrypt(sub.key, sub.auth, body)
+	if push.Err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+func (s *Server) verifyVAPID(header string) error {
+	rest, ok := strings.CutPrefix(header, "vapid ")
+	if !ok {
+		return errors.New("authorization is not vapid")
+	}
+	var token, key string
+	for _, part := range strings.Split(rest, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil || len(raw) != 65 {
+		return errors.New("vapid k is not a P-256 public key")
+	}
+	pub := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(raw[1:33]),
+		Y:     new(big.Int).SetBytes(raw[33:]),
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return pub, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}),
+		jwt.WithAudience(s.URL),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return fmt.Errorf("vapid token: %w", err)
+	}
+	if exp, _ := claims.GetExpirationTime(); exp.After(time.Now().Add(24 * time.Hour)) {
+		return errors.New("vapid token expires more than 24h ahead")
+	}
+	if sub, _ := claims.GetSubject(); sub == "" {
+		return errors.New("vapid token has no sub")
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+package postgresmessaging
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/config"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+// Adapter stores direct messages in PostgreSQL. It has the same behaviour as
+// sqlitemessaging except that attachments are not supported: the Postgres
+// schema has no attachment tables, so a message naming any is rejected.
+type Adapter struct {
+	DB *sql.DB
+}
+
+var _ coremsg.MessageRepository = (*Adapter)(nil)
+var _ coremsg.ClientMessageCorrelationRecorder = (*Adapter)(nil)
+var _ coremsg.ThreadSummaryRepository = (*Adapter)(nil)
+
+// summaryVisible matches the messages a thread preview or unread count may
+// show; payment request updates only change an earlier message.
+const summaryVisible = `m.content_kind <> 'payment_request_update'`
+
+const messageColumns = `
+	m.id, m.from_user_id, m.to_user_id, m.body, m.ciphertext, m.encryption_version,
+	m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at,
+	md.delivered_at, md.read_at`
+
+// outboxColumns adds the sender's client message ID and whether the live
+// relay reported the message undelivered.
+const outboxColumns = messageColumns + `, mc.client_message_id,
+	COALESCE(NOT mc.delivered AND md.delivered_at IS NULL, FALSE)`
+
+const outboxJoins = `
+	FROM messages m
+	LEFT JOIN message_deliveries md ON md.message_id = m.id
+	LEFT JOIN message_client_correlations mc ON mc.stored_message_id = m.id AND mc.sender_user_id = m.from_user_id`
+
+func (a *Adapter) RecordClientMessageCorrelation(ctx context.Context, c coremsg.ClientMessageCorrelation) error {
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO message_client_correlations (
+			sender_user_id, recipient_user_id, client_message_id, stored_message_id, delivered
+		) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (sender_user_id, client_message_id) DO UPDATE SET
+			recipient_user_id = excluded.recipient_user_id,
+			stored_message_id = excluded.stored_message_id,
+			delivered = excluded.delivered
+	`, c.SenderUserID, c.RecipientUserID, c.ClientMessageID, c.StoredMessageID, c.Delivered)
+	return err
+}
+
+func (a *Adapter) SaveDirectMessage(ctx context.Context, msg coremsg.StoredMessage) (coremsg.StoredMessage, error) {
+	if len(msg.AttachmentIDs) > 0 {
+		return coremsg.StoredMessage{}, coremsg.ErrInvalidAttachment
+	}
+	body := msg.Body
+	if msg.Ciphertext != "" && !config.MessagingStorePlaintextWhenEncrypted() {
+		body = ""
+	}
+	contentKind := msg.ContentKind
+	if contentKind == "" {
+		contentKind = "text"
+	}
+
+	var id int64
+	if err := a.DB.QueryRowContext(ctx, `
+		INSERT INTO messages (
+			from_user_id, to_user_id, body, content_kind, ciphertext, encryption_version, sender_device_id, recipient_device_id
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, msg.FromUserID, msg.ToUserID, body, contentKind, msg.Ciphertext, msg.EnvelopeVersion, msg.SenderDeviceID, msg.RecipientDeviceID).Scan(&id); err != nil {
+		return coremsg.StoredMessage{}, err
+	}
+
+	return scanOutboxMessage(a.DB.QueryRowContext(ctx, `SELECT `+outboxColumns+outboxJoins+` WHERE m.id = $1`, id))
+}
+
+func (a *Adapter) MarkDelivered(ctx context.Context, messageID int64, deliveredAt time.Time) error {
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO message_deliveries (message_id, delivered_at)
+		VALUES ($1, $2)
+		ON CONFLICT (message_id) DO UPDATE SET
+			delivered_at = COALESCE(message_deliveries.delivered_at, excluded.delivered_at)
+	`, messageID, deliveredAt.UTC())
+	return err
+}
+
+func (a *Adapter) MarkDeliveredForRecipient(ctx context.Context, recipientUserID int, messageID int64, deliveredAt time.Time) error {
+	if err := a.ensureRecipientOwnsMessage(ctx, recipientUserID, messageID); err != nil {
+		return err
+	}
+	return a.MarkDelivered(ctx, messageID, deliveredAt)
+}
+
+func (a *Adapter) MarkRead(ctx context.Context, messageID int64, readAt time.Time) error {
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO message_deliveries (message_id, delivered_at, read_at)
+		VALUES ($1, $2, $2)
+		ON CONFLICT (message_id) DO UPDATE SET
+			delivered_at = COALESCE(message_deliveries.delivered_at, excluded.delivered_at),
+			read_at = COALESCE(message_deliveries.read_at, excluded.read_at)
+	`, messageID, readAt.UTC())
+	return err
+}
+
+func (a *Adapter) MarkReadForRecipient(ctx context.Context, recipientUserID int, messageID int64, readAt time.Time) error {
+	if err := a.ensureRecipientOwnsMessage(ctx, recipientUserID, messageID); err != nil {
+		return err
+	}
+	return a.MarkRead(ctx, messageID, readAt)
+}
+
+func (a *Adapter) GetMessageForRecipient(ctx context.Context, recipientUserID int, messageID int64) (coremsg.StoredMessage, error) {
+	msg, err := scanMessage(a.DB.QueryRowContext(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages m
+		LEFT JOIN message_deliveries md ON md.message_id = m.id
+		WHERE m.id = $1 AND m.to_user_id = $2
+	`, messageID, recipientUserID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return coremsg.StoredMessage{}, coremsg.ErrMessageNotFound
+	}
+	return msg, err
+}
+
+func (a *Adapter) ListInbox(ctx context.Context, userID int, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, limit: limit})
+}
+
+func (a *Adapter) ListUnreadInbox(ctx context.Context, userID int, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, limit: limit, unreadOnly: true})
+}
+
+func (a *Adapter) ListInboxWithUser(ctx context.Context, userID int, withUserID int, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, withUserID: withUserID, limit: limit})
+}
+
+func (a *Adapter) ListUnreadInboxWithUser(ctx context.Context, userID int, withUserID int, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, withUserID: withUserID, limit: limit, unreadOnly: true})
+}
+
+func (a *Adapter) ListInboxBefore(ctx context.Context, userID int, beforeID int64, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, beforeID: beforeID, limit: limit})
+}
+
+func (a *Adapter) ListUnreadInboxBefore(ctx context.Context, userID int, beforeID int64, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, beforeID: beforeID, limit: limit, unreadOnly: true})
+}
+
+func (a *Adapter) ListInboxBeforeWithUser(ctx context.Context, userID int, withUserID int, beforeID int64, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, withUserID: withUserID, beforeID: beforeID, limit: limit})
+}
+
+func (a *Adapter) ListUnreadInboxBeforeWithUser(ctx context.Context, userID int, withUserID int, beforeID int64, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, withUserID: withUserID, beforeID: beforeID, limit: limit, unreadOnly: true})
+}
+
+func (a *Adapter) ListInboxAfter(ctx context.Context, userID int, afterID int64, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, afterID: afterID, limit: limit})
+}
+
+func (a *Adapter) ListUnreadInboxAfter(ctx context.Context, userID int, afterID int64, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, afterID: afterID, limit: limit, unreadOnly: true})
+}
+
+func (a *Adapter) ListInboxAfterWithUser(ctx context.Context, userID int, withUserID int, afterID int64, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, withUserID: withUserID, afterID: afterID, limit: limit})
+}
+
+func (a *Adapter) ListUnreadInboxAfterWithUser(ctx context.Context, userID int, withUserID int, afterID int64, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listInbox(ctx, inboxQuery{userID: userID, withUserID: withUserID, afterID: afterID, limit: limit, unreadOnly: true})
+}
+
+func (a *Adapter) ListOutbox(ctx context.Context, userID int, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listOutbox(ctx, userID, 0, 0, limit)
+}
+
+func (a *Adapter) ListOutboxBefore(ctx context.Context, userID int, beforeID int64, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listOutbox(ctx, userID, beforeID, 0, limit)
+}
+
+func (a *Adapter) ListOutboxAfter(ctx context.Context, userID int, afterID int64, limit int) ([]coremsg.StoredMessage, error) {
+	return a.listOutbox(ctx, userID, 0, afterID, limit)
+}
+
+// inboxQuery selects received messages. afterID pages forward in ascending
+// order; otherwise pages run newest first, optionally before beforeID.
+type inboxQuery struct {
+	userID     int
+	withUserID int
+	beforeID   int64
+	afterID    int64
+	limit      int
+	unreadOnly bool
+}
+
+func (a *Adapter) listInbox(ctx context.Context, q inboxQuery) ([]coremsg.StoredMessage, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		LEFT JOIN message_deliveries md ON md.message_id = m.id
+		WHERE m.to_user_id = $1`
+	args := []any{q.userID}
+	if q.withUserID > 0 {
+		args = append(args, q.withUserID)
+		query += fmt.Sprintf(` AND (m.from_user_id = $%[1]d OR m.to_user_id = $%[1]d)`, len(args))
+	}
+	if q.unreadOnly {
+		query += ` AND md.read_at IS NULL AND ` + summaryVisible
+	}
+	order := "DESC"
+	switch {
+	case q.afterID > 0:
+		args = append(args, q.afterID)
+		query += fmt.Sprintf(` AND m.id > $%d`, len(args))
+		order = "ASC"
+	case q.beforeID > 0:
+		args = append(args, q.beforeID)
+		query += fmt.Sprintf(` AND m.id < $%d`, len(args))
+	}
+	args = append(args, q.limit)
+	query += fmt.Sprintf(` ORDER BY m.id %s LIMIT $%d`, order, len(args))
+	return a.queryMessages(ctx, scanMessage, query, args...)
+}
+
+func (a *Adapter) listOutbox(ctx context.Context, userID int, beforeID, afterID int64, limit int) ([]coremsg.StoredMessage, error) {
+	query := `SELECT ` + outboxColumns + outboxJoins + ` WHERE m.from_user_id = $1`
+	args := []any{userID}
+	order := "DESC"
+	switch {
+	case afterID > 0:
+		args = append(args, afterID)
+		query += ` AND m.id > $2`
+		order = "ASC"
+	case beforeID > 0:
+		args = append(args, beforeID)
+		query += ` AND m.id < $2`
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY m.id %s LIMIT $%d`, order, len(args))
+	return a.queryMessages(ctx, scanOutboxMessage, query, args...)
+}
+
+func (a *Adapter) queryMessages(ctx context.Context, scan func(scanner) (coremsg.StoredMessage, error), query string, args ...any) ([]coremsg.StoredMessage, error) {
+	rows, err := a.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]coremsg.StoredMessage, 0)
+	for rows.Next() {
+		msg, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, msg)
+	}
+	return out, rows.Err()
+}
+
+// ListThreadSummaries returns one row per counterparty: the latest visible
+// message and the number of visible messages the user has not read.
+func (a *Adapter) ListThreadSummaries(ctx context.Context, userID int, limit int) ([]coremsg.ThreadSummary, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		WITH thread_messages AS (
+			SELECT
+				m.id, m.from_user_id, m.to_user_id, m.body, m.content_kind, m.ciphertext, m.created_at,
+				md.delivered_at, md.read_at,
+				CASE WHEN m.from_user_id = $1 THEN m.to_user_id ELSE m.from_user_id END AS other_user_id,
+				m.to_user_id = $1 AND md.read_at IS NULL AS unread
+			FROM messages m
+			LEFT JOIN message_deliveries md ON md.message_id = m.id
+			WHERE (m.from_user_id = $1 OR m.to_user_id = $1) AND `+summaryVisible+`
+		),
+		latest AS (
+			SELECT DISTINCT ON (other_user_id) *
+			FROM thread_messages
+			ORDER BY other_user_id, id DESC
+		),
+		unread_counts AS (
+			SELECT other_user_id, COUNT(*) FILTER (WHERE unread) AS unread_count
+			FROM thread_messages
+			GROUP BY other_user_id
+		)
+		SELECT
+			l.other_user_id, u.username, COALESCE(u.display_name, ''), COALESCE(u.avatar_url, ''),
+			l.id, l.from_user_id, l.to_user_id, l.body, l.ciphertext <> '', l.content_kind,
+			l.created_at, l.delivered_at, l.read_at, c.unread_count
+		FROM latest l
+		INNER JOIN unread_counts c ON c.other_user_id = l.other_user_id
+		INNER JOIN users u ON u.id = l.other_user_id
+		ORDER BY l.id DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make([]coremsg.ThreadSummary, 0)
+	for rows.Next() {
+		var summary coremsg.ThreadSummary
+		var deliveredAt, readAt sql.NullTime
+		if err := rows.Scan(
+			&summary.CounterpartyUserID,
+			&summary.CounterpartyUsername,
+			&summary.CounterpartyDisplayName,
+			&summary.CounterpartyAvatarURL,
+			&summary.LastMessageID,
+			&summary.LastMessageFromUserID,
+			&summary.LastMessageToUserID,
+			&summary.LastMessageBody,
+			&summary.LastMessageEncrypted,
+			&summary.LastMessageContentKind,
+			&summary.LastMessageCreatedAt,
+			&deliveredAt,
+			&readAt,
+			&summary.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		summary.LastDeliveredAt = nullTimePtr(deliveredAt)
+		summary.LastReadAt = nullTimePtr(readAt)
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+func (a *Adapter) ensureRecipientOwnsMessage(ctx context.Context, recipientUserID int, messageID int64) error {
+	var exists int
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT 1 FROM messages WHERE id = $1 AND to_user_id = $2
+	`, messageID, recipientUserID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return coremsg.ErrMessageNotFound
+	}
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(s scanner) (coremsg.StoredMessage, error) {
+	var msg coremsg.StoredMessage
+	var deliveredAt, readAt sql.NullTime
+	if err := s.Scan(
+		&msg.ID,
+		&msg.FromUserID,
+		&msg.ToUserID,
+		&msg.Body,
+		&msg.Ciphertext,
+		&msg.EnvelopeVersion,
+		&msg.ContentKind,
+		&msg.SenderDeviceID,
+		&msg.RecipientDeviceID,
+		&msg.CreatedAt,
+		&deliveredAt,
+		&readAt,
+	); err != nil {
+		return coremsg.StoredMessage{}, err
+	}
+	msg.DeliveredAt = nullTimePtr(deliveredAt)
+	msg.ReadAt = nullTimePtr(readAt)
+	return msg, nil
+}
+
+func scanOutboxMessage(s scanner) (coremsg.StoredMessage, error) {
+	var msg coremsg.StoredMessage
+	var deliveredAt, readAt sql.NullTime
+	var clientMessageID sql.NullInt64
+	if err := s.Scan(
+		&msg.ID,
+		&msg.FromUserID,
+		&msg.ToUserID,
+		&msg.Body,
+		&msg.Ciphertext,
+		&msg.EnvelopeVersion,
+		&msg.ContentKind,
+		&msg.SenderDeviceID,
+		&msg.RecipientDeviceID,
+		&msg.CreatedAt,
+		&deliveredAt,
+		&readAt,
+		&clientMessageID,
+		&msg.DeliveryFailed,
+	); err != nil {
+		return coremsg.StoredMessage{}, err
+	}
+	msg.DeliveredAt = nullTimePtr(deliveredAt)
+	msg.ReadAt = nullTimePtr(readAt)
+	msg.ClientMessageID = clientMessageID.Int64
+	return msg, nil
+}
+
+func nullTimePtr(v sql.NullTime) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := v.Time
+	return &t
+}
@@ -0,0 +1,41 @@
+package postgresmessaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/storetest"
+)
+
+func TestAdapter_MessagingContract(t *testing.T) {
+	storetest.RunMessagingContract(t, storetest.OpenPostgres, func(b storetest.Backend) storetest.MessagingRepository {
+		return &Adapter{DB: b.DB}
+	})
+}
+
+func TestAdapter_SaveDirectMessage_RejectsAttachments(t *testing.T) {
+	b := storetest.OpenPostgres(t)
+	alice, err := b.Store.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := b.Store.CreateUser("bob", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Adapter{DB: b.DB}
+	_, err = a.SaveDirectMessage(context.Background(), coremsg.StoredMessage{
+		FromUserID:    alice,
+		ToUserID:      bob,
+		ContentKind:   coremsg.ContentKindAttachment,
+		AttachmentIDs: []int64{1},
+	})
+	if !errors.Is(err, coremsg.ErrInvalidAttachment) {
+		t.Fatalf("error = %v, want ErrInvalidAttachment", err)
+	}
+	if inbox, err := a.ListInbox(context.Background(), bob, 10); err != nil || len(inbox) != 0 {
+		t.Fatalf("inbox = %+v, err = %v", inbox, err)
+	}
+}
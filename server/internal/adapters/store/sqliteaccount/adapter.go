@@ -0,0 +1,143 @@
+package sqliteaccount
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	coreaccount "github.com/kyambuthia/go-chat-site/server/internal/core/account"
+)
+
+type Adapter struct {
+	DB *sql.DB
+}
+
+var _ coreaccount.Repository = (*Adapter)(nil)
+
+const exportColumns = `id, user_id, status, attempts, size_bytes, last_error, created_at, completed_at, expires_at`
+
+func (a *Adapter) LatestExport(ctx context.Context, userID int) (coreaccount.Export, error) {
+	export, err := scanExport(a.DB.QueryRowContext(ctx, `
+		SELECT `+exportColumns+` FROM account_exports WHERE user_id = ? ORDER BY id DESC LIMIT 1
+	`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return coreaccount.Export{}, coreaccount.ErrExportNotFound
+	}
+	return export, err
+}
+
+func (a *Adapter) CreateExport(ctx context.Context, userID int, at time.Time) (coreaccount.Export, error) {
+	return scanExport(a.DB.QueryRowContext(ctx, `
+		INSERT INTO account_exports (user_id, created_at) VALUES (?, ?)
+		RETURNING `+exportColumns, userID, at.UTC()))
+}
+
+func (a *Adapter) GetExport(ctx context.Context, userID int, exportID int64) (coreaccount.Export, error) {
+	export, err := scanExport(a.DB.QueryRowContext(ctx, `
+		SELECT `+exportColumns+` FROM account_exports WHERE id = ? AND user_id = ?
+	`, exportID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return coreaccount.Export{}, coreaccount.ErrExportNotFound
+	}
+	return export, err
+}
+
+func (a *Adapter) ReadArchive(ctx context.Context, userID int, exportID int64) ([]byte, error) {
+	var archive []byte
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT archive FROM account_exports WHERE id = ? AND user_id = ? AND status = 'ready'
+	`, exportID, userID).Scan(&archive)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, coreaccount.ErrExportNotFound
+	}
+	return archive, err
+}
+
+func (a *Adapter) ClaimPendingExports(ctx context.Context, now, leaseUntil time.Time, limit int) ([]coreaccount.Export, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		UPDATE account_exports
+		SET status = 'running', lease_until = ?, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM account_exports
+			WHERE status = 'pending' OR (status = 'running' AND lease_until <= ?)
+			ORDER BY id
+			LIMIT ?
+		)
+		RETURNING `+exportColumns, leaseUntil.UTC(), now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]coreaccount.Export, 0)
+	for rows.Next() {
+		export, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, export)
+	}
+	return out, rows.Err()
+}
+
+func (a *Adapter) CompleteExport(ctx context.Context, exportID int64, archive []byte, completedAt, expiresAt time.Time) error {
+	_, err := a.DB.ExecContext(ctx, `
+		UPDATE account_exports
+		SET status = 'ready', archive = ?, size_bytes = ?, last_error = '', lease_until = NULL,
+			completed_at = ?, expires_at = ?
+		WHERE id = ?
+	`, archive, len(archive), completedAt.UTC(), expiresAt.UTC(), exportID)
+	return err
+}
+
+func (a *Adapter) FailExport(ctx context.Context, exportID int64, reason string, final bool) error {
+	status := coreaccount.ExportPending
+	if final {
+		status = coreaccount.ExportFailed
+	}
+	_, err := a.DB.ExecContext(ctx, `
+		UPDATE account_exports SET status = ?, last_error = ?, lease_until = NULL WHERE id = ?
+	`, string(status), reason, exportID)
+	return err
+}
+
+// DeleteExpiredExports also forgets failed exports older than ExportTTL.
+func (a *Adapter) DeleteExpiredExports(ctx context.Context, now time.Time) (int, error) {
+	result, err := a.DB.ExecContext(ctx, `
+		DELETE FROM account_exports
+		WHERE (expires_at IS NOT NULL AND expires_at <= ?)
+		   OR (status = 'failed' AND created_at <= ?)
+	`, now.UTC(), now.UTC().Add(-coreaccount.ExportTTL))
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanExport(row rowScanner) (coreaccount.Export, error) {
+	var export coreaccount.Export
+	var status string
+	var completed, expires sql.NullTime
+	if err := row.Scan(&export.ID, &export.UserID, &status, &export.Attempts, &export.SizeBytes, &export.Error,
+		&export.CreatedAt, &completed, &expires); err != nil {
+		return coreaccount.Export{}, err
+	}
+	export.Status = coreaccount.ExportStatus(status)
+	export.CompletedAt = nullTimePtr(completed)
+	export.ExpiresAt = nullTimePtr(expires)
+	return export, nil
+}
+
+func nullTimePtr(v sql.NullTime) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := v.Time
+	return &t
+}
@@ -0,0 +1,347 @@
+package sqliteaccount
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/blobstore/fsblob"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/passwordbcrypt"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqlitemessaging"
+	coreaccount "github.com/kyambuthia/go-chat-site/server/internal/core/account"
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+func newAccountStore(t *testing.T) (*store.SqliteStore, *Adapter) {
+	t.Helper()
+	s, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.RunMigrations(s.DB, filepath.Join("..", "..", "..", "..", "migrations")); err != nil {
+		t.Fatal(err)
+	}
+	return s, &Adapter{DB: s.DB}
+}
+
+func seedUser(t *testing.T, s *store.SqliteStore, username string) int {
+	t.Helper()
+	id, err := s.CreateUser(username, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func exec(t *testing.T, s *store.SqliteStore, query string, args ...any) {
+	t.Helper()
+	if _, err := s.DB.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+func count(t *testing.T, s *store.SqliteStore, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := s.DB.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+// seedActivity gives alice a contact, an invite, a session, a device, a
+// message in each direction, a transfer and a bot.
+func seedActivity(t *testing.T, s *store.SqliteStore, alice, bob, carol int) int {
+	t.Helper()
+	future := time.Now().UTC().Add(time.Hour)
+	exec(t, s, `INSERT INTO contacts (user_id, contact_id) VALUES (?, ?), (?, ?)`, alice, bob, bob, alice)
+	exec(t, s, `INSERT INTO contact_invites (requester_id, recipient_id) VALUES (?, ?)`, carol, alice)
+	exec(t, s, `
+		INSERT INTO auth_sessions (user_id, device_label, current_refresh_hash, access_token_expires_at, refresh_token_expires_at)
+		VALUES (?, 'laptop', 'h1', ?, ?)
+	`, alice, future, future)
+	exec(t, s, `
+		INSERT INTO device_identities (user_id, label, identity_key, signed_prekey_id, signed_prekey, signed_prekey_signature)
+		VALUES (?, 'phone', 'ik', 1, 'spk', 'sig')
+	`, alice)
+	exec(t, s, `INSERT INTO messages (from_user_id, to_user_id, body) VALUES (?, ?, 'hi bob'), (?, ?, 'hi alice')`, alice, bob, bob, alice)
+	exec(t, s, `INSERT INTO message_deliveries (message_id, delivered_at) SELECT id, CURRENT_TIMESTAMP FROM messages`)
+	exec(t, s, `INSERT INTO wallet_accounts (user_id, balance_cents) VALUES (?, 700), (?, 300)`, alice, bob)
+	exec(t, s, `INSERT INTO wallet_transfers (sender_user_id, recipient_user_id, amount_cents, note) VALUES (?, ?, 300, 'lunch')`, alice, bob)
+	bot := seedUser(t, s, "alicebot")
+	exec(t, s, `INSERT INTO bot_accounts (user_id, owner_user_id) VALUES (?, ?)`, bot, alice)
+	exec(t, s, `INSERT INTO api_tokens (user_id, name, token_hash, scopes) VALUES (?, 'bot', 'th', 'messages:send')`, bot)
+	exec(t, s, `INSERT INTO messages (from_user_id, to_user_id, body) VALUES (?, ?, 'beep')`, bot, carol)
+	return bot
+}
+
+func TestAdapter_CollectArchive_CoversEverySection(t *testing.T) {
+	s, a := newAccountStore(t)
+	alice := seedUser(t, s, "alice")
+	bob := seedUser(t, s, "bob")
+	carol := seedUser(t, s, "carol")
+	seedActivity(t, s, alice, bob, carol)
+
+	archive, err := a.CollectArchive(context.Background(), alice)
+	if err != nil {
+		t.Fatalf("CollectArchive: %v", err)
+	}
+	if archive.Profile.Username != "alice" || archive.Profile.CreatedAt.IsZero() {
+		t.Fatalf("profile = %+v", archive.Profile)
+	}
+	if len(archive.Contacts) != 1 || archive.Contacts[0].Username != "bob" {
+		t.Fatalf("contacts = %+v", archive.Contacts)
+	}
+	if len(archive.Invites) != 1 || archive.Invites[0].Direction != "received" || archive.Invites[0].CounterpartyUsername != "carol" {
+		t.Fatalf("invites = %+v", archive.Invites)
+	}
+	if len(archive.Sessions) != 1 || archive.Sessions[0].DeviceLabel != "laptop" {
+		t.Fatalf("sessions = %+v", archive.Sessions)
+	}
+	if len(archive.Devices) != 1 || archive.Devices[0].IdentityKey != "ik" {
+		t.Fatalf("devices = %+v", archive.Devices)
+	}
+	if len(archive.Messages) != 2 || archive.Messages[0].Direction != "sent" || archive.Messages[1].Direction != "received" ||
+		archive.Messages[1].FromUsername != "bob" || archive.Messages[0].DeliveredAt == nil {
+		t.Fatalf("messages = %+v", archive.Messages)
+	}
+	if archive.Wallet.BalanceCents != 700 || len(archive.Transfers) != 1 || archive.Transfers[0].Direction != "sent" ||
+		archive.Transfers[0].CounterpartyUsername != "bob" || archive.Transfers[0].AmountCents != 300 {
+		t.Fatalf("wallet = %+v, transfers = %+v", archive.Wallet, archive.Transfers)
+	}
+	if archive.Notifications != nil || archive.Identities == nil {
+		t.Fatalf("optional sections = %+v, %+v", archive.Notifications, archive.Identities)
+	}
+}
+
+func TestAdapter_ExportLifecycle(t *testing.T) {
+	s, a := newAccountStore(t)
+	alice := seedUser(t, s, "alice")
+	bob := seedUser(t, s, "bob")
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	if _, err := a.LatestExport(ctx, alice); !errors.Is(err, coreaccount.ErrExportNotFound) {
+		t.Fatalf("LatestExport err = %v", err)
+	}
+	export, err := a.CreateExport(ctx, alice, now)
+	if err != nil || export.Status != coreaccount.ExportPending {
+		t.Fatalf("CreateExport = %+v, %v", export, err)
+	}
+	if _, err := a.GetExport(ctx, bob, export.ID); !errors.Is(err, coreaccount.ErrExportNotFound) {
+		t.Fatalf("another user's export err = %v", err)
+	}
+
+	claimed, err := a.ClaimPendingExports(ctx, now, now.Add(time.Minute), 10)
+	if err != nil || len(claimed) != 1 || claimed[0].Attempts != 1 || claimed[0].Status != coreaccount.ExportRunning {
+		t.Fatalf("claim = %+v, %v", claimed, err)
+	}
+	if again, err := a.ClaimPendingExports(ctx, now, now.Add(time.Minute), 10); err != nil || len(again) != 0 {
+		t.Fatalf("leased export claimed again: %+v, %v", again, err)
+	}
+	if stale, err := a.ClaimPendingExports(ctx, now.Add(2*time.Minute), now.Add(3*time.Minute), 10); err != nil || len(stale) != 1 || stale[0].Attempts != 2 {
+		t.Fatalf("expired lease not reclaimed: %+v, %v", stale, err)
+	}
+
+	if _, err := a.ReadArchive(ctx, alice, export.ID); !errors.Is(err, coreaccount.ErrExportNotFound) {
+		t.Fatalf("archive before ready err = %v", err)
+	}
+	if err := a.CompleteExport(ctx, export.ID, []byte(`{"ok":true}`), now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	ready, err := a.LatestExport(ctx, alice)
+	if err != nil || ready.Status != coreaccount.ExportReady || ready.SizeBytes != 11 || ready.ExpiresAt == nil {
+		t.Fatalf("ready export = %+v, %v", ready, err)
+	}
+	if archive, err := a.ReadArchive(ctx, alice, export.ID); err != nil || string(archive) != `{"ok":true}` {
+		t.Fatalf("ReadArchive = %q, %v", archive, err)
+	}
+
+	failed, err := a.CreateExport(ctx, bob, now.Add(-coreaccount.ExportTTL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.FailExport(ctx, failed.ID, "boom", true); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := a.DeleteExpiredExports(ctx, now.Add(2*time.Hour)); err != nil || n != 2 {
+		t.Fatalf("DeleteExpiredExports = %d, %v", n, err)
+	}
+}
+
+func TestAdapter_DeleteAccount_AnonymizesAndKeepsLedger(t *testing.T) {
+	s, a := newAccountStore(t)
+	alice := seedUser(t, s, "alice")
+	bob := seedUser(t, s, "bob")
+	carol := seedUser(t, s, "carol")
+	bot := seedActivity(t, s, alice, bob, carol)
+	ctx := context.Background()
+
+	creds, err := a.GetCredentials(ctx, alice)
+	if err != nil || creds.Username != "alice" || creds.PasswordHash == "" {
+		t.Fatalf("GetCredentials = %+v, %v", creds, err)
+	}
+	deletion, err := a.DeleteAccount(ctx, alice, time.Now())
+	if err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	if deletion.Username != "alice" || len(deletion.RevokedSessionIDs) != 1 || deletion.TombstonedMessages != 2 ||
+		len(deletion.BotUserIDs) != 1 || deletion.BotUserIDs[0] != bot {
+		t.Fatalf("deletion = %+v", deletion)
+	}
+
+	var username, hash string
+	if err := s.DB.QueryRow(`SELECT username, password_hash FROM users WHERE id = ? AND deleted_at IS NOT NULL`, alice).Scan(&username, &hash); err != nil {
+		t.Fatal(err)
+	}
+	if username != coreaccount.DeletedUsername(alice) || hash != "" {
+		t.Fatalf("users row = %q/%q", username, hash)
+	}
+	if _, err := s.GetUserByUsername("alice"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("old username still resolves: %v", err)
+	}
+	if _, err := s.GetUserByUsername(username); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("deleted username resolves: %v", err)
+	}
+	if _, err := a.GetCredentials(ctx, alice); !errors.Is(err, coreaccount.ErrAccountNotFound) {
+		t.Fatalf("deleted credentials err = %v", err)
+	}
+	if _, err := a.DeleteAccount(ctx, alice, time.Now()); !errors.Is(err, coreaccount.ErrAccountNotFound) {
+		t.Fatalf("second deletion err = %v", err)
+	}
+
+	for _, check := range []struct {
+		query string
+		args  []any
+		want  int
+	}{
+		{`SELECT COUNT(*) FROM messages`, nil, 3},
+		{`SELECT COUNT(*) FROM messages WHERE content_kind = 'deleted' AND body = '' AND ciphertext = ''`, nil, 2},
+		{`SELECT COUNT(*) FROM message_deliveries`, nil, 2},
+		{`SELECT COUNT(*) FROM contacts`, nil, 0},
+		{`SELECT COUNT(*) FROM contact_invites`, nil, 0},
+		{`SELECT COUNT(*) FROM auth_sessions`, nil, 0},
+		{`SELECT COUNT(*) FROM device_identities`, nil, 0},
+		{`SELECT COUNT(*) FROM api_tokens`, nil, 0},
+		{`SELECT COUNT(*) FROM bot_accounts`, nil, 0},
+		{`SELECT COUNT(*) FROM wallet_transfers`, nil, 1},
+		{`SELECT COUNT(*) FROM wallet_accounts`, nil, 2},
+		{`SELECT COUNT(*) FROM users WHERE deleted_at IS NOT NULL`, nil, 2},
+		{`SELECT COUNT(*) FROM message_purges`, nil, 0},
+	} {
+		if got := count(t, s, check.query, check.args...); got != check.want {
+			t.Fatalf("%s %v = %d, want %d", check.query, check.args, got, check.want)
+		}
+	}
+}
+
+func TestAdapter_DeleteAccount_PeerKeepsConversationWithTombstones(t *testing.T) {
+	s, a := newAccountStore(t)
+	alice := seedUser(t, s, "alice")
+	bob := seedUser(t, s, "bob")
+	ctx := context.Background()
+	messages := &sqlitemessaging.Adapter{DB: s.DB}
+
+	sent, err := messages.SaveDirectMessage(ctx, coremsg.StoredMessage{FromUserID: alice, ToUserID: bob, Body: "secret plans", CreatedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := messages.SaveDirectMessage(ctx, coremsg.StoredMessage{FromUserID: bob, ToUserID: alice, Body: "sounds good", CreatedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.DeleteAccount(ctx, alice, time.Now()); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+
+	inbox, err := messages.ListInboxWithUser(ctx, bob, alice, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox) != 1 || inbox[0].ID != sent.ID || inbox[0].ContentKind != coremsg.ContentKindDeleted || inbox[0].Body != "" {
+		t.Fatalf("bob's inbox from alice = %+v, want one tombstone", inbox)
+	}
+	outbox, err := messages.ListOutbox(ctx, bob, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox) != 1 || outbox[0].ID != reply.ID || outbox[0].Body != "sounds good" || outbox[0].ToUserID != alice {
+		t.Fatalf("bob's outbox = %+v, want his reply intact", outbox)
+	}
+	if purged, err := messages.ListPurgedMessagesAfter(ctx, bob, 0, 10); err != nil || len(purged) != 0 {
+		t.Fatalf("bob's purge log = %+v, %v, want empty", purged, err)
+	}
+}
+
+func TestAdapter_DeleteAccount_RemovesAttachmentFiles(t *testing.T) {
+	s, a := newAccountStore(t)
+	alice := seedUser(t, s, "alice")
+	bob := seedUser(t, s, "bob")
+	ctx := context.Background()
+
+	root := t.TempDir()
+	blobs, err := fsblob.New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(body string) string {
+		t.Helper()
+		info, err := blobs.Put(ctx, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ID
+	}
+	own, thumb, shared := put("alice only"), put("thumbnail"), put("sent by both")
+	exec(t, s, `
+		INSERT INTO attachments (owner_user_id, blob_id, mime_type, size_bytes)
+		VALUES (?, ?, 'image/png', 10), (?, ?, 'text/plain', 12), (?, ?, 'text/plain', 12)
+	`, alice, own, alice, shared, bob, shared)
+	exec(t, s, `
+		INSERT INTO attachment_media (attachment_id, status, thumbnail_blob_id)
+		SELECT id, 'ready', ? FROM attachments WHERE blob_id = ?
+	`, thumb, own)
+	exec(t, s, `INSERT INTO attachment_uploads (owner_user_id, mime_type, size_bytes) VALUES (?, 'text/plain', 8)`, alice)
+	var uploadID int64
+	if err := s.DB.QueryRow(`SELECT id FROM attachment_uploads WHERE owner_user_id = ?`, alice).Scan(&uploadID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.WriteChunk(ctx, uploadID, 0, strings.NewReader("partial")); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := coreaccount.NewServiceWithBlobs(a, passwordbcrypt.Verifier{}, blobs)
+	deletion, err := svc.DeleteAccount(ctx, alice, "password123", "alice")
+	if err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	if len(deletion.BlobIDs) != 2 || len(deletion.UploadIDs) != 1 || deletion.UploadIDs[0] != uploadID || deletion.BlobCleanupFailures != 0 {
+		t.Fatalf("deletion = %+v", deletion)
+	}
+
+	for _, blobID := range []string{own, thumb} {
+		if _, err := blobs.Open(ctx, blobID); !errors.Is(err, coreatt.ErrAttachmentNotFound) {
+			t.Fatalf("blob %s still readable: %v", blobID, err)
+		}
+	}
+	r, err := blobs.Open(ctx, shared)
+	if err != nil {
+		t.Fatalf("shared blob removed: %v", err)
+	}
+	_ = r.Close()
+	if _, err := os.Stat(filepath.Join(root, "staging", strconv.FormatInt(uploadID, 10)+".part")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("staged upload still present: %v", err)
+	}
+	if got := count(t, s, `SELECT COUNT(*) FROM attachments`); got != 1 {
+		t.Fatalf("attachments left = %d", got)
+	}
+}
@@ -0,0 +1,220 @@
+package sqliteaccount
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	coreaccount "github.com/kyambuthia/go-chat-site/server/internal/core/account"
+)
+
+// CollectArchive reads each section with its own query. It does not hold a
+// transaction, so a user active during the export may see sections taken a
+// moment apart.
+func (a *Adapter) CollectArchive(ctx context.Context, userID int) (coreaccount.Archive, error) {
+	archive := coreaccount.Archive{
+		Contacts:   make([]coreaccount.ArchiveContact, 0),
+		Invites:    make([]coreaccount.ArchiveInvite, 0),
+		Sessions:   make([]coreaccount.ArchiveSession, 0),
+		Devices:    make([]coreaccount.ArchiveDevice, 0),
+		Messages:   make([]coreaccount.ArchiveMessage, 0),
+		Transfers:  make([]coreaccount.ArchiveTransfer, 0),
+		Identities: make([]coreaccount.ArchiveIdentity, 0),
+	}
+
+	var created sql.NullTime
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT id, username, COALESCE(display_name, ''), COALESCE(avatar_url, ''), created_at
+		FROM users WHERE id = ? AND deleted_at IS NULL
+	`, userID).Scan(&archive.Profile.UserID, &archive.Profile.Username, &archive.Profile.DisplayName, &archive.Profile.AvatarURL, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return coreaccount.Archive{}, coreaccount.ErrAccountNotFound
+	}
+	if err != nil {
+		return coreaccount.Archive{}, err
+	}
+	archive.Profile.CreatedAt = created.Time
+
+	if err := a.each(ctx, func(row rowScanner) error {
+		var c coreaccount.ArchiveContact
+		if err := row.Scan(&c.UserID, &c.Username, &c.DisplayName); err != nil {
+			return err
+		}
+		archive.Contacts = append(archive.Contacts, c)
+		return nil
+	}, `
+		SELECT u.id, u.username, COALESCE(u.display_name, '')
+		FROM contacts c
+		JOIN users u ON u.id = c.contact_id
+		WHERE c.user_id = ?
+		ORDER BY u.username
+	`, userID); err != nil {
+		return coreaccount.Archive{}, err
+	}
+
+	if err := a.each(ctx, func(row rowScanner) error {
+		var inv coreaccount.ArchiveInvite
+		if err := row.Scan(&inv.ID, &inv.Direction, &inv.CounterpartyUsername, &inv.Status, &inv.CreatedAt, &inv.UpdatedAt); err != nil {
+			return err
+		}
+		archive.Invites = append(archive.Invites, inv)
+		return nil
+	}, `
+		SELECT ci.id, CASE WHEN ci.requester_id = ? THEN 'sent' ELSE 'received' END, u.username, ci.status, ci.created_at, ci.updated_at
+		FROM contact_invites ci
+		JOIN users u ON u.id = CASE WHEN ci.requester_id = ? THEN ci.recipient_id ELSE ci.requester_id END
+		WHERE ci.requester_id = ? OR ci.recipient_id = ?
+		ORDER BY ci.id
+	`, userID, userID, userID, userID); err != nil {
+		return coreaccount.Archive{}, err
+	}
+
+	if err := a.each(ctx, func(row rowScanner) error {
+		var s coreaccount.ArchiveSession
+		var revoked sql.NullTime
+		if err := row.Scan(&s.ID, &s.DeviceLabel, &s.UserAgent, &s.LastSeenIP, &s.CreatedAt, &s.LastSeenAt, &revoked, &s.RevokeReason); err != nil {
+			return err
+		}
+		s.RevokedAt = nullTimePtr(revoked)
+		archive.Sessions = append(archive.Sessions, s)
+		return nil
+	}, `
+		SELECT id, device_label, user_agent, last_seen_ip, created_at, last_seen_at, revoked_at, revoke_reason
+		FROM auth_sessions
+		WHERE user_id = ?
+		ORDER BY id
+	`, userID); err != nil {
+		return coreaccount.Archive{}, err
+	}
+
+	if err := a.each(ctx, func(row rowScanner) error {
+		var d coreaccount.ArchiveDevice
+		var revoked sql.NullTime
+		if err := row.Scan(&d.ID, &d.Label, &d.Algorithm, &d.IdentityKey, &d.State, &d.CreatedAt, &revoked); err != nil {
+			return err
+		}
+		d.RevokedAt = nullTimePtr(revoked)
+		archive.Devices = append(archive.Devices, d)
+		return nil
+	}, `
+		SELECT id, label, algorithm, identity_key, key_state, created_at, revoked_at
+		FROM device_identities
+		WHERE user_id = ?
+		ORDER BY id
+	`, userID); err != nil {
+		return coreaccount.Archive{}, err
+	}
+
+	attachments := map[int64][]int64{}
+	if err := a.each(ctx, func(row rowScanner) error {
+		var messageID, attachmentID int64
+		if err := row.Scan(&messageID, &attachmentID); err != nil {
+			return err
+		}
+		attachments[messageID] = append(attachments[messageID], attachmentID)
+		return nil
+	}, `
+		SELECT ma.message_id, ma.attachment_id
+		FROM message_attachments ma
+		JOIN messages m ON m.id = ma.message_id
+		WHERE m.from_user_id = ? OR m.to_user_id = ?
+		ORDER BY ma.message_id, ma.position, ma.attachment_id
+	`, userID, userID); err != nil {
+		return coreaccount.Archive{}, err
+	}
+
+	if err := a.each(ctx, func(row rowScanner) error {
+		var m coreaccount.ArchiveMessage
+		var fromUserID int
+		var delivered, read, expires sql.NullTime
+		if err := row.Scan(&m.ID, &fromUserID, &m.FromUsername, &m.ToUsername, &m.Body, &m.Ciphertext, &m.EnvelopeVersion,
+			&m.ContentKind, &m.CreatedAt, &delivered, &read, &expires); err != nil {
+			return err
+		}
+		m.Direction = "received"
+		if fromUserID == userID {
+			m.Direction = "sent"
+		}
+		m.DeliveredAt = nullTimePtr(delivered)
+		m.ReadAt = nullTimePtr(read)
+		m.ExpiresAt = nullTimePtr(expires)
+		m.AttachmentIDs = attachments[m.ID]
+		archive.Messages = append(archive.Messages, m)
+		return nil
+	}, `
+		SELECT m.id, m.from_user_id, fu.username, tu.username, m.body, m.ciphertext, m.encryption_version,
+			m.content_kind, m.created_at, md.delivered_at, md.read_at, m.expires_at
+		FROM messages m
+		JOIN users fu ON fu.id = m.from_user_id
+		JOIN users tu ON tu.id = m.to_user_id
+		LEFT JOIN message_deliveries md ON md.message_id = m.id
+		WHERE m.from_user_id = ? OR m.to_user_id = ?
+		ORDER BY m.id
+	`, userID, userID); err != nil {
+		return coreaccount.Archive{}, err
+	}
+
+	err = a.DB.QueryRowContext(ctx, `SELECT balance_cents FROM wallet_accounts WHERE user_id = ?`, userID).Scan(&archive.Wallet.BalanceCents)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return coreaccount.Archive{}, err
+	}
+
+	if err := a.each(ctx, func(row rowScanner) error {
+		var t coreaccount.ArchiveTransfer
+		if err := row.Scan(&t.ID, &t.Direction, &t.CounterpartyUsername, &t.AmountCents, &t.Note, &t.CreatedAt); err != nil {
+			return err
+		}
+		archive.Transfers = append(archive.Transfers, t)
+		return nil
+	}, `
+		SELECT wt.id, CASE WHEN wt.sender_user_id = ? THEN 'sent' ELSE 'received' END, u.username,
+			wt.amount_cents, wt.note, wt.created_at
+		FROM wallet_transfers wt
+		JOIN users u ON u.id = CASE WHEN wt.sender_user_id = ? THEN wt.recipient_user_id ELSE wt.sender_user_id END
+		WHERE wt.sender_user_id = ? OR wt.recipient_user_id = ?
+		ORDER BY wt.id
+	`, userID, userID, userID, userID); err != nil {
+		return coreaccount.Archive{}, err
+	}
+
+	if err := a.each(ctx, func(row rowScanner) error {
+		var id coreaccount.ArchiveIdentity
+		if err := row.Scan(&id.Issuer, &id.Email, &id.CreatedAt); err != nil {
+			return err
+		}
+		archive.Identities = append(archive.Identities, id)
+		return nil
+	}, `
+		SELECT issuer, email, created_at FROM user_external_identities WHERE user_id = ? ORDER BY id
+	`, userID); err != nil {
+		return coreaccount.Archive{}, err
+	}
+
+	var prefs coreaccount.ArchiveNotification
+	err = a.DB.QueryRowContext(ctx, `
+		SELECT email, email_verified_at IS NOT NULL, digest_enabled, digest_frequency
+		FROM notification_preferences WHERE user_id = ?
+	`, userID).Scan(&prefs.Email, &prefs.EmailVerified, &prefs.DigestEnabled, &prefs.Frequency)
+	switch {
+	case err == nil:
+		archive.Notifications = &prefs
+	case !errors.Is(err, sql.ErrNoRows):
+		return coreaccount.Archive{}, err
+	}
+
+	return archive, nil
+}
+
+func (a *Adapter) each(ctx context.Context, scan func(rowScanner) error, query string, args ...any) error {
+	rows, err := a.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
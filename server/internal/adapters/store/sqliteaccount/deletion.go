@@ -0,0 +1,255 @@
+package sqliteaccount
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	coreaccount "github.com/kyambuthia/go-chat-site/server/internal/core/account"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+func (a *Adapter) GetCredentials(ctx context.Context, userID int) (coreaccount.Credentials, error) {
+	creds := coreaccount.Credentials{UserID: userID}
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT username, password_hash FROM users WHERE id = ? AND deleted_at IS NULL
+	`, userID).Scan(&creds.Username, &creds.PasswordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return coreaccount.Credentials{}, coreaccount.ErrAccountNotFound
+	}
+	if err != nil {
+		return coreaccount.Credentials{}, err
+	}
+	return creds, nil
+}
+
+// erasureStatements remove everything a deleted user owns apart from the
+// users row and the ledger. ?1 is the user ID. The users row is tombstoned
+// rather than deleted, so ON DELETE CASCADE never fires and each table is
+// cleared here.
+var erasureStatements = []string{
+	`DELETE FROM message_client_correlations WHERE sender_user_id = ?1 OR recipient_user_id = ?1`,
+	`DELETE FROM message_attachments WHERE attachment_id IN (SELECT id FROM attachments WHERE owner_user_id = ?1)`,
+	`DELETE FROM attachment_media WHERE attachment_id IN (SELECT id FROM attachments WHERE owner_user_id = ?1)`,
+	`DELETE FROM attachments WHERE owner_user_id = ?1`,
+	`DELETE FROM attachment_uploads WHERE owner_user_id = ?1`,
+	`DELETE FROM contacts WHERE user_id = ?1 OR contact_id = ?1`,
+	`DELETE FROM contact_invites WHERE requester_id = ?1 OR recipient_id = ?1`,
+	`DELETE FROM push_jobs WHERE user_id = ?1 OR peer_user_id = ?1 OR subscription_id IN (SELECT id FROM push_subscriptions WHERE user_id = ?1)`,
+	`DELETE FROM push_subscriptions WHERE user_id = ?1`,
+	`DELETE FROM push_settings WHERE user_id = ?1`,
+	`DELETE FROM push_mutes WHERE user_id = ?1 OR peer_user_id = ?1`,
+	`DELETE FROM device_sessions WHERE device_identity_id IN (SELECT id FROM device_identities WHERE user_id = ?1)
+		OR auth_session_id IN (SELECT id FROM auth_sessions WHERE user_id = ?1)`,
+	`DELETE FROM device_prekeys WHERE device_identity_id IN (SELECT id FROM device_identities WHERE user_id = ?1)`,
+	`DELETE FROM device_identities WHERE user_id = ?1`,
+	`DELETE FROM auth_refresh_token_history WHERE session_id IN (SELECT id FROM auth_sessions WHERE user_id = ?1)`,
+	`DELETE FROM auth_sessions WHERE user_id = ?1`,
+	`DELETE FROM user_totp WHERE user_id = ?1`,
+	`DELETE FROM user_recovery_codes WHERE user_id = ?1`,
+	`DELETE FROM auth_mfa_challenges WHERE user_id = ?1`,
+	`DELETE FROM webauthn_credentials WHERE user_id = ?1`,
+	`DELETE FROM webauthn_challenges WHERE user_id = ?1`,
+	`DELETE FROM webauthn_user_handles WHERE user_id = ?1`,
+	`DELETE FROM password_reset_tokens WHERE user_id = ?1`,
+	`DELETE FROM user_external_identities WHERE user_id = ?1`,
+	`DELETE FROM oidc_login_states WHERE user_id = ?1`,
+	`DELETE FROM api_tokens WHERE user_id = ?1`,
+	`DELETE FROM webhook_deliveries WHERE endpoint_id IN (SELECT id FROM webhook_endpoints WHERE user_id = ?1)`,
+	`DELETE FROM webhook_endpoints WHERE user_id = ?1`,
+	`DELETE FROM notification_preferences WHERE user_id = ?1`,
+	`DELETE FROM thread_retention_settings WHERE user_low_id = ?1 OR user_high_id = ?1 OR updated_by_user_id = ?1`,
+	`DELETE FROM message_purges WHERE user_id = ?1`,
+	`DELETE FROM account_exports WHERE user_id = ?1`,
+	`DELETE FROM bot_accounts WHERE user_id = ?1 OR owner_user_id = ?1`,
+}
+
+// DeleteAccount tombstones the messages the user sent, erases the user's
+// other data and renames the users row. Both sides of every conversation
+// stay in place, pointing at the renamed row, so the peer keeps their own
+// messages and sees where the deleted user's were. Bots the user owned are
+// deleted the same way.
+func (a *Adapter) DeleteAccount(ctx context.Context, userID int, at time.Time) (coreaccount.Deletion, error) {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return coreaccount.Deletion{}, err
+	}
+	defer tx.Rollback()
+
+	deletion := coreaccount.Deletion{UserID: userID}
+	err = tx.QueryRowContext(ctx, `SELECT username FROM users WHERE id = ? AND deleted_at IS NULL`, userID).Scan(&deletion.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return coreaccount.Deletion{}, coreaccount.ErrAccountNotFound
+	}
+	if err != nil {
+		return coreaccount.Deletion{}, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT b.user_id FROM bot_accounts b JOIN users u ON u.id = b.user_id
+		WHERE b.owner_user_id = ? AND u.deleted_at IS NULL
+		ORDER BY b.user_id
+	`, userID)
+	if err != nil {
+		return coreaccount.Deletion{}, err
+	}
+	for rows.Next() {
+		var botID int
+		if err := rows.Scan(&botID); err != nil {
+			rows.Close()
+			return coreaccount.Deletion{}, err
+		}
+		deletion.BotUserIDs = append(deletion.BotUserIDs, botID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return coreaccount.Deletion{}, err
+	}
+
+	at = at.UTC()
+	var blobIDs []string
+	for _, id := range append([]int{userID}, deletion.BotUserIDs...) {
+		blobs, uploads, err := attachmentFiles(ctx, tx, id)
+		if err != nil {
+			return coreaccount.Deletion{}, err
+		}
+		blobIDs = append(blobIDs, blobs...)
+		deletion.UploadIDs = append(deletion.UploadIDs, uploads...)
+
+		sessionIDs, tombstoned, err := eraseUser(ctx, tx, id, at)
+		if err != nil {
+			return coreaccount.Deletion{}, err
+		}
+		deletion.RevokedSessionIDs = append(deletion.RevokedSessionIDs, sessionIDs...)
+		deletion.TombstonedMessages += tombstoned
+	}
+	deletion.BlobIDs, err = unreferencedBlobs(ctx, tx, blobIDs)
+	if err != nil {
+		return coreaccount.Deletion{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return coreaccount.Deletion{}, err
+	}
+	return deletion, nil
+}
+
+func eraseUser(ctx context.Context, tx *sql.Tx, userID int, at time.Time) ([]int64, int, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM auth_sessions WHERE user_id = ? AND revoked_at IS NULL ORDER BY id`, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	var sessionIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		sessionIDs = append(sessionIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM message_attachments WHERE message_id IN (SELECT id FROM messages WHERE from_user_id = ?)
+	`, userID); err != nil {
+		return nil, 0, err
+	}
+	result, err := tx.ExecContext(ctx, `
+		UPDATE messages
+		SET body = '', ciphertext = '', encryption_version = '', content_kind = ?,
+			sender_device_id = 0, recipient_device_id = 0
+		WHERE from_user_id = ?
+	`, coremsg.ContentKindDeleted, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	tombstoned, err := result.RowsAffected()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, stmt := range erasureStatements {
+		if _, err := tx.ExecContext(ctx, stmt, userID); err != nil {
+			return nil, 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET username = ?, password_hash = '', display_name = NULL, avatar_url = NULL, deleted_at = ?
+		WHERE id = ?
+	`, coreaccount.DeletedUsername(userID), at, userID); err != nil {
+		return nil, 0, err
+	}
+	return sessionIDs, int(tombstoned), nil
+}
+
+// attachmentFiles lists the blobs behind the user's attachments and
+// thumbnails, and the user's unfinished uploads.
+func attachmentFiles(ctx context.Context, tx *sql.Tx, userID int) ([]string, []int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT blob_id FROM attachments WHERE owner_user_id = ?1
+		UNION
+		SELECT m.thumbnail_blob_id FROM attachment_media m
+		JOIN attachments a ON a.id = m.attachment_id
+		WHERE a.owner_user_id = ?1 AND m.thumbnail_blob_id != ''
+	`, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var blobIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		blobIDs = append(blobIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT id FROM attachment_uploads WHERE owner_user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var uploadIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, nil, err
+		}
+		uploadIDs = append(uploadIDs, id)
+	}
+	return blobIDs, uploadIDs, rows.Err()
+}
+
+// unreferencedBlobs keeps the blobs no remaining attachment or thumbnail
+// uses. Identical files share a blob, so another user's copy keeps it.
+func unreferencedBlobs(ctx context.Context, tx *sql.Tx, blobIDs []string) ([]string, error) {
+	seen := make(map[string]bool, len(blobIDs))
+	var out []string
+	for _, id := range blobIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		var used bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM attachments WHERE blob_id = ?1)
+				OR EXISTS (SELECT 1 FROM attachment_media WHERE thumbnail_blob_id = ?1)
+		`, id).Scan(&used); err != nil {
+			return nil, err
+		}
+		if !used {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
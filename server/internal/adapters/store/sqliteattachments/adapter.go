@@ -0,0 +1,290 @@
+package sqliteattachments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+)
+
+type Adapter struct {
+	DB *sql.DB
+}
+
+var (
+	_ coreatt.Repository      = (*Adapter)(nil)
+	_ coreatt.MediaRepository = (*Adapter)(nil)
+)
+
+func (a *Adapter) CreateUpload(ctx context.Context, upload coreatt.Upload) (coreatt.Upload, error) {
+	now := time.Now().UTC()
+	result, err := a.DB.ExecContext(ctx, `
+		INSERT INTO attachment_uploads (
+			owner_user_id, file_name, mime_type, size_bytes, received_bytes, encrypted, created_at, updated_at
+		) VALUES (?, ?, ?, ?, 0, ?, ?, ?)
+	`, upload.OwnerUserID, upload.FileName, upload.MimeType, upload.SizeBytes, boolToInt(upload.Encrypted), now, now)
+	if err != nil {
+		return coreatt.Upload{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return coreatt.Upload{}, err
+	}
+	return a.GetUpload(ctx, upload.OwnerUserID, id)
+}
+
+func (a *Adapter) GetUpload(ctx context.Context, ownerUserID int, uploadID int64) (coreatt.Upload, error) {
+	var upload coreatt.Upload
+	var encrypted int
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT id, owner_user_id, file_name, mime_type, size_bytes, received_bytes, encrypted, created_at
+		FROM attachment_uploads
+		WHERE id = ? AND owner_user_id = ?
+	`, uploadID, ownerUserID).Scan(
+		&upload.ID,
+		&upload.OwnerUserID,
+		&upload.FileName,
+		&upload.MimeType,
+		&upload.SizeBytes,
+		&upload.ReceivedBytes,
+		&encrypted,
+		&upload.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreatt.Upload{}, coreatt.ErrUploadNotFound
+		}
+		return coreatt.Upload{}, err
+	}
+	upload.Encrypted = encrypted != 0
+	return upload, nil
+}
+
+func (a *Adapter) SetUploadReceivedBytes(ctx context.Context, uploadID int64, from, to int64) error {
+	result, err := a.DB.ExecContext(ctx, `
+		UPDATE attachment_uploads
+		SET received_bytes = ?, updated_at = ?
+		WHERE id = ? AND received_bytes = ?
+	`, to, time.Now().UTC(), uploadID, from)
+	if err != nil {
+		return err
+	}
+	if err := requireRowAffected(result, coreatt.ErrChunkOutOfOrder); !errors.Is(err, coreatt.ErrChunkOutOfOrder) {
+		return err
+	}
+	var exists int
+	err = a.DB.QueryRowContext(ctx, `SELECT 1 FROM attachment_uploads WHERE id = ?`, uploadID).Scan(&exists)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return coreatt.ErrUploadNotFound
+	case err != nil:
+		return err
+	}
+	return coreatt.ErrChunkOutOfOrder
+}
+
+func (a *Adapter) DeleteUpload(ctx context.Context, uploadID int64) error {
+	_, err := a.DB.ExecContext(ctx, `DELETE FROM attachment_uploads WHERE id = ?`, uploadID)
+	return err
+}
+
+func (a *Adapter) CreateAttachment(ctx context.Context, attachment coreatt.Attachment) (coreatt.Attachment, error) {
+	result, err := a.DB.ExecContext(ctx, `
+		INSERT INTO attachments (
+			owner_user_id, blob_id, file_name, mime_type, size_bytes, encrypted, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, attachment.OwnerUserID, attachment.BlobID, attachment.FileName, attachment.MimeType, attachment.SizeBytes, boolToInt(attachment.Encrypted), time.Now().UTC())
+	if err != nil {
+		return coreatt.Attachment{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return coreatt.Attachment{}, err
+	}
+	return a.GetAttachment(ctx, id)
+}
+
+func (a *Adapter) GetAttachment(ctx context.Context, attachmentID int64) (coreatt.Attachment, error) {
+	var attachment coreatt.Attachment
+	var encrypted int
+	var mediaStatus, placeholder, thumbnailBlobID, thumbnailMimeType, lastError sql.NullString
+	var width, height, attempts sql.NullInt64
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT a.id, a.owner_user_id, a.blob_id, a.file_name, a.mime_type, a.size_bytes, a.encrypted, a.created_at,
+		       m.status, m.width, m.height, m.placeholder, m.thumbnail_blob_id, m.thumbnail_mime_type, m.attempts, m.last_error
+		FROM attachments a
+		LEFT JOIN attachment_media m ON m.attachment_id = a.id
+		WHERE a.id = ?
+	`, attachmentID).Scan(
+		&attachment.ID,
+		&attachment.OwnerUserID,
+		&attachment.BlobID,
+		&attachment.FileName,
+		&attachment.MimeType,
+		&attachment.SizeBytes,
+		&encrypted,
+		&attachment.CreatedAt,
+		&mediaStatus,
+		&width,
+		&height,
+		&placeholder,
+		&thumbnailBlobID,
+		&thumbnailMimeType,
+		&attempts,
+		&lastError,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreatt.Attachment{}, coreatt.ErrAttachmentNotFound
+		}
+		return coreatt.Attachment{}, err
+	}
+	attachment.Encrypted = encrypted != 0
+	if mediaStatus.Valid {
+		attachment.Media = &coreatt.Media{
+			AttachmentID:      attachment.ID,
+			Status:            coreatt.MediaStatus(mediaStatus.String),
+			Width:             int(width.Int64),
+			Height:            int(height.Int64),
+			Placeholder:       placeholder.String,
+			ThumbnailBlobID:   thumbnailBlobID.String,
+			ThumbnailMimeType: thumbnailMimeType.String,
+			Attempts:          int(attempts.Int64),
+			LastError:         lastError.String,
+		}
+	}
+	return attachment, nil
+}
+
+// CanAccessAttachment allows the uploader plus both participants of any message
+// that references the attachment.
+func (a *Adapter) CanAccessAttachment(ctx context.Context, userID int, attachmentID int64) (bool, error) {
+	var exists int
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT 1
+		FROM attachments a
+		WHERE a.id = ?
+		  AND (
+		      a.owner_user_id = ?
+		      OR EXISTS (
+		          SELECT 1
+		          FROM message_attachments ma
+		          JOIN messages m ON m.id = ma.message_id
+		          WHERE ma.attachment_id = a.id
+		            AND (m.from_user_id = ? OR m.to_user_id = ?)
+		      )
+		  )
+	`, attachmentID, userID, userID, userID).Scan(&exists)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return false, err
+}
+
+// UsageBytes counts completed attachments plus space reserved by pending uploads.
+func (a *Adapter) UsageBytes(ctx context.Context, ownerUserID int) (int64, error) {
+	var used int64
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT
+			COALESCE((SELECT SUM(size_bytes) FROM attachments WHERE owner_user_id = ?), 0) +
+			COALESCE((SELECT SUM(size_bytes) FROM attachment_uploads WHERE owner_user_id = ?), 0)
+	`, ownerUserID, ownerUserID).Scan(&used)
+	return used, err
+}
+
+func (a *Adapter) EnqueueMedia(ctx context.Context, attachmentID int64) error {
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT OR IGNORE INTO attachment_media (attachment_id, status, created_at, updated_at)
+		VALUES (?, 'pending', ?, ?)
+	`, attachmentID, time.Now().UTC(), time.Now().UTC())
+	return err
+}
+
+func (a *Adapter) ListPendingMedia(ctx context.Context, limit int) ([]int64, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT attachment_id
+		FROM attachment_media
+		WHERE status = 'pending'
+		ORDER BY attachment_id ASC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (a *Adapter) GetMedia(ctx context.Context, attachmentID int64) (coreatt.Media, error) {
+	var media coreatt.Media
+	var status string
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT attachment_id, status, width, height, placeholder, thumbnail_blob_id, thumbnail_mime_type, attempts, last_error
+		FROM attachment_media
+		WHERE attachment_id = ?
+	`, attachmentID).Scan(
+		&media.AttachmentID,
+		&status,
+		&media.Width,
+		&media.Height,
+		&media.Placeholder,
+		&media.ThumbnailBlobID,
+		&media.ThumbnailMimeType,
+		&media.Attempts,
+		&media.LastError,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreatt.Media{}, coreatt.ErrMediaNotFound
+		}
+		return coreatt.Media{}, err
+	}
+	media.Status = coreatt.MediaStatus(status)
+	return media, nil
+}
+
+func (a *Adapter) SaveMedia(ctx context.Context, media coreatt.Media) error {
+	result, err := a.DB.ExecContext(ctx, `
+		UPDATE attachment_media
+		SET status = ?, width = ?, height = ?, placeholder = ?, thumbnail_blob_id = ?,
+		    thumbnail_mime_type = ?, attempts = ?, last_error = ?, updated_at = ?
+		WHERE attachment_id = ?
+	`, string(media.Status), media.Width, media.Height, media.Placeholder, media.ThumbnailBlobID,
+		media.ThumbnailMimeType, media.Attempts, media.LastError, time.Now().UTC(), media.AttachmentID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, coreatt.ErrMediaNotFound)
+}
+
+func requireRowAffected(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func boolToInt(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,177 @@
+package sqliteattachments
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+func newAttachmentsStore(t *testing.T) *store.SqliteStore {
+	t.Helper()
+	s, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.RunMigrations(s.DB, filepath.Join("..", "..", "..", "..", "migrations")); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func seedUser(t *testing.T, s *store.SqliteStore, username string) int {
+	t.Helper()
+	res, err := s.DB.Exec(`INSERT INTO users (username, password_hash) VALUES (?, ?)`, username, "test-hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+func TestAdapter_UploadLifecycleAndUsage(t *testing.T) {
+	s := newAttachmentsStore(t)
+	aliceID := seedUser(t, s, "alice")
+	bobID := seedUser(t, s, "bob")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+
+	upload, err := a.CreateUpload(ctx, coreatt.Upload{OwnerUserID: aliceID, FileName: "a.pdf", MimeType: "application/pdf", SizeBytes: 40})
+	if err != nil {
+		t.Fatalf("CreateUpload: %v", err)
+	}
+	if err := a.SetUploadReceivedBytes(ctx, upload.ID, 0, 20); err != nil {
+		t.Fatalf("SetUploadReceivedBytes: %v", err)
+	}
+	if err := a.SetUploadReceivedBytes(ctx, upload.ID, 0, 15); !errors.Is(err, coreatt.ErrChunkOutOfOrder) {
+		t.Fatalf("stale offset err = %v, want ErrChunkOutOfOrder", err)
+	}
+	got, err := a.GetUpload(ctx, aliceID, upload.ID)
+	if err != nil {
+		t.Fatalf("GetUpload: %v", err)
+	}
+	if got.ReceivedBytes != 20 || got.FileName != "a.pdf" {
+		t.Fatalf("upload = %+v, want received 20", got)
+	}
+	if _, err := a.GetUpload(ctx, bobID, upload.ID); !errors.Is(err, coreatt.ErrUploadNotFound) {
+		t.Fatalf("other owner err = %v, want ErrUploadNotFound", err)
+	}
+
+	if _, err := a.CreateAttachment(ctx, coreatt.Attachment{OwnerUserID: aliceID, BlobID: "blob", MimeType: "image/png", SizeBytes: 100, Encrypted: true}); err != nil {
+		t.Fatalf("CreateAttachment: %v", err)
+	}
+	used, err := a.UsageBytes(ctx, aliceID)
+	if err != nil {
+		t.Fatalf("UsageBytes: %v", err)
+	}
+	if used != 140 {
+		t.Fatalf("usage = %d, want 140 (attachments + pending uploads)", used)
+	}
+
+	if err := a.DeleteUpload(ctx, upload.ID); err != nil {
+		t.Fatalf("DeleteUpload: %v", err)
+	}
+	if err := a.SetUploadReceivedBytes(ctx, upload.ID, 20, 40); !errors.Is(err, coreatt.ErrUploadNotFound) {
+		t.Fatalf("deleted upload err = %v, want ErrUploadNotFound", err)
+	}
+}
+
+func TestAdapter_CanAccessAttachment_OwnerAndMessageParticipants(t *testing.T) {
+	s := newAttachmentsStore(t)
+	aliceID := seedUser(t, s, "alice")
+	bobID := seedUser(t, s, "bob")
+	carolID := seedUser(t, s, "carol")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+
+	attachment, err := a.CreateAttachment(ctx, coreatt.Attachment{OwnerUserID: aliceID, BlobID: "blob", MimeType: "image/png", SizeBytes: 10})
+	if err != nil {
+		t.Fatalf("CreateAttachment: %v", err)
+	}
+	if attachment.Encrypted || attachment.CreatedAt.IsZero() {
+		t.Fatalf("attachment = %+v, want plaintext with created_at", attachment)
+	}
+
+	assertAccess := func(userID int, want bool) {
+		t.Helper()
+		ok, err := a.CanAccessAttachment(ctx, userID, attachment.ID)
+		if err != nil {
+			t.Fatalf("CanAccessAttachment: %v", err)
+		}
+		if ok != want {
+			t.Fatalf("access for user %d = %v, want %v", userID, ok, want)
+		}
+	}
+	assertAccess(aliceID, true)
+	assertAccess(bobID, false)
+
+	res, err := s.DB.Exec(`INSERT INTO messages (from_user_id, to_user_id, body, content_kind) VALUES (?, ?, '', 'attachment')`, aliceID, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageID, _ := res.LastInsertId()
+	if _, err := s.DB.Exec(`INSERT INTO message_attachments (message_id, attachment_id) VALUES (?, ?)`, messageID, attachment.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertAccess(bobID, true)
+	assertAccess(carolID, false)
+}
+
+func TestAdapter_MediaQueueAndAttachmentJoin(t *testing.T) {
+	s := newAttachmentsStore(t)
+	aliceID := seedUser(t, s, "alice")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+
+	attachment, err := a.CreateAttachment(ctx, coreatt.Attachment{OwnerUserID: aliceID, BlobID: "abc", MimeType: "image/png", SizeBytes: 10})
+	if err != nil {
+		t.Fatalf("CreateAttachment: %v", err)
+	}
+	if attachment.Media != nil {
+		t.Fatalf("expected no media before enqueue, got %+v", attachment.Media)
+	}
+	if err := a.EnqueueMedia(ctx, attachment.ID); err != nil {
+		t.Fatalf("EnqueueMedia: %v", err)
+	}
+	if err := a.EnqueueMedia(ctx, attachment.ID); err != nil {
+		t.Fatalf("second EnqueueMedia should be a no-op: %v", err)
+	}
+	pending, err := a.ListPendingMedia(ctx, 10)
+	if err != nil || len(pending) != 1 || pending[0] != attachment.ID {
+		t.Fatalf("pending = %v, err = %v", pending, err)
+	}
+
+	media, err := a.GetMedia(ctx, attachment.ID)
+	if err != nil {
+		t.Fatalf("GetMedia: %v", err)
+	}
+	media.Status = coreatt.MediaReady
+	media.Width, media.Height = 640, 480
+	media.Placeholder = "LEHV6nWB2yk8pyo0adR*.7kCMdnj"
+	media.ThumbnailBlobID = "def"
+	if err := a.SaveMedia(ctx, media); err != nil {
+		t.Fatalf("SaveMedia: %v", err)
+	}
+	if pending, _ := a.ListPendingMedia(ctx, 10); len(pending) != 0 {
+		t.Fatalf("pending after ready = %v", pending)
+	}
+
+	got, err := a.GetAttachment(ctx, attachment.ID)
+	if err != nil {
+		t.Fatalf("GetAttachment: %v", err)
+	}
+	if got.Media == nil || got.Media.Status != coreatt.MediaReady || got.Media.Width != 640 || got.Media.ThumbnailBlobID != "def" {
+		t.Fatalf("attachment media = %+v", got.Media)
+	}
+	if err := a.SaveMedia(ctx, coreatt.Media{AttachmentID: 999}); !errors.Is(err, coreatt.ErrMediaNotFound) {
+		t.Fatalf("SaveMedia missing err = %v, want ErrMediaNotFound", err)
+	}
+}
@@ -64,9 +64,12 @@ func (a *Adapter) ListInvites(ctx context.Context, userID corecontacts.UserID) (
 	for _, row := range rows {
 		out = append(out, corecontacts.Invite{
 			ID:              row.ID,
+			FromUser:        corecontacts.UserID(row.InviterID),
 			ToUser:          userID,
 			Status:          corecontacts.InvitePending,
 			InviterUsername: row.InviterUsername,
+			CreatedAt:       row.CreatedAt,
+			ExpiresAt:       row.ExpiresAt,
 		})
 	}
 	return out, nil
@@ -81,6 +84,36 @@ func (a *Adapter) UpdateInvite(ctx context.Context, inviteID int, userID corecon
 	return err
 }
 
+func (a *Adapter) ListOutgoingInvites(ctx context.Context, userID corecontacts.UserID) ([]corecontacts.Invite, error) {
+	_ = ctx
+	rows, err := a.Store.ListOutgoingInvites(int(userID))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]corecontacts.Invite, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, corecontacts.Invite{
+			ID:                row.ID,
+			FromUser:          userID,
+			ToUser:            corecontacts.UserID(row.RecipientID),
+			Status:            corecontacts.InvitePending,
+			RecipientUsername: row.RecipientUsername,
+			CreatedAt:         row.CreatedAt,
+			ExpiresAt:         row.ExpiresAt,
+		})
+	}
+	return out, nil
+}
+
+func (a *Adapter) CancelInvite(ctx context.Context, inviteID int, userID corecontacts.UserID) error {
+	_ = ctx
+	err := a.Store.CancelInvite(inviteID, int(userID))
+	if errors.Is(err, store.ErrNotFound) {
+		return corecontacts.ErrInviteNotFound
+	}
+	return err
+}
+
 func (a *Adapter) ResolveUserIDByUsername(ctx context.Context, username string) (corecontacts.UserID, error) {
 	_ = ctx
 	user, err := a.Store.GetUserByUsername(username)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	corecontacts "github.com/kyambuthia/go-chat-site/server/internal/core/contacts"
 	"github.com/kyambuthia/go-chat-site/server/internal/store"
@@ -18,6 +19,7 @@ type fakeDeps struct {
 	createInviteErr error
 	listInvitesErr  error
 	updateInviteErr error
+	cancelInviteErr error
 	userErr         error
 
 	lastListContacts int
@@ -27,6 +29,8 @@ type fakeDeps struct {
 	lastUpdateInvite int
 	lastUpdateUser   int
 	lastUpdateStatus string
+	lastCancelInvite int
+	lastCancelUser   int
 	lastLookup       string
 }
 
@@ -56,6 +60,15 @@ func (f *fakeDeps) UpdateInviteStatus(inviteID, userID int, status string) error
 	return f.updateInviteErr
 }
 
+func (f *fakeDeps) CancelInvite(inviteID, requesterID int) error {
+	f.lastCancelInvite, f.lastCancelUser = inviteID, requesterID
+	return f.cancelInviteErr
+}
+func (f *fakeDeps) ListOutgoingInvites(userID int) ([]store.OutgoingInvite, error) {
+	return []store.OutgoingInvite{{ID: 5, RecipientID: 8, RecipientUsername: "carol"}}, nil
+}
+func (f *fakeDeps) ExpireInvites(now time.Time) (int, error) { _ = now; return 0, nil }
+
 func TestAdapter_ListContacts_MapsStoreUsersToCoreContacts(t *testing.T) {
 	deps := &fakeDeps{contacts: []store.User{{ID: 2, Username: "bob", DisplayName: "Bob", AvatarURL: "x"}}}
 	a := &Adapter{Store: deps}
@@ -101,6 +114,24 @@ func TestAdapter_UpdateInvite_TranslatesNotFoundError(t *testing.T) {
 	}
 }
 
+func TestAdapter_CancelInvite_TranslatesNotFoundError(t *testing.T) {
+	deps := &fakeDeps{cancelInviteErr: store.ErrNotFound}
+	a := &Adapter{Store: deps}
+
+	err := a.CancelInvite(context.Background(), 5, 1)
+	if !errors.Is(err, corecontacts.ErrInviteNotFound) {
+		t.Fatalf("expected ErrInviteNotFound, got %v", err)
+	}
+	if deps.lastCancelInvite != 5 || deps.lastCancelUser != 1 {
+		t.Fatalf("unexpected CancelInvite call invite=%d user=%d", deps.lastCancelInvite, deps.lastCancelUser)
+	}
+
+	outgoing, err := a.ListOutgoingInvites(context.Background(), 1)
+	if err != nil || len(outgoing) != 1 || outgoing[0].FromUser != 1 || outgoing[0].ToUser != 8 || outgoing[0].RecipientUsername != "carol" {
+		t.Fatalf("unexpected outgoing mapping: %+v, %v", outgoing, err)
+	}
+}
+
 func TestAdapter_ResolveUserIDByUsername_DelegatesLookup(t *testing.T) {
 	deps := &fakeDeps{user: &store.User{ID: 12, Username: "bob"}}
 	a := &Adapter{Store: deps}
@@ -0,0 +1,165 @@
+package sqlitecontacts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	corecontacts "github.com/kyambuthia/go-chat-site/server/internal/core/contacts"
+)
+
+// LinksAdapter stores invite links in invite_links. It talks to the database
+// directly because links have no counterpart in store.APIStore.
+type LinksAdapter struct {
+	DB *sql.DB
+}
+
+var _ corecontacts.InviteLinkRepository = (*LinksAdapter)(nil)
+
+const linkColumns = `l.id, l.user_id, u.username, l.nonce, l.max_uses, l.use_count, l.created_at, l.expires_at, l.revoked_at`
+
+func (a *LinksAdapter) CreateInviteLink(ctx context.Context, link corecontacts.InviteLink) (corecontacts.InviteLink, error) {
+	err := a.DB.QueryRowContext(ctx, `
+		INSERT INTO invite_links (user_id, nonce, max_uses, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, int(link.OwnerID), link.Nonce, link.MaxUses, link.CreatedAt.UTC(), link.ExpiresAt.UTC()).Scan(&link.ID)
+	if err != nil {
+		return corecontacts.InviteLink{}, err
+	}
+	return link, nil
+}
+
+func (a *LinksAdapter) ListInviteLinks(ctx context.Context, owner corecontacts.UserID) ([]corecontacts.InviteLink, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT `+linkColumns+`
+		FROM invite_links l
+		INNER JOIN users u ON u.id = l.user_id
+		WHERE l.user_id = ?
+		ORDER BY l.id DESC
+	`, int(owner))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]corecontacts.InviteLink, 0)
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, link)
+	}
+	return out, rows.Err()
+}
+
+func (a *LinksAdapter) GetInviteLink(ctx context.Context, id int64) (corecontacts.InviteLink, error) {
+	link, err := scanLink(a.DB.QueryRowContext(ctx, `
+		SELECT `+linkColumns+`
+		FROM invite_links l
+		INNER JOIN users u ON u.id = l.user_id
+		WHERE l.id = ?
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return corecontacts.InviteLink{}, corecontacts.ErrInviteLinkNotFound
+	}
+	return link, err
+}
+
+func (a *LinksAdapter) RevokeInviteLink(ctx context.Context, id int64, owner corecontacts.UserID, at time.Time) error {
+	res, err := a.DB.ExecContext(ctx, `
+		UPDATE invite_links SET revoked_at = COALESCE(revoked_at, ?)
+		WHERE id = ? AND user_id = ?
+	`, at.UTC(), id, int(owner))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return corecontacts.ErrInviteLinkNotFound
+	}
+	return nil
+}
+
+// RedeemInviteLink claims a use with a conditional UPDATE, so concurrent
+// redemptions cannot push use_count past max_uses.
+func (a *LinksAdapter) RedeemInviteLink(ctx context.Context, id int64, userID corecontacts.UserID, now time.Time) error {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owner int
+	if err := tx.QueryRowContext(ctx, `SELECT user_id FROM invite_links WHERE id = ?`, id).Scan(&owner); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return corecontacts.ErrInviteLinkInvalid
+		}
+		return err
+	}
+	var redeemed int
+	err = tx.QueryRowContext(ctx, `
+		SELECT 1 FROM invite_link_redemptions WHERE link_id = ? AND user_id = ?
+	`, id, int(userID)).Scan(&redeemed)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE invite_links SET use_count = use_count + 1
+		WHERE id = ? AND revoked_at IS NULL AND expires_at > ? AND use_count < max_uses
+	`, id, now.UTC())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return corecontacts.ErrInviteLinkInvalid
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO invite_link_redemptions (link_id, user_id, redeemed_at) VALUES (?, ?, ?)
+	`, id, int(userID), now.UTC()); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO contacts (user_id, contact_id) VALUES (?, ?), (?, ?)
+	`, owner, int(userID), int(userID), owner); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE contact_invites SET status = 'accepted', updated_at = ?
+		WHERE status = 'pending'
+			AND ((requester_id = ? AND recipient_id = ?) OR (requester_id = ? AND recipient_id = ?))
+	`, now.UTC(), owner, int(userID), int(userID), owner); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(s rowScanner) (corecontacts.InviteLink, error) {
+	var link corecontacts.InviteLink
+	var owner int
+	var revokedAt sql.NullTime
+	if err := s.Scan(&link.ID, &owner, &link.OwnerUsername, &link.Nonce, &link.MaxUses, &link.UseCount,
+		&link.CreatedAt, &link.ExpiresAt, &revokedAt); err != nil {
+		return corecontacts.InviteLink{}, err
+	}
+	link.OwnerID = corecontacts.UserID(owner)
+	if revokedAt.Valid {
+		t := revokedAt.Time
+		link.RevokedAt = &t
+	}
+	return link, nil
+}
@@ -0,0 +1,192 @@
+package sqlitedigest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	coredigest "github.com/kyambuthia/go-chat-site/server/internal/core/digest"
+)
+
+type Adapter struct {
+	DB *sql.DB
+}
+
+var _ coredigest.Repository = (*Adapter)(nil)
+
+const preferenceColumns = `
+	user_id, email, email_verified_at, digest_enabled, digest_frequency, unread_delay_minutes,
+	include_messages, include_invites, include_transfers, last_sent_at, next_digest_at`
+
+const cursorColumns = `messages_cursor, transfers_cursor, last_invite_id`
+
+func (a *Adapter) GetPreferences(ctx context.Context, userID int) (coredigest.Preferences, error) {
+	prefs, err := scanPreferences(a.DB.QueryRowContext(ctx, `
+		SELECT `+preferenceColumns+` FROM notification_preferences WHERE user_id = ?
+	`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return coredigest.Preferences{
+			UserID:           userID,
+			Frequency:        coredigest.FrequencyDaily,
+			UnreadDelay:      coredigest.DefaultUnreadDelay,
+			IncludeMessages:  true,
+			IncludeInvites:   true,
+			IncludeTransfers: true,
+		}, nil
+	}
+	return prefs, err
+}
+
+// SavePreferences drops any pending verification token when the address
+// changes, so a link sent to the old address cannot verify the new one.
+func (a *Adapter) SavePreferences(ctx context.Context, prefs coredigest.Preferences) error {
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO notification_preferences (
+			user_id, email, email_verified_at, digest_enabled, digest_frequency, unread_delay_minutes,
+			include_messages, include_invites, include_transfers, next_digest_at, updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE SET
+			email_verify_hash = CASE WHEN email = excluded.email THEN email_verify_hash ELSE '' END,
+			email_verify_expires_at = CASE WHEN email = excluded.email THEN email_verify_expires_at ELSE NULL END,
+			email = excluded.email,
+			email_verified_at = excluded.email_verified_at,
+			digest_enabled = excluded.digest_enabled,
+			digest_frequency = excluded.digest_frequency,
+			unread_delay_minutes = excluded.unread_delay_minutes,
+			include_messages = excluded.include_messages,
+			include_invites = excluded.include_invites,
+			include_transfers = excluded.include_transfers,
+			next_digest_at = excluded.next_digest_at,
+			updated_at = CURRENT_TIMESTAMP
+	`, prefs.UserID, prefs.Email, timePtrValue(prefs.EmailVerifiedAt), prefs.DigestEnabled, string(prefs.Frequency),
+		int(prefs.UnreadDelay/time.Minute), prefs.IncludeMessages, prefs.IncludeInvites, prefs.IncludeTransfers,
+		timePtrValue(prefs.NextDigestAt))
+	return err
+}
+
+func (a *Adapter) SetEmailVerification(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	result, err := a.DB.ExecContext(ctx, `
+		UPDATE notification_preferences
+		SET email_verify_hash = ?, email_verify_expires_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND email != ''
+	`, tokenHash, expiresAt.UTC(), userID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, coredigest.ErrInvalidEmail)
+}
+
+func (a *Adapter) ConsumeEmailVerification(ctx context.Context, tokenHash string, now time.Time) (int, error) {
+	var userID int
+	err := a.DB.QueryRowContext(ctx, `
+		UPDATE notification_preferences
+		SET email_verified_at = ?, email_verify_hash = '', email_verify_expires_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE email_verify_hash = ? AND email_verify_hash != '' AND email_verify_expires_at > ?
+		RETURNING user_id
+	`, now.UTC(), tokenHash, now.UTC()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, coredigest.ErrInvalidVerifyToken
+	}
+	return userID, err
+}
+
+func (a *Adapter) ClaimDueDigests(ctx context.Context, now, leaseUntil time.Time, limit int) ([]coredigest.Run, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		UPDATE notification_preferences
+		SET next_digest_at = ?
+		WHERE user_id IN (
+			SELECT user_id FROM notification_preferences
+			WHERE digest_enabled = 1 AND email_verified_at IS NOT NULL AND next_digest_at <= ?
+			ORDER BY next_digest_at, user_id
+			LIMIT ?
+		)
+		RETURNING `+preferenceColumns+`, `+cursorColumns, leaseUntil.UTC(), now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]coredigest.Run, 0)
+	for rows.Next() {
+		var run coredigest.Run
+		var messagesCursor, transfersCursor sql.NullTime
+		prefs, err := scanPreferences(rows, &messagesCursor, &transfersCursor, &run.Cursors.LastInviteID)
+		if err != nil {
+			return nil, err
+		}
+		run.Preferences = prefs
+		run.Cursors.MessagesBefore = messagesCursor.Time
+		run.Cursors.TransfersAfter = transfersCursor.Time
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
+
+func (a *Adapter) FinishDigest(ctx context.Context, userID int, cursors coredigest.Cursors, sentAt *time.Time, next time.Time) error {
+	_, err := a.DB.ExecContext(ctx, `
+		UPDATE notification_preferences
+		SET messages_cursor = ?, transfers_cursor = ?, last_invite_id = ?,
+			last_sent_at = COALESCE(?, last_sent_at),
+			next_digest_at = CASE WHEN digest_enabled = 1 THEN ? ELSE NULL END
+		WHERE user_id = ?
+	`, zeroTimeValue(cursors.MessagesBefore), zeroTimeValue(cursors.TransfersAfter), cursors.LastInviteID,
+		timePtrValue(sentAt), next.UTC(), userID)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPreferences(row rowScanner, extra ...any) (coredigest.Preferences, error) {
+	var prefs coredigest.Preferences
+	var verified, lastSent, next sql.NullTime
+	var frequency string
+	var delayMinutes int
+	dest := []any{&prefs.UserID, &prefs.Email, &verified, &prefs.DigestEnabled, &frequency, &delayMinutes,
+		&prefs.IncludeMessages, &prefs.IncludeInvites, &prefs.IncludeTransfers, &lastSent, &next}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return coredigest.Preferences{}, err
+	}
+	prefs.EmailVerifiedAt = nullTimePtr(verified)
+	prefs.Frequency = coredigest.Frequency(frequency)
+	prefs.UnreadDelay = time.Duration(delayMinutes) * time.Minute
+	prefs.LastSentAt = nullTimePtr(lastSent)
+	prefs.NextDigestAt = nullTimePtr(next)
+	return prefs, nil
+}
+
+func requireRowAffected(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func nullTimePtr(v sql.NullTime) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := v.Time
+	return &t
+}
+
+func timePtrValue(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+func zeroTimeValue(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
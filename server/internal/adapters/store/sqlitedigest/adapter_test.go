@@ -0,0 +1,159 @@
+package sqlitedigest
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	coredigest "github.com/kyambuthia/go-chat-site/server/internal/core/digest"
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+func newDigestAdapter(t *testing.T) (*Adapter, int) {
+	t.Helper()
+	s, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.RunMigrations(s.DB, filepath.Join("..", "..", "..", "..", "migrations")); err != nil {
+		t.Fatal(err)
+	}
+	alice, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Adapter{DB: s.DB}, alice
+}
+
+func TestAdapter_PreferencesAndVerification(t *testing.T) {
+	a, alice := newDigestAdapter(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	prefs, err := a.GetPreferences(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefs.Frequency != coredigest.FrequencyDaily || prefs.UnreadDelay != coredigest.DefaultUnreadDelay || !prefs.IncludeMessages {
+		t.Fatalf("defaults = %+v", prefs)
+	}
+	if err := a.SetEmailVerification(ctx, alice, "hash", now.Add(time.Hour)); !errors.Is(err, coredigest.ErrInvalidEmail) {
+		t.Fatalf("verification without address err = %v", err)
+	}
+
+	prefs.Email = "alice@example.com"
+	prefs.Frequency = coredigest.FrequencyHourly
+	prefs.UnreadDelay = 10 * time.Minute
+	prefs.IncludeInvites = false
+	if err := a.SavePreferences(ctx, prefs); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetEmailVerification(ctx, alice, "expired", now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ConsumeEmailVerification(ctx, "expired", now); !errors.Is(err, coredigest.ErrInvalidVerifyToken) {
+		t.Fatalf("expired token err = %v", err)
+	}
+
+	// Changing the address drops the token sent to the previous one.
+	if err := a.SetEmailVerification(ctx, alice, "old-address", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	prefs.Email = "alice@example.org"
+	if err := a.SavePreferences(ctx, prefs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ConsumeEmailVerification(ctx, "old-address", now); !errors.Is(err, coredigest.ErrInvalidVerifyToken) {
+		t.Fatalf("stale token err = %v", err)
+	}
+
+	if err := a.SetEmailVerification(ctx, alice, "current", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	userID, err := a.ConsumeEmailVerification(ctx, "current", now)
+	if err != nil || userID != alice {
+		t.Fatalf("consume = %d, %v", userID, err)
+	}
+	if _, err := a.ConsumeEmailVerification(ctx, "current", now); !errors.Is(err, coredigest.ErrInvalidVerifyToken) {
+		t.Fatalf("reused token err = %v", err)
+	}
+
+	got, err := a.GetPreferences(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != "alice@example.org" || got.EmailVerifiedAt == nil || got.Frequency != coredigest.FrequencyHourly ||
+		got.UnreadDelay != 10*time.Minute || got.IncludeInvites || !got.IncludeTransfers {
+		t.Fatalf("stored = %+v", got)
+	}
+}
+
+func TestAdapter_ClaimAndFinishDigests(t *testing.T) {
+	a, alice := newDigestAdapter(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	due := now.Add(-time.Minute)
+
+	prefs := coredigest.Preferences{
+		UserID: alice, Email: "alice@example.com", DigestEnabled: true, Frequency: coredigest.FrequencyDaily,
+		UnreadDelay: coredigest.DefaultUnreadDelay, IncludeMessages: true, NextDigestAt: &due,
+	}
+	if err := a.SavePreferences(ctx, prefs); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := a.ClaimDueDigests(ctx, now, now.Add(time.Minute), 10)
+	if err != nil || len(runs) != 0 {
+		t.Fatalf("unverified claim = %+v, %v", runs, err)
+	}
+
+	verified := now.Add(-time.Hour)
+	prefs.EmailVerifiedAt = &verified
+	if err := a.SavePreferences(ctx, prefs); err != nil {
+		t.Fatal(err)
+	}
+	runs, err = a.ClaimDueDigests(ctx, now, now.Add(time.Minute), 10)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("claim = %+v, %v", runs, err)
+	}
+	if !runs[0].Cursors.MessagesBefore.IsZero() || runs[0].Cursors.LastInviteID != 0 || runs[0].Preferences.Email != "alice@example.com" {
+		t.Fatalf("first run = %+v", runs[0])
+	}
+	if again, err := a.ClaimDueDigests(ctx, now, now.Add(time.Minute), 10); err != nil || len(again) != 0 {
+		t.Fatalf("leased claim = %+v, %v", again, err)
+	}
+
+	cursors := coredigest.Cursors{MessagesBefore: now.Add(-30 * time.Minute), TransfersAfter: now, LastInviteID: 7}
+	if err := a.FinishDigest(ctx, alice, cursors, &now, now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	runs, err = a.ClaimDueDigests(ctx, now, now.Add(time.Minute), 10)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("second claim = %+v, %v", runs, err)
+	}
+	got := runs[0]
+	if !got.Cursors.MessagesBefore.Equal(cursors.MessagesBefore) || !got.Cursors.TransfersAfter.Equal(now) ||
+		got.Cursors.LastInviteID != 7 || got.Preferences.LastSentAt == nil || !got.Preferences.LastSentAt.Equal(now) {
+		t.Fatalf("second run = %+v", got)
+	}
+
+	// A digest disabled while in flight is not rescheduled.
+	prefs.DigestEnabled = false
+	prefs.NextDigestAt = nil
+	if err := a.SavePreferences(ctx, prefs); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.FinishDigest(ctx, alice, cursors, nil, now); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := a.GetPreferences(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.NextDigestAt != nil || stored.LastSentAt == nil {
+		t.Fatalf("after disable = %+v", stored)
+	}
+}
@@ -0,0 +1,128 @@
+package sqlitedirectory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	coredirectory "github.com/kyambuthia/go-chat-site/server/internal/core/directory"
+)
+
+type Adapter struct {
+	DB *sql.DB
+}
+
+var _ coredirectory.Repository = (*Adapter)(nil)
+
+func (a *Adapter) GetDiscoverability(ctx context.Context, userID int) (coredirectory.Discoverability, error) {
+	var d string
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT discoverability FROM users WHERE id = ? AND deleted_at IS NULL
+	`, userID).Scan(&d)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", coredirectory.ErrUserNotFound
+	}
+	return coredirectory.Discoverability(d), err
+}
+
+func (a *Adapter) SetDiscoverability(ctx context.Context, userID int, d coredirectory.Discoverability) error {
+	res, err := a.DB.ExecContext(ctx, `
+		UPDATE users SET discoverability = ? WHERE id = ? AND deleted_at IS NULL
+	`, string(d), userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return coredirectory.ErrUserNotFound
+	}
+	return nil
+}
+
+// SearchCandidates filters with LIKE patterns built from term and leaves the
+// ranking to the core service. SQLite's lower() only folds ASCII, so
+// non-ASCII names match case-sensitively here.
+func (a *Adapter) SearchCandidates(ctx context.Context, searcherID int, term string, now time.Time, limit int) ([]coredirectory.Candidate, error) {
+	if term == "" {
+		return []coredirectory.Candidate{}, nil
+	}
+	runes := []rune(term)
+	escaped := make([]string, len(runes))
+	for i, r := range runes {
+		escaped[i] = escapeLike(string(r))
+	}
+	prefix := strings.Join(escaped, "") + "%"
+	inOrder := "%" + strings.Join(escaped, "%") + "%"
+	firstRune := escaped[0] + "%"
+	now = now.UTC()
+
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT
+			u.id,
+			u.username,
+			COALESCE(u.display_name, ''),
+			COALESCE(u.avatar_url, ''),
+			EXISTS (SELECT 1 FROM contacts c WHERE c.user_id = ? AND c.contact_id = u.id),
+			COALESCE((
+				SELECT i.id FROM contact_invites i
+				WHERE i.requester_id = ? AND i.recipient_id = u.id AND i.status = 'pending'
+					AND (i.expires_at IS NULL OR i.expires_at > ?)
+			), 0),
+			COALESCE((
+				SELECT i.id FROM contact_invites i
+				WHERE i.requester_id = u.id AND i.recipient_id = ? AND i.status = 'pending'
+					AND (i.expires_at IS NULL OR i.expires_at > ?)
+			), 0)
+		FROM users u
+		WHERE u.id <> ? AND u.deleted_at IS NULL
+			AND (
+				(u.discoverability = 'everyone' AND (
+					lower(u.username) LIKE ? ESCAPE '\'
+					OR lower(COALESCE(u.display_name, '')) LIKE ? ESCAPE '\'
+					OR lower(u.username) LIKE ? ESCAPE '\'
+				))
+				OR (u.discoverability = 'username' AND lower(u.username) = ?)
+			)
+		ORDER BY
+			CASE
+				WHEN lower(u.username) = ? THEN 0
+				WHEN lower(u.username) LIKE ? ESCAPE '\' THEN 1
+				ELSE 2
+			END,
+			length(u.username),
+			u.id
+		LIMIT ?
+	`,
+		searcherID,
+		searcherID, now,
+		searcherID, now,
+		searcherID,
+		inOrder, inOrder, firstRune,
+		term,
+		term, prefix,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]coredirectory.Candidate, 0)
+	for rows.Next() {
+		var c coredirectory.Candidate
+		if err := rows.Scan(&c.UserID, &c.Username, &c.DisplayName, &c.AvatarURL, &c.IsContact, &c.SentInviteID, &c.ReceivedInviteID); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
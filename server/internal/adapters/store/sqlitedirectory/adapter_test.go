@@ -0,0 +1,130 @@
+package sqlitedirectory
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	coredirectory "github.com/kyambuthia/go-chat-site/server/internal/core/directory"
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+func newDirectoryStore(t *testing.T) (*Adapter, *store.SqliteStore) {
+	t.Helper()
+	s, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.RunMigrations(s.DB, filepath.Join("..", "..", "..", "..", "migrations")); err != nil {
+		t.Fatal(err)
+	}
+	return &Adapter{DB: s.DB}, s
+}
+
+func createUser(t *testing.T, s *store.SqliteStore, username, displayName string) int {
+	t.Helper()
+	id, err := s.CreateUser(username, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if displayName != "" {
+		if _, err := s.UpdateUserProfile(id, displayName, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+func TestAdapter_SearchCandidatesHonoursDiscoverabilityAndAnnotates(t *testing.T) {
+	a, s := newDirectoryStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	me := createUser(t, s, "searcher", "")
+	alice := createUser(t, s, "alice", "")
+	alicia := createUser(t, s, "Alicia", "")
+	bob := createUser(t, s, "bob", "Alice Bobson")
+	hidden := createUser(t, s, "alicorn", "")
+	exactOnly := createUser(t, s, "al_ice", "")
+	createUser(t, s, "zed", "")
+
+	if err := a.SetDiscoverability(ctx, hidden, coredirectory.DiscoverNobody); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetDiscoverability(ctx, exactOnly, coredirectory.DiscoverUsername); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := a.GetDiscoverability(ctx, alice); err != nil || d != coredirectory.DiscoverEveryone {
+		t.Fatalf("default discoverability = %q, %v", d, err)
+	}
+	if err := a.SetDiscoverability(ctx, 9999, coredirectory.DiscoverNobody); !errors.Is(err, coredirectory.ErrUserNotFound) {
+		t.Fatalf("unknown user err = %v", err)
+	}
+
+	if err := s.AddContact(me, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateInvite(me, alicia); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateInvite(bob, me); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := a.SearchCandidates(ctx, me, "ali", now, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := map[int]coredirectory.Candidate{}
+	for _, c := range got {
+		byID[c.UserID] = c
+	}
+	if _, ok := byID[hidden]; ok {
+		t.Fatal("discoverability nobody was returned")
+	}
+	if _, ok := byID[exactOnly]; ok {
+		t.Fatal("discoverability username was returned for a partial query")
+	}
+	if _, ok := byID[me]; ok {
+		t.Fatal("searcher was returned")
+	}
+	if len(got) == 0 || got[0].UserID != alice || !got[0].IsContact {
+		t.Fatalf("first candidate = %+v", got)
+	}
+	if byID[alicia].SentInviteID == 0 || byID[bob].ReceivedInviteID == 0 {
+		t.Fatalf("invite annotations = %+v / %+v", byID[alicia], byID[bob])
+	}
+	if byID[bob].DisplayName != "Alice Bobson" {
+		t.Fatalf("bob = %+v", byID[bob])
+	}
+
+	got, err = a.SearchCandidates(ctx, me, "al_ice", now, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || got[0].UserID != exactOnly {
+		t.Fatalf("exact username search = %+v", got)
+	}
+
+	// LIKE wildcards in the term are literal.
+	got, err = a.SearchCandidates(ctx, me, "%%", now, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("wildcard search = %+v", got)
+	}
+
+	// An expired invite no longer annotates the result.
+	got, err = a.SearchCandidates(ctx, me, "alicia", now.Add(store.InviteTTL+time.Hour), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || got[0].UserID != alicia || got[0].SentInviteID != 0 {
+		t.Fatalf("after expiry = %+v", got)
+	}
+}
@@ -0,0 +1,221 @@
+package sqliteidentity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+type APITokensAdapter struct {
+	DB *sql.DB
+}
+
+var _ coreid.APITokenRepository = (*APITokensAdapter)(nil)
+
+const apiTokenColumns = `
+	t.id, t.user_id, EXISTS (SELECT 1 FROM bot_accounts b WHERE b.user_id = t.user_id),
+	t.name, t.scopes, t.created_at, t.last_used_at, t.expires_at, t.revoked_at`
+
+// CreateAPIToken checks the limit and inserts in one statement, so
+// concurrent requests cannot exceed it. Expired tokens do not count.
+func (a *APITokensAdapter) CreateAPIToken(ctx context.Context, token coreid.APIToken, tokenHash string, limit int) (coreid.APIToken, error) {
+	var expires any
+	if token.ExpiresAt != nil {
+		expires = token.ExpiresAt.UTC()
+	}
+	var id int64
+	err := a.DB.QueryRowContext(ctx, `
+		INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_at, expires_at)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE (
+			SELECT COUNT(*) FROM api_tokens
+			WHERE user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)
+		) < ?
+		RETURNING id
+	`, token.UserID, token.Name, tokenHash, strings.Join(token.Scopes, " "), token.CreatedAt.UTC(), expires,
+		token.UserID, token.CreatedAt.UTC(), limit).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.APIToken{}, coreid.ErrAPITokenLimitReached
+		}
+		return coreid.APIToken{}, err
+	}
+	return a.GetAPIToken(ctx, id)
+}
+
+func (a *APITokensAdapter) GetAPITokenByHash(ctx context.Context, tokenHash string) (coreid.APIToken, error) {
+	return a.getAPIToken(ctx, `WHERE t.token_hash = ?`, tokenHash)
+}
+
+func (a *APITokensAdapter) GetAPIToken(ctx context.Context, tokenID int64) (coreid.APIToken, error) {
+	return a.getAPIToken(ctx, `WHERE t.id = ?`, tokenID)
+}
+
+func (a *APITokensAdapter) getAPIToken(ctx context.Context, where string, arg any) (coreid.APIToken, error) {
+	token, err := scanAPIToken(a.DB.QueryRowContext(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens t `+where, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.APIToken{}, coreid.ErrAPITokenNotFound
+		}
+		return coreid.APIToken{}, err
+	}
+	return token, nil
+}
+
+func (a *APITokensAdapter) TouchAPIToken(ctx context.Context, tokenID int64, now time.Time) error {
+	_, err := a.DB.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now.UTC(), tokenID)
+	return err
+}
+
+func (a *APITokensAdapter) ListAPITokens(ctx context.Context, userID coreid.UserID) ([]coreid.APIToken, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens t
+		WHERE t.user_id = ?
+		ORDER BY t.created_at DESC, t.id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]coreid.APIToken, 0)
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, token)
+	}
+	return out, rows.Err()
+}
+
+func (a *APITokensAdapter) RevokeAPIToken(ctx context.Context, tokenID int64, now time.Time) error {
+	result, err := a.DB.ExecContext(ctx, `
+		UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL
+	`, now.UTC(), tokenID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, coreid.ErrAPITokenNotFound)
+}
+
+// CreateBot inserts the bot's users row and ownership in one transaction,
+// enforcing the per-owner limit inside it.
+func (a *APITokensAdapter) CreateBot(ctx context.Context, ownerID coreid.UserID, username, displayName string, now time.Time, limit int) (coreid.Bot, error) {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return coreid.Bot{}, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM bot_accounts WHERE owner_user_id = ?`, ownerID).Scan(&count); err != nil {
+		return coreid.Bot{}, err
+	}
+	if count >= limit {
+		return coreid.Bot{}, coreid.ErrBotLimitReached
+	}
+	var botID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (username, password_hash, display_name) VALUES (?, '', ?)
+		ON CONFLICT (username) DO NOTHING
+		RETURNING id
+	`, username, displayName).Scan(&botID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.Bot{}, coreid.ErrUsernameTaken
+		}
+		return coreid.Bot{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO bot_accounts (user_id, owner_user_id, created_at) VALUES (?, ?, ?)
+	`, botID, ownerID, now.UTC()); err != nil {
+		return coreid.Bot{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return coreid.Bot{}, err
+	}
+	return coreid.Bot{
+		Principal:   coreid.Principal{ID: coreid.UserID(botID), Username: username},
+		OwnerID:     ownerID,
+		DisplayName: displayName,
+		CreatedAt:   now.UTC(),
+	}, nil
+}
+
+func (a *APITokensAdapter) GetBot(ctx context.Context, botID coreid.UserID) (coreid.Bot, error) {
+	bot, err := scanBot(a.DB.QueryRowContext(ctx, `
+		SELECT u.id, u.username, COALESCE(u.display_name, ''), b.owner_user_id, b.created_at
+		FROM bot_accounts b
+		JOIN users u ON u.id = b.user_id
+		WHERE b.user_id = ?
+	`, botID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.Bot{}, coreid.ErrBotNotFound
+		}
+		return coreid.Bot{}, err
+	}
+	return bot, nil
+}
+
+func (a *APITokensAdapter) ListBots(ctx context.Context, ownerID coreid.UserID) ([]coreid.Bot, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT u.id, u.username, COALESCE(u.display_name, ''), b.owner_user_id, b.created_at
+		FROM bot_accounts b
+		JOIN users u ON u.id = b.user_id
+		WHERE b.owner_user_id = ?
+		ORDER BY b.created_at, u.id
+	`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]coreid.Bot, 0)
+	for rows.Next() {
+		bot, err := scanBot(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, bot)
+	}
+	return out, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIToken(row rowScanner) (coreid.APIToken, error) {
+	var token coreid.APIToken
+	var scopes string
+	var lastUsed, expires, revoked sql.NullTime
+	if err := row.Scan(&token.ID, &token.UserID, &token.Bot, &token.Name, &scopes, &token.CreatedAt, &lastUsed, &expires, &revoked); err != nil {
+		return coreid.APIToken{}, err
+	}
+	token.Scopes = strings.Fields(scopes)
+	token.LastUsedAt = nullTimePtr(lastUsed)
+	token.ExpiresAt = nullTimePtr(expires)
+	token.RevokedAt = nullTimePtr(revoked)
+	return token, nil
+}
+
+func scanBot(row rowScanner) (coreid.Bot, error) {
+	var bot coreid.Bot
+	err := row.Scan(&bot.ID, &bot.Username, &bot.DisplayName, &bot.OwnerID, &bot.CreatedAt)
+	return bot, err
+}
+
+func nullTimePtr(v sql.NullTime) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := v.Time
+	return &t
+}
@@ -0,0 +1,110 @@
+package sqliteidentity
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+func TestAPITokensAdapter_TokensAndLimit(t *testing.T) {
+	mfa, userID := newMFAAdapter(t)
+	a := &APITokensAdapter{DB: mfa.DB}
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	expires := now.Add(time.Hour)
+	created, err := a.CreateAPIToken(ctx, coreid.APIToken{
+		UserID: userID, Name: "ci", Scopes: []string{"messages:read", "wallet:read"}, CreatedAt: now, ExpiresAt: &expires,
+	}, "hash-1", 2)
+	if err != nil {
+		t.Fatalf("CreateAPIToken error: %v", err)
+	}
+	if created.ID == 0 || created.Bot || len(created.Scopes) != 2 || created.ExpiresAt == nil {
+		t.Fatalf("created = %+v", created)
+	}
+	byHash, err := a.GetAPITokenByHash(ctx, "hash-1")
+	if err != nil || byHash.ID != created.ID || byHash.Scopes[1] != "wallet:read" {
+		t.Fatalf("GetAPITokenByHash = %+v, %v", byHash, err)
+	}
+	if _, err := a.GetAPITokenByHash(ctx, "missing"); !errors.Is(err, coreid.ErrAPITokenNotFound) {
+		t.Fatalf("missing hash err = %v", err)
+	}
+
+	if _, err := a.CreateAPIToken(ctx, coreid.APIToken{UserID: userID, Name: "two", Scopes: []string{"wallet:read"}, CreatedAt: now}, "hash-2", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateAPIToken(ctx, coreid.APIToken{UserID: userID, Name: "three", Scopes: []string{"wallet:read"}, CreatedAt: now}, "hash-3", 2); !errors.Is(err, coreid.ErrAPITokenLimitReached) {
+		t.Fatalf("over limit err = %v", err)
+	}
+	if err := a.RevokeAPIToken(ctx, created.ID, now); err != nil {
+		t.Fatalf("RevokeAPIToken error: %v", err)
+	}
+	if err := a.RevokeAPIToken(ctx, created.ID, now); !errors.Is(err, coreid.ErrAPITokenNotFound) {
+		t.Fatalf("second revoke err = %v", err)
+	}
+	if _, err := a.CreateAPIToken(ctx, coreid.APIToken{UserID: userID, Name: "three", Scopes: []string{"wallet:read"}, CreatedAt: now}, "hash-3", 2); err != nil {
+		t.Fatalf("revoked tokens should not count toward the limit: %v", err)
+	}
+
+	if err := a.TouchAPIToken(ctx, created.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := a.ListAPITokens(ctx, userID)
+	if err != nil || len(tokens) != 3 {
+		t.Fatalf("ListAPITokens = %+v, %v", tokens, err)
+	}
+	var revoked coreid.APIToken
+	for _, token := range tokens {
+		if token.ID == created.ID {
+			revoked = token
+		}
+	}
+	if revoked.RevokedAt == nil || revoked.LastUsedAt == nil {
+		t.Fatalf("revoked token = %+v", revoked)
+	}
+}
+
+func TestAPITokensAdapter_Bots(t *testing.T) {
+	mfa, ownerID := newMFAAdapter(t)
+	a := &APITokensAdapter{DB: mfa.DB}
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	if _, err := a.CreateBot(ctx, ownerID, "alice", "", now, 2); !errors.Is(err, coreid.ErrUsernameTaken) {
+		t.Fatalf("taken username err = %v", err)
+	}
+	bot, err := a.CreateBot(ctx, ownerID, "oncall-bot", "On-call", now, 2)
+	if err != nil {
+		t.Fatalf("CreateBot error: %v", err)
+	}
+	var hash string
+	if err := a.DB.QueryRow(`SELECT password_hash FROM users WHERE id = ?`, bot.ID).Scan(&hash); err != nil || hash != "" {
+		t.Fatalf("bot password_hash = %q, %v", hash, err)
+	}
+	got, err := a.GetBot(ctx, bot.ID)
+	if err != nil || got.OwnerID != ownerID || got.Username != "oncall-bot" || got.DisplayName != "On-call" {
+		t.Fatalf("GetBot = %+v, %v", got, err)
+	}
+	if _, err := a.GetBot(ctx, ownerID); !errors.Is(err, coreid.ErrBotNotFound) {
+		t.Fatalf("GetBot on a person err = %v", err)
+	}
+
+	if _, err := a.CreateBot(ctx, ownerID, "deploy-bot", "", now, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateBot(ctx, ownerID, "third-bot", "", now, 2); !errors.Is(err, coreid.ErrBotLimitReached) {
+		t.Fatalf("over limit err = %v", err)
+	}
+	bots, err := a.ListBots(ctx, ownerID)
+	if err != nil || len(bots) != 2 {
+		t.Fatalf("ListBots = %+v, %v", bots, err)
+	}
+
+	token, err := a.CreateAPIToken(ctx, coreid.APIToken{UserID: bot.ID, Name: "alerts", Scopes: []string{"messages:send"}, CreatedAt: now}, "bot-hash", 5)
+	if err != nil || !token.Bot {
+		t.Fatalf("bot token = %+v, %v", token, err)
+	}
+}
@@ -0,0 +1,97 @@
+package sqliteidentity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+type CredentialsAdapter struct {
+	DB *sql.DB
+}
+
+var _ coreid.CredentialRepository = (*CredentialsAdapter)(nil)
+
+func (a *CredentialsAdapter) GetPasswordRecord(ctx context.Context, userID coreid.UserID) (coreid.PasswordLoginRecord, error) {
+	record := coreid.PasswordLoginRecord{Principal: coreid.Principal{ID: userID}}
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT username, password_hash FROM users WHERE id = ?
+	`, userID).Scan(&record.Principal.Username, &record.PasswordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.PasswordLoginRecord{}, coreid.ErrPrincipalNotFound
+		}
+		return coreid.PasswordLoginRecord{}, err
+	}
+	return record, nil
+}
+
+func (a *CredentialsAdapter) FindPrincipal(ctx context.Context, username string) (coreid.Principal, error) {
+	var principal coreid.Principal
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT id, username FROM users WHERE username = ? AND deleted_at IS NULL
+	`, username).Scan(&principal.ID, &principal.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.Principal{}, coreid.ErrPrincipalNotFound
+		}
+		return coreid.Principal{}, err
+	}
+	return principal, nil
+}
+
+func (a *CredentialsAdapter) UpdatePasswordHash(ctx context.Context, userID coreid.UserID, passwordHash string) error {
+	result, err := a.DB.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, coreid.ErrPrincipalNotFound)
+}
+
+// CreatePasswordResetToken replaces the user's outstanding token and sweeps
+// expired ones.
+func (a *CredentialsAdapter) CreatePasswordResetToken(ctx context.Context, tokenHash string, userID coreid.UserID, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	if _, err := a.DB.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE expires_at < ?`, now); err != nil {
+		return err
+	}
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (token_hash, user_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			token_hash = excluded.token_hash,
+			expires_at = excluded.expires_at,
+			created_at = excluded.created_at
+	`, tokenHash, userID, expiresAt.UTC(), now)
+	return err
+}
+
+func (a *CredentialsAdapter) GetPasswordResetToken(ctx context.Context, tokenHash string) (coreid.PasswordResetRecord, error) {
+	var record coreid.PasswordResetRecord
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT t.user_id, u.username, t.expires_at
+		FROM password_reset_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ?
+	`, tokenHash).Scan(&record.Principal.ID, &record.Principal.Username, &record.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.PasswordResetRecord{}, coreid.ErrInvalidResetToken
+		}
+		return coreid.PasswordResetRecord{}, err
+	}
+	return record, nil
+}
+
+// ConsumePasswordResetToken reports ErrInvalidResetToken when another request
+// already used the token.
+func (a *CredentialsAdapter) ConsumePasswordResetToken(ctx context.Context, tokenHash string) error {
+	result, err := a.DB.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE token_hash = ?`, tokenHash)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, coreid.ErrInvalidResetToken)
+}
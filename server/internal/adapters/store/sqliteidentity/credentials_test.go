@@ -0,0 +1,50 @@
+package sqliteidentity
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+func TestCredentialsAdapter_PasswordAndResetTokens(t *testing.T) {
+	mfa, userID := newMFAAdapter(t)
+	a := &CredentialsAdapter{DB: mfa.DB}
+	ctx := context.Background()
+
+	if principal, err := a.FindPrincipal(ctx, "alice"); err != nil || principal.ID != userID {
+		t.Fatalf("FindPrincipal = %+v, %v", principal, err)
+	}
+	if _, err := a.FindPrincipal(ctx, "nobody"); !errors.Is(err, coreid.ErrPrincipalNotFound) {
+		t.Fatalf("FindPrincipal unknown err = %v", err)
+	}
+	if err := a.UpdatePasswordHash(ctx, userID, "new-hash"); err != nil {
+		t.Fatalf("UpdatePasswordHash error: %v", err)
+	}
+	if record, err := a.GetPasswordRecord(ctx, userID); err != nil || record.PasswordHash != "new-hash" || record.Principal.Username != "alice" {
+		t.Fatalf("GetPasswordRecord = %+v, %v", record, err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	if err := a.CreatePasswordResetToken(ctx, "first", userID, expiresAt); err != nil {
+		t.Fatalf("CreatePasswordResetToken error: %v", err)
+	}
+	if err := a.CreatePasswordResetToken(ctx, "second", userID, expiresAt); err != nil {
+		t.Fatalf("replacing CreatePasswordResetToken error: %v", err)
+	}
+	if _, err := a.GetPasswordResetToken(ctx, "first"); !errors.Is(err, coreid.ErrInvalidResetToken) {
+		t.Fatalf("replaced token err = %v", err)
+	}
+	record, err := a.GetPasswordResetToken(ctx, "second")
+	if err != nil || record.Principal.ID != userID || record.Principal.Username != "alice" {
+		t.Fatalf("GetPasswordResetToken = %+v, %v", record, err)
+	}
+	if err := a.ConsumePasswordResetToken(ctx, "second"); err != nil {
+		t.Fatalf("ConsumePasswordResetToken error: %v", err)
+	}
+	if err := a.ConsumePasswordResetToken(ctx, "second"); !errors.Is(err, coreid.ErrInvalidResetToken) {
+		t.Fatalf("second consume err = %v", err)
+	}
+}
@@ -201,7 +201,7 @@ func (a *DeviceKeysAdapter) GetDeviceDirectory(ctx context.Context, username str
 	if err := a.DB.QueryRowContext(ctx, `
 		SELECT id, username
 		FROM users
-		WHERE username = ?
+		WHERE username = ? AND deleted_at IS NULL
 	`, username).Scan(&directory.UserID, &directory.Username); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return coreid.DeviceDirectory{}, store.ErrNotFound
@@ -253,6 +253,21 @@ func (a *DeviceKeysAdapter) GetDeviceDirectory(ctx context.Context, username str
 	return directory, nil
 }
 
+// CountDevicesLowOnPrekeys counts active devices holding fewer than below
+// active prekeys.
+func (a *DeviceKeysAdapter) CountDevicesLowOnPrekeys(ctx context.Context, below int) (int, error) {
+	var n int
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM device_identities di
+		WHERE di.revoked_at IS NULL AND (
+			SELECT COUNT(*) FROM device_prekeys dp
+			WHERE dp.device_identity_id = di.id AND dp.key_state = 'active' AND dp.revoked_at IS NULL
+		) < ?
+	`, below).Scan(&n)
+	return n, err
+}
+
 func (a *DeviceKeysAdapter) getDeviceIdentity(ctx context.Context, userID coreid.UserID, sessionID int64, deviceID int64) (coreid.DeviceIdentity, error) {
 	row := a.DB.QueryRowContext(ctx, `
 		SELECT
@@ -0,0 +1,233 @@
+package sqliteidentity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+type MFAAdapter struct {
+	DB *sql.DB
+}
+
+var _ coreid.MFARepository = (*MFAAdapter)(nil)
+
+func (a *MFAAdapter) GetPrincipal(ctx context.Context, userID coreid.UserID) (coreid.Principal, error) {
+	return lookupPrincipal(ctx, a.DB, userID)
+}
+
+func (a *MFAAdapter) GetTOTP(ctx context.Context, userID coreid.UserID) (coreid.TOTPRecord, error) {
+	record := coreid.TOTPRecord{UserID: userID}
+	var confirmedAt sql.NullTime
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT secret, confirmed_at, last_used_step
+		FROM user_totp
+		WHERE user_id = ?
+	`, userID).Scan(&record.Secret, &confirmedAt, &record.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.TOTPRecord{}, coreid.ErrMFANotEnrolled
+		}
+		return coreid.TOTPRecord{}, err
+	}
+	record.Confirmed = confirmedAt.Valid
+	return record, nil
+}
+
+// SavePendingTOTP never overwrites a confirmed secret.
+func (a *MFAAdapter) SavePendingTOTP(ctx context.Context, userID coreid.UserID, secret string) error {
+	now := time.Now().UTC()
+	result, err := a.DB.ExecContext(ctx, `
+		INSERT INTO user_totp (user_id, secret, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			secret = excluded.secret,
+			last_used_step = 0,
+			updated_at = excluded.updated_at
+		WHERE user_totp.confirmed_at IS NULL
+	`, userID, secret, now, now)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, coreid.ErrMFAAlreadyEnabled)
+}
+
+func (a *MFAAdapter) ConfirmTOTP(ctx context.Context, userID coreid.UserID, step int64, recoveryCodeHashes []string) error {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_totp
+		SET confirmed_at = ?, last_used_step = ?, updated_at = ?
+		WHERE user_id = ? AND confirmed_at IS NULL
+	`, now, step, now, userID)
+	if err != nil {
+		return err
+	}
+	if err := requireRowAffected(result, coreid.ErrMFANotEnrolled); err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodesTx(ctx, tx, userID, recoveryCodeHashes, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (a *MFAAdapter) DeleteTOTP(ctx context.Context, userID coreid.UserID) error {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	if err := requireRowAffected(result, coreid.ErrMFANotEnrolled); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM auth_mfa_challenges WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AdvanceTOTPStep records step as used, reporting false when it (or a later
+// step) was already used.
+func (a *MFAAdapter) AdvanceTOTPStep(ctx context.Context, userID coreid.UserID, step int64) (bool, error) {
+	result, err := a.DB.ExecContext(ctx, `
+		UPDATE user_totp
+		SET last_used_step = ?, updated_at = ?
+		WHERE user_id = ? AND confirmed_at IS NOT NULL AND last_used_step < ?
+	`, step, time.Now().UTC(), userID, step)
+	if err != nil {
+		return false, err
+	}
+	return rowAffected(result)
+}
+
+func (a *MFAAdapter) ConsumeRecoveryCode(ctx context.Context, userID coreid.UserID, codeHash string) (bool, error) {
+	result, err := a.DB.ExecContext(ctx, `
+		UPDATE user_recovery_codes
+		SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return rowAffected(result)
+}
+
+func (a *MFAAdapter) CountRecoveryCodes(ctx context.Context, userID coreid.UserID) (int, error) {
+	var count int
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL
+	`, userID).Scan(&count)
+	return count, err
+}
+
+// CreateMFAChallenge also sweeps expired challenges so the table stays small
+// without a separate cleanup job.
+func (a *MFAAdapter) CreateMFAChallenge(ctx context.Context, tokenHash string, userID coreid.UserID, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	if _, err := a.DB.ExecContext(ctx, `DELETE FROM auth_mfa_challenges WHERE expires_at < ?`, now); err != nil {
+		return err
+	}
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO auth_mfa_challenges (token_hash, user_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?)
+	`, tokenHash, userID, expiresAt.UTC(), now)
+	return err
+}
+
+func (a *MFAAdapter) GetMFAChallenge(ctx context.Context, tokenHash string) (coreid.MFAChallengeRecord, error) {
+	var record coreid.MFAChallengeRecord
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT c.user_id, u.username, c.attempts, c.expires_at
+		FROM auth_mfa_challenges c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.token_hash = ?
+	`, tokenHash).Scan(&record.Principal.ID, &record.Principal.Username, &record.Attempts, &record.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.MFAChallengeRecord{}, coreid.ErrInvalidMFAChallenge
+		}
+		return coreid.MFAChallengeRecord{}, err
+	}
+	return record, nil
+}
+
+func (a *MFAAdapter) RecordMFAChallengeFailure(ctx context.Context, tokenHash string) (int, error) {
+	var attempts int
+	err := a.DB.QueryRowContext(ctx, `
+		UPDATE auth_mfa_challenges SET attempts = attempts + 1
+		WHERE token_hash = ?
+		RETURNING attempts
+	`, tokenHash).Scan(&attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, coreid.ErrInvalidMFAChallenge
+	}
+	return attempts, err
+}
+
+// DeleteMFAChallenge reports ErrInvalidMFAChallenge when the challenge was
+// already consumed, which keeps challenges single-use under concurrency.
+func (a *MFAAdapter) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	result, err := a.DB.ExecContext(ctx, `DELETE FROM auth_mfa_challenges WHERE token_hash = ?`, tokenHash)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, coreid.ErrInvalidMFAChallenge)
+}
+
+func lookupPrincipal(ctx context.Context, db *sql.DB, userID coreid.UserID) (coreid.Principal, error) {
+	principal := coreid.Principal{ID: userID}
+	if err := db.QueryRowContext(ctx, `SELECT username FROM users WHERE id = ?`, userID).Scan(&principal.Username); err != nil {
+		return coreid.Principal{}, err
+	}
+	return principal, nil
+}
+
+func replaceRecoveryCodesTx(ctx context.Context, tx *sql.Tx, userID coreid.UserID, hashes []string, now time.Time) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO user_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)
+		`, userID, hash, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rowAffected(result sql.Result) (bool, error) {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func requireRowAffected(result sql.Result, notFound error) error {
+	ok, err := rowAffected(result)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return notFound
+	}
+	return nil
+}
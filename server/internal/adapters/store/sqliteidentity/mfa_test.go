@@ -0,0 +1,113 @@
+package sqliteidentity
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+func newMFAAdapter(t *testing.T) (*MFAAdapter, coreid.UserID) {
+	t.Helper()
+	s, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.RunMigrations(s.DB, filepath.Join("..", "..", "..", "..", "migrations")); err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.DB.Exec(`INSERT INTO users (username, password_hash) VALUES ('alice', 'test-hash')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	return &MFAAdapter{DB: s.DB}, coreid.UserID(id)
+}
+
+func TestMFAAdapter_TOTPLifecycle(t *testing.T) {
+	a, userID := newMFAAdapter(t)
+	ctx := context.Background()
+
+	if _, err := a.GetTOTP(ctx, userID); !errors.Is(err, coreid.ErrMFANotEnrolled) {
+		t.Fatalf("GetTOTP before enrollment err = %v", err)
+	}
+	if err := a.SavePendingTOTP(ctx, userID, "FIRST"); err != nil {
+		t.Fatalf("SavePendingTOTP error: %v", err)
+	}
+	if err := a.SavePendingTOTP(ctx, userID, "SECOND"); err != nil {
+		t.Fatalf("SavePendingTOTP replace error: %v", err)
+	}
+	if err := a.ConfirmTOTP(ctx, userID, 100, []string{"h1", "h2"}); err != nil {
+		t.Fatalf("ConfirmTOTP error: %v", err)
+	}
+	record, err := a.GetTOTP(ctx, userID)
+	if err != nil || !record.Confirmed || record.Secret != "SECOND" || record.LastUsedStep != 100 {
+		t.Fatalf("record = %+v, err = %v", record, err)
+	}
+	if err := a.SavePendingTOTP(ctx, userID, "THIRD"); !errors.Is(err, coreid.ErrMFAAlreadyEnabled) {
+		t.Fatalf("SavePendingTOTP over confirmed err = %v", err)
+	}
+
+	if ok, err := a.AdvanceTOTPStep(ctx, userID, 100); err != nil || ok {
+		t.Fatalf("replayed step advanced = %v, err = %v", ok, err)
+	}
+	if ok, err := a.AdvanceTOTPStep(ctx, userID, 101); err != nil || !ok {
+		t.Fatalf("new step advanced = %v, err = %v", ok, err)
+	}
+
+	if ok, _ := a.ConsumeRecoveryCode(ctx, userID, "h1"); !ok {
+		t.Fatal("expected recovery code to be consumed")
+	}
+	if ok, _ := a.ConsumeRecoveryCode(ctx, userID, "h1"); ok {
+		t.Fatal("recovery code must be single-use")
+	}
+	if n, err := a.CountRecoveryCodes(ctx, userID); err != nil || n != 1 {
+		t.Fatalf("remaining codes = %d, err = %v", n, err)
+	}
+
+	if err := a.DeleteTOTP(ctx, userID); err != nil {
+		t.Fatalf("DeleteTOTP error: %v", err)
+	}
+	if n, _ := a.CountRecoveryCodes(ctx, userID); n != 0 {
+		t.Fatalf("remaining codes after disable = %d", n)
+	}
+	if err := a.DeleteTOTP(ctx, userID); !errors.Is(err, coreid.ErrMFANotEnrolled) {
+		t.Fatalf("second DeleteTOTP err = %v", err)
+	}
+}
+
+func TestMFAAdapter_ChallengesAreSingleUse(t *testing.T) {
+	a, userID := newMFAAdapter(t)
+	ctx := context.Background()
+	expiresAt := time.Now().UTC().Add(time.Minute)
+
+	if err := a.CreateMFAChallenge(ctx, "stale", userID, time.Now().UTC().Add(-time.Minute)); err != nil {
+		t.Fatalf("CreateMFAChallenge error: %v", err)
+	}
+	if err := a.CreateMFAChallenge(ctx, "token-hash", userID, expiresAt); err != nil {
+		t.Fatalf("CreateMFAChallenge error: %v", err)
+	}
+	if _, err := a.GetMFAChallenge(ctx, "stale"); !errors.Is(err, coreid.ErrInvalidMFAChallenge) {
+		t.Fatalf("expired challenge should have been swept, err = %v", err)
+	}
+
+	record, err := a.GetMFAChallenge(ctx, "token-hash")
+	if err != nil || record.Principal.ID != userID || record.Principal.Username != "alice" || !record.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("record = %+v, err = %v", record, err)
+	}
+	if attempts, err := a.RecordMFAChallengeFailure(ctx, "token-hash"); err != nil || attempts != 1 {
+		t.Fatalf("attempts = %d, err = %v", attempts, err)
+	}
+	if err := a.DeleteMFAChallenge(ctx, "token-hash"); err != nil {
+		t.Fatalf("DeleteMFAChallenge error: %v", err)
+	}
+	if err := a.DeleteMFAChallenge(ctx, "token-hash"); !errors.Is(err, coreid.ErrInvalidMFAChallenge) {
+		t.Fatalf("second DeleteMFAChallenge err = %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package sqliteidentity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+type OIDCAdapter struct {
+	DB *sql.DB
+}
+
+var _ coreid.OIDCRepository = (*OIDCAdapter)(nil)
+
+// maxUsernameAttempts bounds how many numbered suffixes CreateExternalUser
+// tries when the suggested username is taken.
+const maxUsernameAttempts = 20
+
+// CreateOIDCState also sweeps expired states so abandoned sign-ins do not
+// accumulate.
+func (a *OIDCAdapter) CreateOIDCState(ctx context.Context, stateHash string, state coreid.OIDCLoginState) error {
+	now := time.Now().UTC()
+	if _, err := a.DB.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < ?`, now); err != nil {
+		return err
+	}
+	var owner any
+	if state.UserID > 0 {
+		owner = state.UserID
+	}
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO oidc_login_states (state_hash, user_id, purpose, code_verifier, nonce, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, stateHash, owner, state.Purpose, state.CodeVerifier, state.Nonce, state.ExpiresAt.UTC(), now)
+	return err
+}
+
+func (a *OIDCAdapter) ConsumeOIDCState(ctx context.Context, stateHash string) (coreid.OIDCLoginState, error) {
+	var state coreid.OIDCLoginState
+	var userID sql.NullInt64
+	err := a.DB.QueryRowContext(ctx, `
+		DELETE FROM oidc_login_states WHERE state_hash = ?
+		RETURNING user_id, purpose, code_verifier, nonce, expires_at
+	`, stateHash).Scan(&userID, &state.Purpose, &state.CodeVerifier, &state.Nonce, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.OIDCLoginState{}, coreid.ErrInvalidOIDCState
+		}
+		return coreid.OIDCLoginState{}, err
+	}
+	state.UserID = coreid.UserID(userID.Int64)
+	return state, nil
+}
+
+func (a *OIDCAdapter) FindExternalIdentity(ctx context.Context, issuer, subject string) (coreid.Principal, error) {
+	var principal coreid.Principal
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT u.id, u.username
+		FROM user_external_identities x
+		JOIN users u ON u.id = x.user_id
+		WHERE x.issuer = ? AND x.subject = ?
+	`, issuer, subject).Scan(&principal.ID, &principal.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.Principal{}, coreid.ErrExternalIdentityUnknown
+		}
+		return coreid.Principal{}, err
+	}
+	return principal, nil
+}
+
+func (a *OIDCAdapter) LinkExternalIdentity(ctx context.Context, userID coreid.UserID, ident coreid.ExternalIdentity, now time.Time) (coreid.ExternalIdentityLink, error) {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return coreid.ExternalIdentityLink{}, err
+	}
+	defer tx.Rollback()
+	if err := linkExternalIdentityTx(ctx, tx, userID, ident, now); err != nil {
+		return coreid.ExternalIdentityLink{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return coreid.ExternalIdentityLink{}, err
+	}
+	return coreid.ExternalIdentityLink{
+		UserID:    userID,
+		Issuer:    ident.Issuer,
+		Subject:   ident.Subject,
+		Email:     ident.Email,
+		CreatedAt: now.UTC(),
+	}, nil
+}
+
+// CreateExternalUser inserts the account and its link in one transaction.
+// When username is taken it tries username-2, username-3, ...
+func (a *OIDCAdapter) CreateExternalUser(ctx context.Context, username string, ident coreid.ExternalIdentity, now time.Time) (coreid.Principal, error) {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return coreid.Principal{}, err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	candidate := username
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			candidate = fmt.Sprintf("%s-%d", username, attempt)
+		}
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO users (username, password_hash, display_name) VALUES (?, '', ?)
+			ON CONFLICT (username) DO NOTHING
+			RETURNING id
+		`, candidate, strings.TrimSpace(ident.Name)).Scan(&userID)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return coreid.Principal{}, err
+		}
+		if attempt == maxUsernameAttempts {
+			return coreid.Principal{}, fmt.Errorf("no free username near %q", username)
+		}
+	}
+	if err := linkExternalIdentityTx(ctx, tx, coreid.UserID(userID), ident, now); err != nil {
+		return coreid.Principal{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE user_external_identities SET last_login_at = ? WHERE issuer = ? AND subject = ?
+	`, now.UTC(), ident.Issuer, ident.Subject); err != nil {
+		return coreid.Principal{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return coreid.Principal{}, err
+	}
+	return coreid.Principal{ID: coreid.UserID(userID), Username: candidate}, nil
+}
+
+func (a *OIDCAdapter) TouchExternalIdentity(ctx context.Context, issuer, subject string, now time.Time) error {
+	result, err := a.DB.ExecContext(ctx, `
+		UPDATE user_external_identities SET last_login_at = ? WHERE issuer = ? AND subject = ?
+	`, now.UTC(), issuer, subject)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, coreid.ErrExternalIdentityMissing)
+}
+
+func (a *OIDCAdapter) ListExternalIdentities(ctx context.Context, userID coreid.UserID) ([]coreid.ExternalIdentityLink, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT user_id, issuer, subject, email, created_at, last_login_at
+		FROM user_external_identities
+		WHERE user_id = ?
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]coreid.ExternalIdentityLink, 0)
+	for rows.Next() {
+		var link coreid.ExternalIdentityLink
+		var lastLogin sql.NullTime
+		if err := rows.Scan(&link.UserID, &link.Issuer, &link.Subject, &link.Email, &link.CreatedAt, &lastLogin); err != nil {
+			return nil, err
+		}
+		if lastLogin.Valid {
+			t := lastLogin.Time
+			link.LastLoginAt = &t
+		}
+		out = append(out, link)
+	}
+	return out, rows.Err()
+}
+
+func (a *OIDCAdapter) UnlinkExternalIdentity(ctx context.Context, userID coreid.UserID, issuer, subject string) error {
+	result, err := a.DB.ExecContext(ctx, `
+		DELETE FROM user_external_identities WHERE user_id = ? AND issuer = ? AND subject = ?
+	`, userID, issuer, subject)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, coreid.ErrExternalIdentityMissing)
+}
+
+// linkExternalIdentityTx tells apart the two uniqueness rules so callers can
+// report which one was hit.
+func linkExternalIdentityTx(ctx context.Context, tx *sql.Tx, userID coreid.UserID, ident coreid.ExternalIdentity, now time.Time) error {
+	var owner int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT user_id FROM user_external_identities WHERE issuer = ? AND subject = ?
+	`, ident.Issuer, ident.Subject).Scan(&owner)
+	switch {
+	case err == nil && coreid.UserID(owner) == userID:
+		return coreid.ErrExternalIdentityExists
+	case err == nil:
+		return coreid.ErrExternalIdentityLinked
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_external_identities (user_id, issuer, subject, email, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, ident.Issuer, ident.Subject, ident.Email, now.UTC())
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return coreid.ErrExternalIdentityExists
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package sqliteidentity
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+func TestOIDCAdapter_StatesAndLinks(t *testing.T) {
+	mfa, userID := newMFAAdapter(t)
+	a := &OIDCAdapter{DB: mfa.DB}
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	if err := a.CreateOIDCState(ctx, "hash-1", coreid.OIDCLoginState{
+		UserID: userID, Purpose: coreid.OIDCPurposeLink, CodeVerifier: "verifier", Nonce: "nonce", ExpiresAt: now.Add(time.Minute),
+	}); err != nil {
+		t.Fatalf("CreateOIDCState error: %v", err)
+	}
+	state, err := a.ConsumeOIDCState(ctx, "hash-1")
+	if err != nil || state.UserID != userID || state.Purpose != coreid.OIDCPurposeLink || state.CodeVerifier != "verifier" || state.Nonce != "nonce" {
+		t.Fatalf("ConsumeOIDCState = %+v, %v", state, err)
+	}
+	if _, err := a.ConsumeOIDCState(ctx, "hash-1"); !errors.Is(err, coreid.ErrInvalidOIDCState) {
+		t.Fatalf("second consume err = %v", err)
+	}
+
+	ident := coreid.ExternalIdentity{Issuer: "https://idp.example", Subject: "sub-1", Email: "alice@corp.example"}
+	if _, err := a.FindExternalIdentity(ctx, ident.Issuer, ident.Subject); !errors.Is(err, coreid.ErrExternalIdentityUnknown) {
+		t.Fatalf("unlinked FindExternalIdentity err = %v", err)
+	}
+	if _, err := a.LinkExternalIdentity(ctx, userID, ident, now); err != nil {
+		t.Fatalf("LinkExternalIdentity error: %v", err)
+	}
+	if _, err := a.LinkExternalIdentity(ctx, userID, ident, now); !errors.Is(err, coreid.ErrExternalIdentityExists) {
+		t.Fatalf("relink err = %v", err)
+	}
+	second := ident
+	second.Subject = "sub-2"
+	if _, err := a.LinkExternalIdentity(ctx, userID, second, now); !errors.Is(err, coreid.ErrExternalIdentityExists) {
+		t.Fatalf("second identity from same issuer err = %v", err)
+	}
+	principal, err := a.FindExternalIdentity(ctx, ident.Issuer, ident.Subject)
+	if err != nil || principal.ID != userID || principal.Username != "alice" {
+		t.Fatalf("FindExternalIdentity = %+v, %v", principal, err)
+	}
+	if err := a.TouchExternalIdentity(ctx, ident.Issuer, ident.Subject, now); err != nil {
+		t.Fatalf("TouchExternalIdentity error: %v", err)
+	}
+	links, err := a.ListExternalIdentities(ctx, userID)
+	if err != nil || len(links) != 1 || links[0].LastLoginAt == nil || links[0].Email != ident.Email {
+		t.Fatalf("ListExternalIdentities = %+v, %v", links, err)
+	}
+
+	if err := a.UnlinkExternalIdentity(ctx, userID+1, ident.Issuer, ident.Subject); !errors.Is(err, coreid.ErrExternalIdentityMissing) {
+		t.Fatalf("unlink by another user err = %v", err)
+	}
+	if err := a.UnlinkExternalIdentity(ctx, userID, ident.Issuer, ident.Subject); err != nil {
+		t.Fatalf("UnlinkExternalIdentity error: %v", err)
+	}
+}
+
+func TestOIDCAdapter_CreateExternalUserPicksFreeUsername(t *testing.T) {
+	mfa, aliceID := newMFAAdapter(t)
+	a := &OIDCAdapter{DB: mfa.DB}
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	created, err := a.CreateExternalUser(ctx, "alice", coreid.ExternalIdentity{Issuer: "https://idp.example", Subject: "staff-9", Name: "Alice Two"}, now)
+	if err != nil {
+		t.Fatalf("CreateExternalUser error: %v", err)
+	}
+	if created.ID == aliceID || created.Username != "alice-2" {
+		t.Fatalf("created = %+v", created)
+	}
+	var hash, displayName string
+	if err := a.DB.QueryRow(`SELECT password_hash, display_name FROM users WHERE id = ?`, created.ID).Scan(&hash, &displayName); err != nil {
+		t.Fatal(err)
+	}
+	if hash != "" || displayName != "Alice Two" {
+		t.Fatalf("password_hash = %q display_name = %q", hash, displayName)
+	}
+	principal, err := a.FindExternalIdentity(ctx, "https://idp.example", "staff-9")
+	if err != nil || principal.ID != created.ID {
+		t.Fatalf("FindExternalIdentity = %+v, %v", principal, err)
+	}
+
+	if _, err := a.CreateExternalUser(ctx, "bob", coreid.ExternalIdentity{Issuer: "https://idp.example", Subject: "staff-9"}, now); !errors.Is(err, coreid.ErrExternalIdentityLinked) {
+		t.Fatalf("already linked subject err = %v", err)
+	}
+	var count int
+	if err := a.DB.QueryRow(`SELECT COUNT(*) FROM users WHERE username = 'bob'`).Scan(&count); err != nil || count != 0 {
+		t.Fatalf("expected the failed create to roll back, count = %d, %v", count, err)
+	}
+}
@@ -0,0 +1,199 @@
+package sqliteidentity
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+type PasskeyAdapter struct {
+	DB *sql.DB
+}
+
+var (
+	_ coreid.PasskeyRepository   = (*PasskeyAdapter)(nil)
+	_ coreid.KeyMaterialProvider = (*PasskeyAdapter)(nil)
+)
+
+func (a *PasskeyAdapter) GetPrincipal(ctx context.Context, userID coreid.UserID) (coreid.Principal, error) {
+	return lookupPrincipal(ctx, a.DB, userID)
+}
+
+// ResolveSigningKey returns the COSE public key for keyRef, a base64url
+// credential ID, only when it belongs to principal.
+func (a *PasskeyAdapter) ResolveSigningKey(ctx context.Context, principal coreid.Principal, keyRef string) ([]byte, error) {
+	var publicKey []byte
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT public_key FROM webauthn_credentials WHERE id = ? AND user_id = ?
+	`, keyRef, principal.ID).Scan(&publicKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, coreid.ErrPasskeyNotFound
+		}
+		return nil, err
+	}
+	return publicKey, nil
+}
+
+// UserHandle returns the user's WebAuthn handle, creating a random one on
+// first use.
+func (a *PasskeyAdapter) UserHandle(ctx context.Context, userID coreid.UserID) ([]byte, error) {
+	handle := make([]byte, 32)
+	if _, err := rand.Read(handle); err != nil {
+		return nil, err
+	}
+	if _, err := a.DB.ExecContext(ctx, `
+		INSERT OR IGNORE INTO webauthn_user_handles (user_id, handle, created_at) VALUES (?, ?, ?)
+	`, userID, handle, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	var stored []byte
+	if err := a.DB.QueryRowContext(ctx, `SELECT handle FROM webauthn_user_handles WHERE user_id = ?`, userID).Scan(&stored); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// CreatePasskeyChallenge also sweeps expired challenges so abandoned
+// ceremonies do not accumulate.
+func (a *PasskeyAdapter) CreatePasskeyChallenge(ctx context.Context, challenge string, userID coreid.UserID, purpose string, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	if _, err := a.DB.ExecContext(ctx, `DELETE FROM webauthn_challenges WHERE expires_at < ?`, now); err != nil {
+		return err
+	}
+	var owner any
+	if userID > 0 {
+		owner = userID
+	}
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO webauthn_challenges (challenge, user_id, purpose, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, challenge, owner, purpose, expiresAt.UTC(), now)
+	return err
+}
+
+func (a *PasskeyAdapter) ConsumePasskeyChallenge(ctx context.Context, challenge string) (coreid.PasskeyChallengeRecord, error) {
+	var record coreid.PasskeyChallengeRecord
+	var userID sql.NullInt64
+	err := a.DB.QueryRowContext(ctx, `
+		DELETE FROM webauthn_challenges WHERE challenge = ?
+		RETURNING user_id, purpose, expires_at
+	`, challenge).Scan(&userID, &record.Purpose, &record.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.PasskeyChallengeRecord{}, coreid.ErrInvalidPasskeyChallenge
+		}
+		return coreid.PasskeyChallengeRecord{}, err
+	}
+	record.UserID = coreid.UserID(userID.Int64)
+	return record, nil
+}
+
+func (a *PasskeyAdapter) CreatePasskey(ctx context.Context, cred coreid.PasskeyCredential) (coreid.PasskeyCredential, error) {
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO webauthn_credentials (id, user_id, label, public_key, algorithm, sign_count, aaguid, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, cred.ID, cred.UserID, cred.Label, cred.PublicKey, cred.Algorithm, cred.SignCount, cred.AAGUID, cred.CreatedAt.UTC())
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return coreid.PasskeyCredential{}, coreid.ErrPasskeyExists
+		}
+		return coreid.PasskeyCredential{}, err
+	}
+	return a.GetPasskey(ctx, cred.ID)
+}
+
+func (a *PasskeyAdapter) GetPasskey(ctx context.Context, credentialID string) (coreid.PasskeyCredential, error) {
+	cred, err := scanPasskey(a.DB.QueryRowContext(ctx, `
+		SELECT id, user_id, label, public_key, algorithm, sign_count, aaguid, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE id = ?
+	`, credentialID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return coreid.PasskeyCredential{}, coreid.ErrPasskeyNotFound
+		}
+		return coreid.PasskeyCredential{}, err
+	}
+	return cred, nil
+}
+
+func (a *PasskeyAdapter) ListPasskeys(ctx context.Context, userID coreid.UserID) ([]coreid.PasskeyCredential, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT id, user_id, label, public_key, algorithm, sign_count, aaguid, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE user_id = ?
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]coreid.PasskeyCredential, 0)
+	for rows.Next() {
+		cred, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, cred)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (a *PasskeyAdapter) DeletePasskey(ctx context.Context, userID coreid.UserID, credentialID string) error {
+	result, err := a.DB.ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?`, credentialID, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, coreid.ErrPasskeyNotFound)
+}
+
+// UpdatePasskeySignCount is a compare-and-swap on the stored counter, so two
+// concurrent logins with the same assertion counter cannot both succeed.
+func (a *PasskeyAdapter) UpdatePasskeySignCount(ctx context.Context, credentialID string, previous, next uint32, usedAt time.Time) (bool, error) {
+	result, err := a.DB.ExecContext(ctx, `
+		UPDATE webauthn_credentials
+		SET sign_count = ?, last_used_at = ?
+		WHERE id = ? AND sign_count = ?
+	`, next, usedAt.UTC(), credentialID, previous)
+	if err != nil {
+		return false, err
+	}
+	return rowAffected(result)
+}
+
+type passkeyScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPasskey(scanner passkeyScanner) (coreid.PasskeyCredential, error) {
+	var cred coreid.PasskeyCredential
+	var lastUsedAt sql.NullTime
+	if err := scanner.Scan(
+		&cred.ID,
+		&cred.UserID,
+		&cred.Label,
+		&cred.PublicKey,
+		&cred.Algorithm,
+		&cred.SignCount,
+		&cred.AAGUID,
+		&cred.CreatedAt,
+		&lastUsedAt,
+	); err != nil {
+		return coreid.PasskeyCredential{}, err
+	}
+	if lastUsedAt.Valid {
+		t := lastUsedAt.Time
+		cred.LastUsedAt = &t
+	}
+	return cred, nil
+}
@@ -0,0 +1,72 @@
+package sqliteidentity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+func TestPasskeyAdapter_CredentialsAndChallenges(t *testing.T) {
+	mfa, userID := newMFAAdapter(t)
+	a := &PasskeyAdapter{DB: mfa.DB}
+	ctx := context.Background()
+
+	handle, err := a.UserHandle(ctx, userID)
+	if err != nil || len(handle) != 32 {
+		t.Fatalf("UserHandle = %x, %v", handle, err)
+	}
+	if again, _ := a.UserHandle(ctx, userID); !bytes.Equal(again, handle) {
+		t.Fatal("expected user handle to be stable")
+	}
+
+	if err := a.CreatePasskeyChallenge(ctx, "login", 0, coreid.PasskeyPurposeAuthenticate, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("CreatePasskeyChallenge error: %v", err)
+	}
+	record, err := a.ConsumePasskeyChallenge(ctx, "login")
+	if err != nil || record.UserID != 0 || record.Purpose != coreid.PasskeyPurposeAuthenticate {
+		t.Fatalf("ConsumePasskeyChallenge = %+v, %v", record, err)
+	}
+	if _, err := a.ConsumePasskeyChallenge(ctx, "login"); !errors.Is(err, coreid.ErrInvalidPasskeyChallenge) {
+		t.Fatalf("second consume err = %v", err)
+	}
+
+	cred := coreid.PasskeyCredential{ID: "cred-1", UserID: userID, Label: "laptop", PublicKey: []byte("cose"), Algorithm: -7, SignCount: 2, CreatedAt: time.Now()}
+	if _, err := a.CreatePasskey(ctx, cred); err != nil {
+		t.Fatalf("CreatePasskey error: %v", err)
+	}
+	if _, err := a.CreatePasskey(ctx, cred); !errors.Is(err, coreid.ErrPasskeyExists) {
+		t.Fatalf("duplicate CreatePasskey err = %v", err)
+	}
+	key, err := a.ResolveSigningKey(ctx, coreid.Principal{ID: userID}, "cred-1")
+	if err != nil || string(key) != "cose" {
+		t.Fatalf("ResolveSigningKey = %q, %v", key, err)
+	}
+	if _, err := a.ResolveSigningKey(ctx, coreid.Principal{ID: userID + 1}, "cred-1"); !errors.Is(err, coreid.ErrPasskeyNotFound) {
+		t.Fatalf("ResolveSigningKey for another user err = %v", err)
+	}
+
+	if ok, err := a.UpdatePasskeySignCount(ctx, "cred-1", 1, 3, time.Now()); err != nil || ok {
+		t.Fatalf("stale compare-and-swap = %v, %v", ok, err)
+	}
+	if ok, err := a.UpdatePasskeySignCount(ctx, "cred-1", 2, 3, time.Now()); err != nil || !ok {
+		t.Fatalf("compare-and-swap = %v, %v", ok, err)
+	}
+	list, err := a.ListPasskeys(ctx, userID)
+	if err != nil || len(list) != 1 || list[0].SignCount != 3 || list[0].LastUsedAt == nil {
+		t.Fatalf("ListPasskeys = %+v, %v", list, err)
+	}
+
+	if err := a.DeletePasskey(ctx, userID+1, "cred-1"); !errors.Is(err, coreid.ErrPasskeyNotFound) {
+		t.Fatalf("DeletePasskey by another user err = %v", err)
+	}
+	if err := a.DeletePasskey(ctx, userID, "cred-1"); err != nil {
+		t.Fatalf("DeletePasskey error: %v", err)
+	}
+	if _, err := a.GetPasskey(ctx, "cred-1"); !errors.Is(err, coreid.ErrPasskeyNotFound) {
+		t.Fatalf("GetPasskey after delete err = %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package sqlitejobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	corejobs "github.com/kyambuthia/go-chat-site/server/internal/core/jobs"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+)
+
+// Adapter stores job state in scheduled_jobs. Unlike most store adapters it
+// also runs on PostgreSQL, because session and rate-limit cleanup are needed
+// on both backends.
+type Adapter struct {
+	DB *sql.DB
+	// Dialect is the SQL flavour of DB; the zero value is SQLite.
+	Dialect dialect.Dialect
+}
+
+var _ corejobs.Repository = (*Adapter)(nil)
+
+const stateColumns = `name, next_run_at, lease_owner, lease_until, attempts, runs, failures,
+	last_started_at, last_finished_at, last_duration_ms, last_items, last_error`
+
+func (a *Adapter) EnsureJob(ctx context.Context, name string, firstRunAt time.Time) error {
+	_, err := a.DB.ExecContext(ctx, a.Dialect.Rebind(`
+		INSERT INTO scheduled_jobs (name, next_run_at, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO NOTHING
+	`), name, firstRunAt.UTC(), time.Now().UTC())
+	return err
+}
+
+func (a *Adapter) ClaimJob(ctx context.Context, name, owner string, now, leaseUntil time.Time) (corejobs.State, bool, error) {
+	state, err := scanState(a.DB.QueryRowContext(ctx, a.Dialect.Rebind(`
+		UPDATE scheduled_jobs
+		SET lease_owner = ?, lease_until = ?, last_started_at = ?
+		WHERE name = ? AND next_run_at <= ? AND (lease_until IS NULL OR lease_until <= ?)
+		RETURNING `+stateColumns), owner, leaseUntil.UTC(), now.UTC(), name, now.UTC(), now.UTC()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return corejobs.State{}, false, nil
+	}
+	if err != nil {
+		return corejobs.State{}, false, err
+	}
+	return state, true, nil
+}
+
+func (a *Adapter) CompleteJob(ctx context.Context, name, owner string, result corejobs.RunResult) error {
+	failed := 0
+	if result.Error != "" {
+		failed = 1
+	}
+	res, err := a.DB.ExecContext(ctx, a.Dialect.Rebind(`
+		UPDATE scheduled_jobs
+		SET lease_owner = '', lease_until = NULL, next_run_at = ?,
+			runs = runs + 1, failures = failures + ?,
+			attempts = CASE WHEN ? = 1 THEN attempts + 1 ELSE 0 END,
+			last_finished_at = ?, last_duration_ms = ?, last_items = ?, last_error = ?
+		WHERE name = ? AND lease_owner = ?
+	`), result.NextRunAt.UTC(), failed, failed, result.FinishedAt.UTC(), result.Duration.Milliseconds(),
+		result.Items, result.Error, name, owner)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (a *Adapter) ListJobs(ctx context.Context) ([]corejobs.State, error) {
+	rows, err := a.DB.QueryContext(ctx, `SELECT `+stateColumns+` FROM scheduled_jobs ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]corejobs.State, 0)
+	for rows.Next() {
+		state, err := scanState(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, state)
+	}
+	return out, rows.Err()
+}
+
+func (a *Adapter) ScheduleJob(ctx context.Context, name string, runAt time.Time) error {
+	res, err := a.DB.ExecContext(ctx, a.Dialect.Rebind(`
+		UPDATE scheduled_jobs SET next_run_at = ? WHERE name = ?
+	`), runAt.UTC(), name)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return corejobs.ErrJobNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanState(s scanner) (corejobs.State, error) {
+	var state corejobs.State
+	var leaseUntil, startedAt, finishedAt sql.NullTime
+	var durationMs int64
+	if err := s.Scan(
+		&state.Name,
+		&state.NextRunAt,
+		&state.LeaseOwner,
+		&leaseUntil,
+		&state.Attempts,
+		&state.Runs,
+		&state.Failures,
+		&startedAt,
+		&finishedAt,
+		&durationMs,
+		&state.LastItems,
+		&state.LastError,
+	); err != nil {
+		return corejobs.State{}, err
+	}
+	state.LeaseUntil = nullTime(leaseUntil)
+	state.LastStartedAt = nullTime(startedAt)
+	state.LastFinishedAt = nullTime(finishedAt)
+	state.LastDuration = time.Duration(durationMs) * time.Millisecond
+	return state, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
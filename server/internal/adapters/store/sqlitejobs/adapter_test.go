@@ -0,0 +1,116 @@
+package sqlitejobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corejobs "github.com/kyambuthia/go-chat-site/server/internal/core/jobs"
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+func newJobsStore(t *testing.T) (*store.SqliteStore, *Adapter) {
+	t.Helper()
+	s, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.RunMigrations(s.DB, filepath.Join("..", "..", "..", "..", "migrations")); err != nil {
+		t.Fatal(err)
+	}
+	return s, &Adapter{DB: s.DB}
+}
+
+func TestAdapter_ClaimJob_LeasesToOneOwnerUntilExpiry(t *testing.T) {
+	_, a := newJobsStore(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	if err := a.EnsureJob(ctx, "session_cleanup", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.EnsureJob(ctx, "session_cleanup", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := a.ClaimJob(ctx, "session_cleanup", "one", now, now.Add(time.Minute)); !ok || err != nil {
+		t.Fatalf("first claim ok=%v err=%v; EnsureJob must keep the original schedule", ok, err)
+	}
+	if _, ok, _ := a.ClaimJob(ctx, "session_cleanup", "two", now.Add(30*time.Second), now.Add(2*time.Minute)); ok {
+		t.Fatal("a held lease was claimed by another owner")
+	}
+
+	expired := now.Add(time.Minute)
+	if _, ok, err := a.ClaimJob(ctx, "session_cleanup", "two", expired, expired.Add(time.Minute)); !ok || err != nil {
+		t.Fatalf("expired lease claim ok=%v err=%v", ok, err)
+	}
+	if err := a.CompleteJob(ctx, "session_cleanup", "one", corejobs.RunResult{FinishedAt: expired, NextRunAt: expired}); !errors.Is(err, corejobs.ErrJobNotFound) {
+		t.Fatalf("stale owner completion err = %v", err)
+	}
+
+	result := corejobs.RunResult{FinishedAt: expired, NextRunAt: expired.Add(time.Hour), Duration: 1500 * time.Millisecond, Error: "database is locked"}
+	if err := a.CompleteJob(ctx, "session_cleanup", "two", result); err != nil {
+		t.Fatal(err)
+	}
+	states, err := a.ListJobs(ctx)
+	if err != nil || len(states) != 1 {
+		t.Fatalf("ListJobs = %v, %v", states, err)
+	}
+	state := states[0]
+	if state.LeaseUntil != nil || state.LeaseOwner != "" || state.Runs != 1 || state.Failures != 1 || state.Attempts != 1 ||
+		state.LastDuration != 1500*time.Millisecond || state.LastError != "database is locked" || !state.NextRunAt.Equal(expired.Add(time.Hour)) {
+		t.Fatalf("state = %+v", state)
+	}
+
+	if err := a.ScheduleJob(ctx, "session_cleanup", expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := a.ClaimJob(ctx, "session_cleanup", "one", expired, expired.Add(time.Minute)); !ok {
+		t.Fatal("job scheduled to run now was not claimable")
+	}
+	if err := a.CompleteJob(ctx, "session_cleanup", "one", corejobs.RunResult{FinishedAt: expired, NextRunAt: expired.Add(time.Hour), Items: 4}); err != nil {
+		t.Fatal(err)
+	}
+	states, _ = a.ListJobs(ctx)
+	if states[0].Attempts != 0 || states[0].Runs != 2 || states[0].LastItems != 4 || states[0].LastError != "" {
+		t.Fatalf("state after success = %+v", states[0])
+	}
+	if err := a.ScheduleJob(ctx, "missing", expired); !errors.Is(err, corejobs.ErrJobNotFound) {
+		t.Fatalf("ScheduleJob unknown job err = %v", err)
+	}
+}
+
+func TestAdapter_PruneRateLimits_KeepsCurrentWindowsAndLockouts(t *testing.T) {
+	s, a := newJobsStore(t)
+	now := time.Now().UTC()
+	old := now.Add(-2 * time.Hour)
+	for _, q := range []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO rate_limit_windows (rate_key, window_start_unix, hits, updated_at_unix) VALUES (?, ?, 1, ?)`, []any{"ip:old", old.Unix(), old.Unix()}},
+		{`INSERT INTO rate_limit_windows (rate_key, window_start_unix, hits, updated_at_unix) VALUES (?, ?, 1, ?)`, []any{"ip:new", now.Unix(), now.Unix()}},
+		{`INSERT INTO auth_login_throttles (scope_key, failure_count, updated_at) VALUES (?, 1, ?)`, []any{"user:stale", now.Add(-48 * time.Hour)}},
+		{`INSERT INTO auth_login_throttles (scope_key, failure_count, locked_until, updated_at) VALUES (?, 5, ?, ?)`, []any{"user:locked", now.Add(time.Hour), now.Add(-48 * time.Hour)}},
+		{`INSERT INTO auth_login_throttles (scope_key, failure_count, updated_at) VALUES (?, 1, ?)`, []any{"user:recent", now}},
+	} {
+		if _, err := s.DB.Exec(q.query, q.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := a.PruneRateLimits(context.Background(), now)
+	if err != nil || n != 2 {
+		t.Fatalf("PruneRateLimits = %d, %v; want 2 rows", n, err)
+	}
+	var windows, throttles int
+	_ = s.DB.QueryRow(`SELECT COUNT(*) FROM rate_limit_windows`).Scan(&windows)
+	_ = s.DB.QueryRow(`SELECT COUNT(*) FROM auth_login_throttles`).Scan(&throttles)
+	if windows != 1 || throttles != 2 {
+		t.Fatalf("left %d windows and %d throttles", windows, throttles)
+	}
+}
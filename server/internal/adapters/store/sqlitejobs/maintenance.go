@@ -0,0 +1,37 @@
+package sqlitejobs
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// rateLimitWindowRetention keeps every window of the shared limiter,
+	// which are at most a minute long, with room to spare.
+	rateLimitWindowRetention = time.Hour
+	// loginThrottleRetention is how long a failed-login counter outlives its
+	// last update. Counters for accounts still locked are kept.
+	loginThrottleRetention = 24 * time.Hour
+)
+
+// PruneRateLimits deletes expired rate_limit_windows rows and stale
+// auth_login_throttles rows. Both tables belong to the HTTP adapter, which
+// cannot be imported by the job wiring. It returns how many rows it deleted.
+func (a *Adapter) PruneRateLimits(ctx context.Context, now time.Time) (int, error) {
+	windows, err := a.DB.ExecContext(ctx, a.Dialect.Rebind(`
+		DELETE FROM rate_limit_windows WHERE window_start_unix < ?
+	`), now.Add(-rateLimitWindowRetention).Unix())
+	if err != nil {
+		return 0, err
+	}
+	throttles, err := a.DB.ExecContext(ctx, a.Dialect.Rebind(`
+		DELETE FROM auth_login_throttles
+		WHERE updated_at < ? AND (locked_until IS NULL OR locked_until < ?)
+	`), now.UTC().Add(-loginThrottleRetention), now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	w, _ := windows.RowsAffected()
+	t, _ := throttles.RowsAffected()
+	return int(w + t), nil
+}
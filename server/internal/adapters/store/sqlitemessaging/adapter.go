@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/kyambuthia/go-chat-site/server/internal/config"
@@ -49,12 +50,18 @@ func (a *Adapter) SaveDirectMessage(ctx context.Context, msg coremsg.StoredMessa
 	if contentKind == "" {
 		contentKind = "text"
 	}
-	result, err := a.DB.ExecContext(ctx, `
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return coremsg.StoredMessage{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
 		INSERT INTO messages (
-			from_user_id, to_user_id, body, content_kind, ciphertext, encryption_version, sender_device_id, recipient_device_id
+			from_user_id, to_user_id, body, content_kind, ciphertext, encryption_version, sender_device_id, recipient_device_id, expires_at
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, msg.FromUserID, msg.ToUserID, body, contentKind, msg.Ciphertext, msg.EnvelopeVersion, msg.SenderDeviceID, msg.RecipientDeviceID)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, msg.FromUserID, msg.ToUserID, body, contentKind, msg.Ciphertext, msg.EnvelopeVersion, msg.SenderDeviceID, msg.RecipientDeviceID, msg.ExpiresAt)
 	if err != nil {
 		return coremsg.StoredMessage{}, err
 	}
@@ -62,6 +69,12 @@ func (a *Adapter) SaveDirectMessage(ctx context.Context, msg coremsg.StoredMessa
 	if err != nil {
 		return coremsg.StoredMessage{}, err
 	}
+	if err := linkAttachmentsTx(ctx, tx, id, msg.FromUserID, msg.AttachmentIDs); err != nil {
+		return coremsg.StoredMessage{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return coremsg.StoredMessage{}, err
+	}
 
 	stored, err := a.getByID(ctx, id)
 	if err != nil {
@@ -121,7 +134,7 @@ func (a *Adapter) ListOutboxBefore(ctx context.Context, userID int, beforeID int
 func (a *Adapter) ListOutboxAfter(ctx context.Context, userID int, afterID int64, limit int) ([]coremsg.StoredMessage, error) {
 	rows, err := a.DB.QueryContext(ctx, `
 		SELECT m.id, m.from_user_id, m.to_user_id, m.body, m.ciphertext, m.encryption_version,
-		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at,
+		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at, m.expires_at,
 		       md.delivered_at, md.read_at, mc.client_message_id,
 		       CASE
 		           WHEN mc.client_message_id IS NOT NULL AND mc.delivered = 0 AND md.delivered_at IS NULL THEN 1
@@ -150,13 +163,13 @@ func (a *Adapter) ListOutboxAfter(ctx context.Context, userID int, afterID int64
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return out, nil
+	return a.withAttachmentIDs(ctx, out)
 }
 
 func (a *Adapter) listOutboxQuery(ctx context.Context, userID int, beforeID int64, limit int) ([]coremsg.StoredMessage, error) {
 	query := `
 		SELECT m.id, m.from_user_id, m.to_user_id, m.body, m.ciphertext, m.encryption_version,
-		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at,
+		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at, m.expires_at,
 		       md.delivered_at, md.read_at, mc.client_message_id,
 		       CASE
 		           WHEN mc.client_message_id IS NOT NULL AND mc.delivered = 0 AND md.delivered_at IS NULL THEN 1
@@ -193,7 +206,7 @@ func (a *Adapter) listOutboxQuery(ctx context.Context, userID int, beforeID int6
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return out, nil
+	return a.withAttachmentIDs(ctx, out)
 }
 
 func (a *Adapter) ListUnreadInbox(ctx context.Context, userID int, limit int) ([]coremsg.StoredMessage, error) {
@@ -243,7 +256,7 @@ func (a *Adapter) ListUnreadInboxAfterWithUser(ctx context.Context, userID int,
 func (a *Adapter) listInboxAfterQuery(ctx context.Context, userID int, withUserID int, afterID int64, limit int, unreadOnly bool) ([]coremsg.StoredMessage, error) {
 	query := `
 		SELECT m.id, m.from_user_id, m.to_user_id, m.body, m.ciphertext, m.encryption_version,
-		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at,
+		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at, m.expires_at,
 		       md.delivered_at, md.read_at
 		FROM messages m
 		LEFT JOIN message_deliveries md ON md.message_id = m.id
@@ -278,13 +291,13 @@ func (a *Adapter) listInboxAfterQuery(ctx context.Context, userID int, withUserI
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return out, nil
+	return a.withAttachmentIDs(ctx, out)
 }
 
 func (a *Adapter) GetMessageForRecipient(ctx context.Context, recipientUserID int, messageID int64) (coremsg.StoredMessage, error) {
 	row := a.DB.QueryRowContext(ctx, `
 		SELECT m.id, m.from_user_id, m.to_user_id, m.body, m.ciphertext, m.encryption_version,
-		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at,
+		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at, m.expires_at,
 		       md.delivered_at, md.read_at
 		FROM messages m
 		LEFT JOIN message_deliveries md ON md.message_id = m.id
@@ -297,7 +310,7 @@ func (a *Adapter) GetMessageForRecipient(ctx context.Context, recipientUserID in
 		}
 		return coremsg.StoredMessage{}, err
 	}
-	return msg, nil
+	return a.withMessageAttachmentIDs(ctx, msg)
 }
 
 func (a *Adapter) ListThreadSummaries(ctx context.Context, userID int, limit int) ([]coremsg.ThreadSummary, error) {
@@ -410,7 +423,7 @@ func (a *Adapter) ListThreadSummaries(ctx context.Context, userID int, limit int
 func (a *Adapter) listInboxQuery(ctx context.Context, userID int, withUserID int, beforeID int64, limit int, unreadOnly bool) ([]coremsg.StoredMessage, error) {
 	query := `
 		SELECT m.id, m.from_user_id, m.to_user_id, m.body, m.ciphertext, m.encryption_version,
-		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at,
+		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at, m.expires_at,
 		       md.delivered_at, md.read_at
 		FROM messages m
 		LEFT JOIN message_deliveries md ON md.message_id = m.id
@@ -449,13 +462,13 @@ func (a *Adapter) listInboxQuery(ctx context.Context, userID int, withUserID int
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return out, nil
+	return a.withAttachmentIDs(ctx, out)
 }
 
 func (a *Adapter) getByID(ctx context.Context, id int64) (coremsg.StoredMessage, error) {
 	row := a.DB.QueryRowContext(ctx, `
 		SELECT m.id, m.from_user_id, m.to_user_id, m.body, m.ciphertext, m.encryption_version,
-		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at,
+		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at, m.expires_at,
 		       md.delivered_at, md.read_at, mc.client_message_id,
 		       CASE
 		           WHEN mc.client_message_id IS NOT NULL AND mc.delivered = 0 AND md.delivered_at IS NULL THEN 1
@@ -466,7 +479,11 @@ func (a *Adapter) getByID(ctx context.Context, id int64) (coremsg.StoredMessage,
 		LEFT JOIN message_client_correlations mc ON mc.stored_message_id = m.id AND mc.sender_user_id = m.from_user_id
 		WHERE m.id = ?
 	`, id)
-	return scanStoredMessageWithClientID(row)
+	msg, err := scanStoredMessageWithClientID(row)
+	if err != nil {
+		return coremsg.StoredMessage{}, err
+	}
+	return a.withMessageAttachmentIDs(ctx, msg)
 }
 
 type scanner interface {
@@ -481,6 +498,7 @@ func scanStoredMessage(s scanner) (coremsg.StoredMessage, error) {
 	var contentKind sql.NullString
 	var senderDeviceID sql.NullInt64
 	var recipientDeviceID sql.NullInt64
+	var expiresAt sql.NullTime
 	var deliveredAt sql.NullTime
 	var readAt sql.NullTime
 	if err := s.Scan(
@@ -494,6 +512,7 @@ func scanStoredMessage(s scanner) (coremsg.StoredMessage, error) {
 		&senderDeviceID,
 		&recipientDeviceID,
 		&createdAt,
+		&expiresAt,
 		&deliveredAt,
 		&readAt,
 	); err != nil {
@@ -517,6 +536,10 @@ func scanStoredMessage(s scanner) (coremsg.StoredMessage, error) {
 	if recipientDeviceID.Valid {
 		msg.RecipientDeviceID = recipientDeviceID.Int64
 	}
+	if expiresAt.Valid {
+		t := expiresAt.Time
+		msg.ExpiresAt = &t
+	}
 	if deliveredAt.Valid {
 		t := deliveredAt.Time
 		msg.DeliveredAt = &t
@@ -536,6 +559,7 @@ func scanStoredMessageWithClientID(s scanner) (coremsg.StoredMessage, error) {
 	var contentKind sql.NullString
 	var senderDeviceID sql.NullInt64
 	var recipientDeviceID sql.NullInt64
+	var expiresAt sql.NullTime
 	var deliveredAt sql.NullTime
 	var readAt sql.NullTime
 	var clientMessageID sql.NullInt64
@@ -551,6 +575,7 @@ func scanStoredMessageWithClientID(s scanner) (coremsg.StoredMessage, error) {
 		&senderDeviceID,
 		&recipientDeviceID,
 		&createdAt,
+		&expiresAt,
 		&deliveredAt,
 		&readAt,
 		&clientMessageID,
@@ -576,6 +601,10 @@ func scanStoredMessageWithClientID(s scanner) (coremsg.StoredMessage, error) {
 	if recipientDeviceID.Valid {
 		msg.RecipientDeviceID = recipientDeviceID.Int64
 	}
+	if expiresAt.Valid {
+		t := expiresAt.Time
+		msg.ExpiresAt = &t
+	}
 	if deliveredAt.Valid {
 		t := deliveredAt.Time
 		msg.DeliveredAt = &t
@@ -606,3 +635,92 @@ func (a *Adapter) ensureRecipientOwnsMessage(ctx context.Context, recipientUserI
 	}
 	return err
 }
+
+// linkAttachmentsTx attaches uploads to a message. Only the sender's own
+// attachments may be referenced; anything else is reported as invalid.
+func linkAttachmentsTx(ctx context.Context, tx *sql.Tx, messageID int64, senderUserID int, attachmentIDs []int64) error {
+	for position, attachmentID := range attachmentIDs {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO message_attachments (message_id, attachment_id, position)
+			SELECT ?, id, ?
+			FROM attachments
+			WHERE id = ? AND owner_user_id = ?
+		`, messageID, position, attachmentID, senderUserID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return coremsg.ErrInvalidAttachment
+		}
+	}
+	return nil
+}
+
+func (a *Adapter) withMessageAttachmentIDs(ctx context.Context, msg coremsg.StoredMessage) (coremsg.StoredMessage, error) {
+	out, err := a.withAttachmentIDs(ctx, []coremsg.StoredMessage{msg})
+	if err != nil {
+		return coremsg.StoredMessage{}, err
+	}
+	return out[0], nil
+}
+
+// withAttachmentIDs fills AttachmentIDs and Attachments for attachment messages
+// in one query.
+func (a *Adapter) withAttachmentIDs(ctx context.Context, msgs []coremsg.StoredMessage) ([]coremsg.StoredMessage, error) {
+	index := make(map[int64]int)
+	args := make([]any, 0)
+	for i, msg := range msgs {
+		if msg.ContentKind != coremsg.ContentKindAttachment {
+			continue
+		}
+		index[msg.ID] = i
+		args = append(args, msg.ID)
+	}
+	if len(args) == 0 {
+		return msgs, nil
+	}
+
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT ma.message_id, a.id, a.mime_type, a.size_bytes, a.encrypted,
+		       COALESCE(m.width, 0), COALESCE(m.height, 0), COALESCE(m.placeholder, '')
+		FROM message_attachments ma
+		JOIN attachments a ON a.id = ma.attachment_id
+		LEFT JOIN attachment_media m ON m.attachment_id = a.id
+		WHERE ma.message_id IN (?`+strings.Repeat(", ?", len(args)-1)+`)
+		ORDER BY ma.message_id, ma.position
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		var summary coremsg.AttachmentSummary
+		var encrypted int
+		if err := rows.Scan(
+			&messageID,
+			&summary.ID,
+			&summary.MimeType,
+			&summary.SizeBytes,
+			&encrypted,
+			&summary.Width,
+			&summary.Height,
+			&summary.Placeholder,
+		); err != nil {
+			return nil, err
+		}
+		summary.Encrypted = encrypted != 0
+		i := index[messageID]
+		msgs[i].AttachmentIDs = append(msgs[i].AttachmentIDs, summary.ID)
+		msgs[i].Attachments = append(msgs[i].Attachments, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
@@ -793,3 +793,72 @@ func TestAdapter_ListThreadSummaries_EncryptedMessageUsesPlaceholderPreview(t *t
 		t.Fatal("LastMessageEncrypted = false, want true")
 	}
 }
+
+func TestAdapter_SaveDirectMessage_LinksSenderAttachments(t *testing.T) {
+	s := newMessagingStore(t)
+	aliceID := seedUser(t, s, "alice")
+	bobID := seedUser(t, s, "bob")
+	a := &Adapter{DB: s.DB}
+
+	seedAttachment := func(ownerID int) int64 {
+		t.Helper()
+		res, err := s.DB.Exec(`INSERT INTO attachments (owner_user_id, blob_id, mime_type, size_bytes) VALUES (?, 'blob', 'image/png', 10)`, ownerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		return id
+	}
+	first := seedAttachment(aliceID)
+	second := seedAttachment(aliceID)
+	bobs := seedAttachment(bobID)
+
+	saved, err := a.SaveDirectMessage(context.Background(), coremsg.StoredMessage{
+		FromUserID:    aliceID,
+		ToUserID:      bobID,
+		ContentKind:   coremsg.ContentKindAttachment,
+		AttachmentIDs: []int64{second, first},
+	})
+	if err != nil {
+		t.Fatalf("SaveDirectMessage error: %v", err)
+	}
+	if len(saved.AttachmentIDs) != 2 || saved.AttachmentIDs[0] != second || saved.AttachmentIDs[1] != first {
+		t.Fatalf("saved attachment ids = %v, want [%d %d]", saved.AttachmentIDs, second, first)
+	}
+
+	inbox, err := a.ListInbox(context.Background(), bobID, 10)
+	if err != nil {
+		t.Fatalf("ListInbox error: %v", err)
+	}
+	if len(inbox) != 1 || len(inbox[0].AttachmentIDs) != 2 {
+		t.Fatalf("inbox = %+v, want one message with two attachments", inbox)
+	}
+
+	if _, err := s.DB.Exec(`INSERT INTO attachment_media (attachment_id, status, width, height, placeholder) VALUES (?, 'ready', 640, 480, 'LKO2?U%2Tw=w')`, first); err != nil {
+		t.Fatal(err)
+	}
+	inbox, err = a.ListInbox(context.Background(), bobID, 10)
+	if err != nil {
+		t.Fatalf("ListInbox error: %v", err)
+	}
+	if got := inbox[0].Attachments; len(got) != 2 || got[0].Width != 0 || got[1].Width != 640 || got[1].Height != 480 || got[1].Placeholder == "" || got[1].MimeType != "image/png" {
+		t.Fatalf("attachment summaries = %+v, want media dimensions on the second entry", got)
+	}
+
+	_, err = a.SaveDirectMessage(context.Background(), coremsg.StoredMessage{
+		FromUserID:    aliceID,
+		ToUserID:      bobID,
+		ContentKind:   coremsg.ContentKindAttachment,
+		AttachmentIDs: []int64{first, bobs},
+	})
+	if !errors.Is(err, coremsg.ErrInvalidAttachment) {
+		t.Fatalf("foreign attachment err = %v, want ErrInvalidAttachment", err)
+	}
+	var count int
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM messages`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("message count = %d, want rejected message rolled back", count)
+	}
+}
@@ -0,0 +1,13 @@
+package sqlitemessaging
+
+import (
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/store/storetest"
+)
+
+func TestAdapter_MessagingContract(t *testing.T) {
+	storetest.RunMessagingContract(t, storetest.OpenSQLite, func(b storetest.Backend) storetest.MessagingRepository {
+		return &Adapter{DB: b.DB}
+	})
+}
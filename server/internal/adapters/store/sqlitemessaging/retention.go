@@ -0,0 +1,259 @@
+package sqlitemessaging
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+var _ coremsg.RetentionRepository = (*Adapter)(nil)
+
+func threadPair(userID, peerUserID int) (int, int) {
+	if userID < peerUserID {
+		return userID, peerUserID
+	}
+	return peerUserID, userID
+}
+
+func (a *Adapter) GetThreadRetention(ctx context.Context, userID, peerUserID int) (coremsg.ThreadRetention, error) {
+	low, high := threadPair(userID, peerUserID)
+	setting := coremsg.ThreadRetention{UserID: userID, PeerUserID: peerUserID}
+	var ttlSeconds int64
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT ttl_seconds, updated_by_user_id, updated_at
+		FROM thread_retention_settings
+		WHERE user_low_id = ? AND user_high_id = ?
+	`, low, high).Scan(&ttlSeconds, &setting.UpdatedByUserID, &setting.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return setting, nil
+	}
+	if err != nil {
+		return coremsg.ThreadRetention{}, err
+	}
+	setting.TTL = time.Duration(ttlSeconds) * time.Second
+	return setting, nil
+}
+
+func (a *Adapter) SetThreadRetention(ctx context.Context, userID, peerUserID int, ttl time.Duration, at time.Time) (coremsg.ThreadRetention, error) {
+	var exists int
+	err := a.DB.QueryRowContext(ctx, `SELECT 1 FROM users WHERE id = ? AND deleted_at IS NULL`, peerUserID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return coremsg.ThreadRetention{}, coremsg.ErrThreadPeerNotFound
+	}
+	if err != nil {
+		return coremsg.ThreadRetention{}, err
+	}
+
+	low, high := threadPair(userID, peerUserID)
+	at = at.UTC()
+	if _, err := a.DB.ExecContext(ctx, `
+		INSERT INTO thread_retention_settings (user_low_id, user_high_id, ttl_seconds, updated_by_user_id, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_low_id, user_high_id) DO UPDATE SET
+			ttl_seconds = excluded.ttl_seconds,
+			updated_by_user_id = excluded.updated_by_user_id,
+			updated_at = excluded.updated_at
+	`, low, high, int64(ttl/time.Second), userID, at); err != nil {
+		return coremsg.ThreadRetention{}, err
+	}
+	return coremsg.ThreadRetention{
+		UserID:          userID,
+		PeerUserID:      peerUserID,
+		TTL:             ttl,
+		UpdatedByUserID: userID,
+		UpdatedAt:       at,
+	}, nil
+}
+
+// PurgeExpiredMessages deletes expired messages; their deliveries,
+// correlations and attachment links go through ON DELETE CASCADE. An
+// attachment goes with its last message, so neither participant can still
+// download it.
+func (a *Adapter) PurgeExpiredMessages(ctx context.Context, now, deliveredBefore time.Time, limit int) (coremsg.Purge, error) {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return coremsg.Purge{}, err
+	}
+	defer tx.Rollback()
+
+	policy := 0
+	if !deliveredBefore.IsZero() {
+		policy = 1
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT m.id, m.from_user_id, m.to_user_id
+		FROM messages m
+		LEFT JOIN message_deliveries md ON md.message_id = m.id
+		WHERE (m.expires_at IS NOT NULL AND m.expires_at <= ?)
+		   OR (? = 1 AND m.ciphertext != '' AND md.delivered_at IS NOT NULL AND md.delivered_at <= ?)
+		ORDER BY m.id
+		LIMIT ?
+	`, now.UTC(), policy, deliveredBefore.UTC(), limit)
+	if err != nil {
+		return coremsg.Purge{}, err
+	}
+	type purge struct {
+		id         int64
+		fromUserID int
+		toUserID   int
+	}
+	var purges []purge
+	for rows.Next() {
+		var p purge
+		if err := rows.Scan(&p.id, &p.fromUserID, &p.toUserID); err != nil {
+			rows.Close()
+			return coremsg.Purge{}, err
+		}
+		purges = append(purges, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return coremsg.Purge{}, err
+	}
+	if len(purges) == 0 {
+		return coremsg.Purge{}, nil
+	}
+
+	ids := make([]any, 0, len(purges))
+	for _, p := range purges {
+		ids = append(ids, p.id)
+	}
+	in := `(?` + strings.Repeat(", ?", len(ids)-1) + `)`
+	blobIDs, err := purgeOrphanedAttachments(ctx, tx, in, ids)
+	if err != nil {
+		return coremsg.Purge{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE id IN `+in, ids...); err != nil {
+		return coremsg.Purge{}, err
+	}
+	for _, p := range purges {
+		for _, userID := range []int{p.fromUserID, p.toUserID} {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO message_purges (user_id, message_id, purged_at) VALUES (?, ?, ?)
+			`, userID, p.id, now.UTC()); err != nil {
+				return coremsg.Purge{}, err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return coremsg.Purge{}, err
+	}
+	return coremsg.Purge{Messages: len(purges), BlobIDs: blobIDs}, nil
+}
+
+// purgeOrphanedAttachments deletes the attachments that only the messages in
+// the id list carry and returns the blobs they leave unreferenced.
+// Identical files share a blob, so one still used elsewhere is kept.
+func purgeOrphanedAttachments(ctx context.Context, tx *sql.Tx, in string, ids []any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT attachment_id FROM message_attachments
+		WHERE message_id IN `+in+`
+		  AND attachment_id NOT IN (
+		      SELECT attachment_id FROM message_attachments WHERE message_id NOT IN `+in+`
+		  )
+	`, append(append([]any{}, ids...), ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	var attArgs []any
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		attArgs = append(attArgs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(attArgs) == 0 {
+		return nil, err
+	}
+
+	attIn := `(?` + strings.Repeat(", ?", len(attArgs)-1) + `)`
+	candidates, err := queryStrings(ctx, tx, `
+		SELECT blob_id FROM attachments WHERE id IN `+attIn+`
+		UNION
+		SELECT thumbnail_blob_id FROM attachment_media WHERE attachment_id IN `+attIn+` AND thumbnail_blob_id != ''
+	`, append(append([]any{}, attArgs...), attArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range []string{
+		`DELETE FROM attachment_media WHERE attachment_id IN ` + attIn,
+		`DELETE FROM message_attachments WHERE attachment_id IN ` + attIn,
+		`DELETE FROM attachments WHERE id IN ` + attIn,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, attArgs...); err != nil {
+			return nil, err
+		}
+	}
+
+	var blobIDs []string
+	for _, id := range candidates {
+		var used bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM attachments WHERE blob_id = ?1)
+				OR EXISTS (SELECT 1 FROM attachment_media WHERE thumbnail_blob_id = ?1)
+		`, id).Scan(&used); err != nil {
+			return nil, err
+		}
+		if !used {
+			blobIDs = append(blobIDs, id)
+		}
+	}
+	return blobIDs, nil
+}
+
+func queryStrings(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func (a *Adapter) ListPurgedMessagesAfter(ctx context.Context, userID int, afterID int64, limit int) ([]coremsg.PurgedMessage, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT id, message_id, purged_at
+		FROM message_purges
+		WHERE user_id = ? AND id > ?
+		ORDER BY id ASC
+		LIMIT ?
+	`, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]coremsg.PurgedMessage, 0)
+	for rows.Next() {
+		var p coremsg.PurgedMessage
+		if err := rows.Scan(&p.ID, &p.MessageID, &p.PurgedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (a *Adapter) DeletePurgeRecordsBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := a.DB.ExecContext(ctx, `DELETE FROM message_purges WHERE purged_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
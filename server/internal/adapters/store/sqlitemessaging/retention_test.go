@@ -0,0 +1,174 @@
+package sqlitemessaging
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/blobstore/fsblob"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqliteattachments"
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+func TestAdapter_ThreadRetention_IsSharedByBothParticipants(t *testing.T) {
+	s := newMessagingStore(t)
+	aliceID := seedUser(t, s, "alice")
+	bobID := seedUser(t, s, "bob")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+
+	unset, err := a.GetThreadRetention(ctx, aliceID, bobID)
+	if err != nil || unset.TTL != 0 || unset.UpdatedByUserID != 0 {
+		t.Fatalf("expected no timer, got %+v, %v", unset, err)
+	}
+	if _, err := a.SetThreadRetention(ctx, bobID, aliceID, time.Hour, time.Now()); err != nil {
+		t.Fatalf("SetThreadRetention: %v", err)
+	}
+	got, err := a.GetThreadRetention(ctx, aliceID, bobID)
+	if err != nil || got.TTL != time.Hour || got.UpdatedByUserID != bobID || got.PeerUserID != bobID {
+		t.Fatalf("unexpected setting %+v, %v", got, err)
+	}
+	if _, err := a.SetThreadRetention(ctx, aliceID, 999, time.Hour, time.Now()); !errors.Is(err, coremsg.ErrThreadPeerNotFound) {
+		t.Fatalf("expected ErrThreadPeerNotFound, got %v", err)
+	}
+}
+
+func TestAdapter_PurgeExpiredMessages_RemovesRowsAndRecordsTombstones(t *testing.T) {
+	s := newMessagingStore(t)
+	aliceID := seedUser(t, s, "alice")
+	bobID := seedUser(t, s, "bob")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	expired, err := a.SaveDirectMessage(ctx, coremsg.StoredMessage{FromUserID: aliceID, ToUserID: bobID, Body: "gone", ExpiresAt: &past})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := a.SaveDirectMessage(ctx, coremsg.StoredMessage{FromUserID: aliceID, ToUserID: bobID, Body: "soon", ExpiresAt: &future})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.ExpiresAt == nil || !pending.ExpiresAt.Equal(future) {
+		t.Fatalf("expected expires_at round trip, got %v", pending.ExpiresAt)
+	}
+	encrypted, err := a.SaveDirectMessage(ctx, coremsg.StoredMessage{FromUserID: bobID, ToUserID: aliceID, Ciphertext: "opaque", EnvelopeVersion: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.MarkDelivered(ctx, expired.ID, now.Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.MarkDelivered(ctx, encrypted.ID, now.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RecordClientMessageCorrelation(ctx, coremsg.ClientMessageCorrelation{
+		SenderUserID: aliceID, RecipientUserID: bobID, ClientMessageID: 11, StoredMessageID: expired.ID,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	purge, err := a.PurgeExpiredMessages(ctx, now, time.Time{}, 100)
+	if err != nil || purge.Messages != 1 {
+		t.Fatalf("expected one timer purge, got %+v, %v", purge, err)
+	}
+	for _, table := range []string{"message_deliveries WHERE message_id = ?", "message_client_correlations WHERE stored_message_id = ?", "messages WHERE id = ?"} {
+		var count int
+		if err := s.DB.QueryRow(`SELECT COUNT(*) FROM `+table, expired.ID).Scan(&count); err != nil || count != 0 {
+			t.Fatalf("%s: expected no rows, got %d, %v", table, count, err)
+		}
+	}
+
+	purge, err = a.PurgeExpiredMessages(ctx, now, now.Add(-24*time.Hour), 100)
+	if err != nil || purge.Messages != 1 {
+		t.Fatalf("expected one ciphertext purge, got %+v, %v", purge, err)
+	}
+	outbox, err := a.ListOutbox(ctx, aliceID, 10)
+	if err != nil || len(outbox) != 1 || outbox[0].ID != pending.ID {
+		t.Fatalf("expected only the unexpired message to remain, got %+v, %v", outbox, err)
+	}
+
+	for _, userID := range []int{aliceID, bobID} {
+		purged, err := a.ListPurgedMessagesAfter(ctx, userID, 0, 10)
+		if err != nil || len(purged) != 2 || purged[0].MessageID != expired.ID || purged[1].MessageID != encrypted.ID {
+			t.Fatalf("user %d: unexpected tombstones %+v, %v", userID, purged, err)
+		}
+		later, err := a.ListPurgedMessagesAfter(ctx, userID, purged[0].ID, 10)
+		if err != nil || len(later) != 1 {
+			t.Fatalf("user %d: expected cursor to skip seen tombstones, got %+v, %v", userID, later, err)
+		}
+	}
+
+	removed, err := a.DeletePurgeRecordsBefore(ctx, now.Add(time.Second))
+	if err != nil || removed != 4 {
+		t.Fatalf("expected 4 tombstones pruned, got %d, %v", removed, err)
+	}
+}
+
+func TestReaper_ExpiredMessageTakesItsAttachmentWithIt(t *testing.T) {
+	s := newMessagingStore(t)
+	aliceID := seedUser(t, s, "alice")
+	bobID := seedUser(t, s, "bob")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+	past := time.Now().UTC().Add(-time.Minute)
+
+	blobs, err := fsblob.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachmentsRepo := &sqliteattachments.Adapter{DB: s.DB}
+	attachments := coreatt.NewService(attachmentsRepo, blobs, coreatt.Limits{})
+	attach := func(body string) coreatt.Attachment {
+		t.Helper()
+		info, err := blobs.Put(ctx, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		att, err := attachmentsRepo.CreateAttachment(ctx, coreatt.Attachment{OwnerUserID: aliceID, BlobID: info.ID, MimeType: "text/plain", SizeBytes: info.SizeBytes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return att
+	}
+	gone, kept, copied := attach("disappearing"), attach("forwarded"), attach("disappearing")
+	lonely := attach("only here")
+
+	for _, msg := range []coremsg.StoredMessage{
+		{FromUserID: aliceID, ToUserID: bobID, ContentKind: coremsg.ContentKindAttachment, AttachmentIDs: []int64{gone.ID, kept.ID, lonely.ID}, ExpiresAt: &past},
+		{FromUserID: aliceID, ToUserID: bobID, ContentKind: coremsg.ContentKindAttachment, AttachmentIDs: []int64{kept.ID}},
+	} {
+		if _, err := a.SaveDirectMessage(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := coremsg.NewReaperWithBlobs(a, coremsg.RetentionPolicy{}, blobs).RunOnce(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("RunOnce = %d, %v", n, err)
+	}
+	for _, userID := range []int{aliceID, bobID} {
+		if _, _, err := attachments.OpenAttachment(ctx, userID, gone.ID); !errors.Is(err, coreatt.ErrAttachmentNotFound) {
+			t.Fatalf("user %d: expired attachment err = %v", userID, err)
+		}
+	}
+	if _, err := blobs.Open(ctx, lonely.BlobID); !errors.Is(err, coreatt.ErrAttachmentNotFound) {
+		t.Fatalf("unshared blob still on disk: %v", err)
+	}
+	if _, r, err := attachments.OpenAttachment(ctx, bobID, kept.ID); err != nil {
+		t.Fatalf("attachment still on another message: %v", err)
+	} else {
+		_ = r.Close()
+	}
+	// An identical upload shares the blob, so the file must survive.
+	if _, r, err := attachments.OpenAttachment(ctx, aliceID, copied.ID); err != nil {
+		t.Fatalf("shared blob removed: %v", err)
+	} else {
+		_ = r.Close()
+	}
+}
@@ -0,0 +1,135 @@
+package sqlitemessaging
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+var _ coremsg.SearchRepository = (*Adapter)(nil)
+
+const (
+	searchSnippetTokens = 12
+	searchTimeLayout    = "2006-01-02 15:04:05"
+)
+
+// SearchMessages matches q.Text against messages_fts, newest first or by
+// bm25 relevance. The ciphertext check repeats the index's own rule so a row
+// that gained ciphertext can never surface even if the index were stale.
+func (a *Adapter) SearchMessages(ctx context.Context, q coremsg.SearchQuery) ([]coremsg.SearchResult, error) {
+	match := ftsMatchExpression(q.Text)
+	if match == "" {
+		return []coremsg.SearchResult{}, nil
+	}
+
+	query := `
+		SELECT m.id, m.from_user_id, m.to_user_id, m.body, m.ciphertext, m.encryption_version,
+		       m.content_kind, m.sender_device_id, m.recipient_device_id, m.created_at, m.expires_at,
+		       md.delivered_at, md.read_at,
+		       snippet(messages_fts, 0, ?1, ?2, '…', ?3),
+		       highlight(messages_fts, 0, ?1, ?2)
+		FROM messages_fts
+		JOIN messages m ON m.id = messages_fts.rowid
+		LEFT JOIN message_deliveries md ON md.message_id = m.id
+		WHERE messages_fts MATCH ?4
+		  AND (m.from_user_id = ?5 OR m.to_user_id = ?5)
+		  AND m.ciphertext = ''`
+	args := []any{coremsg.SnippetMatchStart, coremsg.SnippetMatchEnd, searchSnippetTokens, match, q.UserID}
+	if q.WithUserID > 0 {
+		query += ` AND (m.from_user_id = ? OR m.to_user_id = ?)`
+		args = append(args, q.WithUserID, q.WithUserID)
+	}
+	if q.ContentKind != "" {
+		query += ` AND m.content_kind = ?`
+		args = append(args, q.ContentKind)
+	}
+	if !q.Since.IsZero() {
+		query += ` AND m.created_at >= ?`
+		args = append(args, q.Since.UTC().Format(searchTimeLayout))
+	}
+	if !q.Until.IsZero() {
+		query += ` AND m.created_at < ?`
+		args = append(args, q.Until.UTC().Format(searchTimeLayout))
+	}
+	if q.BeforeID > 0 {
+		query += ` AND m.id < ?`
+		args = append(args, q.BeforeID)
+	}
+	if q.Sort == coremsg.SearchSortRelevance {
+		query += ` ORDER BY bm25(messages_fts), m.id DESC`
+	} else {
+		query += ` ORDER BY m.id DESC`
+	}
+	query += ` LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := a.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := make([]coremsg.StoredMessage, 0)
+	excerpts := make([][2]string, 0)
+	for rows.Next() {
+		var excerpt [2]string
+		msg, err := scanStoredMessage(excerptScanner{scanner: rows, snippet: &excerpt[0], highlight: &excerpt[1]})
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+		excerpts = append(excerpts, excerpt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	msgs, err = a.withAttachmentIDs(ctx, msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]coremsg.SearchResult, 0, len(msgs))
+	for i, msg := range msgs {
+		out = append(out, coremsg.SearchResult{Message: msg, Snippet: excerpts[i][0], Highlight: excerpts[i][1]})
+	}
+	return out, nil
+}
+
+// excerptScanner appends the snippet and highlight columns to the shared
+// message scan.
+type excerptScanner struct {
+	scanner
+	snippet, highlight *string
+}
+
+func (s excerptScanner) Scan(dest ...any) error {
+	return s.scanner.Scan(append(dest, s.snippet, s.highlight)...)
+}
+
+// ftsMatchExpression turns free text into an FTS query: every word must
+// match, the last word also matches as a prefix, and user input can never
+// inject MATCH operators because each word is quoted.
+func ftsMatchExpression(text string) string {
+	words := strings.Fields(text)
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.ReplaceAll(word, `"`, "")
+		if strings.IndexFunc(word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+			continue
+		}
+		terms = append(terms, word)
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	for i, term := range terms {
+		if i == len(terms)-1 {
+			terms[i] = `"` + term + `"*`
+		} else {
+			terms[i] = `"` + term + `"`
+		}
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,177 @@
+package sqlitemessaging
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+func TestAdapter_SearchMessages_ScopesAndFilters(t *testing.T) {
+	s := newMessagingStore(t)
+	aliceID := seedUser(t, s, "alice")
+	bobID := seedUser(t, s, "bob")
+	carolID := seedUser(t, s, "carol")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+
+	save := func(from, to int, body, kind string) int64 {
+		t.Helper()
+		msg, err := a.SaveDirectMessage(ctx, coremsg.StoredMessage{FromUserID: from, ToUserID: to, Body: body, ContentKind: kind})
+		if err != nil {
+			t.Fatalf("SaveDirectMessage error: %v", err)
+		}
+		return msg.ID
+	}
+	oldInvoice := save(aliceID, bobID, "the invoice for March is attached", "text")
+	newInvoice := save(bobID, aliceID, "paid the invoice, thanks", "text")
+	carolInvoice := save(carolID, bobID, "carol has an invoice too", "text")
+	save(aliceID, carolID, "lunch tomorrow?", "text")
+	if _, err := s.DB.Exec(`UPDATE messages SET created_at = '2024-03-01 10:00:00' WHERE id = ?`, oldInvoice); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := a.SearchMessages(ctx, coremsg.SearchQuery{UserID: aliceID, Text: "invoice", Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchMessages error: %v", err)
+	}
+	if len(results) != 2 || results[0].Message.ID != newInvoice || results[1].Message.ID != oldInvoice {
+		t.Fatalf("results = %+v, want alice's two invoice messages newest first", results)
+	}
+	if want := coremsg.SnippetMatchStart + "invoice" + coremsg.SnippetMatchEnd; !strings.Contains(results[0].Snippet, want) {
+		t.Fatalf("snippet = %q, want highlighted match", results[0].Snippet)
+	}
+	if want := "paid the " + coremsg.SnippetMatchStart + "invoice" + coremsg.SnippetMatchEnd + ", thanks"; results[0].Highlight != want {
+		t.Fatalf("highlight = %q, want %q", results[0].Highlight, want)
+	}
+
+	results, err = a.SearchMessages(ctx, coremsg.SearchQuery{UserID: bobID, Text: "invoice", WithUserID: carolID, Limit: 10})
+	if err != nil || len(results) != 1 || results[0].Message.ID != carolInvoice {
+		t.Fatalf("counterparty results = %+v, err = %v", results, err)
+	}
+
+	results, err = a.SearchMessages(ctx, coremsg.SearchQuery{UserID: aliceID, Text: "invoice", Since: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Limit: 10})
+	if err != nil || len(results) != 1 || results[0].Message.ID != newInvoice {
+		t.Fatalf("since results = %+v, err = %v", results, err)
+	}
+	results, err = a.SearchMessages(ctx, coremsg.SearchQuery{UserID: aliceID, Text: "invoice", Until: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Limit: 10})
+	if err != nil || len(results) != 1 || results[0].Message.ID != oldInvoice {
+		t.Fatalf("until results = %+v, err = %v", results, err)
+	}
+
+	results, err = a.SearchMessages(ctx, coremsg.SearchQuery{UserID: aliceID, Text: "pai", Limit: 10})
+	if err != nil || len(results) != 1 || results[0].Message.ID != newInvoice {
+		t.Fatalf("prefix results = %+v, err = %v", results, err)
+	}
+	results, err = a.SearchMessages(ctx, coremsg.SearchQuery{UserID: aliceID, Text: "invoice", ContentKind: "payment_request", Limit: 10})
+	if err != nil || len(results) != 0 {
+		t.Fatalf("content kind results = %+v, err = %v", results, err)
+	}
+	results, err = a.SearchMessages(ctx, coremsg.SearchQuery{UserID: aliceID, Text: `invoice" OR "lunch NEAR/2 -`, Limit: 10})
+	if err != nil {
+		t.Fatalf("operator-laden query should not error: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("operator results = %+v, want none", results)
+	}
+}
+
+func TestAdapter_SearchMessages_ExcludesCiphertextRows(t *testing.T) {
+	t.Setenv("MESSAGING_STORE_PLAINTEXT_WHEN_ENCRYPTED", "true")
+	s := newMessagingStore(t)
+	aliceID := seedUser(t, s, "alice")
+	bobID := seedUser(t, s, "bob")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+
+	// Compatibility mode keeps plaintext next to ciphertext; search must still skip it.
+	encrypted, err := a.SaveDirectMessage(ctx, coremsg.StoredMessage{
+		FromUserID: aliceID, ToUserID: bobID, Body: "secret rendezvous", Ciphertext: "opaque-envelope", EnvelopeVersion: "x3dh-dr-v1",
+	})
+	if err != nil {
+		t.Fatalf("SaveDirectMessage error: %v", err)
+	}
+	if encrypted.Body == "" {
+		t.Fatal("expected compatibility plaintext to be stored for this test")
+	}
+	plain, err := a.SaveDirectMessage(ctx, coremsg.StoredMessage{FromUserID: aliceID, ToUserID: bobID, Body: "public rendezvous"})
+	if err != nil {
+		t.Fatalf("SaveDirectMessage error: %v", err)
+	}
+
+	var indexed int
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM messages_fts_docsize WHERE id = ?`, encrypted.ID).Scan(&indexed); err != nil {
+		t.Fatal(err)
+	}
+	if indexed != 0 {
+		t.Fatal("ciphertext row must not be in the search index")
+	}
+
+	results, err := a.SearchMessages(ctx, coremsg.SearchQuery{UserID: bobID, Text: "rendezvous", Limit: 10})
+	if err != nil || len(results) != 1 || results[0].Message.ID != plain.ID {
+		t.Fatalf("results = %+v, err = %v, want only the plaintext message", results, err)
+	}
+
+	if _, err := s.DB.Exec(`UPDATE messages SET ciphertext = 'late-envelope' WHERE id = ?`, plain.ID); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := a.SearchMessages(ctx, coremsg.SearchQuery{UserID: bobID, Text: "rendezvous", Limit: 10}); len(results) != 0 {
+		t.Fatalf("results after encrypting = %+v, want none", results)
+	}
+	if _, err := s.DB.Exec(`DELETE FROM messages`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM messages_fts_docsize`).Scan(&indexed); err != nil {
+		t.Fatal(err)
+	}
+	if indexed != 0 {
+		t.Fatalf("index rows after delete = %d, want 0", indexed)
+	}
+}
+
+func TestAdapter_SearchMessages_RanksByRelevance(t *testing.T) {
+	s := newMessagingStore(t)
+	aliceID := seedUser(t, s, "alice")
+	bobID := seedUser(t, s, "bob")
+	a := &Adapter{DB: s.DB}
+	ctx := context.Background()
+
+	var ids []int64
+	for _, body := range []string{
+		"invoice invoice invoice",
+		"here is the invoice for the long list of things we bought over the whole of last month",
+		"lunch?",
+	} {
+		msg, err := a.SaveDirectMessage(ctx, coremsg.StoredMessage{FromUserID: aliceID, ToUserID: bobID, Body: body})
+		if err != nil {
+			t.Fatalf("SaveDirectMessage error: %v", err)
+		}
+		ids = append(ids, msg.ID)
+	}
+
+	recent, err := a.SearchMessages(ctx, coremsg.SearchQuery{UserID: bobID, Text: "invoice", Limit: 10, Sort: coremsg.SearchSortRecent})
+	if err != nil || len(recent) != 2 || recent[0].Message.ID != ids[1] {
+		t.Fatalf("recent results = %+v, err = %v", recent, err)
+	}
+	ranked, err := a.SearchMessages(ctx, coremsg.SearchQuery{UserID: bobID, Text: "invoice", Limit: 10, Sort: coremsg.SearchSortRelevance})
+	if err != nil || len(ranked) != 2 || ranked[0].Message.ID != ids[0] || ranked[1].Message.ID != ids[1] {
+		t.Fatalf("ranked results = %+v, err = %v, want the denser match first", ranked, err)
+	}
+
+	// Updating and deleting indexed rows keeps the external-content index in
+	// step with messages.
+	if _, err := s.DB.Exec(`UPDATE messages SET body = 'receipt attached' WHERE id = ?`, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := a.SearchMessages(ctx, coremsg.SearchQuery{UserID: bobID, Text: "invoice", Limit: 10}); len(results) != 1 || results[0].Message.ID != ids[1] {
+		t.Fatalf("results after edit = %+v", results)
+	}
+	if results, _ := a.SearchMessages(ctx, coremsg.SearchQuery{UserID: bobID, Text: "receipt", Limit: 10}); len(results) != 1 || results[0].Message.ID != ids[0] {
+		t.Fatalf("results for edited body = %+v", results)
+	}
+	if _, err := s.DB.Exec(`INSERT INTO messages_fts (messages_fts) VALUES ('integrity-check')`); err != nil {
+		t.Fatalf("integrity-check: %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+package sqlitepush
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	corepush "github.com/kyambuthia/go-chat-site/server/internal/core/push"
+)
+
+type Adapter struct {
+	DB *sql.DB
+}
+
+var _ corepush.Repository = (*Adapter)(nil)
+
+const subscriptionColumns = `id, user_id, session_id, endpoint, p256dh, auth, created_at`
+
+const jobColumns = `
+	id, subscription_id, user_id, peer_user_id, topic, payload, status, attempts,
+	next_attempt_at, last_error, created_at`
+
+// SaveSubscription replaces any row for the same endpoint, together with the
+// jobs queued for it, then inserts within the per-user limit.
+func (a *Adapter) SaveSubscription(ctx context.Context, sub corepush.Subscription, limit int) (corepush.Subscription, error) {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return corepush.Subscription{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE endpoint = ?`, sub.Endpoint); err != nil {
+		return corepush.Subscription{}, err
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO push_subscriptions (user_id, session_id, endpoint, p256dh, auth, created_at)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE (SELECT COUNT(*) FROM push_subscriptions WHERE user_id = ?) < ?
+		RETURNING id
+	`, sub.UserID, sub.SessionID, sub.Endpoint, sub.P256DH, sub.Auth, sub.CreatedAt.UTC(),
+		sub.UserID, limit).Scan(&sub.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return corepush.Subscription{}, corepush.ErrSubscriptionLimit
+		}
+		if strings.Contains(err.Error(), "FOREIGN KEY constraint failed") {
+			return corepush.Subscription{}, corepush.ErrSessionRequired
+		}
+		return corepush.Subscription{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return corepush.Subscription{}, err
+	}
+	sub.CreatedAt = sub.CreatedAt.UTC()
+	return sub, nil
+}
+
+func (a *Adapter) GetSubscription(ctx context.Context, subscriptionID int64) (corepush.Subscription, error) {
+	sub, err := scanSubscription(a.DB.QueryRowContext(ctx, `
+		SELECT `+subscriptionColumns+` FROM push_subscriptions WHERE id = ?
+	`, subscriptionID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return corepush.Subscription{}, corepush.ErrSubscriptionNotFound
+		}
+		return corepush.Subscription{}, err
+	}
+	return sub, nil
+}
+
+func (a *Adapter) ListSubscriptions(ctx context.Context, userID int) ([]corepush.Subscription, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM push_subscriptions
+		WHERE user_id = ?
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSubscriptions(rows)
+}
+
+func (a *Adapter) ListActiveSubscriptions(ctx context.Context, userID int, now time.Time) ([]corepush.Subscription, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT p.id, p.user_id, p.session_id, p.endpoint, p.p256dh, p.auth, p.created_at
+		FROM push_subscriptions p
+		JOIN auth_sessions s ON s.id = p.session_id
+		WHERE p.user_id = ? AND s.revoked_at IS NULL AND s.refresh_token_expires_at > ?
+		ORDER BY p.id
+	`, userID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanSubscriptions(rows)
+}
+
+func (a *Adapter) DeleteSubscription(ctx context.Context, userID int, subscriptionID int64) error {
+	result, err := a.DB.ExecContext(ctx, `
+		DELETE FROM push_subscriptions WHERE id = ? AND user_id = ?
+	`, subscriptionID, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, corepush.ErrSubscriptionNotFound)
+}
+
+// GetSettings returns zero settings for a user who never saved any.
+func (a *Adapter) GetSettings(ctx context.Context, userID int) (corepush.Settings, error) {
+	settings := corepush.Settings{UserID: userID}
+	var dnd sql.NullTime
+	var start, end sql.NullInt64
+	var offset int
+	err := a.DB.QueryRowContext(ctx, `
+		SELECT dnd_until, quiet_start_minute, quiet_end_minute, quiet_utc_offset_minutes
+		FROM push_settings WHERE user_id = ?
+	`, userID).Scan(&dnd, &start, &end, &offset)
+	if errors.Is(err, sql.ErrNoRows) {
+		return settings, nil
+	}
+	if err != nil {
+		return corepush.Settings{}, err
+	}
+	settings.DNDUntil = nullTimePtr(dnd)
+	if start.Valid && end.Valid {
+		settings.QuietHours = &corepush.QuietHours{
+			StartMinute:      int(start.Int64),
+			EndMinute:        int(end.Int64),
+			UTCOffsetMinutes: offset,
+		}
+	}
+	return settings, nil
+}
+
+func (a *Adapter) SaveSettings(ctx context.Context, settings corepush.Settings) error {
+	var start, end any
+	offset := 0
+	if q := settings.QuietHours; q != nil {
+		start, end, offset = q.StartMinute, q.EndMinute, q.UTCOffsetMinutes
+	}
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO push_settings (user_id, dnd_until, quiet_start_minute, quiet_end_minute, quiet_utc_offset_minutes, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE SET
+			dnd_until = excluded.dnd_until,
+			quiet_start_minute = excluded.quiet_start_minute,
+			quiet_end_minute = excluded.quiet_end_minute,
+			quiet_utc_offset_minutes = excluded.quiet_utc_offset_minutes,
+			updated_at = CURRENT_TIMESTAMP
+	`, settings.UserID, timePtrValue(settings.DNDUntil), start, end, offset)
+	return err
+}
+
+func (a *Adapter) GetMute(ctx context.Context, userID, peerUserID int) (corepush.Mute, error) {
+	mute, err := scanMute(a.DB.QueryRowContext(ctx, `
+		SELECT user_id, peer_user_id, until, created_at
+		FROM push_mutes WHERE user_id = ? AND peer_user_id = ?
+	`, userID, peerUserID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return corepush.Mute{}, corepush.ErrMuteNotFound
+		}
+		return corepush.Mute{}, err
+	}
+	return mute, nil
+}
+
+func (a *Adapter) ListMutes(ctx context.Context, userID int) ([]corepush.Mute, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT user_id, peer_user_id, until, created_at
+		FROM push_mutes WHERE user_id = ?
+		ORDER BY created_at, peer_user_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]corepush.Mute, 0)
+	for rows.Next() {
+		mute, err := scanMute(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, mute)
+	}
+	return out, rows.Err()
+}
+
+// SaveMute creates or replaces the mute. A peer that does not exist is
+// reported as corepush.ErrInvalidMute.
+func (a *Adapter) SaveMute(ctx context.Context, mute corepush.Mute) error {
+	_, err := a.DB.ExecContext(ctx, `
+		INSERT INTO push_mutes (user_id, peer_user_id, until, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, peer_user_id) DO UPDATE SET
+			until = excluded.until,
+			created_at = excluded.created_at
+	`, mute.UserID, mute.PeerUserID, timePtrValue(mute.Until), mute.CreatedAt.UTC())
+	if err != nil && strings.Contains(err.Error(), "FOREIGN KEY constraint failed") {
+		return corepush.ErrInvalidMute
+	}
+	return err
+}
+
+func (a *Adapter) DeleteMute(ctx context.Context, userID, peerUserID int) error {
+	result, err := a.DB.ExecContext(ctx, `
+		DELETE FROM push_mutes WHERE user_id = ? AND peer_user_id = ?
+	`, userID, peerUserID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, corepush.ErrMuteNotFound)
+}
+
+func (a *Adapter) EnqueueJobs(ctx context.Context, jobs []corepush.Job) error {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO push_jobs (subscription_id, user_id, peer_user_id, topic, payload, status, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, j := range jobs {
+		if _, err := stmt.ExecContext(ctx, j.SubscriptionID, j.UserID, j.PeerUserID, j.Topic, j.Payload,
+			string(j.Status), j.NextAttemptAt.UTC(), j.CreatedAt.UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (a *Adapter) ClaimDueJobs(ctx context.Context, now, leaseUntil time.Time, limit int) ([]corepush.Job, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		UPDATE push_jobs
+		SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM push_jobs
+			WHERE status = 'pending' AND next_attempt_at <= ?
+			ORDER BY next_attempt_at, id
+			LIMIT ?
+		)
+		RETURNING `+jobColumns, leaseUntil.UTC(), now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]corepush.Job, 0)
+	for rows.Next() {
+		var j corepush.Job
+		var status string
+		if err := rows.Scan(&j.ID, &j.SubscriptionID, &j.UserID, &j.PeerUserID, &j.Topic, &j.Payload, &status,
+			&j.Attempts, &j.NextAttemptAt, &j.LastError, &j.CreatedAt); err != nil {
+			return nil, err
+		}
+		j.Status = corepush.JobStatus(status)
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+// SaveJobAttempt records a failed attempt. A job whose subscription was
+// deleted meanwhile is gone already, which is not an error.
+func (a *Adapter) SaveJobAttempt(ctx context.Context, job corepush.Job) error {
+	_, err := a.DB.ExecContext(ctx, `
+		UPDATE push_jobs
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?
+		WHERE id = ?
+	`, string(job.Status), job.Attempts, job.NextAttemptAt.UTC(), job.LastError, job.ID)
+	return err
+}
+
+func (a *Adapter) DeleteJob(ctx context.Context, jobID int64) error {
+	_, err := a.DB.ExecContext(ctx, `DELETE FROM push_jobs WHERE id = ?`, jobID)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSubscription(row rowScanner) (corepush.Subscription, error) {
+	var sub corepush.Subscription
+	err := row.Scan(&sub.ID, &sub.UserID, &sub.SessionID, &sub.Endpoint, &sub.P256DH, &sub.Auth, &sub.CreatedAt)
+	return sub, err
+}
+
+func scanSubscriptions(rows *sql.Rows) ([]corepush.Subscription, error) {
+	defer rows.Close()
+	out := make([]corepush.Subscription, 0)
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sub)
+	}
+	return out, rows.Err()
+}
+
+func scanMute(row rowScanner) (corepush.Mute, error) {
+	var mute corepush.Mute
+	var until sql.NullTime
+	if err := row.Scan(&mute.UserID, &mute.PeerUserID, &until, &mute.CreatedAt); err != nil {
+		return corepush.Mute{}, err
+	}
+	mute.Until = nullTimePtr(until)
+	return mute, nil
+}
+
+func requireRowAffected(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func nullTimePtr(v sql.NullTime) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := v.Time
+	return &t
+}
+
+func timePtrValue(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
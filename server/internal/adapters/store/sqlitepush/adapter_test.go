@@ -0,0 +1,191 @@
+package sqlitepush
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corepush "github.com/kyambuthia/go-chat-site/server/internal/core/push"
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+func newPushAdapter(t *testing.T) (*Adapter, int, int) {
+	t.Helper()
+	s, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.RunMigrations(s.DB, filepath.Join("..", "..", "..", "..", "migrations")); err != nil {
+		t.Fatal(err)
+	}
+	alice, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.CreateUser("bob", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Adapter{DB: s.DB}, alice, bob
+}
+
+func insertSession(t *testing.T, a *Adapter, userID int, hash string, refreshExpires time.Time) int64 {
+	t.Helper()
+	var id int64
+	err := a.DB.QueryRow(`
+		INSERT INTO auth_sessions (user_id, current_refresh_hash, access_token_expires_at, refresh_token_expires_at)
+		VALUES (?, ?, ?, ?) RETURNING id
+	`, userID, hash, refreshExpires.UTC(), refreshExpires.UTC()).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestAdapter_SubscriptionsFollowSessions(t *testing.T) {
+	a, alice, bob := newPushAdapter(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	live := insertSession(t, a, alice, "live", now.Add(time.Hour))
+	expired := insertSession(t, a, alice, "expired", now.Add(-time.Hour))
+	bobSession := insertSession(t, a, bob, "bob", now.Add(time.Hour))
+
+	first, err := a.SaveSubscription(ctx, corepush.Subscription{UserID: alice, SessionID: live, Endpoint: "https://push.example/a", P256DH: "k", Auth: "s", CreatedAt: now}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.SaveSubscription(ctx, corepush.Subscription{UserID: alice, SessionID: expired, Endpoint: "https://push.example/b", P256DH: "k", Auth: "s", CreatedAt: now}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.SaveSubscription(ctx, corepush.Subscription{UserID: alice, SessionID: live, Endpoint: "https://push.example/c", P256DH: "k", Auth: "s", CreatedAt: now}, 2); !errors.Is(err, corepush.ErrSubscriptionLimit) {
+		t.Fatalf("third subscription err = %v, want ErrSubscriptionLimit", err)
+	}
+
+	active, err := a.ListActiveSubscriptions(ctx, alice, now)
+	if err != nil || len(active) != 1 || active[0].ID != first.ID {
+		t.Fatalf("active = %+v, err = %v", active, err)
+	}
+
+	// Re-subscribing the same endpoint from another account moves it and
+	// drops the jobs queued for the previous owner.
+	if err := a.EnqueueJobs(ctx, []corepush.Job{{SubscriptionID: first.ID, UserID: alice, PeerUserID: bob, Payload: []byte("{}"), Status: corepush.JobPending, NextAttemptAt: now, CreatedAt: now}}); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := a.SaveSubscription(ctx, corepush.Subscription{UserID: bob, SessionID: bobSession, Endpoint: "https://push.example/a", P256DH: "k2", Auth: "s2", CreatedAt: now}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := a.ClaimDueJobs(ctx, now.Add(time.Second), now.Add(time.Minute), 10); err != nil || len(jobs) != 0 {
+		t.Fatalf("jobs after move = %+v, err = %v", jobs, err)
+	}
+	if subs, _ := a.ListSubscriptions(ctx, alice); len(subs) != 1 {
+		t.Fatalf("alice subscriptions after move = %+v", subs)
+	}
+
+	if err := a.DeleteSubscription(ctx, alice, moved.ID); !errors.Is(err, corepush.ErrSubscriptionNotFound) {
+		t.Fatalf("delete other user's subscription err = %v", err)
+	}
+	if _, err := a.DB.Exec(`DELETE FROM auth_sessions WHERE id = ?`, bobSession); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetSubscription(ctx, moved.ID); !errors.Is(err, corepush.ErrSubscriptionNotFound) {
+		t.Fatalf("subscription outlived its session: err = %v", err)
+	}
+}
+
+func TestAdapter_SettingsAndMutes(t *testing.T) {
+	a, alice, bob := newPushAdapter(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	settings, err := a.GetSettings(ctx, alice)
+	if err != nil || settings.DNDUntil != nil || settings.QuietHours != nil {
+		t.Fatalf("default settings = %+v, err = %v", settings, err)
+	}
+	dnd := now.Add(time.Hour)
+	want := corepush.Settings{UserID: alice, DNDUntil: &dnd, QuietHours: &corepush.QuietHours{StartMinute: 22 * 60, EndMinute: 7 * 60, UTCOffsetMinutes: 180}}
+	if err := a.SaveSettings(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	settings, err = a.GetSettings(ctx, alice)
+	if err != nil || settings.DNDUntil == nil || !settings.DNDUntil.Equal(dnd) || settings.QuietHours == nil || *settings.QuietHours != *want.QuietHours {
+		t.Fatalf("settings = %+v, err = %v", settings, err)
+	}
+	if err := a.SaveSettings(ctx, corepush.Settings{UserID: alice}); err != nil {
+		t.Fatal(err)
+	}
+	if settings, _ := a.GetSettings(ctx, alice); settings.DNDUntil != nil || settings.QuietHours != nil {
+		t.Fatalf("cleared settings = %+v", settings)
+	}
+
+	if err := a.SaveMute(ctx, corepush.Mute{UserID: alice, PeerUserID: 9999, CreatedAt: now}); !errors.Is(err, corepush.ErrInvalidMute) {
+		t.Fatalf("mute unknown peer err = %v", err)
+	}
+	if err := a.SaveMute(ctx, corepush.Mute{UserID: alice, PeerUserID: bob, Until: &dnd, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SaveMute(ctx, corepush.Mute{UserID: alice, PeerUserID: bob, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	mute, err := a.GetMute(ctx, alice, bob)
+	if err != nil || mute.Until != nil {
+		t.Fatalf("mute = %+v, err = %v", mute, err)
+	}
+	if mutes, err := a.ListMutes(ctx, alice); err != nil || len(mutes) != 1 {
+		t.Fatalf("mutes = %+v, err = %v", mutes, err)
+	}
+	if err := a.DeleteMute(ctx, alice, bob); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetMute(ctx, alice, bob); !errors.Is(err, corepush.ErrMuteNotFound) {
+		t.Fatalf("deleted mute err = %v", err)
+	}
+}
+
+func TestAdapter_JobQueue(t *testing.T) {
+	a, alice, bob := newPushAdapter(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	session := insertSession(t, a, alice, "s", now.Add(time.Hour))
+	sub, err := a.SaveSubscription(ctx, corepush.Subscription{UserID: alice, SessionID: session, Endpoint: "https://push.example/a", P256DH: "k", Auth: "s", CreatedAt: now}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.EnqueueJobs(ctx, []corepush.Job{
+		{SubscriptionID: sub.ID, UserID: alice, PeerUserID: bob, Topic: "dm-2", Payload: []byte(`{"n":1}`), Status: corepush.JobPending, NextAttemptAt: now, CreatedAt: now},
+		{SubscriptionID: sub.ID, UserID: alice, PeerUserID: bob, Topic: "dm-2", Payload: []byte(`{"n":2}`), Status: corepush.JobPending, NextAttemptAt: now.Add(time.Hour), CreatedAt: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := a.ClaimDueJobs(ctx, now.Add(time.Second), now.Add(time.Minute), 10)
+	if err != nil || len(jobs) != 1 || string(jobs[0].Payload) != `{"n":1}` || jobs[0].Topic != "dm-2" {
+		t.Fatalf("claimed = %+v, err = %v", jobs, err)
+	}
+	if again, _ := a.ClaimDueJobs(ctx, now.Add(time.Second), now.Add(time.Minute), 10); len(again) != 0 {
+		t.Fatalf("leased job claimed twice: %+v", again)
+	}
+
+	job := jobs[0]
+	job.Status = corepush.JobDead
+	job.Attempts = 3
+	job.LastError = "push service returned 400"
+	if err := a.SaveJobAttempt(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := a.ClaimDueJobs(ctx, now.Add(2*time.Minute), now.Add(3*time.Minute), 10); len(again) != 0 {
+		t.Fatalf("dead job claimed: %+v", again)
+	}
+
+	if err := a.DeleteSubscription(ctx, alice, sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	var remaining int
+	if err := a.DB.QueryRow(`SELECT COUNT(*) FROM push_jobs`).Scan(&remaining); err != nil || remaining != 0 {
+		t.Fatalf("jobs after unsubscribe = %d, err = %v", remaining, err)
+	}
+}
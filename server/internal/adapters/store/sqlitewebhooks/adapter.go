@@ -0,0 +1,252 @@
+package sqlitewebhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	corewebhooks "github.com/kyambuthia/go-chat-site/server/internal/core/webhooks"
+)
+
+type Adapter struct {
+	DB *sql.DB
+}
+
+var _ corewebhooks.Repository = (*Adapter)(nil)
+
+const endpointColumns = `id, user_id, url, description, events, secret, created_at`
+
+const deliveryColumns = `
+	id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_attempt_at, last_status_code, last_error, created_at, delivered_at`
+
+// CreateEndpoint checks the per-user limit and inserts in one statement.
+func (a *Adapter) CreateEndpoint(ctx context.Context, endpoint corewebhooks.Endpoint, limit int) (corewebhooks.Endpoint, error) {
+	events := make([]string, 0, len(endpoint.Events))
+	for _, e := range endpoint.Events {
+		events = append(events, string(e))
+	}
+	err := a.DB.QueryRowContext(ctx, `
+		INSERT INTO webhook_endpoints (user_id, url, description, events, secret, created_at)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE (SELECT COUNT(*) FROM webhook_endpoints WHERE user_id = ?) < ?
+		RETURNING id
+	`, endpoint.UserID, endpoint.URL, endpoint.Description, strings.Join(events, " "), endpoint.Secret, endpoint.CreatedAt.UTC(),
+		endpoint.UserID, limit).Scan(&endpoint.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return corewebhooks.Endpoint{}, corewebhooks.ErrEndpointLimit
+		}
+		return corewebhooks.Endpoint{}, err
+	}
+	endpoint.CreatedAt = endpoint.CreatedAt.UTC()
+	return endpoint, nil
+}
+
+func (a *Adapter) GetEndpoint(ctx context.Context, endpointID int64) (corewebhooks.Endpoint, error) {
+	endpoint, err := scanEndpoint(a.DB.QueryRowContext(ctx, `
+		SELECT `+endpointColumns+` FROM webhook_endpoints WHERE id = ?
+	`, endpointID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return corewebhooks.Endpoint{}, corewebhooks.ErrEndpointNotFound
+		}
+		return corewebhooks.Endpoint{}, err
+	}
+	return endpoint, nil
+}
+
+func (a *Adapter) ListEndpoints(ctx context.Context, userID int) ([]corewebhooks.Endpoint, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT `+endpointColumns+`
+		FROM webhook_endpoints
+		WHERE user_id = ?
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]corewebhooks.Endpoint, 0)
+	for rows.Next() {
+		endpoint, err := scanEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, endpoint)
+	}
+	return out, rows.Err()
+}
+
+func (a *Adapter) DeleteEndpoint(ctx context.Context, userID int, endpointID int64) error {
+	result, err := a.DB.ExecContext(ctx, `
+		DELETE FROM webhook_endpoints WHERE id = ? AND user_id = ?
+	`, endpointID, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, corewebhooks.ErrEndpointNotFound)
+}
+
+// EnqueueDeliveries inserts every delivery in one transaction. An event
+// already queued for an endpoint is skipped rather than sent twice.
+func (a *Adapter) EnqueueDeliveries(ctx context.Context, deliveries []corewebhooks.Delivery) error {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, d := range deliveries {
+		if _, err := stmt.ExecContext(ctx, d.EndpointID, d.EventID, string(d.EventType), d.Payload,
+			string(d.Status), d.NextAttemptAt.UTC(), d.CreatedAt.UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (a *Adapter) ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]corewebhooks.Delivery, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= ?
+			ORDER BY next_attempt_at, id
+			LIMIT ?
+		)
+		RETURNING `+deliveryColumns, leaseUntil.UTC(), now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+func (a *Adapter) SaveDeliveryAttempt(ctx context.Context, d corewebhooks.Delivery) error {
+	result, err := a.DB.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?,
+			last_status_code = ?, last_error = ?, delivered_at = ?
+		WHERE id = ?
+	`, string(d.Status), d.Attempts, d.NextAttemptAt.UTC(), timePtrValue(d.LastAttemptAt),
+		d.LastStatusCode, d.LastError, timePtrValue(d.DeliveredAt), d.ID)
+	if err != nil {
+		return err
+	}
+	return requireRowAffected(result, corewebhooks.ErrDeliveryNotFound)
+}
+
+func (a *Adapter) GetDelivery(ctx context.Context, deliveryID int64) (corewebhooks.Delivery, error) {
+	rows, err := a.DB.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ?`, deliveryID)
+	if err != nil {
+		return corewebhooks.Delivery{}, err
+	}
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return corewebhooks.Delivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return corewebhooks.Delivery{}, corewebhooks.ErrDeliveryNotFound
+	}
+	return deliveries[0], nil
+}
+
+// ListDeliveries returns the newest deliveries across the user's endpoints,
+// or one endpoint's when endpointID is set.
+func (a *Adapter) ListDeliveries(ctx context.Context, userID int, endpointID int64, limit int) ([]corewebhooks.Delivery, error) {
+	rows, err := a.DB.QueryContext(ctx, `
+		SELECT `+prefixColumns("d", deliveryColumns)+`
+		FROM webhook_deliveries d
+		JOIN webhook_endpoints e ON e.id = d.endpoint_id
+		WHERE e.user_id = ? AND (? = 0 OR d.endpoint_id = ?)
+		ORDER BY d.id DESC
+		LIMIT ?
+	`, userID, endpointID, endpointID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEndpoint(row rowScanner) (corewebhooks.Endpoint, error) {
+	var endpoint corewebhooks.Endpoint
+	var events string
+	if err := row.Scan(&endpoint.ID, &endpoint.UserID, &endpoint.URL, &endpoint.Description, &events, &endpoint.Secret, &endpoint.CreatedAt); err != nil {
+		return corewebhooks.Endpoint{}, err
+	}
+	for _, e := range strings.Fields(events) {
+		endpoint.Events = append(endpoint.Events, corewebhooks.EventType(e))
+	}
+	return endpoint, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]corewebhooks.Delivery, error) {
+	defer rows.Close()
+	out := make([]corewebhooks.Delivery, 0)
+	for rows.Next() {
+		var d corewebhooks.Delivery
+		var eventType, status string
+		var lastAttempt, delivered sql.NullTime
+		if err := rows.Scan(&d.ID, &d.EndpointID, &d.EventID, &eventType, &d.Payload, &status, &d.Attempts, &d.NextAttemptAt,
+			&lastAttempt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &delivered); err != nil {
+			return nil, err
+		}
+		d.EventType = corewebhooks.EventType(eventType)
+		d.Status = corewebhooks.DeliveryStatus(status)
+		d.LastAttemptAt = nullTimePtr(lastAttempt)
+		d.DeliveredAt = nullTimePtr(delivered)
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, p := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(p)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func requireRowAffected(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func nullTimePtr(v sql.NullTime) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := v.Time
+	return &t
+}
+
+func timePtrValue(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
@@ -0,0 +1,121 @@
+package sqlitewebhooks
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corewebhooks "github.com/kyambuthia/go-chat-site/server/internal/core/webhooks"
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+func newWebhooksAdapter(t *testing.T) (*Adapter, int, int) {
+	t.Helper()
+	s, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.RunMigrations(s.DB, filepath.Join("..", "..", "..", "..", "migrations")); err != nil {
+		t.Fatal(err)
+	}
+	alice, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.CreateUser("bob", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Adapter{DB: s.DB}, alice, bob
+}
+
+func TestAdapter_EndpointsAndLimit(t *testing.T) {
+	a, alice, bob := newWebhooksAdapter(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	endpoint, err := a.CreateEndpoint(ctx, corewebhooks.Endpoint{
+		UserID: alice, URL: "https://example.com/hook", Events: []corewebhooks.EventType{"message.received", "transfer.settled"},
+		Secret: "whsec_1", CreatedAt: now,
+	}, 1)
+	if err != nil {
+		t.Fatalf("CreateEndpoint error: %v", err)
+	}
+	got, err := a.GetEndpoint(ctx, endpoint.ID)
+	if err != nil || got.Secret != "whsec_1" || len(got.Events) != 2 || got.Events[1] != corewebhooks.EventTransferSettled {
+		t.Fatalf("GetEndpoint = %+v, %v", got, err)
+	}
+	if _, err := a.CreateEndpoint(ctx, corewebhooks.Endpoint{UserID: alice, URL: "https://example.com/2", Events: got.Events, Secret: "s", CreatedAt: now}, 1); !errors.Is(err, corewebhooks.ErrEndpointLimit) {
+		t.Fatalf("over limit err = %v", err)
+	}
+	if err := a.DeleteEndpoint(ctx, bob, endpoint.ID); !errors.Is(err, corewebhooks.ErrEndpointNotFound) {
+		t.Fatalf("delete by another user err = %v", err)
+	}
+	if err := a.DeleteEndpoint(ctx, alice, endpoint.ID); err != nil {
+		t.Fatalf("DeleteEndpoint error: %v", err)
+	}
+	if endpoints, err := a.ListEndpoints(ctx, alice); err != nil || len(endpoints) != 0 {
+		t.Fatalf("ListEndpoints = %+v, %v", endpoints, err)
+	}
+}
+
+func TestAdapter_DeliveryQueue(t *testing.T) {
+	a, alice, bob := newWebhooksAdapter(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	endpoint, err := a.CreateEndpoint(ctx, corewebhooks.Endpoint{UserID: alice, URL: "https://example.com/hook", Events: []corewebhooks.EventType{"invite.accepted"}, Secret: "s", CreatedAt: now}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery := corewebhooks.Delivery{
+		EndpointID: endpoint.ID, EventID: "evt_1", EventType: corewebhooks.EventInviteAccepted,
+		Payload: []byte(`{"id":"evt_1"}`), Status: corewebhooks.DeliveryPending, NextAttemptAt: now, CreatedAt: now,
+	}
+	if err := a.EnqueueDeliveries(ctx, []corewebhooks.Delivery{delivery, delivery}); err != nil {
+		t.Fatalf("EnqueueDeliveries error: %v", err)
+	}
+
+	claimed, err := a.ClaimDueDeliveries(ctx, now, now.Add(time.Minute), 10)
+	if err != nil || len(claimed) != 1 || string(claimed[0].Payload) != `{"id":"evt_1"}` {
+		t.Fatalf("ClaimDueDeliveries = %+v, %v (duplicate event ids must collapse)", claimed, err)
+	}
+	if again, err := a.ClaimDueDeliveries(ctx, now, now.Add(time.Minute), 10); err != nil || len(again) != 0 {
+		t.Fatalf("claimed delivery claimed twice: %+v, %v", again, err)
+	}
+	if expired, _ := a.ClaimDueDeliveries(ctx, now.Add(2*time.Minute), now.Add(3*time.Minute), 10); len(expired) != 1 {
+		t.Fatal("delivery with an expired lease was not reclaimed")
+	}
+
+	d := claimed[0]
+	attempted := now.Add(time.Second)
+	d.Status = corewebhooks.DeliveryDead
+	d.Attempts = 8
+	d.LastAttemptAt = &attempted
+	d.LastStatusCode = 502
+	d.LastError = "unexpected status 502"
+	if err := a.SaveDeliveryAttempt(ctx, d); err != nil {
+		t.Fatalf("SaveDeliveryAttempt error: %v", err)
+	}
+	saved, err := a.GetDelivery(ctx, d.ID)
+	if err != nil || saved.Status != corewebhooks.DeliveryDead || saved.Attempts != 8 || saved.LastAttemptAt == nil || saved.LastStatusCode != 502 {
+		t.Fatalf("GetDelivery = %+v, %v", saved, err)
+	}
+
+	if log, err := a.ListDeliveries(ctx, alice, 0, 10); err != nil || len(log) != 1 {
+		t.Fatalf("ListDeliveries = %+v, %v", log, err)
+	}
+	if log, err := a.ListDeliveries(ctx, bob, 0, 10); err != nil || len(log) != 0 {
+		t.Fatalf("another user's log = %+v, %v", log, err)
+	}
+	if err := a.DeleteEndpoint(ctx, alice, endpoint.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetDelivery(ctx, d.ID); !errors.Is(err, corewebhooks.ErrDeliveryNotFound) {
+		t.Fatalf("delivery after endpoint delete err = %v", err)
+	}
+}
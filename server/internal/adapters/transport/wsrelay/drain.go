@@ -0,0 +1,132 @@
+package wsrelay
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+// minReconnectDelay keeps clients from reconnecting before the old process
+// has released the listening socket.
+const minReconnectDelay = 500 * time.Millisecond
+
+// BeginDrain starts a graceful shutdown. Every connected client gets a
+// server_going_away frame with a reconnect delay spread over reconnectSpread,
+// so the next process is not hit by every client at once. New upgrades and
+// new relay sends are refused from now on; sockets stay open until Drain.
+func (h *Hub) BeginDrain(reconnectSpread time.Duration) {
+	h.drainMu.Lock()
+	if h.draining {
+		h.drainMu.Unlock()
+		return
+	}
+	h.draining = true
+	h.idle = make(chan struct{})
+	if h.inflight == 0 {
+		close(h.idle)
+	}
+	h.drainMu.Unlock()
+
+	for _, c := range h.snapshotClients() {
+		c.trySend(Message{
+			Type:         coremsg.KindServerGoingAway,
+			Body:         "server restarting",
+			RetryAfterMs: reconnectHint(reconnectSpread).Milliseconds(),
+		})
+	}
+}
+
+// Drain waits for relay sends already in progress, flushes every client's
+// queued frames, including receipts pushed by HTTP handlers, and closes each
+// socket with close code 1001. It calls BeginDrain first if needed. When ctx
+// ends first, the remaining sockets are closed abruptly.
+func (h *Hub) Drain(ctx context.Context, reconnectSpread time.Duration) error {
+	h.BeginDrain(reconnectSpread)
+	defer h.Shutdown()
+
+	h.drainMu.Lock()
+	idle := h.idle
+	h.drainMu.Unlock()
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	clients := h.snapshotClients()
+	for _, c := range clients {
+		c.finish()
+	}
+	for _, c := range clients {
+		if c.done == nil {
+			continue
+		}
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Draining reports whether BeginDrain has been called.
+func (h *Hub) Draining() bool {
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+	return h.draining
+}
+
+// beginSend registers a relay send so Drain can wait for it. It returns
+// false once the hub is draining.
+func (h *Hub) beginSend() bool {
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+	if h.draining {
+		return false
+	}
+	h.inflight++
+	return true
+}
+
+func (h *Hub) endSend() {
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+	h.inflight--
+	if h.draining && h.inflight == 0 {
+		close(h.idle)
+	}
+}
+
+func (h *Hub) snapshotClients() []*client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	clients := make([]*client, 0)
+	for _, userClients := range h.clients {
+		for c := range userClients {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+func reconnectHint(spread time.Duration) time.Duration {
+	if spread <= 0 {
+		return minReconnectDelay
+	}
+	return minReconnectDelay + rand.N(spread)
+}
+
+// finish closes the send queue but not the socket, so writeLoop writes what
+// is queued and then a close frame.
+func (c *client) finish() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.send)
+}
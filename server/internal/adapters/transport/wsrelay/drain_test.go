@@ -0,0 +1,125 @@
+package wsrelay
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+// blockingDeliveryService holds every send until release is closed.
+type blockingDeliveryService struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingDeliveryService) SendDirect(ctx context.Context, req coremsg.DirectSendRequest) (coremsg.DeliveryReceipt, error) {
+	close(s.started)
+	<-s.release
+	return coremsg.DeliveryReceipt{MessageID: req.MessageID, StoredMessageID: 77, Delivered: true}, nil
+}
+
+func TestHub_Drain_FinishesInFlightSendsAndFlushesQueues(t *testing.T) {
+	hub := NewHub()
+	delivery := &blockingDeliveryService{started: make(chan struct{}), release: make(chan struct{})}
+	hub.SetDeliveryService(delivery)
+	go hub.Run()
+	defer hub.Shutdown()
+
+	authenticator := ExampleAuthenticatorForTests("alice-token", 1, "alice")
+	resolve := ExampleResolveUserIDForTests(map[string]int{"alice": 1, "bob": 2})
+	s := mustStartWSServer(t, WebSocketHandler(hub, authenticator, resolve))
+	defer s.Close()
+
+	header := http.Header{}
+	header.Add("Authorization", "Bearer alice-token")
+	conn, _ := dialWS(t, s.URL, header)
+	defer conn.Close()
+	_ = readUntilType(t, conn, coremsg.KindPresenceState, 2*time.Second)
+
+	if err := conn.WriteJSON(Message{ID: 99, Type: coremsg.KindDirectMessage, To: "bob", Body: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	<-delivery.started
+
+	hub.BeginDrain(time.Second)
+	goingAway := readUntilType(t, conn, coremsg.KindServerGoingAway, 2*time.Second)
+	if goingAway.RetryAfterMs < minReconnectDelay.Milliseconds() || goingAway.RetryAfterMs >= 1500 {
+		t.Fatalf("reconnect hint = %dms, want within [500, 1500)", goingAway.RetryAfterMs)
+	}
+
+	u := "ws" + strings.TrimPrefix(s.URL, "http")
+	if _, resp, err := websocket.DefaultDialer.Dial(u, header); err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("upgrade during drain should be refused with 503, got %v", err)
+	}
+
+	// A receipt pushed by an HTTP handler after the drain began is still delivered.
+	if !hub.SendDirect(1, Message{Type: coremsg.KindMessageRead, ID: 5}) {
+		t.Fatal("receipt should be queued while draining")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	drained := make(chan error, 1)
+	go func() { drained <- hub.Drain(ctx, time.Second) }()
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain returned before the in-flight send finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(delivery.release)
+
+	if receipt := readUntilType(t, conn, coremsg.KindMessageRead, 2*time.Second); receipt.ID != 5 {
+		t.Fatalf("receipt = %+v", receipt)
+	}
+	if ack := readUntilType(t, conn, coremsg.KindMessageAck, 2*time.Second); ack.ID != 99 || ack.StoredMessageID != 77 {
+		t.Fatalf("ack = %+v", ack)
+	}
+	var msg Message
+	if err := conn.ReadJSON(&msg); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("expected close 1001 after the queue, got %+v, %v", msg, err)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+}
+
+func TestHub_Drain_RefusesRelaySendsAfterGoingAway(t *testing.T) {
+	hub := NewHub()
+	hub.SetDeliveryService(&stubDeliveryService{transport: hub, storedMessageID: 1})
+	go hub.Run()
+	defer hub.Shutdown()
+
+	authenticator := ExampleAuthenticatorForTests("alice-token", 1, "alice")
+	resolve := ExampleResolveUserIDForTests(map[string]int{"alice": 1})
+	s := mustStartWSServer(t, WebSocketHandler(hub, authenticator, resolve))
+	defer s.Close()
+
+	header := http.Header{}
+	header.Add("Authorization", "Bearer alice-token")
+	conn, _ := dialWS(t, s.URL, header)
+	defer conn.Close()
+	_ = readUntilType(t, conn, coremsg.KindPresenceState, 2*time.Second)
+
+	hub.BeginDrain(0)
+	if hint := readUntilType(t, conn, coremsg.KindServerGoingAway, 2*time.Second); hint.RetryAfterMs != minReconnectDelay.Milliseconds() {
+		t.Fatalf("reconnect hint without spread = %dms", hint.RetryAfterMs)
+	}
+	if err := conn.WriteJSON(Message{ID: 3, Type: coremsg.KindDirectMessage, To: "alice", Body: "late"}); err != nil {
+		t.Fatal(err)
+	}
+	refused := readUntilType(t, conn, coremsg.KindError, 2*time.Second)
+	if refused.ID != 3 || refused.Body != errServerDraining.Error() {
+		t.Fatalf("late send = %+v", refused)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hub.Drain(ctx, 0); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package wsrelay
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gorilla/websocket"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+// ProtoSubprotocol negotiates compact binary framing for relay messages. Clients
+// offer it alongside the existing bearer.<token> subprotocol; connections that do
+// not offer it keep the JSON text framing.
+const ProtoSubprotocol = "chat.v2.proto"
+
+const (
+	jsonFrameReadLimit  = 1024
+	protoFrameReadLimit = 64 * 1024
+)
+
+var errInvalidProtoFrame = errors.New("invalid proto frame")
+
+// frameCodec encodes relay messages onto a websocket connection.
+type frameCodec interface {
+	readLimit() int64
+	readMessage(conn *websocket.Conn) (Message, error)
+	writeMessage(conn *websocket.Conn, msg Message) error
+}
+
+func codecForSubprotocol(subprotocol string) frameCodec {
+	if subprotocol == ProtoSubprotocol {
+		return protoCodec{}
+	}
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) readLimit() int64 { return jsonFrameReadLimit }
+
+func (jsonCodec) readMessage(conn *websocket.Conn) (Message, error) {
+	var msg Message
+	err := conn.ReadJSON(&msg)
+	return msg, err
+}
+
+func (jsonCodec) writeMessage(conn *websocket.Conn, msg Message) error {
+	return conn.WriteJSON(msg)
+}
+
+// protoCodec writes binary frames using the protobuf wire format for
+// coremsg.Message. Text frames are still accepted and decoded as JSON so clients
+// can switch framing without reconnecting.
+type protoCodec struct{}
+
+func (protoCodec) readLimit() int64 { return protoFrameReadLimit }
+
+func (protoCodec) readMessage(conn *websocket.Conn) (Message, error) {
+	messageType, r, err := conn.NextReader()
+	if err != nil {
+		return Message{}, err
+	}
+	if messageType == websocket.TextMessage {
+		var msg Message
+		err := json.NewDecoder(r).Decode(&msg)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return msg, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Message{}, err
+	}
+	return UnmarshalProtoMessage(data)
+}
+
+func (protoCodec) writeMessage(conn *websocket.Conn, msg Message) error {
+	return conn.WriteMessage(websocket.BinaryMessage, MarshalProtoMessage(msg))
+}
+
+// Field numbers for the chat.v2.proto Message schema:
+//
+//	message Message {
+//	  int64 id = 1;
+//	  string type = 2;
+//	  string from = 3;
+//	  string to = 4;
+//	  string body = 5;
+//	  string content_kind = 6;
+//	  bytes ciphertext = 7;
+//	  string envelope_version = 8;
+//	  int64 sender_device_id = 9;
+//	  int64 recipient_device_id = 10;
+//	  repeated string users = 11;
+//	  int64 stored_message_id = 12;
+//	  int64 retry_after_ms = 13;
+//	  repeated int64 attachment_ids = 14;
+//	}
+const (
+	protoFieldID                = 1
+	protoFieldType              = 2
+	protoFieldFrom              = 3
+	protoFieldTo                = 4
+	protoFieldBody              = 5
+	protoFieldContentKind       = 6
+	protoFieldCiphertext        = 7
+	protoFieldEnvelopeVersion   = 8
+	protoFieldSenderDeviceID    = 9
+	protoFieldRecipientDeviceID = 10
+	protoFieldUsers             = 11
+	protoFieldStoredMessageID   = 12
+	protoFieldRetryAfterMs      = 13
+	protoFieldAttachmentIDs     = 14
+)
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+// MarshalProtoMessage encodes msg using the chat.v2.proto binary schema. Zero
+// values are omitted, matching the omitempty behavior of the JSON framing.
+func MarshalProtoMessage(msg Message) []byte {
+	buf := make([]byte, 0, 64+len(msg.Body)+len(msg.Ciphertext))
+	buf = appendProtoVarintField(buf, protoFieldID, msg.ID)
+	buf = appendProtoStringField(buf, protoFieldType, string(msg.Type))
+	buf = appendProtoStringField(buf, protoFieldFrom, msg.From)
+	buf = appendProtoStringField(buf, protoFieldTo, msg.To)
+	buf = appendProtoStringField(buf, protoFieldBody, msg.Body)
+	buf = appendProtoStringField(buf, protoFieldContentKind, msg.ContentKind)
+	buf = appendProtoStringField(buf, protoFieldCiphertext, msg.Ciphertext)
+	buf = appendProtoStringField(buf, protoFieldEnvelopeVersion, msg.EnvelopeVersion)
+	buf = appendProtoVarintField(buf, protoFieldSenderDeviceID, msg.SenderDeviceID)
+	buf = appendProtoVarintField(buf, protoFieldRecipientDeviceID, msg.RecipientDeviceID)
+	for _, user := range msg.Users {
+		buf = appendProtoTag(buf, protoFieldUsers, protoWireBytes)
+		buf = binary.AppendUvarint(buf, uint64(len(user)))
+		buf = append(buf, user...)
+	}
+	buf = appendProtoVarintField(buf, protoFieldStoredMessageID, msg.StoredMessageID)
+	buf = appendProtoVarintField(buf, protoFieldRetryAfterMs, msg.RetryAfterMs)
+	if len(msg.AttachmentIDs) > 0 {
+		var packed []byte
+		for _, id := range msg.AttachmentIDs {
+			packed = binary.AppendUvarint(packed, uint64(id))
+		}
+		buf = appendProtoStringField(buf, protoFieldAttachmentIDs, string(packed))
+	}
+	return buf
+}
+
+// UnmarshalProtoMessage decodes a chat.v2.proto binary frame. Unknown fields are
+// skipped so newer clients can add fields without breaking older servers.
+func UnmarshalProtoMessage(data []byte) (Message, error) {
+	var msg Message
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return Message{}, errInvalidProtoFrame
+		}
+		data = data[n:]
+		field := key >> 3
+		wireType := key & 0x7
+
+		switch wireType {
+		case protoWireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return Message{}, errInvalidProtoFrame
+			}
+			data = data[n:]
+			switch field {
+			case protoFieldID:
+				msg.ID = int64(v)
+			case protoFieldSenderDeviceID:
+				msg.SenderDeviceID = int64(v)
+			case protoFieldRecipientDeviceID:
+				msg.RecipientDeviceID = int64(v)
+			case protoFieldStoredMessageID:
+				msg.StoredMessageID = int64(v)
+			case protoFieldRetryAfterMs:
+				msg.RetryAfterMs = int64(v)
+			case protoFieldAttachmentIDs:
+				msg.AttachmentIDs = append(msg.AttachmentIDs, int64(v))
+			}
+		case protoWireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return Message{}, errInvalidProtoFrame
+			}
+			value := string(data[n : n+int(length)])
+			data = data[n+int(length):]
+			switch field {
+			case protoFieldType:
+				msg.Type = coremsg.MessageKind(value)
+			case protoFieldFrom:
+				msg.From = value
+			case protoFieldTo:
+				msg.To = value
+			case protoFieldBody:
+				msg.Body = value
+			case protoFieldContentKind:
+				msg.ContentKind = value
+			case protoFieldCiphertext:
+				msg.Ciphertext = value
+			case protoFieldEnvelopeVersion:
+				msg.EnvelopeVersion = value
+			case protoFieldUsers:
+				msg.Users = append(msg.Users, value)
+			case protoFieldAttachmentIDs:
+				ids, err := unpackProtoVarints(value)
+				if err != nil {
+					return Message{}, err
+				}
+				msg.AttachmentIDs = append(msg.AttachmentIDs, ids...)
+			}
+		case protoWireFixed64:
+			if len(data) < 8 {
+				return Message{}, errInvalidProtoFrame
+			}
+			data = data[8:]
+		case protoWireFixed32:
+			if len(data) < 4 {
+				return Message{}, errInvalidProtoFrame
+			}
+			data = data[4:]
+		default:
+			return Message{}, fmt.Errorf("%w: unsupported wire type %d", errInvalidProtoFrame, wireType)
+		}
+	}
+	return msg, nil
+}
+
+// unpackProtoVarints decodes a packed repeated varint field.
+func unpackProtoVarints(packed string) ([]int64, error) {
+	data := []byte(packed)
+	var out []int64
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errInvalidProtoFrame
+		}
+		out = append(out, int64(v))
+		data = data[n:]
+	}
+	return out, nil
+}
+
+func appendProtoTag(buf []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(buf, uint64(field)<<3|uint64(wireType))
+}
+
+func appendProtoVarintField(buf []byte, field int, v int64) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = appendProtoTag(buf, field, protoWireVarint)
+	return binary.AppendUvarint(buf, uint64(v))
+}
+
+func appendProtoStringField(buf []byte, field int, v string) []byte {
+	if v == "" {
+		return buf
+	}
+	buf = appendProtoTag(buf, field, protoWireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
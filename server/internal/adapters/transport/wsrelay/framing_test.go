@@ -0,0 +1,235 @@
+package wsrelay
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+func dialProtoWS(t *testing.T, serverURL string, token string) *websocket.Conn {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(serverURL, "http")
+	dialer := websocket.Dialer{Subprotocols: []string{ProtoSubprotocol, "bearer." + token}}
+	conn, _, err := dialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("proto websocket dial failed: %v", err)
+	}
+	if got := conn.Subprotocol(); got != ProtoSubprotocol {
+		t.Fatalf("negotiated subprotocol = %q, want %q", got, ProtoSubprotocol)
+	}
+	return conn
+}
+
+func readProtoUntilType(t *testing.T, conn *websocket.Conn, want coremsg.MessageKind, timeout time.Duration) Message {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			t.Fatalf("set read deadline: %v", err)
+		}
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read proto frame while waiting for %q: %v", want, err)
+		}
+		if messageType != websocket.BinaryMessage {
+			t.Fatalf("frame type = %d, want binary", messageType)
+		}
+		msg, err := UnmarshalProtoMessage(data)
+		if err != nil {
+			t.Fatalf("unmarshal proto frame: %v", err)
+		}
+		if msg.Type == want {
+			return msg
+		}
+	}
+}
+
+func TestProtoMessage_RoundTrip(t *testing.T) {
+	msg := Message{
+		ID:                -1,
+		Type:              coremsg.KindDirectMessage,
+		From:              "alice",
+		To:                "bob",
+		Body:              "hello",
+		ContentKind:       "text",
+		Ciphertext:        strings.Repeat("QUJD", 512),
+		EnvelopeVersion:   "x3dh-dr-v1",
+		SenderDeviceID:    7,
+		RecipientDeviceID: 9,
+		Users:             []string{"alice", "bob"},
+		StoredMessageID:   501,
+		RetryAfterMs:      250,
+		AttachmentIDs:     []int64{3, 300, 70000},
+	}
+
+	got, err := UnmarshalProtoMessage(MarshalProtoMessage(msg))
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Fatalf("round trip = %+v, want %+v", got, msg)
+	}
+}
+
+func TestUnmarshalProtoMessage_SkipsUnknownFields(t *testing.T) {
+	frame := MarshalProtoMessage(Message{Type: coremsg.KindMessageAck, ID: 5})
+	frame = appendProtoVarintField(frame, 99, 42)
+	frame = appendProtoStringField(frame, 100, "future")
+	frame = appendProtoTag(frame, 101, protoWireFixed32)
+	frame = append(frame, 1, 2, 3, 4)
+
+	got, err := UnmarshalProtoMessage(frame)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.Type != coremsg.KindMessageAck || got.ID != 5 {
+		t.Fatalf("decoded = %+v, want ack with id 5", got)
+	}
+}
+
+func TestUnmarshalProtoMessage_AcceptsUnpackedAttachmentIDs(t *testing.T) {
+	frame := MarshalProtoMessage(Message{Type: coremsg.KindDirectMessage, ContentKind: coremsg.ContentKindAttachment})
+	frame = appendProtoVarintField(frame, protoFieldAttachmentIDs, 11)
+	frame = appendProtoVarintField(frame, protoFieldAttachmentIDs, 12)
+
+	got, err := UnmarshalProtoMessage(frame)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got.AttachmentIDs, []int64{11, 12}) {
+		t.Fatalf("attachment ids = %v, want [11 12]", got.AttachmentIDs)
+	}
+}
+
+func TestUnmarshalProtoMessage_RejectsTruncatedFrame(t *testing.T) {
+	frame := MarshalProtoMessage(Message{Type: coremsg.KindDirectMessage, Body: "hello"})
+
+	if _, err := UnmarshalProtoMessage(frame[:len(frame)-2]); !errors.Is(err, errInvalidProtoFrame) {
+		t.Fatalf("err = %v, want errInvalidProtoFrame", err)
+	}
+}
+
+func TestWebSocketHandler_ProtoSubprotocolRelaysLargeCiphertextToJSONClient(t *testing.T) {
+	hub := NewHub()
+	hub.SetDeliveryService(&stubDeliveryService{transport: hub, storedMessageID: 601})
+	go hub.Run()
+	defer hub.Shutdown()
+
+	authenticator := func(token string) (int, string, int64, error) {
+		switch token {
+		case "alice-token":
+			return 1, "alice", 101, nil
+		case "bob-token":
+			return 2, "bob", 202, nil
+		default:
+			return 0, "", 0, errors.New("invalid token")
+		}
+	}
+	resolve := ExampleResolveUserIDForTests(map[string]int{"alice": 1, "bob": 2})
+
+	s := mustStartWSServer(t, WebSocketHandler(hub, authenticator, resolve))
+	defer s.Close()
+
+	aliceConn := dialProtoWS(t, s.URL, "alice-token")
+	defer aliceConn.Close()
+	_ = readProtoUntilType(t, aliceConn, coremsg.KindPresenceState, 2*time.Second)
+
+	bobHeader := http.Header{}
+	bobHeader.Add("Authorization", "Bearer bob-token")
+	bobConn, _ := dialWS(t, s.URL, bobHeader)
+	defer bobConn.Close()
+	if got := bobConn.Subprotocol(); got != "" {
+		t.Fatalf("json client subprotocol = %q, want none", got)
+	}
+	_ = readProtoUntilType(t, aliceConn, coremsg.KindUserOnline, 2*time.Second)
+
+	ciphertext := strings.Repeat("Y2lwaGVydGV4dA", 400)
+	frame := MarshalProtoMessage(Message{
+		ID:              77,
+		Type:            coremsg.KindDirectMessage,
+		To:              "bob",
+		ContentKind:     "text",
+		Ciphertext:      ciphertext,
+		EnvelopeVersion: "x3dh-dr-v1",
+	})
+	if err := aliceConn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		t.Fatalf("alice write proto frame: %v", err)
+	}
+
+	delivered := readUntilType(t, bobConn, coremsg.KindDirectMessage, 2*time.Second)
+	if delivered.Ciphertext != ciphertext {
+		t.Fatalf("delivered ciphertext length = %d, want %d", len(delivered.Ciphertext), len(ciphertext))
+	}
+	if delivered.From != "alice" || delivered.ID != 601 {
+		t.Fatalf("delivered = from %q id %d, want alice/601", delivered.From, delivered.ID)
+	}
+
+	ack := readProtoUntilType(t, aliceConn, coremsg.KindMessageAck, 2*time.Second)
+	if ack.ID != 77 || ack.StoredMessageID != 601 {
+		t.Fatalf("ack = %+v, want id 77 stored 601", ack)
+	}
+}
+
+func TestWebSocketHandler_ProtoSubprotocolAcceptsJSONTextFrames(t *testing.T) {
+	hub := NewHub()
+	hub.SetDeliveryService(&stubDeliveryService{transport: hub, storedMessageID: 602})
+	go hub.Run()
+	defer hub.Shutdown()
+
+	authenticator := ExampleAuthenticatorForTests("alice-token", 1, "alice")
+	resolve := ExampleResolveUserIDForTests(map[string]int{"alice": 1})
+
+	s := mustStartWSServer(t, WebSocketHandler(hub, authenticator, resolve))
+	defer s.Close()
+
+	conn := dialProtoWS(t, s.URL, "alice-token")
+	defer conn.Close()
+	_ = readProtoUntilType(t, conn, coremsg.KindPresenceState, 2*time.Second)
+
+	if err := conn.WriteJSON(Message{ID: 3, Type: coremsg.KindDirectMessage, To: "alice", Body: "note to self"}); err != nil {
+		t.Fatalf("write json text frame: %v", err)
+	}
+
+	delivered := readProtoUntilType(t, conn, coremsg.KindDirectMessage, 2*time.Second)
+	if delivered.Body != "note to self" {
+		t.Fatalf("delivered body = %q, want note to self", delivered.Body)
+	}
+}
+
+func TestWebSocketHandler_JSONFramingKeepsReadLimit(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown()
+
+	authenticator := ExampleAuthenticatorForTests("alice-token", 1, "alice")
+	resolve := ExampleResolveUserIDForTests(map[string]int{"alice": 1})
+
+	s := mustStartWSServer(t, WebSocketHandler(hub, authenticator, resolve))
+	defer s.Close()
+
+	header := http.Header{}
+	header.Add("Authorization", "Bearer alice-token")
+	conn, _ := dialWS(t, s.URL, header)
+	defer conn.Close()
+	_ = readUntilType(t, conn, coremsg.KindPresenceState, 2*time.Second)
+
+	oversized := Message{Type: coremsg.KindDirectMessage, To: "alice", Ciphertext: strings.Repeat("A", jsonFrameReadLimit)}
+	if err := conn.WriteJSON(oversized); err != nil {
+		t.Fatalf("write oversized json: %v", err)
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatalf("set read deadline: %v", err)
+	}
+	var msg Message
+	err := conn.ReadJSON(&msg)
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("read err = %v, want close 1009 (message too big)", err)
+	}
+}
@@ -0,0 +1,192 @@
+package wsrelay
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/config"
+)
+
+const (
+	defaultViolationWindow = time.Minute
+	// userBucketSweepInterval spaces out the scans that drop the buckets of
+	// disconnected users once they have refilled.
+	userBucketSweepInterval = time.Minute
+)
+
+// RateLimits bounds inbound frame traffic after the websocket upgrade. Handshakes
+// are limited separately by the HTTP adapter.
+type RateLimits struct {
+	ConnectionPerMinute int
+	ConnectionBurst     int
+	UserPerMinute       int
+	UserBurst           int
+	// MaxViolations is the number of rejected frames tolerated within
+	// ViolationWindow before the connection is closed with a policy violation.
+	MaxViolations   int
+	ViolationWindow time.Duration
+}
+
+func RateLimitsFromConfig() RateLimits {
+	return RateLimits{
+		ConnectionPerMinute: config.WSMessageRateLimitPerMinute(),
+		ConnectionBurst:     config.WSMessageBurst(),
+		UserPerMinute:       config.WSUserMessageRateLimitPerMinute(),
+		UserBurst:           config.WSUserMessageBurst(),
+		MaxViolations:       config.WSRateLimitMaxViolations(),
+		ViolationWindow:     defaultViolationWindow,
+	}
+}
+
+// tokenBucket is a small refill-on-read token bucket. A nil bucket allows everything.
+type tokenBucket struct {
+	mu            sync.Mutex
+	ratePerSecond float64
+	burst         float64
+	tokens        float64
+	last          time.Time
+}
+
+func newTokenBucket(perMinute int, burst int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		ratePerSecond: float64(perMinute) / 60,
+		burst:         float64(burst),
+		tokens:        float64(burst),
+		last:          now,
+	}
+}
+
+// take consumes one token, or reports how long until one becomes available.
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.ratePerSecond)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / b.ratePerSecond
+	return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
+
+// refund returns a token taken for a frame that another bucket then rejected.
+func (b *tokenBucket) refund() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// full reports whether the bucket has refilled to its burst by now, at which
+// point dropping it and starting a fresh one later changes nothing.
+func (b *tokenBucket) full(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*b.ratePerSecond >= b.burst
+}
+
+func (h *Hub) SetRateLimits(limits RateLimits) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.limits = limits
+	h.userBuckets = make(map[int]*tokenBucket)
+}
+
+func (h *Hub) rateLimits() RateLimits {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.limits
+}
+
+func (h *Hub) userBucket(userID int, now time.Time) *tokenBucket {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if b, ok := h.userBuckets[userID]; ok {
+		return b
+	}
+	b := newTokenBucket(h.limits.UserPerMinute, h.limits.UserBurst, now)
+	h.userBuckets[userID] = b
+	return b
+}
+
+// sweepUserBucketsLocked drops the buckets of users with no connection once
+// they have refilled. A bucket is kept across a disconnect until then, so
+// reconnecting cannot reset a user's limit. The caller holds h.mu.
+func (h *Hub) sweepUserBucketsLocked(now time.Time) {
+	if now.Sub(h.lastBucketSweep) < userBucketSweepInterval {
+		return
+	}
+	h.lastBucketSweep = now
+	for userID, b := range h.userBuckets {
+		if len(h.clients[userID]) == 0 && b.full(now) {
+			delete(h.userBuckets, userID)
+		}
+	}
+}
+
+// allowInbound applies the per-connection and per-user buckets to one inbound
+// frame. A frame the user bucket rejects gives its connection token back, so
+// a user over their limit does not also drain each connection's budget.
+func (c *client) allowInbound(now time.Time) (bool, time.Duration) {
+	if c.limiter == nil {
+		limits := c.hub.rateLimits()
+		c.limiter = &connLimiter{
+			bucket: newTokenBucket(limits.ConnectionPerMinute, limits.ConnectionBurst, now),
+			limits: limits,
+		}
+	}
+	if ok, retryAfter := c.limiter.bucket.take(now); !ok {
+		return false, retryAfter
+	}
+	ok, retryAfter := c.hub.userBucket(c.userID, now).take(now)
+	if !ok {
+		c.limiter.bucket.refund()
+	}
+	return ok, retryAfter
+}
+
+// recordViolation returns true once the connection has exceeded its tolerated
+// number of rejected frames within the violation window.
+func (c *client) recordViolation(now time.Time) bool {
+	l := c.limiter
+	if l == nil || l.limits.MaxViolations <= 0 {
+		return false
+	}
+	window := l.limits.ViolationWindow
+	if window <= 0 {
+		window = defaultViolationWindow
+	}
+	if l.windowStart.IsZero() || now.Sub(l.windowStart) > window {
+		l.windowStart = now
+		l.violations = 0
+	}
+	l.violations++
+	return l.violations > l.limits.MaxViolations
+}
+
+// connLimiter is owned by a client's read loop and is not safe for concurrent use.
+type connLimiter struct {
+	bucket      *tokenBucket
+	limits      RateLimits
+	violations  int
+	windowStart time.Time
+}
@@ -0,0 +1,212 @@
+package wsrelay
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+func TestTokenBucket_RefillsAtConfiguredRate(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	b := newTokenBucket(60, 2, start)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.take(start); !ok {
+			t.Fatalf("take %d within burst should succeed", i+1)
+		}
+	}
+	ok, retryAfter := b.take(start)
+	if ok {
+		t.Fatal("expected take beyond burst to fail")
+	}
+	if retryAfter != time.Second {
+		t.Fatalf("retryAfter = %s, want 1s", retryAfter)
+	}
+
+	if ok, _ := b.take(start.Add(500 * time.Millisecond)); ok {
+		t.Fatal("expected half-refilled bucket to reject")
+	}
+	if ok, _ := b.take(start.Add(time.Second)); !ok {
+		t.Fatal("expected refilled token to be available after 1s")
+	}
+}
+
+func TestTokenBucket_DisabledWhenRateIsZero(t *testing.T) {
+	b := newTokenBucket(0, 5, time.Now())
+	if b != nil {
+		t.Fatal("expected nil bucket for disabled limit")
+	}
+	if ok, _ := b.take(time.Now()); !ok {
+		t.Fatal("nil bucket should allow")
+	}
+}
+
+func TestClientRecordViolation_DisconnectsAfterThresholdWithinWindow(t *testing.T) {
+	h := NewHub()
+	defer h.Shutdown()
+	h.SetRateLimits(RateLimits{ConnectionPerMinute: 1, ConnectionBurst: 1, MaxViolations: 2, ViolationWindow: time.Minute})
+	c := &client{userID: 1, hub: h}
+
+	now := time.Unix(1_700_000_000, 0)
+	_, _ = c.allowInbound(now)
+	if c.recordViolation(now) || c.recordViolation(now) {
+		t.Fatal("violations within threshold should not disconnect")
+	}
+	if !c.recordViolation(now) {
+		t.Fatal("expected disconnect once threshold is exceeded")
+	}
+
+	later := now.Add(2 * time.Minute)
+	if c.recordViolation(later) {
+		t.Fatal("expected violation window to reset")
+	}
+}
+
+func TestWebSocketHandler_InboundFloodReturnsRetryHintThenCloses(t *testing.T) {
+	hub := NewHub()
+	hub.SetRateLimits(RateLimits{ConnectionPerMinute: 1, ConnectionBurst: 2, MaxViolations: 1, ViolationWindow: time.Minute})
+	go hub.Run()
+	defer hub.Shutdown()
+
+	authenticator := ExampleAuthenticatorForTests("alice-token", 1, "alice")
+	resolve := ExampleResolveUserIDForTests(map[string]int{"alice": 1})
+
+	s := mustStartWSServer(t, WebSocketHandler(hub, authenticator, resolve))
+	defer s.Close()
+
+	header := http.Header{}
+	header.Add("Authorization", "Bearer alice-token")
+	conn, _ := dialWS(t, s.URL, header)
+	defer conn.Close()
+	results := startAsyncReader(conn)
+	_ = readUntilTypeFromChannel(t, results, coremsg.KindPresenceState, 2*time.Second)
+
+	for i := int64(1); i <= 3; i++ {
+		if err := conn.WriteJSON(Message{ID: i, Type: coremsg.KindDirectMessage, To: "alice", Body: "spam"}); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+
+	limited := readUntilTypeFromChannel(t, results, coremsg.KindError, 2*time.Second)
+	if limited.ID != 3 || limited.Body != "rate limit exceeded" {
+		t.Fatalf("error frame = %+v, want rate limit error for id 3", limited)
+	}
+	if limited.RetryAfterMs <= 0 {
+		t.Fatalf("retry_after_ms = %d, want positive hint", limited.RetryAfterMs)
+	}
+
+	if err := conn.WriteJSON(Message{ID: 4, Type: coremsg.KindDirectMessage, To: "alice", Body: "spam"}); err != nil {
+		t.Fatalf("write 4: %v", err)
+	}
+
+	timer := time.NewTimer(2 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				t.Fatal("reader closed without close error")
+			}
+			if result.err == nil {
+				continue
+			}
+			if !websocket.IsCloseError(result.err, websocket.ClosePolicyViolation) {
+				t.Fatalf("close err = %v, want policy violation", result.err)
+			}
+			return
+		case <-timer.C:
+			t.Fatal("timed out waiting for policy-violation close")
+		}
+	}
+}
+
+func TestWebSocketHandler_UserLimitIsSharedAcrossSessions(t *testing.T) {
+	hub := NewHub()
+	hub.SetRateLimits(RateLimits{UserPerMinute: 1, UserBurst: 1})
+	go hub.Run()
+	defer hub.Shutdown()
+
+	authenticator := ExampleAuthenticatorForTests("alice-token", 1, "alice")
+	resolve := ExampleResolveUserIDForTests(map[string]int{"alice": 1})
+
+	s := mustStartWSServer(t, WebSocketHandler(hub, authenticator, resolve))
+	defer s.Close()
+
+	header := http.Header{}
+	header.Add("Authorization", "Bearer alice-token")
+	first, _ := dialWS(t, s.URL, header)
+	defer first.Close()
+	second, _ := dialWS(t, s.URL, header)
+	defer second.Close()
+	_ = readUntilType(t, first, coremsg.KindPresenceState, 2*time.Second)
+	_ = readUntilType(t, second, coremsg.KindPresenceState, 2*time.Second)
+
+	if err := first.WriteJSON(Message{ID: 1, Type: coremsg.KindDirectMessage, To: "alice", Body: "one"}); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+	_ = readUntilType(t, first, coremsg.KindMessageAck, 2*time.Second)
+
+	if err := second.WriteJSON(Message{ID: 2, Type: coremsg.KindDirectMessage, To: "alice", Body: "two"}); err != nil {
+		t.Fatalf("second write: %v", err)
+	}
+	limited := readUntilType(t, second, coremsg.KindError, 2*time.Second)
+	if limited.ID != 2 || limited.Body != "rate limit exceeded" {
+		t.Fatalf("error frame = %+v, want shared user limit error", limited)
+	}
+}
+
+func TestClientAllowInbound_UserDenialKeepsConnectionToken(t *testing.T) {
+	h := NewHub()
+	defer h.Shutdown()
+	h.SetRateLimits(RateLimits{ConnectionPerMinute: 60, ConnectionBurst: 2, UserPerMinute: 60, UserBurst: 1})
+	c := &client{userID: 1, hub: h}
+
+	now := time.Unix(1_700_000_000, 0)
+	if ok, _ := c.allowInbound(now); !ok {
+		t.Fatal("first frame should pass both buckets")
+	}
+	if ok, _ := c.allowInbound(now); ok {
+		t.Fatal("second frame should exceed the user bucket")
+	}
+	// The connection bucket still holds the token the user bucket refused.
+	if ok, _ := c.limiter.bucket.take(now); !ok {
+		t.Fatal("a frame rejected by the user bucket must not spend the connection token")
+	}
+}
+
+func TestHub_UserBucketOutlivesDisconnectUntilRefilled(t *testing.T) {
+	h := NewHub()
+	defer h.Shutdown()
+	h.SetRateLimits(RateLimits{UserPerMinute: 1, UserBurst: 1})
+
+	start := time.Unix(1_700_000_000, 0)
+	gone := h.userBucket(1, start)
+	if ok, _ := gone.take(start); !ok {
+		t.Fatal("first frame should pass")
+	}
+	online := h.userBucket(2, start)
+	h.clients[2] = map[*client]struct{}{{userID: 2, hub: h, send: make(chan Message, 1)}: {}}
+
+	h.mu.Lock()
+	h.sweepUserBucketsLocked(start.Add(30 * time.Second))
+	h.mu.Unlock()
+	if h.userBucket(1, start.Add(30*time.Second)) != gone {
+		t.Fatal("a disconnected user's bucket must survive until it refills")
+	}
+	if ok, _ := gone.take(start.Add(30 * time.Second)); ok {
+		t.Fatal("reconnecting must not reset the user's limit")
+	}
+
+	h.mu.Lock()
+	h.sweepUserBucketsLocked(start.Add(2 * time.Minute))
+	h.mu.Unlock()
+	if _, ok := h.userBuckets[1]; ok {
+		t.Fatal("a refilled bucket of a disconnected user should be swept")
+	}
+	if h.userBucket(2, start.Add(2*time.Minute)) != online {
+		t.Fatal("a connected user's bucket must be kept")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
 	"github.com/kyambuthia/go-chat-site/server/internal/config"
 	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
 )
@@ -20,17 +21,23 @@ type Authenticator func(token string) (userID int, username string, sessionID in
 
 type Message = coremsg.Message
 
+var errServerDraining = errors.New("server is restarting")
+
 type client struct {
 	userID          int
 	username        string
 	sessionID       int64
 	conn            *websocket.Conn
+	codec           frameCodec
 	send            chan Message
 	sendMu          sync.RWMutex
 	closed          bool
 	hub             *Hub
+	limiter         *connLimiter
 	messaging       coremsg.Service
 	resolveToUserID func(string) (int, error)
+	// done is closed when writeLoop returns.
+	done chan struct{}
 }
 
 type Hub struct {
@@ -39,14 +46,24 @@ type Hub struct {
 	ctx             context.Context
 	cancel          context.CancelFunc
 	deliveryService coremsg.Service
+	limits          RateLimits
+	userBuckets     map[int]*tokenBucket
+	lastBucketSweep time.Time
+
+	drainMu  sync.Mutex
+	draining bool
+	inflight int
+	idle     chan struct{}
 }
 
 func NewHub() *Hub {
 	ctx, cancel := context.WithCancel(context.Background())
 	h := &Hub{
-		clients: make(map[int]map[*client]struct{}),
-		ctx:     ctx,
-		cancel:  cancel,
+		clients:     make(map[int]map[*client]struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		limits:      RateLimitsFromConfig(),
+		userBuckets: make(map[int]*tokenBucket),
 	}
 	h.deliveryService = coremsg.NewRelayService(h)
 	return h
@@ -93,6 +110,9 @@ func (h *Hub) AddClient(c *client) error {
 	if c == nil {
 		return errors.New("nil client")
 	}
+	if h.Draining() {
+		return errServerDraining
+	}
 
 	h.mu.Lock()
 	userClients, ok := h.clients[c.userID]
@@ -131,13 +151,15 @@ func (h *Hub) RemoveClient(c *client) {
 	if isLastSession {
 		delete(h.clients, c.userID)
 	}
+	h.sweepUserBucketsLocked(time.Now())
 	h.mu.Unlock()
 
 	if !removed {
 		return
 	}
 	c.close()
-	if isLastSession {
+	// During a drain every client is leaving; telling the others is noise.
+	if isLastSession && !h.Draining() {
 		go h.broadcastExcept(c.userID, Message{Type: coremsg.KindUserOffline, From: c.username})
 	}
 }
@@ -163,6 +185,21 @@ func (h *Hub) DisconnectSession(sessionID int64) {
 	}
 }
 
+// DisconnectUser closes every connection of userID. Bot connections carry no
+// session, so revoking a bot's API token closes them this way.
+func (h *Hub) DisconnectUser(userID int) {
+	h.mu.RLock()
+	matches := make([]*client, 0, len(h.clients[userID]))
+	for c := range h.clients[userID] {
+		matches = append(matches, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range matches {
+		h.RemoveClient(c)
+	}
+}
+
 func (h *Hub) SendDirect(toUserID int, msg Message) bool {
 	h.mu.RLock()
 	userClients, ok := h.clients[toUserID]
@@ -222,7 +259,8 @@ func (h *Hub) onlineUsernamesExceptLocked(excludedUserID int) []string {
 func (c *client) readLoop() {
 	defer c.hub.RemoveClient(c)
 
-	c.conn.SetReadLimit(1024)
+	codec := c.frameCodec()
+	c.conn.SetReadLimit(codec.readLimit())
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -230,11 +268,35 @@ func (c *client) readLoop() {
 	})
 
 	for {
-		var msg Message
-		if err := c.conn.ReadJSON(&msg); err != nil {
+		msg, err := codec.readMessage(c.conn)
+		if err != nil {
 			return
 		}
 
+		now := time.Now()
+		if ok, retryAfter := c.allowInbound(now); !ok {
+			if c.recordViolation(now) {
+				auth.LogSecurityEvent("ws_rate_limit_disconnect", map[string]any{
+					"user_id":    c.userID,
+					"session_id": c.sessionID,
+				})
+				_ = c.conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"),
+					time.Now().Add(time.Second),
+				)
+				return
+			}
+			c.trySend(Message{
+				Type:         coremsg.KindError,
+				ID:           msg.ID,
+				To:           msg.To,
+				Body:         "rate limit exceeded",
+				RetryAfterMs: retryAfter.Milliseconds(),
+			})
+			continue
+		}
+
 		if msg.Type != coremsg.KindDirectMessage {
 			continue
 		}
@@ -252,6 +314,10 @@ func (c *client) readLoop() {
 			c.trySend(Message{Type: coremsg.KindError, ID: msg.ID, To: msg.To, Body: "relay unavailable"})
 			continue
 		}
+		if !c.hub.beginSend() {
+			c.trySend(Message{Type: coremsg.KindError, ID: msg.ID, To: msg.To, Body: errServerDraining.Error()})
+			continue
+		}
 
 		receipt, err := c.messaging.SendDirect(c.hub.ctx, coremsg.DirectSendRequest{
 			FromUserID:        c.userID,
@@ -263,8 +329,18 @@ func (c *client) readLoop() {
 			EnvelopeVersion:   msg.EnvelopeVersion,
 			SenderDeviceID:    msg.SenderDeviceID,
 			RecipientDeviceID: msg.RecipientDeviceID,
+			AttachmentIDs:     msg.AttachmentIDs,
 			MessageID:         msg.ID,
 		})
+		c.hub.endSend()
+		if errors.Is(err, coremsg.ErrInvalidAttachment) {
+			c.trySend(Message{Type: coremsg.KindError, ID: msg.ID, To: msg.To, Body: "invalid attachment"})
+			continue
+		}
+		if errors.Is(err, coremsg.ErrReservedKind) {
+			c.trySend(Message{Type: coremsg.KindError, ID: msg.ID, To: msg.To, Body: "invalid content kind"})
+			continue
+		}
 		if err != nil {
 			c.trySend(Message{Type: coremsg.KindError, ID: msg.ID, To: msg.To, Body: "delivery failed"})
 			continue
@@ -288,11 +364,22 @@ func (c *client) trySend(msg Message) {
 	_ = c.sendWithTimeout(msg, 0)
 }
 
+func (c *client) frameCodec() frameCodec {
+	if c.codec == nil {
+		return jsonCodec{}
+	}
+	return c.codec
+}
+
 func (c *client) writeLoop() {
+	codec := c.frameCodec()
 	ticker := time.NewTicker(30 * time.Second)
 	defer func() {
 		ticker.Stop()
 		_ = c.conn.Close()
+		if c.done != nil {
+			close(c.done)
+		}
 	}()
 
 	for {
@@ -300,10 +387,14 @@ func (c *client) writeLoop() {
 		case msg, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeFrame := []byte{}
+				if c.hub.Draining() {
+					closeFrame = websocket.FormatCloseMessage(websocket.CloseGoingAway, errServerDraining.Error())
+				}
+				_ = c.conn.WriteMessage(websocket.CloseMessage, closeFrame)
 				return
 			}
-			if err := c.conn.WriteJSON(msg); err != nil {
+			if err := codec.writeMessage(c.conn, msg); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -368,6 +459,8 @@ func newUpgrader(checkOrigin func(*http.Request) bool) websocket.Upgrader {
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 		CheckOrigin:     checkOrigin,
+		// Only framing subprotocols are echoed back; bearer.<token> is never selected.
+		Subprotocols: []string{ProtoSubprotocol},
 	}
 }
 
@@ -391,6 +484,11 @@ func WebSocketHandler(h *Hub, authenticator Authenticator, resolveToUserID func(
 			}
 		}
 
+		if h.Draining() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, errServerDraining.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		if token == "" {
 			http.Error(w, "missing token", http.StatusUnauthorized)
 			return
@@ -414,13 +512,19 @@ func WebSocketHandler(h *Hub, authenticator Authenticator, resolveToUserID func(
 			username:        username,
 			sessionID:       sessionID,
 			conn:            conn,
+			codec:           codecForSubprotocol(conn.Subprotocol()),
 			send:            make(chan Message, 16),
 			hub:             h,
 			messaging:       h.delivery(),
 			resolveToUserID: resolveToUserID,
+			done:            make(chan struct{}),
 		}
 		if err := h.AddClient(c); err != nil {
-			http.Error(w, "failed to register client", http.StatusInternalServerError)
+			_ = conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()),
+				time.Now().Add(time.Second),
+			)
 			_ = conn.Close()
 			return
 		}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/kyambuthia/go-chat-site/server/internal/adapters/httpapi"
 	"github.com/kyambuthia/go-chat-site/server/internal/adapters/transport/wsrelay"
+	"github.com/kyambuthia/go-chat-site/server/internal/app"
 	"github.com/kyambuthia/go-chat-site/server/internal/store"
 )
 
@@ -19,6 +20,12 @@ func NewAPI(dataStore store.APIStore, hub *wsrelay.Hub) http.Handler {
 	return loggingMiddleware(httpapi.NewRouter(dataStore, hub))
 }
 
+// NewAPIWithWiring serves wiring's services; the caller starts and stops its
+// background loops.
+func NewAPIWithWiring(dataStore store.APIStore, hub *wsrelay.Hub, wiring *app.Wiring) http.Handler {
+	return loggingMiddleware(httpapi.NewRouterWithWiring(dataStore, hub, wiring))
+}
+
 type statusRecorder struct {
 	http.ResponseWriter
 	status int
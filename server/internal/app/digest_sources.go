@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+
+	corecontacts "github.com/kyambuthia/go-chat-site/server/internal/core/contacts"
+	coredigest "github.com/kyambuthia/go-chat-site/server/internal/core/digest"
+	coreledger "github.com/kyambuthia/go-chat-site/server/internal/core/ledger"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+// digestSourceLimit bounds how many threads and transfers one digest looks
+// at; older activity was covered by earlier digests.
+const digestSourceLimit = 100
+
+// digestSources reads digest activity from the messaging, contacts and ledger
+// services.
+type digestSources struct {
+	threads  coremsg.ThreadSummaryService
+	contacts corecontacts.Service
+	ledger   coreledger.Service
+}
+
+var _ coredigest.Sources = digestSources{}
+
+func (d digestSources) UnreadThreads(ctx context.Context, userID int) ([]coredigest.UnreadThread, error) {
+	summaries, err := d.threads.ListThreadSummaries(ctx, userID, digestSourceLimit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]coredigest.UnreadThread, 0, len(summaries))
+	for _, s := range summaries {
+		if s.UnreadCount == 0 {
+			continue
+		}
+		out = append(out, coredigest.UnreadThread{
+			CounterpartyUsername: s.CounterpartyUsername,
+			UnreadCount:          s.UnreadCount,
+			LastMessageAt:        s.LastMessageCreatedAt,
+		})
+	}
+	return out, nil
+}
+
+func (d digestSources) PendingInvites(ctx context.Context, userID int) ([]coredigest.PendingInvite, error) {
+	invites, err := d.contacts.ListInvites(ctx, corecontacts.UserID(userID))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]coredigest.PendingInvite, 0, len(invites))
+	for _, inv := range invites {
+		if inv.Status != corecontacts.InvitePending {
+			continue
+		}
+		out = append(out, coredigest.PendingInvite{ID: inv.ID, InviterUsername: inv.InviterUsername})
+	}
+	return out, nil
+}
+
+func (d digestSources) ReceivedTransfers(ctx context.Context, userID int) ([]coredigest.ReceivedTransfer, error) {
+	transfers, err := d.ledger.ListTransfers(ctx, userID, digestSourceLimit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]coredigest.ReceivedTransfer, 0, len(transfers))
+	for _, tr := range transfers {
+		if tr.Direction != "received" {
+			continue
+		}
+		out = append(out, coredigest.ReceivedTransfer{
+			FromUsername: tr.CounterpartyUsername,
+			AmountCents:  tr.AmountCents,
+			CurrencyCode: tr.CurrencyCode,
+			CreatedAt:    tr.CreatedAt,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	corecontacts "github.com/kyambuthia/go-chat-site/server/internal/core/contacts"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+func TestDigestSources_ReadRecipientActivity(t *testing.T) {
+	if err := auth.ConfigureJWT("digest-sources-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MAIL_DROP_DIR", t.TempDir())
+	s := newTestStore(t)
+	aliceID, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobID, err := s.CreateUser("bob", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWiring(s)
+	if w.Digest == nil {
+		t.Fatal("digest service not wired")
+	}
+	ctx := context.Background()
+
+	delivery := w.MessageDelivery(offlineTransport{})
+	for _, body := range []string{"hi", "are you there?"} {
+		if _, err := delivery.SendDirect(ctx, coremsg.DirectSendRequest{FromUserID: bobID, From: "bob", ToUserID: aliceID, Body: body, ContentKind: "text"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Contacts.SendInvite(ctx, corecontacts.UserID(bobID), corecontacts.UserID(aliceID)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Ledger.GetAccount(ctx, bobID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DB.Exec(`UPDATE wallet_accounts SET balance_cents = 5000 WHERE user_id = ?`, bobID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Ledger.SendTransferByUsername(ctx, bobID, "alice", 1250); err != nil {
+		t.Fatal(err)
+	}
+
+	sources := digestSources{w.MessagingThreads, w.Contacts, w.Ledger}
+	threads, err := sources.UnreadThreads(ctx, aliceID)
+	if err != nil || len(threads) != 1 || threads[0].CounterpartyUsername != "bob" || threads[0].UnreadCount != 2 || threads[0].LastMessageAt.IsZero() {
+		t.Fatalf("threads = %+v, %v", threads, err)
+	}
+	invites, err := sources.PendingInvites(ctx, aliceID)
+	if err != nil || len(invites) != 1 || invites[0].InviterUsername != "bob" || invites[0].ID == 0 {
+		t.Fatalf("invites = %+v, %v", invites, err)
+	}
+	transfers, err := sources.ReceivedTransfers(ctx, aliceID)
+	if err != nil || len(transfers) != 1 || transfers[0].FromUsername != "bob" || transfers[0].AmountCents != 1250 {
+		t.Fatalf("transfers = %+v, %v", transfers, err)
+	}
+
+	// The sender's side of the same activity is not reported to them.
+	if threads, _ := sources.UnreadThreads(ctx, bobID); len(threads) != 0 {
+		t.Fatalf("bob threads = %+v", threads)
+	}
+	if transfers, _ := sources.ReceivedTransfers(ctx, bobID); len(transfers) != 0 {
+		t.Fatalf("bob transfers = %+v", transfers)
+	}
+}
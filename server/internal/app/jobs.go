@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/jwttokens"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqliteidentity"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqlitejobs"
+	corejobs "github.com/kyambuthia/go-chat-site/server/internal/core/jobs"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+)
+
+// prekeyLowWatermark is the active prekey count below which a device is
+// reported by the prekey check.
+const prekeyLowWatermark = 10
+
+// maintenanceJobs are the jobs every backend runs.
+func maintenanceJobs(jobsRepo *sqlitejobs.Adapter, tokens *jwttokens.Adapter, invites store.InviteStore) []corejobs.Job {
+	return []corejobs.Job{
+		{Name: "session_cleanup", Interval: time.Hour, Run: tokens.DeleteStaleSessions},
+		{Name: "rate_limit_prune", Interval: 5 * time.Minute, Run: jobsRepo.PruneRateLimits},
+		{Name: "invite_expiry", Interval: time.Hour, Run: func(_ context.Context, now time.Time) (int, error) {
+			return invites.ExpireInvites(now)
+		}},
+	}
+}
+
+// retentionJob enforces thread timers and the delivered-ciphertext policy.
+// Its interval keeps deletion within about a minute of expires_at.
+func retentionJob(reaper *coremsg.Reaper) corejobs.Job {
+	return corejobs.Job{
+		Name:     "message_retention",
+		Interval: 30 * time.Second,
+		Run: func(ctx context.Context, _ time.Time) (int, error) {
+			return reaper.Reap(ctx)
+		},
+	}
+}
+
+// prekeyCheckJob counts active devices running low on one-time prekeys, so
+// operators can see clients that stopped replenishing them.
+func prekeyCheckJob(devices *sqliteidentity.DeviceKeysAdapter) corejobs.Job {
+	return corejobs.Job{
+		Name:     "prekey_check",
+		Interval: time.Hour,
+		Run: func(ctx context.Context, _ time.Time) (int, error) {
+			return devices.CountDevicesLowOnPrekeys(ctx, prekeyLowWatermark)
+		},
+	}
+}
+
+// jobRunner returns the background loop that runs jobs. When the job table
+// is missing, for example before migrations ran, maintenance is disabled
+// rather than stopping the server.
+func jobRunner(db *sql.DB, d dialect.Dialect, jobs ...corejobs.Job) func(ctx context.Context) {
+	runner := corejobs.NewRunner(&sqlitejobs.Adapter{DB: db, Dialect: d}, jobOwner(), logJobRun)
+	for _, job := range jobs {
+		runner.Register(job)
+	}
+	return func(ctx context.Context) {
+		if err := runner.Start(ctx); err != nil {
+			log.Printf("warn: background jobs disabled: %v", err)
+		}
+	}
+}
+
+// jobOwner identifies this runner in job leases.
+func jobOwner() string {
+	host, _ := os.Hostname()
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b[:]))
+}
+
+// logJobRun writes a job_run line for failed runs and runs that did work.
+func logJobRun(name string, result corejobs.RunResult) {
+	if result.Error == "" && result.Items == 0 {
+		return
+	}
+	entry := map[string]any{
+		"event":       "job_run",
+		"job":         name,
+		"items":       result.Items,
+		"duration_ms": result.Duration.Milliseconds(),
+		"next_run_at": result.NextRunAt.Format(time.RFC3339),
+	}
+	if result.Error != "" {
+		entry["error"] = result.Error
+	}
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	log.Print(string(payload))
+}
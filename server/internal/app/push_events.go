@@ -0,0 +1,38 @@
+package app
+
+import (
+	"context"
+	"log"
+
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+	corepush "github.com/kyambuthia/go-chat-site/server/internal/core/push"
+)
+
+// pushFallback queues a Web Push notification when a message was stored but
+// the recipient had no live connection to receive it.
+type pushFallback struct {
+	coremsg.Service
+	push corepush.Service
+}
+
+func (p pushFallback) SendDirect(ctx context.Context, req coremsg.DirectSendRequest) (coremsg.DeliveryReceipt, error) {
+	receipt, err := p.Service.SendDirect(ctx, req)
+	if err != nil || receipt.Delivered || receipt.StoredMessageID == 0 {
+		return receipt, err
+	}
+	n := corepush.Notification{
+		UserID:       req.ToUserID,
+		FromUserID:   req.FromUserID,
+		FromUsername: req.From,
+		MessageID:    receipt.StoredMessageID,
+		ContentKind:  req.ContentKind,
+		Encrypted:    req.Ciphertext != "",
+	}
+	if req.ContentKind == "" || req.ContentKind == "text" {
+		n.Preview = req.Body
+	}
+	if err := p.push.Notify(ctx, n); err != nil {
+		log.Printf("warn: push notification for message %d not queued: %v", receipt.StoredMessageID, err)
+	}
+	return receipt, nil
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webpush"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webpush/webpushtest"
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+	corepush "github.com/kyambuthia/go-chat-site/server/internal/core/push"
+)
+
+type offlineTransport struct{}
+
+func (offlineTransport) SendDirect(int, coremsg.Message) bool { return false }
+
+func TestMessageDelivery_PushesOfflineRecipients(t *testing.T) {
+	if err := auth.ConfigureJWT("push-events-test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	key, err := webpush.GenerateVAPIDKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WEBPUSH_VAPID_PRIVATE_KEY", key)
+	t.Setenv("WEBPUSH_VAPID_SUBJECT", "mailto:ops@example.com")
+	t.Setenv("WEBPUSH_ALLOW_PRIVATE_TARGETS", "true")
+	service := webpushtest.New()
+	defer service.Close()
+
+	s := newTestStore(t)
+	aliceID, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobID, err := s.CreateUser("bob", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWiring(s)
+	if w.Push == nil {
+		t.Fatal("push service not wired")
+	}
+	ctx := context.Background()
+	w.Start(ctx)
+	t.Cleanup(w.Stop)
+	login, err := w.Auth.LoginPassword(ctx, coreid.PasswordCredential{Username: "bob", Password: "password123"}, coreid.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	browser, err := service.NewSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Push.Subscribe(ctx, bobID, login.Session.ID, corepush.SubscribeRequest{Endpoint: browser.Endpoint, P256DH: browser.P256DH, Auth: browser.Auth}); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery := w.MessageDelivery(offlineTransport{})
+	send := func(req coremsg.DirectSendRequest) {
+		t.Helper()
+		req.FromUserID, req.From, req.ToUserID = aliceID, "alice", bobID
+		receipt, err := delivery.SendDirect(ctx, req)
+		if err != nil || receipt.Delivered || receipt.StoredMessageID == 0 {
+			t.Fatalf("receipt = %+v, err = %v", receipt, err)
+		}
+	}
+	receive := func() map[string]any {
+		t.Helper()
+		select {
+		case got := <-service.Pushes:
+			if got.Err != nil {
+				t.Fatalf("push service rejected push: %v", got.Err)
+			}
+			var payload map[string]any
+			if err := json.Unmarshal(got.Payload, &payload); err != nil {
+				t.Fatal(err)
+			}
+			return payload
+		case <-time.After(10 * time.Second):
+			t.Fatal("no push received")
+		}
+		return nil
+	}
+
+	send(coremsg.DirectSendRequest{Body: "lunch?", ContentKind: "text"})
+	if got := receive(); got["preview"] != "lunch?" || got["from"] != "alice" || got["encrypted"] != false {
+		t.Fatalf("plaintext payload = %v", got)
+	}
+
+	send(coremsg.DirectSendRequest{Ciphertext: "b64-ciphertext", EnvelopeVersion: "v1", ContentKind: "text"})
+	if got := receive(); got["encrypted"] != true || got["preview"] != nil {
+		t.Fatalf("encrypted payload = %v", got)
+	}
+
+	// Pushes stop once the subscribing session is signed out.
+	if err := w.Sessions.RevokeSession(ctx, coreid.UserID(bobID), login.Session.ID); err != nil {
+		t.Fatal(err)
+	}
+	send(coremsg.DirectSendRequest{Body: "still there?", ContentKind: "text"})
+	select {
+	case got := <-service.Pushes:
+		t.Fatalf("push after sign-out: %+v", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	corecontacts "github.com/kyambuthia/go-chat-site/server/internal/core/contacts"
+	coreledger "github.com/kyambuthia/go-chat-site/server/internal/core/ledger"
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+	corewebhooks "github.com/kyambuthia/go-chat-site/server/internal/core/webhooks"
+)
+
+// The decorators below publish webhook events after the wrapped operation
+// succeeds. A failed publish is logged and never fails the operation itself.
+
+type webhookMessaging struct {
+	coremsg.PersistenceService
+	hooks corewebhooks.Service
+}
+
+// StoreDirectMessage notifies the recipient. The payload carries ids and
+// metadata only; receivers fetch the content with a messages:read token.
+func (m webhookMessaging) StoreDirectMessage(ctx context.Context, req coremsg.PersistDirectMessageRequest) (coremsg.StoredMessage, error) {
+	stored, err := m.PersistenceService.StoreDirectMessage(ctx, req)
+	if err != nil {
+		return stored, err
+	}
+	publishWebhook(ctx, m.hooks, corewebhooks.Event{
+		Type:       corewebhooks.EventMessageReceived,
+		UserID:     stored.ToUserID,
+		OccurredAt: stored.CreatedAt,
+		Data: map[string]any{
+			"message_id":   stored.ID,
+			"from_user_id": stored.FromUserID,
+			"content_kind": stored.ContentKind,
+			"encrypted":    stored.Ciphertext != "",
+		},
+	})
+	if requestID, ok := paidPaymentRequest(stored); ok {
+		publishWebhook(ctx, m.hooks, corewebhooks.Event{
+			Type:       corewebhooks.EventPaymentRequestPaid,
+			UserID:     stored.ToUserID,
+			OccurredAt: stored.CreatedAt,
+			Data: map[string]any{
+				"request_id":    requestID,
+				"message_id":    stored.ID,
+				"payer_user_id": stored.FromUserID,
+			},
+		})
+	}
+	return stored, nil
+}
+
+// paidPaymentRequest reads the payment request ID from the update the payer's
+// client sends back once it has paid. Encrypted updates carry no readable
+// body, so they raise no event.
+func paidPaymentRequest(stored coremsg.StoredMessage) (string, bool) {
+	if stored.ContentKind != "payment_request_update" {
+		return "", false
+	}
+	raw, ok := strings.CutPrefix(stored.Body, "__microapp_v1__:")
+	if !ok {
+		return "", false
+	}
+	var payload struct {
+		Kind      string `json:"kind"`
+		RequestID string `json:"requestId"`
+		Status    string `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		return "", false
+	}
+	if payload.Kind != "payment_request_update" || payload.Status != "paid" || payload.RequestID == "" {
+		return "", false
+	}
+	return payload.RequestID, true
+}
+
+type webhookContacts struct {
+	corecontacts.Service
+	hooks corewebhooks.Service
+}
+
+// RespondToInvite notifies the inviter when an invite is accepted.
+func (c webhookContacts) RespondToInvite(ctx context.Context, inviteID int, userID corecontacts.UserID, status corecontacts.InviteStatus) error {
+	var inviter corecontacts.UserID
+	if status == corecontacts.InviteAccepted {
+		if invites, err := c.Service.ListInvites(ctx, userID); err == nil {
+			for _, invite := range invites {
+				if invite.ID == inviteID {
+					inviter = invite.FromUser
+				}
+			}
+		}
+	}
+	if err := c.Service.RespondToInvite(ctx, inviteID, userID, status); err != nil {
+		return err
+	}
+	if inviter > 0 {
+		publishWebhook(ctx, c.hooks, corewebhooks.Event{
+			Type:   corewebhooks.EventInviteAccepted,
+			UserID: int(inviter),
+			Data: map[string]any{
+				"invite_id":           inviteID,
+				"accepted_by_user_id": int(userID),
+			},
+		})
+	}
+	return nil
+}
+
+type webhookLedger struct {
+	coreledger.Service
+	hooks corewebhooks.Service
+}
+
+// SendTransferByUsername notifies both parties; transfers settle
+// synchronously, so a returned transfer is a settled one.
+func (l webhookLedger) SendTransferByUsername(ctx context.Context, fromUserID int, recipientUsername string, amountCents int64) (coreledger.Transfer, error) {
+	transfer, err := l.Service.SendTransferByUsername(ctx, fromUserID, recipientUsername, amountCents)
+	if err != nil {
+		return transfer, err
+	}
+	for _, side := range []struct {
+		userID, counterparty int
+		direction            string
+	}{
+		{transfer.FromUserID, transfer.ToUserID, "sent"},
+		{transfer.ToUserID, transfer.FromUserID, "received"},
+	} {
+		publishWebhook(ctx, l.hooks, corewebhooks.Event{
+			Type:       corewebhooks.EventTransferSettled,
+			UserID:     side.userID,
+			OccurredAt: transfer.CreatedAt,
+			Data: map[string]any{
+				"direction":            side.direction,
+				"counterparty_user_id": side.counterparty,
+				"amount_cents":         transfer.AmountCents,
+				"currency_code":        transfer.CurrencyCode,
+			},
+		})
+	}
+	return transfer, nil
+}
+
+func publishWebhook(ctx context.Context, hooks corewebhooks.Service, event corewebhooks.Event) {
+	if err := hooks.Publish(ctx, event); err != nil {
+		log.Printf("warn: webhook %s for user %d not queued: %v", event.Type, event.UserID, err)
+	}
+}
@@ -4,34 +4,109 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
 
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/blobstore/fsblob"
 	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/jwttokens"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/oidc"
 	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/passwordbcrypt"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/totp"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/webauthn"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/media/stdimage"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/email"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/filelog"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webhookhttp"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/notify/webpush"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/postgresmessaging"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqliteaccount"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqliteattachments"
 	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqlitecontacts"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqlitedigest"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqlitedirectory"
 	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqliteidentity"
 	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqliteidentityauth"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqlitejobs"
 	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqliteledger"
 	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqlitemessaging"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqlitepush"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/store/sqlitewebhooks"
 	"github.com/kyambuthia/go-chat-site/server/internal/config"
+	coreaccount "github.com/kyambuthia/go-chat-site/server/internal/core/account"
+	coreatt "github.com/kyambuthia/go-chat-site/server/internal/core/attachments"
 	corecontacts "github.com/kyambuthia/go-chat-site/server/internal/core/contacts"
+	coredigest "github.com/kyambuthia/go-chat-site/server/internal/core/digest"
+	coredirectory "github.com/kyambuthia/go-chat-site/server/internal/core/directory"
 	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
 	coreledger "github.com/kyambuthia/go-chat-site/server/internal/core/ledger"
 	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+	corepush "github.com/kyambuthia/go-chat-site/server/internal/core/push"
+	corewebhooks "github.com/kyambuthia/go-chat-site/server/internal/core/webhooks"
 	"github.com/kyambuthia/go-chat-site/server/internal/store"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
 )
 
 // Wiring assembles core services and adapter-backed helper functions for HTTP/WS composition.
 type Wiring struct {
 	Contacts             corecontacts.Service
+	InviteLinks          corecontacts.InviteLinks
+	Directory            coredirectory.Service
 	Auth                 coreid.AuthService
 	Sessions             coreid.SessionService
+	MFA                  coreid.MFAService
+	Passkeys             coreid.PasskeyService
+	OIDC                 coreid.OIDCService
+	Credentials          coreid.CredentialService
 	Tokens               coreid.TokenService
+	APITokens            coreid.APITokenService
 	Identity             coreid.ProfileService
 	Devices              coreid.DeviceIdentityService
 	Ledger               coreledger.Service
 	MessagingPersistence coremsg.PersistenceService
 	MessagingThreads     coremsg.ThreadSummaryService
+	MessagingSearch      coremsg.SearchService
 	MessagingCorrelation coremsg.ClientMessageCorrelationRecorder
+	MessagingRetention   coremsg.RetentionService
+	Attachments          coreatt.Service
+	Webhooks             corewebhooks.Service
+	Push                 corepush.Service
+	Digest               coredigest.Service
+	Account              coreaccount.Service
+
+	loops  background
+	cancel context.CancelFunc
+}
+
+// background collects the loops a Wiring runs between Start and Stop:
+// maintenance jobs, the account exporter, media workers, the webhook and
+// push dispatchers and the digest scheduler.
+type background []func(ctx context.Context)
+
+func (b *background) add(start func(ctx context.Context)) {
+	*b = append(*b, start)
+}
+
+// Start runs the background loops until Stop is called or ctx is done.
+// Tests leave a Wiring unstarted, so building one spawns no goroutines.
+func (w *Wiring) Start(ctx context.Context) {
+	if w.cancel != nil {
+		return
+	}
+	ctx, w.cancel = context.WithCancel(ctx)
+	for _, start := range w.loops {
+		start(ctx)
+	}
+}
+
+// Stop cancels the background loops. Work in progress is abandoned and picked
+// up again by the next process: job leases expire and queued deliveries stay
+// pending.
+func (w *Wiring) Stop() {
+	if w.cancel != nil {
+		w.cancel()
+	}
 }
 
 func NewWiring(dataStore store.APIStore) *Wiring {
@@ -44,22 +119,60 @@ func NewWiring(dataStore store.APIStore) *Wiring {
 		AccessTTL:  config.AccessTokenTTL(),
 		RefreshTTL: config.RefreshTokenTTL(),
 	}
-	if dbProvider, ok := dataStore.(interface{ SQLDB() *sql.DB }); ok && dbProvider.SQLDB() != nil {
+	dbProvider, ok := dataStore.(interface{ SQLDB() *sql.DB })
+	if ok && dbProvider.SQLDB() != nil && dialect.Of(dataStore) == dialect.Postgres {
+		return newPostgresWiring(dbProvider.SQLDB(), contactsAdapter, authAdapter, identityAdapter, ledgerAdapter, tokenAdapter)
+	}
+	var loops background
+	if ok && dbProvider.SQLDB() != nil {
 		tokenAdapter.DB = dbProvider.SQLDB()
 		deviceKeysAdapter := &sqliteidentity.DeviceKeysAdapter{DB: dbProvider.SQLDB()}
+		mfaAdapter := &sqliteidentity.MFAAdapter{DB: dbProvider.SQLDB()}
+		totpProvider := totp.New(config.TOTPIssuer())
+		passkeyAdapter := &sqliteidentity.PasskeyAdapter{DB: dbProvider.SQLDB()}
+		apiTokens := coreid.NewAPITokenService(&sqliteidentity.APITokensAdapter{DB: dbProvider.SQLDB()})
+		passkeys := coreid.NewPasskeyService(passkeyAdapter, webauthn.New(config.WebAuthnRPID(), config.WebAuthnRPName(), config.WebAuthnOrigins()))
+		authenticators := []coreid.Authenticator{passkeys}
+		oidcService := newOIDCService(dbProvider.SQLDB())
+		if oidcService != nil {
+			authenticators = append(authenticators, oidcService)
+		}
 		messagingAdapter := &sqlitemessaging.Adapter{DB: dbProvider.SQLDB()}
-		messagingPersistence = coremsg.NewPersistenceService(messagingAdapter)
+		blobs := newBlobStore()
+		reaper := newReaper(messagingAdapter, blobs)
+		jobs := append(maintenanceJobs(&sqlitejobs.Adapter{DB: dbProvider.SQLDB()}, tokenAdapter, dataStore), retentionJob(reaper), prekeyCheckJob(deviceKeysAdapter))
+		loops.add(jobRunner(dbProvider.SQLDB(), dialect.SQLite, jobs...))
+		webhooks := newWebhookService(dbProvider.SQLDB(), &loops)
+		messagingPersistence = webhookMessaging{coremsg.NewPersistenceServiceWithRetention(messagingAdapter, messagingAdapter), webhooks}
+		contacts := webhookContacts{corecontacts.NewService(contactsAdapter, contactsAdapter), webhooks}
+		ledger := webhookLedger{coreledger.NewService(ledgerAdapter, ledgerAdapter), webhooks}
+		threads := coremsg.NewThreadSummaryService(messagingAdapter)
 		return &Wiring{
-			Contacts:             corecontacts.NewService(contactsAdapter, contactsAdapter),
-			Auth:                 coreid.NewAuthService(authAdapter, passwordbcrypt.Verifier{}, tokenAdapter),
+			Contacts:             contacts,
+			InviteLinks:          newInviteLinkService(dbProvider.SQLDB()),
+			Directory:            coredirectory.NewService(&sqlitedirectory.Adapter{DB: dbProvider.SQLDB()}),
+			Auth:                 coreid.NewAuthServiceWithMFA(authAdapter, passwordbcrypt.Verifier{}, tokenAdapter, mfaAdapter, totpProvider, authenticators...),
 			Sessions:             coreid.NewSessionService(tokenAdapter),
-			Tokens:               tokenAdapter,
+			MFA:                  coreid.NewMFAService(mfaAdapter, totpProvider),
+			Passkeys:             passkeys,
+			OIDC:                 oidcService,
+			Credentials:          newCredentialService(dbProvider.SQLDB(), tokenAdapter),
+			Tokens:               coreid.WithAPITokens(tokenAdapter, apiTokens),
+			APITokens:            apiTokens,
 			Identity:             coreid.NewProfileService(identityAdapter),
 			Devices:              coreid.NewDeviceIdentityService(deviceKeysAdapter),
-			Ledger:               coreledger.NewService(ledgerAdapter, ledgerAdapter),
+			Ledger:               ledger,
 			MessagingPersistence: messagingPersistence,
-			MessagingThreads:     coremsg.NewThreadSummaryService(messagingAdapter),
+			MessagingThreads:     threads,
+			MessagingSearch:      coremsg.NewSearchService(messagingAdapter),
 			MessagingCorrelation: messagingAdapter,
+			MessagingRetention:   coremsg.NewRetentionService(messagingAdapter, messagingAdapter),
+			Attachments:          newAttachmentsService(dbProvider.SQLDB(), blobs, &loops),
+			Webhooks:             webhooks,
+			Push:                 newPushService(dbProvider.SQLDB(), &loops),
+			Digest:               newDigestService(dbProvider.SQLDB(), digestSources{threads, contacts, ledger}, &loops),
+			Account:              newAccountService(dbProvider.SQLDB(), blobs, &loops),
+			loops:                loops,
 		}
 	}
 
@@ -75,6 +188,110 @@ func NewWiring(dataStore store.APIStore) *Wiring {
 	}
 }
 
+// postgresUnsupported maps the Wiring fields the Postgres backend leaves nil
+// to the feature each serves; those routes answer 503 there. Postgres support
+// is deliberately limited to chat, contacts, sessions and wallet. A feature
+// added without a Postgres adapter must be listed here, which
+// TestNewWiring_PostgresLeavesOnlyListedFeaturesUnset enforces, and in the
+// Storage Backends section of docs/architecture/api.md.
+var postgresUnsupported = map[string]string{
+	"InviteLinks":        "invite links",
+	"Directory":          "user search",
+	"MFA":                "two-factor",
+	"Passkeys":           "passkeys",
+	"OIDC":               "single sign-on",
+	"Credentials":        "password reset and change",
+	"APITokens":          "API tokens",
+	"Devices":            "device keys",
+	"MessagingSearch":    "message search",
+	"MessagingRetention": "disappearing messages",
+	"Attachments":        "attachments",
+	"Webhooks":           "webhooks",
+	"Push":               "push",
+	"Digest":             "email notifications",
+	"Account":            "account export and deletion",
+}
+
+func postgresUnsupportedFeatures() []string {
+	features := make([]string, 0, len(postgresUnsupported))
+	for _, feature := range postgresUnsupported {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// CheckPostgresSupport is run at startup when DATABASE_URL selects
+// PostgreSQL. It fails when a setting turns on a feature the backend cannot
+// serve, and unless the operator has accepted the reduced feature set with
+// POSTGRES_ACCEPT_REDUCED_FEATURES, so no feature goes missing silently.
+func CheckPostgresSupport() error {
+	var errs []error
+	for _, setting := range []struct {
+		env, field string
+		set        bool
+	}{
+		{config.EnvInviteLinkSecret, "InviteLinks", config.InviteLinkSecret() != ""},
+		{config.EnvOIDCIssuer, "OIDC", config.OIDCIssuer() != ""},
+		{config.EnvWebPushVAPIDPrivateKey, "Push", config.WebPushVAPIDPrivateKey() != ""},
+		{config.EnvSMTPAddr, "Digest", config.SMTPAddr() != ""},
+		{config.EnvMailDropDir, "Digest", config.MailDropDir() != ""},
+	} {
+		if setting.set {
+			errs = append(errs, fmt.Errorf("%s is set but %s is not supported on PostgreSQL; unset it or use SQLite", setting.env, postgresUnsupported[setting.field]))
+		}
+	}
+	if !config.PostgresAcceptReducedFeatures() {
+		errs = append(errs, fmt.Errorf("PostgreSQL does not support %s; set %s=true to run without them", strings.Join(postgresUnsupportedFeatures(), ", "), config.EnvPostgresAcceptReduced))
+	}
+	return errors.Join(errs...)
+}
+
+// newPostgresWiring covers the core chat, contacts, sessions and wallet
+// services and leaves the features in postgresUnsupported nil.
+func newPostgresWiring(db *sql.DB, contactsAdapter *sqlitecontacts.Adapter, authAdapter *sqliteidentityauth.Adapter, identityAdapter *sqliteidentity.Adapter, ledgerAdapter *sqliteledger.Adapter, tokenAdapter *jwttokens.Adapter) *Wiring {
+	tokenAdapter.DB = db
+	tokenAdapter.Dialect = dialect.Postgres
+	messagingAdapter := &postgresmessaging.Adapter{DB: db}
+	log.Printf("postgres backend: unavailable features: %s", strings.Join(postgresUnsupportedFeatures(), ", "))
+	runner := jobRunner(db, dialect.Postgres, maintenanceJobs(&sqlitejobs.Adapter{DB: db, Dialect: dialect.Postgres}, tokenAdapter, contactsAdapter.Store)...)
+	return &Wiring{
+		Contacts:             corecontacts.NewService(contactsAdapter, contactsAdapter),
+		Auth:                 coreid.NewAuthService(authAdapter, passwordbcrypt.Verifier{}, tokenAdapter),
+		Sessions:             coreid.NewSessionService(tokenAdapter),
+		Tokens:               tokenAdapter,
+		Identity:             coreid.NewProfileService(identityAdapter),
+		Ledger:               coreledger.NewService(ledgerAdapter, ledgerAdapter),
+		MessagingPersistence: coremsg.NewPersistenceService(messagingAdapter),
+		MessagingThreads:     coremsg.NewThreadSummaryService(messagingAdapter),
+		MessagingCorrelation: messagingAdapter,
+		loops:                background{runner},
+	}
+}
+
+// newAccountService registers the exporter that builds queued archives and
+// deletes expired ones. When attachments are configured, deleting an account
+// also removes the user's files.
+func newAccountService(db *sql.DB, blobs *fsblob.Store, loops *background) coreaccount.Service {
+	repo := &sqliteaccount.Adapter{DB: db}
+	loops.add(coreaccount.NewExporter(repo).Start)
+	if blobs == nil {
+		return coreaccount.NewService(repo, passwordbcrypt.Verifier{})
+	}
+	return coreaccount.NewServiceWithBlobs(repo, passwordbcrypt.Verifier{}, blobs)
+}
+
+// MessageDelivery returns the service the real-time transport sends direct
+// messages through: stored first, then relayed, with a Web Push notification
+// when the recipient is offline and push is configured.
+func (w *Wiring) MessageDelivery(transport coremsg.Transport) coremsg.Service {
+	var svc coremsg.Service = coremsg.NewDurableRelayServiceWithCorrelation(transport, w.MessagingPersistence, w.MessagingCorrelation)
+	if w.Push != nil {
+		svc = pushFallback{svc, w.Push}
+	}
+	return svc
+}
+
 func WSAuthenticator(tokens coreid.TokenService, dataStore store.APIStore) func(token string) (int, string, int64, error) {
 	return func(token string) (int, string, int64, error) {
 		if tokens == nil {
@@ -84,6 +301,11 @@ func WSAuthenticator(tokens coreid.TokenService, dataStore store.APIStore) func(
 		if err != nil {
 			return 0, "", 0, err
 		}
+		// A socket both receives and sends messages, and only bots may hold
+		// one on an API token.
+		if claims.APITokenID > 0 && (!claims.Bot || !claims.HasScope(coreid.ScopeMessagesRead) || !claims.HasScope(coreid.ScopeMessagesSend)) {
+			return 0, "", 0, errors.New("token may not open a websocket")
+		}
 		user, err := dataStore.GetUserByID(int(claims.SubjectUserID))
 		if err != nil {
 			return 0, "", 0, err
@@ -101,3 +323,163 @@ func WSResolveUserID(dataStore store.APIStore) func(username string) (int, error
 		return user.ID, nil
 	}
 }
+
+// newCredentialService returns a service whose reset requests are silently
+// dropped when the notification log cannot be opened; password change still
+// works.
+func newCredentialService(db *sql.DB, sessions coreid.SessionRevoker) coreid.CredentialService {
+	var notifier coreid.PasswordResetNotifier
+	if n, err := filelog.New(config.PasswordResetLogPath(), config.PasswordResetURL()); err != nil {
+		log.Printf("warn: password reset delivery disabled: %v", err)
+	} else {
+		notifier = n
+	}
+	return coreid.NewCredentialService(&sqliteidentity.CredentialsAdapter{DB: db}, passwordbcrypt.Verifier{}, passwordbcrypt.Verifier{}, sessions, notifier)
+}
+
+// newOIDCService returns nil when OIDC_ISSUER is unset, which the HTTP
+// adapter reports as "single sign-on unavailable". The issuer is contacted
+// lazily, so a provider outage at startup does not stop the server.
+func newOIDCService(db *sql.DB) coreid.OIDCService {
+	issuer := config.OIDCIssuer()
+	if issuer == "" {
+		return nil
+	}
+	if config.OIDCClientID() == "" {
+		log.Printf("warn: single sign-on disabled: %s is not set", config.EnvOIDCClientID)
+		return nil
+	}
+	provider := oidc.New(issuer, config.OIDCClientID(), config.OIDCClientSecret(), config.OIDCRedirectURL(), config.OIDCScopes(), nil)
+	return coreid.NewOIDCService(&sqliteidentity.OIDCAdapter{DB: db}, provider, coreid.OIDCPolicy{
+		AutoCreate:          config.OIDCAutoCreate(),
+		AllowedEmailDomains: config.OIDCAllowedEmailDomains(),
+		TrustProviderMFA:    config.OIDCTrustProviderMFA(),
+	})
+}
+
+// newInviteLinkService returns nil when INVITE_LINK_SECRET is unset, which
+// the HTTP adapter reports as "invite links unavailable".
+func newInviteLinkService(db *sql.DB) corecontacts.InviteLinks {
+	secret := config.InviteLinkSecret()
+	if secret == "" {
+		return nil
+	}
+	return corecontacts.NewInviteLinkService(&sqlitecontacts.LinksAdapter{DB: db}, secret)
+}
+
+// newReaper also removes attachment files when attachments are configured.
+func newReaper(repo coremsg.RetentionRepository, blobs *fsblob.Store) *coremsg.Reaper {
+	policy := coremsg.RetentionPolicy{DeliveredCiphertextTTL: config.DeliveredCiphertextRetention()}
+	if blobs == nil {
+		return coremsg.NewReaper(repo, policy)
+	}
+	return coremsg.NewReaperWithBlobs(repo, policy, blobs)
+}
+
+// newBlobStore returns nil when ATTACHMENTS_DIR is unset or unusable.
+func newBlobStore() *fsblob.Store {
+	dir := config.AttachmentsDir()
+	if dir == "" {
+		return nil
+	}
+	blobs, err := fsblob.New(dir)
+	if err != nil {
+		log.Printf("warn: attachments disabled: %v", err)
+		return nil
+	}
+	return blobs
+}
+
+// newAttachmentsService returns nil without a blob store, which the HTTP
+// adapter reports as "attachments unavailable". It registers the media
+// pipeline workers.
+func newAttachmentsService(db *sql.DB, blobs *fsblob.Store, loops *background) coreatt.Service {
+	if blobs == nil {
+		return nil
+	}
+	repo := &sqliteattachments.Adapter{DB: db}
+	images := stdimage.New()
+	pipeline := coreatt.NewMediaPipeline(repo, repo, blobs, images)
+	loops.add(pipeline.Start)
+	return coreatt.NewServiceWithMedia(repo, blobs, coreatt.Limits{
+		MaxBytes:       config.AttachmentMaxBytes(),
+		UserQuotaBytes: config.AttachmentUserQuotaBytes(),
+	}, images, pipeline)
+}
+
+// newWebhookService registers the delivery dispatcher. Deliveries left
+// pending by a previous process are sent on its first pass.
+func newWebhookService(db *sql.DB, loops *background) corewebhooks.Service {
+	repo := &sqlitewebhooks.Adapter{DB: db}
+	policy := corewebhooks.Policy{
+		AllowHTTP:   config.WebhooksAllowPrivateTargets(),
+		MaxAttempts: config.WebhookMaxAttempts(),
+	}
+	dispatcher := corewebhooks.NewDispatcher(repo, webhookhttp.New(config.WebhooksAllowPrivateTargets()), policy)
+	loops.add(dispatcher.Start)
+	return corewebhooks.NewService(repo, dispatcher, policy)
+}
+
+// newPushService returns nil when WEBPUSH_VAPID_PRIVATE_KEY is unset, which
+// the HTTP adapter reports as "push notifications unavailable". Like the
+// webhook dispatcher, the send queue is registered as a background loop.
+func newPushService(db *sql.DB, loops *background) corepush.Service {
+	encoded := config.WebPushVAPIDPrivateKey()
+	if encoded == "" {
+		return nil
+	}
+	key, err := webpush.ParseVAPIDKey(encoded)
+	if err != nil {
+		log.Printf("warn: push notifications disabled: %v", err)
+		return nil
+	}
+	allowPrivate := config.WebPushAllowPrivateTargets()
+	pusher, err := webpush.New(key, config.WebPushVAPIDSubject(), webhookhttp.NewClient(allowPrivate))
+	if err != nil {
+		log.Printf("warn: push notifications disabled: %v", err)
+		return nil
+	}
+	repo := &sqlitepush.Adapter{DB: db}
+	policy := corepush.Policy{
+		AllowHTTP:   allowPrivate,
+		MaxAttempts: config.WebPushMaxAttempts(),
+	}
+	dispatcher := corepush.NewDispatcher(repo, pusher, policy)
+	loops.add(dispatcher.Start)
+	return corepush.NewService(repo, pusher, dispatcher, policy)
+}
+
+// newDigestService returns nil when neither SMTP_ADDR nor MAIL_DROP_DIR is
+// set, which the HTTP adapter reports as "email notifications unavailable".
+// It registers the scheduler.
+func newDigestService(db *sql.DB, sources coredigest.Sources, loops *background) coredigest.Service {
+	var mailer coredigest.Mailer
+	switch {
+	case config.SMTPAddr() != "":
+		sender, err := email.NewSMTP(email.SMTPConfig{
+			Addr:       config.SMTPAddr(),
+			Username:   config.SMTPUsername(),
+			Password:   config.SMTPPassword(),
+			From:       config.MailFrom(),
+			RequireTLS: config.SMTPRequireTLS(),
+		})
+		if err != nil {
+			log.Printf("warn: email notifications disabled: %v", err)
+			return nil
+		}
+		mailer = sender
+	case config.MailDropDir() != "":
+		sender, err := email.NewDrop(config.MailDropDir(), config.MailFrom())
+		if err != nil {
+			log.Printf("warn: email notifications disabled: %v", err)
+			return nil
+		}
+		mailer = sender
+	default:
+		return nil
+	}
+	repo := &sqlitedigest.Adapter{DB: db}
+	policy := coredigest.Policy{AppURL: config.NotificationsAppURL()}
+	loops.add(coredigest.NewScheduler(repo, sources, mailer, policy).Start)
+	return coredigest.NewService(repo, mailer, policy)
+}
@@ -2,10 +2,18 @@ package app
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/totp"
+	"github.com/kyambuthia/go-chat-site/server/internal/adapters/identity/webauthn/webauthntest"
 	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreaccount "github.com/kyambuthia/go-chat-site/server/internal/core/account"
 	corecontacts "github.com/kyambuthia/go-chat-site/server/internal/core/contacts"
 	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
 	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
@@ -119,6 +127,110 @@ func TestNewWiring_ComposesWorkingCoreServices(t *testing.T) {
 	}
 }
 
+func TestNewWiring_TOTPLoginRequiresSecondFactor(t *testing.T) {
+	if err := auth.ConfigureJWT("test-secret-123456"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestStore(t)
+	w := NewWiring(s)
+	ctx := context.Background()
+	cred := coreid.PasswordCredential{Username: "alice", Password: "password123"}
+	principal, err := w.Auth.RegisterPassword(ctx, cred)
+	if err != nil {
+		t.Fatalf("RegisterPassword error: %v", err)
+	}
+
+	enrollment, err := w.MFA.BeginTOTPEnrollment(ctx, principal.ID)
+	if err != nil {
+		t.Fatalf("BeginTOTPEnrollment error: %v", err)
+	}
+	authenticator := totp.New("")
+	now := time.Now()
+	code, _ := authenticator.Code(enrollment.Secret, now)
+	recoveryCodes, err := w.MFA.ConfirmTOTPEnrollment(ctx, principal.ID, code)
+	if err != nil || len(recoveryCodes) != coreid.RecoveryCodeCount {
+		t.Fatalf("ConfirmTOTPEnrollment = %v, %v", recoveryCodes, err)
+	}
+
+	_, err = w.Auth.LoginPassword(ctx, cred, coreid.SessionMetadata{})
+	var required *coreid.MFARequiredError
+	if !errors.As(err, &required) {
+		t.Fatalf("LoginPassword err = %v, want MFARequiredError", err)
+	}
+	nextCode, _ := authenticator.Code(enrollment.Secret, now.Add(30*time.Second))
+	tokens, err := w.Auth.CompleteMFALogin(ctx, required.Challenge.Token, nextCode, coreid.SessionMetadata{})
+	if err != nil {
+		t.Fatalf("CompleteMFALogin error: %v", err)
+	}
+	if claims, err := w.Tokens.ValidateToken(ctx, tokens.AccessToken); err != nil || claims.SubjectUserID != principal.ID {
+		t.Fatalf("ValidateToken = %+v, %v", claims, err)
+	}
+
+	if err := w.MFA.DisableTOTP(ctx, principal.ID, recoveryCodes[0]); err != nil {
+		t.Fatalf("DisableTOTP error: %v", err)
+	}
+	if _, err := w.Auth.LoginPassword(ctx, cred, coreid.SessionMetadata{}); err != nil {
+		t.Fatalf("LoginPassword after disable error: %v", err)
+	}
+}
+
+func TestNewWiring_PasskeyRegistrationAndPasswordlessLogin(t *testing.T) {
+	if err := auth.ConfigureJWT("test-secret-123456"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WEBAUTHN_RP_ID", "chat.example")
+	t.Setenv("WEBAUTHN_ORIGINS", "https://chat.example")
+
+	s := newTestStore(t)
+	w := NewWiring(s)
+	ctx := context.Background()
+	principal, err := w.Auth.RegisterPassword(ctx, coreid.PasswordCredential{Username: "alice", Password: "password123"})
+	if err != nil {
+		t.Fatalf("RegisterPassword error: %v", err)
+	}
+
+	authenticator := webauthntest.New("chat.example", "https://chat.example")
+	opts, err := w.Passkeys.BeginPasskeyRegistration(ctx, principal.ID)
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration error: %v", err)
+	}
+	attestation, err := authenticator.Register(opts.Challenge, opts.UserHandle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Passkeys.FinishPasskeyRegistration(ctx, principal.ID, "security key", attestation); err != nil {
+		t.Fatalf("FinishPasskeyRegistration error: %v", err)
+	}
+
+	login, err := w.Passkeys.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin error: %v", err)
+	}
+	assertion, err := authenticator.Assert(login.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := w.Auth.Login(ctx, assertion, coreid.SessionMetadata{DeviceLabel: "phone"})
+	if err != nil {
+		t.Fatalf("Login error: %v", err)
+	}
+	if claims, err := w.Tokens.ValidateToken(ctx, tokens.AccessToken); err != nil || claims.SubjectUserID != principal.ID {
+		t.Fatalf("ValidateToken = %+v, %v", claims, err)
+	}
+
+	// A cloned authenticator replays an older counter.
+	authenticator.SetSignCount(0)
+	login, _ = w.Passkeys.BeginPasskeyLogin(ctx)
+	cloned, err := authenticator.Assert(login.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Auth.Login(ctx, cloned, coreid.SessionMetadata{}); !errors.Is(err, coreid.ErrPasskeySignCountRollback) {
+		t.Fatalf("cloned authenticator err = %v", err)
+	}
+}
+
 func TestWSHelpers_ResolveUserAndAuthenticateToken(t *testing.T) {
 	if err := auth.ConfigureJWT("test-secret-123456"); err != nil {
 		t.Fatal(err)
@@ -164,3 +276,122 @@ func TestWSHelpers_ResolveUserAndAuthenticateToken(t *testing.T) {
 		t.Fatalf("resolvedID = %d, want %d", resolvedID, userID)
 	}
 }
+
+func TestWSAuthenticator_AdmitsOnlyBotTokensWithMessageScopes(t *testing.T) {
+	s := newTestStore(t)
+	ownerID, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWiring(s)
+	ctx := context.Background()
+	bot, err := w.APITokens.CreateBot(ctx, coreid.UserID(ownerID), "oncall-bot", "On-call")
+	if err != nil {
+		t.Fatal(err)
+	}
+	both := []string{coreid.ScopeMessagesRead, coreid.ScopeMessagesSend}
+	_, botToken, err := w.APITokens.CreateAPIToken(ctx, coreid.UserID(ownerID), coreid.CreateAPITokenRequest{Name: "alerts", Scopes: both, BotID: bot.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sendOnly, err := w.APITokens.CreateAPIToken(ctx, coreid.UserID(ownerID), coreid.CreateAPITokenRequest{Name: "send", Scopes: both[1:], BotID: bot.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, personal, err := w.APITokens.CreateAPIToken(ctx, coreid.UserID(ownerID), coreid.CreateAPITokenRequest{Name: "cli", Scopes: both})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authn := WSAuthenticator(w.Tokens, s)
+	gotID, gotUsername, gotSessionID, err := authn(botToken)
+	if err != nil || gotID != int(bot.ID) || gotUsername != "oncall-bot" || gotSessionID != 0 {
+		t.Fatalf("bot authn = %d, %q, %d, %v", gotID, gotUsername, gotSessionID, err)
+	}
+	if _, _, _, err := authn(sendOnly); err == nil {
+		t.Fatal("expected a token without messages:read to be refused")
+	}
+	if _, _, _, err := authn(personal); err == nil {
+		t.Fatal("expected a personal API token to be refused")
+	}
+}
+
+func TestWiring_BackgroundLoopsRunOnlyBetweenStartAndStop(t *testing.T) {
+	s := newTestStore(t)
+	userID, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWiring(s)
+	ctx := context.Background()
+
+	export, err := w.Account.RequestExport(ctx, userID)
+	if err != nil {
+		t.Fatalf("RequestExport: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if latest, err := w.Account.LatestExport(ctx, userID); err != nil || latest.Status != coreaccount.ExportPending {
+		t.Fatalf("export ran before Start: %+v, %v", latest, err)
+	}
+
+	w.Start(ctx)
+	t.Cleanup(w.Stop)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		latest, err := w.Account.LatestExport(ctx, userID)
+		if err != nil {
+			t.Fatalf("LatestExport: %v", err)
+		}
+		if latest.ID == export.ID && latest.Status == coreaccount.ExportReady {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("export not built after Start: %+v", latest)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewWiring_PostgresLeavesOnlyListedFeaturesUnset(t *testing.T) {
+	// sql.Open does not connect, and building the wiring runs no queries.
+	db, err := sql.Open("pgx", "postgres://unused@127.0.0.1:1/unused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	w := NewWiring(&store.PostgresStore{DB: db})
+
+	v := reflect.ValueOf(w).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() || field.Type.Kind() != reflect.Interface {
+			continue
+		}
+		_, listed := postgresUnsupported[field.Name]
+		if unset := v.Field(i).IsNil(); unset != listed {
+			t.Errorf("%s: nil on Postgres = %v, listed in postgresUnsupported = %v", field.Name, unset, listed)
+		}
+	}
+}
+
+func TestCheckPostgresSupport_RequiresAcceptanceAndRefusesUnsupportedSettings(t *testing.T) {
+	t.Setenv("POSTGRES_ACCEPT_REDUCED_FEATURES", "")
+	err := CheckPostgresSupport()
+	if err == nil || !strings.Contains(err.Error(), "POSTGRES_ACCEPT_REDUCED_FEATURES=true") || !strings.Contains(err.Error(), "two-factor") {
+		t.Fatalf("without acceptance err = %v", err)
+	}
+
+	t.Setenv("POSTGRES_ACCEPT_REDUCED_FEATURES", "true")
+	if err := CheckPostgresSupport(); err != nil {
+		t.Fatalf("accepted reduced features err = %v", err)
+	}
+
+	t.Setenv("OIDC_ISSUER", "https://login.example.com")
+	t.Setenv("OIDC_CLIENT_ID", "chat")
+	t.Setenv("SMTP_ADDR", "smtp.example.com:587")
+	t.Setenv("MAIL_FROM", "chat@example.com")
+	err = CheckPostgresSupport()
+	if err == nil || !strings.Contains(err.Error(), "OIDC_ISSUER is set but single sign-on") || !strings.Contains(err.Error(), "SMTP_ADDR is set but email notifications") {
+		t.Fatalf("unsupported settings err = %v", err)
+	}
+}
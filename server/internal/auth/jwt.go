@@ -3,12 +3,20 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey []byte
+var (
+	// jwtKey is the legacy HMAC secret. With a key set configured it only
+	// verifies tokens signed before the switch to asymmetric keys, and only
+	// until legacyUntil (Unix nanoseconds; zero refuses them outright).
+	jwtKey      []byte
+	jwtKeys     atomic.Pointer[KeySet]
+	legacyUntil atomic.Int64
+)
 
 type Claims struct {
 	UserID    int    `json:"user_id"`
@@ -25,12 +33,47 @@ func ConfigureJWT(secret string) error {
 	return nil
 }
 
+// ConfigureKeySet switches new access tokens to asymmetric signing with the
+// key set's active key. Any other key in the set still verifies until its
+// NotAfter. A nil key set goes back to HMAC-only signing. It is safe to call
+// while tokens are being verified, so a reload can swap in a rotated set.
+func ConfigureKeySet(ks *KeySet) error {
+	if ks == nil {
+		jwtKeys.Store(nil)
+		return nil
+	}
+	if _, ok := ks.Active(); !ok {
+		return errors.New("key set has no active key")
+	}
+	jwtKeys.Store(ks)
+	return nil
+}
+
+// ConfigureLegacySecretUntil sets when the HMAC secret stops verifying
+// tokens without a kid once a key set is configured. The zero time refuses
+// them immediately. Without a key set the secret signs every token and this
+// has no effect.
+func ConfigureLegacySecretUntil(until time.Time) {
+	if until.IsZero() {
+		legacyUntil.Store(0)
+		return
+	}
+	legacyUntil.Store(until.UnixNano())
+}
+
+// PublicJWKS returns the public verification keys, or an empty set when
+// tokens are signed with the HMAC secret.
+func PublicJWKS() JWKS {
+	return jwtKeys.Load().JWKS(time.Now())
+}
+
 func GenerateToken(userID int) (string, error) {
 	return GenerateAccessToken(userID, 0, 24*time.Hour)
 }
 
 func GenerateAccessToken(userID int, sessionID int64, ttl time.Duration) (string, error) {
-	if len(jwtKey) == 0 {
+	active, asymmetric := jwtKeys.Load().Active()
+	if !asymmetric && len(jwtKey) == 0 {
 		return "", errors.New("jwt secret is not configured")
 	}
 	if ttl <= 0 {
@@ -49,20 +92,25 @@ func GenerateAccessToken(userID int, sessionID int64, ttl time.Duration) (string
 		},
 	}
 
+	if asymmetric {
+		token := jwt.NewWithClaims(jwt.GetSigningMethod(active.Alg), claims)
+		token.Header["kid"] = active.KID
+		return token.SignedString(active.Private)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtKey)
 }
 
 func ValidateToken(tokenStr string) (*Claims, error) {
-	if len(jwtKey) == 0 {
+	if jwtKeys.Load() == nil && len(jwtKey) == 0 {
 		return nil, errors.New("jwt secret is not configured")
 	}
 
 	claims := &Claims{}
 
-	tkn, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+	tkn, err := jwt.ParseWithClaims(tokenStr, claims, verificationKey, jwt.WithValidMethods([]string{
+		jwt.SigningMethodHS256.Alg(), AlgEdDSA, AlgES256,
+	}))
 	if err != nil {
 		if errors.Is(err, jwt.ErrSignatureInvalid) {
 			return nil, fmt.Errorf("invalid token signature")
@@ -78,3 +126,26 @@ func ValidateToken(tokenStr string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// verificationKey picks the key for a token by its kid header. Tokens
+// without a kid are legacy HMAC tokens. The header alg must match the key's
+// own algorithm so a public key can never be used as an HMAC secret.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	keys := jwtKeys.Load()
+	now := time.Now()
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if token.Method != jwt.SigningMethodHS256 || len(jwtKey) == 0 {
+			return nil, ErrUnknownSigningKey
+		}
+		if keys != nil && now.UnixNano() >= legacyUntil.Load() {
+			return nil, ErrUnknownSigningKey
+		}
+		return jwtKey, nil
+	}
+	key, ok := keys.verificationKey(kid, now)
+	if !ok || token.Method.Alg() != key.Alg {
+		return nil, ErrUnknownSigningKey
+	}
+	return key.Private.Public(), nil
+}
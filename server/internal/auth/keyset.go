@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgES256 = "ES256"
+
+	// DefaultKeyRotationWindow keeps a rotated-out key verifying long enough
+	// for every access token it signed to expire, including the 24h tokens
+	// issued without a session store.
+	DefaultKeyRotationWindow = 24 * time.Hour
+)
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKey is one asymmetric JWT key. NotAfter is zero while the key may
+// still sign; once the key is rotated out it only verifies until NotAfter.
+type SigningKey struct {
+	KID       string
+	Alg       string
+	Private   crypto.Signer
+	CreatedAt time.Time
+	NotAfter  time.Time
+}
+
+func (k SigningKey) verifiesAt(now time.Time) bool {
+	return k.NotAfter.IsZero() || now.Before(k.NotAfter)
+}
+
+// KeySet holds the key that signs new access tokens and every key that may
+// still verify older ones.
+type KeySet struct {
+	ActiveKID string
+	Keys      []SigningKey
+}
+
+// GenerateSigningKey creates a key for alg (EdDSA or ES256). The kid is the
+// RFC 7638 thumbprint of the public key.
+func GenerateSigningKey(alg string, now time.Time) (SigningKey, error) {
+	var signer crypto.Signer
+	switch alg {
+	case AlgEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		signer = priv
+	case AlgES256:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		signer = priv
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return newSigningKey(alg, signer, now.UTC())
+}
+
+func newSigningKey(alg string, signer crypto.Signer, createdAt time.Time) (SigningKey, error) {
+	jwk, err := publicJWK(alg, signer.Public())
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{
+		KID:       jwkThumbprint(jwk),
+		Alg:       alg,
+		Private:   signer,
+		CreatedAt: createdAt,
+	}, nil
+}
+
+// NewKeySet returns a key set with one freshly generated active key.
+func NewKeySet(alg string, now time.Time) (*KeySet, error) {
+	key, err := GenerateSigningKey(alg, now)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{ActiveKID: key.KID, Keys: []SigningKey{key}}, nil
+}
+
+// Rotate makes a new key active. The previous active key keeps verifying for
+// window, and keys whose window has already closed are dropped.
+func (ks *KeySet) Rotate(alg string, window time.Duration, now time.Time) (SigningKey, error) {
+	now = now.UTC()
+	if alg == "" {
+		if active, ok := ks.Active(); ok {
+			alg = active.Alg
+		} else {
+			alg = AlgEdDSA
+		}
+	}
+	next, err := GenerateSigningKey(alg, now)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	kept := make([]SigningKey, 0, len(ks.Keys)+1)
+	for _, key := range ks.Keys {
+		if key.KID == ks.ActiveKID && key.NotAfter.IsZero() {
+			key.NotAfter = now.Add(window)
+		}
+		if key.verifiesAt(now) {
+			kept = append(kept, key)
+		}
+	}
+	ks.Keys = append(kept, next)
+	ks.ActiveKID = next.KID
+	return next, nil
+}
+
+// Active returns the key that signs new tokens.
+func (ks *KeySet) Active() (SigningKey, bool) {
+	if ks == nil {
+		return SigningKey{}, false
+	}
+	for _, key := range ks.Keys {
+		if key.KID == ks.ActiveKID {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+func (ks *KeySet) verificationKey(kid string, now time.Time) (SigningKey, bool) {
+	if ks == nil {
+		return SigningKey{}, false
+	}
+	for _, key := range ks.Keys {
+		if key.KID == kid && key.verifiesAt(now) {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// JWK is the public half of a signing key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	KID string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys that verify tokens at now, active key first.
+func (ks *KeySet) JWKS(now time.Time) JWKS {
+	out := JWKS{Keys: []JWK{}}
+	if ks == nil {
+		return out
+	}
+	if active, ok := ks.Active(); ok {
+		if jwk, err := publicJWK(active.Alg, active.Private.Public()); err == nil {
+			out.Keys = append(out.Keys, withKeyMetadata(jwk, active))
+		}
+	}
+	for _, key := range ks.Keys {
+		if key.KID == ks.ActiveKID || !key.verifiesAt(now) {
+			continue
+		}
+		jwk, err := publicJWK(key.Alg, key.Private.Public())
+		if err != nil {
+			continue
+		}
+		out.Keys = append(out.Keys, withKeyMetadata(jwk, key))
+	}
+	return out
+}
+
+func withKeyMetadata(jwk JWK, key SigningKey) JWK {
+	jwk.KID = key.KID
+	jwk.Alg = key.Alg
+	jwk.Use = "sig"
+	return jwk
+}
+
+func publicJWK(alg string, pub crypto.PublicKey) (JWK, error) {
+	switch alg {
+	case AlgEdDSA:
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return JWK{}, errors.New("EdDSA key is not Ed25519")
+		}
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(key)}, nil
+	case AlgES256:
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok || key.Curve != elliptic.P256() {
+			return JWK{}, errors.New("ES256 key is not P-256")
+		}
+		raw, err := key.ECDH()
+		if err != nil {
+			return JWK{}, err
+		}
+		// Uncompressed point: 0x04 || X || Y, each 32 bytes.
+		point := raw.Bytes()
+		return JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(point[1:33]),
+			Y:   base64.RawURLEncoding.EncodeToString(point[33:]),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+}
+
+// jwkThumbprint is the RFC 7638 SHA-256 thumbprint: the required members in
+// lexicographic order with no whitespace.
+func jwkThumbprint(jwk JWK) string {
+	var canonical string
+	if jwk.Kty == "EC" {
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)
+	} else {
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Crv, jwk.Kty, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type keySetFile struct {
+	ActiveKID string         `json:"active_kid"`
+	Keys      []keyFileEntry `json:"keys"`
+}
+
+type keyFileEntry struct {
+	KID        string     `json:"kid"`
+	Alg        string     `json:"alg"`
+	PrivateKey string     `json:"private_key"`
+	CreatedAt  time.Time  `json:"created_at"`
+	NotAfter   *time.Time `json:"not_after,omitempty"`
+}
+
+// LoadKeySet reads a key set written by Save. The kid of every key is
+// recomputed so a hand-edited file cannot pair a kid with the wrong key.
+func LoadKeySet(path string) (*KeySet, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keySetFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parse key set: %w", err)
+	}
+	ks := &KeySet{ActiveKID: file.ActiveKID}
+	for _, entry := range file.Keys {
+		der, err := base64.StdEncoding.DecodeString(entry.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", entry.KID, err)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", entry.KID, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("key %s: not a signing key", entry.KID)
+		}
+		key, err := newSigningKey(entry.Alg, signer, entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", entry.KID, err)
+		}
+		if key.KID != entry.KID {
+			return nil, fmt.Errorf("key %s: kid does not match key material", entry.KID)
+		}
+		if entry.NotAfter != nil {
+			key.NotAfter = *entry.NotAfter
+		}
+		ks.Keys = append(ks.Keys, key)
+	}
+	if _, ok := ks.Active(); !ok {
+		return nil, errors.New("key set has no active key")
+	}
+	return ks, nil
+}
+
+// Save writes the key set, private keys included, readable only by the
+// owner. The file is replaced atomically so a running server never reads a
+// partial write.
+func (ks *KeySet) Save(path string) error {
+	file := keySetFile{ActiveKID: ks.ActiveKID, Keys: make([]keyFileEntry, 0, len(ks.Keys))}
+	for _, key := range ks.Keys {
+		der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+		if err != nil {
+			return err
+		}
+		entry := keyFileEntry{
+			KID:        key.KID,
+			Alg:        key.Alg,
+			PrivateKey: base64.StdEncoding.EncodeToString(der),
+			CreatedAt:  key.CreatedAt,
+		}
+		if !key.NotAfter.IsZero() {
+			notAfter := key.NotAfter
+			entry.NotAfter = &notAfter
+		}
+		file.Keys = append(file.Keys, entry)
+	}
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".jwt-keys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(raw, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useKeySet(t *testing.T, ks *KeySet) {
+	t.Helper()
+	originalKeys, originalSecret := jwtKeys.Load(), jwtKey
+	t.Cleanup(func() {
+		jwtKeys.Store(originalKeys)
+		jwtKey = originalSecret
+	})
+	jwtKey = nil
+	if err := ConfigureKeySet(ks); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tokenHeader(t *testing.T, token string) map[string]any {
+	t.Helper()
+	raw, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header map[string]any
+	if err := json.Unmarshal(raw, &header); err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestKeySet_SignsAndVerifiesWithEachAlgorithm(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgES256} {
+		t.Run(alg, func(t *testing.T) {
+			ks, err := NewKeySet(alg, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			useKeySet(t, ks)
+
+			token, err := GenerateAccessToken(3, 9, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := tokenHeader(t, token)
+			if header["alg"] != alg || header["kid"] != ks.ActiveKID {
+				t.Fatalf("header = %v, want alg %s kid %s", header, alg, ks.ActiveKID)
+			}
+			claims, err := ValidateToken(token)
+			if err != nil {
+				t.Fatalf("ValidateToken error: %v", err)
+			}
+			if claims.UserID != 3 || claims.SessionID != 9 {
+				t.Fatalf("claims = %+v", claims)
+			}
+
+			jwks := PublicJWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KID != ks.ActiveKID || jwks.Keys[0].Alg != alg || jwks.Keys[0].Use != "sig" {
+				t.Fatalf("jwks = %+v", jwks)
+			}
+		})
+	}
+}
+
+func TestKeySet_RotationKeepsOldKeyVerifyingForWindow(t *testing.T) {
+	now := time.Now()
+	ks, err := NewKeySet(AlgEdDSA, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useKeySet(t, ks)
+	oldKID := ks.ActiveKID
+	oldToken, err := GenerateAccessToken(1, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := ks.Rotate(AlgES256, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.ActiveKID != next.KID || next.KID == oldKID {
+		t.Fatalf("active kid = %s, old %s, next %s", ks.ActiveKID, oldKID, next.KID)
+	}
+	newToken, err := GenerateAccessToken(1, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenHeader(t, newToken)["kid"] != next.KID {
+		t.Fatal("expected new tokens to be signed by the rotated key")
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := ValidateToken(token); err != nil {
+			t.Fatalf("ValidateToken during rotation window: %v", err)
+		}
+	}
+	if jwks := PublicJWKS(); len(jwks.Keys) != 2 || jwks.Keys[0].KID != next.KID {
+		t.Fatalf("jwks during window = %+v", jwks)
+	}
+
+	// Rotating again after the window drops the first key entirely.
+	if _, err := ks.Rotate("", time.Hour, now.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.Keys) != 2 {
+		t.Fatalf("keys after second rotation = %d, want 2", len(ks.Keys))
+	}
+	if _, err := ValidateToken(oldToken); err == nil {
+		t.Fatal("expected token signed by a dropped key to fail")
+	}
+	if active, _ := ks.Active(); active.Alg != AlgES256 {
+		t.Fatalf("rotate without alg used %s, want the active key's ES256", active.Alg)
+	}
+}
+
+func TestKeySet_LegacyHMACTokensVerifyUntilCutoff(t *testing.T) {
+	if err := ConfigureJWT("test-secret-123456"); err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := GenerateToken(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := NewKeySet(AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalKeys := jwtKeys.Load()
+	t.Cleanup(func() { jwtKeys.Store(originalKeys) })
+	if err := ConfigureKeySet(ks); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ConfigureLegacySecretUntil(time.Time{}) })
+
+	if _, err := ValidateToken(legacy); err == nil {
+		t.Fatal("legacy token verified with a key set and no cutoff")
+	}
+	ConfigureLegacySecretUntil(time.Now().Add(time.Hour))
+	if _, err := ValidateToken(legacy); err != nil {
+		t.Fatalf("legacy HMAC token should verify before the cutoff: %v", err)
+	}
+	ConfigureLegacySecretUntil(time.Now().Add(-time.Second))
+	if _, err := ValidateToken(legacy); err == nil {
+		t.Fatal("legacy token verified after the cutoff")
+	}
+
+	// Without a key set the secret signs every token, so there is no cutoff.
+	jwtKeys.Store(nil)
+	if _, err := ValidateToken(legacy); err != nil {
+		t.Fatalf("HMAC-only token should verify: %v", err)
+	}
+	ConfigureLegacySecretUntil(time.Now().Add(time.Hour))
+	if err := ConfigureKeySet(ks); err != nil {
+		t.Fatal(err)
+	}
+	jwtKey = nil
+	t.Cleanup(func() { _ = ConfigureJWT("test-secret-123456") })
+	if _, err := ValidateToken(legacy); err == nil {
+		t.Fatal("expected legacy token to fail once the HMAC secret is removed")
+	}
+}
+
+func TestKeySet_RejectsForgedHeaders(t *testing.T) {
+	ks, err := NewKeySet(AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	useKeySet(t, ks)
+	token, err := GenerateAccessToken(1, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	for name, header := range map[string]string{
+		"unknown kid":  `{"alg":"EdDSA","kid":"nope","typ":"JWT"}`,
+		"alg mismatch": `{"alg":"ES256","kid":"` + ks.ActiveKID + `","typ":"JWT"}`,
+		"hmac no kid":  `{"alg":"HS256","typ":"JWT"}`,
+	} {
+		forged := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + parts[1] + "." + parts[2]
+		if _, err := ValidateToken(forged); err == nil {
+			t.Fatalf("%s: expected validation to fail", name)
+		}
+	}
+}
+
+func TestKeySet_SaveAndLoadRoundTrip(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	ks, err := NewKeySet(AlgEdDSA, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Rotate(AlgES256, time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt-keys.json")
+	if err := ks.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("key file mode = %o, want 600", perm)
+	}
+
+	loaded, err := LoadKeySet(path)
+	if err != nil {
+		t.Fatalf("LoadKeySet error: %v", err)
+	}
+	if loaded.ActiveKID != ks.ActiveKID || len(loaded.Keys) != 2 {
+		t.Fatalf("loaded = %+v", loaded)
+	}
+	if !loaded.Keys[0].NotAfter.Equal(now.Add(time.Hour)) || !loaded.Keys[1].NotAfter.IsZero() {
+		t.Fatalf("not_after = %v / %v", loaded.Keys[0].NotAfter, loaded.Keys[1].NotAfter)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Point both active_kid and the key entry at a kid the key does not hash to.
+	tampered := strings.ReplaceAll(string(raw), ks.ActiveKID, "swapped-kid")
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKeySet(path); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("mismatched kid error = %v", err)
+	}
+}
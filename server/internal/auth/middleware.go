@@ -16,7 +16,10 @@ type AccessTokenService interface {
 	TouchSession(ctx context.Context, sessionID int64, meta coreid.SessionMetadata) error
 }
 
-func Middleware(tokens AccessTokenService) func(http.Handler) http.Handler {
+// Middleware authenticates the bearer token. Session tokens may use every
+// route. API tokens must hold every scope in scopes, and are refused when the
+// route declares none, so routes stay closed to them unless opted in.
+func Middleware(tokens AccessTokenService, scopes ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -41,6 +44,24 @@ func Middleware(tokens AccessTokenService) func(http.Handler) http.Handler {
 				return
 			}
 
+			if claims.APITokenID > 0 {
+				if missing, ok := missingScope(claims, scopes); !ok {
+					LogSecurityEvent("auth_api_token_scope_denied", map[string]any{
+						"request_id":   r.Header.Get("X-Request-ID"),
+						"user_id":      int(claims.SubjectUserID),
+						"api_token_id": claims.APITokenID,
+						"path":         r.URL.Path,
+						"scope":        missing,
+					})
+					if missing == "" {
+						web.JSONError(w, errors.New("this route requires a signed-in session"), http.StatusForbidden)
+					} else {
+						web.JSONError(w, errors.New("token lacks scope "+missing), http.StatusForbidden)
+					}
+					return
+				}
+			}
+
 			if claims.SessionID > 0 {
 				_ = tokens.TouchSession(r.Context(), claims.SessionID, coreid.SessionMetadata{
 					UserAgent: r.UserAgent(),
@@ -57,6 +78,20 @@ func Middleware(tokens AccessTokenService) func(http.Handler) http.Handler {
 	}
 }
 
+// missingScope returns the first required scope the token lacks, or "" with
+// ok false when the route takes no API tokens at all.
+func missingScope(claims coreid.TokenClaims, scopes []string) (string, bool) {
+	if len(scopes) == 0 {
+		return "", false
+	}
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			return scope, false
+		}
+	}
+	return "", true
+}
+
 func clientIPFromRequest(r *http.Request) string {
 	if xff := strings.TrimSpace(r.Header.Get("X-Forwarded-For")); xff != "" {
 		parts := strings.Split(xff, ",")
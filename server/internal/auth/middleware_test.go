@@ -134,3 +134,36 @@ func TestMiddleware_PropagatesNextErrorPath(t *testing.T) {
 		t.Fatalf("status = %d, want 418", rr.Code)
 	}
 }
+
+func TestMiddleware_EnforcesAPITokenScopes(t *testing.T) {
+	tokens := &fakeAccessTokenService{claims: coreid.TokenClaims{SubjectUserID: 9, APITokenID: 3, Scopes: []string{"messages:read"}}}
+	serve := func(scopes ...string) int {
+		called := false
+		h := Middleware(tokens, scopes...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/api/messages/inbox", nil)
+		req.Header.Set("Authorization", "Bearer gcs_token")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if called != (rr.Code == http.StatusOK) {
+			t.Fatalf("status = %d but next called = %v", rr.Code, called)
+		}
+		return rr.Code
+	}
+
+	if code := serve("messages:read"); code != http.StatusOK {
+		t.Fatalf("granted scope status = %d, want 200", code)
+	}
+	if code := serve("messages:read", "messages:send"); code != http.StatusForbidden {
+		t.Fatalf("missing scope status = %d, want 403", code)
+	}
+	if code := serve(); code != http.StatusForbidden {
+		t.Fatalf("route without scopes status = %d, want 403", code)
+	}
+
+	tokens.claims = coreid.TokenClaims{SubjectUserID: 9, SessionID: 4}
+	if code := serve("wallet:read"); code != http.StatusOK {
+		t.Fatalf("session token on scoped route status = %d, want 200", code)
+	}
+}
@@ -0,0 +1,309 @@
+// Package backup takes consistent copies of the SQLite database while the
+// server is running, describes each with a checksummed manifest, restores
+// them, and rotates old copies under a retention policy.
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("backup file does not match its manifest")
+	ErrCheckFailed      = errors.New("database failed its integrity check")
+)
+
+const (
+	manifestSuffix = ".manifest.json"
+	manifestFormat = 1
+
+	// pagesPerStep bounds how long each backup step holds the source read
+	// lock, so the server's writers are only paused briefly.
+	pagesPerStep = 256
+	stepPause    = 5 * time.Millisecond
+)
+
+// Manifest describes one backup. It is written next to the files it lists.
+type Manifest struct {
+	Format        int       `json:"format"`
+	CreatedAt     time.Time `json:"created_at"`
+	Source        string    `json:"source"`
+	SchemaVersion string    `json:"schema_version"`
+	Files         []File    `json:"files"`
+	Check         Report    `json:"check"`
+
+	// Path is where the manifest was read from or written to.
+	Path string `json:"-"`
+}
+
+// File is one file of a backup, named relative to its manifest.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Create copies the database at dbPath into dir with the SQLite online
+// backup API, checks the copy, and writes its manifest. Writers on the
+// source are only blocked for one step at a time.
+func Create(ctx context.Context, dbPath, dir string, now time.Time) (Manifest, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return Manifest{}, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return Manifest{}, err
+	}
+	now = now.UTC()
+	base := "chat-" + now.Format("20060102T150405Z")
+	dbName := base + ".db"
+	manifestPath := filepath.Join(dir, base+manifestSuffix)
+	if _, err := os.Stat(manifestPath); err == nil {
+		return Manifest{}, fmt.Errorf("backup %s already exists", base)
+	}
+
+	partial := filepath.Join(dir, dbName+".partial")
+	_ = os.Remove(partial)
+	if err := copyDatabase(ctx, dbPath, partial, pagesPerStep); err != nil {
+		_ = os.Remove(partial)
+		return Manifest{}, err
+	}
+	if err := os.Chmod(partial, 0o600); err != nil {
+		_ = os.Remove(partial)
+		return Manifest{}, err
+	}
+
+	report, err := Check(ctx, partial)
+	if err == nil && !report.OK() {
+		err = fmt.Errorf("%w: %s", ErrCheckFailed, report.Summary())
+	}
+	if err != nil {
+		_ = os.Remove(partial)
+		return Manifest{}, err
+	}
+	version, err := schemaVersion(ctx, partial)
+	if err != nil {
+		_ = os.Remove(partial)
+		return Manifest{}, err
+	}
+	if err := os.Rename(partial, filepath.Join(dir, dbName)); err != nil {
+		_ = os.Remove(partial)
+		return Manifest{}, err
+	}
+
+	file, err := describeFile(dir, dbName)
+	if err != nil {
+		return Manifest{}, err
+	}
+	source, err := filepath.Abs(dbPath)
+	if err != nil {
+		source = dbPath
+	}
+	manifest := Manifest{
+		Format:        manifestFormat,
+		CreatedAt:     now,
+		Source:        source,
+		SchemaVersion: version,
+		Files:         []File{file},
+		Check:         report,
+		Path:          manifestPath,
+	}
+	if err := writeManifest(manifest); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, nil
+}
+
+// Verify re-hashes every file a manifest lists.
+func Verify(manifest Manifest) error {
+	dir := filepath.Dir(manifest.Path)
+	for _, want := range manifest.Files {
+		if filepath.Base(want.Name) != want.Name {
+			return fmt.Errorf("manifest %s names a file outside its directory", manifest.Path)
+		}
+		got, err := describeFile(dir, want.Name)
+		if err != nil {
+			return err
+		}
+		if got.Size != want.Size || got.SHA256 != want.SHA256 {
+			return fmt.Errorf("%w: %s", ErrChecksumMismatch, want.Name)
+		}
+	}
+	return nil
+}
+
+// Restore replaces the database at dbPath with the backup described by the
+// manifest at manifestPath, after verifying its checksum and integrity. The
+// copy goes through the backup API, so connections that still have dbPath
+// open see the restored content rather than a torn file.
+func Restore(ctx context.Context, manifestPath, dbPath string) (Report, error) {
+	manifest, err := ReadManifest(manifestPath)
+	if err != nil {
+		return Report{}, err
+	}
+	if err := Verify(manifest); err != nil {
+		return Report{}, err
+	}
+	src, err := manifest.databaseFile()
+	if err != nil {
+		return Report{}, err
+	}
+	report, err := Check(ctx, src)
+	if err != nil {
+		return Report{}, err
+	}
+	if !report.OK() {
+		return report, fmt.Errorf("%w: %s", ErrCheckFailed, report.Summary())
+	}
+
+	if err := copyDatabase(ctx, src, dbPath, -1); err != nil {
+		return Report{}, err
+	}
+	report, err = Check(ctx, dbPath)
+	if err != nil {
+		return Report{}, err
+	}
+	if !report.OK() {
+		return report, fmt.Errorf("%w after restore: %s", ErrCheckFailed, report.Summary())
+	}
+	return report, nil
+}
+
+// ReadManifest loads a manifest written by Create.
+func ReadManifest(path string) (Manifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	if manifest.Format != manifestFormat {
+		return Manifest{}, fmt.Errorf("manifest %s has unsupported format %d", path, manifest.Format)
+	}
+	manifest.Path = path
+	return manifest, nil
+}
+
+func (m Manifest) databaseFile() (string, error) {
+	for _, file := range m.Files {
+		if strings.HasSuffix(file.Name, ".db") && filepath.Base(file.Name) == file.Name {
+			return filepath.Join(filepath.Dir(m.Path), file.Name), nil
+		}
+	}
+	return "", fmt.Errorf("manifest %s lists no database file", m.Path)
+}
+
+func writeManifest(manifest Manifest) error {
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	partial := manifest.Path + ".partial"
+	if err := os.WriteFile(partial, append(raw, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(partial, manifest.Path)
+}
+
+func describeFile(dir, name string) (File, error) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Name: name, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// copyDatabase copies src into dst page by page, pages at a time (-1 for
+// all at once). A busy or locked source is retried, and a source written
+// mid-copy makes SQLite restart the copy, so the result is always a
+// consistent snapshot.
+func copyDatabase(ctx context.Context, src, dst string, pages int) error {
+	srcDB, err := sql.Open("sqlite3", readOnlyDSN(src))
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+	dstDB, err := sql.Open("sqlite3", dst)
+	if err != nil {
+		return err
+	}
+	defer dstDB.Close()
+
+	srcConn, err := srcDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	dstConn, err := dstDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(dstRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			to, ok := dstRaw.(*sqlite3.SQLiteConn)
+			from, ok2 := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("backup needs the sqlite3 driver")
+			}
+			b, err := to.Backup("main", from, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := b.Step(pages)
+				if err != nil {
+					_ = b.Finish()
+					return fmt.Errorf("backup step: %w", err)
+				}
+				if done {
+					return b.Finish()
+				}
+				select {
+				case <-ctx.Done():
+					_ = b.Finish()
+					return ctx.Err()
+				case <-time.After(stepPause):
+				}
+			}
+		})
+	})
+}
+
+func readOnlyDSN(path string) string {
+	return "file:" + path + "?mode=ro"
+}
+
+func schemaVersion(ctx context.Context, path string) (string, error) {
+	db, err := sql.Open("sqlite3", readOnlyDSN(path))
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	var version sql.NullString
+	err = db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if err != nil && strings.Contains(err.Error(), "no such table") {
+		return "", nil
+	}
+	return version.String, err
+}
@@ -0,0 +1,239 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+	"github.com/kyambuthia/go-chat-site/server/migrations"
+)
+
+func newLiveStore(t *testing.T) (*store.SqliteStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chat.db")
+	s, err := store.NewSqliteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.Apply(s.DB, migrations.SQLite(), dialect.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	alice, err := s.CreateUser("alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.CreateUser("bob", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetWallet(alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DB.Exec(`UPDATE wallet_accounts SET balance_cents = 1000 WHERE user_id = ?`, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SendMoney(alice, bob, 300); err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	s, path := newLiveStore(t)
+	dir := filepath.Join(t.TempDir(), "backups")
+	ctx := context.Background()
+
+	manifest, err := Create(ctx, path, dir, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.SchemaVersion == "" || len(manifest.Files) != 1 || !manifest.Check.OK() ||
+		manifest.Check.Accounts != 2 || manifest.Check.Transfers != 1 || manifest.Check.TotalBalanceCents != 1000 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+	if filepath.Base(manifest.Path) != "chat-20260301T120000Z.manifest.json" {
+		t.Fatalf("manifest path = %s", manifest.Path)
+	}
+	info, err := os.Stat(filepath.Join(dir, manifest.Files[0].Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("backup mode = %v, want 0600", info.Mode().Perm())
+	}
+	read, err := ReadManifest(manifest.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(read); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(ctx, path, dir, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatal("expected a second backup in the same second to be refused")
+	}
+
+	if _, err := s.CreateUser("carol", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Restore(ctx, manifest.Path, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.TotalBalanceCents != 1000 {
+		t.Fatalf("restore report = %+v", report)
+	}
+	// The server's still-open handle sees the restored content.
+	if _, err := s.GetUserByUsername("carol"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("carol after restore: err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetUserByUsername("alice"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreate_WhileServerWrites(t *testing.T) {
+	s, path := newLiveStore(t)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := s.DB.Exec(`INSERT INTO users (username, password_hash) VALUES (?, 'x')`, fmt.Sprintf("writer%d", i)); err != nil && !strings.Contains(err.Error(), "locked") {
+				t.Errorf("writer: %v", err)
+				return
+			}
+		}
+	}()
+
+	manifest, err := Create(context.Background(), path, t.TempDir(), time.Now())
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !manifest.Check.OK() {
+		t.Fatalf("check = %+v", manifest.Check)
+	}
+}
+
+func TestRestore_RefusesTamperedBackup(t *testing.T) {
+	_, path := newLiveStore(t)
+	dir := t.TempDir()
+	manifest, err := Create(context.Background(), path, dir, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, manifest.Files[0].Name)
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)-1] ^= 0xff
+	if err := os.WriteFile(file, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(t.TempDir(), "restored.db")
+	if _, err := Restore(context.Background(), manifest.Path, target); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("restore error = %v, want ErrChecksumMismatch", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatal("tampered backup must not be restored")
+	}
+}
+
+func TestCheck_ReportsLedgerProblems(t *testing.T) {
+	s, path := newLiveStore(t)
+	bob, err := s.GetUserByUsername("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bob received 300 but now holds less without ever sending anything.
+	if _, err := s.DB.Exec(`UPDATE wallet_accounts SET balance_cents = 100 WHERE user_id = ?`, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Check(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || len(report.LedgerProblems) != 1 || !strings.Contains(report.LedgerProblems[0], "200 cents short") {
+		t.Fatalf("report = %+v", report)
+	}
+	if _, err := Create(context.Background(), path, t.TempDir(), time.Now()); !errors.Is(err, ErrCheckFailed) {
+		t.Fatalf("backup error = %v, want ErrCheckFailed", err)
+	}
+}
+
+func TestPrune_AppliesRetentionPolicy(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 3, 2, 6, 0, 0, 0, time.UTC) // a Monday
+	// Two backups a day for 21 days.
+	var created []time.Time
+	for day := 0; day < 21; day++ {
+		for _, hour := range []int{0, 12} {
+			at := start.AddDate(0, 0, day).Add(time.Duration(hour) * time.Hour)
+			created = append(created, at)
+			name := "chat-" + at.Format("20060102T150405Z")
+			if err := os.WriteFile(filepath.Join(dir, name+".db"), []byte("x"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeManifest(Manifest{Format: manifestFormat, CreatedAt: at, Files: []File{{Name: name + ".db"}}, Path: filepath.Join(dir, name+manifestSuffix)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if _, err := Prune(dir, Policy{}); err == nil {
+		t.Fatal("expected a policy keeping nothing to be refused")
+	}
+	removed, err := Prune(dir, Policy{KeepLast: 3, KeepDaily: 4, KeepWeekly: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	left, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []time.Time
+	for _, manifest := range left {
+		kept = append(kept, manifest.CreatedAt)
+	}
+	newest := created[len(created)-1]
+	want := []time.Time{
+		newest, // last 3, also today's daily and this week's weekly
+		newest.Add(-12 * time.Hour),
+		newest.Add(-24 * time.Hour),                   // last 3, also yesterday's daily
+		newest.AddDate(0, 0, -2),                      // daily
+		newest.AddDate(0, 0, -3),                      // daily
+		time.Date(2026, 3, 15, 18, 0, 0, 0, time.UTC), // newest of the previous ISO week
+		time.Date(2026, 3, 8, 18, 0, 0, 0, time.UTC),  // and the one before
+	}
+	if len(kept) != len(want) || len(removed) != len(created)-len(want) {
+		t.Fatalf("kept %v, removed %d", kept, len(removed))
+	}
+	for i := range want {
+		if !kept[i].Equal(want[i]) {
+			t.Fatalf("kept[%d] = %v, want %v", i, kept[i], want[i])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.Base(removed[0].Files[0].Name))); !os.IsNotExist(err) {
+		t.Fatal("pruned backup file still exists")
+	}
+}
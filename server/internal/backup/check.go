@@ -0,0 +1,174 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// maxProblems caps how many ledger problems a report lists.
+const maxProblems = 50
+
+// Report is the result of Check.
+type Report struct {
+	Integrity            []string `json:"integrity"`
+	ForeignKeyViolations int      `json:"foreign_key_violations"`
+	LedgerProblems       []string `json:"ledger_problems,omitempty"`
+	Accounts             int      `json:"accounts"`
+	Transfers            int      `json:"transfers"`
+	TotalBalanceCents    int64    `json:"total_balance_cents"`
+}
+
+// OK reports whether every check passed.
+func (r Report) OK() bool {
+	return len(r.Integrity) == 1 && r.Integrity[0] == "ok" && r.ForeignKeyViolations == 0 && len(r.LedgerProblems) == 0
+}
+
+// Summary is a one-line description of what failed, or "ok".
+func (r Report) Summary() string {
+	if r.OK() {
+		return "ok"
+	}
+	var parts []string
+	if len(r.Integrity) != 1 || r.Integrity[0] != "ok" {
+		parts = append(parts, "integrity_check: "+strings.Join(r.Integrity, "; "))
+	}
+	if r.ForeignKeyViolations > 0 {
+		parts = append(parts, fmt.Sprintf("%d foreign key violations", r.ForeignKeyViolations))
+	}
+	if len(r.LedgerProblems) > 0 {
+		parts = append(parts, "ledger: "+strings.Join(r.LedgerProblems, "; "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Check opens the database at path read-only and runs PRAGMA
+// integrity_check, PRAGMA foreign_key_check, and the ledger checks. A
+// database that fails a check returns a report that is not OK; the error
+// is for databases that cannot be checked at all.
+func Check(ctx context.Context, path string) (Report, error) {
+	db, err := sql.Open("sqlite3", readOnlyDSN(path))
+	if err != nil {
+		return Report{}, err
+	}
+	defer db.Close()
+
+	var report Report
+	if report.Integrity, err = queryStrings(ctx, db, `PRAGMA integrity_check`); err != nil {
+		return Report{}, fmt.Errorf("integrity_check: %w", err)
+	}
+	rows, err := db.QueryContext(ctx, `PRAGMA foreign_key_check`)
+	if err != nil {
+		return Report{}, fmt.Errorf("foreign_key_check: %w", err)
+	}
+	for rows.Next() {
+		report.ForeignKeyViolations++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Report{}, fmt.Errorf("foreign_key_check: %w", err)
+	}
+
+	var ledgerTables int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('wallet_accounts', 'wallet_transfers')`).Scan(&ledgerTables); err != nil {
+		return Report{}, err
+	}
+	if ledgerTables == 2 {
+		if err := checkLedger(ctx, db, &report); err != nil {
+			return Report{}, fmt.Errorf("ledger check: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// checkLedger verifies what the wallet tables can prove on their own.
+// Balances are funded outside the transfer log, so an account's opening
+// balance is implied: balance + sent - received. It can never be negative,
+// or money arrived in the account that its transfers do not explain going
+// out of it.
+func checkLedger(ctx context.Context, db *sql.DB, report *Report) error {
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(balance_cents), 0) FROM wallet_accounts`).Scan(&report.Accounts, &report.TotalBalanceCents); err != nil {
+		return err
+	}
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM wallet_transfers`).Scan(&report.Transfers); err != nil {
+		return err
+	}
+
+	checks := []struct {
+		query  string
+		format func(a, b, c int64) string
+	}{
+		{
+			`SELECT user_id, balance_cents, 0 FROM wallet_accounts WHERE balance_cents < 0 ORDER BY user_id LIMIT ?`,
+			func(user, balance, _ int64) string {
+				return fmt.Sprintf("user %d has a negative balance of %d cents", user, balance)
+			},
+		},
+		{
+			`SELECT id, amount_cents, sender_user_id FROM wallet_transfers
+			 WHERE amount_cents <= 0 OR sender_user_id = recipient_user_id ORDER BY id LIMIT ?`,
+			func(id, amount, _ int64) string {
+				return fmt.Sprintf("transfer %d is invalid (amount %d cents or sent to self)", id, amount)
+			},
+		},
+		{
+			`SELECT t.id, t.sender_user_id, t.recipient_user_id FROM wallet_transfers t
+			 WHERE NOT EXISTS (SELECT 1 FROM wallet_accounts a WHERE a.user_id = t.sender_user_id)
+			    OR NOT EXISTS (SELECT 1 FROM wallet_accounts a WHERE a.user_id = t.recipient_user_id)
+			 ORDER BY t.id LIMIT ?`,
+			func(id, sender, recipient int64) string {
+				return fmt.Sprintf("transfer %d between users %d and %d has no wallet account", id, sender, recipient)
+			},
+		},
+		{
+			`SELECT a.user_id, a.balance_cents,
+			        a.balance_cents
+			        + COALESCE((SELECT SUM(amount_cents) FROM wallet_transfers WHERE sender_user_id = a.user_id), 0)
+			        - COALESCE((SELECT SUM(amount_cents) FROM wallet_transfers WHERE recipient_user_id = a.user_id), 0) AS opening
+			 FROM wallet_accounts a
+			 WHERE opening < 0 ORDER BY a.user_id LIMIT ?`,
+			func(user, balance, opening int64) string {
+				return fmt.Sprintf("user %d balance of %d cents is %d cents short of what its transfers account for", user, balance, -opening)
+			},
+		},
+	}
+	for _, check := range checks {
+		rows, err := db.QueryContext(ctx, check.query, maxProblems)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var a, b, c int64
+			if err := rows.Scan(&a, &b, &c); err != nil {
+				rows.Close()
+				return err
+			}
+			if len(report.LedgerProblems) < maxProblems {
+				report.LedgerProblems = append(report.LedgerProblems, check.format(a, b, c))
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func queryStrings(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
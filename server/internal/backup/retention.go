@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Policy decides which backups Prune keeps: the newest KeepLast, plus the
+// newest backup of each of the most recent KeepDaily days and KeepWeekly
+// ISO weeks that have one. Days and weeks are in UTC.
+type Policy struct {
+	KeepLast   int
+	KeepDaily  int
+	KeepWeekly int
+}
+
+// List returns the backups in dir, newest first. Unreadable manifests are
+// an error rather than skipped, so Prune never deletes around them.
+func List(dir string) ([]Manifest, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+manifestSuffix))
+	if err != nil {
+		return nil, err
+	}
+	manifests := make([]Manifest, 0, len(paths))
+	for _, path := range paths {
+		manifest, err := ReadManifest(path)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].CreatedAt.After(manifests[j].CreatedAt)
+	})
+	return manifests, nil
+}
+
+// Prune deletes the backups in dir that policy does not keep, and returns
+// the manifests it deleted.
+func Prune(dir string, policy Policy) ([]Manifest, error) {
+	if policy.KeepLast < 1 {
+		return nil, errors.New("retention policy must keep at least the newest backup")
+	}
+	manifests, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make([]bool, len(manifests))
+	days := map[string]bool{}
+	weeks := map[string]bool{}
+	for i, manifest := range manifests {
+		if i < policy.KeepLast {
+			keep[i] = true
+		}
+		day := manifest.CreatedAt.UTC().Format("2006-01-02")
+		if !days[day] && len(days) < policy.KeepDaily {
+			days[day] = true
+			keep[i] = true
+		}
+		year, week := manifest.CreatedAt.UTC().ISOWeek()
+		weekKey := fmt.Sprintf("%d-%02d", year, week)
+		if !weeks[weekKey] && len(weeks) < policy.KeepWeekly {
+			weeks[weekKey] = true
+			keep[i] = true
+		}
+	}
+
+	var removed []Manifest
+	for i, manifest := range manifests {
+		if keep[i] {
+			continue
+		}
+		if err := remove(manifest); err != nil {
+			return removed, err
+		}
+		removed = append(removed, manifest)
+	}
+	return removed, nil
+}
+
+// remove deletes the manifest last, so an interrupted prune leaves a
+// manifest whose files are missing rather than files nothing describes.
+func remove(manifest Manifest) error {
+	dir := filepath.Dir(manifest.Path)
+	for _, file := range manifest.Files {
+		if filepath.Base(file.Name) != file.Name || strings.HasPrefix(file.Name, ".") {
+			return fmt.Errorf("manifest %s names a file outside its directory", manifest.Path)
+		}
+		if err := os.Remove(filepath.Join(dir, file.Name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Remove(manifest.Path)
+}
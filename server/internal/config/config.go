@@ -0,0 +1,585 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EnvConfigFile   = "CONFIG_FILE"
+	EnvPort         = "PORT"
+	EnvJWTSecret    = "JWT_SECRET"
+	EnvDatabasePath = "DATABASE_PATH"
+	EnvLogPath      = "LOG_PATH"
+	EnvShutdownSecs = "SHUTDOWN_TIMEOUT_SECONDS"
+)
+
+const redacted = "[redacted]"
+
+// minInviteLinkSecretLen keeps invite link signatures from resting on a
+// guessable key.
+const minInviteLinkSecretLen = 32
+
+// Config is the server configuration. Load builds it from defaults, an
+// optional JSON file, and then environment variables, so an env var always
+// wins over the file.
+type Config struct {
+	Server     ServerConfig    `json:"server"`
+	Auth       AuthConfig      `json:"auth"`
+	RateLimits RateLimitConfig `json:"rate_limits"`
+	WebSocket  WebSocketConfig `json:"websocket"`
+	Messaging  MessagingConfig `json:"messaging"`
+	OIDC       OIDCConfig      `json:"oidc"`
+	Webhooks   WebhookConfig   `json:"webhooks"`
+	WebPush    WebPushConfig   `json:"webpush"`
+	Mail       MailConfig      `json:"mail"`
+
+	// root is the directory relative paths were resolved against, kept so a
+	// reload resolves them the same way.
+	root string
+}
+
+type ServerConfig struct {
+	Port int `json:"port"`
+	// DatabasePath and LogPath are relative to the project root unless
+	// absolute. DatabasePath is ignored when DatabaseURL is set.
+	DatabasePath string `json:"database_path"`
+	LogPath      string `json:"log_path"`
+	DatabaseURL  string `json:"database_url"`
+	// ShutdownTimeoutSeconds bounds how long a stop waits for requests to
+	// finish and WebSockets to drain before closing them abruptly.
+	ShutdownTimeoutSeconds int `json:"shutdown_timeout_seconds"`
+	// PostgresAcceptReducedFeatures acknowledges that the PostgreSQL backend
+	// runs without the features that have no Postgres adapter yet.
+	PostgresAcceptReducedFeatures bool `json:"postgres_accept_reduced_features"`
+}
+
+type AuthConfig struct {
+	JWTSecret                   string   `json:"jwt_secret"`
+	JWTKeysPath                 string   `json:"jwt_keys_path"`
+	AccessTokenTTLMinutes       int      `json:"access_token_ttl_minutes"`
+	RefreshTokenTTLHours        int      `json:"refresh_token_ttl_hours"`
+	LoginLockoutThreshold       int      `json:"login_lockout_threshold"`
+	LoginLockoutWindowMinutes   int      `json:"login_lockout_window_minutes"`
+	LoginLockoutDurationMinutes int      `json:"login_lockout_duration_minutes"`
+	TOTPIssuer                  string   `json:"totp_issuer"`
+	WebAuthnRPID                string   `json:"webauthn_rp_id"`
+	WebAuthnRPName              string   `json:"webauthn_rp_name"`
+	WebAuthnOrigins             []string `json:"webauthn_origins"`
+	PasswordResetLogPath        string   `json:"password_reset_log_path"`
+	PasswordResetURL            string   `json:"password_reset_url"`
+	// InviteLinkSecret signs invite link codes. Invite links are disabled
+	// while it is empty.
+	InviteLinkSecret string `json:"invite_link_secret"`
+	// JWTLegacySecretUntil (RFC 3339) bounds how long JWT_SECRET still
+	// verifies kid-less tokens after the switch to a key set. It may be at
+	// most one refresh token TTL away; when empty they are refused.
+	JWTLegacySecretUntil string `json:"jwt_legacy_secret_until"`
+}
+
+// RateLimitConfig and WebSocketConfig are the sections Reload applies to a
+// running server.
+type RateLimitConfig struct {
+	LoginPerMinute         int `json:"login_per_minute"`
+	LoginUserPerMinute     int `json:"login_user_per_minute"`
+	RefreshPerMinute       int `json:"refresh_per_minute"`
+	WSHandshakePerMinute   int `json:"ws_handshake_per_minute"`
+	WSMessagePerMinute     int `json:"ws_message_per_minute"`
+	WSMessageBurst         int `json:"ws_message_burst"`
+	WSUserMessagePerMinute int `json:"ws_user_message_per_minute"`
+	WSUserMessageBurst     int `json:"ws_user_message_burst"`
+	WSMaxViolations        int `json:"ws_max_violations"`
+	UserSearchPerMinute    int `json:"user_search_per_minute"`
+}
+
+type WebSocketConfig struct {
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+type MessagingConfig struct {
+	StorePlaintextWhenEncrypted bool   `json:"store_plaintext_when_encrypted"`
+	CiphertextRetentionDays     int    `json:"ciphertext_retention_days"`
+	AttachmentsDir              string `json:"attachments_dir"`
+	AttachmentMaxBytes          int64  `json:"attachment_max_bytes"`
+	AttachmentUserQuotaBytes    int64  `json:"attachment_user_quota_bytes"`
+}
+
+type OIDCConfig struct {
+	Issuer              string   `json:"issuer"`
+	ClientID            string   `json:"client_id"`
+	ClientSecret        string   `json:"client_secret"`
+	RedirectURL         string   `json:"redirect_url"`
+	Scopes              []string `json:"scopes"`
+	AutoCreate          bool     `json:"auto_create"`
+	AllowedEmailDomains []string `json:"allowed_email_domains"`
+	TrustProviderMFA    bool     `json:"trust_provider_mfa"`
+}
+
+type WebhookConfig struct {
+	AllowPrivateTargets bool `json:"allow_private_targets"`
+	MaxAttempts         int  `json:"max_attempts"`
+}
+
+type WebPushConfig struct {
+	VAPIDPrivateKey     string `json:"vapid_private_key"`
+	VAPIDSubject        string `json:"vapid_subject"`
+	AllowPrivateTargets bool   `json:"allow_private_targets"`
+	MaxAttempts         int    `json:"max_attempts"`
+}
+
+type MailConfig struct {
+	SMTPAddr       string `json:"smtp_addr"`
+	SMTPUsername   string `json:"smtp_username"`
+	SMTPPassword   string `json:"smtp_password"`
+	SMTPRequireTLS bool   `json:"smtp_require_tls"`
+	From           string `json:"from"`
+	DropDir        string `json:"drop_dir"`
+	AppURL         string `json:"app_url"`
+}
+
+// Default returns the configuration used when neither a file nor the
+// environment sets a value.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:                   8080,
+			DatabasePath:           "chat.db",
+			LogPath:                filepath.Join("server", "server.log"),
+			ShutdownTimeoutSeconds: 30,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTLMinutes:       15,
+			RefreshTokenTTLHours:        24 * 30,
+			LoginLockoutThreshold:       5,
+			LoginLockoutWindowMinutes:   15,
+			LoginLockoutDurationMinutes: 15,
+			TOTPIssuer:                  "go-chat-site",
+			WebAuthnRPID:                "localhost",
+			WebAuthnRPName:              "go-chat-site",
+			PasswordResetLogPath:        "password-resets.log",
+			PasswordResetURL:            "http://localhost:5173/reset-password",
+		},
+		RateLimits: RateLimitConfig{
+			LoginPerMinute:         60,
+			LoginUserPerMinute:     20,
+			RefreshPerMinute:       60,
+			WSHandshakePerMinute:   120,
+			WSMessagePerMinute:     120,
+			WSMessageBurst:         20,
+			WSUserMessagePerMinute: 240,
+			WSUserMessageBurst:     40,
+			WSMaxViolations:        10,
+			UserSearchPerMinute:    30,
+		},
+		WebSocket: WebSocketConfig{AllowedOrigins: DefaultWSAllowedOrigins()},
+		Messaging: MessagingConfig{
+			AttachmentMaxBytes:       25 << 20,
+			AttachmentUserQuotaBytes: 500 << 20,
+		},
+		OIDC:     OIDCConfig{RedirectURL: "http://localhost:5173/oidc/callback"},
+		Webhooks: WebhookConfig{MaxAttempts: 8},
+		WebPush:  WebPushConfig{MaxAttempts: 5},
+		Mail:     MailConfig{SMTPRequireTLS: true, AppURL: "http://localhost:5173"},
+	}
+}
+
+// setting ties one field to its environment variable. Integer settings
+// reject values below min; reload marks the fields Reload may change.
+type setting struct {
+	env    string
+	key    string
+	min    int64
+	secret bool
+	reload bool
+	field  func(*Config) any
+}
+
+var settings = []setting{
+	{env: EnvPort, key: "server.port", min: 1, field: func(c *Config) any { return &c.Server.Port }},
+	{env: EnvDatabasePath, key: "server.database_path", field: func(c *Config) any { return &c.Server.DatabasePath }},
+	{env: EnvLogPath, key: "server.log_path", field: func(c *Config) any { return &c.Server.LogPath }},
+	{env: EnvDatabaseURL, key: "server.database_url", secret: true, field: func(c *Config) any { return &c.Server.DatabaseURL }},
+	{env: EnvShutdownSecs, key: "server.shutdown_timeout_seconds", min: 1, field: func(c *Config) any { return &c.Server.ShutdownTimeoutSeconds }},
+	{env: EnvPostgresAcceptReduced, key: "server.postgres_accept_reduced_features", field: func(c *Config) any { return &c.Server.PostgresAcceptReducedFeatures }},
+
+	{env: EnvJWTSecret, key: "auth.jwt_secret", secret: true, field: func(c *Config) any { return &c.Auth.JWTSecret }},
+	{env: EnvJWTKeysPath, key: "auth.jwt_keys_path", field: func(c *Config) any { return &c.Auth.JWTKeysPath }},
+	{env: EnvJWTLegacySecretUntil, key: "auth.jwt_legacy_secret_until", reload: true, field: func(c *Config) any { return &c.Auth.JWTLegacySecretUntil }},
+	{env: EnvAccessTokenTTLMinutes, key: "auth.access_token_ttl_minutes", min: 1, field: func(c *Config) any { return &c.Auth.AccessTokenTTLMinutes }},
+	{env: EnvRefreshTokenTTLHours, key: "auth.refresh_token_ttl_hours", min: 1, field: func(c *Config) any { return &c.Auth.RefreshTokenTTLHours }},
+	{env: EnvLoginLockoutThreshold, key: "auth.login_lockout_threshold", min: 1, field: func(c *Config) any { return &c.Auth.LoginLockoutThreshold }},
+	{env: EnvLoginLockoutWindowMins, key: "auth.login_lockout_window_minutes", min: 1, field: func(c *Config) any { return &c.Auth.LoginLockoutWindowMinutes }},
+	{env: EnvLoginLockoutDurationMins, key: "auth.login_lockout_duration_minutes", min: 1, field: func(c *Config) any { return &c.Auth.LoginLockoutDurationMinutes }},
+	{env: EnvTOTPIssuer, key: "auth.totp_issuer", field: func(c *Config) any { return &c.Auth.TOTPIssuer }},
+	{env: EnvWebAuthnRPID, key: "auth.webauthn_rp_id", field: func(c *Config) any { return &c.Auth.WebAuthnRPID }},
+	{env: EnvWebAuthnRPName, key: "auth.webauthn_rp_name", field: func(c *Config) any { return &c.Auth.WebAuthnRPName }},
+	{env: EnvWebAuthnOrigins, key: "auth.webauthn_origins", field: func(c *Config) any { return &c.Auth.WebAuthnOrigins }},
+	{env: EnvPasswordResetLogPath, key: "auth.password_reset_log_path", field: func(c *Config) any { return &c.Auth.PasswordResetLogPath }},
+	{env: EnvPasswordResetURL, key: "auth.password_reset_url", field: func(c *Config) any { return &c.Auth.PasswordResetURL }},
+	{env: EnvInviteLinkSecret, key: "auth.invite_link_secret", secret: true, field: func(c *Config) any { return &c.Auth.InviteLinkSecret }},
+
+	{env: EnvLoginRateLimitPerMinute, key: "rate_limits.login_per_minute", min: 1, reload: true, field: func(c *Config) any { return &c.RateLimits.LoginPerMinute }},
+	{env: EnvLoginUserRateLimit, key: "rate_limits.login_user_per_minute", min: 1, reload: true, field: func(c *Config) any { return &c.RateLimits.LoginUserPerMinute }},
+	{env: EnvRefreshRateLimitPerMin, key: "rate_limits.refresh_per_minute", min: 1, reload: true, field: func(c *Config) any { return &c.RateLimits.RefreshPerMinute }},
+	{env: EnvWSRateLimitPerMinute, key: "rate_limits.ws_handshake_per_minute", min: 1, reload: true, field: func(c *Config) any { return &c.RateLimits.WSHandshakePerMinute }},
+	{env: EnvWSMessageRatePerMinute, key: "rate_limits.ws_message_per_minute", min: 1, reload: true, field: func(c *Config) any { return &c.RateLimits.WSMessagePerMinute }},
+	{env: EnvWSMessageBurst, key: "rate_limits.ws_message_burst", min: 1, reload: true, field: func(c *Config) any { return &c.RateLimits.WSMessageBurst }},
+	{env: EnvWSUserMessageRatePerMin, key: "rate_limits.ws_user_message_per_minute", min: 1, reload: true, field: func(c *Config) any { return &c.RateLimits.WSUserMessagePerMinute }},
+	{env: EnvWSUserMessageBurst, key: "rate_limits.ws_user_message_burst", min: 1, reload: true, field: func(c *Config) any { return &c.RateLimits.WSUserMessageBurst }},
+	{env: EnvWSRateLimitMaxViolations, key: "rate_limits.ws_max_violations", min: 1, reload: true, field: func(c *Config) any { return &c.RateLimits.WSMaxViolations }},
+	{env: EnvUserSearchRateLimit, key: "rate_limits.user_search_per_minute", min: 1, reload: true, field: func(c *Config) any { return &c.RateLimits.UserSearchPerMinute }},
+	{env: EnvWSAllowedOrigins, key: "websocket.allowed_origins", reload: true, field: func(c *Config) any { return &c.WebSocket.AllowedOrigins }},
+
+	{env: EnvMessagingStorePlaintext, key: "messaging.store_plaintext_when_encrypted", field: func(c *Config) any { return &c.Messaging.StorePlaintextWhenEncrypted }},
+	{env: EnvCiphertextRetentionDays, key: "messaging.ciphertext_retention_days", field: func(c *Config) any { return &c.Messaging.CiphertextRetentionDays }},
+	{env: EnvAttachmentsDir, key: "messaging.attachments_dir", field: func(c *Config) any { return &c.Messaging.AttachmentsDir }},
+	{env: EnvAttachmentMaxBytes, key: "messaging.attachment_max_bytes", min: 1, field: func(c *Config) any { return &c.Messaging.AttachmentMaxBytes }},
+	{env: EnvAttachmentUserQuotaBytes, key: "messaging.attachment_user_quota_bytes", min: 1, field: func(c *Config) any { return &c.Messaging.AttachmentUserQuotaBytes }},
+
+	{env: EnvOIDCIssuer, key: "oidc.issuer", field: func(c *Config) any { return &c.OIDC.Issuer }},
+	{env: EnvOIDCClientID, key: "oidc.client_id", field: func(c *Config) any { return &c.OIDC.ClientID }},
+	{env: EnvOIDCClientSecret, key: "oidc.client_secret", secret: true, field: func(c *Config) any { return &c.OIDC.ClientSecret }},
+	{env: EnvOIDCRedirectURL, key: "oidc.redirect_url", field: func(c *Config) any { return &c.OIDC.RedirectURL }},
+	{env: EnvOIDCScopes, key: "oidc.scopes", field: func(c *Config) any { return &c.OIDC.Scopes }},
+	{env: EnvOIDCAutoCreate, key: "oidc.auto_create", field: func(c *Config) any { return &c.OIDC.AutoCreate }},
+	{env: EnvOIDCAllowedEmailDomains, key: "oidc.allowed_email_domains", field: func(c *Config) any { return &c.OIDC.AllowedEmailDomains }},
+	{env: EnvOIDCTrustProviderMFA, key: "oidc.trust_provider_mfa", field: func(c *Config) any { return &c.OIDC.TrustProviderMFA }},
+
+	{env: EnvWebhooksAllowPrivate, key: "webhooks.allow_private_targets", field: func(c *Config) any { return &c.Webhooks.AllowPrivateTargets }},
+	{env: EnvWebhookMaxAttempts, key: "webhooks.max_attempts", min: 1, field: func(c *Config) any { return &c.Webhooks.MaxAttempts }},
+
+	{env: EnvWebPushVAPIDPrivateKey, key: "webpush.vapid_private_key", secret: true, field: func(c *Config) any { return &c.WebPush.VAPIDPrivateKey }},
+	{env: EnvWebPushVAPIDSubject, key: "webpush.vapid_subject", field: func(c *Config) any { return &c.WebPush.VAPIDSubject }},
+	{env: EnvWebPushAllowPrivate, key: "webpush.allow_private_targets", field: func(c *Config) any { return &c.WebPush.AllowPrivateTargets }},
+	{env: EnvWebPushMaxAttempts, key: "webpush.max_attempts", min: 1, field: func(c *Config) any { return &c.WebPush.MaxAttempts }},
+
+	{env: EnvSMTPAddr, key: "mail.smtp_addr", field: func(c *Config) any { return &c.Mail.SMTPAddr }},
+	{env: EnvSMTPUsername, key: "mail.smtp_username", field: func(c *Config) any { return &c.Mail.SMTPUsername }},
+	{env: EnvSMTPPassword, key: "mail.smtp_password", secret: true, field: func(c *Config) any { return &c.Mail.SMTPPassword }},
+	{env: EnvSMTPRequireTLS, key: "mail.smtp_require_tls", field: func(c *Config) any { return &c.Mail.SMTPRequireTLS }},
+	{env: EnvMailFrom, key: "mail.from", field: func(c *Config) any { return &c.Mail.From }},
+	{env: EnvMailDropDir, key: "mail.drop_dir", field: func(c *Config) any { return &c.Mail.DropDir }},
+	{env: EnvNotificationsAppURL, key: "mail.app_url", field: func(c *Config) any { return &c.Mail.AppURL }},
+}
+
+// Load reads the JSON file at path, when path is not empty, over the
+// defaults, applies environment overrides and validates the result. Every
+// problem is reported, not just the first.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	var errs []error
+	for _, s := range settings {
+		raw, ok := os.LookupEnv(s.env)
+		if !ok || strings.TrimSpace(raw) == "" {
+			continue
+		}
+		if err := s.set(&cfg, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	cfg.normalize()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// fromEnv builds a configuration from the environment alone, keeping the
+// default for any value that does not parse or is out of range.
+func fromEnv() *Config {
+	cfg := Default()
+	for _, s := range settings {
+		raw := os.Getenv(s.env)
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		candidate := cfg
+		if s.set(&candidate, raw) == nil && s.check(&candidate) == nil {
+			cfg = candidate
+		}
+	}
+	cfg.normalize()
+	return &cfg
+}
+
+func (s setting) set(cfg *Config, raw string) error {
+	if !s.secret {
+		raw = strings.TrimSpace(raw)
+	}
+	switch p := s.field(cfg).(type) {
+	case *string:
+		*p = raw
+	case *int:
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		*p = v
+	case *int64:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		*p = v
+	case *bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", raw)
+		}
+		*p = v
+	case *[]string:
+		*p = splitList(raw)
+	}
+	return nil
+}
+
+// check applies the setting's lower bound to integer fields.
+func (s setting) check(cfg *Config) error {
+	var v int64
+	switch p := s.field(cfg).(type) {
+	case *int:
+		v = int64(*p)
+	case *int64:
+		v = *p
+	default:
+		return nil
+	}
+	if v < s.min {
+		return fmt.Errorf("%s (%s) must be at least %d, got %d", s.key, s.env, s.min, v)
+	}
+	return nil
+}
+
+func (c *Config) normalize() {
+	c.WebSocket.AllowedOrigins = lowerList(c.WebSocket.AllowedOrigins)
+	if len(c.WebSocket.AllowedOrigins) == 0 {
+		c.WebSocket.AllowedOrigins = DefaultWSAllowedOrigins()
+	}
+	c.Auth.WebAuthnOrigins = lowerList(c.Auth.WebAuthnOrigins)
+	c.Auth.WebAuthnRPID = strings.ToLower(strings.TrimSpace(c.Auth.WebAuthnRPID))
+	domains := make([]string, 0, len(c.OIDC.AllowedEmailDomains))
+	for _, d := range lowerList(c.OIDC.AllowedEmailDomains) {
+		if d = strings.TrimPrefix(d, "@"); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	c.OIDC.AllowedEmailDomains = domains
+}
+
+// Validate reports every setting that is out of range or inconsistent with
+// another.
+func (c *Config) Validate() error {
+	var errs []error
+	for _, s := range settings {
+		if err := s.check(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port (%s) must be at most 65535, got %d", EnvPort, c.Server.Port))
+	}
+	if strings.TrimSpace(c.Server.DatabasePath) == "" {
+		errs = append(errs, fmt.Errorf("server.database_path (%s) must not be empty", EnvDatabasePath))
+	}
+	if strings.TrimSpace(c.Server.LogPath) == "" {
+		errs = append(errs, fmt.Errorf("server.log_path (%s) must not be empty", EnvLogPath))
+	}
+	if raw := c.Auth.JWTLegacySecretUntil; raw != "" {
+		until, err := time.Parse(time.RFC3339, raw)
+		refreshTTL := time.Duration(c.Auth.RefreshTokenTTLHours) * time.Hour
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("auth.jwt_legacy_secret_until (%s): %q is not an RFC 3339 time", EnvJWTLegacySecretUntil, raw))
+		case c.Auth.JWTKeysPath == "" || c.Auth.JWTSecret == "":
+			errs = append(errs, fmt.Errorf("auth.jwt_legacy_secret_until (%s) needs both auth.jwt_keys_path (%s) and auth.jwt_secret (%s)", EnvJWTLegacySecretUntil, EnvJWTKeysPath, EnvJWTSecret))
+		case until.After(time.Now().Add(refreshTTL)):
+			errs = append(errs, fmt.Errorf("auth.jwt_legacy_secret_until (%s) must be within the refresh token TTL (%s), got %s", EnvJWTLegacySecretUntil, refreshTTL, raw))
+		}
+	}
+	if n := len(c.Auth.InviteLinkSecret); n > 0 && n < minInviteLinkSecretLen {
+		errs = append(errs, fmt.Errorf("auth.invite_link_secret (%s) must be at least %d bytes, got %d", EnvInviteLinkSecret, minInviteLinkSecretLen, n))
+	}
+	if c.Messaging.CiphertextRetentionDays < 0 {
+		errs = append(errs, fmt.Errorf("messaging.ciphertext_retention_days (%s) must not be negative, got %d", EnvCiphertextRetentionDays, c.Messaging.CiphertextRetentionDays))
+	}
+	for _, origin := range c.WebSocket.AllowedOrigins {
+		if !isOrigin(origin) {
+			errs = append(errs, fmt.Errorf("websocket.allowed_origins (%s): %q is not an origin like https://chat.example.com", EnvWSAllowedOrigins, origin))
+		}
+	}
+	for _, origin := range c.Auth.WebAuthnOrigins {
+		if !isOrigin(origin) {
+			errs = append(errs, fmt.Errorf("auth.webauthn_origins (%s): %q is not an origin like https://chat.example.com", EnvWebAuthnOrigins, origin))
+		}
+	}
+	for _, u := range []struct{ key, env, value string }{
+		{"auth.password_reset_url", EnvPasswordResetURL, c.Auth.PasswordResetURL},
+		{"oidc.redirect_url", EnvOIDCRedirectURL, c.OIDC.RedirectURL},
+		{"mail.app_url", EnvNotificationsAppURL, c.Mail.AppURL},
+	} {
+		if !isHTTPURL(u.value) {
+			errs = append(errs, fmt.Errorf("%s (%s): %q is not an http or https URL", u.key, u.env, u.value))
+		}
+	}
+	if c.OIDC.Issuer != "" {
+		if !isHTTPURL(c.OIDC.Issuer) {
+			errs = append(errs, fmt.Errorf("oidc.issuer (%s): %q is not an http or https URL", EnvOIDCIssuer, c.OIDC.Issuer))
+		}
+		if c.OIDC.ClientID == "" {
+			errs = append(errs, fmt.Errorf("oidc.client_id (%s) is required when oidc.issuer is set", EnvOIDCClientID))
+		}
+	}
+	if c.WebPush.VAPIDPrivateKey != "" && c.WebPush.VAPIDSubject == "" {
+		errs = append(errs, fmt.Errorf("webpush.vapid_subject (%s) is required when webpush.vapid_private_key is set", EnvWebPushVAPIDSubject))
+	}
+	if c.Mail.SMTPAddr != "" && c.Mail.From == "" {
+		errs = append(errs, fmt.Errorf("mail.from (%s) is required when mail.smtp_addr is set", EnvMailFrom))
+	}
+	return errors.Join(errs...)
+}
+
+// ResolvePaths makes the database, log and attachment paths absolute under
+// root, defaulting attachments to server/attachments.
+func (c *Config) ResolvePaths(root string) {
+	c.root = root
+	if c.Messaging.AttachmentsDir == "" {
+		c.Messaging.AttachmentsDir = filepath.Join("server", "attachments")
+	}
+	c.Server.DatabasePath = ResolvePath(root, c.Server.DatabasePath)
+	c.Server.LogPath = ResolvePath(root, c.Server.LogPath)
+	c.Messaging.AttachmentsDir = ResolvePath(root, c.Messaging.AttachmentsDir)
+}
+
+// ResolvePath joins a relative path onto root and leaves absolute ones alone.
+func ResolvePath(root, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(root, path)
+}
+
+// Redacted returns a copy with every secret replaced, safe to log. The
+// DATABASE_URL keeps its host and database but not its password.
+func (c Config) Redacted() Config {
+	out := c
+	for _, s := range settings {
+		if !s.secret {
+			continue
+		}
+		p := s.field(&out).(*string)
+		if *p == "" {
+			continue
+		}
+		if s.env == EnvDatabaseURL {
+			if u, err := url.Parse(*p); err == nil && u.Scheme != "" {
+				*p = u.Redacted()
+				continue
+			}
+		}
+		*p = redacted
+	}
+	return out
+}
+
+// String renders the redacted configuration as JSON, so printing a Config
+// never leaks a secret.
+func (c Config) String() string {
+	raw, err := json.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("config: %v", err)
+	}
+	return string(raw)
+}
+
+var active atomic.Pointer[Config]
+
+// Install makes cfg the configuration every accessor in this package reads.
+// Until it is called, accessors read the environment on each call, which is
+// what tests and the command-line tools rely on.
+func Install(cfg *Config) {
+	active.Store(cfg)
+}
+
+func current() *Config {
+	if cfg := active.Load(); cfg != nil {
+		return cfg
+	}
+	return fromEnv()
+}
+
+// Reload loads path again and installs the rate limits and WebSocket origins
+// from it; every other setting keeps its running value. It returns the keys
+// that changed but need a restart. On error nothing is installed.
+func Reload(path string) (*Config, []string, error) {
+	running := active.Load()
+	if running == nil {
+		return nil, nil, errors.New("no configuration installed")
+	}
+	next, err := Load(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	next.ResolvePaths(running.root)
+
+	merged := *running
+	merged.RateLimits = next.RateLimits
+	merged.WebSocket = next.WebSocket
+	merged.Auth.JWTLegacySecretUntil = next.Auth.JWTLegacySecretUntil
+	var pending []string
+	for _, s := range settings {
+		if !s.reload && !reflect.DeepEqual(s.field(running), s.field(next)) {
+			pending = append(pending, s.key)
+		}
+	}
+	active.Store(&merged)
+	return &merged, pending, nil
+}
+
+func splitList(raw string) []string {
+	return strings.Fields(strings.ReplaceAll(raw, ",", " "))
+}
+
+func lowerList(in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, v := range in {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func isOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		(u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.User == nil
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
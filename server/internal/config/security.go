@@ -4,7 +4,6 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -21,6 +20,48 @@ const (
 	EnvLoginLockoutWindowMins   = "LOGIN_LOCKOUT_WINDOW_MINUTES"
 	EnvLoginLockoutDurationMins = "LOGIN_LOCKOUT_DURATION_MINUTES"
 	EnvMessagingStorePlaintext  = "MESSAGING_STORE_PLAINTEXT_WHEN_ENCRYPTED"
+	EnvWSMessageRatePerMinute   = "WS_MESSAGE_RATE_LIMIT_PER_MINUTE"
+	EnvWSMessageBurst           = "WS_MESSAGE_BURST"
+	EnvWSUserMessageRatePerMin  = "WS_USER_MESSAGE_RATE_LIMIT_PER_MINUTE"
+	EnvWSUserMessageBurst       = "WS_USER_MESSAGE_BURST"
+	EnvWSRateLimitMaxViolations = "WS_RATE_LIMIT_MAX_VIOLATIONS"
+	EnvUserSearchRateLimit      = "USER_SEARCH_RATE_LIMIT_PER_MINUTE"
+	EnvAttachmentsDir           = "ATTACHMENTS_DIR"
+	EnvAttachmentMaxBytes       = "ATTACHMENT_MAX_BYTES"
+	EnvAttachmentUserQuotaBytes = "ATTACHMENT_USER_QUOTA_BYTES"
+	EnvTOTPIssuer               = "TOTP_ISSUER"
+	EnvWebAuthnRPID             = "WEBAUTHN_RP_ID"
+	EnvWebAuthnRPName           = "WEBAUTHN_RP_NAME"
+	EnvWebAuthnOrigins          = "WEBAUTHN_ORIGINS"
+	EnvPasswordResetLogPath     = "PASSWORD_RESET_LOG_PATH"
+	EnvPasswordResetURL         = "PASSWORD_RESET_URL"
+	EnvInviteLinkSecret         = "INVITE_LINK_SECRET"
+	EnvJWTKeysPath              = "JWT_KEYS_PATH"
+	EnvJWTLegacySecretUntil     = "JWT_LEGACY_SECRET_UNTIL"
+	EnvOIDCIssuer               = "OIDC_ISSUER"
+	EnvOIDCClientID             = "OIDC_CLIENT_ID"
+	EnvOIDCClientSecret         = "OIDC_CLIENT_SECRET"
+	EnvOIDCRedirectURL          = "OIDC_REDIRECT_URL"
+	EnvOIDCScopes               = "OIDC_SCOPES"
+	EnvOIDCAutoCreate           = "OIDC_AUTO_CREATE"
+	EnvOIDCAllowedEmailDomains  = "OIDC_ALLOWED_EMAIL_DOMAINS"
+	EnvOIDCTrustProviderMFA     = "OIDC_TRUST_PROVIDER_MFA"
+	EnvWebhooksAllowPrivate     = "WEBHOOKS_ALLOW_PRIVATE_TARGETS"
+	EnvWebhookMaxAttempts       = "WEBHOOK_MAX_ATTEMPTS"
+	EnvWebPushVAPIDPrivateKey   = "WEBPUSH_VAPID_PRIVATE_KEY"
+	EnvWebPushVAPIDSubject      = "WEBPUSH_VAPID_SUBJECT"
+	EnvWebPushAllowPrivate      = "WEBPUSH_ALLOW_PRIVATE_TARGETS"
+	EnvWebPushMaxAttempts       = "WEBPUSH_MAX_ATTEMPTS"
+	EnvSMTPAddr                 = "SMTP_ADDR"
+	EnvSMTPUsername             = "SMTP_USERNAME"
+	EnvSMTPPassword             = "SMTP_PASSWORD"
+	EnvSMTPRequireTLS           = "SMTP_REQUIRE_TLS"
+	EnvMailFrom                 = "MAIL_FROM"
+	EnvMailDropDir              = "MAIL_DROP_DIR"
+	EnvNotificationsAppURL      = "NOTIFICATIONS_APP_URL"
+	EnvDatabaseURL              = "DATABASE_URL"
+	EnvPostgresAcceptReduced    = "POSTGRES_ACCEPT_REDUCED_FEATURES"
+	EnvCiphertextRetentionDays  = "MESSAGE_CIPHERTEXT_RETENTION_DAYS"
 )
 
 func DefaultWSAllowedOrigins() []string {
@@ -39,23 +80,17 @@ func DefaultWSAllowedOrigins() []string {
 }
 
 func WSAllowedOriginsFromEnv() []string {
-	raw := strings.TrimSpace(os.Getenv(EnvWSAllowedOrigins))
-	if raw == "" {
-		return DefaultWSAllowedOrigins()
-	}
-	parts := strings.Split(raw, ",")
-	out := make([]string, 0, len(parts))
-	for _, p := range parts {
-		if v := strings.TrimSpace(p); v != "" {
-			out = append(out, strings.ToLower(v))
-		}
-	}
+	out := lowerList(strings.Split(os.Getenv(EnvWSAllowedOrigins), ","))
 	if len(out) == 0 {
 		return DefaultWSAllowedOrigins()
 	}
 	return out
 }
 
+// WSAllowedOrigins is the allowlist of the installed configuration, which a
+// reload can change.
+func WSAllowedOrigins() []string { return current().WebSocket.AllowedOrigins }
+
 func WSOriginAllowed(origin string, allowed []string) bool {
 	origin = strings.TrimSpace(origin)
 	if origin == "" {
@@ -75,70 +110,138 @@ func WSOriginAllowed(origin string, allowed []string) bool {
 	return false
 }
 
+// WSOriginCheckFunc follows the installed configuration, so a reload applies
+// to the next handshake. Without one it captures the environment once.
 func WSOriginCheckFunc() func(r *http.Request) bool {
+	if active.Load() != nil {
+		return func(r *http.Request) bool {
+			return WSOriginAllowed(r.Header.Get("Origin"), WSAllowedOrigins())
+		}
+	}
 	allowed := WSAllowedOriginsFromEnv()
 	return func(r *http.Request) bool {
 		return WSOriginAllowed(r.Header.Get("Origin"), allowed)
 	}
 }
 
-func loginRateLimitPerMinute() int {
-	return intFromEnv(EnvLoginRateLimitPerMinute, 60)
-}
-
-func loginUserRateLimitPerMinute() int {
-	return intFromEnv(EnvLoginUserRateLimit, 20)
-}
-
-func refreshRateLimitPerMinute() int {
-	return intFromEnv(EnvRefreshRateLimitPerMin, 60)
-}
-
-func wsHandshakeRateLimitPerMinute() int {
-	return intFromEnv(EnvWSRateLimitPerMinute, 120)
-}
-
-func LoginRateLimitPerMinute() int       { return loginRateLimitPerMinute() }
-func LoginUserRateLimitPerMinute() int   { return loginUserRateLimitPerMinute() }
-func RefreshRateLimitPerMinute() int     { return refreshRateLimitPerMinute() }
-func WSHandshakeRateLimitPerMinute() int { return wsHandshakeRateLimitPerMinute() }
+// The rate limit accessors are read on every request, so passing them as
+// functions lets a reload take effect without rebuilding the limiters.
+func LoginRateLimitPerMinute() int       { return current().RateLimits.LoginPerMinute }
+func LoginUserRateLimitPerMinute() int   { return current().RateLimits.LoginUserPerMinute }
+func RefreshRateLimitPerMinute() int     { return current().RateLimits.RefreshPerMinute }
+func WSHandshakeRateLimitPerMinute() int { return current().RateLimits.WSHandshakePerMinute }
+func UserSearchRateLimitPerMinute() int  { return current().RateLimits.UserSearchPerMinute }
 func AccessTokenTTL() time.Duration {
-	return time.Duration(intFromEnv(EnvAccessTokenTTLMinutes, 15)) * time.Minute
+	return time.Duration(current().Auth.AccessTokenTTLMinutes) * time.Minute
 }
 func RefreshTokenTTL() time.Duration {
-	return time.Duration(intFromEnv(EnvRefreshTokenTTLHours, 24*30)) * time.Hour
+	return time.Duration(current().Auth.RefreshTokenTTLHours) * time.Hour
 }
-func LoginLockoutThreshold() int { return intFromEnv(EnvLoginLockoutThreshold, 5) }
+func LoginLockoutThreshold() int { return current().Auth.LoginLockoutThreshold }
 func LoginLockoutWindow() time.Duration {
-	return time.Duration(intFromEnv(EnvLoginLockoutWindowMins, 15)) * time.Minute
+	return time.Duration(current().Auth.LoginLockoutWindowMinutes) * time.Minute
 }
 func LoginLockoutDuration() time.Duration {
-	return time.Duration(intFromEnv(EnvLoginLockoutDurationMins, 15)) * time.Minute
-}
-func MessagingStorePlaintextWhenEncrypted() bool {
-	return boolFromEnv(EnvMessagingStorePlaintext, false)
+	return time.Duration(current().Auth.LoginLockoutDurationMinutes) * time.Minute
 }
+func WSMessageRateLimitPerMinute() int     { return current().RateLimits.WSMessagePerMinute }
+func WSMessageBurst() int                  { return current().RateLimits.WSMessageBurst }
+func WSUserMessageRateLimitPerMinute() int { return current().RateLimits.WSUserMessagePerMinute }
+func WSUserMessageBurst() int              { return current().RateLimits.WSUserMessageBurst }
+func WSRateLimitMaxViolations() int        { return current().RateLimits.WSMaxViolations }
+func AttachmentsDir() string               { return current().Messaging.AttachmentsDir }
+func AttachmentMaxBytes() int64            { return current().Messaging.AttachmentMaxBytes }
+func AttachmentUserQuotaBytes() int64      { return current().Messaging.AttachmentUserQuotaBytes }
+func TOTPIssuer() string                   { return current().Auth.TOTPIssuer }
+func WebAuthnRPID() string                 { return current().Auth.WebAuthnRPID }
+func WebAuthnRPName() string               { return current().Auth.WebAuthnRPName }
 
-func intFromEnv(key string, fallback int) int {
-	raw := strings.TrimSpace(os.Getenv(key))
-	if raw == "" {
-		return fallback
+// WebAuthnOrigins falls back to the WebSocket origin allowlist, since the
+// browser client that opens the socket is the one running the ceremonies.
+func WebAuthnOrigins() []string {
+	cfg := current()
+	if len(cfg.Auth.WebAuthnOrigins) == 0 {
+		return cfg.WebSocket.AllowedOrigins
 	}
-	v, err := strconv.Atoi(raw)
-	if err != nil || v <= 0 {
-		return fallback
-	}
-	return v
+	return cfg.Auth.WebAuthnOrigins
 }
+func PasswordResetLogPath() string { return current().Auth.PasswordResetLogPath }
+func PasswordResetURL() string     { return current().Auth.PasswordResetURL }
+func JWTKeysPath() string          { return current().Auth.JWTKeysPath }
 
-func boolFromEnv(key string, fallback bool) bool {
-	raw := strings.TrimSpace(os.Getenv(key))
-	if raw == "" {
-		return fallback
-	}
-	v, err := strconv.ParseBool(raw)
-	if err != nil {
-		return fallback
-	}
-	return v
+// JWTLegacySecretUntil is when JWT_SECRET stops verifying tokens without a
+// kid under a key set; the zero time means they are already refused.
+func JWTLegacySecretUntil() time.Time {
+	until, _ := time.Parse(time.RFC3339, current().Auth.JWTLegacySecretUntil)
+	return until
+}
+
+// InviteLinkSecret is the key invite link codes are signed with; empty
+// disables invite links.
+func InviteLinkSecret() string { return current().Auth.InviteLinkSecret }
+
+// DatabaseURL selects the PostgreSQL backend; when empty the server uses the
+// SQLite database at DatabasePath.
+func DatabaseURL() string { return current().Server.DatabaseURL }
+
+// PostgresAcceptReducedFeatures lets the server start on PostgreSQL without
+// the features that only have SQLite adapters.
+func PostgresAcceptReducedFeatures() bool { return current().Server.PostgresAcceptReducedFeatures }
+
+// DatabasePath is the SQLite database file, relative to the project root
+// unless absolute.
+func DatabasePath() string { return current().Server.DatabasePath }
+
+// DeliveredCiphertextRetention is how long encrypted messages are kept after
+// delivery. Zero, the default, keeps them until a thread timer expires them.
+func DeliveredCiphertextRetention() time.Duration {
+	return time.Duration(current().Messaging.CiphertextRetentionDays) * 24 * time.Hour
+}
+
+// OIDCIssuer is empty when single sign-on is disabled.
+func OIDCIssuer() string       { return current().OIDC.Issuer }
+func OIDCClientID() string     { return current().OIDC.ClientID }
+func OIDCClientSecret() string { return current().OIDC.ClientSecret }
+func OIDCRedirectURL() string  { return current().OIDC.RedirectURL }
+
+// OIDCScopes returns nil when unset so the client requests its defaults.
+func OIDCScopes() []string              { return current().OIDC.Scopes }
+func OIDCAutoCreate() bool              { return current().OIDC.AutoCreate }
+func OIDCAllowedEmailDomains() []string { return current().OIDC.AllowedEmailDomains }
+
+// OIDCTrustProviderMFA lets an ID token whose amr claim includes "mfa" stand
+// in for local TOTP.
+func OIDCTrustProviderMFA() bool { return current().OIDC.TrustProviderMFA }
+
+// WebhooksAllowPrivateTargets lets webhook endpoints use http:// and resolve
+// to loopback or private addresses. It is for local development only.
+func WebhooksAllowPrivateTargets() bool { return current().Webhooks.AllowPrivateTargets }
+func WebhookMaxAttempts() int           { return current().Webhooks.MaxAttempts }
+
+// WebPushVAPIDPrivateKey is empty when Web Push is disabled.
+func WebPushVAPIDPrivateKey() string { return current().WebPush.VAPIDPrivateKey }
+func WebPushVAPIDSubject() string    { return current().WebPush.VAPIDSubject }
+
+// WebPushAllowPrivateTargets accepts http:// subscription endpoints on
+// loopback or private addresses, for a local push service stub.
+func WebPushAllowPrivateTargets() bool { return current().WebPush.AllowPrivateTargets }
+func WebPushMaxAttempts() int          { return current().WebPush.MaxAttempts }
+
+// SMTPAddr is the relay's host:port. Email notifications are disabled when
+// neither it nor MailDropDir is set.
+func SMTPAddr() string     { return current().Mail.SMTPAddr }
+func SMTPUsername() string { return current().Mail.SMTPUsername }
+func SMTPPassword() string { return current().Mail.SMTPPassword }
+
+// SMTPRequireTLS refuses relays that do not offer STARTTLS. Turn it off only
+// for a local relay.
+func SMTPRequireTLS() bool { return current().Mail.SMTPRequireTLS }
+func MailFrom() string     { return current().Mail.From }
+
+// MailDropDir writes each email to a file instead of sending it, for
+// development.
+func MailDropDir() string         { return current().Mail.DropDir }
+func NotificationsAppURL() string { return current().Mail.AppURL }
+func MessagingStorePlaintextWhenEncrypted() bool {
+	return current().Messaging.StorePlaintextWhenEncrypted
 }
@@ -0,0 +1,237 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	// ExportTTL is how long a finished archive can be downloaded.
+	ExportTTL = 7 * 24 * time.Hour
+	// ExportCooldown is how often a user may start a new export. Asking
+	// again sooner returns the most recent one.
+	ExportCooldown = time.Hour
+	// MaxExportAttempts bounds how often a failing export is retried.
+	MaxExportAttempts = 3
+
+	// DeletedUsernamePrefix starts the username a deleted account is renamed
+	// to. Registration rejects names with this prefix.
+	DeletedUsernamePrefix = "deleted-user-"
+)
+
+var (
+	ErrExportNotFound     = errors.New("export not found")
+	ErrExportNotReady     = errors.New("export is not ready")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrConfirmation       = errors.New("confirmation does not match username")
+	ErrAccountNotFound    = errors.New("account not found")
+)
+
+// DeletedUsername is the username a deleted account keeps, so ledger and
+// message history still resolve to a stable, anonymous name.
+func DeletedUsername(userID int) string {
+	return DeletedUsernamePrefix + strconv.Itoa(userID)
+}
+
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportRunning ExportStatus = "running"
+	ExportReady   ExportStatus = "ready"
+	ExportFailed  ExportStatus = "failed"
+)
+
+// Export is one archive request. The archive itself is only loaded for
+// download.
+type Export struct {
+	ID          int64
+	UserID      int
+	Status      ExportStatus
+	Attempts    int
+	SizeBytes   int64
+	Error       string
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time
+}
+
+// Archive is the JSON document a user downloads. Its field names are the
+// published archive format.
+type Archive struct {
+	FormatVersion int                  `json:"format_version"`
+	GeneratedAt   time.Time            `json:"generated_at"`
+	Profile       ArchiveProfile       `json:"profile"`
+	Contacts      []ArchiveContact     `json:"contacts"`
+	Invites       []ArchiveInvite      `json:"invites"`
+	Sessions      []ArchiveSession     `json:"sessions"`
+	Devices       []ArchiveDevice      `json:"devices"`
+	Messages      []ArchiveMessage     `json:"messages"`
+	Wallet        ArchiveWallet        `json:"wallet"`
+	Transfers     []ArchiveTransfer    `json:"wallet_transfers"`
+	Identities    []ArchiveIdentity    `json:"external_identities"`
+	Notifications *ArchiveNotification `json:"notification_preferences,omitempty"`
+}
+
+type ArchiveProfile struct {
+	UserID      int       `json:"user_id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ArchiveContact struct {
+	UserID      int    `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+}
+
+type ArchiveInvite struct {
+	ID                   int       `json:"id"`
+	Direction            string    `json:"direction"`
+	CounterpartyUsername string    `json:"counterparty_username"`
+	Status               string    `json:"status"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+type ArchiveSession struct {
+	ID           int64      `json:"id"`
+	DeviceLabel  string     `json:"device_label"`
+	UserAgent    string     `json:"user_agent"`
+	LastSeenIP   string     `json:"last_seen_ip"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastSeenAt   time.Time  `json:"last_seen_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+}
+
+type ArchiveDevice struct {
+	ID          int64      `json:"id"`
+	Label       string     `json:"label"`
+	Algorithm   string     `json:"algorithm"`
+	IdentityKey string     `json:"identity_key"`
+	State       string     `json:"state"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ArchiveMessage is a message the user sent or received. Encrypted messages
+// are exported as the ciphertext the server holds.
+type ArchiveMessage struct {
+	ID              int64      `json:"id"`
+	Direction       string     `json:"direction"`
+	FromUsername    string     `json:"from_username"`
+	ToUsername      string     `json:"to_username"`
+	Body            string     `json:"body,omitempty"`
+	Ciphertext      string     `json:"ciphertext,omitempty"`
+	EnvelopeVersion string     `json:"envelope_version,omitempty"`
+	ContentKind     string     `json:"content_kind"`
+	AttachmentIDs   []int64    `json:"attachment_ids,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	DeliveredAt     *time.Time `json:"delivered_at,omitempty"`
+	ReadAt          *time.Time `json:"read_at,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+}
+
+type ArchiveWallet struct {
+	BalanceCents int64 `json:"balance_cents"`
+}
+
+type ArchiveTransfer struct {
+	ID                   int64     `json:"id"`
+	Direction            string    `json:"direction"`
+	CounterpartyUsername string    `json:"counterparty_username"`
+	AmountCents          int64     `json:"amount_cents"`
+	Note                 string    `json:"note"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+type ArchiveIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ArchiveNotification struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	DigestEnabled bool   `json:"digest_enabled"`
+	Frequency     string `json:"frequency"`
+}
+
+// Credentials is what deletion re-verifies. PasswordHash is empty for
+// accounts that only sign in through single sign-on.
+type Credentials struct {
+	UserID       int
+	Username     string
+	PasswordHash string
+}
+
+// Deletion reports what an account deletion removed. BotUserIDs are the
+// bots the user owned, which are deleted with it. TombstonedMessages counts
+// the messages they sent whose content was cleared.
+type Deletion struct {
+	UserID             int
+	Username           string
+	RevokedSessionIDs  []int64
+	BotUserIDs         []int
+	TombstonedMessages int
+	// BlobIDs are attachment blobs that no remaining attachment references
+	// and UploadIDs the user's unfinished uploads; their files are removed
+	// after the transaction commits.
+	BlobIDs   []string
+	UploadIDs []int64
+	// BlobCleanupFailures counts files that could not be removed.
+	BlobCleanupFailures int
+}
+
+type ExportRepository interface {
+	// LatestExport returns ErrExportNotFound when the user has none.
+	LatestExport(ctx context.Context, userID int) (Export, error)
+	CreateExport(ctx context.Context, userID int, at time.Time) (Export, error)
+	GetExport(ctx context.Context, userID int, exportID int64) (Export, error)
+	// ReadArchive returns the archive of a ready export.
+	ReadArchive(ctx context.Context, userID int, exportID int64) ([]byte, error)
+
+	// ClaimPendingExports marks up to limit pending exports, and running ones
+	// whose lease expired, as running until leaseUntil and counts the attempt.
+	ClaimPendingExports(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Export, error)
+	CompleteExport(ctx context.Context, exportID int64, archive []byte, completedAt, expiresAt time.Time) error
+	// FailExport returns the export to pending, or marks it failed when
+	// final is set.
+	FailExport(ctx context.Context, exportID int64, reason string, final bool) error
+	DeleteExpiredExports(ctx context.Context, now time.Time) (int, error)
+
+	// CollectArchive reads everything the user's archive contains.
+	CollectArchive(ctx context.Context, userID int) (Archive, error)
+}
+
+// BlobRemover deletes attachment files once their rows are gone. It is
+// satisfied by the attachment blob store.
+type BlobRemover interface {
+	Delete(ctx context.Context, blobID string) error
+	Discard(ctx context.Context, uploadID int64) error
+}
+
+type DeletionRepository interface {
+	// GetCredentials returns ErrAccountNotFound for unknown or deleted users.
+	GetCredentials(ctx context.Context, userID int) (Credentials, error)
+	// DeleteAccount anonymizes the users row and removes everything else the
+	// user owns in one transaction. Wallet accounts and transfers are kept
+	// for accounting. It reports the attachment files left without rows in
+	// BlobIDs and UploadIDs but does not touch them.
+	DeleteAccount(ctx context.Context, userID int, at time.Time) (Deletion, error)
+}
+
+type Repository interface {
+	ExportRepository
+	DeletionRepository
+}
+
+type PasswordVerifier interface {
+	VerifyPassword(password, hash string) bool
+}
@@ -0,0 +1,190 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	archiveFormatVersion = 1
+
+	defaultExportInterval = 10 * time.Second
+	defaultExportBatch    = 5
+	exportLease           = 10 * time.Minute
+)
+
+type Service interface {
+	// RequestExport queues an archive of the user's data. While one is
+	// queued, running or younger than ExportCooldown, it returns that one.
+	RequestExport(ctx context.Context, userID int) (Export, error)
+	LatestExport(ctx context.Context, userID int) (Export, error)
+	// DownloadExport returns the archive of a ready, unexpired export.
+	DownloadExport(ctx context.Context, userID int, exportID int64) (Export, []byte, error)
+	// DeleteAccount checks the password, when the account has one, and the
+	// typed username before deleting the account.
+	DeleteAccount(ctx context.Context, userID int, password, confirmUsername string) (Deletion, error)
+}
+
+type service struct {
+	repo     Repository
+	verifier PasswordVerifier
+	blobs    BlobRemover
+	now      func() time.Time
+}
+
+func NewService(repo Repository, verifier PasswordVerifier) Service {
+	return &service{repo: repo, verifier: verifier, now: time.Now}
+}
+
+// NewServiceWithBlobs also removes the deleted user's attachment files.
+func NewServiceWithBlobs(repo Repository, verifier PasswordVerifier, blobs BlobRemover) Service {
+	return &service{repo: repo, verifier: verifier, blobs: blobs, now: time.Now}
+}
+
+func (s *service) RequestExport(ctx context.Context, userID int) (Export, error) {
+	now := s.now().UTC()
+	latest, err := s.repo.LatestExport(ctx, userID)
+	switch {
+	case errors.Is(err, ErrExportNotFound):
+	case err != nil:
+		return Export{}, err
+	case latest.Status == ExportPending || latest.Status == ExportRunning:
+		return latest, nil
+	case latest.Status == ExportReady && now.Sub(latest.CreatedAt) < ExportCooldown:
+		return latest, nil
+	}
+	return s.repo.CreateExport(ctx, userID, now)
+}
+
+func (s *service) LatestExport(ctx context.Context, userID int) (Export, error) {
+	return s.repo.LatestExport(ctx, userID)
+}
+
+func (s *service) DownloadExport(ctx context.Context, userID int, exportID int64) (Export, []byte, error) {
+	export, err := s.repo.GetExport(ctx, userID, exportID)
+	if err != nil {
+		return Export{}, nil, err
+	}
+	if export.ExpiresAt != nil && !s.now().Before(*export.ExpiresAt) {
+		return Export{}, nil, ErrExportNotFound
+	}
+	if export.Status != ExportReady {
+		return Export{}, nil, ErrExportNotReady
+	}
+	archive, err := s.repo.ReadArchive(ctx, userID, exportID)
+	if err != nil {
+		return Export{}, nil, err
+	}
+	return export, archive, nil
+}
+
+func (s *service) DeleteAccount(ctx context.Context, userID int, password, confirmUsername string) (Deletion, error) {
+	creds, err := s.repo.GetCredentials(ctx, userID)
+	if err != nil {
+		return Deletion{}, err
+	}
+	if strings.TrimSpace(confirmUsername) != creds.Username {
+		return Deletion{}, ErrConfirmation
+	}
+	if creds.PasswordHash != "" && (s.verifier == nil || !s.verifier.VerifyPassword(password, creds.PasswordHash)) {
+		return Deletion{}, ErrInvalidCredentials
+	}
+	deletion, err := s.repo.DeleteAccount(ctx, userID, s.now().UTC())
+	if err != nil {
+		return Deletion{}, err
+	}
+	s.removeFiles(ctx, &deletion)
+	return deletion, nil
+}
+
+// removeFiles runs after the deletion committed, so a failure here cannot
+// undo it; failures are counted for the caller to report instead.
+func (s *service) removeFiles(ctx context.Context, deletion *Deletion) {
+	if s.blobs == nil {
+		return
+	}
+	for _, blobID := range deletion.BlobIDs {
+		if err := s.blobs.Delete(ctx, blobID); err != nil {
+			deletion.BlobCleanupFailures++
+		}
+	}
+	for _, uploadID := range deletion.UploadIDs {
+		if err := s.blobs.Discard(ctx, uploadID); err != nil {
+			deletion.BlobCleanupFailures++
+		}
+	}
+}
+
+// Exporter builds queued archives in the background and deletes expired
+// ones.
+type Exporter struct {
+	repo     ExportRepository
+	now      func() time.Time
+	interval time.Duration
+	batch    int
+}
+
+func NewExporter(repo ExportRepository) *Exporter {
+	return &Exporter{
+		repo:     repo,
+		now:      time.Now,
+		interval: defaultExportInterval,
+		batch:    defaultExportBatch,
+	}
+}
+
+// Start runs the exporter until ctx is cancelled.
+func (e *Exporter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			for {
+				n, err := e.RunDue(ctx)
+				if err != nil || n < e.batch {
+					break
+				}
+			}
+			_, _ = e.repo.DeleteExpiredExports(ctx, e.now().UTC())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunDue claims one batch of queued exports and builds them. It returns how
+// many were claimed.
+func (e *Exporter) RunDue(ctx context.Context) (int, error) {
+	now := e.now().UTC()
+	exports, err := e.repo.ClaimPendingExports(ctx, now, now.Add(exportLease), e.batch)
+	if err != nil {
+		return 0, err
+	}
+	for _, export := range exports {
+		if err := e.build(ctx, export); err != nil {
+			_ = e.repo.FailExport(ctx, export.ID, err.Error(), export.Attempts >= MaxExportAttempts)
+		}
+	}
+	return len(exports), nil
+}
+
+func (e *Exporter) build(ctx context.Context, export Export) error {
+	archive, err := e.repo.CollectArchive(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+	now := e.now().UTC()
+	archive.FormatVersion = archiveFormatVersion
+	archive.GeneratedAt = now
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	return e.repo.CompleteExport(ctx, export.ID, data, now, now.Add(ExportTTL))
+}
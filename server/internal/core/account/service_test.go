@@ -0,0 +1,224 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeRepo struct {
+	exports    []Export
+	archives   map[int64][]byte
+	claimed    []Export
+	collectErr error
+	failed     map[int64]bool
+	creds      Credentials
+	deletedAt  time.Time
+}
+
+func (f *fakeRepo) LatestExport(ctx context.Context, userID int) (Export, error) {
+	for i := len(f.exports) - 1; i >= 0; i-- {
+		if f.exports[i].UserID == userID {
+			return f.exports[i], nil
+		}
+	}
+	return Export{}, ErrExportNotFound
+}
+
+func (f *fakeRepo) CreateExport(ctx context.Context, userID int, at time.Time) (Export, error) {
+	export := Export{ID: int64(len(f.exports) + 1), UserID: userID, Status: ExportPending, CreatedAt: at}
+	f.exports = append(f.exports, export)
+	return export, nil
+}
+
+func (f *fakeRepo) GetExport(ctx context.Context, userID int, exportID int64) (Export, error) {
+	for _, export := range f.exports {
+		if export.ID == exportID && export.UserID == userID {
+			return export, nil
+		}
+	}
+	return Export{}, ErrExportNotFound
+}
+
+func (f *fakeRepo) ReadArchive(ctx context.Context, userID int, exportID int64) ([]byte, error) {
+	return f.archives[exportID], nil
+}
+
+func (f *fakeRepo) ClaimPendingExports(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Export, error) {
+	claimed := f.claimed
+	f.claimed = nil
+	return claimed, nil
+}
+
+func (f *fakeRepo) CompleteExport(ctx context.Context, exportID int64, archive []byte, completedAt, expiresAt time.Time) error {
+	if f.archives == nil {
+		f.archives = map[int64][]byte{}
+	}
+	f.archives[exportID] = archive
+	for i := range f.exports {
+		if f.exports[i].ID == exportID {
+			f.exports[i].Status = ExportReady
+			f.exports[i].ExpiresAt = &expiresAt
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepo) FailExport(ctx context.Context, exportID int64, reason string, final bool) error {
+	if f.failed == nil {
+		f.failed = map[int64]bool{}
+	}
+	f.failed[exportID] = final
+	return nil
+}
+
+func (f *fakeRepo) DeleteExpiredExports(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeRepo) CollectArchive(ctx context.Context, userID int) (Archive, error) {
+	if f.collectErr != nil {
+		return Archive{}, f.collectErr
+	}
+	return Archive{Profile: ArchiveProfile{UserID: userID, Username: "alice"}}, nil
+}
+
+func (f *fakeRepo) GetCredentials(ctx context.Context, userID int) (Credentials, error) {
+	if f.creds.UserID != userID {
+		return Credentials{}, ErrAccountNotFound
+	}
+	return f.creds, nil
+}
+
+func (f *fakeRepo) DeleteAccount(ctx context.Context, userID int, at time.Time) (Deletion, error) {
+	f.deletedAt = at
+	return Deletion{UserID: userID, Username: f.creds.Username}, nil
+}
+
+type fakeVerifier struct{}
+
+func (fakeVerifier) VerifyPassword(password, hash string) bool {
+	return hash == "hash:"+password
+}
+
+func TestService_RequestExport_ReusesActiveOrRecentExport(t *testing.T) {
+	repo := &fakeRepo{}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewService(repo, fakeVerifier{}).(*service)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	first, err := svc.RequestExport(ctx, 4)
+	if err != nil || first.ID != 1 || first.Status != ExportPending {
+		t.Fatalf("first export %+v, %v", first, err)
+	}
+	again, err := svc.RequestExport(ctx, 4)
+	if err != nil || again.ID != 1 {
+		t.Fatalf("pending export should be reused, got %+v, %v", again, err)
+	}
+
+	repo.exports[0].Status = ExportReady
+	now = now.Add(30 * time.Minute)
+	if recent, err := svc.RequestExport(ctx, 4); err != nil || recent.ID != 1 {
+		t.Fatalf("recent export should be reused, got %+v, %v", recent, err)
+	}
+	now = now.Add(ExportCooldown)
+	if fresh, err := svc.RequestExport(ctx, 4); err != nil || fresh.ID != 2 {
+		t.Fatalf("expected a new export after the cooldown, got %+v, %v", fresh, err)
+	}
+
+	repo.exports[1].Status = ExportFailed
+	if retry, err := svc.RequestExport(ctx, 4); err != nil || retry.ID != 3 {
+		t.Fatalf("a failed export should not block a new one, got %+v, %v", retry, err)
+	}
+}
+
+func TestService_DownloadExport_RequiresReadyUnexpiredExport(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	repo := &fakeRepo{
+		exports: []Export{
+			{ID: 1, UserID: 4, Status: ExportRunning},
+			{ID: 2, UserID: 4, Status: ExportReady, ExpiresAt: &expires},
+		},
+		archives: map[int64][]byte{2: []byte(`{}`)},
+	}
+	svc := NewService(repo, fakeVerifier{}).(*service)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, _, err := svc.DownloadExport(ctx, 4, 1); !errors.Is(err, ErrExportNotReady) {
+		t.Fatalf("running export err = %v", err)
+	}
+	if _, _, err := svc.DownloadExport(ctx, 5, 2); !errors.Is(err, ErrExportNotFound) {
+		t.Fatalf("another user's export err = %v", err)
+	}
+	if _, archive, err := svc.DownloadExport(ctx, 4, 2); err != nil || string(archive) != `{}` {
+		t.Fatalf("ready export = %q, %v", archive, err)
+	}
+	now = expires
+	if _, _, err := svc.DownloadExport(ctx, 4, 2); !errors.Is(err, ErrExportNotFound) {
+		t.Fatalf("expired export err = %v", err)
+	}
+}
+
+func TestService_DeleteAccount_ChecksConfirmationAndPassword(t *testing.T) {
+	repo := &fakeRepo{creds: Credentials{UserID: 4, Username: "alice", PasswordHash: "hash:secret"}}
+	svc := NewService(repo, fakeVerifier{})
+	ctx := context.Background()
+
+	if _, err := svc.DeleteAccount(ctx, 4, "secret", "bob"); !errors.Is(err, ErrConfirmation) {
+		t.Fatalf("wrong username err = %v", err)
+	}
+	if _, err := svc.DeleteAccount(ctx, 4, "guess", "alice"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password err = %v", err)
+	}
+	if !repo.deletedAt.IsZero() {
+		t.Fatal("account deleted without confirmation")
+	}
+	if deletion, err := svc.DeleteAccount(ctx, 4, "secret", " alice "); err != nil || deletion.UserID != 4 || repo.deletedAt.IsZero() {
+		t.Fatalf("deletion = %+v, %v", deletion, err)
+	}
+
+	// Single sign-on accounts have no password to check.
+	repo = &fakeRepo{creds: Credentials{UserID: 5, Username: "sso"}}
+	if _, err := NewService(repo, fakeVerifier{}).DeleteAccount(ctx, 5, "", "sso"); err != nil {
+		t.Fatalf("sso deletion err = %v", err)
+	}
+}
+
+func TestExporter_RunDue_BuildsArchiveAndRetriesFailures(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	repo := &fakeRepo{exports: []Export{{ID: 1, UserID: 4, Status: ExportRunning, Attempts: 1}}}
+	repo.claimed = repo.exports
+	exporter := NewExporter(repo)
+	exporter.now = func() time.Time { return now }
+
+	if n, err := exporter.RunDue(context.Background()); err != nil || n != 1 {
+		t.Fatalf("RunDue = %d, %v", n, err)
+	}
+	var archive Archive
+	if err := json.Unmarshal(repo.archives[1], &archive); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if archive.FormatVersion != archiveFormatVersion || !archive.GeneratedAt.Equal(now) || archive.Profile.Username != "alice" {
+		t.Fatalf("unexpected archive %+v", archive)
+	}
+	if repo.exports[0].ExpiresAt == nil || !repo.exports[0].ExpiresAt.Equal(now.Add(ExportTTL)) {
+		t.Fatalf("unexpected expiry %v", repo.exports[0].ExpiresAt)
+	}
+
+	repo.collectErr = errors.New("disk I/O error")
+	repo.claimed = []Export{{ID: 2, UserID: 4, Attempts: 1}, {ID: 3, UserID: 4, Attempts: MaxExportAttempts}}
+	if _, err := exporter.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if final, ok := repo.failed[2]; !ok || final {
+		t.Fatalf("first failure should be retried, got %v", repo.failed)
+	}
+	if !repo.failed[3] {
+		t.Fatalf("last attempt should fail the export, got %v", repo.failed)
+	}
+}
@@ -0,0 +1,109 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// EncryptedMimeType is the only MIME type accepted for client-side-encrypted blobs.
+// The real content type travels inside the E2EE envelope with the blob key.
+const EncryptedMimeType = "application/octet-stream"
+
+var (
+	ErrUploadNotFound      = errors.New("upload not found")
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrUnsupportedMimeType = errors.New("unsupported attachment type")
+	ErrTooLarge            = errors.New("attachment too large")
+	ErrQuotaExceeded       = errors.New("attachment storage quota exceeded")
+	ErrChunkOutOfOrder     = errors.New("chunk offset does not match received bytes")
+	ErrUploadIncomplete    = errors.New("upload is incomplete")
+	ErrChecksumMismatch    = errors.New("attachment checksum mismatch")
+)
+
+// AllowedMimeTypes lists the plaintext content types accepted for upload.
+var AllowedMimeTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// Attachment is a completed upload that messages can reference by ID. BlobID is
+// the content address (hex SHA-256) of the stored bytes. Media is set once the
+// image pipeline has picked the attachment up.
+type Attachment struct {
+	ID          int64
+	OwnerUserID int
+	BlobID      string
+	FileName    string
+	MimeType    string
+	SizeBytes   int64
+	Encrypted   bool
+	CreatedAt   time.Time
+	Media       *Media
+}
+
+// Upload tracks an in-progress chunked upload.
+type Upload struct {
+	ID            int64
+	OwnerUserID   int
+	FileName      string
+	MimeType      string
+	SizeBytes     int64
+	ReceivedBytes int64
+	Encrypted     bool
+	CreatedAt     time.Time
+}
+
+type BeginUploadRequest struct {
+	FileName  string
+	MimeType  string
+	SizeBytes int64
+	Encrypted bool
+}
+
+// Limits bounds attachment sizes and per-user storage.
+type Limits struct {
+	MaxBytes       int64
+	UserQuotaBytes int64
+	ChunkBytes     int64
+}
+
+// BlobInfo describes bytes committed to content-addressed storage.
+type BlobInfo struct {
+	ID        string
+	SizeBytes int64
+}
+
+// Repository persists upload and attachment metadata.
+type Repository interface {
+	CreateUpload(ctx context.Context, upload Upload) (Upload, error)
+	GetUpload(ctx context.Context, ownerUserID int, uploadID int64) (Upload, error)
+	// SetUploadReceivedBytes advances an upload's received bytes from from to
+	// to, and returns ErrChunkOutOfOrder when another chunk moved it first.
+	SetUploadReceivedBytes(ctx context.Context, uploadID int64, from, to int64) error
+	DeleteUpload(ctx context.Context, uploadID int64) error
+	CreateAttachment(ctx context.Context, attachment Attachment) (Attachment, error)
+	GetAttachment(ctx context.Context, attachmentID int64) (Attachment, error)
+	CanAccessAttachment(ctx context.Context, userID int, attachmentID int64) (bool, error)
+	UsageBytes(ctx context.Context, ownerUserID int) (int64, error)
+}
+
+// BlobStore is the storage seam for attachment bytes. Uploads are staged per
+// upload ID and committed under their content address. Commit checks
+// expectedSHA256 against the bytes as uploaded, then applies transform (if any)
+// and addresses the blob by the transformed bytes. Put stores derived blobs such
+// as thumbnails. Delete removes a committed blob; the caller must have checked
+// that no attachment still references it, since identical files share one.
+type BlobStore interface {
+	WriteChunk(ctx context.Context, uploadID int64, offset int64, r io.Reader) (int64, error)
+	Commit(ctx context.Context, uploadID int64, expectedSHA256 string, transform Transform) (BlobInfo, error)
+	Put(ctx context.Context, r io.Reader) (BlobInfo, error)
+	Discard(ctx context.Context, uploadID int64) error
+	Open(ctx context.Context, blobID string) (io.ReadSeekCloser, error)
+	Delete(ctx context.Context, blobID string) error
+}
@@ -0,0 +1,203 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+type MediaStatus string
+
+const (
+	MediaPending MediaStatus = "pending"
+	MediaReady   MediaStatus = "ready"
+	MediaFailed  MediaStatus = "failed"
+)
+
+var ErrMediaNotFound = errors.New("attachment media not found")
+
+const (
+	defaultMediaWorkers       = 2
+	defaultMediaQueueSize     = 256
+	defaultMediaSweepInterval = time.Minute
+	defaultMediaMaxAttempts   = 3
+)
+
+// Transform rewrites uploaded bytes on their way into blob storage, for example
+// to drop location metadata. A nil Transform stores the bytes as uploaded.
+type Transform func(dst io.Writer, src io.Reader) error
+
+// Media is derived image metadata produced by the background pipeline.
+type Media struct {
+	AttachmentID      int64
+	Status            MediaStatus
+	Width             int
+	Height            int
+	Placeholder       string
+	ThumbnailBlobID   string
+	ThumbnailMimeType string
+	Attempts          int
+	LastError         string
+}
+
+// ImageAnalysis is what an ImageProcessor extracts from one image.
+type ImageAnalysis struct {
+	Width             int
+	Height            int
+	Placeholder       string
+	Thumbnail         []byte
+	ThumbnailMimeType string
+}
+
+// ImageProcessor is the seam for image decoding and sanitizing.
+type ImageProcessor interface {
+	// Supports reports whether Analyze can decode mimeType.
+	Supports(mimeType string) bool
+	// Sanitizer returns the Transform applied before plaintext bytes of
+	// mimeType are committed, or nil when none is needed.
+	Sanitizer(mimeType string) Transform
+	Analyze(mimeType string, r io.Reader) (ImageAnalysis, error)
+}
+
+// MediaRepository persists pipeline state. Pending rows double as the durable
+// queue, so work survives restarts.
+type MediaRepository interface {
+	EnqueueMedia(ctx context.Context, attachmentID int64) error
+	ListPendingMedia(ctx context.Context, limit int) ([]int64, error)
+	GetMedia(ctx context.Context, attachmentID int64) (Media, error)
+	SaveMedia(ctx context.Context, media Media) error
+}
+
+// MediaPipeline generates thumbnails and placeholders off the request path.
+// Enqueue records a pending row and nudges an in-memory queue; a periodic sweep
+// picks up anything the queue dropped or a previous process left behind.
+type MediaPipeline struct {
+	repo          Repository
+	media         MediaRepository
+	blobs         BlobStore
+	images        ImageProcessor
+	queue         chan int64
+	workers       int
+	sweepInterval time.Duration
+	maxAttempts   int
+}
+
+func NewMediaPipeline(repo Repository, media MediaRepository, blobs BlobStore, images ImageProcessor) *MediaPipeline {
+	return &MediaPipeline{
+		repo:          repo,
+		media:         media,
+		blobs:         blobs,
+		images:        images,
+		queue:         make(chan int64, defaultMediaQueueSize),
+		workers:       defaultMediaWorkers,
+		sweepInterval: defaultMediaSweepInterval,
+		maxAttempts:   defaultMediaMaxAttempts,
+	}
+}
+
+func (p *MediaPipeline) Enqueue(ctx context.Context, attachmentID int64) error {
+	if err := p.media.EnqueueMedia(ctx, attachmentID); err != nil {
+		return err
+	}
+	select {
+	case p.queue <- attachmentID:
+	default:
+	}
+	return nil
+}
+
+// Start launches the workers and the recovery sweep until ctx is cancelled.
+func (p *MediaPipeline) Start(ctx context.Context) {
+	for i := 0; i < p.workers; i++ {
+		go p.work(ctx)
+	}
+	go p.sweep(ctx)
+}
+
+func (p *MediaPipeline) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-p.queue:
+			_ = p.Process(ctx, id)
+		}
+	}
+}
+
+func (p *MediaPipeline) sweep(ctx context.Context) {
+	ticker := time.NewTicker(p.sweepInterval)
+	defer ticker.Stop()
+	for {
+		ids, err := p.media.ListPendingMedia(ctx, defaultMediaQueueSize)
+		if err == nil {
+			for _, id := range ids {
+				select {
+				case p.queue <- id:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process analyzes one pending attachment. Failures are retried by the sweep
+// until maxAttempts, after which the row is marked failed.
+func (p *MediaPipeline) Process(ctx context.Context, attachmentID int64) error {
+	media, err := p.media.GetMedia(ctx, attachmentID)
+	if err != nil {
+		return err
+	}
+	if media.Status != MediaPending {
+		return nil
+	}
+
+	result, err := p.analyze(ctx, attachmentID)
+	if err != nil {
+		media.Attempts++
+		media.LastError = err.Error()
+		if media.Attempts >= p.maxAttempts {
+			media.Status = MediaFailed
+		}
+		if saveErr := p.media.SaveMedia(ctx, media); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+
+	thumb, err := p.blobs.Put(ctx, bytes.NewReader(result.Thumbnail))
+	if err != nil {
+		return err
+	}
+	return p.media.SaveMedia(ctx, Media{
+		AttachmentID:      attachmentID,
+		Status:            MediaReady,
+		Width:             result.Width,
+		Height:            result.Height,
+		Placeholder:       result.Placeholder,
+		ThumbnailBlobID:   thumb.ID,
+		ThumbnailMimeType: result.ThumbnailMimeType,
+		Attempts:          media.Attempts + 1,
+	})
+}
+
+func (p *MediaPipeline) analyze(ctx context.Context, attachmentID int64) (ImageAnalysis, error) {
+	attachment, err := p.repo.GetAttachment(ctx, attachmentID)
+	if err != nil {
+		return ImageAnalysis{}, err
+	}
+	blob, err := p.blobs.Open(ctx, attachment.BlobID)
+	if err != nil {
+		return ImageAnalysis{}, err
+	}
+	defer blob.Close()
+	return p.images.Analyze(attachment.MimeType, blob)
+}
@@ -0,0 +1,198 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+type fakeMediaRepo struct {
+	repo  *fakeRepo
+	media map[int64]Media
+}
+
+func (f *fakeMediaRepo) EnqueueMedia(ctx context.Context, attachmentID int64) error {
+	_ = ctx
+	if _, ok := f.media[attachmentID]; !ok {
+		f.media[attachmentID] = Media{AttachmentID: attachmentID, Status: MediaPending}
+	}
+	f.sync(attachmentID)
+	return nil
+}
+
+func (f *fakeMediaRepo) ListPendingMedia(ctx context.Context, limit int) ([]int64, error) {
+	_ = ctx
+	var ids []int64
+	for id, media := range f.media {
+		if media.Status == MediaPending && len(ids) < limit {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (f *fakeMediaRepo) GetMedia(ctx context.Context, attachmentID int64) (Media, error) {
+	_ = ctx
+	media, ok := f.media[attachmentID]
+	if !ok {
+		return Media{}, ErrMediaNotFound
+	}
+	return media, nil
+}
+
+func (f *fakeMediaRepo) SaveMedia(ctx context.Context, media Media) error {
+	_ = ctx
+	if _, ok := f.media[media.AttachmentID]; !ok {
+		return ErrMediaNotFound
+	}
+	f.media[media.AttachmentID] = media
+	f.sync(media.AttachmentID)
+	return nil
+}
+
+// sync mirrors the LEFT JOIN the SQL repository does in GetAttachment.
+func (f *fakeMediaRepo) sync(attachmentID int64) {
+	attachment := f.repo.attachments[attachmentID]
+	media := f.media[attachmentID]
+	attachment.Media = &media
+	f.repo.attachments[attachmentID] = attachment
+}
+
+type fakeImages struct {
+	err error
+}
+
+func (f *fakeImages) Supports(mimeType string) bool { return mimeType == "image/png" }
+
+func (f *fakeImages) Sanitizer(mimeType string) Transform {
+	if mimeType != "image/png" {
+		return nil
+	}
+	return func(dst io.Writer, src io.Reader) error {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return err
+		}
+		_, err = dst.Write(bytes.ReplaceAll(data, []byte("GPS"), nil))
+		return err
+	}
+}
+
+func (f *fakeImages) Analyze(mimeType string, r io.Reader) (ImageAnalysis, error) {
+	if f.err != nil {
+		return ImageAnalysis{}, f.err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ImageAnalysis{}, err
+	}
+	return ImageAnalysis{
+		Width:             len(data),
+		Height:            1,
+		Placeholder:       "L00000fQfQfQfQfQfQfQfQfQfQfQ",
+		Thumbnail:         []byte("thumb:" + mimeType),
+		ThumbnailMimeType: "image/png",
+	}, nil
+}
+
+func newMediaServiceForTest(images *fakeImages) (Service, *MediaPipeline, *fakeRepo, *fakeMediaRepo, *memoryBlobs) {
+	repo := newFakeRepo()
+	media := &fakeMediaRepo{repo: repo, media: map[int64]Media{}}
+	blobs := newMemoryBlobs()
+	pipeline := NewMediaPipeline(repo, media, blobs, images)
+	return NewServiceWithMedia(repo, blobs, Limits{}, images, pipeline), pipeline, repo, media, blobs
+}
+
+func uploadForTest(t *testing.T, svc Service, content []byte, mimeType string) Attachment {
+	t.Helper()
+	ctx := context.Background()
+	upload, err := svc.BeginUpload(ctx, 1, BeginUploadRequest{MimeType: mimeType, SizeBytes: int64(len(content))})
+	if err != nil {
+		t.Fatalf("BeginUpload: %v", err)
+	}
+	if _, err := svc.AppendChunk(ctx, 1, upload.ID, 0, bytes.NewReader(content)); err != nil {
+		t.Fatalf("AppendChunk: %v", err)
+	}
+	attachment, err := svc.CompleteUpload(ctx, 1, upload.ID, "")
+	if err != nil {
+		t.Fatalf("CompleteUpload: %v", err)
+	}
+	return attachment
+}
+
+func TestService_CompleteUploadSanitizesAndQueuesImages(t *testing.T) {
+	svc, pipeline, _, media, blobs := newMediaServiceForTest(&fakeImages{})
+	content := append(append([]byte{}, pngHeader...), []byte("GPSpixels")...)
+
+	attachment := uploadForTest(t, svc, content, "image/png")
+	if attachment.Media == nil || attachment.Media.Status != MediaPending {
+		t.Fatalf("media = %+v, want pending", attachment.Media)
+	}
+	if stored := blobs.blobs[attachment.BlobID]; bytes.Contains(stored, []byte("GPS")) {
+		t.Fatal("expected sanitizer to run before the blob was stored")
+	}
+	if attachment.SizeBytes != int64(len(content)-3) {
+		t.Fatalf("size = %d, want sanitized size %d", attachment.SizeBytes, len(content)-3)
+	}
+
+	if _, _, err := svc.OpenThumbnail(context.Background(), 1, attachment.ID); !errors.Is(err, ErrMediaNotFound) {
+		t.Fatalf("thumbnail before processing err = %v, want ErrMediaNotFound", err)
+	}
+	if err := pipeline.Process(context.Background(), attachment.ID); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	ready := media.media[attachment.ID]
+	if ready.Status != MediaReady || ready.Width != int(attachment.SizeBytes) || ready.ThumbnailBlobID == "" {
+		t.Fatalf("media = %+v, want ready with dimensions and thumbnail", ready)
+	}
+
+	got, thumb, err := svc.OpenThumbnail(context.Background(), 1, attachment.ID)
+	if err != nil {
+		t.Fatalf("OpenThumbnail: %v", err)
+	}
+	data, _ := io.ReadAll(thumb)
+	if string(data) != "thumb:image/png" || got.ThumbnailMimeType != "image/png" {
+		t.Fatalf("thumbnail = %q (%s)", data, got.ThumbnailMimeType)
+	}
+	if _, _, err := svc.OpenThumbnail(context.Background(), 2, attachment.ID); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Fatalf("stranger thumbnail err = %v, want ErrAttachmentNotFound", err)
+	}
+
+	text := uploadForTest(t, svc, []byte("plain notes"), "text/plain")
+	if text.Media != nil {
+		t.Fatalf("text attachment media = %+v, want none", text.Media)
+	}
+	if _, ok := media.media[text.ID]; ok {
+		t.Fatal("expected non-image attachment not to be queued")
+	}
+}
+
+func TestMediaPipeline_ProcessMarksFailedAfterMaxAttempts(t *testing.T) {
+	images := &fakeImages{}
+	svc, pipeline, _, media, _ := newMediaServiceForTest(images)
+	attachment := uploadForTest(t, svc, append(append([]byte{}, pngHeader...), 'x'), "image/png")
+
+	images.err = errors.New("corrupt image")
+	for i := 1; i <= defaultMediaMaxAttempts; i++ {
+		if err := pipeline.Process(context.Background(), attachment.ID); err == nil {
+			t.Fatalf("attempt %d: expected error", i)
+		}
+		got := media.media[attachment.ID]
+		if got.Attempts != i || got.LastError != "corrupt image" {
+			t.Fatalf("attempt %d media = %+v", i, got)
+		}
+	}
+	if got := media.media[attachment.ID]; got.Status != MediaFailed {
+		t.Fatalf("status = %q, want failed", got.Status)
+	}
+
+	images.err = nil
+	if err := pipeline.Process(context.Background(), attachment.ID); err != nil {
+		t.Fatalf("Process on failed row: %v", err)
+	}
+	if got := media.media[attachment.ID]; got.Status != MediaFailed {
+		t.Fatalf("failed rows should not be reprocessed, status = %q", got.Status)
+	}
+}
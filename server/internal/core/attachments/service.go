@@ -0,0 +1,269 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	DefaultMaxBytes       int64 = 25 << 20
+	DefaultUserQuotaBytes int64 = 500 << 20
+	DefaultChunkBytes     int64 = 1 << 20
+
+	maxFileNameLength = 255
+)
+
+var ErrInvalidUpload = errors.New("invalid upload")
+
+type Service interface {
+	BeginUpload(ctx context.Context, ownerUserID int, req BeginUploadRequest) (Upload, error)
+	GetUpload(ctx context.Context, ownerUserID int, uploadID int64) (Upload, error)
+	AppendChunk(ctx context.Context, ownerUserID int, uploadID int64, offset int64, r io.Reader) (Upload, error)
+	CompleteUpload(ctx context.Context, ownerUserID int, uploadID int64, expectedSHA256 string) (Attachment, error)
+	GetAttachment(ctx context.Context, userID int, attachmentID int64) (Attachment, error)
+	OpenAttachment(ctx context.Context, userID int, attachmentID int64) (Attachment, io.ReadSeekCloser, error)
+	OpenThumbnail(ctx context.Context, userID int, attachmentID int64) (Media, io.ReadSeekCloser, error)
+	Limits() Limits
+}
+
+type service struct {
+	repo     Repository
+	blobs    BlobStore
+	limits   Limits
+	images   ImageProcessor
+	pipeline *MediaPipeline
+}
+
+func NewService(repo Repository, blobs BlobStore, limits Limits) Service {
+	return NewServiceWithMedia(repo, blobs, limits, nil, nil)
+}
+
+// NewServiceWithMedia sanitizes plaintext images with images before they are
+// stored and hands them to pipeline for thumbnails and placeholders.
+func NewServiceWithMedia(repo Repository, blobs BlobStore, limits Limits, images ImageProcessor, pipeline *MediaPipeline) Service {
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultMaxBytes
+	}
+	if limits.UserQuotaBytes <= 0 {
+		limits.UserQuotaBytes = DefaultUserQuotaBytes
+	}
+	if limits.ChunkBytes <= 0 {
+		limits.ChunkBytes = DefaultChunkBytes
+	}
+	return &service{repo: repo, blobs: blobs, limits: limits, images: images, pipeline: pipeline}
+}
+
+func (s *service) Limits() Limits {
+	return s.limits
+}
+
+func (s *service) BeginUpload(ctx context.Context, ownerUserID int, req BeginUploadRequest) (Upload, error) {
+	mimeType, err := normalizeMimeType(req.MimeType, req.Encrypted)
+	if err != nil {
+		return Upload{}, err
+	}
+	if req.SizeBytes <= 0 {
+		return Upload{}, ErrInvalidUpload
+	}
+	if req.SizeBytes > s.limits.MaxBytes {
+		return Upload{}, ErrTooLarge
+	}
+
+	used, err := s.repo.UsageBytes(ctx, ownerUserID)
+	if err != nil {
+		return Upload{}, err
+	}
+	if used+req.SizeBytes > s.limits.UserQuotaBytes {
+		return Upload{}, ErrQuotaExceeded
+	}
+
+	return s.repo.CreateUpload(ctx, Upload{
+		OwnerUserID: ownerUserID,
+		FileName:    normalizeFileName(req.FileName),
+		MimeType:    mimeType,
+		SizeBytes:   req.SizeBytes,
+		Encrypted:   req.Encrypted,
+	})
+}
+
+func (s *service) GetUpload(ctx context.Context, ownerUserID int, uploadID int64) (Upload, error) {
+	return s.repo.GetUpload(ctx, ownerUserID, uploadID)
+}
+
+func (s *service) AppendChunk(ctx context.Context, ownerUserID int, uploadID int64, offset int64, r io.Reader) (Upload, error) {
+	upload, err := s.repo.GetUpload(ctx, ownerUserID, uploadID)
+	if err != nil {
+		return Upload{}, err
+	}
+	if offset != upload.ReceivedBytes {
+		return Upload{}, ErrChunkOutOfOrder
+	}
+
+	maxChunk := upload.SizeBytes - upload.ReceivedBytes
+	if maxChunk > s.limits.ChunkBytes {
+		maxChunk = s.limits.ChunkBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxChunk+1))
+	if err != nil {
+		return Upload{}, err
+	}
+	if len(data) == 0 {
+		return Upload{}, ErrInvalidUpload
+	}
+	if int64(len(data)) > maxChunk {
+		return Upload{}, ErrTooLarge
+	}
+
+	// Plaintext uploads must actually be what they claim to be. Encrypted blobs
+	// are opaque, so only their size is checked.
+	if offset == 0 && !upload.Encrypted && !sniffMatches(upload.MimeType, data) {
+		_ = s.blobs.Discard(ctx, upload.ID)
+		_ = s.repo.DeleteUpload(ctx, upload.ID)
+		return Upload{}, ErrUnsupportedMimeType
+	}
+
+	n, err := s.blobs.WriteChunk(ctx, upload.ID, offset, bytes.NewReader(data))
+	if err != nil {
+		return Upload{}, err
+	}
+	// Two requests can pass the offset check together; only the first to
+	// record its bytes wins, and the other must re-read the upload and resume.
+	if err := s.repo.SetUploadReceivedBytes(ctx, upload.ID, offset, offset+n); err != nil {
+		return Upload{}, err
+	}
+	upload.ReceivedBytes = offset + n
+	return upload, nil
+}
+
+func (s *service) CompleteUpload(ctx context.Context, ownerUserID int, uploadID int64, expectedSHA256 string) (Attachment, error) {
+	upload, err := s.repo.GetUpload(ctx, ownerUserID, uploadID)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if upload.ReceivedBytes != upload.SizeBytes {
+		return Attachment{}, ErrUploadIncomplete
+	}
+
+	var transform Transform
+	if !upload.Encrypted && s.images != nil {
+		transform = s.images.Sanitizer(upload.MimeType)
+	}
+	blob, err := s.blobs.Commit(ctx, upload.ID, strings.ToLower(strings.TrimSpace(expectedSHA256)), transform)
+	if err != nil {
+		if errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrUnsupportedMimeType) {
+			_ = s.blobs.Discard(ctx, upload.ID)
+			_ = s.repo.DeleteUpload(ctx, upload.ID)
+		}
+		return Attachment{}, err
+	}
+
+	attachment, err := s.repo.CreateAttachment(ctx, Attachment{
+		OwnerUserID: ownerUserID,
+		BlobID:      blob.ID,
+		FileName:    upload.FileName,
+		MimeType:    upload.MimeType,
+		SizeBytes:   blob.SizeBytes,
+		Encrypted:   upload.Encrypted,
+	})
+	if err != nil {
+		return Attachment{}, err
+	}
+	if err := s.repo.DeleteUpload(ctx, upload.ID); err != nil {
+		return Attachment{}, err
+	}
+	// Thumbnails are best-effort; the attachment is usable without them.
+	if s.pipeline != nil && !attachment.Encrypted && s.images.Supports(attachment.MimeType) {
+		if err := s.pipeline.Enqueue(ctx, attachment.ID); err == nil {
+			attachment.Media = &Media{AttachmentID: attachment.ID, Status: MediaPending}
+		}
+	}
+	return attachment, nil
+}
+
+func (s *service) GetAttachment(ctx context.Context, userID int, attachmentID int64) (Attachment, error) {
+	ok, err := s.repo.CanAccessAttachment(ctx, userID, attachmentID)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if !ok {
+		return Attachment{}, ErrAttachmentNotFound
+	}
+	return s.repo.GetAttachment(ctx, attachmentID)
+}
+
+func (s *service) OpenAttachment(ctx context.Context, userID int, attachmentID int64) (Attachment, io.ReadSeekCloser, error) {
+	attachment, err := s.GetAttachment(ctx, userID, attachmentID)
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+	blob, err := s.blobs.Open(ctx, attachment.BlobID)
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+	return attachment, blob, nil
+}
+
+func (s *service) OpenThumbnail(ctx context.Context, userID int, attachmentID int64) (Media, io.ReadSeekCloser, error) {
+	attachment, err := s.GetAttachment(ctx, userID, attachmentID)
+	if err != nil {
+		return Media{}, nil, err
+	}
+	if attachment.Media == nil || attachment.Media.Status != MediaReady || attachment.Media.ThumbnailBlobID == "" {
+		return Media{}, nil, ErrMediaNotFound
+	}
+	blob, err := s.blobs.Open(ctx, attachment.Media.ThumbnailBlobID)
+	if err != nil {
+		return Media{}, nil, err
+	}
+	return *attachment.Media, blob, nil
+}
+
+func normalizeMimeType(raw string, encrypted bool) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if encrypted && raw == "" {
+		return EncryptedMimeType, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(raw)
+	if err != nil {
+		return "", ErrUnsupportedMimeType
+	}
+	if encrypted {
+		if mediaType != EncryptedMimeType {
+			return "", ErrUnsupportedMimeType
+		}
+		return mediaType, nil
+	}
+	if !AllowedMimeTypes[mediaType] {
+		return "", ErrUnsupportedMimeType
+	}
+	return mediaType, nil
+}
+
+func sniffMatches(declared string, data []byte) bool {
+	sniffed, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return false
+	}
+	return sniffed == declared
+}
+
+func normalizeFileName(name string) string {
+	name = strings.TrimSpace(strings.ReplaceAll(name, "\\", "/"))
+	if name == "" {
+		return ""
+	}
+	name = path.Base(name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	if len(name) > maxFileNameLength {
+		name = name[:maxFileNameLength]
+	}
+	return name
+}
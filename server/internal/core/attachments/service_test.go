@@ -0,0 +1,364 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+type fakeRepo struct {
+	nextID      int64
+	uploads     map[int64]Upload
+	attachments map[int64]Attachment
+	usage       int64
+	accessible  map[int64]bool
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{
+		uploads:     map[int64]Upload{},
+		attachments: map[int64]Attachment{},
+		accessible:  map[int64]bool{},
+	}
+}
+
+func (f *fakeRepo) CreateUpload(ctx context.Context, upload Upload) (Upload, error) {
+	_ = ctx
+	f.nextID++
+	upload.ID = f.nextID
+	f.uploads[upload.ID] = upload
+	return upload, nil
+}
+
+func (f *fakeRepo) GetUpload(ctx context.Context, ownerUserID int, uploadID int64) (Upload, error) {
+	_ = ctx
+	upload, ok := f.uploads[uploadID]
+	if !ok || upload.OwnerUserID != ownerUserID {
+		return Upload{}, ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+func (f *fakeRepo) SetUploadReceivedBytes(ctx context.Context, uploadID int64, from, to int64) error {
+	_ = ctx
+	upload, ok := f.uploads[uploadID]
+	if !ok {
+		return ErrUploadNotFound
+	}
+	if upload.ReceivedBytes != from {
+		return ErrChunkOutOfOrder
+	}
+	upload.ReceivedBytes = to
+	f.uploads[uploadID] = upload
+	return nil
+}
+
+func (f *fakeRepo) DeleteUpload(ctx context.Context, uploadID int64) error {
+	_ = ctx
+	delete(f.uploads, uploadID)
+	return nil
+}
+
+func (f *fakeRepo) CreateAttachment(ctx context.Context, attachment Attachment) (Attachment, error) {
+	_ = ctx
+	f.nextID++
+	attachment.ID = f.nextID
+	f.attachments[attachment.ID] = attachment
+	return attachment, nil
+}
+
+func (f *fakeRepo) GetAttachment(ctx context.Context, attachmentID int64) (Attachment, error) {
+	_ = ctx
+	attachment, ok := f.attachments[attachmentID]
+	if !ok {
+		return Attachment{}, ErrAttachmentNotFound
+	}
+	return attachment, nil
+}
+
+func (f *fakeRepo) CanAccessAttachment(ctx context.Context, userID int, attachmentID int64) (bool, error) {
+	_ = ctx
+	attachment, ok := f.attachments[attachmentID]
+	return ok && (attachment.OwnerUserID == userID || f.accessible[attachmentID]), nil
+}
+
+func (f *fakeRepo) UsageBytes(ctx context.Context, ownerUserID int) (int64, error) {
+	_ = ctx
+	_ = ownerUserID
+	return f.usage, nil
+}
+
+type memoryBlobs struct {
+	staged    map[int64][]byte
+	blobs     map[string][]byte
+	discarded []int64
+}
+
+func newMemoryBlobs() *memoryBlobs {
+	return &memoryBlobs{staged: map[int64][]byte{}, blobs: map[string][]byte{}}
+}
+
+func (m *memoryBlobs) WriteChunk(ctx context.Context, uploadID int64, offset int64, r io.Reader) (int64, error) {
+	_ = ctx
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	m.staged[uploadID] = append(m.staged[uploadID][:offset], data...)
+	return int64(len(data)), nil
+}
+
+func (m *memoryBlobs) Commit(ctx context.Context, uploadID int64, expectedSHA256 string, transform Transform) (BlobInfo, error) {
+	data := m.staged[uploadID]
+	sum := sha256.Sum256(data)
+	if expectedSHA256 != "" && expectedSHA256 != hex.EncodeToString(sum[:]) {
+		return BlobInfo{}, ErrChecksumMismatch
+	}
+	if transform != nil {
+		var out bytes.Buffer
+		if err := transform(&out, bytes.NewReader(data)); err != nil {
+			return BlobInfo{}, err
+		}
+		data = out.Bytes()
+	}
+	delete(m.staged, uploadID)
+	return m.Put(ctx, bytes.NewReader(data))
+}
+
+func (m *memoryBlobs) Put(ctx context.Context, r io.Reader) (BlobInfo, error) {
+	_ = ctx
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+	m.blobs[id] = data
+	return BlobInfo{ID: id, SizeBytes: int64(len(data))}, nil
+}
+
+func (m *memoryBlobs) Discard(ctx context.Context, uploadID int64) error {
+	_ = ctx
+	m.discarded = append(m.discarded, uploadID)
+	delete(m.staged, uploadID)
+	return nil
+}
+
+func (m *memoryBlobs) Open(ctx context.Context, blobID string) (io.ReadSeekCloser, error) {
+	_ = ctx
+	data, ok := m.blobs[blobID]
+	if !ok {
+		return nil, ErrAttachmentNotFound
+	}
+	return nopReadSeekCloser{bytes.NewReader(data)}, nil
+}
+
+func (m *memoryBlobs) Delete(ctx context.Context, blobID string) error {
+	_ = ctx
+	delete(m.blobs, blobID)
+	return nil
+}
+
+type nopReadSeekCloser struct{ *bytes.Reader }
+
+func (nopReadSeekCloser) Close() error { return nil }
+
+func TestService_ChunkedUploadCompletesToContentAddressedAttachment(t *testing.T) {
+	repo := newFakeRepo()
+	blobs := newMemoryBlobs()
+	svc := NewService(repo, blobs, Limits{ChunkBytes: 8})
+	content := append(append([]byte{}, pngHeader...), []byte("pixels")...)
+
+	upload, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{
+		FileName:  "../screens/shot.png",
+		MimeType:  "image/png",
+		SizeBytes: int64(len(content)),
+	})
+	if err != nil {
+		t.Fatalf("BeginUpload: %v", err)
+	}
+	if upload.FileName != "shot.png" {
+		t.Fatalf("file name = %q, want path stripped", upload.FileName)
+	}
+
+	for offset := 0; offset < len(content); offset += 8 {
+		end := min(offset+8, len(content))
+		if _, err := svc.AppendChunk(context.Background(), 1, upload.ID, int64(offset), bytes.NewReader(content[offset:end])); err != nil {
+			t.Fatalf("AppendChunk at %d: %v", offset, err)
+		}
+	}
+
+	sum := sha256.Sum256(content)
+	attachment, err := svc.CompleteUpload(context.Background(), 1, upload.ID, strings.ToUpper(hex.EncodeToString(sum[:])))
+	if err != nil {
+		t.Fatalf("CompleteUpload: %v", err)
+	}
+	if attachment.BlobID != hex.EncodeToString(sum[:]) || attachment.SizeBytes != int64(len(content)) {
+		t.Fatalf("attachment = %+v, want content-addressed blob", attachment)
+	}
+	if _, ok := repo.uploads[upload.ID]; ok {
+		t.Fatal("expected upload record to be removed after completion")
+	}
+
+	_, blob, err := svc.OpenAttachment(context.Background(), 1, attachment.ID)
+	if err != nil {
+		t.Fatalf("OpenAttachment: %v", err)
+	}
+	got, _ := io.ReadAll(blob)
+	if !bytes.Equal(got, content) {
+		t.Fatal("downloaded bytes do not match upload")
+	}
+}
+
+func TestService_BeginUploadValidatesTypeSizeAndQuota(t *testing.T) {
+	repo := newFakeRepo()
+	svc := NewService(repo, newMemoryBlobs(), Limits{MaxBytes: 100, UserQuotaBytes: 150})
+
+	if _, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{MimeType: "text/html", SizeBytes: 10}); !errors.Is(err, ErrUnsupportedMimeType) {
+		t.Fatalf("html err = %v, want ErrUnsupportedMimeType", err)
+	}
+	if _, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{MimeType: "image/png", SizeBytes: 101}); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("oversized err = %v, want ErrTooLarge", err)
+	}
+	if _, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{MimeType: "image/png", SizeBytes: 0}); !errors.Is(err, ErrInvalidUpload) {
+		t.Fatalf("empty err = %v, want ErrInvalidUpload", err)
+	}
+	if _, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{MimeType: "image/png", SizeBytes: 10, Encrypted: true}); !errors.Is(err, ErrUnsupportedMimeType) {
+		t.Fatalf("encrypted png err = %v, want ErrUnsupportedMimeType", err)
+	}
+
+	repo.usage = 100
+	if _, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{MimeType: "application/pdf", SizeBytes: 60}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("quota err = %v, want ErrQuotaExceeded", err)
+	}
+	upload, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{SizeBytes: 50, Encrypted: true})
+	if err != nil {
+		t.Fatalf("encrypted upload within quota: %v", err)
+	}
+	if upload.MimeType != EncryptedMimeType {
+		t.Fatalf("encrypted mime = %q, want %q", upload.MimeType, EncryptedMimeType)
+	}
+}
+
+func TestService_AppendChunkRejectsSpoofedContentType(t *testing.T) {
+	repo := newFakeRepo()
+	blobs := newMemoryBlobs()
+	svc := NewService(repo, blobs, Limits{})
+
+	upload, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{MimeType: "image/png", SizeBytes: 20})
+	if err != nil {
+		t.Fatalf("BeginUpload: %v", err)
+	}
+	_, err = svc.AppendChunk(context.Background(), 1, upload.ID, 0, strings.NewReader("<html><script></script>"[:20]))
+	if !errors.Is(err, ErrUnsupportedMimeType) {
+		t.Fatalf("err = %v, want ErrUnsupportedMimeType", err)
+	}
+	if len(blobs.discarded) != 1 {
+		t.Fatal("expected spoofed upload to be discarded")
+	}
+	if _, ok := repo.uploads[upload.ID]; ok {
+		t.Fatal("expected spoofed upload record to be removed")
+	}
+}
+
+func TestService_EncryptedUploadSkipsSniffing(t *testing.T) {
+	svc := NewService(newFakeRepo(), newMemoryBlobs(), Limits{})
+
+	upload, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{MimeType: EncryptedMimeType, SizeBytes: 5, Encrypted: true})
+	if err != nil {
+		t.Fatalf("BeginUpload: %v", err)
+	}
+	if _, err := svc.AppendChunk(context.Background(), 1, upload.ID, 0, strings.NewReader("<html")); err != nil {
+		t.Fatalf("AppendChunk: %v", err)
+	}
+}
+
+func TestService_AppendChunkEnforcesOffsetAndDeclaredSize(t *testing.T) {
+	svc := NewService(newFakeRepo(), newMemoryBlobs(), Limits{})
+
+	upload, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{MimeType: "text/plain", SizeBytes: 5})
+	if err != nil {
+		t.Fatalf("BeginUpload: %v", err)
+	}
+	if _, err := svc.AppendChunk(context.Background(), 1, upload.ID, 2, strings.NewReader("hi")); !errors.Is(err, ErrChunkOutOfOrder) {
+		t.Fatalf("gap err = %v, want ErrChunkOutOfOrder", err)
+	}
+	if _, err := svc.AppendChunk(context.Background(), 1, upload.ID, 0, strings.NewReader("hello!")); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("overflow err = %v, want ErrTooLarge", err)
+	}
+	if _, err := svc.AppendChunk(context.Background(), 1, upload.ID, 0, strings.NewReader("hel")); err != nil {
+		t.Fatalf("AppendChunk: %v", err)
+	}
+	if _, err := svc.CompleteUpload(context.Background(), 1, upload.ID, ""); !errors.Is(err, ErrUploadIncomplete) {
+		t.Fatalf("complete err = %v, want ErrUploadIncomplete", err)
+	}
+	if _, err := svc.AppendChunk(context.Background(), 2, upload.ID, 3, strings.NewReader("lo")); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("other user err = %v, want ErrUploadNotFound", err)
+	}
+}
+
+func TestService_CompleteUploadChecksumMismatchDiscardsUpload(t *testing.T) {
+	repo := newFakeRepo()
+	blobs := newMemoryBlobs()
+	svc := NewService(repo, blobs, Limits{})
+
+	upload, _ := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{MimeType: "text/plain", SizeBytes: 5})
+	if _, err := svc.AppendChunk(context.Background(), 1, upload.ID, 0, strings.NewReader("hello")); err != nil {
+		t.Fatalf("AppendChunk: %v", err)
+	}
+	if _, err := svc.CompleteUpload(context.Background(), 1, upload.ID, strings.Repeat("0", 64)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("err = %v, want ErrChecksumMismatch", err)
+	}
+	if _, ok := repo.uploads[upload.ID]; ok {
+		t.Fatal("expected mismatched upload to be removed")
+	}
+}
+
+func TestService_GetAttachmentHidesInaccessibleAttachments(t *testing.T) {
+	repo := newFakeRepo()
+	svc := NewService(repo, newMemoryBlobs(), Limits{})
+	attachment, _ := repo.CreateAttachment(context.Background(), Attachment{OwnerUserID: 1, BlobID: "abc", MimeType: "text/plain", SizeBytes: 1})
+
+	if _, err := svc.GetAttachment(context.Background(), 2, attachment.ID); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Fatalf("stranger err = %v, want ErrAttachmentNotFound", err)
+	}
+	repo.accessible[attachment.ID] = true
+	if _, err := svc.GetAttachment(context.Background(), 2, attachment.ID); err != nil {
+		t.Fatalf("recipient err = %v, want access", err)
+	}
+}
+
+// racingRepo lets another chunk land between AppendChunk reading the upload
+// and recording its own bytes.
+type racingRepo struct{ *fakeRepo }
+
+func (r racingRepo) GetUpload(ctx context.Context, ownerUserID int, uploadID int64) (Upload, error) {
+	upload, err := r.fakeRepo.GetUpload(ctx, ownerUserID, uploadID)
+	if err == nil {
+		_ = r.fakeRepo.SetUploadReceivedBytes(ctx, uploadID, upload.ReceivedBytes, upload.ReceivedBytes+1)
+	}
+	return upload, err
+}
+
+func TestService_AppendChunkLosesRaceWithConcurrentChunk(t *testing.T) {
+	repo := newFakeRepo()
+	svc := NewService(racingRepo{repo}, newMemoryBlobs(), Limits{})
+
+	upload, err := svc.BeginUpload(context.Background(), 1, BeginUploadRequest{MimeType: EncryptedMimeType, SizeBytes: 5, Encrypted: true})
+	if err != nil {
+		t.Fatalf("BeginUpload: %v", err)
+	}
+	if _, err := svc.AppendChunk(context.Background(), 1, upload.ID, 0, strings.NewReader("abc")); !errors.Is(err, ErrChunkOutOfOrder) {
+		t.Fatalf("racing chunk err = %v, want ErrChunkOutOfOrder", err)
+	}
+	if got := repo.uploads[upload.ID].ReceivedBytes; got != 1 {
+		t.Fatalf("received bytes = %d, want the winning chunk's 1", got)
+	}
+}
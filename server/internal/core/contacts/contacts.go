@@ -3,6 +3,7 @@ package contacts
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 type UserID int
@@ -20,14 +21,21 @@ const (
 	InvitePending  InviteStatus = "pending"
 	InviteAccepted InviteStatus = "accepted"
 	InviteRejected InviteStatus = "rejected"
+	// InviteCancelled is set when the sender withdraws an invite and
+	// InviteExpired when the invite_expiry job finds it past ExpiresAt.
+	InviteCancelled InviteStatus = "cancelled"
+	InviteExpired   InviteStatus = "expired"
 )
 
 type Invite struct {
-	ID              int
-	FromUser        UserID
-	ToUser          UserID
-	Status          InviteStatus
-	InviterUsername string
+	ID                int
+	FromUser          UserID
+	ToUser            UserID
+	Status            InviteStatus
+	InviterUsername   string
+	RecipientUsername string
+	CreatedAt         time.Time
+	ExpiresAt         time.Time
 }
 
 var (
@@ -43,4 +51,9 @@ type GraphRepository interface {
 	CreateInvite(ctx context.Context, fromUser, toUser UserID) error
 	ListInvites(ctx context.Context, userID UserID) ([]Invite, error)
 	UpdateInvite(ctx context.Context, inviteID int, userID UserID, status InviteStatus) error
+	// ListOutgoingInvites returns the unexpired pending invites userID sent.
+	ListOutgoingInvites(ctx context.Context, userID UserID) ([]Invite, error)
+	// CancelInvite withdraws a pending invite sent by userID, returning
+	// ErrInviteNotFound for any other invite.
+	CancelInvite(ctx context.Context, inviteID int, userID UserID) error
 }
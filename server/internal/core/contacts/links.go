@@ -0,0 +1,225 @@
+package contacts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	DefaultInviteLinkMaxUses = 1
+	MaxInviteLinkUses        = 100
+	DefaultInviteLinkTTL     = 72 * time.Hour
+	MaxInviteLinkTTL         = 30 * 24 * time.Hour
+	// MaxActiveInviteLinks bounds the links one user can have open at once.
+	MaxActiveInviteLinks = 20
+
+	inviteLinkNonceBytes = 8
+	inviteLinkTagBytes   = 16
+)
+
+var (
+	ErrInvalidInviteLink   = errors.New("max_uses must be between 1 and 100 and expiry at most 30 days")
+	ErrInviteLinkInvalid   = errors.New("invite link is invalid or expired")
+	ErrInviteLinkNotFound  = errors.New("invite link not found")
+	ErrInviteLinkOwn       = errors.New("you cannot redeem your own invite link")
+	ErrInviteLinkLimit     = errors.New("invite link limit reached")
+	errInviteLinkMalformed = errors.New("malformed invite link code")
+)
+
+// InviteLink lets anyone holding its code become a contact of its owner, up
+// to MaxUses people and until ExpiresAt. Code is derived from ID and Nonce
+// and signed, so it is never stored.
+type InviteLink struct {
+	ID            int64
+	OwnerID       UserID
+	OwnerUsername string
+	Nonce         string
+	MaxUses       int
+	UseCount      int
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	RevokedAt     *time.Time
+	Code          string
+}
+
+// Active reports whether the link can still be redeemed by someone new.
+func (l InviteLink) Active(now time.Time) bool {
+	return l.RevokedAt == nil && now.Before(l.ExpiresAt) && l.UseCount < l.MaxUses
+}
+
+// InviteLinkRepository persists invite links and their redemptions.
+type InviteLinkRepository interface {
+	// CreateInviteLink stores link and returns it with its ID set.
+	CreateInviteLink(ctx context.Context, link InviteLink) (InviteLink, error)
+	// ListInviteLinks returns every link owner created, newest first.
+	ListInviteLinks(ctx context.Context, owner UserID) ([]InviteLink, error)
+	// GetInviteLink returns ErrInviteLinkNotFound for an unknown id.
+	GetInviteLink(ctx context.Context, id int64) (InviteLink, error)
+	// RevokeInviteLink returns ErrInviteLinkNotFound unless owner created
+	// the link.
+	RevokeInviteLink(ctx context.Context, id int64, owner UserID, at time.Time) error
+	// RedeemInviteLink records userID's use of the link, makes userID and
+	// the owner contacts of each other and accepts any pending invite
+	// between them, all in one transaction. A user who already redeemed the
+	// link is not counted again. It returns ErrInviteLinkInvalid when the
+	// link is revoked, expired or used up at the time of redemption.
+	RedeemInviteLink(ctx context.Context, id int64, userID UserID, now time.Time) error
+}
+
+// InviteLinks is the invite link use case consumed by the HTTP adapter.
+type InviteLinks interface {
+	CreateInviteLink(ctx context.Context, owner UserID, maxUses int, ttl time.Duration) (InviteLink, error)
+	ListInviteLinks(ctx context.Context, owner UserID) ([]InviteLink, error)
+	RevokeInviteLink(ctx context.Context, id int64, owner UserID) error
+	RedeemInviteLink(ctx context.Context, userID UserID, code string) (InviteLink, error)
+}
+
+// InviteLinkService issues and redeems signed invite links.
+type InviteLinkService struct {
+	repo   InviteLinkRepository
+	secret []byte
+	now    func() time.Time
+}
+
+var _ InviteLinks = (*InviteLinkService)(nil)
+
+// NewInviteLinkService signs codes with secret, which must not be empty.
+func NewInviteLinkService(repo InviteLinkRepository, secret string) *InviteLinkService {
+	return &InviteLinkService{repo: repo, secret: []byte(secret), now: time.Now}
+}
+
+// CreateInviteLink opens a link for owner. Zero maxUses and ttl select the
+// defaults of one use and three days.
+func (s *InviteLinkService) CreateInviteLink(ctx context.Context, owner UserID, maxUses int, ttl time.Duration) (InviteLink, error) {
+	if maxUses == 0 {
+		maxUses = DefaultInviteLinkMaxUses
+	}
+	if ttl == 0 {
+		ttl = DefaultInviteLinkTTL
+	}
+	if maxUses < 1 || maxUses > MaxInviteLinkUses || ttl < 0 || ttl > MaxInviteLinkTTL {
+		return InviteLink{}, ErrInvalidInviteLink
+	}
+	now := s.now().UTC()
+	existing, err := s.repo.ListInviteLinks(ctx, owner)
+	if err != nil {
+		return InviteLink{}, err
+	}
+	active := 0
+	for _, link := range existing {
+		if link.Active(now) {
+			active++
+		}
+	}
+	if active >= MaxActiveInviteLinks {
+		return InviteLink{}, ErrInviteLinkLimit
+	}
+
+	nonce := make([]byte, inviteLinkNonceBytes)
+	if _, err := rand.Read(nonce); err != nil {
+		return InviteLink{}, err
+	}
+	link, err := s.repo.CreateInviteLink(ctx, InviteLink{
+		OwnerID:   owner,
+		Nonce:     hex.EncodeToString(nonce),
+		MaxUses:   maxUses,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return InviteLink{}, err
+	}
+	link.Code = s.code(link)
+	return link, nil
+}
+
+// ListInviteLinks returns owner's links with their codes, so a link can be
+// shared again.
+func (s *InviteLinkService) ListInviteLinks(ctx context.Context, owner UserID) ([]InviteLink, error) {
+	links, err := s.repo.ListInviteLinks(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	for i := range links {
+		links[i].Code = s.code(links[i])
+	}
+	return links, nil
+}
+
+func (s *InviteLinkService) RevokeInviteLink(ctx context.Context, id int64, owner UserID) error {
+	return s.repo.RevokeInviteLink(ctx, id, owner, s.now().UTC())
+}
+
+// RedeemInviteLink connects userID with the owner of the link code names and
+// returns the link. Every reason a code cannot be used, from a bad signature
+// to a link that ran out of uses, is ErrInviteLinkInvalid, so codes cannot be
+// probed.
+func (s *InviteLinkService) RedeemInviteLink(ctx context.Context, userID UserID, code string) (InviteLink, error) {
+	id, nonce, err := s.parse(code)
+	if err != nil {
+		return InviteLink{}, ErrInviteLinkInvalid
+	}
+	link, err := s.repo.GetInviteLink(ctx, id)
+	if errors.Is(err, ErrInviteLinkNotFound) {
+		return InviteLink{}, ErrInviteLinkInvalid
+	}
+	if err != nil {
+		return InviteLink{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(link.Nonce), []byte(nonce)) != 1 {
+		return InviteLink{}, ErrInviteLinkInvalid
+	}
+	if link.OwnerID == userID {
+		return InviteLink{}, ErrInviteLinkOwn
+	}
+	if err := s.repo.RedeemInviteLink(ctx, id, userID, s.now().UTC()); err != nil {
+		return InviteLink{}, err
+	}
+	link.Code = s.code(link)
+	return link, nil
+}
+
+// code is base64url(id || nonce || tag), where tag is a truncated
+// HMAC-SHA256 of id and nonce.
+func (s *InviteLinkService) code(link InviteLink) string {
+	nonce, err := hex.DecodeString(link.Nonce)
+	if err != nil || len(nonce) != inviteLinkNonceBytes {
+		return ""
+	}
+	payload := make([]byte, 8, 8+inviteLinkNonceBytes+inviteLinkTagBytes)
+	binary.BigEndian.PutUint64(payload, uint64(link.ID))
+	payload = append(payload, nonce...)
+	payload = append(payload, s.tag(payload)...)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func (s *InviteLinkService) parse(code string) (int64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(code)
+	if err != nil || len(raw) != 8+inviteLinkNonceBytes+inviteLinkTagBytes {
+		return 0, "", errInviteLinkMalformed
+	}
+	payload, tag := raw[:8+inviteLinkNonceBytes], raw[8+inviteLinkNonceBytes:]
+	if !hmac.Equal(tag, s.tag(payload)) {
+		return 0, "", errInviteLinkMalformed
+	}
+	id := int64(binary.BigEndian.Uint64(payload[:8]))
+	if id <= 0 {
+		return 0, "", errInviteLinkMalformed
+	}
+	return id, hex.EncodeToString(payload[8:]), nil
+}
+
+func (s *InviteLinkService) tag(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("invite-link."))
+	mac.Write(payload)
+	return mac.Sum(nil)[:inviteLinkTagBytes]
+}
@@ -0,0 +1,126 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeLinkRepo struct {
+	links    map[int64]*InviteLink
+	redeemed []UserID
+}
+
+func (f *fakeLinkRepo) CreateInviteLink(ctx context.Context, link InviteLink) (InviteLink, error) {
+	if f.links == nil {
+		f.links = map[int64]*InviteLink{}
+	}
+	link.ID = int64(len(f.links) + 1)
+	f.links[link.ID] = &link
+	return link, nil
+}
+
+func (f *fakeLinkRepo) ListInviteLinks(ctx context.Context, owner UserID) ([]InviteLink, error) {
+	out := make([]InviteLink, 0)
+	for _, link := range f.links {
+		if link.OwnerID == owner {
+			out = append(out, *link)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeLinkRepo) GetInviteLink(ctx context.Context, id int64) (InviteLink, error) {
+	link, ok := f.links[id]
+	if !ok {
+		return InviteLink{}, ErrInviteLinkNotFound
+	}
+	return *link, nil
+}
+
+func (f *fakeLinkRepo) RevokeInviteLink(ctx context.Context, id int64, owner UserID, at time.Time) error {
+	link, ok := f.links[id]
+	if !ok || link.OwnerID != owner {
+		return ErrInviteLinkNotFound
+	}
+	link.RevokedAt = &at
+	return nil
+}
+
+func (f *fakeLinkRepo) RedeemInviteLink(ctx context.Context, id int64, userID UserID, now time.Time) error {
+	f.redeemed = append(f.redeemed, userID)
+	return nil
+}
+
+func TestInviteLinkService_CodesAreSignedAndBoundToTheLink(t *testing.T) {
+	repo := &fakeLinkRepo{}
+	svc := NewInviteLinkService(repo, "0123456789abcdef0123456789abcdef")
+	ctx := context.Background()
+
+	link, err := svc.CreateInviteLink(ctx, 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.MaxUses != DefaultInviteLinkMaxUses || link.ExpiresAt.Sub(link.CreatedAt) != DefaultInviteLinkTTL || link.Code == "" {
+		t.Fatalf("link = %+v", link)
+	}
+
+	if _, err := svc.RedeemInviteLink(ctx, 1, link.Code); !errors.Is(err, ErrInviteLinkOwn) {
+		t.Fatalf("own link err = %v", err)
+	}
+	got, err := svc.RedeemInviteLink(ctx, 2, link.Code)
+	if err != nil || got.OwnerID != 1 || len(repo.redeemed) != 1 || repo.redeemed[0] != 2 {
+		t.Fatalf("redeem = %+v, %v, redeemed %v", got, err, repo.redeemed)
+	}
+
+	other := NewInviteLinkService(repo, "another-secret-another-secret-xx")
+	for name, code := range map[string]string{
+		"other key": other.code(*repo.links[link.ID]),
+		"truncated": link.Code[:len(link.Code)-4],
+		"garbage":   "not-a-code",
+		"empty":     "",
+	} {
+		if _, err := svc.RedeemInviteLink(ctx, 2, code); !errors.Is(err, ErrInviteLinkInvalid) {
+			t.Errorf("%s: err = %v, want ErrInviteLinkInvalid", name, err)
+		}
+	}
+
+	// A valid signature over a stale nonce, as after the row was replaced,
+	// must not redeem.
+	repo.links[link.ID].Nonce = "00000000000000ff"
+	if _, err := svc.RedeemInviteLink(ctx, 2, link.Code); !errors.Is(err, ErrInviteLinkInvalid) {
+		t.Fatalf("nonce mismatch err = %v", err)
+	}
+}
+
+func TestInviteLinkService_CreateValidatesAndLimitsActiveLinks(t *testing.T) {
+	repo := &fakeLinkRepo{}
+	svc := NewInviteLinkService(repo, "0123456789abcdef0123456789abcdef")
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		maxUses int
+		ttl     time.Duration
+	}{
+		{-1, 0}, {MaxInviteLinkUses + 1, 0}, {1, MaxInviteLinkTTL + time.Hour}, {1, -time.Hour},
+	} {
+		if _, err := svc.CreateInviteLink(ctx, 1, tc.maxUses, tc.ttl); !errors.Is(err, ErrInvalidInviteLink) {
+			t.Fatalf("CreateInviteLink(%d, %v) err = %v", tc.maxUses, tc.ttl, err)
+		}
+	}
+	for i := 0; i < MaxActiveInviteLinks; i++ {
+		if _, err := svc.CreateInviteLink(ctx, 1, 5, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.CreateInviteLink(ctx, 1, 5, time.Hour); !errors.Is(err, ErrInviteLinkLimit) {
+		t.Fatalf("over limit err = %v", err)
+	}
+	if err := svc.RevokeInviteLink(ctx, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreateInviteLink(ctx, 1, 5, time.Hour); err != nil {
+		t.Fatalf("create after revoke err = %v", err)
+	}
+}
@@ -14,6 +14,8 @@ type Service interface {
 	SendInviteByUsername(ctx context.Context, fromUser UserID, username string) error
 	ListInvites(ctx context.Context, userID UserID) ([]Invite, error)
 	RespondToInvite(ctx context.Context, inviteID int, userID UserID, status InviteStatus) error
+	ListOutgoingInvites(ctx context.Context, userID UserID) ([]Invite, error)
+	CancelInvite(ctx context.Context, inviteID int, userID UserID) error
 }
 
 type CoreService struct {
@@ -80,3 +82,11 @@ func (s *CoreService) RespondToInvite(ctx context.Context, inviteID int, userID
 	}
 	return err
 }
+
+func (s *CoreService) ListOutgoingInvites(ctx context.Context, userID UserID) ([]Invite, error) {
+	return s.repo.ListOutgoingInvites(ctx, userID)
+}
+
+func (s *CoreService) CancelInvite(ctx context.Context, inviteID int, userID UserID) error {
+	return s.repo.CancelInvite(ctx, inviteID, userID)
+}
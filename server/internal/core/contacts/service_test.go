@@ -58,6 +58,19 @@ func (f *fakeGraphRepo) UpdateInvite(ctx context.Context, inviteID int, userID U
 	return f.err
 }
 
+func (f *fakeGraphRepo) ListOutgoingInvites(ctx context.Context, userID UserID) ([]Invite, error) {
+	_ = ctx
+	f.lastUserID = userID
+	return f.invites, f.err
+}
+
+func (f *fakeGraphRepo) CancelInvite(ctx context.Context, inviteID int, userID UserID) error {
+	_ = ctx
+	f.lastInviteID = inviteID
+	f.lastUserID = userID
+	return f.err
+}
+
 func TestCoreService_ListContacts_DelegatesToRepository(t *testing.T) {
 	repo := &fakeGraphRepo{contacts: []Contact{{UserID: 2, Username: "bob"}}}
 	svc := NewService(repo, nil)
@@ -99,6 +112,18 @@ func TestCoreService_RespondToInvite_PropagatesErrors(t *testing.T) {
 	}
 }
 
+func TestCoreService_CancelInvite_PropagatesNotFound(t *testing.T) {
+	repo := &fakeGraphRepo{err: ErrInviteNotFound}
+	svc := NewService(repo, nil)
+
+	if err := svc.CancelInvite(context.Background(), 4, 2); !errors.Is(err, ErrInviteNotFound) {
+		t.Fatalf("expected ErrInviteNotFound, got %v", err)
+	}
+	if repo.lastInviteID != 4 || repo.lastUserID != 2 {
+		t.Fatalf("unexpected cancel call inviteID=%d userID=%d", repo.lastInviteID, repo.lastUserID)
+	}
+}
+
 type fakeUserDirectory struct {
 	userID UserID
 	err    error
@@ -0,0 +1,126 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	DefaultUnreadDelay = 30 * time.Minute
+	// EmailVerificationTTL bounds how long a verification link works.
+	EmailVerificationTTL = 24 * time.Hour
+	maxEmailLength       = 254
+)
+
+var (
+	ErrInvalidPreferences = errors.New("invalid notification preferences")
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrEmailNotVerified   = errors.New("email address is not verified")
+	ErrInvalidVerifyToken = errors.New("invalid or expired email verification token")
+)
+
+// Frequency is how often a user may receive a digest.
+type Frequency string
+
+const (
+	FrequencyHourly Frequency = "hourly"
+	FrequencyDaily  Frequency = "daily"
+)
+
+func (f Frequency) Interval() time.Duration {
+	if f == FrequencyHourly {
+		return time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Preferences are one user's email notification settings. A digest is only
+// sent to a verified address.
+type Preferences struct {
+	UserID          int
+	Email           string
+	EmailVerifiedAt *time.Time
+	DigestEnabled   bool
+	Frequency       Frequency
+	// UnreadDelay is how long a message must sit unread before a digest
+	// mentions it, so people chatting live are not emailed.
+	UnreadDelay      time.Duration
+	IncludeMessages  bool
+	IncludeInvites   bool
+	IncludeTransfers bool
+	LastSentAt       *time.Time
+	NextDigestAt     *time.Time
+}
+
+// Cursors record what earlier digests already covered, so each item is
+// reported once.
+type Cursors struct {
+	// MessagesBefore is the unread cutoff of the previous run: threads whose
+	// latest message is no newer than it were already considered.
+	MessagesBefore time.Time
+	TransfersAfter time.Time
+	LastInviteID   int
+}
+
+// Run is a claimed digest: the user's preferences and cursors.
+type Run struct {
+	Preferences Preferences
+	Cursors     Cursors
+}
+
+type Repository interface {
+	// GetPreferences returns defaults for a user who never saved any.
+	GetPreferences(ctx context.Context, userID int) (Preferences, error)
+	// SavePreferences stores everything but LastSentAt, the pending
+	// verification token and the cursors.
+	SavePreferences(ctx context.Context, prefs Preferences) error
+	SetEmailVerification(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// ConsumeEmailVerification marks the address verified when the token
+	// matches and has not expired.
+	ConsumeEmailVerification(ctx context.Context, tokenHash string, now time.Time) (int, error)
+
+	// ClaimDueDigests returns enabled, verified users whose next digest is
+	// due at now and pushes it to leaseUntil.
+	ClaimDueDigests(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Run, error)
+	// FinishDigest advances the cursors and schedules the next run. sentAt
+	// is nil when there was nothing to send.
+	FinishDigest(ctx context.Context, userID int, cursors Cursors, sentAt *time.Time, next time.Time) error
+}
+
+// UnreadThread is a conversation with messages the user has not read.
+type UnreadThread struct {
+	CounterpartyUsername string
+	UnreadCount          int
+	LastMessageAt        time.Time
+}
+
+type PendingInvite struct {
+	ID              int
+	InviterUsername string
+}
+
+type ReceivedTransfer struct {
+	FromUsername string
+	AmountCents  int64
+	CurrencyCode string
+	CreatedAt    time.Time
+}
+
+// Sources reads the activity a digest reports on.
+type Sources interface {
+	UnreadThreads(ctx context.Context, userID int) ([]UnreadThread, error)
+	PendingInvites(ctx context.Context, userID int) ([]PendingInvite, error)
+	ReceivedTransfers(ctx context.Context, userID int) ([]ReceivedTransfer, error)
+}
+
+// Mail is a plain-text message to one recipient.
+type Mail struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
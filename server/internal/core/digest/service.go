@@ -0,0 +1,399 @@
+package digest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	minUnreadDelay = 5 * time.Minute
+	maxUnreadDelay = 24 * time.Hour
+
+	defaultScheduleInterval = time.Minute
+	defaultScheduleBatch    = 50
+	digestLease             = 5 * time.Minute
+	// sendRetryDelay is the wait before a digest whose mail failed is
+	// attempted again with the same content.
+	sendRetryDelay = 15 * time.Minute
+)
+
+// Policy holds deployment settings shared by the service and the scheduler.
+type Policy struct {
+	// AppURL is the web client's base URL, used for links in mail.
+	AppURL string
+}
+
+type UpdateRequest struct {
+	Email            string
+	DigestEnabled    bool
+	Frequency        Frequency
+	UnreadDelay      time.Duration
+	IncludeMessages  bool
+	IncludeInvites   bool
+	IncludeTransfers bool
+}
+
+type Service interface {
+	GetPreferences(ctx context.Context, userID int) (Preferences, error)
+	// UpdatePreferences replaces the user's settings. A new address is sent
+	// a verification link and receives nothing else until it is verified.
+	UpdatePreferences(ctx context.Context, userID int, req UpdateRequest) (Preferences, error)
+	ResendVerification(ctx context.Context, userID int) error
+	// VerifyEmail confirms the address the token was sent to and returns
+	// its user. It needs no session, as the link may open in any browser.
+	VerifyEmail(ctx context.Context, token string) (int, error)
+}
+
+type service struct {
+	repo   Repository
+	mailer Mailer
+	policy Policy
+	now    func() time.Time
+}
+
+func NewService(repo Repository, mailer Mailer, policy Policy) Service {
+	return &service{repo: repo, mailer: mailer, policy: policy, now: time.Now}
+}
+
+func (s *service) GetPreferences(ctx context.Context, userID int) (Preferences, error) {
+	return s.repo.GetPreferences(ctx, userID)
+}
+
+func (s *service) UpdatePreferences(ctx context.Context, userID int, req UpdateRequest) (Preferences, error) {
+	current, err := s.repo.GetPreferences(ctx, userID)
+	if err != nil {
+		return Preferences{}, err
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return Preferences{}, err
+	}
+	if req.Frequency == "" {
+		req.Frequency = FrequencyDaily
+	}
+	if req.Frequency != FrequencyHourly && req.Frequency != FrequencyDaily {
+		return Preferences{}, fmt.Errorf("%w: frequency must be hourly or daily", ErrInvalidPreferences)
+	}
+	if req.UnreadDelay == 0 {
+		req.UnreadDelay = DefaultUnreadDelay
+	}
+	if req.UnreadDelay < minUnreadDelay || req.UnreadDelay > maxUnreadDelay {
+		return Preferences{}, fmt.Errorf("%w: unread delay must be between 5 minutes and 24 hours", ErrInvalidPreferences)
+	}
+	if req.DigestEnabled && email == "" {
+		return Preferences{}, fmt.Errorf("%w: digests need an email address", ErrInvalidPreferences)
+	}
+
+	prefs := Preferences{
+		UserID:           userID,
+		Email:            email,
+		EmailVerifiedAt:  current.EmailVerifiedAt,
+		DigestEnabled:    req.DigestEnabled,
+		Frequency:        req.Frequency,
+		UnreadDelay:      req.UnreadDelay,
+		IncludeMessages:  req.IncludeMessages,
+		IncludeInvites:   req.IncludeInvites,
+		IncludeTransfers: req.IncludeTransfers,
+		LastSentAt:       current.LastSentAt,
+		NextDigestAt:     current.NextDigestAt,
+	}
+	changed := email != current.Email
+	if changed {
+		prefs.EmailVerifiedAt = nil
+	}
+	now := s.now().UTC()
+	switch {
+	case !prefs.DigestEnabled:
+		prefs.NextDigestAt = nil
+	case prefs.NextDigestAt == nil || prefs.NextDigestAt.After(now.Add(prefs.Frequency.Interval())):
+		next := now.Add(prefs.UnreadDelay)
+		prefs.NextDigestAt = &next
+	}
+	if err := s.repo.SavePreferences(ctx, prefs); err != nil {
+		return Preferences{}, err
+	}
+	if changed && email != "" {
+		if err := s.sendVerification(ctx, prefs); err != nil {
+			return Preferences{}, err
+		}
+	}
+	return prefs, nil
+}
+
+func (s *service) ResendVerification(ctx context.Context, userID int) error {
+	prefs, err := s.repo.GetPreferences(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if prefs.Email == "" {
+		return ErrInvalidEmail
+	}
+	if prefs.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.sendVerification(ctx, prefs)
+}
+
+// sendVerification replaces any outstanding token; only its hash is stored.
+func (s *service) sendVerification(ctx context.Context, prefs Preferences) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	if err := s.repo.SetEmailVerification(ctx, prefs.UserID, hashToken(token), s.now().UTC().Add(EmailVerificationTTL)); err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, Mail{
+		To:      prefs.Email,
+		Subject: "Confirm your email address",
+		Text: "Confirm this address to receive activity digests:\n\n" +
+			appLink(s.policy.AppURL, "/verify-email", "token", token) + "\n\n" +
+			"The link expires in 24 hours. If you did not ask for this, ignore this email.\n",
+	})
+}
+
+func (s *service) VerifyEmail(ctx context.Context, token string) (int, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return 0, ErrInvalidVerifyToken
+	}
+	return s.repo.ConsumeEmailVerification(ctx, hashToken(token), s.now().UTC())
+}
+
+func normalizeEmail(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(raw)
+	if err != nil || addr.Name != "" || addr.Address != raw || len(raw) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+	local, domain, _ := strings.Cut(raw, "@")
+	return local + "@" + strings.ToLower(domain), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func appLink(base, path, key, value string) string {
+	u, err := url.Parse(strings.TrimRight(base, "/") + path)
+	if err != nil {
+		return ""
+	}
+	if key != "" {
+		q := u.Query()
+		q.Set(key, value)
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// Scheduler sends digests as they fall due. Each run reports only activity
+// that earlier digests did not: threads whose latest unread message became
+// old enough since the last run, invites newer than the last one reported,
+// and transfers received since the last run.
+type Scheduler struct {
+	repo     Repository
+	sources  Sources
+	mailer   Mailer
+	policy   Policy
+	now      func() time.Time
+	interval time.Duration
+	batch    int
+}
+
+func NewScheduler(repo Repository, sources Sources, mailer Mailer, policy Policy) *Scheduler {
+	return &Scheduler{
+		repo:     repo,
+		sources:  sources,
+		mailer:   mailer,
+		policy:   policy,
+		now:      time.Now,
+		interval: defaultScheduleInterval,
+		batch:    defaultScheduleBatch,
+	}
+}
+
+// Start runs the scheduler until ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			for {
+				n, err := s.RunDue(ctx)
+				if err != nil || n < s.batch {
+					break
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunDue claims one batch of due digests and sends them. It returns how many
+// were claimed.
+func (s *Scheduler) RunDue(ctx context.Context) (int, error) {
+	now := s.now().UTC()
+	runs, err := s.repo.ClaimDueDigests(ctx, now, now.Add(digestLease), s.batch)
+	if err != nil {
+		return 0, err
+	}
+	for _, run := range runs {
+		_ = s.run(ctx, run)
+	}
+	return len(runs), nil
+}
+
+type digestContent struct {
+	threads   []UnreadThread
+	invites   []PendingInvite
+	transfers []ReceivedTransfer
+}
+
+func (c digestContent) empty() bool {
+	return len(c.threads) == 0 && len(c.invites) == 0 && len(c.transfers) == 0
+}
+
+func (s *Scheduler) run(ctx context.Context, run Run) error {
+	prefs := run.Preferences
+	now := s.now().UTC()
+	next := run.Cursors
+	var content digestContent
+
+	if prefs.IncludeMessages {
+		cutoff := now.Add(-prefs.UnreadDelay)
+		threads, err := s.sources.UnreadThreads(ctx, prefs.UserID)
+		if err != nil {
+			return s.retry(ctx, run, now, err)
+		}
+		for _, t := range threads {
+			if t.UnreadCount > 0 && t.LastMessageAt.After(run.Cursors.MessagesBefore) && !t.LastMessageAt.After(cutoff) {
+				content.threads = append(content.threads, t)
+			}
+		}
+		if cutoff.After(next.MessagesBefore) {
+			next.MessagesBefore = cutoff
+		}
+	}
+	if prefs.IncludeInvites {
+		invites, err := s.sources.PendingInvites(ctx, prefs.UserID)
+		if err != nil {
+			return s.retry(ctx, run, now, err)
+		}
+		for _, inv := range invites {
+			if inv.ID > run.Cursors.LastInviteID {
+				content.invites = append(content.invites, inv)
+				if inv.ID > next.LastInviteID {
+					next.LastInviteID = inv.ID
+				}
+			}
+		}
+	}
+	if prefs.IncludeTransfers {
+		transfers, err := s.sources.ReceivedTransfers(ctx, prefs.UserID)
+		if err != nil {
+			return s.retry(ctx, run, now, err)
+		}
+		for _, tr := range transfers {
+			if tr.CreatedAt.After(run.Cursors.TransfersAfter) && !tr.CreatedAt.After(now) {
+				content.transfers = append(content.transfers, tr)
+			}
+		}
+		next.TransfersAfter = now
+	}
+
+	var sentAt *time.Time
+	if !content.empty() {
+		subject, text := compose(content, s.policy.AppURL)
+		if err := s.mailer.Send(ctx, Mail{To: prefs.Email, Subject: subject, Text: text}); err != nil {
+			return s.retry(ctx, run, now, err)
+		}
+		sentAt = &now
+	}
+	return s.repo.FinishDigest(ctx, prefs.UserID, next, sentAt, now.Add(prefs.Frequency.Interval()))
+}
+
+// retry keeps the cursors so the next attempt reports the same activity.
+func (s *Scheduler) retry(ctx context.Context, run Run, now time.Time, cause error) error {
+	if err := s.repo.FinishDigest(ctx, run.Preferences.UserID, run.Cursors, nil, now.Add(sendRetryDelay)); err != nil {
+		return err
+	}
+	return cause
+}
+
+// compose renders a digest. It names people and counts but never includes
+// message content, which may be end-to-end encrypted.
+func compose(c digestContent, appURL string) (string, string) {
+	var parts []string
+	var b strings.Builder
+	b.WriteString("Here is what happened while you were away.\n")
+
+	if len(c.threads) > 0 {
+		total := 0
+		b.WriteString("\nUnread messages:\n")
+		for _, t := range c.threads {
+			total += t.UnreadCount
+			fmt.Fprintf(&b, "- %s: %s\n", t.CounterpartyUsername, plural(t.UnreadCount, "unread message"))
+		}
+		parts = append(parts, plural(total, "unread message"))
+	}
+	if len(c.invites) > 0 {
+		b.WriteString("\nContact invites:\n")
+		for _, inv := range c.invites {
+			fmt.Fprintf(&b, "- %s wants to add you as a contact\n", inv.InviterUsername)
+		}
+		parts = append(parts, plural(len(c.invites), "contact invite"))
+	}
+	if len(c.transfers) > 0 {
+		b.WriteString("\nMoney received:\n")
+		for _, tr := range c.transfers {
+			fmt.Fprintf(&b, "- %s from %s\n", formatAmount(tr.AmountCents, tr.CurrencyCode), tr.FromUsername)
+		}
+		parts = append(parts, plural(len(c.transfers), "payment"))
+	}
+
+	if appURL != "" {
+		fmt.Fprintf(&b, "\nOpen the app: %s\n", appLink(appURL, "", "", ""))
+		fmt.Fprintf(&b, "Change or stop these emails: %s\n", appLink(appURL, "/settings/notifications", "", ""))
+	}
+	return "You have " + joinParts(parts), b.String()
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func joinParts(parts []string) string {
+	if len(parts) <= 1 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+func formatAmount(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s%d.%02d %s", sign, cents/100, cents%100, currency))
+}
@@ -0,0 +1,353 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type storedPrefs struct {
+	prefs      Preferences
+	cursors    Cursors
+	verifyHash string
+	verifyExp  time.Time
+}
+
+type fakeRepo struct {
+	users map[int]*storedPrefs
+}
+
+func newFakeRepo() *fakeRepo { return &fakeRepo{users: map[int]*storedPrefs{}} }
+
+func (f *fakeRepo) GetPreferences(ctx context.Context, userID int) (Preferences, error) {
+	if u, ok := f.users[userID]; ok {
+		return u.prefs, nil
+	}
+	return Preferences{UserID: userID, Frequency: FrequencyDaily, UnreadDelay: DefaultUnreadDelay, IncludeMessages: true, IncludeInvites: true, IncludeTransfers: true}, nil
+}
+
+func (f *fakeRepo) SavePreferences(ctx context.Context, prefs Preferences) error {
+	u, ok := f.users[prefs.UserID]
+	if !ok {
+		u = &storedPrefs{}
+		f.users[prefs.UserID] = u
+	}
+	if u.prefs.Email != prefs.Email {
+		u.verifyHash = ""
+	}
+	prefs.LastSentAt = u.prefs.LastSentAt
+	u.prefs = prefs
+	return nil
+}
+
+func (f *fakeRepo) SetEmailVerification(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	u, ok := f.users[userID]
+	if !ok || u.prefs.Email == "" {
+		return ErrInvalidEmail
+	}
+	u.verifyHash, u.verifyExp = tokenHash, expiresAt
+	return nil
+}
+
+func (f *fakeRepo) ConsumeEmailVerification(ctx context.Context, tokenHash string, now time.Time) (int, error) {
+	for id, u := range f.users {
+		if u.verifyHash != "" && u.verifyHash == tokenHash && u.verifyExp.After(now) {
+			u.verifyHash = ""
+			u.prefs.EmailVerifiedAt = &now
+			return id, nil
+		}
+	}
+	return 0, ErrInvalidVerifyToken
+}
+
+func (f *fakeRepo) ClaimDueDigests(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Run, error) {
+	var out []Run
+	for _, u := range f.users {
+		p := u.prefs
+		if p.DigestEnabled && p.EmailVerifiedAt != nil && p.NextDigestAt != nil && !p.NextDigestAt.After(now) {
+			lease := leaseUntil
+			u.prefs.NextDigestAt = &lease
+			out = append(out, Run{Preferences: p, Cursors: u.cursors})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) FinishDigest(ctx context.Context, userID int, cursors Cursors, sentAt *time.Time, next time.Time) error {
+	u := f.users[userID]
+	u.cursors = cursors
+	if sentAt != nil {
+		u.prefs.LastSentAt = sentAt
+	}
+	u.prefs.NextDigestAt = &next
+	return nil
+}
+
+type fakeSources struct {
+	threads   []UnreadThread
+	invites   []PendingInvite
+	transfers []ReceivedTransfer
+}
+
+func (f *fakeSources) UnreadThreads(context.Context, int) ([]UnreadThread, error) {
+	return f.threads, nil
+}
+func (f *fakeSources) PendingInvites(context.Context, int) ([]PendingInvite, error) {
+	return f.invites, nil
+}
+func (f *fakeSources) ReceivedTransfers(context.Context, int) ([]ReceivedTransfer, error) {
+	return f.transfers, nil
+}
+
+type fakeMailer struct {
+	sent []Mail
+	err  error
+}
+
+func (f *fakeMailer) Send(ctx context.Context, m Mail) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+type harness struct {
+	repo      *fakeRepo
+	sources   *fakeSources
+	mailer    *fakeMailer
+	service   *service
+	scheduler *Scheduler
+	now       time.Time
+}
+
+func newHarness() *harness {
+	h := &harness{repo: newFakeRepo(), sources: &fakeSources{}, mailer: &fakeMailer{}, now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	policy := Policy{AppURL: "https://chat.example.com/"}
+	clock := func() time.Time { return h.now }
+	h.service = NewService(h.repo, h.mailer, policy).(*service)
+	h.service.now = clock
+	h.scheduler = NewScheduler(h.repo, h.sources, h.mailer, policy)
+	h.scheduler.now = clock
+	return h
+}
+
+func tokenFromMail(t *testing.T, m Mail) string {
+	t.Helper()
+	for _, line := range strings.Split(m.Text, "\n") {
+		if u, err := url.Parse(line); err == nil && u.Query().Get("token") != "" {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatalf("no verification link in %q", m.Text)
+	return ""
+}
+
+// enable saves digest preferences for user 1 and verifies the address.
+func (h *harness) enable(t *testing.T, req UpdateRequest) {
+	t.Helper()
+	ctx := context.Background()
+	req.Email, req.DigestEnabled = "alice@Example.COM", true
+	if _, err := h.service.UpdatePreferences(ctx, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.service.VerifyEmail(ctx, tokenFromMail(t, h.mailer.sent[len(h.mailer.sent)-1])); err != nil {
+		t.Fatal(err)
+	}
+	h.mailer.sent = nil
+}
+
+func TestUpdatePreferences_Validation(t *testing.T) {
+	h := newHarness()
+	ctx := context.Background()
+	cases := []struct {
+		req  UpdateRequest
+		want error
+	}{
+		{UpdateRequest{Email: "Alice <alice@example.com>"}, ErrInvalidEmail},
+		{UpdateRequest{Email: "not-an-address"}, ErrInvalidEmail},
+		{UpdateRequest{Email: strings.Repeat("a", 250) + "@example.com"}, ErrInvalidEmail},
+		{UpdateRequest{DigestEnabled: true}, ErrInvalidPreferences},
+		{UpdateRequest{Email: "alice@example.com", Frequency: "weekly"}, ErrInvalidPreferences},
+		{UpdateRequest{Email: "alice@example.com", UnreadDelay: time.Minute}, ErrInvalidPreferences},
+		{UpdateRequest{Email: "alice@example.com", UnreadDelay: 48 * time.Hour}, ErrInvalidPreferences},
+	}
+	for _, tc := range cases {
+		if _, err := h.service.UpdatePreferences(ctx, 1, tc.req); !errors.Is(err, tc.want) {
+			t.Errorf("UpdatePreferences(%+v) err = %v, want %v", tc.req, err, tc.want)
+		}
+	}
+	if len(h.mailer.sent) != 0 {
+		t.Fatalf("mail sent for invalid preferences: %+v", h.mailer.sent)
+	}
+}
+
+func TestUpdatePreferences_VerifiesNewAddress(t *testing.T) {
+	h := newHarness()
+	ctx := context.Background()
+
+	prefs, err := h.service.UpdatePreferences(ctx, 1, UpdateRequest{Email: " alice@Example.COM ", DigestEnabled: true, IncludeMessages: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefs.Email != "alice@example.com" || prefs.EmailVerifiedAt != nil || prefs.Frequency != FrequencyDaily || prefs.UnreadDelay != DefaultUnreadDelay {
+		t.Fatalf("prefs = %+v", prefs)
+	}
+	if prefs.NextDigestAt == nil || !prefs.NextDigestAt.Equal(h.now.Add(DefaultUnreadDelay)) {
+		t.Fatalf("next digest = %v", prefs.NextDigestAt)
+	}
+	if len(h.mailer.sent) != 1 || h.mailer.sent[0].To != "alice@example.com" ||
+		!strings.Contains(h.mailer.sent[0].Text, "https://chat.example.com/verify-email?token=") {
+		t.Fatalf("verification mail = %+v", h.mailer.sent)
+	}
+	token := tokenFromMail(t, h.mailer.sent[0])
+	if h.repo.users[1].verifyHash == token || h.repo.users[1].verifyHash != hashToken(token) {
+		t.Fatal("verification token must be stored hashed")
+	}
+
+	// Saving the same address again neither resets verification nor re-sends.
+	if _, err := h.service.VerifyEmail(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	prefs, err = h.service.UpdatePreferences(ctx, 1, UpdateRequest{Email: "alice@example.com", DigestEnabled: true, Frequency: FrequencyHourly})
+	if err != nil || prefs.EmailVerifiedAt == nil || len(h.mailer.sent) != 1 {
+		t.Fatalf("same address = %+v, %v, mails %d", prefs, err, len(h.mailer.sent))
+	}
+	if err := h.service.ResendVerification(ctx, 1); err != nil || len(h.mailer.sent) != 1 {
+		t.Fatalf("resend for verified address err = %v, mails %d", err, len(h.mailer.sent))
+	}
+
+	// A new address starts unverified and the old token is useless.
+	prefs, err = h.service.UpdatePreferences(ctx, 1, UpdateRequest{Email: "alice@example.org", DigestEnabled: true})
+	if err != nil || prefs.EmailVerifiedAt != nil || len(h.mailer.sent) != 2 {
+		t.Fatalf("new address = %+v, %v, mails %d", prefs, err, len(h.mailer.sent))
+	}
+	if _, err := h.service.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidVerifyToken) {
+		t.Fatalf("old token err = %v", err)
+	}
+	h.now = h.now.Add(EmailVerificationTTL + time.Minute)
+	if _, err := h.service.VerifyEmail(ctx, tokenFromMail(t, h.mailer.sent[1])); !errors.Is(err, ErrInvalidVerifyToken) {
+		t.Fatalf("expired token err = %v", err)
+	}
+	if err := h.service.ResendVerification(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	userID, err := h.service.VerifyEmail(ctx, tokenFromMail(t, h.mailer.sent[2]))
+	if err != nil || userID != 1 {
+		t.Fatalf("verify = %d, %v", userID, err)
+	}
+
+	if err := h.service.ResendVerification(ctx, 2); !errors.Is(err, ErrInvalidEmail) {
+		t.Fatalf("resend without address err = %v", err)
+	}
+}
+
+func TestScheduler_ReportsEachItemOnce(t *testing.T) {
+	h := newHarness()
+	ctx := context.Background()
+	h.enable(t, UpdateRequest{IncludeMessages: true, IncludeInvites: true, IncludeTransfers: true})
+
+	h.sources.threads = []UnreadThread{
+		{CounterpartyUsername: "bob", UnreadCount: 2, LastMessageAt: h.now.Add(-10 * time.Minute)},
+		// Too recent: the user may still be chatting.
+		{CounterpartyUsername: "carol", UnreadCount: 1, LastMessageAt: h.now.Add(20 * time.Minute)},
+		{CounterpartyUsername: "dave", UnreadCount: 0, LastMessageAt: h.now.Add(-time.Hour)},
+	}
+	h.sources.invites = []PendingInvite{{ID: 4, InviterUsername: "erin"}}
+	h.sources.transfers = []ReceivedTransfer{{FromUsername: "bob", AmountCents: 1250, CurrencyCode: "KES", CreatedAt: h.now.Add(-time.Hour)}}
+
+	h.now = h.now.Add(DefaultUnreadDelay)
+	if n, err := h.scheduler.RunDue(ctx); err != nil || n != 1 {
+		t.Fatalf("RunDue = %d, %v", n, err)
+	}
+	if len(h.mailer.sent) != 1 {
+		t.Fatalf("sent = %+v", h.mailer.sent)
+	}
+	m := h.mailer.sent[0]
+	if m.To != "alice@example.com" || m.Subject != "You have 2 unread messages, 1 contact invite and 1 payment" {
+		t.Fatalf("mail = %+v", m)
+	}
+	for _, want := range []string{"- bob: 2 unread messages", "- erin wants to add you", "- 12.50 KES from bob", "https://chat.example.com/settings/notifications"} {
+		if !strings.Contains(m.Text, want) {
+			t.Fatalf("digest missing %q:\n%s", want, m.Text)
+		}
+	}
+	if strings.Contains(m.Text, "carol") || strings.Contains(m.Text, "dave") {
+		t.Fatalf("digest reported threads it should not:\n%s", m.Text)
+	}
+
+	// Nothing is due until the frequency interval has passed.
+	h.now = h.now.Add(time.Hour)
+	if n, _ := h.scheduler.RunDue(ctx); n != 0 {
+		t.Fatalf("claimed %d digests before the interval", n)
+	}
+
+	// The next run reports carol's thread, now old enough, and only new items.
+	h.now = h.now.Add(24 * time.Hour)
+	h.sources.invites = append(h.sources.invites, PendingInvite{ID: 9, InviterUsername: "frank"})
+	if _, err := h.scheduler.RunDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.mailer.sent) != 2 {
+		t.Fatalf("sent = %+v", h.mailer.sent)
+	}
+	m = h.mailer.sent[1]
+	if m.Subject != "You have 1 unread message and 1 contact invite" ||
+		!strings.Contains(m.Text, "carol") || strings.Contains(m.Text, "bob") || strings.Contains(m.Text, "erin") {
+		t.Fatalf("second digest = %+v", m)
+	}
+
+	// With nothing new, no mail is sent but the schedule still advances.
+	h.now = h.now.Add(25 * time.Hour)
+	if n, err := h.scheduler.RunDue(ctx); err != nil || n != 1 || len(h.mailer.sent) != 2 {
+		t.Fatalf("empty run = %d, %v, mails %d", n, err, len(h.mailer.sent))
+	}
+	if next := h.repo.users[1].prefs.NextDigestAt; next == nil || !next.Equal(h.now.Add(24*time.Hour)) {
+		t.Fatalf("next digest = %v", next)
+	}
+}
+
+func TestScheduler_RetriesFailedMail(t *testing.T) {
+	h := newHarness()
+	ctx := context.Background()
+	h.enable(t, UpdateRequest{IncludeInvites: true, Frequency: FrequencyHourly})
+	h.sources.invites = []PendingInvite{{ID: 3, InviterUsername: "bob"}}
+
+	h.now = h.now.Add(DefaultUnreadDelay)
+	h.mailer.err = errors.New("relay down")
+	if _, err := h.scheduler.RunDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	u := h.repo.users[1]
+	if u.cursors.LastInviteID != 0 || u.prefs.LastSentAt != nil || !u.prefs.NextDigestAt.Equal(h.now.Add(sendRetryDelay)) {
+		t.Fatalf("after failure = %+v %+v", u.prefs, u.cursors)
+	}
+
+	h.mailer.err = nil
+	h.now = h.now.Add(sendRetryDelay)
+	if _, err := h.scheduler.RunDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.mailer.sent) != 1 || !strings.Contains(h.mailer.sent[0].Text, "bob wants to add you") || u.cursors.LastInviteID != 3 {
+		t.Fatalf("retry = %+v, cursors %+v", h.mailer.sent, u.cursors)
+	}
+	if !u.prefs.NextDigestAt.Equal(h.now.Add(time.Hour)) {
+		t.Fatalf("next digest = %v", u.prefs.NextDigestAt)
+	}
+}
+
+func TestScheduler_SkipsUnverifiedAddresses(t *testing.T) {
+	h := newHarness()
+	ctx := context.Background()
+	if _, err := h.service.UpdatePreferences(ctx, 1, UpdateRequest{Email: "alice@example.com", DigestEnabled: true, IncludeInvites: true}); err != nil {
+		t.Fatal(err)
+	}
+	h.sources.invites = []PendingInvite{{ID: 1, InviterUsername: "bob"}}
+	h.now = h.now.Add(48 * time.Hour)
+	if n, err := h.scheduler.RunDue(ctx); err != nil || n != 0 || len(h.mailer.sent) != 1 {
+		t.Fatalf("RunDue = %d, %v, mails %+v", n, err, h.mailer.sent)
+	}
+}
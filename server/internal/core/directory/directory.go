@@ -0,0 +1,96 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	MinQueryRunes = 2
+	MaxQueryRunes = 64
+	DefaultLimit  = 20
+	MaxLimit      = 50
+	// minTypoRunes is the shortest query matched with a typo; shorter
+	// ones would match most of the directory.
+	minTypoRunes = 4
+	// candidateLimit bounds the rows ranked per search, so a short query on
+	// a large directory stays cheap.
+	candidateLimit = 200
+)
+
+var (
+	ErrInvalidQuery           = errors.New("query must be 2 to 64 characters")
+	ErrInvalidDiscoverability = errors.New("discoverability must be everyone, username or nobody")
+	ErrUserNotFound           = errors.New("user not found")
+)
+
+// Discoverability is who may find a user through search. It does not affect
+// invites sent to an exact username.
+type Discoverability string
+
+const (
+	// DiscoverEveryone matches the user on username and display name
+	// prefixes and near misses.
+	DiscoverEveryone Discoverability = "everyone"
+	// DiscoverUsername matches the user only on their exact username.
+	DiscoverUsername Discoverability = "username"
+	// DiscoverNobody keeps the user out of search results.
+	DiscoverNobody Discoverability = "nobody"
+)
+
+func (d Discoverability) Valid() bool {
+	return d == DiscoverEveryone || d == DiscoverUsername || d == DiscoverNobody
+}
+
+// Relationship is how a search result relates to the user searching.
+type Relationship string
+
+const (
+	RelationshipNone           Relationship = "none"
+	RelationshipContact        Relationship = "contact"
+	RelationshipInviteSent     Relationship = "invite_sent"
+	RelationshipInviteReceived Relationship = "invite_received"
+)
+
+// Candidate is a user the repository found for a search term, with its
+// relationship to the searcher.
+type Candidate struct {
+	UserID      int
+	Username    string
+	DisplayName string
+	AvatarURL   string
+	IsContact   bool
+	// SentInviteID and ReceivedInviteID are the pending, unexpired invites
+	// from and to the searcher, or zero.
+	SentInviteID     int
+	ReceivedInviteID int
+}
+
+// Result is one ranked search hit.
+type Result struct {
+	UserID       int
+	Username     string
+	DisplayName  string
+	AvatarURL    string
+	Relationship Relationship
+	// InviteID is the pending invite behind an invite_sent or
+	// invite_received relationship, so the client can cancel or accept it.
+	InviteID int
+}
+
+type Repository interface {
+	// GetDiscoverability and SetDiscoverability return ErrUserNotFound for
+	// an unknown or deleted account.
+	GetDiscoverability(ctx context.Context, userID int) (Discoverability, error)
+	SetDiscoverability(ctx context.Context, userID int, d Discoverability) error
+	// SearchCandidates returns up to limit users other than searcherID that
+	// may match term, which is lower case. It returns users whose
+	// discoverability is everyone and whose lower-cased username or display
+	// name contains the runes of term in order or whose username starts
+	// with the first rune of term, best prefix matches first; and users
+	// whose discoverability is username and whose lower-cased username
+	// equals term. Deleted accounts are never returned. Invites
+	// count as pending only while unexpired at now.
+	SearchCandidates(ctx context.Context, searcherID int, term string, now time.Time, limit int) ([]Candidate, error)
+}
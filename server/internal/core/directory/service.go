@@ -0,0 +1,210 @@
+package directory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Match tiers, best first. A candidate matching none of them is dropped.
+const (
+	tierExactUsername = iota
+	tierUsernamePrefix
+	tierDisplayNamePrefix
+	tierSubstring
+	tierTypo
+	tierSubsequence
+	noMatch
+)
+
+type Service interface {
+	// Search ranks the users userID may find for query: exact username
+	// first, then prefixes, substrings, usernames one typo away from the
+	// query and finally names containing the query's characters in order.
+	Search(ctx context.Context, userID int, query string, limit int) ([]Result, error)
+	GetDiscoverability(ctx context.Context, userID int) (Discoverability, error)
+	SetDiscoverability(ctx context.Context, userID int, d Discoverability) error
+}
+
+type service struct {
+	repo Repository
+	now  func() time.Time
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo, now: time.Now}
+}
+
+func (s *service) Search(ctx context.Context, userID int, query string, limit int) ([]Result, error) {
+	term := NormalizeQuery(query)
+	if n := utf8.RuneCountInString(term); n < MinQueryRunes || n > MaxQueryRunes {
+		return nil, ErrInvalidQuery
+	}
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	candidates, err := s.repo.SearchCandidates(ctx, userID, term, s.now().UTC(), candidateLimit)
+	if err != nil {
+		return nil, err
+	}
+	type ranked struct {
+		tier      int
+		candidate Candidate
+	}
+	matches := make([]ranked, 0, len(candidates))
+	for _, c := range candidates {
+		if tier := matchTier(term, c); tier != noMatch {
+			matches = append(matches, ranked{tier: tier, candidate: c})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.tier != b.tier {
+			return a.tier < b.tier
+		}
+		if la, lb := len(a.candidate.Username), len(b.candidate.Username); la != lb {
+			return la < lb
+		}
+		return a.candidate.Username < b.candidate.Username
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	results := make([]Result, 0, len(matches))
+	for _, m := range matches {
+		results = append(results, toResult(m.candidate))
+	}
+	return results, nil
+}
+
+func (s *service) GetDiscoverability(ctx context.Context, userID int) (Discoverability, error) {
+	return s.repo.GetDiscoverability(ctx, userID)
+}
+
+func (s *service) SetDiscoverability(ctx context.Context, userID int, d Discoverability) error {
+	if !d.Valid() {
+		return ErrInvalidDiscoverability
+	}
+	return s.repo.SetDiscoverability(ctx, userID, d)
+}
+
+// NormalizeQuery trims query, drops a leading @ and lower-cases it.
+func NormalizeQuery(query string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(query), "@"))
+}
+
+func matchTier(term string, c Candidate) int {
+	username := strings.ToLower(c.Username)
+	displayName := strings.ToLower(c.DisplayName)
+	switch {
+	case username == term:
+		return tierExactUsername
+	case strings.HasPrefix(username, term):
+		return tierUsernamePrefix
+	case displayName != "" && hasWordPrefix(displayName, term):
+		return tierDisplayNamePrefix
+	case strings.Contains(username, term) || strings.Contains(displayName, term):
+		return tierSubstring
+	case typoPrefix(username, term):
+		return tierTypo
+	case isSubsequence(term, username) || isSubsequence(term, displayName):
+		return tierSubsequence
+	}
+	return noMatch
+}
+
+func hasWordPrefix(name, term string) bool {
+	if strings.HasPrefix(name, term) {
+		return true
+	}
+	for _, word := range strings.Fields(name) {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// typoPrefix reports whether term is one edit away from username or from
+// the start of it, so a query can be a mistyped, partly typed name.
+func typoPrefix(username, term string) bool {
+	runes := []rune(username)
+	n := utf8.RuneCountInString(term)
+	if n < minTypoRunes {
+		return false
+	}
+	for _, size := range []int{n - 1, n, n + 1} {
+		if size > 0 && size <= len(runes) && withinOneEdit(string(runes[:size]), term) {
+			return true
+		}
+	}
+	return false
+}
+
+// withinOneEdit reports whether a and b differ by at most one insertion,
+// deletion, substitution or swap of adjacent runes.
+func withinOneEdit(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < len(rb) {
+		ra, rb = rb, ra
+	}
+	if len(ra)-len(rb) > 1 {
+		return false
+	}
+	i := 0
+	for i < len(rb) && ra[i] == rb[i] {
+		i++
+	}
+	if i == len(rb) {
+		return true
+	}
+	if len(ra) == len(rb) {
+		if string(ra[i+1:]) == string(rb[i+1:]) {
+			return true
+		}
+		return i+1 < len(ra) && ra[i] == rb[i+1] && ra[i+1] == rb[i] && string(ra[i+2:]) == string(rb[i+2:])
+	}
+	return string(ra[i+1:]) == string(rb[i:])
+}
+
+func isSubsequence(term, s string) bool {
+	if s == "" {
+		return false
+	}
+	rest := []rune(term)
+	for _, r := range s {
+		if len(rest) == 0 {
+			break
+		}
+		if r == rest[0] {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
+
+func toResult(c Candidate) Result {
+	r := Result{
+		UserID:       c.UserID,
+		Username:     c.Username,
+		DisplayName:  c.DisplayName,
+		AvatarURL:    c.AvatarURL,
+		Relationship: RelationshipNone,
+	}
+	switch {
+	case c.IsContact:
+		r.Relationship = RelationshipContact
+	case c.ReceivedInviteID != 0:
+		r.Relationship, r.InviteID = RelationshipInviteReceived, c.ReceivedInviteID
+	case c.SentInviteID != 0:
+		r.Relationship, r.InviteID = RelationshipInviteSent, c.SentInviteID
+	}
+	return r
+}
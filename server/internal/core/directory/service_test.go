@@ -0,0 +1,117 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeRepo struct {
+	candidates []Candidate
+	settings   map[int]Discoverability
+	lastTerm   string
+}
+
+func (f *fakeRepo) GetDiscoverability(ctx context.Context, userID int) (Discoverability, error) {
+	if d, ok := f.settings[userID]; ok {
+		return d, nil
+	}
+	return DiscoverEveryone, nil
+}
+
+func (f *fakeRepo) SetDiscoverability(ctx context.Context, userID int, d Discoverability) error {
+	if f.settings == nil {
+		f.settings = map[int]Discoverability{}
+	}
+	f.settings[userID] = d
+	return nil
+}
+
+func (f *fakeRepo) SearchCandidates(ctx context.Context, searcherID int, term string, now time.Time, limit int) ([]Candidate, error) {
+	f.lastTerm = term
+	return f.candidates, nil
+}
+
+func TestService_SearchRanksMatchesAndAnnotatesRelationships(t *testing.T) {
+	repo := &fakeRepo{candidates: []Candidate{
+		{UserID: 1, Username: "malice"},
+		{UserID: 2, Username: "alicia", SentInviteID: 7},
+		{UserID: 3, Username: "bob", DisplayName: "Alice Bobson", ReceivedInviteID: 9},
+		{UserID: 4, Username: "Alice", IsContact: true, SentInviteID: 3},
+		{UserID: 5, Username: "alcie"},
+		{UserID: 6, Username: "a_l_i_c_e"},
+		{UserID: 7, Username: "zed"},
+	}}
+	svc := NewService(repo)
+
+	results, err := svc.Search(context.Background(), 100, "  @ALIC ", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.lastTerm != "alic" {
+		t.Fatalf("term = %q", repo.lastTerm)
+	}
+	want := []int{4, 2, 3, 1, 5, 6}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v", results)
+	}
+	for i, id := range want {
+		if results[i].UserID != id {
+			t.Fatalf("result %d = %+v, want user %d", i, results[i], id)
+		}
+	}
+	if results[0].Relationship != RelationshipContact || results[0].InviteID != 0 {
+		t.Fatalf("contact = %+v", results[0])
+	}
+	if results[1].Relationship != RelationshipInviteSent || results[1].InviteID != 7 {
+		t.Fatalf("sent = %+v", results[1])
+	}
+	if results[2].Relationship != RelationshipInviteReceived || results[2].InviteID != 9 {
+		t.Fatalf("received = %+v", results[2])
+	}
+
+	if limited, _ := svc.Search(context.Background(), 100, "alic", 2); len(limited) != 2 {
+		t.Fatalf("limit 2 returned %d", len(limited))
+	}
+	for _, q := range []string{"", "a", "@b", string(make([]byte, MaxQueryRunes+1))} {
+		if _, err := svc.Search(context.Background(), 100, q, 0); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("Search(%q) err = %v", q, err)
+		}
+	}
+}
+
+func TestService_SetDiscoverabilityValidates(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	if err := svc.SetDiscoverability(ctx, 1, "friends"); !errors.Is(err, ErrInvalidDiscoverability) {
+		t.Fatalf("err = %v", err)
+	}
+	if err := svc.SetDiscoverability(ctx, 1, DiscoverNobody); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := svc.GetDiscoverability(ctx, 1); err != nil || d != DiscoverNobody {
+		t.Fatalf("GetDiscoverability = %q, %v", d, err)
+	}
+}
+
+func TestWithinOneEdit(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"alice", "alice", true},
+		{"alice", "alcie", true},
+		{"alice", "alise", true},
+		{"alice", "alie", true},
+		{"alice", "alicee", true},
+		{"alice", "alcei", false},
+		{"alice", "al", false},
+	} {
+		if got := withinOneEdit(tc.a, tc.b); got != tc.want {
+			t.Errorf("withinOneEdit(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidAPIToken        = errors.New("invalid api token")
+	ErrInvalidAPITokenRequest = errors.New("token name is required (at most 64 characters)")
+	ErrInvalidAPITokenExpiry  = errors.New("token expiry must be between 0 and 365 days")
+	ErrInvalidScope           = errors.New("unknown scope")
+	ErrAPITokenNotFound       = errors.New("api token not found")
+	ErrAPITokenLimitReached   = errors.New("api token limit reached")
+	ErrInvalidBotUsername     = errors.New("bot username must be 3-32 letters, digits, '.', '_' or '-'")
+	ErrUsernameTaken          = errors.New("username already taken")
+	ErrBotNotFound            = errors.New("bot not found")
+	ErrBotLimitReached        = errors.New("bot limit reached")
+)
+
+// Scopes an API token can be granted. Interactive sessions hold all of them;
+// routes that declare none are closed to API tokens.
+const (
+	ScopeMessagesRead = "messages:read"
+	ScopeMessagesSend = "messages:send"
+	ScopeWalletRead   = "wallet:read"
+)
+
+var APITokenScopes = []string{ScopeMessagesRead, ScopeMessagesSend, ScopeWalletRead}
+
+const (
+	// APITokenPrefix marks API tokens so they can be told apart from JWTs
+	// without a lookup, and makes leaked tokens easy to grep for.
+	APITokenPrefix      = "gcs_"
+	MaxAPITokensPerUser = 50
+	MaxBotsPerOwner     = 10
+	MaxAPITokenLifetime = 365 * 24 * time.Hour
+	maxAPITokenNameLen  = 64
+	// apiTokenTouchInterval limits last_used_at writes for busy tokens.
+	apiTokenTouchInterval = time.Minute
+)
+
+// APIToken is a long-lived bearer credential. The secret is shown once at
+// creation and only its SHA-256 hash is stored.
+type APIToken struct {
+	ID         int64
+	UserID     UserID
+	Bot        bool
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+}
+
+// Bot is an account without a password that acts only through API tokens
+// created by its owner.
+type Bot struct {
+	Principal
+	OwnerID     UserID
+	DisplayName string
+	CreatedAt   time.Time
+}
+
+type CreateAPITokenRequest struct {
+	Name   string
+	Scopes []string
+	// BotID issues the token to one of the caller's bots instead of the
+	// caller. ExpiresIn of zero means the token does not expire.
+	BotID     UserID
+	ExpiresIn time.Duration
+}
+
+type APITokenRepository interface {
+	// CreateAPIToken fails with ErrAPITokenLimitReached when the user already
+	// has limit unrevoked tokens.
+	CreateAPIToken(ctx context.Context, token APIToken, tokenHash string, limit int) (APIToken, error)
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (APIToken, error)
+	GetAPIToken(ctx context.Context, tokenID int64) (APIToken, error)
+	TouchAPIToken(ctx context.Context, tokenID int64, now time.Time) error
+	ListAPITokens(ctx context.Context, userID UserID) ([]APIToken, error)
+	RevokeAPIToken(ctx context.Context, tokenID int64, now time.Time) error
+	// CreateBot fails with ErrUsernameTaken or ErrBotLimitReached.
+	CreateBot(ctx context.Context, ownerID UserID, username, displayName string, now time.Time, limit int) (Bot, error)
+	GetBot(ctx context.Context, botID UserID) (Bot, error)
+	ListBots(ctx context.Context, ownerID UserID) ([]Bot, error)
+}
+
+type APITokenService interface {
+	CreateAPIToken(ctx context.Context, actor UserID, req CreateAPITokenRequest) (APIToken, string, error)
+	ListAPITokens(ctx context.Context, actor UserID, botID UserID) ([]APIToken, error)
+	RevokeAPIToken(ctx context.Context, actor UserID, tokenID int64) (APIToken, error)
+	CreateBot(ctx context.Context, owner UserID, username, displayName string) (Bot, error)
+	ListBots(ctx context.Context, owner UserID) ([]Bot, error)
+	ValidateAPIToken(ctx context.Context, token string) (TokenClaims, error)
+}
+
+type apiTokenService struct {
+	repo APITokenRepository
+	now  func() time.Time
+}
+
+func NewAPITokenService(repo APITokenRepository) APITokenService {
+	return &apiTokenService{repo: repo, now: time.Now}
+}
+
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// NormalizeScopes sorts and deduplicates scopes and rejects unknown ones.
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool, len(scopes))
+	out := make([]string, 0, len(scopes))
+	for _, raw := range scopes {
+		scope := strings.ToLower(strings.TrimSpace(raw))
+		if seen[scope] {
+			continue
+		}
+		known := false
+		for _, s := range APITokenScopes {
+			known = known || s == scope
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, raw)
+		}
+		seen[scope] = true
+		out = append(out, scope)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (s *apiTokenService) CreateAPIToken(ctx context.Context, actor UserID, req CreateAPITokenRequest) (APIToken, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAPITokenNameLen {
+		return APIToken{}, "", ErrInvalidAPITokenRequest
+	}
+	scopes, err := NormalizeScopes(req.Scopes)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	if req.ExpiresIn < 0 || req.ExpiresIn > MaxAPITokenLifetime {
+		return APIToken{}, "", ErrInvalidAPITokenExpiry
+	}
+	subject, err := s.subject(ctx, actor, req.BotID)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	secret = APITokenPrefix + secret
+	now := s.now().UTC()
+	token := APIToken{UserID: subject, Bot: req.BotID > 0, Name: name, Scopes: scopes, CreatedAt: now}
+	if req.ExpiresIn > 0 {
+		expires := now.Add(req.ExpiresIn)
+		token.ExpiresAt = &expires
+	}
+	created, err := s.repo.CreateAPIToken(ctx, token, hashOpaqueToken(secret), MaxAPITokensPerUser)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	return created, secret, nil
+}
+
+func (s *apiTokenService) ListAPITokens(ctx context.Context, actor UserID, botID UserID) ([]APIToken, error) {
+	subject, err := s.subject(ctx, actor, botID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListAPITokens(ctx, subject)
+}
+
+// RevokeAPIToken lets the caller revoke their own tokens and their bots'.
+// Revoking twice is not an error.
+func (s *apiTokenService) RevokeAPIToken(ctx context.Context, actor UserID, tokenID int64) (APIToken, error) {
+	token, err := s.repo.GetAPIToken(ctx, tokenID)
+	if err != nil {
+		return APIToken{}, err
+	}
+	if token.UserID != actor {
+		bot, err := s.repo.GetBot(ctx, token.UserID)
+		if err != nil || bot.OwnerID != actor {
+			return APIToken{}, ErrAPITokenNotFound
+		}
+	}
+	if token.RevokedAt != nil {
+		return token, nil
+	}
+	now := s.now().UTC()
+	if err := s.repo.RevokeAPIToken(ctx, tokenID, now); err != nil {
+		return APIToken{}, err
+	}
+	token.RevokedAt = &now
+	return token, nil
+}
+
+func (s *apiTokenService) CreateBot(ctx context.Context, owner UserID, username, displayName string) (Bot, error) {
+	username = strings.TrimSpace(username)
+	if !validBotUsername(username) {
+		return Bot{}, ErrInvalidBotUsername
+	}
+	return s.repo.CreateBot(ctx, owner, username, strings.TrimSpace(displayName), s.now().UTC(), MaxBotsPerOwner)
+}
+
+func (s *apiTokenService) ListBots(ctx context.Context, owner UserID) ([]Bot, error) {
+	return s.repo.ListBots(ctx, owner)
+}
+
+func (s *apiTokenService) ValidateAPIToken(ctx context.Context, token string) (TokenClaims, error) {
+	if !IsAPIToken(token) {
+		return TokenClaims{}, ErrInvalidAPIToken
+	}
+	record, err := s.repo.GetAPITokenByHash(ctx, hashOpaqueToken(token))
+	if err != nil {
+		if errors.Is(err, ErrAPITokenNotFound) {
+			return TokenClaims{}, ErrInvalidAPIToken
+		}
+		return TokenClaims{}, err
+	}
+	now := s.now().UTC()
+	if record.RevokedAt != nil || (record.ExpiresAt != nil && !now.Before(*record.ExpiresAt)) {
+		return TokenClaims{}, ErrInvalidAPIToken
+	}
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= apiTokenTouchInterval {
+		_ = s.repo.TouchAPIToken(ctx, record.ID, now)
+	}
+	return TokenClaims{
+		SubjectUserID: record.UserID,
+		APITokenID:    record.ID,
+		Scopes:        record.Scopes,
+		Bot:           record.Bot,
+	}, nil
+}
+
+// subject resolves whose tokens the caller is managing: their own, or those
+// of a bot they own. Bots cannot manage tokens.
+func (s *apiTokenService) subject(ctx context.Context, actor UserID, botID UserID) (UserID, error) {
+	if botID <= 0 {
+		return actor, nil
+	}
+	bot, err := s.repo.GetBot(ctx, botID)
+	if err != nil {
+		return 0, err
+	}
+	if bot.OwnerID != actor {
+		return 0, ErrBotNotFound
+	}
+	return bot.ID, nil
+}
+
+func validBotUsername(username string) bool {
+	if len(username) < 3 || len(username) > maxExternalUsernameLen {
+		return false
+	}
+	for _, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithAPITokens returns a TokenService that also accepts API tokens in
+// ValidateToken. Every other method goes to tokens.
+func WithAPITokens(tokens TokenService, apiTokens APITokenService) TokenService {
+	if apiTokens == nil {
+		return tokens
+	}
+	return &apiTokenAwareTokens{TokenService: tokens, apiTokens: apiTokens}
+}
+
+type apiTokenAwareTokens struct {
+	TokenService
+	apiTokens APITokenService
+}
+
+func (t *apiTokenAwareTokens) ValidateToken(ctx context.Context, token string) (TokenClaims, error) {
+	if IsAPIToken(token) {
+		return t.apiTokens.ValidateAPIToken(ctx, token)
+	}
+	return t.TokenService.ValidateToken(ctx, token)
+}
@@ -0,0 +1,200 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeAPITokenRepo struct {
+	tokens map[int64]APIToken
+	hashes map[string]int64
+	bots   map[UserID]Bot
+	nextID int64
+}
+
+func newFakeAPITokenRepo() *fakeAPITokenRepo {
+	return &fakeAPITokenRepo{tokens: map[int64]APIToken{}, hashes: map[string]int64{}, bots: map[UserID]Bot{}}
+}
+
+func (f *fakeAPITokenRepo) CreateAPIToken(ctx context.Context, token APIToken, tokenHash string, limit int) (APIToken, error) {
+	f.nextID++
+	token.ID = f.nextID
+	_, token.Bot = f.bots[token.UserID]
+	f.tokens[token.ID] = token
+	f.hashes[tokenHash] = token.ID
+	return token, nil
+}
+
+func (f *fakeAPITokenRepo) GetAPITokenByHash(ctx context.Context, tokenHash string) (APIToken, error) {
+	id, ok := f.hashes[tokenHash]
+	if !ok {
+		return APIToken{}, ErrAPITokenNotFound
+	}
+	return f.tokens[id], nil
+}
+
+func (f *fakeAPITokenRepo) GetAPIToken(ctx context.Context, tokenID int64) (APIToken, error) {
+	token, ok := f.tokens[tokenID]
+	if !ok {
+		return APIToken{}, ErrAPITokenNotFound
+	}
+	return token, nil
+}
+
+func (f *fakeAPITokenRepo) TouchAPIToken(ctx context.Context, tokenID int64, now time.Time) error {
+	token := f.tokens[tokenID]
+	token.LastUsedAt = &now
+	f.tokens[tokenID] = token
+	return nil
+}
+
+func (f *fakeAPITokenRepo) ListAPITokens(ctx context.Context, userID UserID) ([]APIToken, error) {
+	out := make([]APIToken, 0)
+	for _, token := range f.tokens {
+		if token.UserID == userID {
+			out = append(out, token)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeAPITokenRepo) RevokeAPIToken(ctx context.Context, tokenID int64, now time.Time) error {
+	token := f.tokens[tokenID]
+	token.RevokedAt = &now
+	f.tokens[tokenID] = token
+	return nil
+}
+
+func (f *fakeAPITokenRepo) CreateBot(ctx context.Context, ownerID UserID, username, displayName string, now time.Time, limit int) (Bot, error) {
+	bot := Bot{Principal: Principal{ID: UserID(100 + len(f.bots)), Username: username}, OwnerID: ownerID, DisplayName: displayName, CreatedAt: now}
+	f.bots[bot.ID] = bot
+	return bot, nil
+}
+
+func (f *fakeAPITokenRepo) GetBot(ctx context.Context, botID UserID) (Bot, error) {
+	bot, ok := f.bots[botID]
+	if !ok {
+		return Bot{}, ErrBotNotFound
+	}
+	return bot, nil
+}
+
+func (f *fakeAPITokenRepo) ListBots(ctx context.Context, ownerID UserID) ([]Bot, error) {
+	return nil, nil
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	got, err := NormalizeScopes([]string{" messages:send", "MESSAGES:READ", "messages:send"})
+	if err != nil || strings.Join(got, " ") != "messages:read messages:send" {
+		t.Fatalf("NormalizeScopes = %v, %v", got, err)
+	}
+	if _, err := NormalizeScopes([]string{"wallet:send"}); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("unknown scope err = %v", err)
+	}
+	if _, err := NormalizeScopes(nil); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("empty scopes err = %v", err)
+	}
+}
+
+func TestAPITokenService_CreateValidateRevoke(t *testing.T) {
+	repo := newFakeAPITokenRepo()
+	svc := NewAPITokenService(repo).(*apiTokenService)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	token, secret, err := svc.CreateAPIToken(ctx, 7, CreateAPITokenRequest{Name: "ci", Scopes: []string{ScopeWalletRead}, ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatalf("CreateAPIToken error: %v", err)
+	}
+	if !IsAPIToken(secret) || token.UserID != 7 || token.ExpiresAt == nil {
+		t.Fatalf("token = %+v secret = %q", token, secret)
+	}
+	for hash := range repo.hashes {
+		if strings.Contains(hash, secret) {
+			t.Fatal("secret stored in plaintext")
+		}
+	}
+
+	claims, err := svc.ValidateAPIToken(ctx, secret)
+	if err != nil || claims.SubjectUserID != 7 || claims.APITokenID != token.ID || !claims.HasScope(ScopeWalletRead) || claims.HasScope(ScopeMessagesSend) {
+		t.Fatalf("ValidateAPIToken = %+v, %v", claims, err)
+	}
+	if repo.tokens[token.ID].LastUsedAt == nil {
+		t.Fatal("expected last_used_at to be recorded")
+	}
+	if _, err := svc.ValidateAPIToken(ctx, secret+"x"); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Fatalf("unknown token err = %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := svc.ValidateAPIToken(ctx, secret); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Fatalf("expired token err = %v", err)
+	}
+
+	_, other, _ := svc.CreateAPIToken(ctx, 7, CreateAPITokenRequest{Name: "cli", Scopes: []string{ScopeMessagesRead}})
+	if _, err := svc.RevokeAPIToken(ctx, 8, 2); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Fatalf("revoke by another user err = %v", err)
+	}
+	if _, err := svc.RevokeAPIToken(ctx, 7, 2); err != nil {
+		t.Fatalf("RevokeAPIToken error: %v", err)
+	}
+	if _, err := svc.ValidateAPIToken(ctx, other); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Fatalf("revoked token err = %v", err)
+	}
+
+	if _, _, err := svc.CreateAPIToken(ctx, 7, CreateAPITokenRequest{Name: "forever", Scopes: []string{ScopeWalletRead}, ExpiresIn: 2 * MaxAPITokenLifetime}); !errors.Is(err, ErrInvalidAPITokenExpiry) {
+		t.Fatalf("too long expiry err = %v", err)
+	}
+}
+
+func TestAPITokenService_BotTokensBelongToOwner(t *testing.T) {
+	repo := newFakeAPITokenRepo()
+	svc := NewAPITokenService(repo)
+	ctx := context.Background()
+
+	if _, err := svc.CreateBot(ctx, 7, "on call", ""); !errors.Is(err, ErrInvalidBotUsername) {
+		t.Fatalf("invalid username err = %v", err)
+	}
+	bot, err := svc.CreateBot(ctx, 7, "oncall-bot", "On-call")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := CreateAPITokenRequest{Name: "alerts", Scopes: []string{ScopeMessagesSend, ScopeMessagesRead}, BotID: bot.ID}
+	if _, _, err := svc.CreateAPIToken(ctx, 8, req); !errors.Is(err, ErrBotNotFound) {
+		t.Fatalf("token for someone else's bot err = %v", err)
+	}
+	token, secret, err := svc.CreateAPIToken(ctx, 7, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := svc.ValidateAPIToken(ctx, secret)
+	if err != nil || claims.SubjectUserID != bot.ID || !claims.Bot {
+		t.Fatalf("bot claims = %+v, %v", claims, err)
+	}
+	if revoked, err := svc.RevokeAPIToken(ctx, 7, token.ID); err != nil || !revoked.Bot {
+		t.Fatalf("owner revoke = %+v, %v", revoked, err)
+	}
+}
+
+func TestWithAPITokens_DispatchesOnPrefix(t *testing.T) {
+	repo := newFakeAPITokenRepo()
+	apiTokens := NewAPITokenService(repo)
+	_, secret, err := apiTokens.CreateAPIToken(context.Background(), 7, CreateAPITokenRequest{Name: "ci", Scopes: []string{ScopeWalletRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := &fakeTokenService{}
+	tokens := WithAPITokens(sessions, apiTokens)
+
+	if claims, err := tokens.ValidateToken(context.Background(), secret); err != nil || claims.APITokenID == 0 {
+		t.Fatalf("api token claims = %+v, %v", claims, err)
+	}
+	if claims, err := tokens.ValidateToken(context.Background(), "eyJhbGciOi.jwt"); err != nil || claims.APITokenID != 0 || !claims.HasScope(ScopeWalletRead) {
+		t.Fatalf("session token claims = %+v, %v", claims, err)
+	}
+}
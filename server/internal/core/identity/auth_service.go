@@ -4,9 +4,13 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
 )
 
-var ErrInvalidCredentials = errors.New("invalid credentials")
+var (
+	ErrInvalidCredentials    = errors.New("invalid credentials")
+	ErrUnsupportedCredential = errors.New("unsupported credential")
+)
 
 type PasswordLoginRecord struct {
 	Principal    Principal
@@ -25,30 +29,156 @@ type PasswordVerifier interface {
 type AuthService interface {
 	RegisterPassword(ctx context.Context, cred PasswordCredential) (Principal, error)
 	LoginPassword(ctx context.Context, cred PasswordCredential, meta SessionMetadata) (SessionTokens, error)
+	// Login verifies any credential a registered Authenticator accepts, then
+	// applies the MFA policy and issues the session as LoginPassword does.
+	Login(ctx context.Context, cred Credential, meta SessionMetadata) (SessionTokens, error)
+	ResolveMFAChallenge(ctx context.Context, challengeToken string) (Principal, error)
+	CompleteMFALogin(ctx context.Context, challengeToken, code string, meta SessionMetadata) (SessionTokens, error)
 }
 
 type authService struct {
-	repo     AuthRepository
-	verifier PasswordVerifier
-	tokens   TokenService
+	repo           AuthRepository
+	verifier       PasswordVerifier
+	tokens         TokenService
+	mfa            MFARepository
+	totp           TOTPProvider
+	authenticators []Authenticator
+	now            func() time.Time
+}
+
+// NewAuthService verifies passwords itself and any other credential with
+// the given authenticators.
+func NewAuthService(repo AuthRepository, verifier PasswordVerifier, tokens TokenService, authenticators ...Authenticator) AuthService {
+	return &authService{repo: repo, verifier: verifier, tokens: tokens, authenticators: authenticators, now: time.Now}
 }
 
-func NewAuthService(repo AuthRepository, verifier PasswordVerifier, tokens TokenService) AuthService {
-	return &authService{repo: repo, verifier: verifier, tokens: tokens}
+// NewAuthServiceWithMFA makes a login with a credential that does not
+// satisfy MFA return an *MFARequiredError for accounts with confirmed TOTP
+// instead of issuing a session.
+func NewAuthServiceWithMFA(repo AuthRepository, verifier PasswordVerifier, tokens TokenService, mfa MFARepository, totp TOTPProvider, authenticators ...Authenticator) AuthService {
+	return &authService{repo: repo, verifier: verifier, tokens: tokens, mfa: mfa, totp: totp, authenticators: authenticators, now: time.Now}
 }
 
 func (s *authService) RegisterPassword(ctx context.Context, cred PasswordCredential) (Principal, error) {
 	cred.Username = strings.TrimSpace(cred.Username)
+	if err := ValidatePassword(cred.Username, cred.Password); err != nil {
+		return Principal{}, err
+	}
 	return s.repo.CreateUser(ctx, cred)
 }
 
 func (s *authService) LoginPassword(ctx context.Context, cred PasswordCredential, meta SessionMetadata) (SessionTokens, error) {
+	return s.Login(ctx, cred, meta)
+}
+
+func (s *authService) Login(ctx context.Context, cred Credential, meta SessionMetadata) (SessionTokens, error) {
+	principal, err := s.Authenticate(ctx, cred)
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	if s.mfa != nil && !cred.SatisfiesMFA() {
+		totp, err := s.mfa.GetTOTP(ctx, principal.ID)
+		if err != nil && !errors.Is(err, ErrMFANotEnrolled) {
+			return SessionTokens{}, err
+		}
+		if err == nil && totp.Confirmed {
+			challenge, err := s.issueMFAChallenge(ctx, principal.ID)
+			if err != nil {
+				return SessionTokens{}, err
+			}
+			return SessionTokens{}, &MFARequiredError{Principal: principal, Challenge: challenge}
+		}
+	}
+	return s.tokens.IssueSession(ctx, principal, meta)
+}
+
+// Authenticate checks passwords itself and offers any other credential to
+// the registered authenticators.
+func (s *authService) Authenticate(ctx context.Context, cred Credential) (Principal, error) {
+	if password, ok := cred.(PasswordCredential); ok {
+		return s.authenticatePassword(ctx, password)
+	}
+	for _, a := range s.authenticators {
+		principal, err := a.Authenticate(ctx, cred)
+		if !errors.Is(err, ErrUnsupportedCredential) {
+			return principal, err
+		}
+	}
+	return Principal{}, ErrUnsupportedCredential
+}
+
+func (s *authService) authenticatePassword(ctx context.Context, cred PasswordCredential) (Principal, error) {
 	record, err := s.repo.GetPasswordLoginRecord(ctx, strings.TrimSpace(cred.Username))
 	if err != nil {
-		return SessionTokens{}, ErrInvalidCredentials
+		return Principal{}, ErrInvalidCredentials
 	}
 	if s.verifier == nil || !s.verifier.VerifyPassword(cred.Password, record.PasswordHash) {
-		return SessionTokens{}, ErrInvalidCredentials
+		return Principal{}, ErrInvalidCredentials
+	}
+	return record.Principal, nil
+}
+
+// ResolveMFAChallenge reports who a pending challenge belongs to without
+// consuming it, so transports can apply per-account throttling first.
+func (s *authService) ResolveMFAChallenge(ctx context.Context, challengeToken string) (Principal, error) {
+	record, err := s.mfaChallenge(ctx, challengeToken)
+	if err != nil {
+		return Principal{}, err
+	}
+	return record.Principal, nil
+}
+
+// CompleteMFALogin issues a session only after a valid second factor. A
+// challenge is single-use and is discarded after MaxMFAChallengeAttempts
+// wrong codes.
+func (s *authService) CompleteMFALogin(ctx context.Context, challengeToken, code string, meta SessionMetadata) (SessionTokens, error) {
+	record, err := s.mfaChallenge(ctx, challengeToken)
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	tokenHash := hashOpaqueToken(challengeToken)
+	if err := verifySecondFactor(ctx, s.mfa, s.totp, s.now(), record.Principal.ID, code); err != nil {
+		if errors.Is(err, ErrMFANotEnrolled) {
+			_ = s.mfa.DeleteMFAChallenge(ctx, tokenHash)
+			return SessionTokens{}, ErrInvalidMFAChallenge
+		}
+		if errors.Is(err, ErrInvalidMFACode) {
+			attempts, recordErr := s.mfa.RecordMFAChallengeFailure(ctx, tokenHash)
+			if recordErr == nil && attempts >= MaxMFAChallengeAttempts {
+				_ = s.mfa.DeleteMFAChallenge(ctx, tokenHash)
+			}
+		}
+		return SessionTokens{}, err
+	}
+	if err := s.mfa.DeleteMFAChallenge(ctx, tokenHash); err != nil {
+		return SessionTokens{}, err
 	}
 	return s.tokens.IssueSession(ctx, record.Principal, meta)
 }
+
+func (s *authService) issueMFAChallenge(ctx context.Context, userID UserID) (MFAChallenge, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return MFAChallenge{}, err
+	}
+	expiresAt := s.now().UTC().Add(MFAChallengeTTL)
+	if err := s.mfa.CreateMFAChallenge(ctx, hashOpaqueToken(token), userID, expiresAt); err != nil {
+		return MFAChallenge{}, err
+	}
+	return MFAChallenge{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+func (s *authService) mfaChallenge(ctx context.Context, challengeToken string) (MFAChallengeRecord, error) {
+	challengeToken = strings.TrimSpace(challengeToken)
+	if s.mfa == nil || challengeToken == "" {
+		return MFAChallengeRecord{}, ErrInvalidMFAChallenge
+	}
+	record, err := s.mfa.GetMFAChallenge(ctx, hashOpaqueToken(challengeToken))
+	if err != nil {
+		return MFAChallengeRecord{}, err
+	}
+	if !s.now().Before(record.ExpiresAt) || record.Attempts >= MaxMFAChallengeAttempts {
+		return MFAChallengeRecord{}, ErrInvalidMFAChallenge
+	}
+	return record, nil
+}
@@ -174,3 +174,16 @@ func TestAuthService_LoginPassword_ReturnsInvalidCredentials(t *testing.T) {
 		}
 	})
 }
+
+func TestAuthService_RegisterPassword_EnforcesPolicy(t *testing.T) {
+	repo := &fakeAuthRepo{createID: 9}
+	svc := NewAuthService(repo, &fakePasswordVerifier{}, &fakeTokenService{})
+
+	_, err := svc.RegisterPassword(context.Background(), PasswordCredential{Username: "alice", Password: "alice-rocks-1"})
+	if !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("RegisterPassword err = %v, want ErrWeakPassword", err)
+	}
+	if repo.lastCreate.Username != "" {
+		t.Fatalf("CreateUser called with %+v", repo.lastCreate)
+	}
+}
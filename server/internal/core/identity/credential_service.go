@@ -0,0 +1,201 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+	ErrPrincipalNotFound = errors.New("user not found")
+)
+
+const PasswordResetTTL = 30 * time.Minute
+
+// Session revoke reasons recorded on auth_sessions.revoke_reason.
+const (
+	RevokeReasonPasswordChanged = "password_changed"
+	RevokeReasonPasswordReset   = "password_reset"
+)
+
+type PasswordResetRecord struct {
+	Principal Principal
+	ExpiresAt time.Time
+}
+
+// PasswordResetNotice is handed to the notifier; Token is the only copy of
+// the plaintext reset token.
+type PasswordResetNotice struct {
+	Principal Principal
+	Token     string
+	ExpiresAt time.Time
+}
+
+// PasswordResetNotifier delivers reset tokens out of band (email, a log file
+// for local development, ...).
+type PasswordResetNotifier interface {
+	NotifyPasswordReset(ctx context.Context, notice PasswordResetNotice) error
+}
+
+// PasswordHasher produces hashes PasswordVerifier can check.
+type PasswordHasher interface {
+	HashPassword(password string) (string, error)
+}
+
+// SessionRevoker revokes every live session of a user except keepSessionID
+// (0 keeps none) and reports the revoked IDs so transports can disconnect
+// them.
+type SessionRevoker interface {
+	RevokeUserSessions(ctx context.Context, userID UserID, keepSessionID int64, reason string) ([]int64, error)
+}
+
+// CredentialRepository stores password hashes and reset tokens. Only token
+// hashes are stored. CreatePasswordResetToken replaces any outstanding token
+// for the user; ConsumePasswordResetToken must delete the token so it can be
+// used once. FindPrincipal returns ErrPrincipalNotFound for unknown users.
+type CredentialRepository interface {
+	GetPasswordRecord(ctx context.Context, userID UserID) (PasswordLoginRecord, error)
+	FindPrincipal(ctx context.Context, username string) (Principal, error)
+	UpdatePasswordHash(ctx context.Context, userID UserID, passwordHash string) error
+	CreatePasswordResetToken(ctx context.Context, tokenHash string, userID UserID, expiresAt time.Time) error
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (PasswordResetRecord, error)
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) error
+}
+
+// PasswordChange reports who changed their password and which sessions were
+// revoked as a result.
+type PasswordChange struct {
+	Principal         Principal
+	RevokedSessionIDs []int64
+}
+
+type CredentialService interface {
+	ResolvePrincipal(ctx context.Context, userID UserID) (Principal, error)
+	ChangePassword(ctx context.Context, userID UserID, currentSessionID int64, currentPassword, newPassword string) (PasswordChange, error)
+	RequestPasswordReset(ctx context.Context, username string) error
+	ResetPassword(ctx context.Context, token, newPassword string) (PasswordChange, error)
+}
+
+type credentialService struct {
+	repo     CredentialRepository
+	verifier PasswordVerifier
+	hasher   PasswordHasher
+	sessions SessionRevoker
+	notifier PasswordResetNotifier
+	now      func() time.Time
+}
+
+func NewCredentialService(repo CredentialRepository, verifier PasswordVerifier, hasher PasswordHasher, sessions SessionRevoker, notifier PasswordResetNotifier) CredentialService {
+	return &credentialService{
+		repo:     repo,
+		verifier: verifier,
+		hasher:   hasher,
+		sessions: sessions,
+		notifier: notifier,
+		now:      time.Now,
+	}
+}
+
+// ResolvePrincipal lets transports key per-account throttling before the
+// current password is checked.
+func (s *credentialService) ResolvePrincipal(ctx context.Context, userID UserID) (Principal, error) {
+	record, err := s.repo.GetPasswordRecord(ctx, userID)
+	if err != nil {
+		return Principal{}, err
+	}
+	return record.Principal, nil
+}
+
+// ChangePassword re-verifies the current password and then revokes every
+// other session, so a stolen refresh token stops working once the owner
+// changes their password.
+func (s *credentialService) ChangePassword(ctx context.Context, userID UserID, currentSessionID int64, currentPassword, newPassword string) (PasswordChange, error) {
+	record, err := s.repo.GetPasswordRecord(ctx, userID)
+	if err != nil {
+		return PasswordChange{}, err
+	}
+	if s.verifier == nil || !s.verifier.VerifyPassword(currentPassword, record.PasswordHash) {
+		return PasswordChange{}, ErrInvalidCredentials
+	}
+	if err := s.setPassword(ctx, record.Principal, newPassword); err != nil {
+		return PasswordChange{}, err
+	}
+	revoked, err := s.sessions.RevokeUserSessions(ctx, userID, currentSessionID, RevokeReasonPasswordChanged)
+	if err != nil {
+		return PasswordChange{}, err
+	}
+	return PasswordChange{Principal: record.Principal, RevokedSessionIDs: revoked}, nil
+}
+
+// RequestPasswordReset never reports whether the username exists.
+func (s *credentialService) RequestPasswordReset(ctx context.Context, username string) error {
+	username = strings.TrimSpace(username)
+	if username == "" || s.notifier == nil {
+		return nil
+	}
+	principal, err := s.repo.FindPrincipal(ctx, username)
+	if err != nil {
+		if errors.Is(err, ErrPrincipalNotFound) {
+			return nil
+		}
+		return err
+	}
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := s.now().UTC().Add(PasswordResetTTL)
+	if err := s.repo.CreatePasswordResetToken(ctx, hashOpaqueToken(token), principal.ID, expiresAt); err != nil {
+		return err
+	}
+	return s.notifier.NotifyPasswordReset(ctx, PasswordResetNotice{
+		Principal: principal,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// ResetPassword checks the new password against policy before consuming the
+// token, so a rejected password does not burn it. Every session is revoked;
+// the user signs in again with the new password (and TOTP, if enabled).
+func (s *credentialService) ResetPassword(ctx context.Context, token, newPassword string) (PasswordChange, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return PasswordChange{}, ErrInvalidResetToken
+	}
+	tokenHash := hashOpaqueToken(token)
+	record, err := s.repo.GetPasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		return PasswordChange{}, err
+	}
+	if !s.now().Before(record.ExpiresAt) {
+		return PasswordChange{}, ErrInvalidResetToken
+	}
+	if err := ValidatePassword(record.Principal.Username, newPassword); err != nil {
+		return PasswordChange{}, err
+	}
+	if err := s.repo.ConsumePasswordResetToken(ctx, tokenHash); err != nil {
+		return PasswordChange{}, err
+	}
+	if err := s.setPassword(ctx, record.Principal, newPassword); err != nil {
+		return PasswordChange{}, err
+	}
+	revoked, err := s.sessions.RevokeUserSessions(ctx, record.Principal.ID, 0, RevokeReasonPasswordReset)
+	if err != nil {
+		return PasswordChange{}, err
+	}
+	return PasswordChange{Principal: record.Principal, RevokedSessionIDs: revoked}, nil
+}
+
+func (s *credentialService) setPassword(ctx context.Context, principal Principal, password string) error {
+	if err := ValidatePassword(principal.Username, password); err != nil {
+		return err
+	}
+	hash, err := s.hasher.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return s.repo.UpdatePasswordHash(ctx, principal.ID, hash)
+}
@@ -0,0 +1,193 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeCredentialRepo struct {
+	users  map[UserID]PasswordLoginRecord
+	resets map[string]PasswordResetRecord
+}
+
+func newFakeCredentialRepo() *fakeCredentialRepo {
+	return &fakeCredentialRepo{
+		users: map[UserID]PasswordLoginRecord{
+			7: {Principal: Principal{ID: 7, Username: "alice"}, PasswordHash: "hash:password123"},
+		},
+		resets: map[string]PasswordResetRecord{},
+	}
+}
+
+func (f *fakeCredentialRepo) GetPasswordRecord(ctx context.Context, userID UserID) (PasswordLoginRecord, error) {
+	_ = ctx
+	record, ok := f.users[userID]
+	if !ok {
+		return PasswordLoginRecord{}, ErrPrincipalNotFound
+	}
+	return record, nil
+}
+
+func (f *fakeCredentialRepo) FindPrincipal(ctx context.Context, username string) (Principal, error) {
+	_ = ctx
+	for _, record := range f.users {
+		if record.Principal.Username == username {
+			return record.Principal, nil
+		}
+	}
+	return Principal{}, ErrPrincipalNotFound
+}
+
+func (f *fakeCredentialRepo) UpdatePasswordHash(ctx context.Context, userID UserID, passwordHash string) error {
+	_ = ctx
+	record := f.users[userID]
+	record.PasswordHash = passwordHash
+	f.users[userID] = record
+	return nil
+}
+
+func (f *fakeCredentialRepo) CreatePasswordResetToken(ctx context.Context, tokenHash string, userID UserID, expiresAt time.Time) error {
+	_ = ctx
+	for hash, record := range f.resets {
+		if record.Principal.ID == userID {
+			delete(f.resets, hash)
+		}
+	}
+	f.resets[tokenHash] = PasswordResetRecord{Principal: f.users[userID].Principal, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (f *fakeCredentialRepo) GetPasswordResetToken(ctx context.Context, tokenHash string) (PasswordResetRecord, error) {
+	_ = ctx
+	record, ok := f.resets[tokenHash]
+	if !ok {
+		return PasswordResetRecord{}, ErrInvalidResetToken
+	}
+	return record, nil
+}
+
+func (f *fakeCredentialRepo) ConsumePasswordResetToken(ctx context.Context, tokenHash string) error {
+	_ = ctx
+	if _, ok := f.resets[tokenHash]; !ok {
+		return ErrInvalidResetToken
+	}
+	delete(f.resets, tokenHash)
+	return nil
+}
+
+// fakeHasher pairs with hashVerifier: a hash is "hash:" plus the password.
+type fakeHasher struct{}
+
+func (fakeHasher) HashPassword(password string) (string, error) { return "hash:" + password, nil }
+
+type hashVerifier struct{}
+
+func (hashVerifier) VerifyPassword(password, hash string) bool { return hash == "hash:"+password }
+
+type fakeSessionRevoker struct {
+	keep   int64
+	reason string
+	calls  int
+}
+
+func (f *fakeSessionRevoker) RevokeUserSessions(ctx context.Context, userID UserID, keepSessionID int64, reason string) ([]int64, error) {
+	_ = ctx
+	_ = userID
+	f.keep = keepSessionID
+	f.reason = reason
+	f.calls++
+	return []int64{11, 12}, nil
+}
+
+type fakeResetNotifier struct {
+	notices []PasswordResetNotice
+}
+
+func (f *fakeResetNotifier) NotifyPasswordReset(ctx context.Context, notice PasswordResetNotice) error {
+	_ = ctx
+	f.notices = append(f.notices, notice)
+	return nil
+}
+
+func TestCredentialService_ChangePassword(t *testing.T) {
+	repo := newFakeCredentialRepo()
+	sessions := &fakeSessionRevoker{}
+	svc := NewCredentialService(repo, hashVerifier{}, fakeHasher{}, sessions, nil)
+	ctx := context.Background()
+
+	if _, err := svc.ChangePassword(ctx, 7, 10, "wrong-password", "new-secret-1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong current password err = %v", err)
+	}
+	if _, err := svc.ChangePassword(ctx, 7, 10, "password123", "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("weak new password err = %v", err)
+	}
+	if sessions.calls != 0 || repo.users[7].PasswordHash != "hash:password123" {
+		t.Fatalf("failed change had side effects: calls=%d hash=%q", sessions.calls, repo.users[7].PasswordHash)
+	}
+
+	change, err := svc.ChangePassword(ctx, 7, 10, "password123", "new-secret-1")
+	if err != nil {
+		t.Fatalf("ChangePassword error: %v", err)
+	}
+	if repo.users[7].PasswordHash != "hash:new-secret-1" {
+		t.Fatalf("hash = %q", repo.users[7].PasswordHash)
+	}
+	if sessions.keep != 10 || sessions.reason != RevokeReasonPasswordChanged || len(change.RevokedSessionIDs) != 2 {
+		t.Fatalf("revocation keep=%d reason=%q change=%+v", sessions.keep, sessions.reason, change)
+	}
+}
+
+func TestCredentialService_ResetPassword(t *testing.T) {
+	repo := newFakeCredentialRepo()
+	sessions := &fakeSessionRevoker{}
+	notifier := &fakeResetNotifier{}
+	svc := NewCredentialService(repo, hashVerifier{}, fakeHasher{}, sessions, notifier).(*credentialService)
+	ctx := context.Background()
+
+	if err := svc.RequestPasswordReset(ctx, "nobody"); err != nil || len(notifier.notices) != 0 {
+		t.Fatalf("unknown user: err=%v notices=%d", err, len(notifier.notices))
+	}
+	if err := svc.RequestPasswordReset(ctx, "alice"); err != nil {
+		t.Fatalf("RequestPasswordReset error: %v", err)
+	}
+	if err := svc.RequestPasswordReset(ctx, "alice"); err != nil {
+		t.Fatalf("second RequestPasswordReset error: %v", err)
+	}
+	if len(notifier.notices) != 2 || len(repo.resets) != 1 {
+		t.Fatalf("notices=%d stored=%d", len(notifier.notices), len(repo.resets))
+	}
+	superseded, token := notifier.notices[0].Token, notifier.notices[1].Token
+	if _, ok := repo.resets[token]; ok {
+		t.Fatal("reset token stored in plaintext")
+	}
+
+	if _, err := svc.ResetPassword(ctx, superseded, "new-secret-1"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("superseded token err = %v", err)
+	}
+	if _, err := svc.ResetPassword(ctx, token, "alice-secret-1"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("weak password err = %v", err)
+	}
+	change, err := svc.ResetPassword(ctx, token, "new-secret-1")
+	if err != nil {
+		t.Fatalf("ResetPassword after rejected password error: %v", err)
+	}
+	if change.Principal.ID != 7 || repo.users[7].PasswordHash != "hash:new-secret-1" {
+		t.Fatalf("change=%+v hash=%q", change, repo.users[7].PasswordHash)
+	}
+	if sessions.keep != 0 || sessions.reason != RevokeReasonPasswordReset {
+		t.Fatalf("revocation keep=%d reason=%q", sessions.keep, sessions.reason)
+	}
+	if _, err := svc.ResetPassword(ctx, token, "another-secret-2"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("reused token err = %v", err)
+	}
+
+	if err := svc.RequestPasswordReset(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	svc.now = func() time.Time { return time.Now().Add(PasswordResetTTL + time.Minute) }
+	if _, err := svc.ResetPassword(ctx, notifier.notices[2].Token, "another-secret-2"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expired token err = %v", err)
+	}
+}
@@ -33,12 +33,20 @@ type ProfileUpdate struct {
 	AvatarURL   string
 }
 
+// Credential is proof of identity presented at login. SatisfiesMFA reports
+// whether it already proves a second factor, so login skips the TOTP step.
+type Credential interface {
+	SatisfiesMFA() bool
+}
+
 // PasswordCredential represents the current username/password auth mechanism.
 type PasswordCredential struct {
 	Username string
 	Password string
 }
 
+func (PasswordCredential) SatisfiesMFA() bool { return false }
+
 // SessionMetadata carries request/device context used for session creation and refresh rotation.
 type SessionMetadata struct {
 	DeviceLabel string
@@ -70,9 +78,27 @@ type SessionTokens struct {
 }
 
 // TokenClaims is the normalized auth token payload used by adapters.
+// APITokenID is set for API tokens, which carry Scopes; session tokens carry
+// none and may use every route.
 type TokenClaims struct {
 	SubjectUserID UserID
 	SessionID     int64
+	APITokenID    int64
+	Scopes        []string
+	Bot           bool
+}
+
+// HasScope reports whether the token may be used where scope is required.
+func (c TokenClaims) HasScope(scope string) bool {
+	if c.APITokenID == 0 {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 type DeviceKeyState string
@@ -149,9 +175,11 @@ type DeviceDirectory struct {
 	Devices  []DeviceDirectoryEntry
 }
 
-// Authenticator validates credentials and returns a principal.
+// Authenticator validates one kind of credential and returns its principal.
+// It returns ErrUnsupportedCredential for any other kind, so AuthService can
+// offer a credential to each registered authenticator in turn.
 type Authenticator interface {
-	AuthenticatePassword(ctx context.Context, cred PasswordCredential) (Principal, error)
+	Authenticate(ctx context.Context, cred Credential) (Principal, error)
 }
 
 // TokenService abstracts token creation/validation and session lifecycle.
@@ -164,7 +192,8 @@ type TokenService interface {
 	TouchSession(ctx context.Context, sessionID int64, meta SessionMetadata) error
 }
 
-// KeyMaterialProvider abstracts future DID/WebAuthn/passkey key resolution.
+// KeyMaterialProvider resolves public keys by reference. The passkey store
+// implements it for WebAuthn credentials; DID keys may follow.
 type KeyMaterialProvider interface {
 	ResolveSigningKey(ctx context.Context, principal Principal, keyRef string) ([]byte, error)
 }
@@ -0,0 +1,267 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrMFARequired         = errors.New("two-factor authentication required")
+	ErrMFANotEnrolled      = errors.New("two-factor authentication is not enrolled")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired mfa challenge")
+)
+
+const (
+	MFAChallengeTTL         = 5 * time.Minute
+	MaxMFAChallengeAttempts = 5
+	RecoveryCodeCount       = 10
+)
+
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// MFAChallenge is the short-lived token a client trades, together with a
+// second-factor code, for a session once the password step has passed.
+type MFAChallenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// MFARequiredError is returned by LoginPassword when the password was correct
+// but the account still needs a second factor. No session exists yet.
+type MFARequiredError struct {
+	Principal Principal
+	Challenge MFAChallenge
+}
+
+func (e *MFARequiredError) Error() string { return ErrMFARequired.Error() }
+
+func (e *MFARequiredError) Is(target error) bool { return target == ErrMFARequired }
+
+// TOTPProvider generates RFC 6238 secrets and checks codes. MatchStep returns
+// the time step the code belongs to so callers can reject replays.
+type TOTPProvider interface {
+	NewSecret() (string, error)
+	ProvisioningURI(secret, accountName string) string
+	MatchStep(secret, code string, at time.Time) (int64, bool)
+}
+
+type TOTPRecord struct {
+	UserID       UserID
+	Secret       string
+	Confirmed    bool
+	LastUsedStep int64
+}
+
+type MFAChallengeRecord struct {
+	Principal Principal
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+type TOTPEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+type MFAStatus struct {
+	TOTPEnabled            bool
+	RecoveryCodesRemaining int
+}
+
+// MFARepository stores TOTP secrets, hashed recovery codes, and hashed login
+// challenges. Token and code arguments are always hashes, never raw values.
+type MFARepository interface {
+	GetPrincipal(ctx context.Context, userID UserID) (Principal, error)
+	GetTOTP(ctx context.Context, userID UserID) (TOTPRecord, error)
+	SavePendingTOTP(ctx context.Context, userID UserID, secret string) error
+	ConfirmTOTP(ctx context.Context, userID UserID, step int64, recoveryCodeHashes []string) error
+	DeleteTOTP(ctx context.Context, userID UserID) error
+	AdvanceTOTPStep(ctx context.Context, userID UserID, step int64) (bool, error)
+	ConsumeRecoveryCode(ctx context.Context, userID UserID, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID UserID) (int, error)
+	CreateMFAChallenge(ctx context.Context, tokenHash string, userID UserID, expiresAt time.Time) error
+	GetMFAChallenge(ctx context.Context, tokenHash string) (MFAChallengeRecord, error)
+	RecordMFAChallengeFailure(ctx context.Context, tokenHash string) (int, error)
+	DeleteMFAChallenge(ctx context.Context, tokenHash string) error
+}
+
+type MFAService interface {
+	Status(ctx context.Context, userID UserID) (MFAStatus, error)
+	BeginTOTPEnrollment(ctx context.Context, userID UserID) (TOTPEnrollment, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userID UserID, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID UserID, code string) error
+}
+
+type mfaService struct {
+	repo MFARepository
+	totp TOTPProvider
+	now  func() time.Time
+}
+
+func NewMFAService(repo MFARepository, totp TOTPProvider) MFAService {
+	return &mfaService{repo: repo, totp: totp, now: time.Now}
+}
+
+func (s *mfaService) Status(ctx context.Context, userID UserID) (MFAStatus, error) {
+	record, err := s.repo.GetTOTP(ctx, userID)
+	if errors.Is(err, ErrMFANotEnrolled) || (err == nil && !record.Confirmed) {
+		return MFAStatus{}, nil
+	}
+	if err != nil {
+		return MFAStatus{}, err
+	}
+	remaining, err := s.repo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return MFAStatus{}, err
+	}
+	return MFAStatus{TOTPEnabled: true, RecoveryCodesRemaining: remaining}, nil
+}
+
+// BeginTOTPEnrollment replaces any unconfirmed secret; TOTP only takes effect
+// once ConfirmTOTPEnrollment sees a valid code for it.
+func (s *mfaService) BeginTOTPEnrollment(ctx context.Context, userID UserID) (TOTPEnrollment, error) {
+	record, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, ErrMFANotEnrolled) {
+		return TOTPEnrollment{}, err
+	}
+	if err == nil && record.Confirmed {
+		return TOTPEnrollment{}, ErrMFAAlreadyEnabled
+	}
+	principal, err := s.repo.GetPrincipal(ctx, userID)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	secret, err := s.totp.NewSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	if err := s.repo.SavePendingTOTP(ctx, userID, secret); err != nil {
+		return TOTPEnrollment{}, err
+	}
+	return TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: s.totp.ProvisioningURI(secret, principal.Username),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables TOTP and returns the only plaintext copy of
+// the recovery codes.
+func (s *mfaService) ConfirmTOTPEnrollment(ctx context.Context, userID UserID, code string) ([]string, error) {
+	record, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if record.Confirmed {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	step, ok := s.totp.MatchStep(record.Secret, strings.TrimSpace(code), s.now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes, hashes, err := newRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ConfirmTOTP(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *mfaService) DisableTOTP(ctx context.Context, userID UserID, code string) error {
+	if err := verifySecondFactor(ctx, s.repo, s.totp, s.now(), userID, code); err != nil {
+		return err
+	}
+	return s.repo.DeleteTOTP(ctx, userID)
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code.
+// Each TOTP step and each recovery code can be used at most once.
+func verifySecondFactor(ctx context.Context, repo MFARepository, totp TOTPProvider, now time.Time, userID UserID, code string) error {
+	record, err := repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !record.Confirmed {
+		return ErrMFANotEnrolled
+	}
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrInvalidMFACode
+	}
+	if step, ok := totp.MatchStep(record.Secret, code, now); ok {
+		advanced, err := repo.AdvanceTOTPStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+	consumed, err := repo.ConsumeRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func newRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for range n {
+		var b strings.Builder
+		for i := range 10 {
+			if i == 5 {
+				b.WriteByte('-')
+			}
+			idx, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			b.WriteByte(recoveryCodeAlphabet[idx.Int64()])
+		}
+		codes = append(codes, b.String())
+		hashes = append(hashes, hashRecoveryCode(b.String()))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, spaces, and dashes so users can type codes
+// however their password manager displays them.
+func hashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, code)
+	return hashOpaqueToken(normalized)
+}
+
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,358 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type fakeMFARepo struct {
+	totp       map[UserID]TOTPRecord
+	recovery   map[UserID]map[string]bool
+	challenges map[string]*MFAChallengeRecord
+}
+
+func newFakeMFARepo() *fakeMFARepo {
+	return &fakeMFARepo{
+		totp:       map[UserID]TOTPRecord{},
+		recovery:   map[UserID]map[string]bool{},
+		challenges: map[string]*MFAChallengeRecord{},
+	}
+}
+
+func (f *fakeMFARepo) GetPrincipal(ctx context.Context, userID UserID) (Principal, error) {
+	_ = ctx
+	return Principal{ID: userID, Username: "alice"}, nil
+}
+
+func (f *fakeMFARepo) GetTOTP(ctx context.Context, userID UserID) (TOTPRecord, error) {
+	_ = ctx
+	record, ok := f.totp[userID]
+	if !ok {
+		return TOTPRecord{}, ErrMFANotEnrolled
+	}
+	return record, nil
+}
+
+func (f *fakeMFARepo) SavePendingTOTP(ctx context.Context, userID UserID, secret string) error {
+	_ = ctx
+	if f.totp[userID].Confirmed {
+		return ErrMFAAlreadyEnabled
+	}
+	f.totp[userID] = TOTPRecord{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (f *fakeMFARepo) ConfirmTOTP(ctx context.Context, userID UserID, step int64, hashes []string) error {
+	_ = ctx
+	record := f.totp[userID]
+	record.Confirmed = true
+	record.LastUsedStep = step
+	f.totp[userID] = record
+	f.recovery[userID] = map[string]bool{}
+	for _, hash := range hashes {
+		f.recovery[userID][hash] = false
+	}
+	return nil
+}
+
+func (f *fakeMFARepo) DeleteTOTP(ctx context.Context, userID UserID) error {
+	_ = ctx
+	delete(f.totp, userID)
+	delete(f.recovery, userID)
+	return nil
+}
+
+func (f *fakeMFARepo) AdvanceTOTPStep(ctx context.Context, userID UserID, step int64) (bool, error) {
+	_ = ctx
+	record := f.totp[userID]
+	if record.LastUsedStep >= step {
+		return false, nil
+	}
+	record.LastUsedStep = step
+	f.totp[userID] = record
+	return true, nil
+}
+
+func (f *fakeMFARepo) ConsumeRecoveryCode(ctx context.Context, userID UserID, codeHash string) (bool, error) {
+	_ = ctx
+	used, ok := f.recovery[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	f.recovery[userID][codeHash] = true
+	return true, nil
+}
+
+func (f *fakeMFARepo) CountRecoveryCodes(ctx context.Context, userID UserID) (int, error) {
+	_ = ctx
+	n := 0
+	for _, used := range f.recovery[userID] {
+		if !used {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeMFARepo) CreateMFAChallenge(ctx context.Context, tokenHash string, userID UserID, expiresAt time.Time) error {
+	_ = ctx
+	f.challenges[tokenHash] = &MFAChallengeRecord{Principal: Principal{ID: userID, Username: "alice"}, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (f *fakeMFARepo) GetMFAChallenge(ctx context.Context, tokenHash string) (MFAChallengeRecord, error) {
+	_ = ctx
+	record, ok := f.challenges[tokenHash]
+	if !ok {
+		return MFAChallengeRecord{}, ErrInvalidMFAChallenge
+	}
+	return *record, nil
+}
+
+func (f *fakeMFARepo) RecordMFAChallengeFailure(ctx context.Context, tokenHash string) (int, error) {
+	_ = ctx
+	record, ok := f.challenges[tokenHash]
+	if !ok {
+		return 0, ErrInvalidMFAChallenge
+	}
+	record.Attempts++
+	return record.Attempts, nil
+}
+
+func (f *fakeMFARepo) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	_ = ctx
+	if _, ok := f.challenges[tokenHash]; !ok {
+		return ErrInvalidMFAChallenge
+	}
+	delete(f.challenges, tokenHash)
+	return nil
+}
+
+// fakeTOTP accepts "<step>" as the code for a step, within one step of now.
+type fakeTOTP struct{}
+
+func (fakeTOTP) NewSecret() (string, error) { return "SECRET", nil }
+
+func (fakeTOTP) ProvisioningURI(secret, accountName string) string {
+	return "otpauth://totp/test:" + accountName + "?secret=" + secret
+}
+
+func (fakeTOTP) MatchStep(secret, code string, at time.Time) (int64, bool) {
+	step, err := strconv.ParseInt(code, 10, 64)
+	if err != nil || secret == "" {
+		return 0, false
+	}
+	current := at.Unix() / 30
+	if step < current-1 || step > current+1 {
+		return 0, false
+	}
+	return step, true
+}
+
+func currentCode(now time.Time, offset int64) string {
+	return strconv.FormatInt(now.Unix()/30+offset, 10)
+}
+
+func enrollForTest(t *testing.T, repo *fakeMFARepo, now time.Time) []string {
+	t.Helper()
+	svc := &mfaService{repo: repo, totp: fakeTOTP{}, now: func() time.Time { return now }}
+	enrollment, err := svc.BeginTOTPEnrollment(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("BeginTOTPEnrollment error: %v", err)
+	}
+	if enrollment.ProvisioningURI != "otpauth://totp/test:alice?secret=SECRET" {
+		t.Fatalf("unexpected provisioning uri %q", enrollment.ProvisioningURI)
+	}
+	codes, err := svc.ConfirmTOTPEnrollment(context.Background(), 7, currentCode(now, -1))
+	if err != nil {
+		t.Fatalf("ConfirmTOTPEnrollment error: %v", err)
+	}
+	return codes
+}
+
+func TestMFAService_EnrollConfirmAndDisable(t *testing.T) {
+	repo := newFakeMFARepo()
+	now := time.Unix(1_700_000_000, 0)
+	svc := &mfaService{repo: repo, totp: fakeTOTP{}, now: func() time.Time { return now }}
+
+	if status, _ := svc.Status(context.Background(), 7); status.TOTPEnabled {
+		t.Fatal("expected TOTP disabled before enrollment")
+	}
+	if _, err := svc.BeginTOTPEnrollment(context.Background(), 7); err != nil {
+		t.Fatalf("BeginTOTPEnrollment error: %v", err)
+	}
+	if status, _ := svc.Status(context.Background(), 7); status.TOTPEnabled {
+		t.Fatal("pending enrollment must not count as enabled")
+	}
+	if _, err := svc.ConfirmTOTPEnrollment(context.Background(), 7, "000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("confirm with wrong code err = %v", err)
+	}
+
+	codes, err := svc.ConfirmTOTPEnrollment(context.Background(), 7, currentCode(now, 0))
+	if err != nil {
+		t.Fatalf("ConfirmTOTPEnrollment error: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount || len(codes[0]) != 11 {
+		t.Fatalf("recovery codes = %v", codes)
+	}
+	for hash := range repo.recovery[7] {
+		for _, code := range codes {
+			if hash == code {
+				t.Fatal("recovery codes must be stored hashed")
+			}
+		}
+	}
+	if status, _ := svc.Status(context.Background(), 7); !status.TOTPEnabled || status.RecoveryCodesRemaining != RecoveryCodeCount {
+		t.Fatalf("status = %+v", status)
+	}
+	if _, err := svc.BeginTOTPEnrollment(context.Background(), 7); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Fatalf("re-enroll err = %v", err)
+	}
+
+	if err := svc.DisableTOTP(context.Background(), 7, currentCode(now, 0)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("disable with the code used to confirm err = %v, want replay rejection", err)
+	}
+	if err := svc.DisableTOTP(context.Background(), 7, " "+codes[3]+" "); err != nil {
+		t.Fatalf("DisableTOTP with recovery code error: %v", err)
+	}
+	if status, _ := svc.Status(context.Background(), 7); status.TOTPEnabled {
+		t.Fatal("expected TOTP disabled")
+	}
+}
+
+func newMFAAuthServiceForTest(repo *fakeMFARepo, tokens *fakeTokenService, now time.Time) AuthService {
+	authRepo := &fakeAuthRepo{loginRecord: PasswordLoginRecord{Principal: Principal{ID: 7, Username: "alice"}, PasswordHash: "hash"}}
+	svc := NewAuthServiceWithMFA(authRepo, &fakePasswordVerifier{ok: true}, tokens, repo, fakeTOTP{}).(*authService)
+	svc.now = func() time.Time { return now }
+	return svc
+}
+
+func TestAuthService_LoginPassword_RequiresSecondFactor(t *testing.T) {
+	repo := newFakeMFARepo()
+	now := time.Unix(1_700_000_000, 0)
+	codes := enrollForTest(t, repo, now)
+	tokens := &fakeTokenService{tokens: SessionTokens{AccessToken: "jwt-token"}}
+	svc := newMFAAuthServiceForTest(repo, tokens, now)
+	cred := PasswordCredential{Username: "alice", Password: "password123"}
+
+	_, err := svc.LoginPassword(context.Background(), cred, SessionMetadata{})
+	var required *MFARequiredError
+	if !errors.As(err, &required) || !errors.Is(err, ErrMFARequired) {
+		t.Fatalf("LoginPassword err = %v, want MFARequiredError", err)
+	}
+	if tokens.lastPrincipal.ID != 0 {
+		t.Fatal("IssueSession must not run before the second factor")
+	}
+	if !required.Challenge.ExpiresAt.Equal(now.Add(MFAChallengeTTL)) {
+		t.Fatalf("challenge expires at %v", required.Challenge.ExpiresAt)
+	}
+	if _, ok := repo.challenges[required.Challenge.Token]; ok {
+		t.Fatal("challenge tokens must be stored hashed")
+	}
+
+	principal, err := svc.ResolveMFAChallenge(context.Background(), required.Challenge.Token)
+	if err != nil || principal.Username != "alice" {
+		t.Fatalf("ResolveMFAChallenge = %+v, %v", principal, err)
+	}
+	if _, err := svc.CompleteMFALogin(context.Background(), required.Challenge.Token, currentCode(now, -1), SessionMetadata{}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("replayed enrollment code err = %v", err)
+	}
+	got, err := svc.CompleteMFALogin(context.Background(), required.Challenge.Token, currentCode(now, 0), SessionMetadata{DeviceLabel: "Phone"})
+	if err != nil {
+		t.Fatalf("CompleteMFALogin error: %v", err)
+	}
+	if got.AccessToken != "jwt-token" || tokens.lastPrincipal.ID != 7 || tokens.lastMeta.DeviceLabel != "Phone" {
+		t.Fatalf("unexpected session issue: tokens=%+v principal=%+v", got, tokens.lastPrincipal)
+	}
+	if _, err := svc.CompleteMFALogin(context.Background(), required.Challenge.Token, codes[0], SessionMetadata{}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Fatalf("reused challenge err = %v", err)
+	}
+
+	_, err = svc.LoginPassword(context.Background(), cred, SessionMetadata{})
+	errors.As(err, &required)
+	if _, err := svc.CompleteMFALogin(context.Background(), required.Challenge.Token, codes[0], SessionMetadata{}); err != nil {
+		t.Fatalf("recovery code login error: %v", err)
+	}
+	_, err = svc.LoginPassword(context.Background(), cred, SessionMetadata{})
+	errors.As(err, &required)
+	if _, err := svc.CompleteMFALogin(context.Background(), required.Challenge.Token, codes[0], SessionMetadata{}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("reused recovery code err = %v", err)
+	}
+}
+
+func TestAuthService_CompleteMFALogin_DiscardsChallengeAfterMaxAttempts(t *testing.T) {
+	repo := newFakeMFARepo()
+	now := time.Unix(1_700_000_000, 0)
+	enrollForTest(t, repo, now)
+	svc := newMFAAuthServiceForTest(repo, &fakeTokenService{}, now)
+
+	_, err := svc.LoginPassword(context.Background(), PasswordCredential{Username: "alice", Password: "password123"}, SessionMetadata{})
+	var required *MFARequiredError
+	if !errors.As(err, &required) {
+		t.Fatalf("LoginPassword err = %v", err)
+	}
+	for i := 0; i < MaxMFAChallengeAttempts; i++ {
+		if _, err := svc.CompleteMFALogin(context.Background(), required.Challenge.Token, "not-a-code", SessionMetadata{}); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("attempt %d err = %v", i+1, err)
+		}
+	}
+	if _, err := svc.CompleteMFALogin(context.Background(), required.Challenge.Token, currentCode(now, 0), SessionMetadata{}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Fatalf("exhausted challenge err = %v", err)
+	}
+}
+
+func TestAuthService_CompleteMFALogin_RejectsExpiredChallenge(t *testing.T) {
+	repo := newFakeMFARepo()
+	now := time.Unix(1_700_000_000, 0)
+	enrollForTest(t, repo, now)
+	svc := newMFAAuthServiceForTest(repo, &fakeTokenService{}, now)
+
+	_, err := svc.LoginPassword(context.Background(), PasswordCredential{Username: "alice", Password: "password123"}, SessionMetadata{})
+	var required *MFARequiredError
+	errors.As(err, &required)
+	svc.(*authService).now = func() time.Time { return now.Add(MFAChallengeTTL) }
+	if _, err := svc.ResolveMFAChallenge(context.Background(), required.Challenge.Token); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Fatalf("expired challenge err = %v", err)
+	}
+}
+
+type fakeCredential struct{ secondFactor bool }
+
+func (c fakeCredential) SatisfiesMFA() bool { return c.secondFactor }
+
+type fakeAuthenticator struct{}
+
+func (fakeAuthenticator) Authenticate(ctx context.Context, cred Credential) (Principal, error) {
+	_ = ctx
+	if _, ok := cred.(fakeCredential); !ok {
+		return Principal{}, ErrUnsupportedCredential
+	}
+	return Principal{ID: 7, Username: "alice"}, nil
+}
+
+func TestAuthService_Login_AppliesMFAPolicyToEveryCredential(t *testing.T) {
+	repo := newFakeMFARepo()
+	now := time.Unix(1_700_000_000, 0)
+	enrollForTest(t, repo, now)
+	tokens := &fakeTokenService{tokens: SessionTokens{AccessToken: "jwt-token"}}
+	authRepo := &fakeAuthRepo{loginRecord: PasswordLoginRecord{Principal: Principal{ID: 7, Username: "alice"}, PasswordHash: "hash"}}
+	svc := NewAuthServiceWithMFA(authRepo, &fakePasswordVerifier{ok: true}, tokens, repo, fakeTOTP{}, fakeAuthenticator{})
+	ctx := context.Background()
+
+	if _, err := svc.Login(ctx, fakeCredential{}, SessionMetadata{}); !errors.Is(err, ErrMFARequired) {
+		t.Fatalf("single-factor credential err = %v, want MFARequiredError", err)
+	}
+	if tokens.lastPrincipal.ID != 0 {
+		t.Fatal("IssueSession must not run before the second factor")
+	}
+	got, err := svc.Login(ctx, fakeCredential{secondFactor: true}, SessionMetadata{DeviceLabel: "phone"})
+	if err != nil || got.AccessToken != "jwt-token" || tokens.lastPrincipal.ID != 7 || tokens.lastMeta.DeviceLabel != "phone" {
+		t.Fatalf("two-factor credential = %+v, %v", got, err)
+	}
+	if _, err := svc.Login(ctx, PasskeyAssertion{}, SessionMetadata{}); !errors.Is(err, ErrUnsupportedCredential) {
+		t.Fatalf("credential without an authenticator err = %v", err)
+	}
+}
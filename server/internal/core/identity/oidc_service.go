@@ -0,0 +1,339 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidOIDCState        = errors.New("invalid or expired sign-in state")
+	ErrInvalidExternalIdentity = errors.New("identity provider response rejected")
+	ErrExternalIdentityUnknown = errors.New("no account is linked to this identity")
+	ErrExternalIdentityLinked  = errors.New("identity is already linked to an account")
+	ErrExternalIdentityExists  = errors.New("account already has an identity from this provider")
+	ErrExternalIdentityMissing = errors.New("linked identity not found")
+)
+
+const (
+	OIDCStateTTL           = 10 * time.Minute
+	OIDCPurposeLogin       = "login"
+	OIDCPurposeLink        = "link"
+	maxExternalUsernameLen = 32
+)
+
+// ExternalIdentity is what an identity provider asserted about the user in a
+// verified ID token. AMR lists the authentication methods the provider used.
+type ExternalIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+	AMR               []string
+}
+
+// multiFactor reports whether the provider says it used more than one
+// factor, through the RFC 8176 "mfa" authentication method reference.
+func (ident ExternalIdentity) multiFactor() bool {
+	for _, method := range ident.AMR {
+		if method == "mfa" {
+			return true
+		}
+	}
+	return false
+}
+
+// ExternalIdentityLink is an external subject attached to a local account.
+type ExternalIdentityLink struct {
+	UserID      UserID
+	Issuer      string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+}
+
+// OIDCAuthorization is where to send the browser to start a sign-in.
+type OIDCAuthorization struct {
+	URL       string
+	State     string
+	ExpiresAt time.Time
+}
+
+// OIDCLoginState is the server-side half of an authorization request.
+// UserID is set only for link requests.
+type OIDCLoginState struct {
+	UserID       UserID
+	Purpose      string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
+
+// OIDCProvider runs the protocol against one issuer. Exchange redeems the
+// code with the PKCE verifier and returns the claims of an ID token whose
+// signature, issuer, audience, expiry and nonce it has checked.
+type OIDCProvider interface {
+	Issuer() string
+	AuthorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (ExternalIdentity, error)
+}
+
+// OIDCRepository stores links and pending authorization states. Only state
+// hashes are stored and ConsumeOIDCState must delete the state so it can be
+// used once. CreateExternalUser creates an account with no usable password,
+// picking a free username based on the one given, and links it.
+type OIDCRepository interface {
+	CreateOIDCState(ctx context.Context, stateHash string, state OIDCLoginState) error
+	ConsumeOIDCState(ctx context.Context, stateHash string) (OIDCLoginState, error)
+	FindExternalIdentity(ctx context.Context, issuer, subject string) (Principal, error)
+	LinkExternalIdentity(ctx context.Context, userID UserID, ident ExternalIdentity, now time.Time) (ExternalIdentityLink, error)
+	CreateExternalUser(ctx context.Context, username string, ident ExternalIdentity, now time.Time) (Principal, error)
+	TouchExternalIdentity(ctx context.Context, issuer, subject string, now time.Time) error
+	ListExternalIdentities(ctx context.Context, userID UserID) ([]ExternalIdentityLink, error)
+	UnlinkExternalIdentity(ctx context.Context, userID UserID, issuer, subject string) error
+}
+
+// OIDCPolicy decides whether an unlinked identity may create an account.
+// With AllowedEmailDomains set, only verified emails in those domains may.
+// With TrustProviderMFA set, a sign-in the provider marks as multi-factor
+// counts as the second factor; otherwise local TOTP is asked for as after a
+// password.
+type OIDCPolicy struct {
+	AutoCreate          bool
+	AllowedEmailDomains []string
+	TrustProviderMFA    bool
+}
+
+func (p OIDCPolicy) allowsCreate(ident ExternalIdentity) bool {
+	if !p.AutoCreate {
+		return false
+	}
+	if len(p.AllowedEmailDomains) == 0 {
+		return true
+	}
+	if !ident.EmailVerified {
+		return false
+	}
+	at := strings.LastIndex(ident.Email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(ident.Email[at+1:])
+	for _, allowed := range p.AllowedEmailDomains {
+		if domain == strings.ToLower(strings.TrimSpace(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExternalLogin is a redeemed provider sign-in. It is the Credential the
+// OIDC service authenticates, so sessions come from AuthService.Login and
+// its MFA policy like any other login. Only RedeemOIDCLogin makes one that
+// authenticates.
+type ExternalLogin struct {
+	Principal   Principal
+	Identity    ExternalIdentity
+	Created     bool
+	redeemed    bool
+	providerMFA bool
+}
+
+func (l ExternalLogin) SatisfiesMFA() bool { return l.providerMFA }
+
+// OIDCService runs provider sign-in and linking. It is also the
+// Authenticator for the ExternalLogin credentials it redeems.
+type OIDCService interface {
+	Authenticator
+	BeginOIDCLogin(ctx context.Context) (OIDCAuthorization, error)
+	RedeemOIDCLogin(ctx context.Context, state, code string) (ExternalLogin, error)
+	BeginOIDCLink(ctx context.Context, userID UserID) (OIDCAuthorization, error)
+	FinishOIDCLink(ctx context.Context, userID UserID, state, code string) (ExternalIdentityLink, error)
+	ListExternalIdentities(ctx context.Context, userID UserID) ([]ExternalIdentityLink, error)
+	UnlinkExternalIdentity(ctx context.Context, userID UserID, issuer, subject string) error
+}
+
+type oidcService struct {
+	repo     OIDCRepository
+	provider OIDCProvider
+	policy   OIDCPolicy
+	now      func() time.Time
+}
+
+func NewOIDCService(repo OIDCRepository, provider OIDCProvider, policy OIDCPolicy) OIDCService {
+	return &oidcService{repo: repo, provider: provider, policy: policy, now: time.Now}
+}
+
+func (s *oidcService) BeginOIDCLogin(ctx context.Context) (OIDCAuthorization, error) {
+	return s.begin(ctx, 0, OIDCPurposeLogin)
+}
+
+// RedeemOIDCLogin resolves the provider's identity to a linked account,
+// creating one when the policy allows. It never links to an existing account
+// by username or email: linking needs a signed-in user.
+func (s *oidcService) RedeemOIDCLogin(ctx context.Context, state, code string) (ExternalLogin, error) {
+	record, ident, err := s.finish(ctx, state, code)
+	if err != nil {
+		return ExternalLogin{}, err
+	}
+	if record.Purpose != OIDCPurposeLogin {
+		return ExternalLogin{}, ErrInvalidOIDCState
+	}
+	login := ExternalLogin{Identity: ident, redeemed: true, providerMFA: s.policy.TrustProviderMFA && ident.multiFactor()}
+	now := s.now().UTC()
+	principal, err := s.repo.FindExternalIdentity(ctx, ident.Issuer, ident.Subject)
+	if err == nil {
+		if err := s.repo.TouchExternalIdentity(ctx, ident.Issuer, ident.Subject, now); err != nil {
+			return ExternalLogin{}, err
+		}
+		login.Principal = principal
+		return login, nil
+	}
+	if !errors.Is(err, ErrExternalIdentityUnknown) {
+		return ExternalLogin{}, err
+	}
+	if !s.policy.allowsCreate(ident) {
+		return ExternalLogin{}, ErrExternalIdentityUnknown
+	}
+	login.Principal, err = s.repo.CreateExternalUser(ctx, externalUsername(ident), ident, now)
+	if err != nil {
+		return ExternalLogin{}, err
+	}
+	login.Created = true
+	return login, nil
+}
+
+// Authenticate accepts only an ExternalLogin that RedeemOIDCLogin returned.
+func (s *oidcService) Authenticate(ctx context.Context, cred Credential) (Principal, error) {
+	login, ok := cred.(ExternalLogin)
+	if !ok {
+		return Principal{}, ErrUnsupportedCredential
+	}
+	if !login.redeemed || login.Principal.ID == 0 {
+		return Principal{}, ErrInvalidExternalIdentity
+	}
+	return login.Principal, nil
+}
+
+func (s *oidcService) BeginOIDCLink(ctx context.Context, userID UserID) (OIDCAuthorization, error) {
+	return s.begin(ctx, userID, OIDCPurposeLink)
+}
+
+// FinishOIDCLink attaches the provider identity to the signed-in user who
+// started the link.
+func (s *oidcService) FinishOIDCLink(ctx context.Context, userID UserID, state, code string) (ExternalIdentityLink, error) {
+	record, ident, err := s.finish(ctx, state, code)
+	if err != nil {
+		return ExternalIdentityLink{}, err
+	}
+	if record.Purpose != OIDCPurposeLink || record.UserID != userID {
+		return ExternalIdentityLink{}, ErrInvalidOIDCState
+	}
+	return s.repo.LinkExternalIdentity(ctx, userID, ident, s.now().UTC())
+}
+
+func (s *oidcService) ListExternalIdentities(ctx context.Context, userID UserID) ([]ExternalIdentityLink, error) {
+	return s.repo.ListExternalIdentities(ctx, userID)
+}
+
+// UnlinkExternalIdentity does not check for another way to sign in; an
+// account created by the provider can still set a password through reset.
+func (s *oidcService) UnlinkExternalIdentity(ctx context.Context, userID UserID, issuer, subject string) error {
+	issuer, subject = strings.TrimSpace(issuer), strings.TrimSpace(subject)
+	if issuer == "" || subject == "" {
+		return ErrExternalIdentityMissing
+	}
+	return s.repo.UnlinkExternalIdentity(ctx, userID, issuer, subject)
+}
+
+func (s *oidcService) begin(ctx context.Context, userID UserID, purpose string) (OIDCAuthorization, error) {
+	state, err := newOpaqueToken()
+	if err != nil {
+		return OIDCAuthorization{}, err
+	}
+	nonce, err := newOpaqueToken()
+	if err != nil {
+		return OIDCAuthorization{}, err
+	}
+	verifier, err := newOpaqueToken()
+	if err != nil {
+		return OIDCAuthorization{}, err
+	}
+	expiresAt := s.now().UTC().Add(OIDCStateTTL)
+	if err := s.repo.CreateOIDCState(ctx, hashOpaqueToken(state), OIDCLoginState{
+		UserID:       userID,
+		Purpose:      purpose,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    expiresAt,
+	}); err != nil {
+		return OIDCAuthorization{}, err
+	}
+	url, err := s.provider.AuthorizationURL(ctx, state, nonce, pkceChallenge(verifier))
+	if err != nil {
+		return OIDCAuthorization{}, err
+	}
+	return OIDCAuthorization{URL: url, State: state, ExpiresAt: expiresAt}, nil
+}
+
+// finish burns the state before redeeming the code, so an authorization
+// response can only be tried once.
+func (s *oidcService) finish(ctx context.Context, state, code string) (OIDCLoginState, ExternalIdentity, error) {
+	state, code = strings.TrimSpace(state), strings.TrimSpace(code)
+	if state == "" || code == "" {
+		return OIDCLoginState{}, ExternalIdentity{}, ErrInvalidOIDCState
+	}
+	record, err := s.repo.ConsumeOIDCState(ctx, hashOpaqueToken(state))
+	if err != nil {
+		return OIDCLoginState{}, ExternalIdentity{}, err
+	}
+	if !s.now().Before(record.ExpiresAt) {
+		return OIDCLoginState{}, ExternalIdentity{}, ErrInvalidOIDCState
+	}
+	ident, err := s.provider.Exchange(ctx, code, record.CodeVerifier, record.Nonce)
+	if err != nil {
+		return OIDCLoginState{}, ExternalIdentity{}, err
+	}
+	if ident.Issuer != s.provider.Issuer() || ident.Subject == "" {
+		return OIDCLoginState{}, ExternalIdentity{}, ErrInvalidExternalIdentity
+	}
+	return record, ident, nil
+}
+
+// pkceChallenge is the RFC 7636 S256 code challenge.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// externalUsername suggests a username for a new account from the
+// provider's claims, keeping lowercase letters, digits, '.', '_' and '-'.
+func externalUsername(ident ExternalIdentity) string {
+	candidate := ident.PreferredUsername
+	if candidate == "" {
+		candidate = ident.Email
+	}
+	if at := strings.Index(candidate, "@"); at >= 0 {
+		candidate = candidate[:at]
+	}
+	var b strings.Builder
+	for _, r := range strings.ToLower(candidate) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			b.WriteRune(r)
+		}
+		if b.Len() == maxExternalUsernameLen {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
@@ -0,0 +1,306 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type fakeOIDCRepo struct {
+	states  map[string]OIDCLoginState
+	links   map[string]ExternalIdentityLink
+	nextID  UserID
+	created []string
+}
+
+func newFakeOIDCRepo() *fakeOIDCRepo {
+	return &fakeOIDCRepo{states: map[string]OIDCLoginState{}, links: map[string]ExternalIdentityLink{}, nextID: 100}
+}
+
+func (f *fakeOIDCRepo) CreateOIDCState(ctx context.Context, stateHash string, state OIDCLoginState) error {
+	_ = ctx
+	f.states[stateHash] = state
+	return nil
+}
+
+func (f *fakeOIDCRepo) ConsumeOIDCState(ctx context.Context, stateHash string) (OIDCLoginState, error) {
+	_ = ctx
+	state, ok := f.states[stateHash]
+	if !ok {
+		return OIDCLoginState{}, ErrInvalidOIDCState
+	}
+	delete(f.states, stateHash)
+	return state, nil
+}
+
+func (f *fakeOIDCRepo) FindExternalIdentity(ctx context.Context, issuer, subject string) (Principal, error) {
+	_ = ctx
+	link, ok := f.links[issuer+"|"+subject]
+	if !ok {
+		return Principal{}, ErrExternalIdentityUnknown
+	}
+	return Principal{ID: link.UserID, Username: "alice"}, nil
+}
+
+func (f *fakeOIDCRepo) LinkExternalIdentity(ctx context.Context, userID UserID, ident ExternalIdentity, now time.Time) (ExternalIdentityLink, error) {
+	_ = ctx
+	if existing, ok := f.links[ident.Issuer+"|"+ident.Subject]; ok && existing.UserID != userID {
+		return ExternalIdentityLink{}, ErrExternalIdentityLinked
+	}
+	link := ExternalIdentityLink{UserID: userID, Issuer: ident.Issuer, Subject: ident.Subject, Email: ident.Email, CreatedAt: now}
+	f.links[ident.Issuer+"|"+ident.Subject] = link
+	return link, nil
+}
+
+func (f *fakeOIDCRepo) CreateExternalUser(ctx context.Context, username string, ident ExternalIdentity, now time.Time) (Principal, error) {
+	f.nextID++
+	f.created = append(f.created, username)
+	if _, err := f.LinkExternalIdentity(ctx, f.nextID, ident, now); err != nil {
+		return Principal{}, err
+	}
+	return Principal{ID: f.nextID, Username: username}, nil
+}
+
+func (f *fakeOIDCRepo) TouchExternalIdentity(ctx context.Context, issuer, subject string, now time.Time) error {
+	_ = ctx
+	link := f.links[issuer+"|"+subject]
+	link.LastLoginAt = &now
+	f.links[issuer+"|"+subject] = link
+	return nil
+}
+
+func (f *fakeOIDCRepo) ListExternalIdentities(ctx context.Context, userID UserID) ([]ExternalIdentityLink, error) {
+	_ = ctx
+	out := []ExternalIdentityLink{}
+	for _, link := range f.links {
+		if link.UserID == userID {
+			out = append(out, link)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeOIDCRepo) UnlinkExternalIdentity(ctx context.Context, userID UserID, issuer, subject string) error {
+	_ = ctx
+	link, ok := f.links[issuer+"|"+subject]
+	if !ok || link.UserID != userID {
+		return ErrExternalIdentityMissing
+	}
+	delete(f.links, issuer+"|"+subject)
+	return nil
+}
+
+// fakeOIDCProvider accepts a code equal to the PKCE challenge it was given
+// for the matching nonce and returns identity.
+type fakeOIDCProvider struct {
+	identity   ExternalIdentity
+	challenges map[string]string
+}
+
+func (f *fakeOIDCProvider) Issuer() string { return "https://idp.example" }
+
+func (f *fakeOIDCProvider) AuthorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	_ = ctx
+	if f.challenges == nil {
+		f.challenges = map[string]string{}
+	}
+	f.challenges[nonce] = codeChallenge
+	return "https://idp.example/authorize?state=" + url.QueryEscape(state) + "&nonce=" + url.QueryEscape(nonce), nil
+}
+
+func (f *fakeOIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (ExternalIdentity, error) {
+	_ = ctx
+	if code != "code-"+nonce || f.challenges[nonce] != pkceChallenge(codeVerifier) {
+		return ExternalIdentity{}, ErrInvalidExternalIdentity
+	}
+	return f.identity, nil
+}
+
+// authorize plays the browser: it starts at the authorization URL and
+// returns the state and code the provider would redirect back with.
+func authorizeFake(t *testing.T, auth OIDCAuthorization) (string, string) {
+	t.Helper()
+	u, err := url.Parse(auth.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("state"), "code-" + u.Query().Get("nonce")
+}
+
+func TestOIDCService_LinkThenLogin(t *testing.T) {
+	repo := newFakeOIDCRepo()
+	provider := &fakeOIDCProvider{identity: ExternalIdentity{Issuer: "https://idp.example", Subject: "sub-1", Email: "alice@corp.example"}}
+	svc := NewOIDCService(repo, provider, OIDCPolicy{})
+	ctx := context.Background()
+
+	login, err := svc.BeginOIDCLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin error: %v", err)
+	}
+	state, code := authorizeFake(t, login)
+	if _, err := svc.RedeemOIDCLogin(ctx, state, code); !errors.Is(err, ErrExternalIdentityUnknown) {
+		t.Fatalf("unlinked login err = %v", err)
+	}
+	if len(repo.created) != 0 {
+		t.Fatalf("created accounts without policy: %v", repo.created)
+	}
+
+	link, err := svc.BeginOIDCLink(ctx, 7)
+	if err != nil {
+		t.Fatalf("BeginOIDCLink error: %v", err)
+	}
+	state, code = authorizeFake(t, link)
+	if _, err := svc.FinishOIDCLink(ctx, 8, state, code); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("link finished by another user err = %v", err)
+	}
+	if _, err := svc.FinishOIDCLink(ctx, 7, state, code); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("reused link state err = %v", err)
+	}
+	link, _ = svc.BeginOIDCLink(ctx, 7)
+	state, code = authorizeFake(t, link)
+	linked, err := svc.FinishOIDCLink(ctx, 7, state, code)
+	if err != nil || linked.UserID != 7 || linked.Subject != "sub-1" {
+		t.Fatalf("FinishOIDCLink = %+v, %v", linked, err)
+	}
+
+	login, _ = svc.BeginOIDCLogin(ctx)
+	state, code = authorizeFake(t, login)
+	if _, err := svc.FinishOIDCLink(ctx, 7, state, code); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("login state used for linking err = %v", err)
+	}
+	login, _ = svc.BeginOIDCLogin(ctx)
+	state, code = authorizeFake(t, login)
+	got, err := svc.RedeemOIDCLogin(ctx, state, code)
+	if err != nil {
+		t.Fatalf("RedeemOIDCLogin error: %v", err)
+	}
+	if got.Principal.ID != 7 || got.Created {
+		t.Fatalf("login = %+v", got)
+	}
+	if principal, err := svc.Authenticate(ctx, got); err != nil || principal.ID != 7 {
+		t.Fatalf("Authenticate(redeemed) = %+v, %v", principal, err)
+	}
+	if _, err := svc.Authenticate(ctx, ExternalLogin{Principal: Principal{ID: 7}}); !errors.Is(err, ErrInvalidExternalIdentity) {
+		t.Fatalf("Authenticate(unredeemed) err = %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, PasswordCredential{}); !errors.Is(err, ErrUnsupportedCredential) {
+		t.Fatalf("Authenticate(password) err = %v", err)
+	}
+
+	if err := svc.UnlinkExternalIdentity(ctx, 8, "https://idp.example", "sub-1"); !errors.Is(err, ErrExternalIdentityMissing) {
+		t.Fatalf("unlink by another user err = %v", err)
+	}
+	if err := svc.UnlinkExternalIdentity(ctx, 7, "https://idp.example", "sub-1"); err != nil {
+		t.Fatalf("unlink error: %v", err)
+	}
+}
+
+func TestOIDCService_AutoCreatePolicyAndPKCE(t *testing.T) {
+	repo := newFakeOIDCRepo()
+	provider := &fakeOIDCProvider{identity: ExternalIdentity{
+		Issuer:            "https://idp.example",
+		Subject:           "staff-1",
+		Email:             "Bob.Smith@Corp.Example",
+		PreferredUsername: "Bob Smith!",
+	}}
+	svc := NewOIDCService(repo, provider, OIDCPolicy{AutoCreate: true, AllowedEmailDomains: []string{"corp.example"}}).(*oidcService)
+	ctx := context.Background()
+
+	loginWith := func() (ExternalLogin, error) {
+		auth, err := svc.BeginOIDCLogin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, code := authorizeFake(t, auth)
+		return svc.RedeemOIDCLogin(ctx, state, code)
+	}
+	if _, err := loginWith(); !errors.Is(err, ErrExternalIdentityUnknown) {
+		t.Fatalf("unverified email err = %v", err)
+	}
+	provider.identity.EmailVerified = true
+	provider.identity.Email = "bob@elsewhere.example"
+	if _, err := loginWith(); !errors.Is(err, ErrExternalIdentityUnknown) {
+		t.Fatalf("foreign domain err = %v", err)
+	}
+	provider.identity.Email = "bob@CORP.example"
+	got, err := loginWith()
+	if err != nil || !got.Created || got.Principal.Username != "bobsmith" {
+		t.Fatalf("auto-create = %+v, %v", got, err)
+	}
+	again, err := loginWith()
+	if err != nil || again.Created || again.Principal.ID != got.Principal.ID {
+		t.Fatalf("second login = %+v, %v", again, err)
+	}
+
+	auth, _ := svc.BeginOIDCLogin(ctx)
+	state, _ := authorizeFake(t, auth)
+	if _, err := svc.RedeemOIDCLogin(ctx, state, "code-wrong-nonce"); !errors.Is(err, ErrInvalidExternalIdentity) {
+		t.Fatalf("mismatched code err = %v", err)
+	}
+
+	auth, _ = svc.BeginOIDCLogin(ctx)
+	state, code := authorizeFake(t, auth)
+	svc.now = func() time.Time { return time.Now().Add(OIDCStateTTL + time.Second) }
+	if _, err := svc.RedeemOIDCLogin(ctx, state, code); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("expired state err = %v", err)
+	}
+}
+
+func TestOIDCService_LoginAppliesMFAPolicyUnlessProviderMFAIsTrusted(t *testing.T) {
+	mfaRepo := newFakeMFARepo()
+	enrollForTest(t, mfaRepo, time.Unix(1_700_000_000, 0))
+	repo := newFakeOIDCRepo()
+	provider := &fakeOIDCProvider{identity: ExternalIdentity{Issuer: "https://idp.example", Subject: "sub-1", AMR: []string{"pwd", "otp", "mfa"}}}
+	ctx := context.Background()
+	if _, err := repo.LinkExternalIdentity(ctx, 7, provider.identity, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	loginWith := func(policy OIDCPolicy) (SessionTokens, error) {
+		t.Helper()
+		oidcSvc := NewOIDCService(repo, provider, policy)
+		tokens := &fakeTokenService{tokens: SessionTokens{AccessToken: "access"}}
+		authSvc := NewAuthServiceWithMFA(&fakeAuthRepo{}, &fakePasswordVerifier{}, tokens, mfaRepo, fakeTOTP{}, oidcSvc)
+		begin, err := oidcSvc.BeginOIDCLogin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, code := authorizeFake(t, begin)
+		login, err := oidcSvc.RedeemOIDCLogin(ctx, state, code)
+		if err != nil {
+			t.Fatalf("RedeemOIDCLogin error: %v", err)
+		}
+		return authSvc.Login(ctx, login, SessionMetadata{})
+	}
+
+	if _, err := loginWith(OIDCPolicy{}); !errors.Is(err, ErrMFARequired) {
+		t.Fatalf("untrusted provider MFA err = %v, want MFARequiredError", err)
+	}
+	provider.identity.AMR = []string{"pwd"}
+	if _, err := loginWith(OIDCPolicy{TrustProviderMFA: true}); !errors.Is(err, ErrMFARequired) {
+		t.Fatalf("single-factor provider sign-in err = %v, want MFARequiredError", err)
+	}
+	provider.identity.AMR = []string{"pwd", "otp", "mfa"}
+	got, err := loginWith(OIDCPolicy{TrustProviderMFA: true})
+	if err != nil || got.AccessToken != "access" {
+		t.Fatalf("trusted provider MFA = %+v, %v", got, err)
+	}
+}
+
+func TestExternalUsername(t *testing.T) {
+	for _, tc := range []struct {
+		ident ExternalIdentity
+		want  string
+	}{
+		{ExternalIdentity{PreferredUsername: "jane.doe"}, "jane.doe"},
+		{ExternalIdentity{Email: "J_Doe+chat@corp.example"}, "j_doechat"},
+		{ExternalIdentity{PreferredUsername: "日本"}, "user"},
+		{ExternalIdentity{PreferredUsername: "abcdefghijklmnopqrstuvwxyz0123456789"}, "abcdefghijklmnopqrstuvwxyz012345"},
+	} {
+		if got := externalUsername(tc.ident); got != tc.want {
+			t.Fatalf("externalUsername(%+v) = %q, want %q", tc.ident, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPasskeyNotFound          = errors.New("passkey not found")
+	ErrPasskeyExists            = errors.New("passkey already registered")
+	ErrPasskeyLimitReached      = errors.New("passkey limit reached")
+	ErrInvalidPasskeyChallenge  = errors.New("invalid or expired passkey challenge")
+	ErrInvalidPasskeyAssertion  = errors.New("invalid passkey response")
+	ErrPasskeySignCountRollback = errors.New("passkey signature counter did not increase")
+)
+
+const (
+	PasskeyChallengeTTL        = 5 * time.Minute
+	MaxPasskeysPerUser         = 20
+	MaxPasskeyLabelLength      = 64
+	PasskeyPurposeRegister     = "registration"
+	PasskeyPurposeAuthenticate = "authentication"
+)
+
+// RelyingParty identifies this server to WebAuthn authenticators.
+type RelyingParty struct {
+	ID   string
+	Name string
+}
+
+// PasskeyCredential is a registered WebAuthn public-key credential. ID is the
+// base64url credential ID and PublicKey is the COSE_Key from registration.
+type PasskeyCredential struct {
+	ID         string
+	UserID     UserID
+	Label      string
+	PublicKey  []byte
+	Algorithm  int64
+	SignCount  uint32
+	AAGUID     string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// PasskeyAttestation is the browser's response to navigator.credentials.create.
+type PasskeyAttestation struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// PasskeyAssertion is the browser's response to navigator.credentials.get.
+type PasskeyAssertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+// SatisfiesMFA is true because the verifier requires user verification, so a
+// passkey proves possession and a PIN or biometric at once.
+func (PasskeyAssertion) SatisfiesMFA() bool { return true }
+
+type PasskeyRegistrationOptions struct {
+	RelyingParty         RelyingParty
+	Challenge            string
+	UserHandle           []byte
+	Username             string
+	ExcludeCredentialIDs []string
+	Timeout              time.Duration
+}
+
+type PasskeyLoginOptions struct {
+	RelyingParty RelyingParty
+	Challenge    string
+	Timeout      time.Duration
+}
+
+type PasskeyChallengeRecord struct {
+	UserID    UserID
+	Purpose   string
+	ExpiresAt time.Time
+}
+
+// PasskeyVerifier performs the WebAuthn ceremony checks. Challenge is the
+// base64url challenge issued by this service.
+type PasskeyVerifier interface {
+	RelyingParty() RelyingParty
+	ClientChallenge(clientDataJSON []byte) (string, error)
+	VerifyRegistration(challenge string, resp PasskeyAttestation) (PasskeyCredential, error)
+	VerifyAssertion(challenge string, resp PasskeyAssertion, publicKey []byte) (uint32, error)
+}
+
+// PasskeyRepository stores credentials and ceremony challenges.
+// ResolveSigningKey returns the COSE public key for a credential ID owned by
+// the principal. ConsumePasskeyChallenge must delete the challenge so it can
+// only be used once.
+type PasskeyRepository interface {
+	KeyMaterialProvider
+	GetPrincipal(ctx context.Context, userID UserID) (Principal, error)
+	UserHandle(ctx context.Context, userID UserID) ([]byte, error)
+	CreatePasskeyChallenge(ctx context.Context, challenge string, userID UserID, purpose string, expiresAt time.Time) error
+	ConsumePasskeyChallenge(ctx context.Context, challenge string) (PasskeyChallengeRecord, error)
+	CreatePasskey(ctx context.Context, cred PasskeyCredential) (PasskeyCredential, error)
+	GetPasskey(ctx context.Context, credentialID string) (PasskeyCredential, error)
+	ListPasskeys(ctx context.Context, userID UserID) ([]PasskeyCredential, error)
+	DeletePasskey(ctx context.Context, userID UserID, credentialID string) error
+	UpdatePasskeySignCount(ctx context.Context, credentialID string, previous, next uint32, usedAt time.Time) (bool, error)
+}
+
+// PasskeyService manages passkeys. It is also the Authenticator for
+// PasskeyAssertion credentials: logins go through AuthService.Login, which
+// applies the same session and MFA policy as a password login.
+type PasskeyService interface {
+	Authenticator
+	AuthenticatePasskey(ctx context.Context, assertion PasskeyAssertion) (Principal, error)
+	BeginPasskeyRegistration(ctx context.Context, userID UserID) (PasskeyRegistrationOptions, error)
+	FinishPasskeyRegistration(ctx context.Context, userID UserID, label string, resp PasskeyAttestation) (PasskeyCredential, error)
+	ListPasskeys(ctx context.Context, userID UserID) ([]PasskeyCredential, error)
+	DeletePasskey(ctx context.Context, userID UserID, credentialID string) error
+	BeginPasskeyLogin(ctx context.Context) (PasskeyLoginOptions, error)
+}
+
+type passkeyService struct {
+	repo     PasskeyRepository
+	verifier PasskeyVerifier
+	now      func() time.Time
+}
+
+func NewPasskeyService(repo PasskeyRepository, verifier PasskeyVerifier) PasskeyService {
+	return &passkeyService{repo: repo, verifier: verifier, now: time.Now}
+}
+
+func (s *passkeyService) BeginPasskeyRegistration(ctx context.Context, userID UserID) (PasskeyRegistrationOptions, error) {
+	principal, err := s.repo.GetPrincipal(ctx, userID)
+	if err != nil {
+		return PasskeyRegistrationOptions{}, err
+	}
+	handle, err := s.repo.UserHandle(ctx, userID)
+	if err != nil {
+		return PasskeyRegistrationOptions{}, err
+	}
+	existing, err := s.repo.ListPasskeys(ctx, userID)
+	if err != nil {
+		return PasskeyRegistrationOptions{}, err
+	}
+	if len(existing) >= MaxPasskeysPerUser {
+		return PasskeyRegistrationOptions{}, ErrPasskeyLimitReached
+	}
+	challenge, err := s.issueChallenge(ctx, userID, PasskeyPurposeRegister)
+	if err != nil {
+		return PasskeyRegistrationOptions{}, err
+	}
+	exclude := make([]string, 0, len(existing))
+	for _, cred := range existing {
+		exclude = append(exclude, cred.ID)
+	}
+	return PasskeyRegistrationOptions{
+		RelyingParty:         s.verifier.RelyingParty(),
+		Challenge:            challenge,
+		UserHandle:           handle,
+		Username:             principal.Username,
+		ExcludeCredentialIDs: exclude,
+		Timeout:              PasskeyChallengeTTL,
+	}, nil
+}
+
+func (s *passkeyService) FinishPasskeyRegistration(ctx context.Context, userID UserID, label string, resp PasskeyAttestation) (PasskeyCredential, error) {
+	label = strings.TrimSpace(label)
+	if len([]rune(label)) > MaxPasskeyLabelLength {
+		return PasskeyCredential{}, ErrInvalidPasskeyAssertion
+	}
+	challenge, record, err := s.consumeChallenge(ctx, resp.ClientDataJSON, PasskeyPurposeRegister)
+	if err != nil {
+		return PasskeyCredential{}, err
+	}
+	if record.UserID != userID {
+		return PasskeyCredential{}, ErrInvalidPasskeyChallenge
+	}
+	cred, err := s.verifier.VerifyRegistration(challenge, resp)
+	if err != nil {
+		return PasskeyCredential{}, err
+	}
+	cred.UserID = userID
+	cred.Label = label
+	cred.CreatedAt = s.now().UTC()
+	return s.repo.CreatePasskey(ctx, cred)
+}
+
+func (s *passkeyService) ListPasskeys(ctx context.Context, userID UserID) ([]PasskeyCredential, error) {
+	return s.repo.ListPasskeys(ctx, userID)
+}
+
+func (s *passkeyService) DeletePasskey(ctx context.Context, userID UserID, credentialID string) error {
+	credentialID = strings.TrimSpace(credentialID)
+	if credentialID == "" {
+		return ErrPasskeyNotFound
+	}
+	return s.repo.DeletePasskey(ctx, userID, credentialID)
+}
+
+// BeginPasskeyLogin issues a challenge for a discoverable-credential login, so
+// the client does not need to send a username first.
+func (s *passkeyService) BeginPasskeyLogin(ctx context.Context) (PasskeyLoginOptions, error) {
+	challenge, err := s.issueChallenge(ctx, 0, PasskeyPurposeAuthenticate)
+	if err != nil {
+		return PasskeyLoginOptions{}, err
+	}
+	return PasskeyLoginOptions{
+		RelyingParty: s.verifier.RelyingParty(),
+		Challenge:    challenge,
+		Timeout:      PasskeyChallengeTTL,
+	}, nil
+}
+
+// AuthenticatePasskey verifies an assertion against the stored public key and
+// advances the signature counter. A counter that fails to increase suggests a
+// cloned authenticator and rejects the login; authenticators that always
+// report zero are accepted.
+func (s *passkeyService) AuthenticatePasskey(ctx context.Context, assertion PasskeyAssertion) (Principal, error) {
+	challenge, _, err := s.consumeChallenge(ctx, assertion.ClientDataJSON, PasskeyPurposeAuthenticate)
+	if err != nil {
+		return Principal{}, err
+	}
+	credentialID := base64.RawURLEncoding.EncodeToString(assertion.CredentialID)
+	cred, err := s.repo.GetPasskey(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, ErrPasskeyNotFound) {
+			return Principal{}, ErrInvalidPasskeyAssertion
+		}
+		return Principal{}, err
+	}
+	if len(assertion.UserHandle) > 0 {
+		handle, err := s.repo.UserHandle(ctx, cred.UserID)
+		if err != nil {
+			return Principal{}, err
+		}
+		if string(handle) != string(assertion.UserHandle) {
+			return Principal{}, ErrInvalidPasskeyAssertion
+		}
+	}
+	principal, err := s.repo.GetPrincipal(ctx, cred.UserID)
+	if err != nil {
+		return Principal{}, err
+	}
+	publicKey, err := s.repo.ResolveSigningKey(ctx, principal, credentialID)
+	if err != nil {
+		return Principal{}, err
+	}
+	signCount, err := s.verifier.VerifyAssertion(challenge, assertion, publicKey)
+	if err != nil {
+		return Principal{}, err
+	}
+	if (signCount != 0 || cred.SignCount != 0) && signCount <= cred.SignCount {
+		return Principal{}, ErrPasskeySignCountRollback
+	}
+	updated, err := s.repo.UpdatePasskeySignCount(ctx, credentialID, cred.SignCount, signCount, s.now().UTC())
+	if err != nil {
+		return Principal{}, err
+	}
+	if !updated {
+		return Principal{}, ErrPasskeySignCountRollback
+	}
+	return principal, nil
+}
+
+func (s *passkeyService) Authenticate(ctx context.Context, cred Credential) (Principal, error) {
+	assertion, ok := cred.(PasskeyAssertion)
+	if !ok {
+		return Principal{}, ErrUnsupportedCredential
+	}
+	return s.AuthenticatePasskey(ctx, assertion)
+}
+
+func (s *passkeyService) issueChallenge(ctx context.Context, userID UserID, purpose string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(buf)
+	if err := s.repo.CreatePasskeyChallenge(ctx, challenge, userID, purpose, s.now().UTC().Add(PasskeyChallengeTTL)); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// consumeChallenge finds the challenge the client signed over and burns it
+// before any verification, so a failed ceremony cannot be retried.
+func (s *passkeyService) consumeChallenge(ctx context.Context, clientDataJSON []byte, purpose string) (string, PasskeyChallengeRecord, error) {
+	challenge, err := s.verifier.ClientChallenge(clientDataJSON)
+	if err != nil || challenge == "" {
+		return "", PasskeyChallengeRecord{}, ErrInvalidPasskeyAssertion
+	}
+	record, err := s.repo.ConsumePasskeyChallenge(ctx, challenge)
+	if err != nil {
+		return "", PasskeyChallengeRecord{}, err
+	}
+	if record.Purpose != purpose || !s.now().Before(record.ExpiresAt) {
+		return "", PasskeyChallengeRecord{}, ErrInvalidPasskeyChallenge
+	}
+	return challenge, record, nil
+}
@@ -0,0 +1,296 @@
+package identity
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakePasskeyRepo struct {
+	handles    map[UserID][]byte
+	challenges map[string]PasskeyChallengeRecord
+	creds      map[string]PasskeyCredential
+}
+
+func newFakePasskeyRepo() *fakePasskeyRepo {
+	return &fakePasskeyRepo{
+		handles:    map[UserID][]byte{},
+		challenges: map[string]PasskeyChallengeRecord{},
+		creds:      map[string]PasskeyCredential{},
+	}
+}
+
+func (f *fakePasskeyRepo) ResolveSigningKey(ctx context.Context, principal Principal, keyRef string) ([]byte, error) {
+	_ = ctx
+	cred, ok := f.creds[keyRef]
+	if !ok || cred.UserID != principal.ID {
+		return nil, ErrPasskeyNotFound
+	}
+	return cred.PublicKey, nil
+}
+
+func (f *fakePasskeyRepo) GetPrincipal(ctx context.Context, userID UserID) (Principal, error) {
+	_ = ctx
+	return Principal{ID: userID, Username: "alice"}, nil
+}
+
+func (f *fakePasskeyRepo) UserHandle(ctx context.Context, userID UserID) ([]byte, error) {
+	_ = ctx
+	if _, ok := f.handles[userID]; !ok {
+		f.handles[userID] = []byte{byte(userID), 0xaa}
+	}
+	return f.handles[userID], nil
+}
+
+func (f *fakePasskeyRepo) CreatePasskeyChallenge(ctx context.Context, challenge string, userID UserID, purpose string, expiresAt time.Time) error {
+	_ = ctx
+	f.challenges[challenge] = PasskeyChallengeRecord{UserID: userID, Purpose: purpose, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (f *fakePasskeyRepo) ConsumePasskeyChallenge(ctx context.Context, challenge string) (PasskeyChallengeRecord, error) {
+	_ = ctx
+	record, ok := f.challenges[challenge]
+	if !ok {
+		return PasskeyChallengeRecord{}, ErrInvalidPasskeyChallenge
+	}
+	delete(f.challenges, challenge)
+	return record, nil
+}
+
+func (f *fakePasskeyRepo) CreatePasskey(ctx context.Context, cred PasskeyCredential) (PasskeyCredential, error) {
+	_ = ctx
+	if _, ok := f.creds[cred.ID]; ok {
+		return PasskeyCredential{}, ErrPasskeyExists
+	}
+	f.creds[cred.ID] = cred
+	return cred, nil
+}
+
+func (f *fakePasskeyRepo) GetPasskey(ctx context.Context, credentialID string) (PasskeyCredential, error) {
+	_ = ctx
+	cred, ok := f.creds[credentialID]
+	if !ok {
+		return PasskeyCredential{}, ErrPasskeyNotFound
+	}
+	return cred, nil
+}
+
+func (f *fakePasskeyRepo) ListPasskeys(ctx context.Context, userID UserID) ([]PasskeyCredential, error) {
+	_ = ctx
+	out := []PasskeyCredential{}
+	for _, cred := range f.creds {
+		if cred.UserID == userID {
+			out = append(out, cred)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakePasskeyRepo) DeletePasskey(ctx context.Context, userID UserID, credentialID string) error {
+	_ = ctx
+	cred, ok := f.creds[credentialID]
+	if !ok || cred.UserID != userID {
+		return ErrPasskeyNotFound
+	}
+	delete(f.creds, credentialID)
+	return nil
+}
+
+func (f *fakePasskeyRepo) UpdatePasskeySignCount(ctx context.Context, credentialID string, previous, next uint32, usedAt time.Time) (bool, error) {
+	_ = ctx
+	cred, ok := f.creds[credentialID]
+	if !ok || cred.SignCount != previous {
+		return false, nil
+	}
+	cred.SignCount = next
+	cred.LastUsedAt = &usedAt
+	f.creds[credentialID] = cred
+	return true, nil
+}
+
+// fakePasskeyVerifier treats clientDataJSON as the bare challenge and trusts
+// everything else, reporting signCount from every assertion.
+type fakePasskeyVerifier struct {
+	signCount uint32
+}
+
+func (f *fakePasskeyVerifier) RelyingParty() RelyingParty {
+	return RelyingParty{ID: "chat.example", Name: "Chat"}
+}
+
+func (f *fakePasskeyVerifier) ClientChallenge(clientDataJSON []byte) (string, error) {
+	return string(clientDataJSON), nil
+}
+
+func (f *fakePasskeyVerifier) VerifyRegistration(challenge string, resp PasskeyAttestation) (PasskeyCredential, error) {
+	if challenge != string(resp.ClientDataJSON) {
+		return PasskeyCredential{}, ErrInvalidPasskeyAssertion
+	}
+	return PasskeyCredential{
+		ID:        base64.RawURLEncoding.EncodeToString(resp.CredentialID),
+		PublicKey: []byte("cose-key"),
+		Algorithm: -7,
+	}, nil
+}
+
+func (f *fakePasskeyVerifier) VerifyAssertion(challenge string, resp PasskeyAssertion, publicKey []byte) (uint32, error) {
+	if challenge != string(resp.ClientDataJSON) || string(publicKey) != "cose-key" {
+		return 0, ErrInvalidPasskeyAssertion
+	}
+	return f.signCount, nil
+}
+
+func registerFakePasskey(t *testing.T, svc PasskeyService, userID UserID, credentialID []byte) {
+	t.Helper()
+	opts, err := svc.BeginPasskeyRegistration(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration error: %v", err)
+	}
+	if _, err := svc.FinishPasskeyRegistration(context.Background(), userID, "laptop", PasskeyAttestation{
+		CredentialID:   credentialID,
+		ClientDataJSON: []byte(opts.Challenge),
+	}); err != nil {
+		t.Fatalf("FinishPasskeyRegistration error: %v", err)
+	}
+}
+
+func TestPasskeyService_RegisterAndLogin(t *testing.T) {
+	repo := newFakePasskeyRepo()
+	verifier := &fakePasskeyVerifier{}
+	tokens := &fakeTokenService{tokens: SessionTokens{AccessToken: "access"}}
+	svc := NewPasskeyService(repo, verifier)
+	auth := NewAuthService(&fakeAuthRepo{}, &fakePasswordVerifier{}, tokens, svc)
+	ctx := context.Background()
+
+	opts, err := svc.BeginPasskeyRegistration(ctx, 7)
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration error: %v", err)
+	}
+	if opts.Username != "alice" || len(opts.UserHandle) == 0 || opts.Challenge == "" {
+		t.Fatalf("registration options = %+v", opts)
+	}
+	if _, err := svc.FinishPasskeyRegistration(ctx, 8, "", PasskeyAttestation{
+		CredentialID:   []byte{1},
+		ClientDataJSON: []byte(opts.Challenge),
+	}); !errors.Is(err, ErrInvalidPasskeyChallenge) {
+		t.Fatalf("registration by another user err = %v", err)
+	}
+	registerFakePasskey(t, svc, 7, []byte{1, 2, 3})
+
+	again, err := svc.BeginPasskeyRegistration(ctx, 7)
+	if err != nil || len(again.ExcludeCredentialIDs) != 1 {
+		t.Fatalf("exclude list = %+v, err = %v", again.ExcludeCredentialIDs, err)
+	}
+
+	login, err := svc.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin error: %v", err)
+	}
+	verifier.signCount = 1
+	assertion := PasskeyAssertion{
+		CredentialID:   []byte{1, 2, 3},
+		ClientDataJSON: []byte(login.Challenge),
+		UserHandle:     repo.handles[7],
+	}
+	got, err := auth.Login(ctx, assertion, SessionMetadata{DeviceLabel: "phone"})
+	if err != nil {
+		t.Fatalf("Login error: %v", err)
+	}
+	if got.AccessToken != "access" || tokens.lastPrincipal.ID != 7 || tokens.lastMeta.DeviceLabel != "phone" {
+		t.Fatalf("issued %+v for %+v", got, tokens.lastPrincipal)
+	}
+	if _, err := auth.Login(ctx, assertion, SessionMetadata{}); !errors.Is(err, ErrInvalidPasskeyChallenge) {
+		t.Fatalf("replayed challenge err = %v", err)
+	}
+	if _, err := svc.FinishPasskeyRegistration(ctx, 7, "", PasskeyAttestation{
+		CredentialID:   []byte{9},
+		ClientDataJSON: []byte(mustBeginLogin(t, svc)),
+	}); !errors.Is(err, ErrInvalidPasskeyChallenge) {
+		t.Fatalf("login challenge used for registration err = %v", err)
+	}
+}
+
+func TestPasskeyService_RejectsSignCountRollbackAndForeignHandle(t *testing.T) {
+	repo := newFakePasskeyRepo()
+	verifier := &fakePasskeyVerifier{signCount: 5}
+	svc := NewPasskeyService(repo, verifier)
+	ctx := context.Background()
+	registerFakePasskey(t, svc, 7, []byte{1})
+
+	assert := func(handle []byte) error {
+		_, err := svc.AuthenticatePasskey(ctx, PasskeyAssertion{
+			CredentialID:   []byte{1},
+			ClientDataJSON: []byte(mustBeginLogin(t, svc)),
+			UserHandle:     handle,
+		})
+		return err
+	}
+	if err := assert(nil); err != nil {
+		t.Fatalf("first assertion error: %v", err)
+	}
+	if err := assert(nil); !errors.Is(err, ErrPasskeySignCountRollback) {
+		t.Fatalf("repeated counter err = %v", err)
+	}
+	verifier.signCount = 3
+	if err := assert(nil); !errors.Is(err, ErrPasskeySignCountRollback) {
+		t.Fatalf("lower counter err = %v", err)
+	}
+	verifier.signCount = 6
+	if err := assert([]byte("someone-else")); !errors.Is(err, ErrInvalidPasskeyAssertion) {
+		t.Fatalf("foreign user handle err = %v", err)
+	}
+	if err := assert(nil); err != nil {
+		t.Fatalf("advanced counter error: %v", err)
+	}
+
+	zero := newFakePasskeyRepo()
+	zeroSvc := NewPasskeyService(zero, &fakePasskeyVerifier{})
+	registerFakePasskey(t, zeroSvc, 7, []byte{2})
+	for i := 0; i < 2; i++ {
+		if _, err := zeroSvc.AuthenticatePasskey(ctx, PasskeyAssertion{
+			CredentialID:   []byte{2},
+			ClientDataJSON: []byte(mustBeginLogin(t, zeroSvc)),
+		}); err != nil {
+			t.Fatalf("zero-counter authenticator login %d error: %v", i, err)
+		}
+	}
+}
+
+func TestPasskeyService_ExpiredChallengeAndUnknownCredential(t *testing.T) {
+	repo := newFakePasskeyRepo()
+	svc := NewPasskeyService(repo, &fakePasskeyVerifier{signCount: 1}).(*passkeyService)
+	ctx := context.Background()
+	registerFakePasskey(t, svc, 7, []byte{1})
+
+	challenge := mustBeginLogin(t, svc)
+	svc.now = func() time.Time { return time.Now().Add(PasskeyChallengeTTL + time.Second) }
+	if _, err := svc.AuthenticatePasskey(ctx, PasskeyAssertion{
+		CredentialID:   []byte{1},
+		ClientDataJSON: []byte(challenge),
+	}); !errors.Is(err, ErrInvalidPasskeyChallenge) {
+		t.Fatalf("expired challenge err = %v", err)
+	}
+	svc.now = time.Now
+
+	if _, err := svc.AuthenticatePasskey(ctx, PasskeyAssertion{
+		CredentialID:   []byte{42},
+		ClientDataJSON: []byte(mustBeginLogin(t, svc)),
+	}); !errors.Is(err, ErrInvalidPasskeyAssertion) {
+		t.Fatalf("unknown credential err = %v", err)
+	}
+	if err := svc.DeletePasskey(ctx, 8, base64.RawURLEncoding.EncodeToString([]byte{1})); !errors.Is(err, ErrPasskeyNotFound) {
+		t.Fatalf("delete by another user err = %v", err)
+	}
+}
+
+func mustBeginLogin(t *testing.T, svc PasskeyService) string {
+	t.Helper()
+	opts, err := svc.BeginPasskeyLogin(context.Background())
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin error: %v", err)
+	}
+	return opts.Challenge
+}
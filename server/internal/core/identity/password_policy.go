@@ -0,0 +1,80 @@
+package identity
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrWeakPassword = errors.New("password does not meet policy")
+
+const (
+	MinPasswordLength = 8
+	// MaxPasswordBytes is bcrypt's input limit; longer passwords would be
+	// silently truncated.
+	MaxPasswordBytes = 72
+)
+
+// PasswordPolicyError names the rule a password broke. It matches
+// ErrWeakPassword with errors.Is.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string { return e.Reason }
+
+func (e *PasswordPolicyError) Is(target error) bool { return target == ErrWeakPassword }
+
+// commonPasswords lists passwords that pass the length and character-class
+// rules but top every breached-password list.
+var commonPasswords = map[string]struct{}{
+	"password1":  {},
+	"password1!": {},
+	"passw0rd":   {},
+	"p@ssw0rd":   {},
+	"p@ssword":   {},
+	"qwerty123":  {},
+	"qwerty12":   {},
+	"abc12345":   {},
+	"abcd1234":   {},
+	"1q2w3e4r":   {},
+	"1qaz2wsx":   {},
+	"iloveyou1":  {},
+	"letmein1":   {},
+	"welcome1":   {},
+	"admin123":   {},
+	"changeme1":  {},
+	"trustno1":   {},
+}
+
+// ValidatePassword applies the account password policy: 8 to 72 bytes, at
+// least one letter and one digit or symbol, not containing the username, and
+// not a well-known password.
+func ValidatePassword(username, password string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return &PasswordPolicyError{Reason: "password too short"}
+	}
+	if len(password) > MaxPasswordBytes {
+		return &PasswordPolicyError{Reason: "password too long"}
+	}
+	var hasLetter, hasOther bool
+	for _, r := range password {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+		} else if !unicode.IsSpace(r) {
+			hasOther = true
+		}
+	}
+	if !hasLetter || !hasOther {
+		return &PasswordPolicyError{Reason: "password must contain a letter and a digit or symbol"}
+	}
+	lower := strings.ToLower(password)
+	if name := strings.ToLower(strings.TrimSpace(username)); len(name) >= 3 && strings.Contains(lower, name) {
+		return &PasswordPolicyError{Reason: "password must not contain the username"}
+	}
+	if _, ok := commonPasswords[lower]; ok {
+		return &PasswordPolicyError{Reason: "password is too common"}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package identity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	cases := []struct {
+		username string
+		password string
+		reason   string
+	}{
+		{"alice", "password123", ""},
+		{"alice", "correct horse battery 9", ""},
+		{"alice", "pässwörd-ü", ""},
+		{"alice", "short1", "password too short"},
+		{"alice", strings.Repeat("a1", 37), "password too long"},
+		{"alice", "abcdefghij", "password must contain a letter and a digit or symbol"},
+		{"alice", "1234567890", "password must contain a letter and a digit or symbol"},
+		{"alice", "Alice2024!", "password must not contain the username"},
+		{"alice", "Passw0rd", "password is too common"},
+	}
+	for _, tc := range cases {
+		err := ValidatePassword(tc.username, tc.password)
+		if tc.reason == "" {
+			if err != nil {
+				t.Fatalf("ValidatePassword(%q) error: %v", tc.password, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrWeakPassword) || err.Error() != tc.reason {
+			t.Fatalf("ValidatePassword(%q) = %v, want %q", tc.password, err, tc.reason)
+		}
+	}
+}
@@ -11,6 +11,24 @@ var (
 	ErrSessionNotFound     = errors.New("session not found")
 )
 
+// RevokeReasonRefreshTokenReplay is recorded when a rotated-out refresh token
+// is presented again.
+const RevokeReasonRefreshTokenReplay = "refresh_token_replay"
+
+// RefreshTokenReuseError reports a refresh token that was valid once but has
+// since been rotated out. Reuse means the token was copied, so the session
+// family it belonged to has been revoked; SessionIDs lists what was revoked
+// so transports can drop live connections. It matches ErrRefreshTokenReplay
+// with errors.Is.
+type RefreshTokenReuseError struct {
+	UserID     UserID
+	SessionIDs []int64
+}
+
+func (e *RefreshTokenReuseError) Error() string { return ErrRefreshTokenReplay.Error() }
+
+func (e *RefreshTokenReuseError) Is(target error) bool { return target == ErrRefreshTokenReplay }
+
 type SessionService interface {
 	RefreshSession(ctx context.Context, refreshToken string, meta SessionMetadata) (SessionTokens, error)
 	ListSessions(ctx context.Context, userID UserID) ([]Session, error)
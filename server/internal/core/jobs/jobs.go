@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// Job is a periodic maintenance task. Run returns how many items it
+// processed, which is recorded with the job's state.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Timeout bounds one run and sets the lease another process waits out
+	// before taking the job over. Zero means DefaultTimeout.
+	Timeout time.Duration
+	Run     func(ctx context.Context, now time.Time) (int, error)
+}
+
+// State is the persisted schedule and metrics of one job. Attempts counts
+// consecutive failures and is reset by a successful run.
+type State struct {
+	Name           string
+	NextRunAt      time.Time
+	LeaseOwner     string
+	LeaseUntil     *time.Time
+	Attempts       int
+	Runs           int64
+	Failures       int64
+	LastStartedAt  *time.Time
+	LastFinishedAt *time.Time
+	LastDuration   time.Duration
+	LastItems      int
+	LastError      string
+}
+
+// RunResult is what a finished run records.
+type RunResult struct {
+	FinishedAt time.Time
+	NextRunAt  time.Time
+	Duration   time.Duration
+	Items      int
+	// Error is empty when the run succeeded.
+	Error string
+}
+
+// Repository persists job state. ClaimJob must be atomic across processes:
+// it succeeds only when the job is due and its lease is free or expired.
+type Repository interface {
+	// EnsureJob records a job the first time it is registered, due at
+	// firstRunAt. An existing job keeps its schedule.
+	EnsureJob(ctx context.Context, name string, firstRunAt time.Time) error
+	// ClaimJob leases a due job to owner until leaseUntil and returns its
+	// state, or false when it is not due or another owner holds it.
+	ClaimJob(ctx context.Context, name, owner string, now, leaseUntil time.Time) (State, bool, error)
+	// CompleteJob releases owner's lease and records the run. It returns
+	// ErrJobNotFound when owner no longer holds the lease.
+	CompleteJob(ctx context.Context, name, owner string, result RunResult) error
+	ListJobs(ctx context.Context) ([]State, error)
+	// ScheduleJob makes a job due at runAt, for an operator who wants it to
+	// run now.
+	ScheduleJob(ctx context.Context, name string, runAt time.Time) error
+}
@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the run timeout and lease of a job that sets none.
+	DefaultTimeout = 5 * time.Minute
+
+	defaultTick = 15 * time.Second
+	// retryBase is the first retry delay after a failed run. It doubles per
+	// consecutive failure and never exceeds the job's interval.
+	retryBase = 30 * time.Second
+)
+
+// Runner runs registered jobs when they are due. Every process may run a
+// Runner against the same database; the lease in ClaimJob makes sure each
+// due run happens in only one of them.
+type Runner struct {
+	repo   Repository
+	owner  string
+	report func(name string, result RunResult)
+	now    func() time.Time
+	tick   time.Duration
+	jobs   []Job
+}
+
+// NewRunner returns a runner that claims jobs as owner, which must be unique
+// per process. report, when not nil, is called after every run.
+func NewRunner(repo Repository, owner string, report func(name string, result RunResult)) *Runner {
+	return &Runner{
+		repo:   repo,
+		owner:  owner,
+		report: report,
+		now:    time.Now,
+		tick:   defaultTick,
+	}
+}
+
+// Register adds a job. It must be called before Start.
+func (r *Runner) Register(job Job) {
+	r.jobs = append(r.jobs, job)
+}
+
+// Jobs returns the registered jobs.
+func (r *Runner) Jobs() []Job {
+	return append([]Job(nil), r.jobs...)
+}
+
+// Start records every registered job and runs due ones until ctx is
+// cancelled. A new job's first run is one interval after it is recorded, so
+// a restart loop does not run every job on each start.
+func (r *Runner) Start(ctx context.Context) error {
+	now := r.now().UTC()
+	for _, job := range r.jobs {
+		if err := r.repo.EnsureJob(ctx, job.Name, now.Add(job.Interval)); err != nil {
+			return fmt.Errorf("register job %s: %w", job.Name, err)
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(r.tick)
+		defer ticker.Stop()
+		for {
+			_, _ = r.RunDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// RunDue runs every registered job that is due and not leased elsewhere. It
+// returns how many ran.
+func (r *Runner) RunDue(ctx context.Context) (int, error) {
+	ran := 0
+	for _, job := range r.jobs {
+		if ctx.Err() != nil {
+			return ran, ctx.Err()
+		}
+		ok, err := r.runOne(ctx, job)
+		if err != nil {
+			return ran, err
+		}
+		if ok {
+			ran++
+		}
+	}
+	return ran, nil
+}
+
+func (r *Runner) runOne(ctx context.Context, job Job) (bool, error) {
+	timeout := job.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	started := r.now().UTC()
+	state, ok, err := r.repo.ClaimJob(ctx, job.Name, r.owner, started, started.Add(timeout))
+	if err != nil || !ok {
+		return false, err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	items, runErr := job.Run(runCtx, started)
+	cancel()
+
+	finished := r.now().UTC()
+	result := RunResult{
+		FinishedAt: finished,
+		NextRunAt:  finished.Add(job.Interval),
+		Duration:   finished.Sub(started),
+		Items:      items,
+	}
+	if runErr != nil {
+		result.Error = runErr.Error()
+		result.NextRunAt = finished.Add(retryDelay(state.Attempts+1, job.Interval))
+	}
+	// A run that outlived its lease may have been taken over; the new
+	// owner's record wins.
+	if err := r.repo.CompleteJob(ctx, job.Name, r.owner, result); err != nil && !errors.Is(err, ErrJobNotFound) {
+		return true, err
+	}
+	if r.report != nil {
+		r.report(job.Name, result)
+	}
+	return true, nil
+}
+
+// retryDelay is the wait after the attempts-th consecutive failure.
+func retryDelay(attempts int, interval time.Duration) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts && delay < interval; i++ {
+		delay *= 2
+	}
+	if interval > 0 && delay > interval {
+		return interval
+	}
+	return delay
+}
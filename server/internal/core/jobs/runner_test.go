@@ -0,0 +1,150 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeRepo struct {
+	states    map[string]*State
+	completed []RunResult
+	lostLease bool
+}
+
+func (f *fakeRepo) EnsureJob(ctx context.Context, name string, firstRunAt time.Time) error {
+	if f.states == nil {
+		f.states = map[string]*State{}
+	}
+	if _, ok := f.states[name]; !ok {
+		f.states[name] = &State{Name: name, NextRunAt: firstRunAt}
+	}
+	return nil
+}
+
+func (f *fakeRepo) ClaimJob(ctx context.Context, name, owner string, now, leaseUntil time.Time) (State, bool, error) {
+	state := f.states[name]
+	if state == nil || state.NextRunAt.After(now) || (state.LeaseUntil != nil && state.LeaseUntil.After(now)) {
+		return State{}, false, nil
+	}
+	state.LeaseOwner = owner
+	state.LeaseUntil = &leaseUntil
+	return *state, true, nil
+}
+
+func (f *fakeRepo) CompleteJob(ctx context.Context, name, owner string, result RunResult) error {
+	f.completed = append(f.completed, result)
+	if f.lostLease {
+		return ErrJobNotFound
+	}
+	state := f.states[name]
+	state.LeaseOwner, state.LeaseUntil = "", nil
+	state.NextRunAt = result.NextRunAt
+	state.Runs++
+	if result.Error != "" {
+		state.Failures++
+		state.Attempts++
+	} else {
+		state.Attempts = 0
+	}
+	return nil
+}
+
+func (f *fakeRepo) ListJobs(ctx context.Context) ([]State, error) { return nil, nil }
+
+func (f *fakeRepo) ScheduleJob(ctx context.Context, name string, runAt time.Time) error {
+	f.states[name].NextRunAt = runAt
+	return nil
+}
+
+func TestRunner_RunDue_RunsDueJobsAndRetriesFailuresWithBackoff(t *testing.T) {
+	repo := &fakeRepo{}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var reported []string
+	runner := NewRunner(repo, "test", func(name string, _ RunResult) { reported = append(reported, name) })
+	runner.now = func() time.Time { return now }
+
+	failing := true
+	calls := 0
+	runner.Register(Job{Name: "cleanup", Interval: time.Hour, Run: func(ctx context.Context, at time.Time) (int, error) {
+		calls++
+		if failing {
+			return 0, errors.New("database is locked")
+		}
+		return 3, nil
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := runner.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.states["cleanup"].NextRunAt; !got.Equal(now.Add(time.Hour)) {
+		t.Fatalf("first run at %v, want one interval after registration", got)
+	}
+
+	if n, _ := runner.RunDue(context.Background()); n != 0 || calls != 0 {
+		t.Fatalf("job ran before it was due: n=%d calls=%d", n, calls)
+	}
+
+	now = now.Add(time.Hour)
+	for i, wantDelay := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute} {
+		if n, err := runner.RunDue(context.Background()); n != 1 || err != nil {
+			t.Fatalf("attempt %d: n=%d err=%v", i+1, n, err)
+		}
+		state := repo.states["cleanup"]
+		if got := state.NextRunAt.Sub(now); got != wantDelay || state.Attempts != i+1 {
+			t.Fatalf("attempt %d: retry in %v with attempts %d, want %v", i+1, got, state.Attempts, wantDelay)
+		}
+		now = state.NextRunAt
+	}
+
+	failing = false
+	if _, err := runner.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	state := repo.states["cleanup"]
+	if state.Attempts != 0 || state.Runs != 4 || state.Failures != 3 || !state.NextRunAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("state after success = %+v", state)
+	}
+	if last := repo.completed[len(repo.completed)-1]; last.Items != 3 || last.Error != "" {
+		t.Fatalf("last result = %+v", last)
+	}
+	if len(reported) != 4 {
+		t.Fatalf("reported %d runs, want 4", len(reported))
+	}
+}
+
+func TestRunner_RunDue_SkipsLeasedJobsAndToleratesLostLease(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	held := now.Add(time.Minute)
+	repo := &fakeRepo{states: map[string]*State{
+		"prune": {Name: "prune", NextRunAt: now, LeaseOwner: "other", LeaseUntil: &held},
+	}}
+	runner := NewRunner(repo, "test", nil)
+	runner.now = func() time.Time { return now }
+	calls := 0
+	runner.Register(Job{Name: "prune", Interval: time.Minute, Run: func(ctx context.Context, at time.Time) (int, error) {
+		calls++
+		return 0, nil
+	}})
+
+	if n, _ := runner.RunDue(context.Background()); n != 0 || calls != 0 {
+		t.Fatalf("ran a job leased by another process: n=%d", n)
+	}
+
+	now = held
+	repo.lostLease = true
+	if n, err := runner.RunDue(context.Background()); n != 1 || err != nil {
+		t.Fatalf("lost lease should not be an error: n=%d err=%v", n, err)
+	}
+}
+
+func TestRetryDelay_NeverExceedsInterval(t *testing.T) {
+	if got := retryDelay(10, 5*time.Minute); got != 5*time.Minute {
+		t.Fatalf("retryDelay = %v", got)
+	}
+	if got := retryDelay(1, 10*time.Second); got != 10*time.Second {
+		t.Fatalf("retryDelay for a short interval = %v", got)
+	}
+}
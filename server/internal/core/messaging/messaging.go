@@ -10,17 +10,38 @@ type UserID int
 
 type MessageKind string
 
-var ErrMessageNotFound = errors.New("message not found")
+var (
+	ErrMessageNotFound   = errors.New("message not found")
+	ErrInvalidAttachment = errors.New("invalid attachment")
+	ErrReservedKind      = errors.New("content kind is reserved")
+)
+
+// ContentKindAttachment marks a message whose payload is a list of attachment
+// IDs. For encrypted attachments the blob key travels inside the E2EE envelope.
+const ContentKindAttachment = "attachment"
+
+// ContentKindSystem marks messages the server writes into a thread itself,
+// such as a disappearing-message timer change. Clients may not send it.
+const ContentKindSystem = "system"
+
+// ContentKindDeleted marks a message whose sender deleted their account; its
+// content has been cleared. Clients may not send it.
+const ContentKindDeleted = "deleted"
+
+// MaxAttachmentsPerMessage bounds how many attachments a single message may reference.
+const MaxAttachmentsPerMessage = 10
 
 const (
 	KindDirectMessage    MessageKind = "direct_message"
 	KindMessageAck       MessageKind = "message_ack"
 	KindMessageDelivered MessageKind = "message_delivered"
 	KindMessageRead      MessageKind = "message_read"
+	KindThreadTimer      MessageKind = "thread_timer_changed"
 	KindPresenceState    MessageKind = "presence_state"
 	KindUserOnline       MessageKind = "user_online"
 	KindUserOffline      MessageKind = "user_offline"
 	KindError            MessageKind = "error"
+	KindServerGoingAway  MessageKind = "server_going_away"
 )
 
 // Message is the normalized real-time payload envelope for the messaging domain.
@@ -37,6 +58,8 @@ type Message struct {
 	RecipientDeviceID int64       `json:"recipient_device_id,omitempty"`
 	Users             []string    `json:"users,omitempty"`
 	StoredMessageID   int64       `json:"stored_message_id,omitempty"`
+	RetryAfterMs      int64       `json:"retry_after_ms,omitempty"`
+	AttachmentIDs     []int64     `json:"attachment_ids,omitempty"`
 }
 
 // Thread models a future conversation primitive (DM thread, group thread, marketplace order thread).
@@ -77,8 +100,24 @@ type StoredMessage struct {
 	CreatedAt         time.Time
 	DeliveredAt       *time.Time
 	ReadAt            *time.Time
+	ExpiresAt         *time.Time
 	ClientMessageID   int64
 	DeliveryFailed    bool
+	AttachmentIDs     []int64
+	Attachments       []AttachmentSummary
+}
+
+// AttachmentSummary is the per-attachment metadata clients need to lay out a
+// message before downloading anything. Width, Height and Placeholder stay zero
+// until the media pipeline has processed the attachment.
+type AttachmentSummary struct {
+	ID          int64
+	MimeType    string
+	SizeBytes   int64
+	Encrypted   bool
+	Width       int
+	Height      int
+	Placeholder string
 }
 
 // Transport is the adapter seam for centralized relay today and P2P transports later.
@@ -14,6 +14,7 @@ type PersistDirectMessageRequest struct {
 	EnvelopeVersion   string
 	SenderDeviceID    int64
 	RecipientDeviceID int64
+	AttachmentIDs     []int64
 }
 
 type MessageRepository interface {
@@ -65,8 +66,9 @@ type PersistenceService interface {
 }
 
 type persistenceService struct {
-	repo MessageRepository
-	now  func() time.Time
+	repo      MessageRepository
+	retention ThreadRetentionReader
+	now       func() time.Time
 }
 
 func NewPersistenceService(repo MessageRepository) PersistenceService {
@@ -76,7 +78,31 @@ func NewPersistenceService(repo MessageRepository) PersistenceService {
 	}
 }
 
+// NewPersistenceServiceWithRetention stamps each stored message with the
+// expiry of its thread's disappearing-message timer.
+func NewPersistenceServiceWithRetention(repo MessageRepository, retention ThreadRetentionReader) PersistenceService {
+	return &persistenceService{
+		repo:      repo,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
 func (s *persistenceService) StoreDirectMessage(ctx context.Context, req PersistDirectMessageRequest) (StoredMessage, error) {
+	if req.ContentKind == ContentKindSystem || req.ContentKind == ContentKindDeleted {
+		return StoredMessage{}, ErrReservedKind
+	}
+	if err := validateAttachmentIDs(req.ContentKind, req.AttachmentIDs); err != nil {
+		return StoredMessage{}, err
+	}
+	var expiresAt *time.Time
+	if s.retention != nil {
+		setting, err := s.retention.GetThreadRetention(ctx, req.FromUserID, req.ToUserID)
+		if err != nil {
+			return StoredMessage{}, err
+		}
+		expiresAt = setting.expiresAt(s.now())
+	}
 	return s.repo.SaveDirectMessage(ctx, StoredMessage{
 		FromUserID:        req.FromUserID,
 		ToUserID:          req.ToUserID,
@@ -86,9 +112,31 @@ func (s *persistenceService) StoreDirectMessage(ctx context.Context, req Persist
 		EnvelopeVersion:   req.EnvelopeVersion,
 		SenderDeviceID:    req.SenderDeviceID,
 		RecipientDeviceID: req.RecipientDeviceID,
+		AttachmentIDs:     req.AttachmentIDs,
+		ExpiresAt:         expiresAt,
 	})
 }
 
+func validateAttachmentIDs(contentKind string, ids []int64) error {
+	if contentKind != ContentKindAttachment {
+		if len(ids) > 0 {
+			return ErrInvalidAttachment
+		}
+		return nil
+	}
+	if len(ids) == 0 || len(ids) > MaxAttachmentsPerMessage {
+		return ErrInvalidAttachment
+	}
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if id <= 0 || seen[id] {
+			return ErrInvalidAttachment
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
 func (s *persistenceService) MarkDelivered(ctx context.Context, messageID int64) error {
 	return s.repo.MarkDelivered(ctx, messageID, s.now().UTC())
 }
@@ -382,3 +382,32 @@ func TestPersistenceService_ListUnreadInbox_UsesDefaultLimitAndDelegates(t *test
 		t.Fatalf("default limit = %d, want 100", repo.lastListLimit)
 	}
 }
+
+func TestPersistenceService_StoreDirectMessage_ValidatesAttachmentIDs(t *testing.T) {
+	repo := &fakePersistenceRepo{}
+	svc := NewPersistenceService(repo)
+
+	cases := []PersistDirectMessageRequest{
+		{FromUserID: 1, ToUserID: 2, Body: "hi", AttachmentIDs: []int64{5}},
+		{FromUserID: 1, ToUserID: 2, ContentKind: ContentKindAttachment},
+		{FromUserID: 1, ToUserID: 2, ContentKind: ContentKindAttachment, AttachmentIDs: []int64{5, 5}},
+		{FromUserID: 1, ToUserID: 2, ContentKind: ContentKindAttachment, AttachmentIDs: make([]int64, MaxAttachmentsPerMessage+1)},
+	}
+	for i, req := range cases {
+		if _, err := svc.StoreDirectMessage(context.Background(), req); !errors.Is(err, ErrInvalidAttachment) {
+			t.Fatalf("case %d err = %v, want ErrInvalidAttachment", i, err)
+		}
+	}
+
+	if _, err := svc.StoreDirectMessage(context.Background(), PersistDirectMessageRequest{
+		FromUserID:    1,
+		ToUserID:      2,
+		ContentKind:   ContentKindAttachment,
+		AttachmentIDs: []int64{5, 6},
+	}); err != nil {
+		t.Fatalf("valid attachment message err = %v", err)
+	}
+	if len(repo.lastSave.AttachmentIDs) != 2 {
+		t.Fatalf("saved attachment ids = %v, want forwarded", repo.lastSave.AttachmentIDs)
+	}
+}
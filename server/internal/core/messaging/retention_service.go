@@ -0,0 +1,269 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRetentionTTL = errors.New("invalid disappearing message timer")
+	ErrThreadPeerNotFound  = errors.New("thread peer not found")
+)
+
+const (
+	MinRetentionTTL = 30 * time.Second
+	MaxRetentionTTL = 365 * 24 * time.Hour
+
+	// PurgeLogRetention is how long sync reports a purged message ID. A
+	// client away for longer should drop its local history and resync.
+	PurgeLogRetention = 30 * 24 * time.Hour
+
+	// RetentionTimerEvent is the event a timer-change system message carries.
+	RetentionTimerEvent = "disappearing_timer_changed"
+
+	defaultReapInterval = 30 * time.Second
+	defaultReapBatch    = 500
+)
+
+// ThreadRetention is the disappearing-message timer of the thread between
+// two users. A zero TTL means messages are kept.
+type ThreadRetention struct {
+	UserID          int
+	PeerUserID      int
+	TTL             time.Duration
+	UpdatedByUserID int
+	UpdatedAt       time.Time
+}
+
+func (r ThreadRetention) expiresAt(now time.Time) *time.Time {
+	if r.TTL <= 0 {
+		return nil
+	}
+	t := now.UTC().Add(r.TTL)
+	return &t
+}
+
+// PurgedMessage is a tombstone for a message the reaper deleted, recorded
+// for each participant. ID is the participant's purge-log cursor.
+type PurgedMessage struct {
+	ID        int64
+	MessageID int64
+	PurgedAt  time.Time
+}
+
+// PurgeLogPage is one page of a user's purge log for sync.
+type PurgeLogPage struct {
+	AfterID     int64
+	NextAfterID int64
+	Purged      []PurgedMessage
+	HasMore     bool
+}
+
+// RetentionPolicy is the server-wide retention policy. A zero
+// DeliveredCiphertextTTL keeps delivered ciphertext until its thread timer,
+// if any, expires it.
+type RetentionPolicy struct {
+	DeliveredCiphertextTTL time.Duration
+}
+
+// Purge is what one reaper batch deleted. BlobIDs are the files of
+// attachments that only the purged messages carried and that no remaining
+// attachment shares; the reaper removes them after the batch commits.
+type Purge struct {
+	Messages int
+	BlobIDs  []string
+}
+
+// BlobRemover deletes attachment files. It is satisfied by the attachment
+// blob store.
+type BlobRemover interface {
+	Delete(ctx context.Context, blobID string) error
+}
+
+type ThreadRetentionReader interface {
+	GetThreadRetention(ctx context.Context, userID, peerUserID int) (ThreadRetention, error)
+}
+
+type RetentionRepository interface {
+	ThreadRetentionReader
+	// SetThreadRetention returns ErrThreadPeerNotFound for an unknown peer.
+	SetThreadRetention(ctx context.Context, userID, peerUserID int, ttl time.Duration, at time.Time) (ThreadRetention, error)
+	// PurgeExpiredMessages deletes up to limit messages that expired by now,
+	// plus delivered encrypted messages delivered before deliveredBefore
+	// when it is non-zero, with their deliveries, correlations and
+	// attachment links, and records a tombstone for each participant.
+	// Attachments no other message references are deleted with them.
+	PurgeExpiredMessages(ctx context.Context, now, deliveredBefore time.Time, limit int) (Purge, error)
+	ListPurgedMessagesAfter(ctx context.Context, userID int, afterID int64, limit int) ([]PurgedMessage, error)
+	DeletePurgeRecordsBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+type RetentionService interface {
+	GetThreadRetention(ctx context.Context, userID, peerUserID int) (ThreadRetention, error)
+	// SetThreadRetention changes the timer and announces it in the thread
+	// with a system message, which it returns. Setting the current value is
+	// a no-op and returns a zero message.
+	SetThreadRetention(ctx context.Context, userID, peerUserID int, ttl time.Duration) (ThreadRetention, StoredMessage, error)
+	ListPurgedAfter(ctx context.Context, userID int, afterID int64, limit int) (PurgeLogPage, error)
+}
+
+type retentionService struct {
+	repo     RetentionRepository
+	messages MessageRepository
+	now      func() time.Time
+}
+
+func NewRetentionService(repo RetentionRepository, messages MessageRepository) RetentionService {
+	return &retentionService{repo: repo, messages: messages, now: time.Now}
+}
+
+func (s *retentionService) GetThreadRetention(ctx context.Context, userID, peerUserID int) (ThreadRetention, error) {
+	if peerUserID <= 0 || peerUserID == userID {
+		return ThreadRetention{}, ErrThreadPeerNotFound
+	}
+	return s.repo.GetThreadRetention(ctx, userID, peerUserID)
+}
+
+func (s *retentionService) SetThreadRetention(ctx context.Context, userID, peerUserID int, ttl time.Duration) (ThreadRetention, StoredMessage, error) {
+	if ttl != 0 && (ttl < MinRetentionTTL || ttl > MaxRetentionTTL || ttl%time.Second != 0) {
+		return ThreadRetention{}, StoredMessage{}, ErrInvalidRetentionTTL
+	}
+	current, err := s.GetThreadRetention(ctx, userID, peerUserID)
+	if err != nil {
+		return ThreadRetention{}, StoredMessage{}, err
+	}
+	if current.TTL == ttl {
+		return current, StoredMessage{}, nil
+	}
+
+	now := s.now().UTC()
+	setting, err := s.repo.SetThreadRetention(ctx, userID, peerUserID, ttl, now)
+	if err != nil {
+		return ThreadRetention{}, StoredMessage{}, err
+	}
+	body, err := json.Marshal(map[string]any{
+		"event":          RetentionTimerEvent,
+		"ttl_seconds":    int64(ttl / time.Second),
+		"set_by_user_id": userID,
+		"peer_user_id":   peerUserID,
+	})
+	if err != nil {
+		return ThreadRetention{}, StoredMessage{}, err
+	}
+	announcement, err := s.messages.SaveDirectMessage(ctx, StoredMessage{
+		FromUserID:  userID,
+		ToUserID:    peerUserID,
+		Body:        string(body),
+		ContentKind: ContentKindSystem,
+		ExpiresAt:   setting.expiresAt(now),
+	})
+	if err != nil {
+		return ThreadRetention{}, StoredMessage{}, err
+	}
+	return setting, announcement, nil
+}
+
+func (s *retentionService) ListPurgedAfter(ctx context.Context, userID int, afterID int64, limit int) (PurgeLogPage, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	purged, err := s.repo.ListPurgedMessagesAfter(ctx, userID, afterID, limit+1)
+	if err != nil {
+		return PurgeLogPage{}, err
+	}
+	page := PurgeLogPage{AfterID: afterID, NextAfterID: afterID, Purged: purged}
+	if len(purged) > limit {
+		page.Purged = purged[:limit]
+		page.HasMore = true
+	}
+	if len(page.Purged) > 0 {
+		page.NextAfterID = page.Purged[len(page.Purged)-1].ID
+	}
+	return page, nil
+}
+
+// Reaper deletes messages whose thread timer has expired and, under the
+// server-wide policy, delivered ciphertext older than the policy allows. It
+// also forgets purge-log entries older than PurgeLogRetention.
+type Reaper struct {
+	repo     RetentionRepository
+	policy   RetentionPolicy
+	blobs    BlobRemover
+	now      func() time.Time
+	interval time.Duration
+	batch    int
+}
+
+func NewReaper(repo RetentionRepository, policy RetentionPolicy) *Reaper {
+	return &Reaper{
+		repo:     repo,
+		policy:   policy,
+		now:      time.Now,
+		interval: defaultReapInterval,
+		batch:    defaultReapBatch,
+	}
+}
+
+// NewReaperWithBlobs also removes the files of the attachments it deletes.
+func NewReaperWithBlobs(repo RetentionRepository, policy RetentionPolicy, blobs BlobRemover) *Reaper {
+	r := NewReaper(repo, policy)
+	r.blobs = blobs
+	return r
+}
+
+// Start runs the reaper until ctx is cancelled.
+func (r *Reaper) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			_, _ = r.Reap(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Reap purges batches until none is left, then forgets old purge-log
+// entries. It returns how many messages it deleted.
+func (r *Reaper) Reap(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := r.RunOnce(ctx)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < r.batch {
+			break
+		}
+	}
+	_, err := r.repo.DeletePurgeRecordsBefore(ctx, r.now().UTC().Add(-PurgeLogRetention))
+	return total, err
+}
+
+// RunOnce purges one batch and returns how many messages it deleted. A file
+// that cannot be removed is left behind without a row and does not fail the
+// batch, which has already committed.
+func (r *Reaper) RunOnce(ctx context.Context) (int, error) {
+	now := r.now().UTC()
+	var deliveredBefore time.Time
+	if r.policy.DeliveredCiphertextTTL > 0 {
+		deliveredBefore = now.Add(-r.policy.DeliveredCiphertextTTL)
+	}
+	purge, err := r.repo.PurgeExpiredMessages(ctx, now, deliveredBefore, r.batch)
+	if err != nil {
+		return purge.Messages, err
+	}
+	if r.blobs != nil {
+		for _, blobID := range purge.BlobIDs {
+			_ = r.blobs.Delete(ctx, blobID)
+		}
+	}
+	return purge.Messages, nil
+}
@@ -0,0 +1,215 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeRetentionRepo struct {
+	settings        map[[2]int]ThreadRetention
+	setErr          error
+	purgeCalls      int
+	lastNow         time.Time
+	lastDelivered   time.Time
+	purged          []PurgedMessage
+	lastPurgeAfter  int64
+	lastPurgeLimit  int
+	lastPruneBefore time.Time
+	purge           Purge
+}
+
+func retentionKey(userID, peerUserID int) [2]int {
+	if userID > peerUserID {
+		userID, peerUserID = peerUserID, userID
+	}
+	return [2]int{userID, peerUserID}
+}
+
+func (f *fakeRetentionRepo) GetThreadRetention(ctx context.Context, userID, peerUserID int) (ThreadRetention, error) {
+	setting := f.settings[retentionKey(userID, peerUserID)]
+	setting.UserID, setting.PeerUserID = userID, peerUserID
+	return setting, nil
+}
+
+func (f *fakeRetentionRepo) SetThreadRetention(ctx context.Context, userID, peerUserID int, ttl time.Duration, at time.Time) (ThreadRetention, error) {
+	if f.setErr != nil {
+		return ThreadRetention{}, f.setErr
+	}
+	if f.settings == nil {
+		f.settings = map[[2]int]ThreadRetention{}
+	}
+	setting := ThreadRetention{UserID: userID, PeerUserID: peerUserID, TTL: ttl, UpdatedByUserID: userID, UpdatedAt: at}
+	f.settings[retentionKey(userID, peerUserID)] = setting
+	return setting, nil
+}
+
+func (f *fakeRetentionRepo) PurgeExpiredMessages(ctx context.Context, now, deliveredBefore time.Time, limit int) (Purge, error) {
+	f.purgeCalls++
+	f.lastNow, f.lastDelivered = now, deliveredBefore
+	return f.purge, nil
+}
+
+func (f *fakeRetentionRepo) ListPurgedMessagesAfter(ctx context.Context, userID int, afterID int64, limit int) ([]PurgedMessage, error) {
+	f.lastPurgeAfter, f.lastPurgeLimit = afterID, limit
+	var out []PurgedMessage
+	for _, p := range f.purged {
+		if p.ID > afterID && len(out) < limit {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRetentionRepo) DeletePurgeRecordsBefore(ctx context.Context, before time.Time) (int, error) {
+	f.lastPruneBefore = before
+	return 0, nil
+}
+
+func TestRetentionService_SetThreadRetention_AnnouncesChange(t *testing.T) {
+	repo := &fakeRetentionRepo{}
+	messages := &fakePersistenceRepo{}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewRetentionService(repo, messages).(*retentionService)
+	svc.now = func() time.Time { return now }
+
+	setting, announcement, err := svc.SetThreadRetention(context.Background(), 7, 9, time.Hour)
+	if err != nil {
+		t.Fatalf("SetThreadRetention: %v", err)
+	}
+	if setting.TTL != time.Hour || setting.UpdatedByUserID != 7 {
+		t.Fatalf("unexpected setting %+v", setting)
+	}
+	if announcement.ID == 0 || announcement.ContentKind != ContentKindSystem || announcement.FromUserID != 7 || announcement.ToUserID != 9 {
+		t.Fatalf("unexpected announcement %+v", announcement)
+	}
+	if announcement.ExpiresAt == nil || !announcement.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("announcement should expire with the new timer, got %v", announcement.ExpiresAt)
+	}
+	var body map[string]any
+	if err := json.Unmarshal([]byte(announcement.Body), &body); err != nil {
+		t.Fatalf("announcement body: %v", err)
+	}
+	if body["event"] != RetentionTimerEvent || body["ttl_seconds"] != float64(3600) {
+		t.Fatalf("unexpected announcement body %v", body)
+	}
+
+	messages.saveResp = StoredMessage{}
+	messages.lastSave = StoredMessage{}
+	if _, announcement, err := svc.SetThreadRetention(context.Background(), 9, 7, time.Hour); err != nil || announcement.ID != 0 || messages.lastSave.ContentKind != "" {
+		t.Fatalf("setting the current value should not announce; got %+v, %v", announcement, err)
+	}
+
+	if _, announcement, err := svc.SetThreadRetention(context.Background(), 9, 7, 0); err != nil || announcement.ExpiresAt != nil {
+		t.Fatalf("turning the timer off should announce without expiry; got %+v, %v", announcement, err)
+	}
+}
+
+func TestRetentionService_SetThreadRetention_Validates(t *testing.T) {
+	svc := NewRetentionService(&fakeRetentionRepo{}, &fakePersistenceRepo{})
+	for _, ttl := range []time.Duration{time.Second, MaxRetentionTTL + time.Second, time.Minute + time.Millisecond, -time.Minute} {
+		if _, _, err := svc.SetThreadRetention(context.Background(), 1, 2, ttl); !errors.Is(err, ErrInvalidRetentionTTL) {
+			t.Fatalf("ttl %v: expected ErrInvalidRetentionTTL, got %v", ttl, err)
+		}
+	}
+	if _, _, err := svc.SetThreadRetention(context.Background(), 1, 1, time.Hour); !errors.Is(err, ErrThreadPeerNotFound) {
+		t.Fatalf("expected ErrThreadPeerNotFound for self, got %v", err)
+	}
+	svc = NewRetentionService(&fakeRetentionRepo{setErr: ErrThreadPeerNotFound}, &fakePersistenceRepo{})
+	if _, _, err := svc.SetThreadRetention(context.Background(), 1, 99, time.Hour); !errors.Is(err, ErrThreadPeerNotFound) {
+		t.Fatalf("expected ErrThreadPeerNotFound, got %v", err)
+	}
+}
+
+func TestRetentionService_ListPurgedAfter_Pages(t *testing.T) {
+	repo := &fakeRetentionRepo{purged: []PurgedMessage{{ID: 4, MessageID: 40}, {ID: 5, MessageID: 50}, {ID: 6, MessageID: 60}}}
+	svc := NewRetentionService(repo, &fakePersistenceRepo{})
+
+	page, err := svc.ListPurgedAfter(context.Background(), 1, 3, 2)
+	if err != nil {
+		t.Fatalf("ListPurgedAfter: %v", err)
+	}
+	if !page.HasMore || len(page.Purged) != 2 || page.NextAfterID != 5 || repo.lastPurgeLimit != 3 {
+		t.Fatalf("unexpected page %+v (limit %d)", page, repo.lastPurgeLimit)
+	}
+	page, err = svc.ListPurgedAfter(context.Background(), 1, 6, 2)
+	if err != nil || page.HasMore || len(page.Purged) != 0 || page.NextAfterID != 6 {
+		t.Fatalf("unexpected empty page %+v, %v", page, err)
+	}
+}
+
+func TestPersistenceService_StoreDirectMessage_AppliesThreadTimer(t *testing.T) {
+	repo := &fakePersistenceRepo{}
+	retention := &fakeRetentionRepo{settings: map[[2]int]ThreadRetention{{1, 2}: {TTL: 10 * time.Minute}}}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewPersistenceServiceWithRetention(repo, retention).(*persistenceService)
+	svc.now = func() time.Time { return now }
+
+	if _, err := svc.StoreDirectMessage(context.Background(), PersistDirectMessageRequest{FromUserID: 2, ToUserID: 1, Body: "hi"}); err != nil {
+		t.Fatalf("StoreDirectMessage: %v", err)
+	}
+	if repo.lastSave.ExpiresAt == nil || !repo.lastSave.ExpiresAt.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("expected expiry from thread timer, got %v", repo.lastSave.ExpiresAt)
+	}
+
+	repo.saveResp = StoredMessage{}
+	if _, err := svc.StoreDirectMessage(context.Background(), PersistDirectMessageRequest{FromUserID: 2, ToUserID: 3, Body: "hi"}); err != nil {
+		t.Fatalf("StoreDirectMessage: %v", err)
+	}
+	if repo.lastSave.ExpiresAt != nil {
+		t.Fatalf("thread without a timer should not expire, got %v", repo.lastSave.ExpiresAt)
+	}
+
+	for _, kind := range []string{ContentKindSystem, ContentKindDeleted} {
+		if _, err := svc.StoreDirectMessage(context.Background(), PersistDirectMessageRequest{FromUserID: 2, ToUserID: 1, ContentKind: kind}); !errors.Is(err, ErrReservedKind) {
+			t.Fatalf("%s: expected ErrReservedKind, got %v", kind, err)
+		}
+	}
+}
+
+func TestReaper_RunOnce_AppliesPolicy(t *testing.T) {
+	repo := &fakeRetentionRepo{}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	reaper := NewReaper(repo, RetentionPolicy{})
+	reaper.now = func() time.Time { return now }
+	if _, err := reaper.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if !repo.lastNow.Equal(now) || !repo.lastDelivered.IsZero() {
+		t.Fatalf("without a policy only timers apply; got now=%v delivered=%v", repo.lastNow, repo.lastDelivered)
+	}
+
+	reaper = NewReaper(repo, RetentionPolicy{DeliveredCiphertextTTL: 7 * 24 * time.Hour})
+	reaper.now = func() time.Time { return now }
+	if _, err := reaper.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if !repo.lastDelivered.Equal(now.Add(-7 * 24 * time.Hour)) {
+		t.Fatalf("unexpected delivered cutoff %v", repo.lastDelivered)
+	}
+}
+
+type fakeBlobRemover struct {
+	deleted []string
+}
+
+func (f *fakeBlobRemover) Delete(ctx context.Context, blobID string) error {
+	f.deleted = append(f.deleted, blobID)
+	return nil
+}
+
+func TestReaper_RunOnce_RemovesFilesOfDeletedAttachments(t *testing.T) {
+	repo := &fakeRetentionRepo{purge: Purge{Messages: 2, BlobIDs: []string{"a", "b"}}}
+	blobs := &fakeBlobRemover{}
+
+	n, err := NewReaperWithBlobs(repo, RetentionPolicy{}, blobs).RunOnce(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("RunOnce = %d, %v", n, err)
+	}
+	if len(blobs.deleted) != 2 || blobs.deleted[0] != "a" || blobs.deleted[1] != "b" {
+		t.Fatalf("deleted blobs = %v", blobs.deleted)
+	}
+}
@@ -0,0 +1,105 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 100
+	MaxSearchTextRunes = 256
+)
+
+// Snippet highlight markers. Adapters wrap matched terms in these control
+// characters so transports can render highlights without trusting message
+// bodies as markup.
+const (
+	SnippetMatchStart = "\x02"
+	SnippetMatchEnd   = "\x03"
+)
+
+// SearchSort orders search results. Relevance ranks by bm25 and returns a
+// single page, so it cannot be combined with BeforeID.
+type SearchSort string
+
+const (
+	SearchSortRecent    SearchSort = "recent"
+	SearchSortRelevance SearchSort = "relevance"
+)
+
+// SearchQuery searches the caller's plaintext history. Zero values leave a
+// filter unset; Until is exclusive.
+type SearchQuery struct {
+	UserID      int
+	Text        string
+	WithUserID  int
+	Since       time.Time
+	Until       time.Time
+	ContentKind string
+	BeforeID    int64
+	Limit       int
+	Sort        SearchSort
+}
+
+// SearchResult is a matching message plus a short excerpt around the match
+// and the whole body, both with matches between the snippet markers.
+type SearchResult struct {
+	Message   StoredMessage
+	Snippet   string
+	Highlight string
+}
+
+// SearchRepository must only return messages the query's user sent or
+// received, and must never index ciphertext-only rows.
+type SearchRepository interface {
+	SearchMessages(ctx context.Context, q SearchQuery) ([]SearchResult, error)
+}
+
+type SearchService interface {
+	SearchMessages(ctx context.Context, q SearchQuery) ([]SearchResult, error)
+}
+
+type searchService struct {
+	repo SearchRepository
+}
+
+func NewSearchService(repo SearchRepository) SearchService {
+	return &searchService{repo: repo}
+}
+
+func (s *searchService) SearchMessages(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	q.Text = strings.TrimSpace(q.Text)
+	if q.UserID <= 0 || q.Text == "" || utf8.RuneCountInString(q.Text) > MaxSearchTextRunes {
+		return nil, ErrInvalidSearchQuery
+	}
+	if q.WithUserID < 0 || q.BeforeID < 0 {
+		return nil, ErrInvalidSearchQuery
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = SearchSortRecent
+	case SearchSortRecent:
+	case SearchSortRelevance:
+		if q.BeforeID > 0 {
+			return nil, ErrInvalidSearchQuery
+		}
+	default:
+		return nil, ErrInvalidSearchQuery
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return nil, ErrInvalidSearchQuery
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultSearchLimit
+	}
+	if q.Limit > MaxSearchLimit {
+		q.Limit = MaxSearchLimit
+	}
+	return s.repo.SearchMessages(ctx, q)
+}
@@ -0,0 +1,62 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeSearchRepo struct {
+	last  SearchQuery
+	calls int
+}
+
+func (f *fakeSearchRepo) SearchMessages(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	_ = ctx
+	f.last = q
+	f.calls++
+	return []SearchResult{{Message: StoredMessage{ID: 1}, Snippet: "hi"}}, nil
+}
+
+func TestSearchService_NormalizesQueryAndClampsLimit(t *testing.T) {
+	repo := &fakeSearchRepo{}
+	svc := NewSearchService(repo)
+
+	if _, err := svc.SearchMessages(context.Background(), SearchQuery{UserID: 3, Text: "  invoice  "}); err != nil {
+		t.Fatalf("SearchMessages error: %v", err)
+	}
+	if repo.last.Text != "invoice" || repo.last.Limit != DefaultSearchLimit || repo.last.Sort != SearchSortRecent {
+		t.Fatalf("repo query = %+v, want trimmed text, default limit and newest first", repo.last)
+	}
+
+	if _, err := svc.SearchMessages(context.Background(), SearchQuery{UserID: 3, Text: "invoice", Limit: 1000}); err != nil {
+		t.Fatalf("SearchMessages error: %v", err)
+	}
+	if repo.last.Limit != MaxSearchLimit {
+		t.Fatalf("limit = %d, want %d", repo.last.Limit, MaxSearchLimit)
+	}
+}
+
+func TestSearchService_RejectsInvalidQueries(t *testing.T) {
+	repo := &fakeSearchRepo{}
+	svc := NewSearchService(repo)
+	now := time.Now()
+
+	for name, q := range map[string]SearchQuery{
+		"empty":         {UserID: 1, Text: "   "},
+		"no user":       {Text: "hello"},
+		"too long":      {UserID: 1, Text: strings.Repeat("a", MaxSearchTextRunes+1)},
+		"inverted date": {UserID: 1, Text: "hello", Since: now, Until: now.Add(-time.Hour)},
+		"unknown sort":  {UserID: 1, Text: "hello", Sort: "oldest"},
+		"ranked paging": {UserID: 1, Text: "hello", Sort: SearchSortRelevance, BeforeID: 10},
+	} {
+		if _, err := svc.SearchMessages(context.Background(), q); !errors.Is(err, ErrInvalidSearchQuery) {
+			t.Fatalf("%s: err = %v, want ErrInvalidSearchQuery", name, err)
+		}
+	}
+	if repo.calls != 0 {
+		t.Fatalf("repo called %d times for invalid queries", repo.calls)
+	}
+}
@@ -12,6 +12,7 @@ type DirectSendRequest struct {
 	EnvelopeVersion   string
 	SenderDeviceID    int64
 	RecipientDeviceID int64
+	AttachmentIDs     []int64
 	MessageID         int64
 }
 
@@ -40,6 +41,7 @@ func (s *RelayService) SendDirect(ctx context.Context, req DirectSendRequest) (D
 		EnvelopeVersion:   req.EnvelopeVersion,
 		SenderDeviceID:    req.SenderDeviceID,
 		RecipientDeviceID: req.RecipientDeviceID,
+		AttachmentIDs:     req.AttachmentIDs,
 	})
 	if !ok {
 		return DeliveryReceipt{MessageID: req.MessageID, Delivered: false, Reason: "recipient_offline"}, nil
@@ -84,6 +86,7 @@ func (s *DurableRelayService) SendDirect(ctx context.Context, req DirectSendRequ
 			EnvelopeVersion:   req.EnvelopeVersion,
 			SenderDeviceID:    req.SenderDeviceID,
 			RecipientDeviceID: req.RecipientDeviceID,
+			AttachmentIDs:     req.AttachmentIDs,
 		})
 		if err != nil {
 			return DeliveryReceipt{}, err
@@ -101,6 +104,7 @@ func (s *DurableRelayService) SendDirect(ctx context.Context, req DirectSendRequ
 		EnvelopeVersion:   req.EnvelopeVersion,
 		SenderDeviceID:    req.SenderDeviceID,
 		RecipientDeviceID: req.RecipientDeviceID,
+		AttachmentIDs:     req.AttachmentIDs,
 	})
 	if s.correlation != nil && req.MessageID != 0 && storedID != 0 {
 		if err := s.correlation.RecordClientMessageCorrelation(ctx, ClientMessageCorrelation{
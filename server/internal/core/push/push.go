@@ -0,0 +1,162 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	MaxSubscriptionsPerUser = 20
+	DefaultMaxAttempts      = 5
+	// NotificationTTL is how long the push service may hold a notification
+	// for an unreachable browser; queued jobs older than this are dropped.
+	NotificationTTL = 24 * time.Hour
+	// MaxPreviewRunes bounds the plaintext preview carried in a payload.
+	MaxPreviewRunes = 120
+)
+
+var (
+	ErrInvalidSubscription  = errors.New("invalid push subscription")
+	ErrSubscriptionLimit    = errors.New("push subscription limit reached")
+	ErrSubscriptionNotFound = errors.New("push subscription not found")
+	ErrSessionRequired      = errors.New("push subscriptions require a signed-in session")
+	ErrInvalidSettings      = errors.New("invalid push settings")
+	ErrInvalidMute          = errors.New("invalid mute")
+	ErrMuteNotFound         = errors.New("mute not found")
+)
+
+// Subscription is one browser's PushSubscription, bound to the session that
+// registered it. It stops receiving pushes when that session ends.
+type Subscription struct {
+	ID        int64
+	UserID    int
+	SessionID int64
+	Endpoint  string
+	// P256DH and Auth are the subscription's base64url keys from
+	// PushSubscription.getKey.
+	P256DH    string
+	Auth      string
+	CreatedAt time.Time
+}
+
+// QuietHours is a daily window, in minutes after local midnight, during which
+// pushes are suppressed. The window may wrap past midnight.
+type QuietHours struct {
+	StartMinute      int
+	EndMinute        int
+	UTCOffsetMinutes int
+}
+
+func (q QuietHours) Contains(t time.Time) bool {
+	local := t.UTC().Add(time.Duration(q.UTCOffsetMinutes) * time.Minute)
+	minute := local.Hour()*60 + local.Minute()
+	if q.StartMinute < q.EndMinute {
+		return minute >= q.StartMinute && minute < q.EndMinute
+	}
+	return minute >= q.StartMinute || minute < q.EndMinute
+}
+
+type Settings struct {
+	UserID int
+	// DNDUntil suppresses every push until it passes.
+	DNDUntil   *time.Time
+	QuietHours *QuietHours
+}
+
+// Mute silences pushes for one conversation, until Until or indefinitely.
+type Mute struct {
+	UserID     int
+	PeerUserID int
+	Until      *time.Time
+	CreatedAt  time.Time
+}
+
+func (m Mute) Active(now time.Time) bool {
+	return m.Until == nil || now.Before(*m.Until)
+}
+
+// Notification tells a user about a message they could not be sent live.
+type Notification struct {
+	UserID       int
+	FromUserID   int
+	FromUsername string
+	MessageID    int64
+	ContentKind  string
+	// Encrypted notifications carry only a hint; Preview is dropped.
+	Encrypted bool
+	Preview   string
+}
+
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobDead    JobStatus = "dead"
+)
+
+// Job is one notification queued for one subscription.
+type Job struct {
+	ID             int64
+	SubscriptionID int64
+	UserID         int
+	PeerUserID     int
+	Topic          string
+	Payload        []byte
+	Status         JobStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastError      string
+	CreatedAt      time.Time
+}
+
+type Repository interface {
+	// SaveSubscription registers a subscription, replacing any earlier row
+	// for the same endpoint, since browsers reuse endpoints across logins.
+	SaveSubscription(ctx context.Context, sub Subscription, limit int) (Subscription, error)
+	GetSubscription(ctx context.Context, subscriptionID int64) (Subscription, error)
+	ListSubscriptions(ctx context.Context, userID int) ([]Subscription, error)
+	// ListActiveSubscriptions skips subscriptions whose session was revoked
+	// or has expired.
+	ListActiveSubscriptions(ctx context.Context, userID int, now time.Time) ([]Subscription, error)
+	DeleteSubscription(ctx context.Context, userID int, subscriptionID int64) error
+
+	GetSettings(ctx context.Context, userID int) (Settings, error)
+	SaveSettings(ctx context.Context, settings Settings) error
+	GetMute(ctx context.Context, userID, peerUserID int) (Mute, error)
+	ListMutes(ctx context.Context, userID int) ([]Mute, error)
+	SaveMute(ctx context.Context, mute Mute) error
+	DeleteMute(ctx context.Context, userID, peerUserID int) error
+
+	EnqueueJobs(ctx context.Context, jobs []Job) error
+	// ClaimDueJobs returns pending jobs due at now and pushes their
+	// next_attempt_at to leaseUntil.
+	ClaimDueJobs(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Job, error)
+	SaveJobAttempt(ctx context.Context, job Job) error
+	DeleteJob(ctx context.Context, jobID int64) error
+}
+
+type Urgency string
+
+const (
+	UrgencyNormal Urgency = "normal"
+	UrgencyHigh   Urgency = "high"
+)
+
+type PushOptions struct {
+	TTL     time.Duration
+	Urgency Urgency
+	// Topic lets the push service replace an undelivered notification with
+	// a newer one for the same conversation.
+	Topic string
+}
+
+// Pusher encrypts payload for sub and hands it to the subscription's push
+// service. It returns the push service's status code, or an error when no
+// response was received.
+type Pusher interface {
+	Push(ctx context.Context, sub Subscription, payload []byte, opts PushOptions) (int, error)
+	// PublicKey is the base64url VAPID key browsers pass as
+	// applicationServerKey.
+	PublicKey() string
+}
@@ -0,0 +1,443 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxEndpointLength = 2048
+
+	defaultDispatchInterval = 5 * time.Second
+	defaultDispatchBatch    = 32
+	defaultDispatchWorkers  = 4
+	jobLease                = time.Minute
+	retryBase               = 10 * time.Second
+	retryCap                = 15 * time.Minute
+	maxLastErrorLength      = 300
+)
+
+// Policy holds deployment settings shared by the service and the dispatcher.
+type Policy struct {
+	// AllowHTTP accepts http:// subscription endpoints, for a local push
+	// service stub; browsers only issue https endpoints.
+	AllowHTTP   bool
+	MaxAttempts int
+}
+
+func (p Policy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+type SubscribeRequest struct {
+	Endpoint string
+	P256DH   string
+	Auth     string
+}
+
+type Service interface {
+	// PublicKey is the VAPID application server key for the browser.
+	PublicKey() string
+	Subscribe(ctx context.Context, userID int, sessionID int64, req SubscribeRequest) (Subscription, error)
+	ListSubscriptions(ctx context.Context, userID int) ([]Subscription, error)
+	Unsubscribe(ctx context.Context, userID int, subscriptionID int64) error
+	GetSettings(ctx context.Context, userID int) (Settings, error)
+	// UpdateSettings replaces the user's do-not-disturb and quiet hours.
+	UpdateSettings(ctx context.Context, settings Settings) (Settings, error)
+	ListMutes(ctx context.Context, userID int) ([]Mute, error)
+	// Mute silences one conversation for d, or indefinitely when d is zero.
+	Mute(ctx context.Context, userID, peerUserID int, d time.Duration) (Mute, error)
+	Unmute(ctx context.Context, userID, peerUserID int) error
+	// Notify queues a push to each of the user's active subscriptions unless
+	// the conversation is muted or the user is in do-not-disturb.
+	Notify(ctx context.Context, n Notification) error
+}
+
+type service struct {
+	repo       Repository
+	pusher     Pusher
+	dispatcher *Dispatcher
+	policy     Policy
+	now        func() time.Time
+}
+
+func NewService(repo Repository, pusher Pusher, dispatcher *Dispatcher, policy Policy) Service {
+	return &service{
+		repo:       repo,
+		pusher:     pusher,
+		dispatcher: dispatcher,
+		policy:     policy,
+		now:        time.Now,
+	}
+}
+
+func (s *service) PublicKey() string {
+	return s.pusher.PublicKey()
+}
+
+func (s *service) Subscribe(ctx context.Context, userID int, sessionID int64, req SubscribeRequest) (Subscription, error) {
+	if sessionID <= 0 {
+		return Subscription{}, ErrSessionRequired
+	}
+	endpoint, err := s.normalizeEndpoint(req.Endpoint)
+	if err != nil {
+		return Subscription{}, err
+	}
+	p256dh, err := decodeKey(req.P256DH)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("%w: p256dh is not base64url", ErrInvalidSubscription)
+	}
+	if _, err := ecdh.P256().NewPublicKey(p256dh); err != nil {
+		return Subscription{}, fmt.Errorf("%w: p256dh is not a P-256 public key", ErrInvalidSubscription)
+	}
+	auth, err := decodeKey(req.Auth)
+	if err != nil || len(auth) != 16 {
+		return Subscription{}, fmt.Errorf("%w: auth must be 16 bytes", ErrInvalidSubscription)
+	}
+	return s.repo.SaveSubscription(ctx, Subscription{
+		UserID:    userID,
+		SessionID: sessionID,
+		Endpoint:  endpoint,
+		P256DH:    base64.RawURLEncoding.EncodeToString(p256dh),
+		Auth:      base64.RawURLEncoding.EncodeToString(auth),
+		CreatedAt: s.now().UTC(),
+	}, MaxSubscriptionsPerUser)
+}
+
+func (s *service) normalizeEndpoint(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || len(raw) > maxEndpointLength || u.User != nil {
+		return "", fmt.Errorf("%w: endpoint must be an https url", ErrInvalidSubscription)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && s.policy.AllowHTTP) {
+		return "", fmt.Errorf("%w: endpoint must be an https url", ErrInvalidSubscription)
+	}
+	return u.String(), nil
+}
+
+// decodeKey accepts base64url with or without padding, as browsers differ.
+func decodeKey(v string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(v), "="))
+}
+
+func (s *service) ListSubscriptions(ctx context.Context, userID int) ([]Subscription, error) {
+	return s.repo.ListSubscriptions(ctx, userID)
+}
+
+func (s *service) Unsubscribe(ctx context.Context, userID int, subscriptionID int64) error {
+	return s.repo.DeleteSubscription(ctx, userID, subscriptionID)
+}
+
+func (s *service) GetSettings(ctx context.Context, userID int) (Settings, error) {
+	return s.repo.GetSettings(ctx, userID)
+}
+
+func (s *service) UpdateSettings(ctx context.Context, settings Settings) (Settings, error) {
+	if q := settings.QuietHours; q != nil {
+		if q.StartMinute < 0 || q.StartMinute >= 24*60 || q.EndMinute < 0 || q.EndMinute >= 24*60 || q.StartMinute == q.EndMinute {
+			return Settings{}, fmt.Errorf("%w: quiet hours must be two different times of day", ErrInvalidSettings)
+		}
+		if q.UTCOffsetMinutes < -14*60 || q.UTCOffsetMinutes > 14*60 {
+			return Settings{}, fmt.Errorf("%w: utc offset out of range", ErrInvalidSettings)
+		}
+	}
+	if settings.DNDUntil != nil {
+		until := settings.DNDUntil.UTC()
+		if !until.After(s.now()) {
+			settings.DNDUntil = nil
+		} else {
+			settings.DNDUntil = &until
+		}
+	}
+	if err := s.repo.SaveSettings(ctx, settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+func (s *service) ListMutes(ctx context.Context, userID int) ([]Mute, error) {
+	mutes, err := s.repo.ListMutes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	active := make([]Mute, 0, len(mutes))
+	for _, m := range mutes {
+		if m.Active(now) {
+			active = append(active, m)
+		}
+	}
+	return active, nil
+}
+
+func (s *service) Mute(ctx context.Context, userID, peerUserID int, d time.Duration) (Mute, error) {
+	if peerUserID <= 0 || peerUserID == userID || d < 0 {
+		return Mute{}, ErrInvalidMute
+	}
+	now := s.now().UTC()
+	mute := Mute{UserID: userID, PeerUserID: peerUserID, CreatedAt: now}
+	if d > 0 {
+		until := now.Add(d)
+		mute.Until = &until
+	}
+	if err := s.repo.SaveMute(ctx, mute); err != nil {
+		return Mute{}, err
+	}
+	return mute, nil
+}
+
+func (s *service) Unmute(ctx context.Context, userID, peerUserID int) error {
+	return s.repo.DeleteMute(ctx, userID, peerUserID)
+}
+
+func (s *service) Notify(ctx context.Context, n Notification) error {
+	now := s.now()
+	if quiet, err := suppressed(ctx, s.repo, n.UserID, n.FromUserID, now); err != nil || quiet {
+		return err
+	}
+	subs, err := s.repo.ListActiveSubscriptions(ctx, n.UserID, now.UTC())
+	if err != nil || len(subs) == 0 {
+		return err
+	}
+	payload, err := notificationPayload(n)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]Job, 0, len(subs))
+	for _, sub := range subs {
+		jobs = append(jobs, Job{
+			SubscriptionID: sub.ID,
+			UserID:         n.UserID,
+			PeerUserID:     n.FromUserID,
+			Topic:          "dm-" + strconv.Itoa(n.FromUserID),
+			Payload:        payload,
+			Status:         JobPending,
+			NextAttemptAt:  now.UTC(),
+			CreatedAt:      now.UTC(),
+		})
+	}
+	if err := s.repo.EnqueueJobs(ctx, jobs); err != nil {
+		return err
+	}
+	s.dispatcher.Wake()
+	return nil
+}
+
+// notificationPayload is the JSON the service worker receives. Encrypted
+// messages only say that something arrived and from whom; the client fetches
+// and decrypts the message itself.
+func notificationPayload(n Notification) ([]byte, error) {
+	body := map[string]any{
+		"type":         "message",
+		"message_id":   n.MessageID,
+		"from_user_id": n.FromUserID,
+		"from":         n.FromUsername,
+		"content_kind": n.ContentKind,
+		"encrypted":    n.Encrypted,
+	}
+	if !n.Encrypted && n.Preview != "" {
+		body["preview"] = truncateRunes(n.Preview, MaxPreviewRunes)
+	}
+	return json.Marshal(body)
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+// suppressed reports whether pushes from peerUserID to userID are silenced
+// by a mute, do-not-disturb, or quiet hours.
+func suppressed(ctx context.Context, repo Repository, userID, peerUserID int, now time.Time) (bool, error) {
+	settings, err := repo.GetSettings(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if settings.DNDUntil != nil && now.Before(*settings.DNDUntil) {
+		return true, nil
+	}
+	if settings.QuietHours != nil && settings.QuietHours.Contains(now) {
+		return true, nil
+	}
+	mute, err := repo.GetMute(ctx, userID, peerUserID)
+	if errors.Is(err, ErrMuteNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return mute.Active(now), nil
+}
+
+// Dispatcher sends queued push jobs. Settings are checked again at send time,
+// so muting a conversation also silences pushes already queued for it.
+type Dispatcher struct {
+	repo     Repository
+	pusher   Pusher
+	policy   Policy
+	now      func() time.Time
+	wake     chan struct{}
+	interval time.Duration
+	batch    int
+	workers  int
+}
+
+func NewDispatcher(repo Repository, pusher Pusher, policy Policy) *Dispatcher {
+	return &Dispatcher{
+		repo:     repo,
+		pusher:   pusher,
+		policy:   policy,
+		now:      time.Now,
+		wake:     make(chan struct{}, 1),
+		interval: defaultDispatchInterval,
+		batch:    defaultDispatchBatch,
+		workers:  defaultDispatchWorkers,
+	}
+}
+
+// Wake asks a running dispatcher to check the queue now. It is safe on a nil
+// Dispatcher.
+func (d *Dispatcher) Wake() {
+	if d == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the dispatch loop until ctx is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			for {
+				n, err := d.SendDue(ctx)
+				if err != nil || n < d.batch {
+					break
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// SendDue claims one batch of due jobs and sends them. It returns how many
+// were claimed.
+func (d *Dispatcher) SendDue(ctx context.Context) (int, error) {
+	now := d.now().UTC()
+	jobs, err := d.repo.ClaimDueJobs(ctx, now, now.Add(jobLease), d.batch)
+	if err != nil {
+		return 0, err
+	}
+
+	sem := make(chan struct{}, d.workers)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(job Job) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d.attempt(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+	return len(jobs), nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, job Job) {
+	now := d.now()
+	age := now.Sub(job.CreatedAt)
+	if age >= NotificationTTL {
+		_ = d.repo.DeleteJob(ctx, job.ID)
+		return
+	}
+	if quiet, err := suppressed(ctx, d.repo, job.UserID, job.PeerUserID, now); err != nil {
+		return
+	} else if quiet {
+		_ = d.repo.DeleteJob(ctx, job.ID)
+		return
+	}
+	sub, err := d.repo.GetSubscription(ctx, job.SubscriptionID)
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		_ = d.repo.DeleteJob(ctx, job.ID)
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	status, err := d.pusher.Push(ctx, sub, job.Payload, PushOptions{
+		TTL:     NotificationTTL - age,
+		Urgency: UrgencyHigh,
+		Topic:   job.Topic,
+	})
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		_ = d.repo.DeleteJob(ctx, job.ID)
+		return
+	case err == nil && (status == 404 || status == 410):
+		// The browser unsubscribed; its queued jobs go with it.
+		_ = d.repo.DeleteSubscription(ctx, sub.UserID, sub.ID)
+		return
+	}
+
+	job.Attempts++
+	if err != nil {
+		job.LastError = truncate(err.Error(), maxLastErrorLength)
+	} else {
+		job.LastError = "push service returned " + strconv.Itoa(status)
+	}
+	retryable := err != nil || status == 429 || status >= 500
+	if retryable && job.Attempts < d.policy.maxAttempts() {
+		job.NextAttemptAt = d.now().UTC().Add(RetryDelay(job.Attempts))
+	} else {
+		job.Status = JobDead
+	}
+	_ = d.repo.SaveJobAttempt(ctx, job)
+}
+
+// RetryDelay is the wait after the given number of failed attempts: 10s
+// doubling each time, capped at fifteen minutes.
+func RetryDelay(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryCap {
+			return retryCap
+		}
+	}
+	return delay
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
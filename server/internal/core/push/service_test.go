@@ -0,0 +1,462 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeRepo struct {
+	mu       sync.Mutex
+	subs     map[int64]Subscription
+	settings map[int]Settings
+	mutes    map[[2]int]Mute
+	jobs     map[int64]Job
+	nextID   int64
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{
+		subs:     map[int64]Subscription{},
+		settings: map[int]Settings{},
+		mutes:    map[[2]int]Mute{},
+		jobs:     map[int64]Job{},
+	}
+}
+
+func (f *fakeRepo) SaveSubscription(ctx context.Context, sub Subscription, limit int) (Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	sub.ID = f.nextID
+	f.subs[sub.ID] = sub
+	return sub, nil
+}
+
+func (f *fakeRepo) GetSubscription(ctx context.Context, subscriptionID int64) (Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sub, ok := f.subs[subscriptionID]
+	if !ok {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return sub, nil
+}
+
+func (f *fakeRepo) ListSubscriptions(ctx context.Context, userID int) ([]Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]Subscription, 0)
+	for _, sub := range f.subs {
+		if sub.UserID == userID {
+			out = append(out, sub)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) ListActiveSubscriptions(ctx context.Context, userID int, now time.Time) ([]Subscription, error) {
+	return f.ListSubscriptions(ctx, userID)
+}
+
+func (f *fakeRepo) DeleteSubscription(ctx context.Context, userID int, subscriptionID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs, subscriptionID)
+	for id, job := range f.jobs {
+		if job.SubscriptionID == subscriptionID {
+			delete(f.jobs, id)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepo) GetSettings(ctx context.Context, userID int) (Settings, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.settings[userID]; ok {
+		return s, nil
+	}
+	return Settings{UserID: userID}, nil
+}
+
+func (f *fakeRepo) SaveSettings(ctx context.Context, settings Settings) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.settings[settings.UserID] = settings
+	return nil
+}
+
+func (f *fakeRepo) GetMute(ctx context.Context, userID, peerUserID int) (Mute, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	mute, ok := f.mutes[[2]int{userID, peerUserID}]
+	if !ok {
+		return Mute{}, ErrMuteNotFound
+	}
+	return mute, nil
+}
+
+func (f *fakeRepo) ListMutes(ctx context.Context, userID int) ([]Mute, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]Mute, 0)
+	for _, m := range f.mutes {
+		if m.UserID == userID {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) SaveMute(ctx context.Context, mute Mute) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mutes[[2]int{mute.UserID, mute.PeerUserID}] = mute
+	return nil
+}
+
+func (f *fakeRepo) DeleteMute(ctx context.Context, userID, peerUserID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.mutes, [2]int{userID, peerUserID})
+	return nil
+}
+
+func (f *fakeRepo) EnqueueJobs(ctx context.Context, jobs []Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, j := range jobs {
+		f.nextID++
+		j.ID = f.nextID
+		f.jobs[j.ID] = j
+	}
+	return nil
+}
+
+func (f *fakeRepo) ClaimDueJobs(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]Job, 0)
+	for id, j := range f.jobs {
+		if j.Status == JobPending && !j.NextAttemptAt.After(now) && len(out) < limit {
+			j.NextAttemptAt = leaseUntil
+			f.jobs[id] = j
+			out = append(out, j)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) SaveJobAttempt(ctx context.Context, job Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.jobs[job.ID]; ok {
+		f.jobs[job.ID] = job
+	}
+	return nil
+}
+
+func (f *fakeRepo) DeleteJob(ctx context.Context, jobID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.jobs, jobID)
+	return nil
+}
+
+func (f *fakeRepo) jobCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.jobs)
+}
+
+func (f *fakeRepo) onlyJob(t *testing.T) Job {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.jobs) != 1 {
+		t.Fatalf("jobs = %d, want 1", len(f.jobs))
+	}
+	for _, j := range f.jobs {
+		return j
+	}
+	return Job{}
+}
+
+type fakePusher struct {
+	mu       sync.Mutex
+	status   int
+	err      error
+	payloads [][]byte
+	opts     []PushOptions
+}
+
+func (f *fakePusher) Push(ctx context.Context, sub Subscription, payload []byte, opts PushOptions) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.payloads = append(f.payloads, payload)
+	f.opts = append(f.opts, opts)
+	return f.status, f.err
+}
+
+func (f *fakePusher) PublicKey() string { return "vapid-public-key" }
+
+func subscribeRequest(t *testing.T) SubscribeRequest {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	_, _ = rand.Read(auth)
+	return SubscribeRequest{
+		Endpoint: "https://push.example.com/send/abc",
+		P256DH:   base64.URLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(auth),
+	}
+}
+
+type harness struct {
+	repo       *fakeRepo
+	pusher     *fakePusher
+	svc        *service
+	dispatcher *Dispatcher
+	now        time.Time
+}
+
+func newHarness(t *testing.T, status int) *harness {
+	t.Helper()
+	h := &harness{
+		repo:   newFakeRepo(),
+		pusher: &fakePusher{status: status},
+		now:    time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	policy := Policy{MaxAttempts: 3}
+	h.dispatcher = NewDispatcher(h.repo, h.pusher, policy)
+	h.svc = NewService(h.repo, h.pusher, h.dispatcher, policy).(*service)
+	clock := func() time.Time { return h.now }
+	h.svc.now, h.dispatcher.now = clock, clock
+	if _, err := h.svc.Subscribe(context.Background(), 7, 1, subscribeRequest(t)); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func (h *harness) notify(t *testing.T, n Notification) {
+	t.Helper()
+	if n.UserID == 0 {
+		n.UserID, n.FromUserID, n.FromUsername, n.MessageID, n.ContentKind = 7, 9, "bob", 42, "text"
+	}
+	if err := h.svc.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestService_SubscribeValidation(t *testing.T) {
+	svc := NewService(newFakeRepo(), &fakePusher{}, nil, Policy{})
+	ctx := context.Background()
+	good := subscribeRequest(t)
+
+	if _, err := svc.Subscribe(ctx, 7, 0, good); !errors.Is(err, ErrSessionRequired) {
+		t.Fatalf("no session err = %v", err)
+	}
+	for _, endpoint := range []string{"http://push.example.com/x", "https://user@push.example.com/x", "not a url"} {
+		req := good
+		req.Endpoint = endpoint
+		if _, err := svc.Subscribe(ctx, 7, 1, req); !errors.Is(err, ErrInvalidSubscription) {
+			t.Fatalf("endpoint %q err = %v", endpoint, err)
+		}
+	}
+	bad := good
+	bad.P256DH = base64.RawURLEncoding.EncodeToString(make([]byte, 65))
+	if _, err := svc.Subscribe(ctx, 7, 1, bad); !errors.Is(err, ErrInvalidSubscription) {
+		t.Fatalf("bad p256dh err = %v", err)
+	}
+	bad = good
+	bad.Auth = base64.RawURLEncoding.EncodeToString(make([]byte, 8))
+	if _, err := svc.Subscribe(ctx, 7, 1, bad); !errors.Is(err, ErrInvalidSubscription) {
+		t.Fatalf("bad auth err = %v", err)
+	}
+
+	sub, err := svc.Subscribe(ctx, 7, 1, good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sub.P256DH, "=") {
+		t.Fatalf("p256dh not normalized to unpadded base64url: %q", sub.P256DH)
+	}
+}
+
+func TestService_NotifyPayloadHidesEncryptedContent(t *testing.T) {
+	h := newHarness(t, 201)
+	h.notify(t, Notification{UserID: 7, FromUserID: 9, FromUsername: "bob", MessageID: 1, ContentKind: "text", Encrypted: true, Preview: "secret"})
+	h.notify(t, Notification{UserID: 7, FromUserID: 9, FromUsername: "bob", MessageID: 2, ContentKind: "text", Preview: strings.Repeat("é", MaxPreviewRunes+5)})
+	if n, err := h.dispatcher.SendDue(context.Background()); err != nil || n != 2 {
+		t.Fatalf("SendDue = %d, %v", n, err)
+	}
+	if h.repo.jobCount() != 0 {
+		t.Fatalf("sent jobs were not removed")
+	}
+
+	previews := map[int64]any{}
+	for _, raw := range h.pusher.payloads {
+		var body map[string]any
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Fatal(err)
+		}
+		previews[int64(body["message_id"].(float64))] = body["preview"]
+	}
+	if previews[1] != nil {
+		t.Fatalf("encrypted message leaked a preview: %v", previews[1])
+	}
+	if p, _ := previews[2].(string); len([]rune(p)) != MaxPreviewRunes+1 || !strings.HasSuffix(p, "…") {
+		t.Fatalf("preview = %q", p)
+	}
+	if opts := h.pusher.opts[0]; opts.Topic != "dm-9" || opts.Urgency != UrgencyHigh || opts.TTL != NotificationTTL {
+		t.Fatalf("push options = %+v", opts)
+	}
+}
+
+func TestService_NotifyRespectsMuteDNDAndQuietHours(t *testing.T) {
+	h := newHarness(t, 201)
+	ctx := context.Background()
+
+	if _, err := h.svc.Mute(ctx, 7, 9, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	h.notify(t, Notification{})
+	if h.repo.jobCount() != 0 {
+		t.Fatal("muted conversation was queued")
+	}
+	h.now = h.now.Add(2 * time.Hour)
+	if mutes, _ := h.svc.ListMutes(ctx, 7); len(mutes) != 0 {
+		t.Fatalf("expired mute still listed: %+v", mutes)
+	}
+
+	until := h.now.Add(30 * time.Minute)
+	if _, err := h.svc.UpdateSettings(ctx, Settings{UserID: 7, DNDUntil: &until}); err != nil {
+		t.Fatal(err)
+	}
+	h.notify(t, Notification{})
+	if h.repo.jobCount() != 0 {
+		t.Fatal("push queued during do-not-disturb")
+	}
+
+	// 14:00 UTC is 23:00 at UTC+9, inside 22:00-07:00 quiet hours.
+	quiet := &QuietHours{StartMinute: 22 * 60, EndMinute: 7 * 60, UTCOffsetMinutes: 9 * 60}
+	if _, err := h.svc.UpdateSettings(ctx, Settings{UserID: 7, QuietHours: quiet}); err != nil {
+		t.Fatal(err)
+	}
+	h.notify(t, Notification{})
+	if h.repo.jobCount() != 0 {
+		t.Fatal("push queued during quiet hours")
+	}
+
+	if _, err := h.svc.UpdateSettings(ctx, Settings{UserID: 7}); err != nil {
+		t.Fatal(err)
+	}
+	h.notify(t, Notification{})
+	if h.repo.jobCount() != 1 {
+		t.Fatal("push not queued once settings were cleared")
+	}
+	// Muting after the push was queued still silences it.
+	if _, err := h.svc.Mute(ctx, 7, 9, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.dispatcher.SendDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.pusher.payloads) != 0 || h.repo.jobCount() != 0 {
+		t.Fatalf("pushes = %d, jobs = %d after mute", len(h.pusher.payloads), h.repo.jobCount())
+	}
+}
+
+func TestService_UpdateSettingsValidation(t *testing.T) {
+	h := newHarness(t, 201)
+	ctx := context.Background()
+	for _, q := range []QuietHours{{StartMinute: 60, EndMinute: 60}, {StartMinute: -1, EndMinute: 60}, {StartMinute: 0, EndMinute: 24 * 60}, {StartMinute: 0, EndMinute: 60, UTCOffsetMinutes: 15 * 60}} {
+		q := q
+		if _, err := h.svc.UpdateSettings(ctx, Settings{UserID: 7, QuietHours: &q}); !errors.Is(err, ErrInvalidSettings) {
+			t.Fatalf("%+v err = %v", q, err)
+		}
+	}
+	past := h.now.Add(-time.Minute)
+	settings, err := h.svc.UpdateSettings(ctx, Settings{UserID: 7, DNDUntil: &past})
+	if err != nil || settings.DNDUntil != nil {
+		t.Fatalf("past dnd = %+v, err = %v", settings, err)
+	}
+	if _, err := h.svc.Mute(ctx, 7, 7, 0); !errors.Is(err, ErrInvalidMute) {
+		t.Fatalf("self mute err = %v", err)
+	}
+}
+
+func TestDispatcher_RetriesThenDeadLetters(t *testing.T) {
+	h := newHarness(t, 503)
+	ctx := context.Background()
+	h.notify(t, Notification{})
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if n, err := h.dispatcher.SendDue(ctx); err != nil || n != 1 {
+			t.Fatalf("attempt %d: SendDue = %d, %v", attempt, n, err)
+		}
+		job := h.repo.onlyJob(t)
+		if job.Attempts != attempt {
+			t.Fatalf("attempts = %d, want %d", job.Attempts, attempt)
+		}
+		if attempt < 3 && (job.Status != JobPending || !job.NextAttemptAt.Equal(h.now.Add(RetryDelay(attempt)))) {
+			t.Fatalf("attempt %d job = %+v", attempt, job)
+		}
+		h.now = h.now.Add(RetryDelay(attempt))
+	}
+	if job := h.repo.onlyJob(t); job.Status != JobDead || job.LastError != "push service returned 503" {
+		t.Fatalf("job = %+v", job)
+	}
+}
+
+func TestDispatcher_GoneRemovesSubscription(t *testing.T) {
+	h := newHarness(t, 410)
+	ctx := context.Background()
+	h.notify(t, Notification{})
+	if _, err := h.dispatcher.SendDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if subs, _ := h.repo.ListSubscriptions(ctx, 7); len(subs) != 0 {
+		t.Fatalf("subscriptions after 410 = %+v", subs)
+	}
+	if h.repo.jobCount() != 0 {
+		t.Fatal("jobs left for a removed subscription")
+	}
+}
+
+func TestDispatcher_DropsExpiredJobs(t *testing.T) {
+	h := newHarness(t, 201)
+	h.notify(t, Notification{})
+	h.now = h.now.Add(NotificationTTL)
+	if _, err := h.dispatcher.SendDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.pusher.payloads) != 0 || h.repo.jobCount() != 0 {
+		t.Fatalf("expired job was sent: pushes = %d", len(h.pusher.payloads))
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	day := QuietHours{StartMinute: 9 * 60, EndMinute: 17 * 60}
+	overnight := QuietHours{StartMinute: 22 * 60, EndMinute: 7 * 60, UTCOffsetMinutes: -5 * 60}
+	at := func(h, m int) time.Time { return time.Date(2026, 5, 1, h, m, 0, 0, time.UTC) }
+
+	if !day.Contains(at(9, 0)) || day.Contains(at(17, 0)) || day.Contains(at(8, 59)) {
+		t.Fatal("daytime window boundaries wrong")
+	}
+	// UTC-5: 03:30 UTC is 22:30 local, 12:30 UTC is 07:30 local.
+	if !overnight.Contains(at(3, 30)) || overnight.Contains(at(12, 30)) || !overnight.Contains(at(11, 59)) {
+		t.Fatal("overnight window wrong")
+	}
+}
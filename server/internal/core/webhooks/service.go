@@ -0,0 +1,427 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxDescriptionLength = 200
+	maxLastErrorLength   = 300
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+
+	defaultDispatchInterval = 5 * time.Second
+	defaultDispatchBatch    = 32
+	defaultDispatchWorkers  = 4
+	// deliveryLease must outlast a send, including the sender's timeout.
+	deliveryLease = 2 * time.Minute
+	retryBase     = 30 * time.Second
+	retryCap      = 6 * time.Hour
+)
+
+// Policy holds deployment settings shared by the service and the dispatcher.
+type Policy struct {
+	// AllowHTTP accepts http:// endpoint URLs. It is for local development
+	// and tests; production endpoints must use https.
+	AllowHTTP bool
+	// MaxAttempts is how many failed sends dead-letter a delivery.
+	MaxAttempts int
+}
+
+func (p Policy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+type CreateEndpointRequest struct {
+	URL         string
+	Description string
+	Events      []string
+}
+
+type Service interface {
+	// CreateEndpoint returns the endpoint with its signing secret, which is
+	// not returned again.
+	CreateEndpoint(ctx context.Context, userID int, req CreateEndpointRequest) (Endpoint, error)
+	ListEndpoints(ctx context.Context, userID int) ([]Endpoint, error)
+	DeleteEndpoint(ctx context.Context, userID int, endpointID int64) error
+	// ListDeliveries returns the caller's delivery log, newest first,
+	// optionally narrowed to one endpoint.
+	ListDeliveries(ctx context.Context, userID int, endpointID int64, limit int) ([]Delivery, error)
+	// RetryDelivery moves a dead delivery back onto the queue.
+	RetryDelivery(ctx context.Context, userID int, deliveryID int64) (Delivery, error)
+	// Publish queues event for every endpoint its user subscribed to it.
+	Publish(ctx context.Context, event Event) error
+}
+
+type service struct {
+	repo       Repository
+	dispatcher *Dispatcher
+	policy     Policy
+	now        func() time.Time
+}
+
+// NewService returns the webhook service. dispatcher may be nil, in which case
+// deliveries stay queued until a dispatcher runs.
+func NewService(repo Repository, dispatcher *Dispatcher, policy Policy) Service {
+	return &service{
+		repo:       repo,
+		dispatcher: dispatcher,
+		policy:     policy,
+		now:        time.Now,
+	}
+}
+
+func (s *service) CreateEndpoint(ctx context.Context, userID int, req CreateEndpointRequest) (Endpoint, error) {
+	if userID <= 0 {
+		return Endpoint{}, ErrInvalidEndpoint
+	}
+	rawURL, err := s.normalizeURL(req.URL)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	events, err := NormalizeEventTypes(req.Events)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	description := strings.TrimSpace(req.Description)
+	if len(description) > maxDescriptionLength {
+		return Endpoint{}, fmt.Errorf("%w: description is too long", ErrInvalidEndpoint)
+	}
+	secret, err := randomHex("whsec_", 32)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	return s.repo.CreateEndpoint(ctx, Endpoint{
+		UserID:      userID,
+		URL:         rawURL,
+		Description: description,
+		Events:      events,
+		Secret:      secret,
+		CreatedAt:   s.now().UTC(),
+	}, MaxEndpointsPerUser)
+}
+
+// normalizeURL rejects URLs a signed delivery should not go to. Whether the
+// host resolves to a private address is checked by the sender at dial time.
+func (s *service) normalizeURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" || u.Hostname() == "" {
+		return "", ErrInvalidEndpointURL
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+	case "http":
+		if !s.policy.AllowHTTP {
+			return "", ErrInvalidEndpointURL
+		}
+	default:
+		return "", ErrInvalidEndpointURL
+	}
+	if u.User != nil || u.Fragment != "" {
+		return "", ErrInvalidEndpointURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	return u.String(), nil
+}
+
+// NormalizeEventTypes deduplicates and validates event names, keeping the
+// order of EventTypes.
+func NormalizeEventTypes(events []string) ([]EventType, error) {
+	requested := make(map[EventType]bool, len(events))
+	for _, e := range events {
+		t := EventType(strings.ToLower(strings.TrimSpace(e)))
+		if !knownEventType(t) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidEventType, e)
+		}
+		requested[t] = true
+	}
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("%w: at least one event is required", ErrInvalidEventType)
+	}
+	out := make([]EventType, 0, len(requested))
+	for _, t := range EventTypes {
+		if requested[t] {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func knownEventType(t EventType) bool {
+	for _, known := range EventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *service) ListEndpoints(ctx context.Context, userID int) ([]Endpoint, error) {
+	return s.repo.ListEndpoints(ctx, userID)
+}
+
+func (s *service) DeleteEndpoint(ctx context.Context, userID int, endpointID int64) error {
+	return s.repo.DeleteEndpoint(ctx, userID, endpointID)
+}
+
+func (s *service) ListDeliveries(ctx context.Context, userID int, endpointID int64, limit int) ([]Delivery, error) {
+	if limit <= 0 {
+		limit = defaultDeliveryLimit
+	}
+	if limit > maxDeliveryLimit {
+		limit = maxDeliveryLimit
+	}
+	return s.repo.ListDeliveries(ctx, userID, endpointID, limit)
+}
+
+func (s *service) RetryDelivery(ctx context.Context, userID int, deliveryID int64) (Delivery, error) {
+	delivery, err := s.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return Delivery{}, err
+	}
+	endpoint, err := s.repo.GetEndpoint(ctx, delivery.EndpointID)
+	if err != nil || endpoint.UserID != userID {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	if delivery.Status != DeliveryDead {
+		return Delivery{}, ErrDeliveryNotDead
+	}
+	delivery.Status = DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = s.now().UTC()
+	if err := s.repo.SaveDeliveryAttempt(ctx, delivery); err != nil {
+		return Delivery{}, err
+	}
+	s.dispatcher.Wake()
+	return delivery, nil
+}
+
+func (s *service) Publish(ctx context.Context, event Event) error {
+	if event.UserID <= 0 || !knownEventType(event.Type) {
+		return ErrInvalidEventType
+	}
+	if event.ID == "" {
+		id, err := randomHex("evt_", 16)
+		if err != nil {
+			return err
+		}
+		event.ID = id
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = s.now()
+	}
+
+	endpoints, err := s.repo.ListEndpoints(ctx, event.UserID)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]any{
+		"id":          event.ID,
+		"type":        event.Type,
+		"occurred_at": event.OccurredAt.UTC(),
+		"data":        event.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := s.now().UTC()
+	deliveries := make([]Delivery, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribes(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, Delivery{
+			EndpointID:    endpoint.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := s.repo.EnqueueDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+	s.dispatcher.Wake()
+	return nil
+}
+
+// Dispatcher sends queued deliveries. It polls the queue and is woken early
+// by Publish, so deliveries queued by a previous process are picked up too.
+type Dispatcher struct {
+	repo     Repository
+	sender   Sender
+	policy   Policy
+	now      func() time.Time
+	wake     chan struct{}
+	interval time.Duration
+	batch    int
+	workers  int
+}
+
+func NewDispatcher(repo Repository, sender Sender, policy Policy) *Dispatcher {
+	return &Dispatcher{
+		repo:     repo,
+		sender:   sender,
+		policy:   policy,
+		now:      time.Now,
+		wake:     make(chan struct{}, 1),
+		interval: defaultDispatchInterval,
+		batch:    defaultDispatchBatch,
+		workers:  defaultDispatchWorkers,
+	}
+}
+
+// Wake asks a running dispatcher to check the queue now. It is safe on a nil
+// Dispatcher.
+func (d *Dispatcher) Wake() {
+	if d == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the dispatch loop until ctx is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			for {
+				n, err := d.DeliverDue(ctx)
+				if err != nil || n < d.batch {
+					break
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// DeliverDue claims one batch of due deliveries, sends them and records the
+// outcome. It returns how many were attempted.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	now := d.now().UTC()
+	deliveries, err := d.repo.ClaimDueDeliveries(ctx, now, now.Add(deliveryLease), d.batch)
+	if err != nil {
+		return 0, err
+	}
+
+	sem := make(chan struct{}, d.workers)
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(delivery Delivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d.attempt(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery Delivery) {
+	endpoint, err := d.repo.GetEndpoint(ctx, delivery.EndpointID)
+	if errors.Is(err, ErrEndpointNotFound) {
+		// Deleting an endpoint removes its deliveries; this one raced it.
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	sentAt := d.now()
+	status, sendErr := d.sender.Send(ctx, Request{
+		URL: endpoint.URL,
+		Headers: map[string]string{
+			"Content-Type":  "application/json",
+			"User-Agent":    "go-chat-site-webhooks/1",
+			SignatureHeader: Sign(endpoint.Secret, sentAt, delivery.Payload),
+			EventIDHeader:   delivery.EventID,
+			EventTypeHeader: string(delivery.EventType),
+			DeliveryHeader:  strconv.FormatInt(delivery.ID, 10),
+		},
+		Body: delivery.Payload,
+	})
+
+	finished := d.now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &finished
+	delivery.LastStatusCode = status
+	delivery.LastError = ""
+	switch {
+	case sendErr == nil && status >= 200 && status < 300:
+		delivery.Status = DeliveryDelivered
+		delivery.DeliveredAt = &finished
+	default:
+		if sendErr != nil {
+			delivery.LastError = truncate(sendErr.Error(), maxLastErrorLength)
+		} else {
+			delivery.LastError = "unexpected status " + strconv.Itoa(status)
+		}
+		// 410 Gone is the receiver asking us to stop.
+		if status == 410 || delivery.Attempts >= d.policy.maxAttempts() {
+			delivery.Status = DeliveryDead
+		} else {
+			delivery.Status = DeliveryPending
+			delivery.NextAttemptAt = finished.Add(RetryDelay(delivery.Attempts))
+		}
+	}
+	_ = d.repo.SaveDeliveryAttempt(ctx, delivery)
+}
+
+// RetryDelay is the wait after the given number of failed attempts: 30s
+// doubling each time, capped at six hours.
+func RetryDelay(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryCap {
+			return retryCap
+		}
+	}
+	return delay
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+func randomHex(prefix string, n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(buf), nil
+}
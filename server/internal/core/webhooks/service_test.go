@@ -0,0 +1,279 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeRepo struct {
+	mu         sync.Mutex
+	endpoints  map[int64]Endpoint
+	deliveries map[int64]Delivery
+	nextID     int64
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{endpoints: map[int64]Endpoint{}, deliveries: map[int64]Delivery{}}
+}
+
+func (f *fakeRepo) CreateEndpoint(ctx context.Context, endpoint Endpoint, limit int) (Endpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	endpoint.ID = f.nextID
+	f.endpoints[endpoint.ID] = endpoint
+	return endpoint, nil
+}
+
+func (f *fakeRepo) GetEndpoint(ctx context.Context, endpointID int64) (Endpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	endpoint, ok := f.endpoints[endpointID]
+	if !ok {
+		return Endpoint{}, ErrEndpointNotFound
+	}
+	return endpoint, nil
+}
+
+func (f *fakeRepo) ListEndpoints(ctx context.Context, userID int) ([]Endpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]Endpoint, 0)
+	for _, endpoint := range f.endpoints {
+		if endpoint.UserID == userID {
+			out = append(out, endpoint)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) DeleteEndpoint(ctx context.Context, userID int, endpointID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.endpoints, endpointID)
+	return nil
+}
+
+func (f *fakeRepo) EnqueueDeliveries(ctx context.Context, deliveries []Delivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, d := range deliveries {
+		f.nextID++
+		d.ID = f.nextID
+		f.deliveries[d.ID] = d
+	}
+	return nil
+}
+
+func (f *fakeRepo) ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Delivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]Delivery, 0)
+	for id, d := range f.deliveries {
+		if d.Status == DeliveryPending && !d.NextAttemptAt.After(now) && len(out) < limit {
+			d.NextAttemptAt = leaseUntil
+			f.deliveries[id] = d
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) SaveDeliveryAttempt(ctx context.Context, delivery Delivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (f *fakeRepo) GetDelivery(ctx context.Context, deliveryID int64) (Delivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, ok := f.deliveries[deliveryID]
+	if !ok {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	return d, nil
+}
+
+func (f *fakeRepo) ListDeliveries(ctx context.Context, userID int, endpointID int64, limit int) ([]Delivery, error) {
+	return nil, nil
+}
+
+func (f *fakeRepo) only(t *testing.T) Delivery {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.deliveries) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(f.deliveries))
+	}
+	for _, d := range f.deliveries {
+		return d
+	}
+	return Delivery{}
+}
+
+type fakeSender struct {
+	mu       sync.Mutex
+	status   int
+	err      error
+	requests []Request
+}
+
+func (f *fakeSender) Send(ctx context.Context, req Request) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	return f.status, f.err
+}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+	header := Sign("whsec_test", now, body)
+	if !strings.HasPrefix(header, "t=1700000000,v1=") {
+		t.Fatalf("header = %q", header)
+	}
+	if err := VerifySignature("whsec_test", header, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("VerifySignature error: %v", err)
+	}
+	if err := VerifySignature("whsec_other", header, body, now, 5*time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("wrong secret err = %v", err)
+	}
+	if err := VerifySignature("whsec_test", header, []byte(`{"id":"evt_2"}`), now, 5*time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("tampered body err = %v", err)
+	}
+	if err := VerifySignature("whsec_test", header, body, now.Add(time.Hour), 5*time.Minute); !errors.Is(err, ErrSignatureOutOfRange) {
+		t.Fatalf("stale signature err = %v", err)
+	}
+}
+
+func TestService_CreateEndpointValidation(t *testing.T) {
+	svc := NewService(newFakeRepo(), nil, Policy{})
+	ctx := context.Background()
+
+	for _, raw := range []string{"http://example.com/hook", "ftp://example.com", "https://user:pw@example.com/", "not a url"} {
+		if _, err := svc.CreateEndpoint(ctx, 7, CreateEndpointRequest{URL: raw, Events: []string{"message.received"}}); !errors.Is(err, ErrInvalidEndpointURL) {
+			t.Fatalf("%q err = %v", raw, err)
+		}
+	}
+	if _, err := svc.CreateEndpoint(ctx, 7, CreateEndpointRequest{URL: "https://example.com/hook", Events: []string{"wallet.drained"}}); !errors.Is(err, ErrInvalidEventType) {
+		t.Fatalf("unknown event err = %v", err)
+	}
+	endpoint, err := svc.CreateEndpoint(ctx, 7, CreateEndpointRequest{
+		URL:    "https://example.com/hook",
+		Events: []string{"transfer.settled", "MESSAGE.RECEIVED", "transfer.settled"},
+	})
+	if err != nil {
+		t.Fatalf("CreateEndpoint error: %v", err)
+	}
+	if !strings.HasPrefix(endpoint.Secret, "whsec_") || len(endpoint.Events) != 2 || endpoint.Events[0] != EventMessageReceived {
+		t.Fatalf("endpoint = %+v", endpoint)
+	}
+
+	dev := NewService(newFakeRepo(), nil, Policy{AllowHTTP: true})
+	if _, err := dev.CreateEndpoint(ctx, 7, CreateEndpointRequest{URL: "http://127.0.0.1:9000/hook", Events: []string{"invite.accepted"}}); err != nil {
+		t.Fatalf("http endpoint with AllowHTTP err = %v", err)
+	}
+}
+
+func TestDispatcher_RetriesThenDeadLetters(t *testing.T) {
+	repo := newFakeRepo()
+	sender := &fakeSender{status: 500}
+	policy := Policy{MaxAttempts: 3}
+	dispatcher := NewDispatcher(repo, sender, policy)
+	svc := NewService(repo, dispatcher, policy).(*service)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	svc.now, dispatcher.now = clock, clock
+	ctx := context.Background()
+
+	endpoint, err := svc.CreateEndpoint(ctx, 7, CreateEndpointRequest{URL: "https://example.com/hook", Events: []string{"transfer.settled"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Publish(ctx, Event{Type: EventMessageReceived, UserID: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Publish(ctx, Event{Type: EventTransferSettled, UserID: 7, Data: map[string]any{"amount_cents": 500}}); err != nil {
+		t.Fatal(err)
+	}
+	queued := repo.only(t)
+
+	if n, err := dispatcher.DeliverDue(ctx); err != nil || n != 1 {
+		t.Fatalf("DeliverDue = %d, %v", n, err)
+	}
+	req := sender.requests[0]
+	if err := VerifySignature(endpoint.Secret, req.Headers[SignatureHeader], req.Body, now, time.Minute); err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	if req.Headers[EventTypeHeader] != "transfer.settled" || !strings.Contains(string(req.Body), `"amount_cents":500`) {
+		t.Fatalf("request = %+v body=%s", req.Headers, req.Body)
+	}
+	d := repo.only(t)
+	if d.Status != DeliveryPending || d.Attempts != 1 || !d.NextAttemptAt.Equal(now.Add(RetryDelay(1))) || d.LastStatusCode != 500 {
+		t.Fatalf("after first failure = %+v", d)
+	}
+
+	if n, _ := dispatcher.DeliverDue(ctx); n != 0 {
+		t.Fatalf("delivery retried before its backoff elapsed")
+	}
+	for i := 0; i < 2; i++ {
+		now = now.Add(RetryDelay(i + 1))
+		if n, _ := dispatcher.DeliverDue(ctx); n != 1 {
+			t.Fatalf("retry %d not attempted", i+1)
+		}
+	}
+	if d := repo.only(t); d.Status != DeliveryDead || d.Attempts != 3 {
+		t.Fatalf("after max attempts = %+v", d)
+	}
+
+	if _, err := svc.RetryDelivery(ctx, 8, queued.ID); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Fatalf("retry by another user err = %v", err)
+	}
+	if _, err := svc.RetryDelivery(ctx, 7, queued.ID); err != nil {
+		t.Fatalf("RetryDelivery error: %v", err)
+	}
+	sender.status = 204
+	if n, _ := dispatcher.DeliverDue(ctx); n != 1 {
+		t.Fatal("retried delivery not attempted")
+	}
+	if d := repo.only(t); d.Status != DeliveryDelivered || d.DeliveredAt == nil || d.LastError != "" {
+		t.Fatalf("after success = %+v", d)
+	}
+	if _, err := svc.RetryDelivery(ctx, 7, queued.ID); !errors.Is(err, ErrDeliveryNotDead) {
+		t.Fatalf("retry of delivered err = %v", err)
+	}
+}
+
+func TestDispatcher_GoneDeadLettersImmediately(t *testing.T) {
+	repo := newFakeRepo()
+	dispatcher := NewDispatcher(repo, &fakeSender{status: 410}, Policy{})
+	svc := NewService(repo, dispatcher, Policy{})
+	ctx := context.Background()
+	if _, err := svc.CreateEndpoint(ctx, 7, CreateEndpointRequest{URL: "https://example.com/hook", Events: []string{"invite.accepted"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Publish(ctx, Event{Type: EventInviteAccepted, UserID: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dispatcher.DeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := repo.only(t); d.Status != DeliveryDead || d.Attempts != 1 {
+		t.Fatalf("delivery = %+v", d)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if RetryDelay(1) != 30*time.Second || RetryDelay(3) != 2*time.Minute {
+		t.Fatalf("RetryDelay(1) = %v, RetryDelay(3) = %v", RetryDelay(1), RetryDelay(3))
+	}
+	if RetryDelay(40) != 6*time.Hour {
+		t.Fatalf("RetryDelay(40) = %v, want cap", RetryDelay(40))
+	}
+}
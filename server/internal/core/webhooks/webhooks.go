@@ -0,0 +1,184 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventMessageReceived    EventType = "message.received"
+	EventInviteAccepted     EventType = "invite.accepted"
+	EventTransferSettled    EventType = "transfer.settled"
+	EventPaymentRequestPaid EventType = "payment_request.paid"
+)
+
+// EventTypes lists what an endpoint may subscribe to.
+var EventTypes = []EventType{
+	EventMessageReceived,
+	EventInviteAccepted,
+	EventTransferSettled,
+	EventPaymentRequestPaid,
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventIDHeader   = "X-Webhook-Event-Id"
+	EventTypeHeader = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	MaxEndpointsPerUser = 10
+	DefaultMaxAttempts  = 8
+)
+
+var (
+	ErrInvalidEndpoint     = errors.New("invalid webhook endpoint")
+	ErrInvalidEndpointURL  = errors.New("webhook url must be an https url")
+	ErrInvalidEventType    = errors.New("unknown webhook event type")
+	ErrEndpointNotFound    = errors.New("webhook endpoint not found")
+	ErrEndpointLimit       = errors.New("webhook endpoint limit reached")
+	ErrDeliveryNotFound    = errors.New("webhook delivery not found")
+	ErrDeliveryNotDead     = errors.New("only dead deliveries can be retried")
+	ErrInvalidSignature    = errors.New("invalid webhook signature")
+	ErrSignatureOutOfRange = errors.New("webhook signature timestamp out of range")
+)
+
+// Event is something that happened to UserID; it is delivered to every
+// endpoint that user registered for Type.
+type Event struct {
+	ID         string
+	Type       EventType
+	UserID     int
+	OccurredAt time.Time
+	Data       map[string]any
+}
+
+type Endpoint struct {
+	ID          int64
+	UserID      int
+	URL         string
+	Description string
+	Events      []EventType
+	// Secret signs deliveries. It is kept in plaintext because signing needs
+	// it, and is only shown to the owner when the endpoint is created.
+	Secret    string
+	CreatedAt time.Time
+}
+
+func (e Endpoint) Subscribes(eventType EventType) bool {
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one event queued for one endpoint. Pending rows are the durable
+// queue; dead rows are the dead-letter list.
+type Delivery struct {
+	ID             int64
+	EndpointID     int64
+	EventID        string
+	EventType      EventType
+	Payload        []byte
+	Status         DeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastAttemptAt  *time.Time
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+type Repository interface {
+	CreateEndpoint(ctx context.Context, endpoint Endpoint, limit int) (Endpoint, error)
+	GetEndpoint(ctx context.Context, endpointID int64) (Endpoint, error)
+	ListEndpoints(ctx context.Context, userID int) ([]Endpoint, error)
+	DeleteEndpoint(ctx context.Context, userID int, endpointID int64) error
+	EnqueueDeliveries(ctx context.Context, deliveries []Delivery) error
+	// ClaimDueDeliveries returns pending deliveries due at now and pushes
+	// their next_attempt_at to leaseUntil, so a crash mid-send retries them
+	// rather than losing them, and overlapping sweeps do not send twice.
+	ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Delivery, error)
+	SaveDeliveryAttempt(ctx context.Context, delivery Delivery) error
+	GetDelivery(ctx context.Context, deliveryID int64) (Delivery, error)
+	ListDeliveries(ctx context.Context, userID int, endpointID int64, limit int) ([]Delivery, error)
+}
+
+// Request is one signed HTTP POST to an endpoint.
+type Request struct {
+	URL     string
+	Headers map[string]string
+	Body    []byte
+}
+
+// Sender performs the HTTP call. It returns the response status code, or an
+// error when no response was received.
+type Sender interface {
+	Send(ctx context.Context, req Request) (int, error)
+}
+
+// Sign returns the X-Webhook-Signature value for body sent at timestamp:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">".
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + ts + ",v1=" + signature(secret, ts, body)
+}
+
+// VerifySignature checks a signature header as a receiver would, rejecting
+// timestamps further than tolerance from now to limit replays.
+func VerifySignature(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sigs = append(sigs, value)
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return ErrSignatureOutOfRange
+	}
+	want := signature(secret, ts, body)
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
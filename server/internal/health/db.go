@@ -18,12 +18,11 @@ func CheckDBReady(ctx context.Context, db *sql.DB) error {
 		return fmt.Errorf("database ping failed: %w", err)
 	}
 
+	// Reading the table itself rather than a catalog keeps the check the
+	// same on SQLite and Postgres.
 	var count int
-	if err := db.QueryRowContext(ctx, `SELECT COUNT(1) FROM sqlite_master WHERE type='table' AND name='schema_migrations'`).Scan(&count); err != nil {
-		return fmt.Errorf("schema_migrations readiness check failed: %w", err)
-	}
-	if count != 1 {
-		return errors.New("schema_migrations table missing")
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(1) FROM schema_migrations`).Scan(&count); err != nil {
+		return fmt.Errorf("schema_migrations table missing: %w", err)
 	}
 
 	return nil
@@ -1,69 +1,378 @@
 package migrate
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
+	"io/fs"
+	"os"
 	"sort"
 	"strings"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
 )
 
-// RunMigrations applies all .sql files in a directory that have not yet been applied.
-// It uses a schema_migrations table to track which migrations are already done.
-func RunMigrations(db *sql.DB, dir string) error {
-	// Ensure the migrations table exists.
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY)`)
+var (
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	ErrUnknownVersion   = errors.New("applied migration is not in the migration set")
+	ErrNoDownMigration  = errors.New("migration has no down script")
+)
+
+const downSuffix = ".down.sql"
+
+// Migration is one schema version: its up script and, when a paired
+// NNNN_name.down.sql exists, the script that reverses it.
+type Migration struct {
+	Version  string
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status describes one version as seen by Migrator.Status. Missing versions
+// were applied by a newer migration set and have no Name.
+type Status struct {
+	Version  string
+	Name     string
+	Applied  bool
+	Modified bool
+	Missing  bool
+	HasDown  bool
+}
+
+// Load reads the .sql files at the root of fsys, ordered by version. The
+// version is the file name up to the first underscore, and the checksum is
+// the SHA-256 of the up script.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
 	if err != nil {
-		return fmt.Errorf("could not create schema_migrations table: %w", err)
+		return nil, err
+	}
+
+	byVersion := map[string]*Migration{}
+	downs := map[string]string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		version := strings.Split(name, "_")[0]
+		if strings.HasSuffix(name, downSuffix) {
+			if _, ok := downs[version]; ok {
+				return nil, fmt.Errorf("duplicate down migration for version %s", version)
+			}
+			downs[version] = string(content)
+			continue
+		}
+		if existing, ok := byVersion[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %s: %s and %s", version, existing.Name, name)
+		}
+		sum := sha256.Sum256(content)
+		byVersion[version] = &Migration{Version: version, Name: name, Up: string(content), Checksum: hex.EncodeToString(sum[:])}
+	}
+
+	for version, down := range downs {
+		m, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("down migration for version %s has no up migration", version)
+		}
+		m.Down = down
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
 	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and reverts one migration set against one database,
+// tracking versions and their checksums in schema_migrations.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect.Dialect
+	migrations []Migration
+}
 
-	files, err := ioutil.ReadDir(dir)
+func New(db *sql.DB, fsys fs.FS, d dialect.Dialect) (*Migrator, error) {
+	migrations, err := Load(fsys)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return &Migrator{db: db, dialect: d, migrations: migrations}, nil
+}
 
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Name() < files[j].Name()
-	})
+// Migrations returns the loaded migration set in version order.
+func (m *Migrator) Migrations() []Migration { return m.migrations }
 
-	tx, err := db.Begin()
+// Up applies up to n pending migrations in version order, or all of them
+// when n <= 0, in one transaction. It refuses to apply anything when an
+// applied migration has been modified or is unknown. Versions recorded
+// before checksums were tracked adopt the current file's checksum.
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	applied, err := m.applied(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkDrift(applied); err != nil {
+		return nil, err
 	}
-	defer tx.Rollback() // Rollback on error, commit on success
 
-	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".sql") {
+	var done []Migration
+	for _, migration := range m.migrations {
+		checksum, ok := applied[migration.Version]
+		if ok {
+			if checksum == "" {
+				if _, err := tx.ExecContext(ctx, m.dialect.Rebind(`UPDATE schema_migrations SET checksum = ? WHERE version = ?`), migration.Checksum, migration.Version); err != nil {
+					return nil, fmt.Errorf("failed to record checksum for migration %s: %w", migration.Version, err)
+				}
+			}
 			continue
 		}
+		if n > 0 && len(done) == n {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return nil, fmt.Errorf("failed to execute migration %s: %w", migration.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, m.dialect.Rebind(`INSERT INTO schema_migrations (version, checksum) VALUES (?, ?)`), migration.Version, migration.Checksum); err != nil {
+			return nil, fmt.Errorf("failed to record migration version %s: %w", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return done, nil
+}
 
-		version := strings.Split(file.Name(), "_")[0]
+// Down reverts the n most recently applied migrations, newest first, in one
+// transaction. Nothing is reverted unless every one of them has a down
+// script and no applied migration has drifted.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n <= 0 {
+		return nil, errors.New("down needs a positive number of migrations")
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	applied, err := m.applied(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkDrift(applied); err != nil {
+		return nil, err
+	}
 
-		var appliedVersion string
-		err := tx.QueryRow("SELECT version FROM schema_migrations WHERE version = ?", version).Scan(&appliedVersion)
-		if err != nil && err != sql.ErrNoRows {
-			return fmt.Errorf("could not query schema_migrations for version %s: %w", version, err)
+	var targets []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(targets) < n; i-- {
+		if _, ok := applied[m.migrations[i].Version]; ok {
+			targets = append(targets, m.migrations[i])
+		}
+	}
+	for _, migration := range targets {
+		if strings.TrimSpace(migration.Down) == "" {
+			return nil, fmt.Errorf("%w: %s", ErrNoDownMigration, migration.Name)
 		}
+	}
 
-		// If the migration has already been applied, skip it.
-		if appliedVersion == version {
-			continue
+	for _, migration := range targets {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return nil, fmt.Errorf("failed to revert migration %s: %w", migration.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, m.dialect.Rebind(`DELETE FROM schema_migrations WHERE version = ?`), migration.Version); err != nil {
+			return nil, fmt.Errorf("failed to remove migration version %s: %w", migration.Version, err)
 		}
+	}
 
-		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
-		if err != nil {
-			return err
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// Status reports every known version followed by any applied version the
+// migration set no longer contains.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.readApplied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	known := map[string]bool{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		checksum, ok := applied[migration.Version]
+		statuses = append(statuses, Status{
+			Version:  migration.Version,
+			Name:     migration.Name,
+			Applied:  ok,
+			Modified: ok && checksum != "" && checksum != migration.Checksum,
+			HasDown:  strings.TrimSpace(migration.Down) != "",
+		})
+	}
+
+	var missing []string
+	for version := range applied {
+		if !known[version] {
+			missing = append(missing, version)
 		}
+	}
+	sort.Strings(missing)
+	for _, version := range missing {
+		statuses = append(statuses, Status{Version: version, Applied: true, Missing: true})
+	}
+	return statuses, nil
+}
+
+// Verify fails when an applied migration has been modified or is missing
+// from the migration set. Pending migrations are not an error.
+func (m *Migrator) Verify(ctx context.Context) error {
+	applied, err := m.readApplied(ctx)
+	if err != nil {
+		return err
+	}
+	return m.checkDrift(applied)
+}
 
-		if _, err = tx.Exec(string(content)); err != nil {
-			return fmt.Errorf("failed to execute migration %s: %w", file.Name(), err)
+func (m *Migrator) checkDrift(applied map[string]string) error {
+	known := map[string]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	var problems []string
+	var first error
+	versions := make([]string, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	for _, version := range versions {
+		migration, ok := known[version]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("version %s is applied but not in the migration set", version))
+			if first == nil {
+				first = ErrUnknownVersion
+			}
+		case applied[version] != "" && applied[version] != migration.Checksum:
+			problems = append(problems, fmt.Sprintf("%s changed after it was applied (recorded %s, file %s)", migration.Name, shortSum(applied[version]), shortSum(migration.Checksum)))
+			if first == nil {
+				first = ErrChecksumMismatch
+			}
 		}
+	}
+	if first != nil {
+		return fmt.Errorf("%w: %s", first, strings.Join(problems, "; "))
+	}
+	return nil
+}
 
-		if _, err = tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version); err != nil {
-			return fmt.Errorf("failed to record migration version %s: %w", version, err)
+func (m *Migrator) readApplied(ctx context.Context) (map[string]string, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	applied, err := m.applied(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	return applied, tx.Commit()
+}
+
+// applied creates or upgrades schema_migrations and returns the recorded
+// checksum of every applied version; versions recorded before checksums
+// were tracked have an empty one.
+func (m *Migrator) applied(ctx context.Context, tx *sql.Tx) (map[string]string, error) {
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY, checksum TEXT NOT NULL DEFAULT '')`); err != nil {
+		return nil, fmt.Errorf("could not create schema_migrations table: %w", err)
+	}
+	if err := m.addChecksumColumn(ctx, tx); err != nil {
+		return nil, fmt.Errorf("could not add schema_migrations.checksum: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT version, checksum FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("could not query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := map[string]string{}
+	for rows.Next() {
+		var version, checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
 		}
+		applied[version] = checksum
+	}
+	return applied, rows.Err()
+}
+
+// addChecksumColumn upgrades a schema_migrations table created before
+// checksums were recorded.
+func (m *Migrator) addChecksumColumn(ctx context.Context, tx *sql.Tx) error {
+	if m.dialect == dialect.Postgres {
+		_, err := tx.ExecContext(ctx, `ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum TEXT NOT NULL DEFAULT ''`)
+		return err
 	}
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info('schema_migrations') WHERE name = 'checksum'`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `ALTER TABLE schema_migrations ADD COLUMN checksum TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+func shortSum(sum string) string {
+	if len(sum) > 12 {
+		return sum[:12]
+	}
+	return sum
+}
+
+// Apply runs every pending migration in fsys.
+func Apply(db *sql.DB, fsys fs.FS, d dialect.Dialect) error {
+	m, err := New(db, fsys, d)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(context.Background(), 0)
+	return err
+}
+
+// RunMigrations applies all .sql files in a directory that have not yet been applied.
+// It uses a schema_migrations table to track which migrations are already done.
+func RunMigrations(db *sql.DB, dir string) error {
+	return RunMigrationsFor(db, dir, dialect.SQLite)
+}
 
-	return tx.Commit()
+// RunMigrationsFor is RunMigrations for a database of the given dialect.
+// Subdirectories are skipped, so the Postgres set in migrations/postgres is
+// never applied to SQLite.
+func RunMigrationsFor(db *sql.DB, dir string, d dialect.Dialect) error {
+	return Apply(db, os.DirFS(dir), d)
 }
@@ -1,11 +1,17 @@
 package migrate
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+	"github.com/kyambuthia/go-chat-site/server/migrations"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -67,3 +73,248 @@ func TestRunMigrations_FailsOnInvalidSQL(t *testing.T) {
 		t.Fatal("expected migration failure for invalid sql")
 	}
 }
+
+func openMemoryDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_items.sql":      {Data: []byte(`CREATE TABLE items (id INTEGER PRIMARY KEY);`)},
+		"0001_items.down.sql": {Data: []byte(`DROP TABLE items;`)},
+		"0002_tags.sql":       {Data: []byte(`CREATE TABLE tags (id INTEGER PRIMARY KEY);`)},
+		"0002_tags.down.sql":  {Data: []byte(`DROP TABLE tags;`)},
+		"0003_notes.sql":      {Data: []byte(`CREATE TABLE notes (id INTEGER PRIMARY KEY);`)},
+		"0003_notes.down.sql": {Data: []byte(`DROP TABLE notes;`)},
+	}
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count == 1
+}
+
+func TestMigrator_UpAndDownByCount(t *testing.T) {
+	db := openMemoryDB(t)
+	m, err := New(db, testMigrations(), dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	applied, err := m.Up(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Version != "0001" || !tableExists(t, db, "items") || tableExists(t, db, "tags") {
+		t.Fatalf("up 1 applied %+v", applied)
+	}
+	if applied, err = m.Up(ctx, 0); err != nil || len(applied) != 2 {
+		t.Fatalf("up all applied %+v, err = %v", applied, err)
+	}
+
+	reverted, err := m.Down(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 2 || reverted[0].Version != "0003" || reverted[1].Version != "0002" {
+		t.Fatalf("down 2 reverted %+v", reverted)
+	}
+	if !tableExists(t, db, "items") || tableExists(t, db, "tags") || tableExists(t, db, "notes") {
+		t.Fatal("down 2 left the wrong tables")
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 3 || !statuses[0].Applied || statuses[1].Applied || statuses[2].Applied || !statuses[0].HasDown {
+		t.Fatalf("statuses = %+v", statuses)
+	}
+	if _, err := m.Down(ctx, 0); err == nil {
+		t.Fatal("expected down 0 to be rejected")
+	}
+}
+
+func TestMigrator_RefusesModifiedMigration(t *testing.T) {
+	db := openMemoryDB(t)
+	files := testMigrations()
+	if err := Apply(db, files, dialect.SQLite); err != nil {
+		t.Fatal(err)
+	}
+
+	files["0002_tags.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT);`)}
+	files["0004_more.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE more (id INTEGER PRIMARY KEY);`)}
+	m, err := New(db, files, dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := m.Verify(ctx); !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), "0002_tags.sql") {
+		t.Fatalf("verify error = %v, want ErrChecksumMismatch naming the file", err)
+	}
+	if _, err := m.Up(ctx, 0); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("up error = %v, want ErrChecksumMismatch", err)
+	}
+	if tableExists(t, db, "more") {
+		t.Fatal("up must not apply pending migrations after drift")
+	}
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("down error = %v, want ErrChecksumMismatch", err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[1].Modified || statuses[0].Modified || statuses[3].Applied {
+		t.Fatalf("statuses = %+v", statuses)
+	}
+}
+
+func TestMigrator_RefusesUnknownAppliedVersion(t *testing.T) {
+	db := openMemoryDB(t)
+	files := testMigrations()
+	if err := Apply(db, files, dialect.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	delete(files, "0003_notes.sql")
+	delete(files, "0003_notes.down.sql")
+	m, err := New(db, files, dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(context.Background()); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("verify error = %v, want ErrUnknownVersion", err)
+	}
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := statuses[len(statuses)-1]; last.Version != "0003" || !last.Missing {
+		t.Fatalf("statuses = %+v", statuses)
+	}
+}
+
+func TestMigrator_DownNeedsEveryDownScript(t *testing.T) {
+	db := openMemoryDB(t)
+	files := testMigrations()
+	delete(files, "0002_tags.down.sql")
+	m, err := New(db, files, dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Down(ctx, 2); !errors.Is(err, ErrNoDownMigration) {
+		t.Fatalf("down error = %v, want ErrNoDownMigration", err)
+	}
+	if !tableExists(t, db, "notes") {
+		t.Fatal("down must not revert anything when a script is missing")
+	}
+}
+
+func TestMigrator_AdoptsChecksumsOfLegacyVersions(t *testing.T) {
+	db := openMemoryDB(t)
+	if _, err := db.Exec(`CREATE TABLE schema_migrations (version TEXT PRIMARY KEY);
+		CREATE TABLE items (id INTEGER PRIMARY KEY);
+		INSERT INTO schema_migrations (version) VALUES ('0001');`); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, testMigrations(), dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := m.Up(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Fatalf("applied = %+v, want 0002 and 0003", applied)
+	}
+	var checksum string
+	if err := db.QueryRow(`SELECT checksum FROM schema_migrations WHERE version = '0001'`).Scan(&checksum); err != nil {
+		t.Fatal(err)
+	}
+	if checksum != m.Migrations()[0].Checksum {
+		t.Fatalf("legacy checksum = %q, want %q", checksum, m.Migrations()[0].Checksum)
+	}
+}
+
+func TestLoad_RejectsInconsistentSets(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"orphan down": {
+			"0001_a.down.sql": {Data: []byte(`SELECT 1;`)},
+		},
+		"duplicate version": {
+			"0001_a.sql": {Data: []byte(`SELECT 1;`)},
+			"0001_b.sql": {Data: []byte(`SELECT 1;`)},
+		},
+	}
+	for name, files := range cases {
+		if _, err := Load(files); err == nil {
+			t.Errorf("%s: expected Load error", name)
+		}
+	}
+}
+
+// Every shipped down script must revert its migration cleanly, so the
+// embedded sets are walked all the way down and back up.
+func TestEmbeddedMigrations_RoundTrip(t *testing.T) {
+	db := openMemoryDB(t)
+	if _, err := db.Exec(`PRAGMA foreign_keys = ON`); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, migrations.SQLite(), dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	total := len(m.Migrations())
+	for i, migration := range m.Migrations() {
+		if migration.Down == "" {
+			t.Errorf("%s has no down migration", migration.Name)
+		}
+		if i > 0 && migration.Version <= m.Migrations()[i-1].Version {
+			t.Fatalf("migrations out of order at %s", migration.Name)
+		}
+	}
+	if reverted, err := m.Down(ctx, total); err != nil || len(reverted) != total {
+		t.Fatalf("down all reverted %d, err = %v", len(reverted), err)
+	}
+	var leftover int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name NOT IN ('schema_migrations', 'sqlite_sequence') AND name NOT LIKE 'sqlite_autoindex%'`).Scan(&leftover); err != nil {
+		t.Fatal(err)
+	}
+	if leftover != 0 {
+		t.Fatalf("%d schema objects left after reverting every migration", leftover)
+	}
+	if applied, err := m.Up(ctx, 0); err != nil || len(applied) != total {
+		t.Fatalf("re-apply applied %d, err = %v", len(applied), err)
+	}
+
+	postgres, err := Load(migrations.Postgres())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range postgres {
+		if migration.Down == "" {
+			t.Errorf("postgres %s has no down migration", migration.Name)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/store/storetest"
+)
+
+func TestAPIStoreContract(t *testing.T) {
+	storetest.ForEach(t, storetest.RunAPIStoreContract)
+}
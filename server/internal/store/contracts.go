@@ -1,5 +1,7 @@
 package store
 
+import "time"
+
 // LoginStore is the auth login dependency.
 type LoginStore interface {
 	GetUserByUsername(username string) (*User, error)
@@ -24,6 +26,9 @@ type InviteStore interface {
 	CreateInvite(inviterID, inviteeID int) error
 	ListInvites(userID int) ([]Invite, error)
 	UpdateInviteStatus(inviteID, userID int, status string) error
+	CancelInvite(inviteID, requesterID int) error
+	ListOutgoingInvites(userID int) ([]OutgoingInvite, error)
+	ExpireInvites(now time.Time) (int, error)
 }
 
 // MeStore handles profile read/update operations for the authenticated user.
@@ -0,0 +1,69 @@
+// Package dialect names the SQL flavour behind a *sql.DB so code shared by
+// the SQLite and Postgres backends can adjust the few things that differ.
+package dialect
+
+import (
+	"strconv"
+	"strings"
+)
+
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+func (d Dialect) String() string {
+	if d == Postgres {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+// Rebind rewrites ? placeholders as $1, $2, ... for Postgres. Question marks
+// inside quoted literals and identifiers are left alone.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// TimestampType is the column type for an instant in time.
+func (d Dialect) TimestampType() string {
+	if d == Postgres {
+		return "TIMESTAMPTZ"
+	}
+	return "DATETIME"
+}
+
+// Of reports the dialect of a store or handle, defaulting to SQLite for
+// values that do not say.
+func Of(v any) Dialect {
+	if provider, ok := v.(interface{ Dialect() Dialect }); ok {
+		return provider.Dialect()
+	}
+	return SQLite
+}
@@ -0,0 +1,30 @@
+package dialect
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	query := `SELECT id FROM t WHERE a = ? AND b = 'what?' AND "odd?col" = ? LIMIT ?`
+	if got := SQLite.Rebind(query); got != query {
+		t.Fatalf("sqlite rebind changed query: %s", got)
+	}
+	want := `SELECT id FROM t WHERE a = $1 AND b = 'what?' AND "odd?col" = $2 LIMIT $3`
+	if got := Postgres.Rebind(query); got != want {
+		t.Fatalf("postgres rebind = %s, want %s", got, want)
+	}
+	if got := Postgres.Rebind(`SELECT 'it''s?' , ?`); got != `SELECT 'it''s?' , $1` {
+		t.Fatalf("escaped quote rebind = %s", got)
+	}
+}
+
+func TestOf(t *testing.T) {
+	if got := Of(struct{}{}); got != SQLite {
+		t.Fatalf("Of(plain) = %v, want sqlite", got)
+	}
+	if got := Of(postgresThing{}); got != Postgres {
+		t.Fatalf("Of(postgres) = %v, want postgres", got)
+	}
+}
+
+type postgresThing struct{}
+
+func (postgresThing) Dialect() Dialect { return Postgres }
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+)
+
+// PostgresStore is the APIStore backed by PostgreSQL. Its schema comes from
+// migrations/postgres rather than the SQLite migration set.
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+// SQLDB exposes the underlying database handle for adapter composition.
+func (s *PostgresStore) SQLDB() *sql.DB {
+	if s == nil {
+		return nil
+	}
+	return s.DB
+}
+
+func (s *PostgresStore) Dialect() dialect.Dialect { return dialect.Postgres }
+
+// NewPostgresStore opens a pool for a libpq-style DSN or postgres:// URL.
+func NewPostgresStore(dataSourceName string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &PostgresStore{DB: db}, nil
+}
+
+const pgUniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
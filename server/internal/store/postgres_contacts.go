@@ -0,0 +1,246 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *PostgresStore) ListContacts(userID int) ([]User, error) {
+	rows, err := s.DB.Query(`
+		SELECT u.id, u.username, COALESCE(u.display_name, ''), COALESCE(u.avatar_url, '')
+		FROM users u
+		INNER JOIN contacts c ON u.id = c.contact_id
+		WHERE c.user_id = $1
+		ORDER BY COALESCE(u.display_name, u.username), u.username
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := make([]User, 0)
+	for rows.Next() {
+		var contact User
+		if err := rows.Scan(&contact.ID, &contact.Username, &contact.DisplayName, &contact.AvatarURL); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return contacts, nil
+}
+
+func (s *PostgresStore) AddContact(userID, contactID int) error {
+	if userID == contactID {
+		return errors.New("you cannot add yourself as a contact")
+	}
+	_, err := s.DB.Exec(`
+		INSERT INTO contacts (user_id, contact_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userID, contactID)
+	return err
+}
+
+func (s *PostgresStore) RemoveContact(userID, contactID int) error {
+	_, err := s.DB.Exec(`DELETE FROM contacts WHERE user_id = $1 AND contact_id = $2`, userID, contactID)
+	return err
+}
+
+// CreateInvite sends a pending invite that expires after InviteTTL. The
+// existing row for the pair, if any, is locked and sent again when it was
+// cancelled or has expired.
+func (s *PostgresStore) CreateInvite(inviterID, inviteeID int) error {
+	if inviterID == inviteeID {
+		return errors.New("you cannot invite yourself")
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var existingID int
+	var status string
+	var expiresAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, status, expires_at
+		FROM contact_invites
+		WHERE (requester_id = $1 AND recipient_id = $2) OR (requester_id = $2 AND recipient_id = $1)
+		FOR UPDATE
+	`, inviterID, inviteeID).Scan(&existingID, &status, &expiresAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.Exec(`
+			INSERT INTO contact_invites (requester_id, recipient_id, status, created_at, updated_at, expires_at)
+			VALUES ($1, $2, 'pending', $3, $3, $4)
+		`, inviterID, inviteeID, now, now.Add(InviteTTL))
+		if isUniqueViolation(err) {
+			return ErrInviteExists
+		}
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case !inviteReusable(status, expiresAt, now):
+		return ErrInviteExists
+	default:
+		if _, err := tx.Exec(`
+			UPDATE contact_invites
+			SET requester_id = $1, recipient_id = $2, status = 'pending',
+				created_at = $3, updated_at = $3, expires_at = $4
+			WHERE id = $5
+		`, inviterID, inviteeID, now, now.Add(InviteTTL), existingID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ListInvites(userID int) ([]Invite, error) {
+	rows, err := s.DB.Query(`
+		SELECT ci.id, ci.requester_id, u.username, ci.created_at, ci.expires_at
+		FROM contact_invites ci
+		INNER JOIN users u ON ci.requester_id = u.id
+		WHERE ci.recipient_id = $1 AND ci.status = 'pending'
+			AND (ci.expires_at IS NULL OR ci.expires_at > now())
+		ORDER BY ci.created_at DESC, ci.id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := make([]Invite, 0)
+	for rows.Next() {
+		var invite Invite
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&invite.ID, &invite.InviterID, &invite.InviterUsername, &invite.CreatedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		invite.ExpiresAt = expiresAt.Time
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+func (s *PostgresStore) ListOutgoingInvites(userID int) ([]OutgoingInvite, error) {
+	rows, err := s.DB.Query(`
+		SELECT ci.id, ci.recipient_id, u.username, ci.created_at, ci.expires_at
+		FROM contact_invites ci
+		INNER JOIN users u ON ci.recipient_id = u.id
+		WHERE ci.requester_id = $1 AND ci.status = 'pending'
+			AND (ci.expires_at IS NULL OR ci.expires_at > now())
+		ORDER BY ci.created_at DESC, ci.id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := make([]OutgoingInvite, 0)
+	for rows.Next() {
+		var invite OutgoingInvite
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&invite.ID, &invite.RecipientID, &invite.RecipientUsername, &invite.CreatedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		invite.ExpiresAt = expiresAt.Time
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+func (s *PostgresStore) CancelInvite(inviteID, requesterID int) error {
+	res, err := s.DB.Exec(`
+		UPDATE contact_invites
+		SET status = 'cancelled', updated_at = now()
+		WHERE id = $1 AND requester_id = $2 AND status = 'pending'
+	`, inviteID, requesterID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) ExpireInvites(now time.Time) (int, error) {
+	res, err := s.DB.Exec(`
+		UPDATE contact_invites
+		SET status = 'expired', updated_at = $1
+		WHERE status = 'pending' AND expires_at <= $1
+	`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// UpdateInviteStatus locks the invite row so two concurrent answers cannot
+// both see it pending.
+func (s *PostgresStore) UpdateInviteStatus(inviteID, userID int, status string) error {
+	if status != "accepted" && status != "rejected" {
+		return fmt.Errorf("unsupported status: %s", status)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inviterID int
+	row := tx.QueryRow(`
+		SELECT requester_id
+		FROM contact_invites
+		WHERE id = $1 AND recipient_id = $2 AND status = 'pending'
+			AND (expires_at IS NULL OR expires_at > now())
+		FOR UPDATE
+	`, inviteID, userID)
+	if err := row.Scan(&inviterID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE contact_invites
+		SET status = $1, updated_at = now()
+		WHERE id = $2
+	`, status, inviteID); err != nil {
+		return err
+	}
+
+	if status == "accepted" {
+		if _, err := tx.Exec(`
+			INSERT INTO contacts (user_id, contact_id)
+			VALUES ($1, $2), ($2, $1)
+			ON CONFLICT DO NOTHING
+		`, userID, inviterID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
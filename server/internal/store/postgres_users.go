@@ -0,0 +1,69 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/crypto"
+)
+
+func (s *PostgresStore) CreateUser(username, password string) (int, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return 0, errors.New("username is required")
+	}
+
+	hashedPassword, err := crypto.HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	if err := s.DB.QueryRow(`
+		INSERT INTO users (username, password_hash) VALUES ($1, $2)
+		RETURNING id
+	`, username, hashedPassword).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *PostgresStore) GetUserByUsername(username string) (*User, error) {
+	row := s.DB.QueryRow(`
+		SELECT id, username, COALESCE(display_name, ''), COALESCE(avatar_url, ''), password_hash
+		FROM users
+		WHERE username = $1
+	`, strings.TrimSpace(username))
+	return scanPostgresUser(row)
+}
+
+func (s *PostgresStore) GetUserByID(id int) (*User, error) {
+	row := s.DB.QueryRow(`
+		SELECT id, username, COALESCE(display_name, ''), COALESCE(avatar_url, ''), password_hash
+		FROM users
+		WHERE id = $1
+	`, id)
+	return scanPostgresUser(row)
+}
+
+func (s *PostgresStore) UpdateUserProfile(id int, displayName, avatarURL string) (*User, error) {
+	row := s.DB.QueryRow(`
+		UPDATE users
+		SET display_name = $1, avatar_url = $2
+		WHERE id = $3
+		RETURNING id, username, COALESCE(display_name, ''), COALESCE(avatar_url, ''), password_hash
+	`, strings.TrimSpace(displayName), strings.TrimSpace(avatarURL), id)
+	return scanPostgresUser(row)
+}
+
+func scanPostgresUser(row *sql.Row) (*User, error) {
+	user := &User{}
+	if err := row.Scan(&user.ID, &user.Username, &user.DisplayName, &user.AvatarURL, &user.PasswordHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
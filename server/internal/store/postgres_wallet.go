@@ -0,0 +1,153 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+func (s *PostgresStore) GetWallet(userID int) (*Wallet, error) {
+	if _, err := s.DB.Exec(`
+		INSERT INTO wallet_accounts (user_id) VALUES ($1)
+		ON CONFLICT (user_id) DO NOTHING
+	`, userID); err != nil {
+		return nil, err
+	}
+
+	var wallet Wallet
+	err := s.DB.QueryRow(`
+		SELECT id, user_id, balance_cents
+		FROM wallet_accounts
+		WHERE user_id = $1
+	`, userID).Scan(&wallet.ID, &wallet.UserID, &wallet.BalanceCents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+func (s *PostgresStore) ListTransfers(userID, limit int) ([]WalletTransfer, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT
+			wt.id,
+			CASE WHEN wt.sender_user_id = $1 THEN 'sent' ELSE 'received' END AS direction,
+			u.id,
+			u.username,
+			COALESCE(u.display_name, ''),
+			COALESCE(u.avatar_url, ''),
+			wt.amount_cents,
+			wt.created_at
+		FROM wallet_transfers wt
+		INNER JOIN users u
+			ON u.id = CASE WHEN wt.sender_user_id = $1 THEN wt.recipient_user_id ELSE wt.sender_user_id END
+		WHERE wt.sender_user_id = $1 OR wt.recipient_user_id = $1
+		ORDER BY wt.created_at DESC, wt.id DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := make([]WalletTransfer, 0)
+	for rows.Next() {
+		var transfer WalletTransfer
+		if err := rows.Scan(
+			&transfer.ID,
+			&transfer.Direction,
+			&transfer.CounterpartyUserID,
+			&transfer.CounterpartyUsername,
+			&transfer.CounterpartyDisplayName,
+			&transfer.CounterpartyAvatarURL,
+			&transfer.AmountCents,
+			&transfer.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// SendMoney locks both accounts in user ID order before reading the sender's
+// balance. SQLite gets this for free from its single writer; under Postgres
+// two concurrent transfers would otherwise both pass the balance check.
+func (s *PostgresStore) SendMoney(senderID, recipientID int, amountCents int64) error {
+	if senderID == recipientID {
+		return errors.New("cannot transfer to yourself")
+	}
+	if amountCents <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO wallet_accounts (user_id) VALUES ($1), ($2)
+		ON CONFLICT (user_id) DO NOTHING
+	`, senderID, recipientID); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT user_id, balance_cents
+		FROM wallet_accounts
+		WHERE user_id IN ($1, $2)
+		ORDER BY user_id
+		FOR UPDATE
+	`, senderID, recipientID)
+	if err != nil {
+		return err
+	}
+	var senderBalance int64
+	for rows.Next() {
+		var userID int
+		var balance int64
+		if err := rows.Scan(&userID, &balance); err != nil {
+			rows.Close()
+			return err
+		}
+		if userID == senderID {
+			senderBalance = balance
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	if senderBalance < amountCents {
+		return ErrInsufficientFund
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE wallet_accounts
+		SET balance_cents = balance_cents + CASE WHEN user_id = $1 THEN -$3::BIGINT ELSE $3::BIGINT END,
+			updated_at = now()
+		WHERE user_id IN ($1, $2)
+	`, senderID, recipientID, amountCents); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO wallet_transfers (sender_user_id, recipient_user_id, amount_cents)
+		VALUES ($1, $2, $3)
+	`, senderID, recipientID, amountCents); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
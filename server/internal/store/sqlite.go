@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"strings"
+	"time"
 
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -26,6 +28,8 @@ func (s *SqliteStore) SQLDB() *sql.DB {
 	return s.DB
 }
 
+func (s *SqliteStore) Dialect() dialect.Dialect { return dialect.SQLite }
+
 type User struct {
 	ID           int    `json:"id"`
 	Username     string `json:"username"`
@@ -35,12 +39,28 @@ type User struct {
 }
 
 type Invite struct {
-	ID              int    `json:"id"`
-	InviterUsername string `json:"inviter_username"`
+	ID              int       `json:"id"`
+	InviterID       int       `json:"-"`
+	InviterUsername string    `json:"inviter_username"`
+	CreatedAt       time.Time `json:"created_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+// OutgoingInvite is a pending invite seen by the user who sent it.
+type OutgoingInvite struct {
+	ID                int       `json:"id"`
+	RecipientID       int       `json:"-"`
+	RecipientUsername string    `json:"recipient_username"`
+	CreatedAt         time.Time `json:"created_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
 }
 
+// InviteTTL is how long a contact invite stays pending before the
+// invite_expiry job marks it expired.
+const InviteTTL = 14 * 24 * time.Hour
+
 func NewSqliteStore(dataSourceName string) (*SqliteStore, error) {
-	db, err := sql.Open("sqlite3", dataSourceName)
+	db, err := sql.Open("sqlite3", withForeignKeys(dataSourceName))
 	if err != nil {
 		return nil, err
 	}
@@ -52,10 +72,6 @@ func NewSqliteStore(dataSourceName string) (*SqliteStore, error) {
 		db.SetMaxIdleConns(1)
 	}
 
-	if _, err := db.Exec("PRAGMA foreign_keys = ON;"); err != nil {
-		return nil, err
-	}
-
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
@@ -63,6 +79,20 @@ func NewSqliteStore(dataSourceName string) (*SqliteStore, error) {
 	return &SqliteStore{DB: db}, nil
 }
 
+// withForeignKeys asks go-sqlite3 to enable foreign keys on every connection
+// it opens. A PRAGMA run through the pool only reaches one connection, so
+// ON DELETE CASCADE and REFERENCES checks would depend on which one a query
+// happened to get.
+func withForeignKeys(dataSourceName string) string {
+	if strings.Contains(dataSourceName, "_foreign_keys=") || strings.Contains(dataSourceName, "_fk=") {
+		return dataSourceName
+	}
+	if strings.Contains(dataSourceName, "?") {
+		return dataSourceName + "&_foreign_keys=on"
+	}
+	return dataSourceName + "?_foreign_keys=on"
+}
+
 func isInMemorySQLiteDSN(dataSourceName string) bool {
 	trimmed := strings.TrimSpace(dataSourceName)
 	if trimmed == ":memory:" {
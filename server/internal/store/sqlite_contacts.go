@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 func (s *SqliteStore) ListContacts(userID int) ([]User, error) {
@@ -48,32 +49,81 @@ func (s *SqliteStore) RemoveContact(userID, contactID int) error {
 	return err
 }
 
+// CreateInvite sends a pending invite that expires after InviteTTL. A pair
+// of users has at most one invite row, so an earlier invite between them
+// that was cancelled or expired is sent again rather than duplicated.
 func (s *SqliteStore) CreateInvite(inviterID, inviteeID int) error {
 	if inviterID == inviteeID {
 		return errors.New("you cannot invite yourself")
 	}
 
-	_, err := s.DB.Exec(`
-		INSERT INTO contact_invites (requester_id, recipient_id, status)
-		VALUES (?, ?, 'pending')
-	`, inviterID, inviteeID)
+	tx, err := s.DB.Begin()
 	if err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "unique") {
-			return ErrInviteExists
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var existingID int
+	var status string
+	var expiresAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, status, expires_at
+		FROM contact_invites
+		WHERE (requester_id = ? AND recipient_id = ?) OR (requester_id = ? AND recipient_id = ?)
+	`, inviterID, inviteeID, inviteeID, inviterID).Scan(&existingID, &status, &expiresAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.Exec(`
+			INSERT INTO contact_invites (requester_id, recipient_id, status, created_at, updated_at, expires_at)
+			VALUES (?, ?, 'pending', ?, ?, ?)
+		`, inviterID, inviteeID, now, now, now.Add(InviteTTL))
+		if err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				return ErrInviteExists
+			}
+			return err
 		}
+	case err != nil:
 		return err
+	case !inviteReusable(status, expiresAt, now):
+		return ErrInviteExists
+	default:
+		if _, err := tx.Exec(`
+			UPDATE contact_invites
+			SET requester_id = ?, recipient_id = ?, status = 'pending',
+				created_at = ?, updated_at = ?, expires_at = ?
+			WHERE id = ?
+		`, inviterID, inviteeID, now, now, now.Add(InviteTTL), existingID); err != nil {
+			return err
+		}
 	}
-	return nil
+	return tx.Commit()
 }
 
+// inviteReusable reports whether an existing invite row no longer blocks a
+// new invite between the same users.
+func inviteReusable(status string, expiresAt sql.NullTime, now time.Time) bool {
+	switch status {
+	case "cancelled", "expired":
+		return true
+	case "pending":
+		return expiresAt.Valid && !expiresAt.Time.After(now)
+	}
+	return false
+}
+
+// ListInvites returns the pending invites sent to userID that have not
+// expired, newest first.
 func (s *SqliteStore) ListInvites(userID int) ([]Invite, error) {
 	rows, err := s.DB.Query(`
-		SELECT ci.id, u.username
+		SELECT ci.id, ci.requester_id, u.username, ci.created_at, ci.expires_at
 		FROM contact_invites ci
 		INNER JOIN users u ON ci.requester_id = u.id
 		WHERE ci.recipient_id = ? AND ci.status = 'pending'
-		ORDER BY ci.created_at DESC
-	`, userID)
+			AND (ci.expires_at IS NULL OR ci.expires_at > ?)
+		ORDER BY ci.created_at DESC, ci.id DESC
+	`, userID, time.Now().UTC())
 	if err != nil {
 		return nil, err
 	}
@@ -82,9 +132,11 @@ func (s *SqliteStore) ListInvites(userID int) ([]Invite, error) {
 	invites := make([]Invite, 0)
 	for rows.Next() {
 		var invite Invite
-		if err := rows.Scan(&invite.ID, &invite.InviterUsername); err != nil {
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&invite.ID, &invite.InviterID, &invite.InviterUsername, &invite.CreatedAt, &expiresAt); err != nil {
 			return nil, err
 		}
+		invite.ExpiresAt = expiresAt.Time
 		invites = append(invites, invite)
 	}
 	if err := rows.Err(); err != nil {
@@ -93,6 +145,74 @@ func (s *SqliteStore) ListInvites(userID int) ([]Invite, error) {
 	return invites, nil
 }
 
+// ListOutgoingInvites returns the pending invites userID sent that have not
+// expired, newest first.
+func (s *SqliteStore) ListOutgoingInvites(userID int) ([]OutgoingInvite, error) {
+	rows, err := s.DB.Query(`
+		SELECT ci.id, ci.recipient_id, u.username, ci.created_at, ci.expires_at
+		FROM contact_invites ci
+		INNER JOIN users u ON ci.recipient_id = u.id
+		WHERE ci.requester_id = ? AND ci.status = 'pending'
+			AND (ci.expires_at IS NULL OR ci.expires_at > ?)
+		ORDER BY ci.created_at DESC, ci.id DESC
+	`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := make([]OutgoingInvite, 0)
+	for rows.Next() {
+		var invite OutgoingInvite
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&invite.ID, &invite.RecipientID, &invite.RecipientUsername, &invite.CreatedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		invite.ExpiresAt = expiresAt.Time
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// CancelInvite withdraws a pending invite. Only the user who sent it can
+// cancel it; anything else is ErrNotFound.
+func (s *SqliteStore) CancelInvite(inviteID, requesterID int) error {
+	res, err := s.DB.Exec(`
+		UPDATE contact_invites
+		SET status = 'cancelled', updated_at = ?
+		WHERE id = ? AND requester_id = ? AND status = 'pending'
+	`, time.Now().UTC(), inviteID, requesterID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ExpireInvites marks pending invites whose expires_at has passed as
+// expired and returns how many it changed.
+func (s *SqliteStore) ExpireInvites(now time.Time) (int, error) {
+	res, err := s.DB.Exec(`
+		UPDATE contact_invites
+		SET status = 'expired', updated_at = ?
+		WHERE status = 'pending' AND expires_at <= ?
+	`, now.UTC(), now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
 func (s *SqliteStore) UpdateInviteStatus(inviteID, userID int, status string) error {
 	if status != "accepted" && status != "rejected" {
 		return fmt.Errorf("unsupported status: %s", status)
@@ -109,7 +229,8 @@ func (s *SqliteStore) UpdateInviteStatus(inviteID, userID int, status string) er
 		SELECT requester_id
 		FROM contact_invites
 		WHERE id = ? AND recipient_id = ? AND status = 'pending'
-	`, inviteID, userID)
+			AND (expires_at IS NULL OR expires_at > ?)
+	`, inviteID, userID, time.Now().UTC())
 
 	if err := row.Scan(&inviterID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
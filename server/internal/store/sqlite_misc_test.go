@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
 
@@ -32,6 +33,31 @@ func TestNewSqliteStore_InMemoryUsesSingleConnection(t *testing.T) {
 	}
 }
 
+func TestNewSqliteStore_EnablesForeignKeysOnEveryConnection(t *testing.T) {
+	s, err := NewSqliteStore(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		conn, err := s.DB.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Held open so the next iteration gets a fresh pool connection.
+		defer conn.Close()
+		var enabled int
+		if err := conn.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&enabled); err != nil {
+			t.Fatal(err)
+		}
+		if enabled != 1 {
+			t.Fatalf("connection %d: foreign_keys = %d, want 1", i, enabled)
+		}
+	}
+}
+
 func TestCreateUser_RejectsBlankUsername(t *testing.T) {
 	s := newStoreForTest(t)
 	if _, err := s.CreateUser("   ", "password123"); err == nil {
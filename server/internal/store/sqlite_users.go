@@ -36,7 +36,7 @@ func (s *SqliteStore) GetUserByUsername(username string) (*User, error) {
 	row := s.DB.QueryRow(`
 		SELECT id, username, COALESCE(display_name, ''), COALESCE(avatar_url, ''), password_hash
 		FROM users
-		WHERE username = ?
+		WHERE username = ? AND deleted_at IS NULL
 	`, strings.TrimSpace(username))
 
 	user := &User{}
@@ -0,0 +1,323 @@
+package storetest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+)
+
+// RunAPIStoreContract checks the store.APIStore behaviour handlers and the
+// core adapters rely on.
+func RunAPIStoreContract(t *testing.T, open Opener) {
+	t.Run("users", func(t *testing.T) {
+		b := open(t)
+		s := b.Store
+		if _, err := s.CreateUser("   ", "password123"); err == nil {
+			t.Fatal("expected username validation error")
+		}
+		id, err := s.CreateUser(" alice ", "password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.CreateUser("alice", "password123"); err == nil {
+			t.Fatal("expected duplicate username error")
+		}
+
+		byName, err := s.GetUserByUsername("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if byName.ID != id || byName.PasswordHash == "" || byName.PasswordHash == "password123" {
+			t.Fatalf("user by name = %+v", byName)
+		}
+		if _, err := s.GetUserByUsername("missing"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("missing user error = %v, want ErrNotFound", err)
+		}
+		if _, err := s.GetUserByID(id + 1000); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("missing id error = %v, want ErrNotFound", err)
+		}
+
+		updated, err := s.UpdateUserProfile(id, " Alice A. ", " https://example.com/a.png ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.DisplayName != "Alice A." || updated.AvatarURL != "https://example.com/a.png" || updated.Username != "alice" {
+			t.Fatalf("updated profile = %+v", updated)
+		}
+		if _, err := s.UpdateUserProfile(id+1000, "x", ""); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("update missing error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("contacts and invites", func(t *testing.T) {
+		b := open(t)
+		s := b.Store
+		alice := seedStoreUser(t, s, "alice")
+		bob := seedStoreUser(t, s, "bob")
+		carol := seedStoreUser(t, s, "carol")
+
+		if err := s.CreateInvite(alice, alice); err == nil {
+			t.Fatal("expected self invite error")
+		}
+		if err := s.CreateInvite(alice, bob); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CreateInvite(bob, alice); !errors.Is(err, store.ErrInviteExists) {
+			t.Fatalf("reverse invite error = %v, want ErrInviteExists", err)
+		}
+		if err := s.CreateInvite(carol, bob); err != nil {
+			t.Fatal(err)
+		}
+
+		invites, err := s.ListInvites(bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(invites) != 2 {
+			t.Fatalf("invites = %+v, want 2", invites)
+		}
+		var fromAlice store.Invite
+		for _, invite := range invites {
+			if invite.InviterID == alice {
+				fromAlice = invite
+			}
+		}
+		if fromAlice.InviterUsername != "alice" {
+			t.Fatalf("invites = %+v", invites)
+		}
+
+		if err := s.UpdateInviteStatus(fromAlice.ID, alice, "accepted"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("accept by inviter error = %v, want ErrNotFound", err)
+		}
+		if err := s.UpdateInviteStatus(fromAlice.ID, bob, "maybe"); err == nil {
+			t.Fatal("expected unsupported status error")
+		}
+		if err := s.UpdateInviteStatus(fromAlice.ID, bob, "accepted"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpdateInviteStatus(fromAlice.ID, bob, "accepted"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("second accept error = %v, want ErrNotFound", err)
+		}
+		for _, pair := range [][2]int{{alice, bob}, {bob, alice}} {
+			contacts, err := s.ListContacts(pair[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(contacts) != 1 || contacts[0].ID != pair[1] {
+				t.Fatalf("contacts of %d = %+v", pair[0], contacts)
+			}
+		}
+
+		if err := s.AddContact(alice, alice); err == nil {
+			t.Fatal("expected self contact error")
+		}
+		if err := s.AddContact(alice, carol); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddContact(alice, carol); err != nil {
+			t.Fatalf("repeat AddContact error = %v, want nil", err)
+		}
+		if err := s.RemoveContact(alice, bob); err != nil {
+			t.Fatal(err)
+		}
+		contacts, err := s.ListContacts(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(contacts) != 1 || contacts[0].Username != "carol" {
+			t.Fatalf("contacts after remove = %+v", contacts)
+		}
+	})
+
+	t.Run("invite cancel and expiry", func(t *testing.T) {
+		b := open(t)
+		s := b.Store
+		alice := seedStoreUser(t, s, "alice")
+		bob := seedStoreUser(t, s, "bob")
+		carol := seedStoreUser(t, s, "carol")
+
+		if err := s.CreateInvite(alice, bob); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CreateInvite(alice, carol); err != nil {
+			t.Fatal(err)
+		}
+		outgoing, err := s.ListOutgoingInvites(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outgoing) != 2 || outgoing[0].ExpiresAt.Sub(outgoing[0].CreatedAt) != store.InviteTTL {
+			t.Fatalf("outgoing = %+v", outgoing)
+		}
+		var toBob store.OutgoingInvite
+		for _, invite := range outgoing {
+			if invite.RecipientID == bob {
+				toBob = invite
+			}
+		}
+		if toBob.RecipientUsername != "bob" {
+			t.Fatalf("outgoing = %+v", outgoing)
+		}
+
+		if err := s.CancelInvite(toBob.ID, bob); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("cancel by recipient error = %v, want ErrNotFound", err)
+		}
+		if err := s.CancelInvite(toBob.ID, alice); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CancelInvite(toBob.ID, alice); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("second cancel error = %v, want ErrNotFound", err)
+		}
+		if invites, _ := s.ListInvites(bob); len(invites) != 0 {
+			t.Fatalf("bob still sees a cancelled invite: %+v", invites)
+		}
+		if err := s.UpdateInviteStatus(toBob.ID, bob, "accepted"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("accept cancelled error = %v, want ErrNotFound", err)
+		}
+		if err := s.CreateInvite(bob, alice); err != nil {
+			t.Fatalf("invite after cancel error = %v, want nil", err)
+		}
+		if invites, _ := s.ListInvites(alice); len(invites) != 1 || invites[0].InviterID != bob {
+			t.Fatalf("reused invite = %+v", invites)
+		}
+
+		past := time.Now().UTC().Add(-time.Hour)
+		b.Exec(t, `UPDATE contact_invites SET expires_at = ? WHERE recipient_id = ?`, past, carol)
+		if invites, _ := s.ListInvites(carol); len(invites) != 0 {
+			t.Fatalf("carol sees an expired invite: %+v", invites)
+		}
+		n, err := s.ExpireInvites(time.Now())
+		if err != nil || n != 1 {
+			t.Fatalf("ExpireInvites = %d, %v; want 1", n, err)
+		}
+		if n, _ := s.ExpireInvites(time.Now()); n != 0 {
+			t.Fatalf("second ExpireInvites = %d, want 0", n)
+		}
+		if err := s.CreateInvite(carol, alice); err != nil {
+			t.Fatalf("invite after expiry error = %v, want nil", err)
+		}
+		if err := s.UpdateInviteStatus(toBob.ID, alice, "rejected"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CreateInvite(alice, bob); !errors.Is(err, store.ErrInviteExists) {
+			t.Fatalf("invite after reject error = %v, want ErrInviteExists", err)
+		}
+	})
+
+	t.Run("wallet", func(t *testing.T) {
+		b := open(t)
+		s := b.Store
+		alice := seedStoreUser(t, s, "alice")
+		bob := seedStoreUser(t, s, "bob")
+
+		wallet, err := s.GetWallet(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wallet.UserID != alice || wallet.BalanceCents != 0 {
+			t.Fatalf("new wallet = %+v", wallet)
+		}
+		b.Exec(t, `UPDATE wallet_accounts SET balance_cents = ? WHERE user_id = ?`, 1_000, alice)
+
+		if err := s.SendMoney(alice, alice, 100); err == nil {
+			t.Fatal("expected self transfer error")
+		}
+		if err := s.SendMoney(alice, bob, 0); err == nil {
+			t.Fatal("expected zero amount error")
+		}
+		if err := s.SendMoney(alice, bob, 1_001); !errors.Is(err, store.ErrInsufficientFund) {
+			t.Fatalf("overdraw error = %v, want ErrInsufficientFund", err)
+		}
+		if err := s.SendMoney(alice, bob, 250); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SendMoney(bob, alice, 50); err != nil {
+			t.Fatal(err)
+		}
+		assertBalance(t, s, alice, 800)
+		assertBalance(t, s, bob, 200)
+
+		transfers, err := s.ListTransfers(alice, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transfers) != 2 {
+			t.Fatalf("transfers = %+v, want 2", transfers)
+		}
+		directions := map[string]int64{}
+		for _, transfer := range transfers {
+			if transfer.CounterpartyUserID != bob || transfer.CounterpartyUsername != "bob" || transfer.CreatedAt.IsZero() {
+				t.Fatalf("transfer = %+v", transfer)
+			}
+			directions[transfer.Direction] = transfer.AmountCents
+		}
+		if directions["sent"] != 250 || directions["received"] != 50 {
+			t.Fatalf("directions = %v", directions)
+		}
+		if limited, err := s.ListTransfers(alice, 1); err != nil || len(limited) != 1 {
+			t.Fatalf("limited transfers = %+v, err = %v", limited, err)
+		}
+	})
+
+	// Concurrent transfers must never overdraw: SQLite serialises writers,
+	// and other backends have to lock the accounts they read.
+	t.Run("concurrent transfers", func(t *testing.T) {
+		b := open(t)
+		s := b.Store
+		alice := seedStoreUser(t, s, "alice")
+		bob := seedStoreUser(t, s, "bob")
+		if _, err := s.GetWallet(alice); err != nil {
+			t.Fatal(err)
+		}
+		b.Exec(t, `UPDATE wallet_accounts SET balance_cents = ? WHERE user_id = ?`, 500, alice)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		succeeded := 0
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.SendMoney(alice, bob, 100)
+				if err != nil && !errors.Is(err, store.ErrInsufficientFund) {
+					t.Errorf("SendMoney error: %v", err)
+					return
+				}
+				if err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if succeeded != 5 {
+			t.Fatalf("succeeded transfers = %d, want 5", succeeded)
+		}
+		assertBalance(t, s, alice, 0)
+		assertBalance(t, s, bob, 500)
+	})
+}
+
+func seedStoreUser(t testing.TB, s store.APIStore, username string) int {
+	t.Helper()
+	id, err := s.CreateUser(username, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func assertBalance(t testing.TB, s store.APIStore, userID int, want int64) {
+	t.Helper()
+	wallet, err := s.GetWallet(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.BalanceCents != want {
+		t.Fatalf("balance of %d = %d, want %d", userID, wallet.BalanceCents, want)
+	}
+}
@@ -0,0 +1,257 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	coremsg "github.com/kyambuthia/go-chat-site/server/internal/core/messaging"
+)
+
+// MessagingRepository is everything a backend's messaging adapter provides.
+type MessagingRepository interface {
+	coremsg.MessageRepository
+	coremsg.ClientMessageCorrelationRecorder
+	coremsg.ThreadSummaryRepository
+}
+
+// RunMessagingContract checks a messaging adapter built by newRepo over a
+// backend opened by open.
+func RunMessagingContract(t *testing.T, open Opener, newRepo func(Backend) MessagingRepository) {
+	ctx := context.Background()
+	setup := func(t *testing.T) (MessagingRepository, int, int, int) {
+		b := open(t)
+		return newRepo(b), seedStoreUser(t, b.Store, "alice"), seedStoreUser(t, b.Store, "bob"), seedStoreUser(t, b.Store, "carol")
+	}
+	send := func(t *testing.T, repo MessagingRepository, msg coremsg.StoredMessage) coremsg.StoredMessage {
+		t.Helper()
+		saved, err := repo.SaveDirectMessage(ctx, msg)
+		if err != nil {
+			t.Fatalf("SaveDirectMessage error: %v", err)
+		}
+		return saved
+	}
+
+	t.Run("save and envelope metadata", func(t *testing.T) {
+		t.Setenv("MESSAGING_STORE_PLAINTEXT_WHEN_ENCRYPTED", "false")
+		repo, alice, bob, _ := setup(t)
+		plain := send(t, repo, coremsg.StoredMessage{FromUserID: alice, ToUserID: bob, Body: "hello"})
+		if plain.ID == 0 || plain.ContentKind != "text" || plain.CreatedAt.IsZero() || plain.DeliveredAt != nil {
+			t.Fatalf("saved = %+v", plain)
+		}
+		encrypted := send(t, repo, coremsg.StoredMessage{
+			FromUserID: alice, ToUserID: bob, Body: "leak", ContentKind: "text",
+			Ciphertext: "opaque-envelope", EnvelopeVersion: "x3dh-dr-v1", SenderDeviceID: 101, RecipientDeviceID: 202,
+		})
+		if encrypted.Body != "" {
+			t.Fatalf("encrypted body = %q, want empty", encrypted.Body)
+		}
+
+		got, err := repo.GetMessageForRecipient(ctx, bob, encrypted.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Ciphertext != "opaque-envelope" || got.EnvelopeVersion != "x3dh-dr-v1" || got.SenderDeviceID != 101 || got.RecipientDeviceID != 202 {
+			t.Fatalf("envelope = %+v", got)
+		}
+		if _, err := repo.GetMessageForRecipient(ctx, alice, encrypted.ID); !errors.Is(err, coremsg.ErrMessageNotFound) {
+			t.Fatalf("sender read error = %v, want ErrMessageNotFound", err)
+		}
+	})
+
+	t.Run("receipts", func(t *testing.T) {
+		repo, alice, bob, carol := setup(t)
+		first := send(t, repo, coremsg.StoredMessage{FromUserID: alice, ToUserID: bob, Body: "one"})
+		second := send(t, repo, coremsg.StoredMessage{FromUserID: alice, ToUserID: bob, Body: "two"})
+
+		if err := repo.MarkDeliveredForRecipient(ctx, carol, first.ID, time.Now()); !errors.Is(err, coremsg.ErrMessageNotFound) {
+			t.Fatalf("wrong recipient delivered error = %v", err)
+		}
+		if err := repo.MarkReadForRecipient(ctx, carol, first.ID, time.Now()); !errors.Is(err, coremsg.ErrMessageNotFound) {
+			t.Fatalf("wrong recipient read error = %v", err)
+		}
+
+		deliveredAt := time.Now().UTC().Truncate(time.Second)
+		if err := repo.MarkDeliveredForRecipient(ctx, bob, first.ID, deliveredAt); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.MarkDelivered(ctx, first.ID, deliveredAt.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.MarkReadForRecipient(ctx, bob, first.ID, deliveredAt.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		// Reading without a delivery receipt implies delivery.
+		if err := repo.MarkRead(ctx, second.ID, deliveredAt); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.GetMessageForRecipient(ctx, bob, first.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.DeliveredAt == nil || !got.DeliveredAt.Equal(deliveredAt) || got.ReadAt == nil || !got.ReadAt.Equal(deliveredAt.Add(time.Minute)) {
+			t.Fatalf("first receipts = delivered %v read %v", got.DeliveredAt, got.ReadAt)
+		}
+		got, err = repo.GetMessageForRecipient(ctx, bob, second.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.DeliveredAt == nil || got.ReadAt == nil {
+			t.Fatalf("second receipts = delivered %v read %v", got.DeliveredAt, got.ReadAt)
+		}
+	})
+
+	t.Run("inbox pagination and filters", func(t *testing.T) {
+		repo, alice, bob, carol := setup(t)
+		var ids []int64
+		for i, from := range []int{alice, carol, alice, carol, alice} {
+			ids = append(ids, send(t, repo, coremsg.StoredMessage{FromUserID: from, ToUserID: bob, Body: string(rune('a' + i))}).ID)
+		}
+		if err := repo.MarkRead(ctx, ids[0], time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		send(t, repo, coremsg.StoredMessage{
+			FromUserID: alice, ToUserID: bob, ContentKind: "payment_request_update",
+			Body: `__microapp_v1__:{"kind":"payment_request_update","requestId":"payreq_1","status":"paid"}`,
+		})
+
+		check := func(name string, got []coremsg.StoredMessage, err error, want ...int64) {
+			t.Helper()
+			if err != nil {
+				t.Fatalf("%s error: %v", name, err)
+			}
+			gotIDs := make([]int64, 0, len(got))
+			for _, msg := range got {
+				gotIDs = append(gotIDs, msg.ID)
+			}
+			if len(gotIDs) != len(want) {
+				t.Fatalf("%s = %v, want %v", name, gotIDs, want)
+			}
+			for i := range want {
+				if gotIDs[i] != want[i] {
+					t.Fatalf("%s = %v, want %v", name, gotIDs, want)
+				}
+			}
+		}
+
+		all, err := repo.ListInbox(ctx, bob, 10)
+		if err != nil || len(all) != 6 {
+			t.Fatalf("inbox len = %d, err = %v", len(all), err)
+		}
+		got, err := repo.ListInboxBefore(ctx, bob, ids[3], 2)
+		check("before", got, err, ids[2], ids[1])
+		got, err = repo.ListInboxAfter(ctx, bob, ids[1], 2)
+		check("after", got, err, ids[2], ids[3])
+		got, err = repo.ListInboxWithUser(ctx, bob, carol, 10)
+		check("with carol", got, err, ids[3], ids[1])
+		got, err = repo.ListUnreadInboxWithUser(ctx, bob, alice, 10)
+		check("unread with alice", got, err, ids[4], ids[2])
+		got, err = repo.ListUnreadInbox(ctx, bob, 10)
+		check("unread", got, err, ids[4], ids[3], ids[2], ids[1])
+		got, err = repo.ListUnreadInboxBefore(ctx, bob, ids[3], 10)
+		check("unread before", got, err, ids[2], ids[1])
+		got, err = repo.ListUnreadInboxBeforeWithUser(ctx, bob, alice, ids[4], 10)
+		check("unread before with alice", got, err, ids[2])
+		got, err = repo.ListUnreadInboxAfter(ctx, bob, ids[2], 10)
+		check("unread after", got, err, ids[3], ids[4])
+		got, err = repo.ListUnreadInboxAfterWithUser(ctx, bob, carol, ids[0], 10)
+		check("unread after with carol", got, err, ids[1], ids[3])
+		got, err = repo.ListInboxBeforeWithUser(ctx, bob, alice, ids[4], 1)
+		check("before with alice", got, err, ids[2])
+		got, err = repo.ListInboxAfterWithUser(ctx, bob, alice, ids[0], 10)
+		if err != nil || len(got) != 3 || got[0].ID != ids[2] || got[1].ID != ids[4] {
+			t.Fatalf("after with alice = %+v, err = %v", got, err)
+		}
+	})
+
+	t.Run("outbox and client correlations", func(t *testing.T) {
+		repo, alice, bob, _ := setup(t)
+		first := send(t, repo, coremsg.StoredMessage{FromUserID: alice, ToUserID: bob, Body: "one"})
+		second := send(t, repo, coremsg.StoredMessage{FromUserID: alice, ToUserID: bob, Body: "two"})
+		third := send(t, repo, coremsg.StoredMessage{FromUserID: alice, ToUserID: bob, Body: "three"})
+
+		record := func(clientID, storedID int64, delivered bool) {
+			t.Helper()
+			if err := repo.RecordClientMessageCorrelation(ctx, coremsg.ClientMessageCorrelation{
+				SenderUserID: alice, RecipientUserID: bob, ClientMessageID: clientID, StoredMessageID: storedID, Delivered: delivered,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		record(7, first.ID, true)
+		record(8, first.ID, false)
+		// The same client ID again moves the correlation to the new message.
+		record(8, second.ID, false)
+
+		outbox, err := repo.ListOutbox(ctx, alice, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outbox) != 3 || outbox[0].ID != third.ID || outbox[2].ID != first.ID {
+			t.Fatalf("outbox = %+v", outbox)
+		}
+		if outbox[1].ClientMessageID != 8 || !outbox[1].DeliveryFailed {
+			t.Fatalf("undelivered outbox message = %+v", outbox[1])
+		}
+		if outbox[2].ClientMessageID != 7 || outbox[2].DeliveryFailed || outbox[0].ClientMessageID != 0 || outbox[0].DeliveryFailed {
+			t.Fatalf("outbox correlations = %+v", outbox)
+		}
+
+		// A later delivery receipt clears the failure.
+		if err := repo.MarkDelivered(ctx, second.ID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		page, err := repo.ListOutboxBefore(ctx, alice, third.ID, 1)
+		if err != nil || len(page) != 1 || page[0].ID != second.ID || page[0].DeliveryFailed {
+			t.Fatalf("outbox before = %+v, err = %v", page, err)
+		}
+		page, err = repo.ListOutboxAfter(ctx, alice, first.ID, 10)
+		if err != nil || len(page) != 2 || page[0].ID != second.ID || page[1].ID != third.ID {
+			t.Fatalf("outbox after = %+v, err = %v", page, err)
+		}
+		if inbox, err := repo.ListOutbox(ctx, bob, 10); err != nil || len(inbox) != 0 {
+			t.Fatalf("recipient outbox = %+v, err = %v", inbox, err)
+		}
+	})
+
+	t.Run("thread summaries", func(t *testing.T) {
+		repo, alice, bob, carol := setup(t)
+		fromBob := send(t, repo, coremsg.StoredMessage{FromUserID: bob, ToUserID: alice, Body: "hi alice"})
+		send(t, repo, coremsg.StoredMessage{FromUserID: bob, ToUserID: alice, Body: "still there?"})
+		reply := send(t, repo, coremsg.StoredMessage{FromUserID: alice, ToUserID: bob, Body: "yes"})
+		send(t, repo, coremsg.StoredMessage{
+			FromUserID: bob, ToUserID: alice, ContentKind: "payment_request_update",
+			Body: `__microapp_v1__:{"kind":"payment_request_update","requestId":"payreq_1","status":"paid"}`,
+		})
+		fromCarol := send(t, repo, coremsg.StoredMessage{
+			FromUserID: carol, ToUserID: alice, ContentKind: "text", Ciphertext: "opaque", EnvelopeVersion: "v1",
+		})
+		if err := repo.MarkRead(ctx, fromBob.ID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		summaries, err := repo.ListThreadSummaries(ctx, alice, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(summaries) != 2 {
+			t.Fatalf("summaries = %+v", summaries)
+		}
+		carolThread, bobThread := summaries[0], summaries[1]
+		if carolThread.CounterpartyUsername != "carol" || carolThread.LastMessageID != fromCarol.ID ||
+			!carolThread.LastMessageEncrypted || carolThread.UnreadCount != 1 {
+			t.Fatalf("carol thread = %+v", carolThread)
+		}
+		if bobThread.CounterpartyUserID != bob || bobThread.LastMessageID != reply.ID || bobThread.LastMessageBody != "yes" ||
+			bobThread.LastMessageEncrypted || bobThread.LastMessageContentKind != "text" || bobThread.UnreadCount != 1 {
+			t.Fatalf("bob thread = %+v", bobThread)
+		}
+
+		limited, err := repo.ListThreadSummaries(ctx, alice, 1)
+		if err != nil || len(limited) != 1 || limited[0].CounterpartyUserID != carol {
+			t.Fatalf("limited summaries = %+v, err = %v", limited, err)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/auth"
+	coreid "github.com/kyambuthia/go-chat-site/server/internal/core/identity"
+)
+
+// SessionStore is the session half of the token adapter.
+type SessionStore interface {
+	coreid.TokenService
+	coreid.SessionRevoker
+}
+
+// RunSessionContract checks login sessions, refresh rotation and revocation
+// for a token adapter built by newTokens over a backend opened by open.
+func RunSessionContract(t *testing.T, open Opener, newTokens func(Backend) SessionStore) {
+	ctx := context.Background()
+	if err := auth.ConfigureJWT("session-contract-secret"); err != nil {
+		t.Fatal(err)
+	}
+	setup := func(t *testing.T) (SessionStore, coreid.Principal) {
+		b := open(t)
+		id := seedStoreUser(t, b.Store, "alice")
+		return newTokens(b), coreid.Principal{ID: coreid.UserID(id), Username: "alice"}
+	}
+
+	t.Run("issue validate list revoke", func(t *testing.T) {
+		tokens, alice := setup(t)
+		issued, err := tokens.IssueSession(ctx, alice, coreid.SessionMetadata{DeviceLabel: "Laptop", UserAgent: "test-agent", IPAddress: "127.0.0.1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issued.Session.ID == 0 || issued.AccessToken == "" || issued.RefreshToken == "" {
+			t.Fatalf("issued = %+v", issued)
+		}
+		claims, err := tokens.ValidateToken(ctx, issued.AccessToken)
+		if err != nil || claims.SubjectUserID != alice.ID || claims.SessionID != issued.Session.ID {
+			t.Fatalf("claims = %+v, err = %v", claims, err)
+		}
+		if err := tokens.TouchSession(ctx, issued.Session.ID, coreid.SessionMetadata{IPAddress: "10.0.0.2"}); err != nil {
+			t.Fatal(err)
+		}
+
+		sessions, err := tokens.ListSessions(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 1 || sessions[0].DeviceLabel != "Laptop" || sessions[0].UserAgent != "test-agent" ||
+			sessions[0].LastSeenIP != "10.0.0.2" || sessions[0].RevokedAt != nil {
+			t.Fatalf("sessions = %+v", sessions)
+		}
+
+		if err := tokens.RevokeSession(ctx, alice.ID+1, issued.Session.ID); !errors.Is(err, coreid.ErrSessionNotFound) {
+			t.Fatalf("revoke by other user error = %v, want ErrSessionNotFound", err)
+		}
+		if err := tokens.RevokeSession(ctx, alice.ID, issued.Session.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tokens.ValidateToken(ctx, issued.AccessToken); err == nil {
+			t.Fatal("expected revoked session to fail validation")
+		}
+		if _, err := tokens.RefreshSession(ctx, issued.RefreshToken, coreid.SessionMetadata{}); !errors.Is(err, coreid.ErrInvalidRefreshToken) {
+			t.Fatalf("refresh after revoke error = %v, want ErrInvalidRefreshToken", err)
+		}
+	})
+
+	t.Run("refresh rotation and reuse", func(t *testing.T) {
+		tokens, alice := setup(t)
+		issued, err := tokens.IssueSession(ctx, alice, coreid.SessionMetadata{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tokens.RefreshSession(ctx, "not-a-token", coreid.SessionMetadata{}); !errors.Is(err, coreid.ErrInvalidRefreshToken) {
+			t.Fatalf("unknown token error = %v", err)
+		}
+		second, err := tokens.RefreshSession(ctx, issued.RefreshToken, coreid.SessionMetadata{UserAgent: "next"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		third, err := tokens.RefreshSession(ctx, second.RefreshToken, coreid.SessionMetadata{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second.Session.ID != issued.Session.ID || third.RefreshToken == second.RefreshToken || third.Session.UserAgent != "next" {
+			t.Fatalf("rotation = %+v then %+v", second.Session, third.Session)
+		}
+
+		// The first token is now only in the rotation history.
+		_, err = tokens.RefreshSession(ctx, issued.RefreshToken, coreid.SessionMetadata{})
+		var reuse *coreid.RefreshTokenReuseError
+		if !errors.As(err, &reuse) || reuse.UserID != alice.ID || len(reuse.SessionIDs) != 1 || reuse.SessionIDs[0] != issued.Session.ID {
+			t.Fatalf("reuse error = %#v", err)
+		}
+		if _, err := tokens.RefreshSession(ctx, third.RefreshToken, coreid.SessionMetadata{}); !errors.Is(err, coreid.ErrInvalidRefreshToken) {
+			t.Fatalf("refresh after reuse error = %v, want ErrInvalidRefreshToken", err)
+		}
+	})
+
+	t.Run("revoke other sessions", func(t *testing.T) {
+		tokens, alice := setup(t)
+		var ids []int64
+		for i := 0; i < 3; i++ {
+			issued, err := tokens.IssueSession(ctx, alice, coreid.SessionMetadata{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, issued.Session.ID)
+		}
+		revoked, err := tokens.RevokeUserSessions(ctx, alice.ID, ids[1], "password_changed")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revoked) != 2 {
+			t.Fatalf("revoked = %v", revoked)
+		}
+		sessions, err := tokens.ListSessions(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, session := range sessions {
+			if (session.ID == ids[1]) != (session.RevokedAt == nil) {
+				t.Fatalf("session %d revoked at %v", session.ID, session.RevokedAt)
+			}
+		}
+	})
+}
@@ -0,0 +1,7 @@
+-- The legacy invites and wallets tables are left as the up migration found
+-- them; invites and balances created since are dropped with the new tables.
+DROP INDEX IF EXISTS idx_contacts_unique_pair;
+DROP TABLE IF EXISTS message_deliveries;
+DROP TABLE IF EXISTS wallet_transfers;
+DROP TABLE IF EXISTS wallet_accounts;
+DROP TABLE IF EXISTS contact_invites;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS device_sessions;
+DROP TABLE IF EXISTS device_prekeys;
+DROP TABLE IF EXISTS device_identities;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_messages_recipient_device_id;
+DROP INDEX IF EXISTS idx_messages_sender_device_id;
+
+ALTER TABLE messages DROP COLUMN recipient_device_id;
+ALTER TABLE messages DROP COLUMN sender_device_id;
+ALTER TABLE messages DROP COLUMN encryption_version;
+ALTER TABLE messages DROP COLUMN ciphertext;
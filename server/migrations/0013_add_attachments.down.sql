@@ -0,0 +1,4 @@
+-- Blobs already written to ATTACHMENTS_DIR are not removed.
+DROP TABLE IF EXISTS message_attachments;
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS attachment_uploads;
@@ -0,0 +1,19 @@
+-- Derived image metadata. Pending rows are the durable work queue for the
+-- thumbnail pipeline; thumbnail_blob_id points into the same blob store as
+-- attachments.blob_id.
+CREATE TABLE IF NOT EXISTS attachment_media (
+    attachment_id INTEGER PRIMARY KEY REFERENCES attachments(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    placeholder TEXT NOT NULL DEFAULT '',
+    thumbnail_blob_id TEXT NOT NULL DEFAULT '',
+    thumbnail_mime_type TEXT NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_media_status
+    ON attachment_media (status, attachment_id);
@@ -0,0 +1,43 @@
+-- Full-text index over plaintext message bodies, keyed by messages.id (rowid).
+-- Rows that carry ciphertext are never indexed, even when a compatibility
+-- plaintext copy is stored, so the index cannot outlive ciphertext-at-rest.
+-- The index reads bodies from messages (external content), which needs a
+-- go-sqlite3 build with the sqlite_fts5 tag. Every 'delete' below repeats the
+-- insert condition because FTS5 must only be told to remove rows it indexed,
+-- and the 'rebuild' command must never be used: it would index every row.
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+    body,
+    tokenize = 'unicode61',
+    content = 'messages',
+    content_rowid = 'id'
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_insert
+AFTER INSERT ON messages
+WHEN NEW.ciphertext = '' AND NEW.body != ''
+BEGIN
+    INSERT INTO messages_fts (rowid, body) VALUES (NEW.id, NEW.body);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_update
+AFTER UPDATE OF body, ciphertext ON messages
+BEGIN
+    INSERT INTO messages_fts (messages_fts, rowid, body)
+    SELECT 'delete', OLD.id, OLD.body
+    WHERE OLD.ciphertext = '' AND OLD.body != '';
+    INSERT INTO messages_fts (rowid, body)
+    SELECT NEW.id, NEW.body
+    WHERE NEW.ciphertext = '' AND NEW.body != '';
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_delete
+AFTER DELETE ON messages
+WHEN OLD.ciphertext = '' AND OLD.body != ''
+BEGIN
+    INSERT INTO messages_fts (messages_fts, rowid, body) VALUES ('delete', OLD.id, OLD.body);
+END;
+
+INSERT INTO messages_fts (rowid, body)
+SELECT id, body
+FROM messages
+WHERE ciphertext = '' AND body != '';
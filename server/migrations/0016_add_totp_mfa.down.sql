@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS auth_mfa_challenges;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
@@ -0,0 +1,37 @@
+-- Opaque per-user WebAuthn user handle. Authenticators store it with
+-- discoverable credentials, so it must not reveal the username or user id.
+CREATE TABLE IF NOT EXISTS webauthn_user_handles (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    handle BLOB NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Registered passkeys. id is the base64url credential ID and public_key the
+-- COSE_Key captured at registration; sign_count tracks clone detection.
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    label TEXT NOT NULL DEFAULT '',
+    public_key BLOB NOT NULL,
+    algorithm INTEGER NOT NULL,
+    sign_count INTEGER NOT NULL DEFAULT 0,
+    aaguid TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id
+    ON webauthn_credentials (user_id, created_at);
+
+-- Single-use ceremony challenges. Login challenges have no user_id because
+-- discoverable-credential login does not ask for a username first.
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    challenge TEXT PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL CHECK (purpose IN ('registration', 'authentication')),
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_challenges_expires_at
+    ON webauthn_challenges (expires_at);
@@ -0,0 +1,12 @@
+-- Every refresh token a session has rotated out, stored as SHA-256 hashes.
+-- auth_sessions only keeps the current and previous hash; this table lets a
+-- refresh of any older token be recognised as reuse rather than an unknown
+-- token. Rows go away with their session.
+CREATE TABLE IF NOT EXISTS auth_refresh_token_history (
+    token_hash TEXT PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES auth_sessions(id) ON DELETE CASCADE,
+    rotated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_refresh_token_history_session_id
+    ON auth_refresh_token_history (session_id);
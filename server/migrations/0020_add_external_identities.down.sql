@@ -0,0 +1,4 @@
+-- Accounts created by a provider sign-in keep their empty password_hash and
+-- can only sign in again after a password reset.
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS user_external_identities;
@@ -0,0 +1,29 @@
+-- External (OIDC) identities linked to local accounts. An issuer/subject
+-- pair belongs to one account, and an account has at most one identity per
+-- issuer. Accounts created by a provider sign-in have an empty password_hash.
+CREATE TABLE IF NOT EXISTS user_external_identities (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at DATETIME,
+    UNIQUE (issuer, subject),
+    UNIQUE (user_id, issuer)
+);
+
+-- Pending authorization requests, keyed by a SHA-256 hash of the state
+-- parameter. user_id is set only when a signed-in user is linking.
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash TEXT PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL CHECK (purpose IN ('login', 'link')),
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_login_states_expires_at
+    ON oidc_login_states (expires_at);
@@ -0,0 +1,3 @@
+-- Bot users rows remain, without a way to authenticate.
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS bot_accounts;
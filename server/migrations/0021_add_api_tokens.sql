@@ -0,0 +1,27 @@
+-- Bot accounts are users rows with an empty password_hash that act only
+-- through API tokens created by their owner.
+CREATE TABLE IF NOT EXISTS bot_accounts (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    owner_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_bot_accounts_owner_user_id
+    ON bot_accounts (owner_user_id);
+
+-- Long-lived scoped API tokens, stored as SHA-256 hashes. scopes is a
+-- space-separated list; expires_at NULL means the token does not expire.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    expires_at DATETIME,
+    revoked_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id
+    ON api_tokens (user_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS push_jobs;
+DROP TABLE IF EXISTS push_mutes;
+DROP TABLE IF EXISTS push_settings;
+DROP TABLE IF EXISTS push_subscriptions;
@@ -0,0 +1,56 @@
+-- Web Push subscriptions, one per browser endpoint. Each is bound to the
+-- session that registered it and goes away with that session.
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id INTEGER NOT NULL REFERENCES auth_sessions(id) ON DELETE CASCADE,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh TEXT NOT NULL,
+    auth TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_subscriptions_user_id
+    ON push_subscriptions (user_id);
+
+-- Do-not-disturb and quiet hours. quiet_start_minute is NULL when quiet
+-- hours are off.
+CREATE TABLE IF NOT EXISTS push_settings (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    dnd_until DATETIME,
+    quiet_start_minute INTEGER,
+    quiet_end_minute INTEGER,
+    quiet_utc_offset_minutes INTEGER NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Per-conversation mutes; until is NULL for an indefinite mute.
+CREATE TABLE IF NOT EXISTS push_mutes (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    peer_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    until DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, peer_user_id)
+);
+
+-- The push send queue. Sent jobs are deleted; dead rows are kept for
+-- inspection until their subscription goes away.
+CREATE TABLE IF NOT EXISTS push_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER NOT NULL REFERENCES push_subscriptions(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    peer_user_id INTEGER NOT NULL,
+    topic TEXT NOT NULL DEFAULT '',
+    payload BLOB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_jobs_due
+    ON push_jobs (status, next_attempt_at);
+
+CREATE INDEX IF NOT EXISTS idx_push_jobs_subscription_id
+    ON push_jobs (subscription_id);
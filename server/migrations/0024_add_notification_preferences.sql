@@ -0,0 +1,30 @@
+-- Email notification preferences and digest scheduling. The address is
+-- user-supplied and receives nothing but the verification link until
+-- email_verified_at is set; only the verification token's hash is stored.
+-- The cursor columns record what earlier digests already reported.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL DEFAULT '',
+    email_verified_at DATETIME,
+    email_verify_hash TEXT NOT NULL DEFAULT '',
+    email_verify_expires_at DATETIME,
+    digest_enabled INTEGER NOT NULL DEFAULT 0,
+    digest_frequency TEXT NOT NULL DEFAULT 'daily',
+    unread_delay_minutes INTEGER NOT NULL DEFAULT 30,
+    include_messages INTEGER NOT NULL DEFAULT 1,
+    include_invites INTEGER NOT NULL DEFAULT 1,
+    include_transfers INTEGER NOT NULL DEFAULT 1,
+    next_digest_at DATETIME,
+    last_sent_at DATETIME,
+    messages_cursor DATETIME,
+    transfers_cursor DATETIME,
+    last_invite_id INTEGER NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_preferences_next_digest
+    ON notification_preferences (next_digest_at)
+    WHERE digest_enabled = 1 AND email_verified_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notification_preferences_verify_hash
+    ON notification_preferences (email_verify_hash);
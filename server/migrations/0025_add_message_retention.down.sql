@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_message_purges_purged_at;
+DROP INDEX IF EXISTS idx_message_purges_user;
+DROP TABLE IF EXISTS message_purges;
+DROP TABLE IF EXISTS thread_retention_settings;
+
+DROP INDEX IF EXISTS idx_messages_expires_at;
+ALTER TABLE messages DROP COLUMN expires_at;
@@ -0,0 +1,33 @@
+-- Disappearing messages and server-side retention. expires_at is set when a
+-- message is stored in a thread with a timer; the reaper deletes the row once
+-- it passes. Timers belong to the unordered pair of participants, stored
+-- with the lower user ID first. message_purges keeps one tombstone per
+-- participant so sync can tell every device which IDs are gone.
+ALTER TABLE messages ADD COLUMN expires_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at
+    ON messages (expires_at)
+    WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS thread_retention_settings (
+    user_low_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_high_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ttl_seconds INTEGER NOT NULL CHECK (ttl_seconds >= 0),
+    updated_by_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (user_low_id, user_high_id),
+    CHECK (user_low_id < user_high_id)
+);
+
+CREATE TABLE IF NOT EXISTS message_purges (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id INTEGER NOT NULL,
+    purged_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_purges_user
+    ON message_purges (user_id, id);
+
+CREATE INDEX IF NOT EXISTS idx_message_purges_purged_at
+    ON message_purges (purged_at);
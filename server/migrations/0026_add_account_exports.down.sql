@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_account_exports_status;
+DROP INDEX IF EXISTS idx_account_exports_user;
+DROP TABLE IF EXISTS account_exports;
+
+ALTER TABLE users DROP COLUMN deleted_at;
@@ -0,0 +1,26 @@
+-- Account data export and deletion. account_exports holds queued and
+-- finished archives; the archive is kept until expires_at so the user can
+-- download it more than once. A deleted account keeps its users row, renamed
+-- and with deleted_at set, because wallet_transfers and message history
+-- still reference it.
+ALTER TABLE users ADD COLUMN deleted_at DATETIME;
+
+CREATE TABLE IF NOT EXISTS account_exports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'ready', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    lease_until DATETIME,
+    archive BLOB,
+    size_bytes INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    completed_at DATETIME,
+    expires_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_exports_user
+    ON account_exports (user_id, id);
+
+CREATE INDEX IF NOT EXISTS idx_account_exports_status
+    ON account_exports (status, id);
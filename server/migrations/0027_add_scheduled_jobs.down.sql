@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_rate_limit_windows_start;
+DROP TABLE IF EXISTS rate_limit_windows;
+DROP TABLE IF EXISTS scheduled_jobs;
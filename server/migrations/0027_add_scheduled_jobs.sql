@@ -0,0 +1,31 @@
+-- Background job state. Each maintenance job has one row holding its next
+-- run, the lease that keeps two processes from running it at once, and
+-- counters for operators. rate_limit_windows was only ever created by the
+-- HTTP rate limiter on first use; it is declared here so the pruning job can
+-- rely on it, and indexed by window so pruning does not scan every key.
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+    name TEXT PRIMARY KEY,
+    next_run_at DATETIME NOT NULL,
+    lease_owner TEXT NOT NULL DEFAULT '',
+    lease_until DATETIME,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    runs INTEGER NOT NULL DEFAULT 0,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_started_at DATETIME,
+    last_finished_at DATETIME,
+    last_duration_ms INTEGER NOT NULL DEFAULT 0,
+    last_items INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS rate_limit_windows (
+    rate_key TEXT NOT NULL,
+    window_start_unix BIGINT NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    updated_at_unix BIGINT NOT NULL,
+    PRIMARY KEY (rate_key, window_start_unix)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_windows_start
+    ON rate_limit_windows (window_start_unix);
@@ -0,0 +1,31 @@
+DROP TABLE IF EXISTS invite_link_redemptions;
+DROP INDEX IF EXISTS idx_invite_links_user;
+DROP TABLE IF EXISTS invite_links;
+
+CREATE TABLE contact_invites_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    requester_id INTEGER NOT NULL,
+    recipient_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'rejected', 'cancelled')),
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (requester_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE,
+    CHECK (requester_id <> recipient_id)
+);
+
+INSERT INTO contact_invites_old (id, requester_id, recipient_id, status, created_at, updated_at)
+SELECT id, requester_id, recipient_id, CASE WHEN status = 'expired' THEN 'cancelled' ELSE status END, created_at, updated_at
+FROM contact_invites;
+
+DROP TABLE contact_invites;
+ALTER TABLE contact_invites_old RENAME TO contact_invites;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_contact_invites_pair_unique
+ON contact_invites (
+    CASE WHEN requester_id < recipient_id THEN requester_id ELSE recipient_id END,
+    CASE WHEN requester_id < recipient_id THEN recipient_id ELSE requester_id END
+);
+
+CREATE INDEX IF NOT EXISTS idx_contact_invites_recipient_status
+ON contact_invites (recipient_id, status);
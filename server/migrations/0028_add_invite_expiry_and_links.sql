@@ -0,0 +1,65 @@
+-- Invite expiry, cancellation and shareable invite links.
+--
+-- contact_invites is rebuilt because SQLite cannot change a CHECK
+-- constraint: the new 'expired' status is set by the invite_expiry job once
+-- expires_at passes. Existing invites expire 14 days after they were sent.
+-- The pair index still allows one row per pair of users; sending again after
+-- a cancel or expiry reuses that row.
+CREATE TABLE contact_invites_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    requester_id INTEGER NOT NULL,
+    recipient_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'rejected', 'cancelled', 'expired')),
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    FOREIGN KEY (requester_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE,
+    CHECK (requester_id <> recipient_id)
+);
+
+INSERT INTO contact_invites_new (id, requester_id, recipient_id, status, created_at, updated_at, expires_at)
+SELECT id, requester_id, recipient_id, status, created_at, updated_at, datetime(created_at, '+14 days')
+FROM contact_invites;
+
+DROP TABLE contact_invites;
+ALTER TABLE contact_invites_new RENAME TO contact_invites;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_contact_invites_pair_unique
+ON contact_invites (
+    CASE WHEN requester_id < recipient_id THEN requester_id ELSE recipient_id END,
+    CASE WHEN requester_id < recipient_id THEN recipient_id ELSE requester_id END
+);
+
+CREATE INDEX IF NOT EXISTS idx_contact_invites_recipient_status
+ON contact_invites (recipient_id, status);
+
+CREATE INDEX IF NOT EXISTS idx_contact_invites_requester_status
+ON contact_invites (requester_id, status);
+
+CREATE INDEX IF NOT EXISTS idx_contact_invites_status_expires
+ON contact_invites (status, expires_at);
+
+-- An invite link is identified by id and nonce; the code shared with people
+-- is both, signed with INVITE_LINK_SECRET, so it is never stored. max_uses
+-- bounds redemptions and each user can redeem a link once.
+CREATE TABLE IF NOT EXISTS invite_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    nonce TEXT NOT NULL,
+    max_uses INTEGER NOT NULL CHECK (max_uses > 0),
+    use_count INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_links_user
+    ON invite_links (user_id, id);
+
+CREATE TABLE IF NOT EXISTS invite_link_redemptions (
+    link_id INTEGER NOT NULL REFERENCES invite_links(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redeemed_at DATETIME NOT NULL,
+    PRIMARY KEY (link_id, user_id)
+);
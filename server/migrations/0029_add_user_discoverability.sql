@@ -0,0 +1,6 @@
+-- User directory search. discoverability decides who can find an account
+-- through /api/users/search: 'everyone' matches on prefix and fuzzy terms,
+-- 'username' only on the exact username, and 'nobody' never. Invites by
+-- exact username are unaffected.
+ALTER TABLE users ADD COLUMN discoverability TEXT NOT NULL DEFAULT 'everyone'
+    CHECK (discoverability IN ('everyone', 'username', 'nobody'));
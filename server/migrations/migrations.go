@@ -0,0 +1,41 @@
+// Package migrations embeds the SQL migration sets so the server and
+// cmd/migrate do not need the source tree at runtime.
+//
+// Each version is NNNN_name.sql with an optional NNNN_name.down.sql that
+// reverses it. Applied files must never be edited: the migration engine
+// records a checksum per version and refuses to run when one changes. Add a
+// new version instead.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+)
+
+//go:embed *.sql
+var sqliteFiles embed.FS
+
+//go:embed postgres/*.sql
+var postgresFiles embed.FS
+
+// SQLite is the migration set for the SQLite backend.
+func SQLite() fs.FS { return sqliteFiles }
+
+// Postgres is the migration set for the PostgreSQL backend.
+func Postgres() fs.FS {
+	sub, err := fs.Sub(postgresFiles, "postgres")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// For returns the migration set for d.
+func For(d dialect.Dialect) fs.FS {
+	if d == dialect.Postgres {
+		return Postgres()
+	}
+	return SQLite()
+}
@@ -0,0 +1,118 @@
+package migrations
+
+import (
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kyambuthia/go-chat-site/server/internal/migrate"
+	"github.com/kyambuthia/go-chat-site/server/internal/store"
+	"github.com/kyambuthia/go-chat-site/server/internal/store/dialect"
+)
+
+// sqliteOnlyTables are the tables of features the Postgres backend does not
+// serve; see postgresUnsupported in internal/app. A new SQLite table needs a
+// Postgres migration or an entry here, so the gap cannot widen unnoticed.
+var sqliteOnlyTables = map[string]string{
+	"account_exports":           "account export and deletion",
+	"api_tokens":                "API tokens",
+	"attachment_media":          "attachments",
+	"attachment_uploads":        "attachments",
+	"attachments":               "attachments",
+	"auth_mfa_challenges":       "two-factor",
+	"bot_accounts":              "API tokens",
+	"device_identities":         "device keys",
+	"device_prekeys":            "device keys",
+	"device_sessions":           "device keys",
+	"invite_link_redemptions":   "invite links",
+	"invite_links":              "invite links",
+	"message_attachments":       "attachments",
+	"message_purges":            "disappearing messages",
+	"messages_fts":              "message search",
+	"notification_preferences":  "email notifications",
+	"oidc_login_states":         "single sign-on",
+	"password_reset_tokens":     "password reset and change",
+	"push_jobs":                 "push",
+	"push_mutes":                "push",
+	"push_settings":             "push",
+	"push_subscriptions":        "push",
+	"thread_retention_settings": "disappearing messages",
+	"user_external_identities":  "single sign-on",
+	"user_recovery_codes":       "two-factor",
+	"user_totp":                 "two-factor",
+	"webauthn_challenges":       "passkeys",
+	"webauthn_credentials":      "passkeys",
+	"webauthn_user_handles":     "passkeys",
+	"webhook_deliveries":        "webhooks",
+	"webhook_endpoints":         "webhooks",
+}
+
+// legacyTables were superseded by 0007_refactor_core_schema and are no
+// longer read, so Postgres never had them.
+var legacyTables = map[string]bool{"invitations": true, "invites": true, "wallets": true}
+
+var createTable = regexp.MustCompile(`(?i)CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?(\w+)`)
+
+func TestSQLiteTablesHavePostgresCounterpartsOrAreListed(t *testing.T) {
+	s, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.DB.Close() })
+	if err := migrate.Apply(s.DB, SQLite(), dialect.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := s.DB.Query(`
+		SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE 'messages_fts_%' AND name != 'schema_migrations'
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var sqliteTables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		sqliteTables = append(sqliteTables, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	postgresTables := map[string]bool{}
+	files, err := fs.Glob(Postgres(), "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		if strings.HasSuffix(name, ".down.sql") {
+			continue
+		}
+		body, err := fs.ReadFile(Postgres(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range createTable.FindAllStringSubmatch(string(body), -1) {
+			postgresTables[strings.ToLower(m[1])] = true
+		}
+	}
+
+	sort.Strings(sqliteTables)
+	for _, table := range sqliteTables {
+		if legacyTables[table] {
+			continue
+		}
+		_, listed := sqliteOnlyTables[table]
+		switch {
+		case !postgresTables[table] && !listed:
+			t.Errorf("%s exists only in SQLite: add a Postgres migration or list it in sqliteOnlyTables", table)
+		case postgresTables[table] && listed:
+			t.Errorf("%s now has a Postgres table: remove it from sqliteOnlyTables", table)
+		}
+	}
+}
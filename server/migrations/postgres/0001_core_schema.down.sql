@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS rate_limit_windows;
+DROP TABLE IF EXISTS auth_login_throttles;
+DROP TABLE IF EXISTS auth_refresh_token_history;
+DROP TABLE IF EXISTS auth_sessions;
+DROP TABLE IF EXISTS message_client_correlations;
+DROP TABLE IF EXISTS message_deliveries;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS wallet_transfers;
+DROP TABLE IF EXISTS wallet_accounts;
+DROP TABLE IF EXISTS contact_invites;
+DROP TABLE IF EXISTS contacts;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,156 @@
+-- Core schema for the PostgreSQL backend. It matches the SQLite schema as of
+-- migration 0024 for the tables the Postgres adapters use: accounts, contacts
+-- and invites, the wallet ledger, direct messages and auth sessions. Features
+-- whose adapters are SQLite-only (MFA, passkeys, SSO, API tokens, device keys,
+-- attachments, search, webhooks, push and email digests) have no tables here.
+
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    display_name TEXT,
+    avatar_url TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS contacts (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    contact_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, contact_id),
+    CHECK (user_id <> contact_id)
+);
+
+-- One invite relationship per unordered user pair.
+CREATE TABLE IF NOT EXISTS contact_invites (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    requester_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'rejected', 'cancelled')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (requester_id <> recipient_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_contact_invites_pair_unique
+    ON contact_invites (LEAST(requester_id, recipient_id), GREATEST(requester_id, recipient_id));
+
+CREATE INDEX IF NOT EXISTS idx_contact_invites_recipient_status
+    ON contact_invites (recipient_id, status);
+
+CREATE TABLE IF NOT EXISTS wallet_accounts (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    balance_cents BIGINT NOT NULL DEFAULT 0 CHECK (balance_cents >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS wallet_transfers (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    sender_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    recipient_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    amount_cents BIGINT NOT NULL CHECK (amount_cents > 0),
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (sender_user_id <> recipient_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_transfers_sender_created
+    ON wallet_transfers (sender_user_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_transfers_recipient_created
+    ON wallet_transfers (recipient_user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    from_user_id BIGINT NOT NULL REFERENCES users(id),
+    to_user_id BIGINT NOT NULL REFERENCES users(id),
+    body TEXT NOT NULL DEFAULT '',
+    content_kind TEXT NOT NULL DEFAULT 'text',
+    ciphertext TEXT NOT NULL DEFAULT '',
+    encryption_version TEXT NOT NULL DEFAULT '',
+    sender_device_id BIGINT NOT NULL DEFAULT 0,
+    recipient_device_id BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_to_user_id
+    ON messages (to_user_id, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_messages_from_user_id
+    ON messages (from_user_id, id DESC);
+
+CREATE TABLE IF NOT EXISTS message_deliveries (
+    message_id BIGINT PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    delivered_at TIMESTAMPTZ,
+    read_at TIMESTAMPTZ,
+    CHECK (read_at IS NULL OR delivered_at IS NOT NULL)
+);
+
+CREATE TABLE IF NOT EXISTS message_client_correlations (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    sender_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_message_id BIGINT NOT NULL,
+    stored_message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    delivered BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (sender_user_id, client_message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_client_correlations_stored_message
+    ON message_client_correlations (stored_message_id);
+
+CREATE TABLE IF NOT EXISTS auth_sessions (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_label TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    last_seen_ip TEXT NOT NULL DEFAULT '',
+    current_refresh_hash TEXT NOT NULL UNIQUE,
+    previous_refresh_hash TEXT NOT NULL DEFAULT '',
+    access_token_expires_at TIMESTAMPTZ NOT NULL,
+    refresh_token_expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    refreshed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ,
+    revoke_reason TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_user_id_created_at
+    ON auth_sessions (user_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_refresh_expires_at
+    ON auth_sessions (refresh_token_expires_at);
+
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_previous_refresh_hash
+    ON auth_sessions (previous_refresh_hash);
+
+CREATE TABLE IF NOT EXISTS auth_refresh_token_history (
+    token_hash TEXT PRIMARY KEY,
+    session_id BIGINT NOT NULL REFERENCES auth_sessions(id) ON DELETE CASCADE,
+    rotated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_refresh_token_history_session_id
+    ON auth_refresh_token_history (session_id);
+
+-- The login throttle and shared rate limiter also create these on first use;
+-- declaring them here keeps the schema in one place.
+CREATE TABLE IF NOT EXISTS auth_login_throttles (
+    scope_key TEXT PRIMARY KEY,
+    failure_count INTEGER NOT NULL DEFAULT 0,
+    first_failed_at TIMESTAMPTZ,
+    locked_until TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS rate_limit_windows (
+    rate_key TEXT NOT NULL,
+    window_start_unix BIGINT NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    updated_at_unix BIGINT NOT NULL,
+    PRIMARY KEY (rate_key, window_start_unix)
+);
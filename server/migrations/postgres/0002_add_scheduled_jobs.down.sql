@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_rate_limit_windows_start;
+DROP TABLE IF EXISTS scheduled_jobs;
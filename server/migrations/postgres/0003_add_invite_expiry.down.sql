@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_contact_invites_status_expires;
+DROP INDEX IF EXISTS idx_contact_invites_requester_status;
+ALTER TABLE contact_invites DROP COLUMN IF EXISTS expires_at;
+UPDATE contact_invites SET status = 'cancelled' WHERE status = 'expired';
+ALTER TABLE contact_invites DROP CONSTRAINT IF EXISTS contact_invites_status_check;
+ALTER TABLE contact_invites ADD CONSTRAINT contact_invites_status_check
+    CHECK (status IN ('pending', 'accepted', 'rejected', 'cancelled'));
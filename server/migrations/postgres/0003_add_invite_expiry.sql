@@ -0,0 +1,13 @@
+-- Invite expiry and cancellation, matching SQLite migration 0028. Invite
+-- links are SQLite-only for now.
+ALTER TABLE contact_invites DROP CONSTRAINT IF EXISTS contact_invites_status_check;
+ALTER TABLE contact_invites ADD CONSTRAINT contact_invites_status_check
+    CHECK (status IN ('pending', 'accepted', 'rejected', 'cancelled', 'expired'));
+ALTER TABLE contact_invites ADD COLUMN expires_at TIMESTAMPTZ;
+UPDATE contact_invites SET expires_at = created_at + INTERVAL '14 days';
+
+CREATE INDEX IF NOT EXISTS idx_contact_invites_requester_status
+    ON contact_invites (requester_id, status);
+
+CREATE INDEX IF NOT EXISTS idx_contact_invites_status_expires
+    ON contact_invites (status, expires_at);